@@ -0,0 +1,159 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/types"
+	pb "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+	"go.uber.org/zap"
+)
+
+// Modes of handling the protobuf binlogs arbiter doesn't fully understand, which
+// are usually produced by a drainer newer than arbiter.
+const (
+	// CompatTolerant loads what arbiter understands of the binlogs, the unknown fields
+	// are ignored, the mutations of unknown types are skipped, and the values of the
+	// unknown column types are loaded as they are. Every kind of them is logged once.
+	CompatTolerant = "tolerant"
+	// CompatStrict stops arbiter at the first binlog it doesn't fully understand.
+	CompatStrict = "strict"
+)
+
+// knownColumnTypes are the column types set by drainer in ColumnInfo.MysqlType.
+var knownColumnTypes = func() map[string]struct{} {
+	known := make(map[string]struct{})
+	for tp := 0; tp < 256; tp++ {
+		for _, cs := range []string{"", "binary"} {
+			if str := types.TypeToStr(byte(tp), cs); len(str) > 0 {
+				known[str] = struct{}{}
+			}
+		}
+	}
+	return known
+}()
+
+// compatChecker checks whether the protobuf binlogs are fully understood by arbiter.
+// The methods of a nil compatChecker do nothing, it's used for the formats other than
+// protobuf, whose binlogs are built by arbiter itself.
+type compatChecker struct {
+	strict bool
+	// logged is the problems logged in tolerant mode.
+	logged map[string]struct{}
+}
+
+func newCompatChecker(mode string) *compatChecker {
+	return &compatChecker{
+		strict: mode == CompatStrict,
+		logged: make(map[string]struct{}),
+	}
+}
+
+// check returns an error if the binlog isn't fully understood in strict mode, in tolerant
+// mode it logs the problems not logged before and drops the mutations of unknown types.
+func (c *compatChecker) check(binlog *pb.Binlog) error {
+	if c == nil {
+		return nil
+	}
+	problems := incompatibilities(binlog)
+	if len(problems) == 0 {
+		return nil
+	}
+	if c.strict {
+		return errors.Errorf("binlog of commit ts %d isn't fully understood: %s, it may be produced by a newer drainer, upgrade arbiter or set up.compatibility to %q to load it anyway",
+			binlog.CommitTs, problems[0], CompatTolerant)
+	}
+
+	incompatibleCounter.Inc()
+	for _, problem := range problems {
+		if _, ok := c.logged[problem]; ok {
+			continue
+		}
+		c.logged[problem] = struct{}{}
+		log.Warn("binlog isn't fully understood, it may be produced by a newer drainer, ignore what's unknown",
+			zap.String("problem", problem), zap.Int64("commit ts", binlog.CommitTs))
+	}
+	dropUnknownMutations(binlog)
+	return nil
+}
+
+// incompatibilities returns what arbiter doesn't understand of the binlog.
+func incompatibilities(binlog *pb.Binlog) []string {
+	var problems []string
+	unknownFields := func(msg string, fields []byte) {
+		if len(fields) > 0 {
+			problems = append(problems, "unknown fields of "+msg)
+		}
+	}
+
+	unknownFields("Binlog", binlog.XXX_unrecognized)
+	switch binlog.Type {
+	case pb.BinlogType_DML:
+	case pb.BinlogType_DDL:
+		if binlog.DdlData != nil {
+			unknownFields("DDLData", binlog.DdlData.XXX_unrecognized)
+		}
+		return problems
+	default:
+		return append(problems, fmt.Sprintf("unknown binlog type %d", binlog.Type))
+	}
+	if binlog.DmlData == nil {
+		return problems
+	}
+
+	unknownFields("DMLData", binlog.DmlData.XXX_unrecognized)
+	for _, table := range binlog.DmlData.Tables {
+		name := fmt.Sprintf("%s.%s", table.GetSchemaName(), table.GetTableName())
+		unknownFields("Table "+name, table.XXX_unrecognized)
+		for _, info := range table.ColumnInfo {
+			unknownFields(fmt.Sprintf("ColumnInfo of %s.%s", name, info.Name), info.XXX_unrecognized)
+			if _, ok := knownColumnTypes[info.MysqlType]; !ok {
+				problems = append(problems, fmt.Sprintf("unknown type %s of column %s.%s", info.MysqlType, name, info.Name))
+			}
+		}
+		for _, mut := range table.Mutations {
+			if _, ok := pb.MutationType_name[int32(mut.GetType())]; !ok {
+				problems = append(problems, fmt.Sprintf("unknown mutation type %d of table %s", mut.GetType(), name))
+				continue
+			}
+			unknownFields("TableMutation of "+name, mut.XXX_unrecognized)
+			for _, row := range []*pb.Row{mut.Row, mut.ChangeRow} {
+				if row == nil {
+					continue
+				}
+				unknownFields("Row of "+name, row.XXX_unrecognized)
+				for _, col := range row.Columns {
+					unknownFields("Column of "+name, col.XXX_unrecognized)
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// dropUnknownMutations drops the mutations of unknown types, which can't be loaded.
+func dropUnknownMutations(binlog *pb.Binlog) {
+	for _, table := range binlog.GetDmlData().GetTables() {
+		muts := table.Mutations[:0]
+		for _, mut := range table.Mutations {
+			if _, ok := pb.MutationType_name[int32(mut.GetType())]; ok {
+				muts = append(muts, mut)
+			}
+		}
+		table.Mutations = muts
+	}
+}
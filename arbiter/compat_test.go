@@ -0,0 +1,86 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	. "github.com/pingcap/check"
+	pb "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+)
+
+type compatSuite struct{}
+
+var _ = Suite(&compatSuite{})
+
+func (s *compatSuite) newBinlog() *pb.Binlog {
+	schema, table := "test", "t"
+	id := int64(1)
+	insert, unknown := pb.MutationType_Insert, pb.MutationType(10)
+	return &pb.Binlog{
+		Type:     pb.BinlogType_DML,
+		CommitTs: 10,
+		DmlData: &pb.DMLData{Tables: []*pb.Table{{
+			SchemaName: &schema,
+			TableName:  &table,
+			ColumnInfo: []*pb.ColumnInfo{{Name: "id", MysqlType: "int"}, {Name: "v", MysqlType: "varchar"}},
+			Mutations: []*pb.TableMutation{
+				{Type: &insert, Row: &pb.Row{Columns: []*pb.Column{{Int64Value: &id}, {StringValue: &schema}}}},
+				{Type: &unknown, Row: &pb.Row{}},
+			},
+		}}},
+	}
+}
+
+func (s *compatSuite) TestUnknownFields(c *C) {
+	data, err := (&pb.Binlog{Type: pb.BinlogType_DDL, CommitTs: 10}).Marshal()
+	c.Assert(err, IsNil)
+	// field 100 of varint 1 added by a newer drainer.
+	data = append(data, 0xa0, 0x06, 0x01)
+	binlog, err := protobufDecoder{}.Decode(nil, data)
+	c.Assert(err, IsNil)
+	c.Assert(incompatibilities(binlog), DeepEquals, []string{"unknown fields of Binlog"})
+
+	c.Assert(newCompatChecker(CompatStrict).check(binlog), ErrorMatches, "binlog of commit ts 10 isn't fully understood: unknown fields of Binlog.*")
+	c.Assert(newCompatChecker(CompatTolerant).check(binlog), IsNil)
+
+	var checker *compatChecker
+	c.Assert(checker.check(binlog), IsNil)
+}
+
+func (s *compatSuite) TestTolerant(c *C) {
+	binlog := s.newBinlog()
+	table := binlog.DmlData.Tables[0]
+	table.ColumnInfo[1].MysqlType = "vector"
+	table.Mutations[0].Row.Columns[1].XXX_unrecognized = []byte{0xa0, 0x06, 0x01}
+	c.Assert(incompatibilities(binlog), DeepEquals, []string{
+		"unknown type vector of column test.t.v",
+		"unknown fields of Column of test.t",
+		"unknown mutation type 10 of table test.t",
+	})
+
+	checker := newCompatChecker(CompatTolerant)
+	c.Assert(checker.check(binlog), IsNil)
+	// only the mutations of unknown types are dropped.
+	c.Assert(table.Mutations, HasLen, 1)
+	c.Assert(table.Mutations[0].GetType(), Equals, pb.MutationType_Insert)
+	c.Assert(checker.logged, HasLen, 3)
+	c.Assert(checker.check(s.newBinlog()), IsNil)
+	c.Assert(checker.logged, HasLen, 3)
+
+	binlog = s.newBinlog()
+	c.Assert(newCompatChecker(CompatStrict).check(binlog), ErrorMatches, ".*unknown mutation type 10 of table test.t.*")
+	c.Assert(binlog.DmlData.Tables[0].Mutations, HasLen, 2)
+
+	binlog.DmlData.Tables[0].Mutations = binlog.DmlData.Tables[0].Mutations[:1]
+	c.Assert(newCompatChecker(CompatStrict).check(binlog), IsNil)
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb-binlog/pkg/version"
 	"go.uber.org/zap"
@@ -47,6 +48,9 @@ type Config struct {
 	Up   UpConfig   `toml:"up" json:"up"`
 	Down DownConfig `toml:"down" json:"down"`
 
+	DeadLetter  DeadLetterConfig  `toml:"dead-letter" json:"dead-letter"`
+	FlowControl FlowControlConfig `toml:"flow-control" json:"flow-control"`
+
 	Metrics      Metrics `toml:"metrics" json:"metrics"`
 	configFile   string
 	printVersion bool
@@ -62,11 +66,26 @@ type Metrics struct {
 type UpConfig struct {
 	KafkaAddrs   string `toml:"kafka-addrs" json:"kafka-addrs"`
 	KafkaVersion string `toml:"kafka-version" json:"kafka-version"`
+	// MessageFormat is the format of the messages in the topic, can be
+	// "protobuf", "canal-json" or "debezium"
+	MessageFormat string `toml:"message-format" json:"message-format"`
+	// Compatibility is how the protobuf binlogs not fully understood are handled,
+	// can be "tolerant" or "strict"
+	Compatibility string `toml:"compatibility" json:"compatibility"`
 
 	InitialCommitTS   int64  `toml:"initial-commit-ts" json:"initial-commit-ts"`
 	Topic             string `toml:"topic" json:"topic"`
 	MessageBufferSize int    `toml:"message-buffer-size" json:"message-buffer-size"`
 	SaramaBufferSize  int    `toml:"sarama-buffer-size" json:"sarama-buffer-size"`
+	// Partitions are the partitions of the topic to read, the binlogs of them are merged by commit ts
+	// and checkpointed together, the parts of a binlog in them are merged into one. Only partition 0 is
+	// read if it's empty for protobuf, and all the partitions for the other formats.
+	Partitions []int32 `toml:"partitions" json:"partitions"`
+	// Watermarks means every partition of canal-json has the TIDB_WATERMARK messages of TiCDC, which is
+	// required to read more than one partition of canal-json.
+	Watermarks bool `toml:"watermarks" json:"watermarks"`
+	// SkipUndecodable skips the messages failed to be decoded instead of stopping arbiter.
+	SkipUndecodable bool `toml:"skip-undecodable" json:"skip-undecodable"`
 }
 
 // DownConfig is configuration of downstream
@@ -79,6 +98,18 @@ type DownConfig struct {
 	WorkerCount int  `toml:"worker-count" json:"worker-count"`
 	BatchSize   int  `toml:"batch-size" json:"batch-size"`
 	SafeMode    bool `toml:"safe-mode" json:"safe-mode"`
+
+	// MaxOpenConns and MaxIdleConns limit the connection pool of downstream, they're the worker
+	// count by default. ConnMaxLifetime is the max seconds a connection is reused, zero means forever.
+	MaxOpenConns    int `toml:"max-open-conns" json:"max-open-conns"`
+	MaxIdleConns    int `toml:"max-idle-conns" json:"max-idle-conns"`
+	ConnMaxLifetime int `toml:"conn-max-lifetime" json:"conn-max-lifetime"`
+	// IsolationLevel is the isolation level of the transactions executing DMLs, like "READ-COMMITTED".
+	IsolationLevel string `toml:"isolation-level" json:"isolation-level"`
+
+	// TransformPlugin is the path of the Go plugin exporting the Transform function
+	// applied to each txn before loading.
+	TransformPlugin string `toml:"transform-plugin" json:"transform-plugin"`
 }
 
 // NewConfig return an instance of configuration
@@ -102,11 +133,21 @@ func NewConfig() *Config {
 
 	fs.Int64Var(&cfg.Up.InitialCommitTS, "up.initial-commit-ts", 0, "if arbiter doesn't have checkpoint, use initial commitTS to initial checkpoint")
 	fs.StringVar(&cfg.Up.Topic, "up.topic", "", "topic name of kafka")
+	fs.StringVar(&cfg.Up.MessageFormat, "up.message-format", FormatProtobuf, "format of the messages in the topic: protobuf, canal-json or debezium")
+	fs.StringVar(&cfg.Up.Compatibility, "up.compatibility", CompatTolerant, "how the protobuf binlogs produced by a newer drainer are handled: tolerant ignores what's unknown, strict stops arbiter")
 
 	fs.IntVar(&cfg.Down.WorkerCount, "down.worker-count", 16, "concurrency write to downstream")
 	fs.IntVar(&cfg.Down.BatchSize, "down.batch-size", 64, "batch size write to downstream")
+	fs.StringVar(&cfg.Down.TransformPlugin, "down.transform-plugin", "", "path of the Go plugin exporting the Transform function applied to each txn before loading")
 	fs.BoolVar(&cfg.Down.SafeMode, "safe-mode", false, "enable safe mode to make reentrant")
 
+	fs.StringVar(&cfg.DeadLetter.Topic, "dead-letter.topic", "", "kafka topic to produce the binlogs failed to be decoded, transformed or loaded to, instead of stopping arbiter")
+	fs.BoolVar(&cfg.DeadLetter.Replay, "dead-letter.replay", false, "load the binlogs in the dead-letter topic to downstream in safe mode and exit")
+	fs.Int64Var(&cfg.DeadLetter.ReplayOffset, "dead-letter.replay-offset", -2, "offset of the dead-letter topic to replay from, -2 means the oldest one")
+
+	fs.IntVar(&cfg.FlowControl.MaxLag, "flow-control.max-lag", 0, "max seconds a binlog read from kafka can wait to be loaded before arbiter is lagging, 0 means no limit")
+	fs.StringVar(&cfg.FlowControl.LagWebhook, "flow-control.lag-webhook", "", "URL to POST to when arbiter starts and stops lagging")
+
 	return cfg
 }
 
@@ -169,6 +210,58 @@ func (cfg *Config) validate() error {
 		return errUpTopicNotSpecified
 	}
 
+	switch cfg.Up.MessageFormat {
+	case FormatProtobuf, FormatCanalJSON, FormatDebezium:
+	default:
+		return errors.Errorf("unsupported up.message-format: %s", cfg.Up.MessageFormat)
+	}
+
+	switch cfg.Up.Compatibility {
+	case "", CompatTolerant, CompatStrict:
+	default:
+		return errors.Errorf("unsupported up.compatibility: %s, must be %s or %s", cfg.Up.Compatibility, CompatTolerant, CompatStrict)
+	}
+
+	if cfg.Up.Watermarks && cfg.Up.MessageFormat != FormatCanalJSON {
+		return errors.Errorf("up.watermarks is only for the format %s, the format is %s", FormatCanalJSON, cfg.Up.MessageFormat)
+	}
+
+	seen := make(map[int32]struct{}, len(cfg.Up.Partitions))
+	for _, p := range cfg.Up.Partitions {
+		if p < 0 {
+			return errors.Errorf("invalid partition %d in up.partitions", p)
+		}
+		if _, ok := seen[p]; ok {
+			return errors.Errorf("duplicate partition %d in up.partitions", p)
+		}
+		seen[p] = struct{}{}
+	}
+
+	if cfg.Down.MaxOpenConns < 0 || cfg.Down.MaxIdleConns < 0 || cfg.Down.ConnMaxLifetime < 0 {
+		return errors.New("down.max-open-conns, down.max-idle-conns and down.conn-max-lifetime can't be negative")
+	}
+	if _, err := loader.ParseIsolationLevel(cfg.Down.IsolationLevel); err != nil {
+		return errors.Trace(err)
+	}
+
+	if cfg.DeadLetter.Replay && !cfg.DeadLetter.enabled() {
+		return errors.New("dead-letter.topic must be set to replay the dead letters")
+	}
+	if cfg.DeadLetter.enabled() && cfg.DeadLetter.Topic == cfg.Up.Topic {
+		return errors.New("dead-letter.topic can't be the same as up.topic")
+	}
+
+	flow := cfg.FlowControl
+	if flow.MaxLag < 0 || flow.MaxDownstreamErrors < 0 || flow.PauseSeconds < 0 {
+		return errors.New("flow-control.max-lag, flow-control.max-downstream-errors and flow-control.pause-seconds can't be negative")
+	}
+	if len(flow.LagWebhook) > 0 && flow.MaxLag == 0 {
+		return errors.New("flow-control.max-lag must be set to call flow-control.lag-webhook")
+	}
+	if flow.MaxDownstreamErrors > 0 && !cfg.DeadLetter.enabled() {
+		return errors.New("dead-letter.topic must be set to pause on flow-control.max-downstream-errors, arbiter quits on the first error without it")
+	}
+
 	return nil
 }
 
@@ -180,6 +273,25 @@ func (cfg *Config) adjustConfig() error {
 	if len(cfg.Up.KafkaVersion) == 0 {
 		cfg.Up.KafkaVersion = defaultKafkaVersion
 	}
+	if len(cfg.Up.MessageFormat) == 0 {
+		cfg.Up.MessageFormat = FormatProtobuf
+	}
+	if len(cfg.Up.Compatibility) == 0 {
+		cfg.Up.Compatibility = CompatTolerant
+	}
+
+	// cfg.DeadLetter
+	if len(cfg.DeadLetter.KafkaAddrs) == 0 {
+		cfg.DeadLetter.KafkaAddrs = cfg.Up.KafkaAddrs
+	}
+	if len(cfg.DeadLetter.KafkaVersion) == 0 {
+		cfg.DeadLetter.KafkaVersion = cfg.Up.KafkaVersion
+	}
+
+	// cfg.FlowControl
+	if cfg.FlowControl.PauseSeconds == 0 {
+		cfg.FlowControl.PauseSeconds = defaultPauseSeconds
+	}
 
 	// cfg.Down
 	if len(cfg.Down.Host) == 0 {
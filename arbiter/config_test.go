@@ -69,6 +69,7 @@ func (t *TestConfigSuite) TestParseConfig(c *check.C) {
 	c.Assert(config.Up.KafkaVersion, check.Equals, defaultKafkaVersion)
 	c.Assert(config.Up.InitialCommitTS, check.Equals, int64(0))
 	c.Assert(config.Up.Topic, check.Equals, upTopic)
+	c.Assert(config.Up.MessageFormat, check.Equals, FormatProtobuf)
 	c.Assert(config.Down.Host, check.Equals, "localhost")
 	c.Assert(config.Down.Port, check.Equals, 3306)
 	c.Assert(config.Down.User, check.Equals, "root")
@@ -106,6 +107,68 @@ func (t *TestConfigSuite) TestParseConfig(c *check.C) {
 
 	// simply verify json string
 	c.Assert(strings.Contains(config.String(), listenAddr), check.IsTrue)
+
+	config = NewConfig()
+	err = config.Parse(append(args, "-up.message-format=canal-json"))
+	c.Assert(err, check.IsNil)
+	c.Assert(config.Up.MessageFormat, check.Equals, FormatCanalJSON)
+
+	config = NewConfig()
+	err = config.Parse(append(args, "-up.message-format=avro"))
+	c.Assert(err, check.ErrorMatches, ".*unsupported up.message-format: avro.*")
+}
+
+func (t *TestConfigSuite) TestValidatePartitions(c *check.C) {
+	cfg := &Config{Up: UpConfig{Topic: "test", MessageFormat: FormatProtobuf, Partitions: []int32{0, 2}}}
+	c.Assert(cfg.validate(), check.IsNil)
+
+	cfg.Up.Partitions = []int32{0, -1}
+	c.Assert(cfg.validate(), check.ErrorMatches, "invalid partition -1.*")
+
+	cfg.Up.Partitions = []int32{1, 0, 1}
+	c.Assert(cfg.validate(), check.ErrorMatches, "duplicate partition 1.*")
+}
+
+func (t *TestConfigSuite) TestValidateWatermarks(c *check.C) {
+	cfg := &Config{Up: UpConfig{Topic: "test", MessageFormat: FormatCanalJSON, Watermarks: true}}
+	c.Assert(cfg.validate(), check.IsNil)
+
+	cfg.Up.MessageFormat = FormatDebezium
+	c.Assert(cfg.validate(), check.ErrorMatches, "up.watermarks is only for the format canal-json.*")
+}
+
+func (t *TestConfigSuite) TestDeadLetterConfig(c *check.C) {
+	cfg := &Config{Up: UpConfig{Topic: "test", KafkaAddrs: "192.168.0.1:9092"}}
+	c.Assert(cfg.adjustConfig(), check.IsNil)
+	c.Assert(cfg.DeadLetter.KafkaAddrs, check.Equals, "192.168.0.1:9092")
+	c.Assert(cfg.DeadLetter.KafkaVersion, check.Equals, defaultKafkaVersion)
+	c.Assert(cfg.validate(), check.IsNil)
+
+	cfg.DeadLetter.Replay = true
+	c.Assert(cfg.validate(), check.ErrorMatches, "dead-letter.topic must be set.*")
+	cfg.DeadLetter.Topic = "test"
+	c.Assert(cfg.validate(), check.ErrorMatches, "dead-letter.topic can't be the same as up.topic")
+	cfg.DeadLetter.Topic = "test_dead_letter"
+	c.Assert(cfg.validate(), check.IsNil)
+}
+
+func (t *TestConfigSuite) TestFlowControlConfig(c *check.C) {
+	cfg := &Config{Up: UpConfig{Topic: "test"}}
+	c.Assert(cfg.adjustConfig(), check.IsNil)
+	c.Assert(cfg.FlowControl.PauseSeconds, check.Equals, defaultPauseSeconds)
+	c.Assert(cfg.validate(), check.IsNil)
+
+	cfg.FlowControl.LagWebhook = "http://127.0.0.1:8080/scale"
+	c.Assert(cfg.validate(), check.ErrorMatches, "flow-control.max-lag must be set.*")
+	cfg.FlowControl.MaxLag = -1
+	c.Assert(cfg.validate(), check.ErrorMatches, ".*can't be negative")
+	cfg.FlowControl.MaxLag = 60
+	c.Assert(cfg.validate(), check.IsNil)
+
+	cfg.FlowControl.MaxDownstreamErrors = 100
+	c.Assert(cfg.validate(), check.ErrorMatches, "dead-letter.topic must be set to pause.*")
+	cfg.DeadLetter.Topic = "test_dead_letter"
+	c.Assert(cfg.validate(), check.IsNil)
 }
 
 func (t *TestConfigSuite) TestParseConfigFileWithInvalidArgs(c *check.C) {
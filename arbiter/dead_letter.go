@@ -0,0 +1,275 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tidb-tools/tidb-binlog/driver/reader"
+	pb "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+	"go.uber.org/zap"
+)
+
+// The stages a message fails at.
+const (
+	stageDecode    = "decode"
+	stageTransform = "transform"
+	stageLoad      = "load"
+)
+
+// DeadLetterConfig is the configuration of the dead-letter topic, the messages failed
+// to be decoded, transformed or loaded are produced to it instead of stopping arbiter.
+type DeadLetterConfig struct {
+	// Topic is the dead-letter topic, it's disabled if empty.
+	Topic        string `toml:"topic" json:"topic"`
+	KafkaAddrs   string `toml:"kafka-addrs" json:"kafka-addrs"`
+	KafkaVersion string `toml:"kafka-version" json:"kafka-version"`
+
+	// Replay is set to load the messages in the dead-letter topic to downstream and exit,
+	// from the offset ReplayOffset.
+	Replay       bool  `toml:"-" json:"-"`
+	ReplayOffset int64 `toml:"-" json:"-"`
+}
+
+func (c *DeadLetterConfig) enabled() bool {
+	return len(c.Topic) > 0
+}
+
+// deadLetter is the message produced to the dead-letter topic, Binlog is the failed
+// binlog encoded by protobuf whatever the format of the upstream topic is.
+type deadLetter struct {
+	Topic    string    `json:"topic"`
+	Offset   int64     `json:"offset"`
+	CommitTS int64     `json:"commit-ts"`
+	Stage    string    `json:"stage"`
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+	Binlog   []byte    `json:"binlog"`
+}
+
+var newSyncProducer = sarama.NewSyncProducer
+
+// deadLetterWriter produces the failed messages to partition 0 of the dead-letter topic,
+// so they're replayed in order.
+type deadLetterWriter struct {
+	topic    string
+	upTopic  string
+	producer sarama.SyncProducer
+}
+
+func newDeadLetterWriter(cfg *DeadLetterConfig, upTopic string) (*deadLetterWriter, error) {
+	conf, err := util.NewSaramaConfig(cfg.KafkaVersion, "arbiter.dead_letter.")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	conf.Producer.Return.Successes = true
+	conf.Producer.RequiredAcks = sarama.WaitForAll
+	conf.Producer.Partitioner = sarama.NewManualPartitioner
+
+	producer, err := newSyncProducer(strings.Split(cfg.KafkaAddrs, ","), conf)
+	if err != nil {
+		return nil, errors.Annotatef(err, "create producer of dead-letter topic %s", cfg.Topic)
+	}
+	return &deadLetterWriter{topic: cfg.Topic, upTopic: upTopic, producer: producer}, nil
+}
+
+// write produces the message failed at the stage with the cause, an error is returned if
+// it can't be produced, then arbiter stops.
+func (w *deadLetterWriter) write(msg *reader.Message, stage string, cause error) error {
+	data, err := msg.Binlog.Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	value, err := json.Marshal(&deadLetter{
+		Topic:    w.upTopic,
+		Offset:   msg.Offset,
+		CommitTS: msg.Binlog.CommitTs,
+		Stage:    stage,
+		Error:    cause.Error(),
+		Time:     time.Now(),
+		Binlog:   data,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	_, offset, err := w.producer.SendMessage(&sarama.ProducerMessage{Topic: w.topic, Partition: 0, Value: sarama.ByteEncoder(value)})
+	if err != nil {
+		return errors.Annotatef(err, "produce binlog %d to dead-letter topic %s, cause: %v", msg.Binlog.CommitTs, w.topic, cause)
+	}
+	deadLetterCounter.WithLabelValues(stage).Inc()
+	log.Warn("produce binlog to dead-letter topic", zap.String("stage", stage), zap.Int64("ts", msg.Binlog.CommitTs),
+		zap.Int64("offset", msg.Offset), zap.Int64("dead-letter offset", offset), zap.NamedError("cause", cause))
+	return nil
+}
+
+// handleFailedTxn is the loader.FailedTxnHandler, only the txns rejected by downstream are
+// produced to the dead-letter topic, the other errors like the connection lost stop arbiter.
+func (w *deadLetterWriter) handleFailedTxn(txn *loader.Txn, err error) error {
+	msg, ok := txn.Metadata.(*reader.Message)
+	if !ok || !isRejectedByDownstream(err) {
+		return err
+	}
+	return w.write(msg, stageLoad, err)
+}
+
+func isRejectedByDownstream(err error) bool {
+	if errors.IsNotFound(err) {
+		return true
+	}
+	_, ok := errors.Cause(err).(*mysql.MySQLError)
+	return ok
+}
+
+func (w *deadLetterWriter) close() {
+	if err := w.producer.Close(); err != nil {
+		log.Warn("close producer of dead-letter topic failed", zap.Error(err))
+	}
+}
+
+// ReplayDeadLetters loads the binlogs in the dead-letter topic from the offset to the newest
+// one when it's called to downstream in safe mode, it stops at the first failure. It's used
+// after the failed binlogs or downstream are fixed.
+func ReplayDeadLetters(cfg *Config) error {
+	down := cfg.Down
+	db, err := createDB(down.User, down.Password, down.Host, down.Port, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer db.Close()
+
+	var transform Transform
+	if len(down.TransformPlugin) > 0 {
+		if transform, err = LoadTransform(down.TransformPlugin); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	conf, err := util.NewSaramaConfig(cfg.DeadLetter.KafkaVersion, "arbiter.dead_letter.")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	client, err := sarama.NewClient(strings.Split(cfg.DeadLetter.KafkaAddrs, ","), conf)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer client.Close()
+	newest, err := client.GetOffset(cfg.DeadLetter.Topic, 0, sarama.OffsetNewest)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	start := cfg.DeadLetter.ReplayOffset
+	if start < 0 {
+		if start, err = client.GetOffset(cfg.DeadLetter.Topic, 0, sarama.OffsetOldest); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if start >= newest {
+		log.Info("no dead letter to replay", zap.String("topic", cfg.DeadLetter.Topic), zap.Int64("offset", start))
+		return nil
+	}
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer consumer.Close()
+	pc, err := consumer.ConsumePartition(cfg.DeadLetter.Topic, 0, start)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer pc.Close()
+
+	ld, err := newLoader(db, loader.WorkerCount(down.WorkerCount), loader.BatchSize(down.BatchSize))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	ld.SetSafeMode(true)
+
+	return errors.Trace(replayDeadLetters(pc.Messages(), newest, ld, transform))
+}
+
+// replayDeadLetters loads the binlogs of the messages before the offset end.
+func replayDeadLetters(source <-chan *sarama.ConsumerMessage, end int64, ld loader.Loader, transform Transform) error {
+	var runErr error
+	stopped := make(chan struct{})
+	go func() {
+		runErr = ld.Run()
+		close(stopped)
+	}()
+
+	var replayed int64 = -1
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for txn := range ld.Successes() {
+			replayed = txn.Metadata.(*sarama.ConsumerMessage).Offset
+		}
+	}()
+
+	err := sendDeadLetters(source, end, ld, transform, stopped)
+	ld.Close()
+	<-stopped
+	<-done
+	if err == nil {
+		err = runErr
+	}
+	if err != nil {
+		log.Error("replay dead letters failed", zap.Int64("last replayed offset", replayed), zap.Error(err))
+		return errors.Trace(err)
+	}
+	log.Info("replay dead letters success", zap.Int64("last replayed offset", replayed))
+	return nil
+}
+
+func sendDeadLetters(source <-chan *sarama.ConsumerMessage, end int64, ld loader.Loader, transform Transform, stopped <-chan struct{}) error {
+	for kmsg := range source {
+		var letter deadLetter
+		if err := json.Unmarshal(kmsg.Value, &letter); err != nil {
+			return errors.Annotatef(err, "decode dead letter at offset %d", kmsg.Offset)
+		}
+		binlog := new(pb.Binlog)
+		if err := binlog.Unmarshal(letter.Binlog); err != nil {
+			return errors.Annotatef(err, "decode binlog of dead letter at offset %d", kmsg.Offset)
+		}
+		txn, err := loader.SecondaryBinlogToTxn(binlog)
+		if err != nil {
+			return errors.Annotatef(err, "dead letter at offset %d", kmsg.Offset)
+		}
+		txn.Metadata = kmsg
+		if err = transformTxn(transform, txn); err != nil {
+			return errors.Annotatef(err, "dead letter at offset %d", kmsg.Offset)
+		}
+
+		log.Info("replay dead letter", zap.Int64("offset", kmsg.Offset), zap.Int64("ts", letter.CommitTS),
+			zap.String("stage", letter.Stage), zap.String("error", letter.Error))
+		select {
+		case ld.Input() <- txn:
+		case <-stopped:
+			return nil
+		}
+
+		if kmsg.Offset+1 >= end {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/go-sql-driver/mysql"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-tools/tidb-binlog/driver/reader"
+	pb "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type deadLetterSuite struct{}
+
+var _ = Suite(&deadLetterSuite{})
+
+func (s *deadLetterSuite) newWriter(c *C) (*deadLetterWriter, *mocks.SyncProducer) {
+	producer := mocks.NewSyncProducer(c, nil)
+	return &deadLetterWriter{topic: "dead", upTopic: "up", producer: producer}, producer
+}
+
+// badBinlogMsg returns a message which can't be translated to txn since the bit value is too long.
+func (s *deadLetterSuite) badBinlogMsg(commitTs int64) *reader.Message {
+	schema, table, name, tp := "test", "t", "b", "bit"
+	return &reader.Message{
+		Offset: commitTs,
+		Binlog: &pb.Binlog{
+			Type:     pb.BinlogType_DML,
+			CommitTs: commitTs,
+			DmlData: &pb.DMLData{Tables: []*pb.Table{{
+				SchemaName: &schema,
+				TableName:  &table,
+				ColumnInfo: []*pb.ColumnInfo{{Name: name, MysqlType: tp}},
+				Mutations: []*pb.TableMutation{{
+					Type: pb.MutationType_Insert.Enum(),
+					Row:  &pb.Row{Columns: []*pb.Column{{BytesValue: []byte("123456789")}}},
+				}},
+			}}},
+		},
+	}
+}
+
+func (s *deadLetterSuite) ddlMsg(table string, commitTs int64) *reader.Message {
+	msg := (&syncBinlogsSuite{}).createMsg("test", table, "create table "+table+"(id int)", commitTs)
+	msg.Binlog.Type = pb.BinlogType_DDL
+	return msg
+}
+
+func (s *deadLetterSuite) TestWrite(c *C) {
+	w, producer := s.newWriter(c)
+	defer w.close()
+
+	msg := s.ddlMsg("t", 10)
+	msg.Offset = 5
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(value []byte) error {
+		var letter deadLetter
+		if err := json.Unmarshal(value, &letter); err != nil {
+			return err
+		}
+		if letter.Topic != "up" || letter.Offset != 5 || letter.CommitTS != 10 || letter.Stage != stageLoad || letter.Error != "table exists" {
+			return errors.New("unexpected dead letter " + string(value))
+		}
+		binlog := new(pb.Binlog)
+		if err := binlog.Unmarshal(letter.Binlog); err != nil {
+			return err
+		}
+		if string(binlog.DdlData.DdlQuery) != "create table t(id int)" {
+			return errors.New("unexpected binlog " + binlog.String())
+		}
+		return nil
+	})
+	before := testutil.ToFloat64(deadLetterCounter.WithLabelValues(stageLoad))
+	c.Assert(w.write(msg, stageLoad, errors.New("table exists")), IsNil)
+	c.Assert(testutil.ToFloat64(deadLetterCounter.WithLabelValues(stageLoad))-before, Equals, 1.0)
+
+	producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	c.Assert(w.write(msg, stageLoad, errors.New("table exists")), ErrorMatches, ".*dead-letter topic dead.*")
+}
+
+func (s *deadLetterSuite) TestHandleFailedTxn(c *C) {
+	w, producer := s.newWriter(c)
+	defer w.close()
+
+	txn := &loader.Txn{Metadata: s.ddlMsg("t", 10)}
+	producer.ExpectSendMessageAndSucceed()
+	c.Assert(w.handleFailedTxn(txn, &mysql.MySQLError{Number: 1146, Message: "table doesn't exist"}), IsNil)
+
+	// the errors not from downstream stop arbiter.
+	err := errors.New("invalid connection")
+	c.Assert(w.handleFailedTxn(txn, err), Equals, err)
+}
+
+func (s *deadLetterSuite) TestSyncBinlogsWithDeadLetter(c *C) {
+	w, producer := s.newWriter(c)
+	defer w.close()
+
+	source := make(chan *reader.Message, 3)
+	source <- s.badBinlogMsg(1)
+	source <- s.ddlMsg("logs", 2)
+	source <- s.ddlMsg("users", 3)
+	close(source)
+
+	var stages []string
+	for i := 0; i < 2; i++ {
+		producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(value []byte) error {
+			var letter deadLetter
+			err := json.Unmarshal(value, &letter)
+			stages = append(stages, letter.Stage)
+			return err
+		})
+	}
+	transform := func(txn *loader.Txn) error {
+		if txn.DDL.Table == "logs" {
+			return errors.New("unknown table")
+		}
+		return nil
+	}
+
+	dest := make(chan *loader.Txn, 3)
+	err := syncBinlogs(context.Background(), source, &dummyLoader{input: dest}, transform, w, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(dest, HasLen, 1)
+	c.Assert((<-dest).DDL.Table, Equals, "users")
+	c.Assert(stages, DeepEquals, []string{stageDecode, stageTransform})
+}
+
+// replayLoader is the loader recording the txns loaded.
+type replayLoader struct {
+	dummyLoader
+	loaded []*loader.Txn
+}
+
+func (l *replayLoader) Run() error {
+	for txn := range l.input {
+		l.loaded = append(l.loaded, txn)
+		l.successes <- txn
+	}
+	close(l.successes)
+	return nil
+}
+
+func (l *replayLoader) Close() {
+	close(l.input)
+}
+
+func (s *deadLetterSuite) TestReplayDeadLetters(c *C) {
+	w, producer := s.newWriter(c)
+	defer w.close()
+
+	var values [][]byte
+	for i := 0; i < 3; i++ {
+		producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(value []byte) error {
+			values = append(values, value)
+			return nil
+		})
+		msg := s.ddlMsg("t", int64(i+1))
+		c.Assert(w.write(msg, stageLoad, errors.New("failed")), IsNil)
+	}
+
+	source := make(chan *sarama.ConsumerMessage, len(values))
+	for i, value := range values {
+		source <- &sarama.ConsumerMessage{Offset: int64(i), Value: value}
+	}
+
+	// only the messages before the end are replayed.
+	ld := &replayLoader{dummyLoader: dummyLoader{input: make(chan *loader.Txn), successes: make(chan *loader.Txn)}}
+	c.Assert(replayDeadLetters(source, 2, ld, nil), IsNil)
+	c.Assert(ld.loaded, HasLen, 2)
+	c.Assert(ld.loaded[1].DDL.SQL, Equals, "create table t(id int)")
+
+	source <- &sarama.ConsumerMessage{Offset: 3, Value: []byte("invalid")}
+	ld = &replayLoader{dummyLoader: dummyLoader{input: make(chan *loader.Txn), successes: make(chan *loader.Txn)}}
+	c.Assert(replayDeadLetters(source, 4, ld, nil), ErrorMatches, "decode dead letter at offset 3.*")
+	c.Assert(ld.loaded, HasLen, 1)
+}
@@ -0,0 +1,712 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	pb "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+// Supported formats of the messages in the upstream topic.
+const (
+	FormatProtobuf  = "protobuf"
+	FormatCanalJSON = "canal-json"
+	FormatDebezium  = "debezium"
+)
+
+// Decoder decodes a kafka message into the slave binlog format, so messages
+// produced by other CDC tools can share the same loading path. The key of
+// the message is nil if it has no key. A nil binlog is returned for the
+// messages without any change, like the tombstones of debezium.
+type Decoder interface {
+	Decode(key []byte, value []byte) (*pb.Binlog, error)
+}
+
+// NewDecoder creates a Decoder for the specified message format
+func NewDecoder(format string) (Decoder, error) {
+	switch format {
+	case FormatProtobuf, "":
+		return protobufDecoder{}, nil
+	case FormatCanalJSON:
+		return &canalJSONDecoder{}, nil
+	case FormatDebezium:
+		return &debeziumDecoder{}, nil
+	default:
+		return nil, errors.NotSupportedf("message format %s", format)
+	}
+}
+
+type protobufDecoder struct{}
+
+func (protobufDecoder) Decode(_ []byte, value []byte) (*pb.Binlog, error) {
+	binlog := new(pb.Binlog)
+	if err := binlog.Unmarshal(value); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return binlog, nil
+}
+
+// monotonicTS makes sure the commit ts assigned to the decoded binlogs is
+// strictly increasing, the messages of other CDC tools only carry a
+// millisecond timestamp and several of them may share the same one.
+type monotonicTS struct {
+	last int64
+}
+
+func (m *monotonicTS) next(ts int64) int64 {
+	if ts <= m.last {
+		ts = m.last + 1
+	}
+	m.last = ts
+	return ts
+}
+
+func physicalToTS(ms int64) int64 {
+	return int64(oracle.ComposeTS(ms, 0))
+}
+
+type canalJSONMessage struct {
+	Database  string                   `json:"database"`
+	Table     string                   `json:"table"`
+	PKNames   []string                 `json:"pkNames"`
+	IsDDL     bool                     `json:"isDdl"`
+	Type      string                   `json:"type"`
+	ES        int64                    `json:"es"`
+	TS        int64                    `json:"ts"`
+	SQL       string                   `json:"sql"`
+	MySQLType map[string]string        `json:"mysqlType"`
+	Data      []map[string]interface{} `json:"data"`
+	Old       []map[string]interface{} `json:"old"`
+	// TiCDC extension carrying the commit ts of upstream TiDB, or the watermark
+	// of the partition in the TIDB_WATERMARK messages
+	TiDB *struct {
+		CommitTS    int64 `json:"commitTs"`
+		WatermarkTS int64 `json:"watermarkTs"`
+	} `json:"_tidb"`
+}
+
+// canalJSONDecoder decodes messages in the canal-json format, see
+// https://github.com/alibaba/canal/wiki/Canal-Kafka-RocketMQ-QuickStart
+type canalJSONDecoder struct {
+	ts monotonicTS
+}
+
+func (d *canalJSONDecoder) Decode(_ []byte, value []byte) (*pb.Binlog, error) {
+	msg := new(canalJSONMessage)
+	if err := unmarshalUseNumber(value, msg); err != nil {
+		return nil, errors.Annotate(err, "decode canal-json message failed")
+	}
+
+	var ts int64
+	switch {
+	case strings.ToUpper(msg.Type) == "TIDB_WATERMARK" && msg.TiDB != nil:
+		// all the rows before the watermark in the partition have been sent.
+		return &pb.Binlog{Type: pb.BinlogType_DML, CommitTs: d.ts.next(msg.TiDB.WatermarkTS), DmlData: &pb.DMLData{}}, nil
+	case msg.TiDB != nil && msg.TiDB.CommitTS > 0:
+		ts = msg.TiDB.CommitTS
+	case msg.ES > 0:
+		ts = physicalToTS(msg.ES)
+	default:
+		ts = physicalToTS(msg.TS)
+	}
+	ts = d.ts.next(ts)
+
+	if msg.IsDDL {
+		return newDDLBinlog(ts, msg.Database, msg.Table, msg.SQL), nil
+	}
+
+	var tp pb.MutationType
+	switch strings.ToUpper(msg.Type) {
+	case "INSERT":
+		tp = pb.MutationType_Insert
+	case "UPDATE":
+		tp = pb.MutationType_Update
+	case "DELETE":
+		tp = pb.MutationType_Delete
+	default:
+		return nil, errors.NotSupportedf("canal-json message type %s", msg.Type)
+	}
+
+	columns := columnNames(msg.MySQLType, msg.Data)
+	table := newTable(msg.Database, msg.Table, columns, func(name string) string {
+		return msg.MySQLType[name]
+	}, msg.PKNames)
+
+	for i, data := range msg.Data {
+		mut := &pb.TableMutation{Type: &tp}
+		var err error
+		if mut.Row, err = newRow(columns, data); err != nil {
+			return nil, errors.Trace(err)
+		}
+		convertCanalBinary(table, mut.Row)
+		if tp == pb.MutationType_Update {
+			// canal only records the changed columns in the old values
+			old := make(map[string]interface{}, len(data))
+			for k, v := range data {
+				old[k] = v
+			}
+			if i < len(msg.Old) {
+				for k, v := range msg.Old[i] {
+					old[k] = v
+				}
+			}
+			if mut.ChangeRow, err = newRow(columns, old); err != nil {
+				return nil, errors.Trace(err)
+			}
+			convertCanalBinary(table, mut.ChangeRow)
+		}
+		table.Mutations = append(table.Mutations, mut)
+	}
+
+	return newDMLBinlog(ts, table), nil
+}
+
+// convertCanalBinary restores the binary values which canal encodes as
+// ISO-8859-1 strings.
+func convertCanalBinary(table *pb.Table, row *pb.Row) {
+	for i, info := range table.ColumnInfo {
+		if !strings.Contains(info.MysqlType, "blob") && !strings.Contains(info.MysqlType, "binary") {
+			continue
+		}
+		col := row.Columns[i]
+		if col.StringValue == nil {
+			continue
+		}
+		runes := []rune(col.GetStringValue())
+		data := make([]byte, len(runes))
+		for j, r := range runes {
+			data[j] = byte(r)
+		}
+		col.StringValue = nil
+		col.BytesValue = data
+	}
+}
+
+type debeziumSource struct {
+	DB       string `json:"db"`
+	Table    string `json:"table"`
+	TsMs     int64  `json:"ts_ms"`
+	CommitTS int64  `json:"commit_ts"`
+}
+
+type debeziumPayload struct {
+	Before       map[string]interface{} `json:"before"`
+	After        map[string]interface{} `json:"after"`
+	Source       *debeziumSource        `json:"source"`
+	Op           string                 `json:"op"`
+	TsMs         int64                  `json:"ts_ms"`
+	DatabaseName string                 `json:"databaseName"`
+	DDL          string                 `json:"ddl"`
+}
+
+// debeziumSchema is the schema of a struct or a field in the schema envelope, see
+// https://debezium.io/documentation/reference/connectors/mysql.html#mysql-data-types
+type debeziumSchema struct {
+	Type       string            `json:"type"`
+	Name       string            `json:"name"`
+	Field      string            `json:"field"`
+	Parameters map[string]string `json:"parameters"`
+	Fields     []*debeziumSchema `json:"fields"`
+}
+
+// field returns the schema of the field of the struct, nil if it's not found.
+func (s *debeziumSchema) field(name string) *debeziumSchema {
+	if s == nil {
+		return nil
+	}
+	for _, f := range s.Fields {
+		if f.Field == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// The semantic types of the values in the schema envelope.
+const (
+	debeziumDecimal         = "org.apache.kafka.connect.data.Decimal"
+	debeziumVariableDecimal = "io.debezium.data.VariableScaleDecimal"
+	debeziumDate            = "io.debezium.time.Date"
+	debeziumConnectDate     = "org.apache.kafka.connect.data.Date"
+	debeziumTimestamp       = "io.debezium.time.Timestamp"
+	debeziumConnectTS       = "org.apache.kafka.connect.data.Timestamp"
+	debeziumMicroTimestamp  = "io.debezium.time.MicroTimestamp"
+	debeziumNanoTimestamp   = "io.debezium.time.NanoTimestamp"
+	debeziumZonedTimestamp  = "io.debezium.time.ZonedTimestamp"
+	debeziumTime            = "io.debezium.time.Time"
+	debeziumConnectTime     = "org.apache.kafka.connect.data.Time"
+	debeziumMicroTime       = "io.debezium.time.MicroTime"
+	debeziumNanoTime        = "io.debezium.time.NanoTime"
+	debeziumYear            = "io.debezium.time.Year"
+	debeziumJSON            = "io.debezium.data.Json"
+)
+
+// debeziumDecoder decodes messages produced by the debezium MySQL connector,
+// both with and without the schema envelope. With the schema envelope, the
+// values of the semantic types like DECIMAL, DATE and bytes are converted to
+// the ones MySQL accepts, and the columns are typed and kept in their order.
+// The primary key is read from the key of the message.
+type debeziumDecoder struct {
+	ts monotonicTS
+}
+
+func (d *debeziumDecoder) Decode(key []byte, value []byte) (*pb.Binlog, error) {
+	// the tombstone following a delete for log compaction.
+	if len(bytes.TrimSpace(value)) == 0 || bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+		return nil, nil
+	}
+
+	var envelope struct {
+		Schema  *debeziumSchema  `json:"schema"`
+		Payload *debeziumPayload `json:"payload"`
+	}
+	if err := unmarshalUseNumber(value, &envelope); err != nil {
+		return nil, errors.Annotate(err, "decode debezium message failed")
+	}
+	payload := envelope.Payload
+	if payload == nil {
+		payload = new(debeziumPayload)
+		if err := unmarshalUseNumber(value, payload); err != nil {
+			return nil, errors.Annotate(err, "decode debezium message failed")
+		}
+	}
+
+	source := payload.Source
+	if source == nil {
+		source = new(debeziumSource)
+	}
+
+	var ts int64
+	switch {
+	case source.CommitTS > 0:
+		ts = source.CommitTS
+	case source.TsMs > 0:
+		ts = physicalToTS(source.TsMs)
+	default:
+		ts = physicalToTS(payload.TsMs)
+	}
+	ts = d.ts.next(ts)
+
+	if len(payload.DDL) > 0 {
+		schema := payload.DatabaseName
+		if len(schema) == 0 {
+			schema = source.DB
+		}
+		return newDDLBinlog(ts, schema, source.Table, payload.DDL), nil
+	}
+
+	var tp pb.MutationType
+	var row, changeRow map[string]interface{}
+	switch payload.Op {
+	case "c", "r":
+		tp = pb.MutationType_Insert
+		row = payload.After
+	case "u":
+		tp = pb.MutationType_Update
+		row, changeRow = payload.After, payload.Before
+	case "d":
+		tp = pb.MutationType_Delete
+		row = payload.Before
+	default:
+		return nil, errors.NotSupportedf("debezium op %s", payload.Op)
+	}
+
+	pks, err := debeziumKeyColumns(key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	rowSchema := envelope.Schema.field("after")
+	if rowSchema == nil {
+		rowSchema = envelope.Schema.field("before")
+	}
+	var columns []string
+	if rowSchema != nil && len(rowSchema.Fields) > 0 {
+		for _, f := range rowSchema.Fields {
+			columns = append(columns, f.Field)
+		}
+	} else {
+		columns = columnNames(nil, []map[string]interface{}{row})
+	}
+	table := newTable(source.DB, source.Table, columns, func(name string) string {
+		return debeziumMySQLType(rowSchema.field(name))
+	}, pks)
+
+	mut := &pb.TableMutation{Type: &tp}
+	if mut.Row, err = newDebeziumRow(rowSchema, columns, row); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if changeRow != nil {
+		if mut.ChangeRow, err = newDebeziumRow(rowSchema, columns, changeRow); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	table.Mutations = append(table.Mutations, mut)
+
+	return newDMLBinlog(ts, table), nil
+}
+
+// debeziumKeyColumns returns the sorted names of the columns in the key of the message, which are
+// the primary key, or the first unique key of the tables without primary key.
+func debeziumKeyColumns(key []byte) ([]string, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+	var envelope struct {
+		Schema  *debeziumSchema        `json:"schema"`
+		Payload map[string]interface{} `json:"payload"`
+	}
+	if err := unmarshalUseNumber(key, &envelope); err != nil {
+		return nil, errors.Annotate(err, "decode the key of debezium message failed")
+	}
+	values := envelope.Payload
+	if envelope.Schema == nil && values == nil {
+		if err := unmarshalUseNumber(key, &values); err != nil {
+			return nil, errors.Annotate(err, "decode the key of debezium message failed")
+		}
+	}
+	return columnNames(nil, []map[string]interface{}{values}), nil
+}
+
+func newDebeziumRow(schema *debeziumSchema, columns []string, values map[string]interface{}) (*pb.Row, error) {
+	converted := make(map[string]interface{}, len(values))
+	for name, v := range values {
+		var err error
+		if converted[name], err = debeziumValue(schema.field(name), v); err != nil {
+			return nil, errors.Annotatef(err, "column %s", name)
+		}
+	}
+	return newRow(columns, converted)
+}
+
+// debeziumMySQLType returns the MySQL type of the field by its schema, "" if it's unknown.
+func debeziumMySQLType(field *debeziumSchema) string {
+	if field == nil {
+		return ""
+	}
+	switch field.Name {
+	case debeziumDecimal, debeziumVariableDecimal:
+		return "decimal"
+	case debeziumDate, debeziumConnectDate:
+		return "date"
+	case debeziumTimestamp, debeziumConnectTS, debeziumMicroTimestamp, debeziumNanoTimestamp:
+		return "datetime"
+	case debeziumZonedTimestamp:
+		return "timestamp"
+	case debeziumTime, debeziumConnectTime, debeziumMicroTime, debeziumNanoTime:
+		return "time"
+	case debeziumYear:
+		return "year"
+	case debeziumJSON:
+		return "json"
+	}
+	switch field.Type {
+	case "boolean", "int8":
+		return "tinyint"
+	case "int16":
+		return "smallint"
+	case "int32":
+		return "int"
+	case "int64":
+		return "bigint"
+	case "float32":
+		return "float"
+	case "float64":
+		return "double"
+	case "string":
+		return "varchar"
+	case "bytes":
+		return "blob"
+	default:
+		return ""
+	}
+}
+
+// debeziumValue converts the value of the semantic type of the field to the one MySQL accepts,
+// the dates and times without time zone are represented in UTC by debezium, and ZonedTimestamp
+// is converted to UTC, so the sessions of downstream should use the time zone UTC.
+func debeziumValue(field *debeziumSchema, v interface{}) (interface{}, error) {
+	if field == nil || v == nil {
+		return v, nil
+	}
+
+	switch field.Name {
+	case debeziumDecimal:
+		scale, err := strconv.Atoi(field.Parameters["scale"])
+		if err != nil {
+			return nil, errors.Annotate(err, "invalid scale of decimal")
+		}
+		return decodeDebeziumDecimal(v, scale)
+	case debeziumVariableDecimal:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("invalid variable scale decimal %v", v)
+		}
+		scale, err := debeziumInt(m["scale"])
+		if err != nil {
+			return nil, errors.Annotate(err, "invalid scale of decimal")
+		}
+		return decodeDebeziumDecimal(m["value"], int(scale))
+	case debeziumDate, debeziumConnectDate:
+		days, err := debeziumInt(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return time.Unix(days*24*60*60, 0).UTC().Format("2006-01-02"), nil
+	case debeziumTimestamp, debeziumConnectTS, debeziumMicroTimestamp, debeziumNanoTimestamp:
+		n, err := debeziumInt(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return time.Unix(0, n*int64(debeziumUnit(field.Name))).UTC().Format(debeziumDatetimeLayout), nil
+	case debeziumZonedTimestamp:
+		str, ok := v.(string)
+		if !ok {
+			return nil, errors.Errorf("invalid zoned timestamp %v", v)
+		}
+		t, err := time.Parse(time.RFC3339Nano, str)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return t.UTC().Format(debeziumDatetimeLayout), nil
+	case debeziumTime, debeziumConnectTime, debeziumMicroTime, debeziumNanoTime:
+		n, err := debeziumInt(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return formatDebeziumTime(time.Duration(n) * debeziumUnit(field.Name)), nil
+	}
+
+	if field.Type == "bytes" {
+		str, ok := v.(string)
+		if !ok {
+			return nil, errors.Errorf("invalid bytes %v", v)
+		}
+		data, err := base64.StdEncoding.DecodeString(str)
+		if err != nil {
+			return nil, errors.Annotate(err, "invalid base64 bytes")
+		}
+		return data, nil
+	}
+	return v, nil
+}
+
+const debeziumDatetimeLayout = "2006-01-02 15:04:05.999999"
+
+// debeziumUnit returns the unit of the timestamps and times of the semantic type.
+func debeziumUnit(name string) time.Duration {
+	switch name {
+	case debeziumMicroTimestamp, debeziumMicroTime:
+		return time.Microsecond
+	case debeziumNanoTimestamp, debeziumNanoTime:
+		return time.Nanosecond
+	default:
+		return time.Millisecond
+	}
+}
+
+func debeziumInt(v interface{}) (int64, error) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, errors.Errorf("invalid integer %v", v)
+	}
+	i, err := n.Int64()
+	return i, errors.Trace(err)
+}
+
+// decodeDebeziumDecimal decodes the base64 big-endian two's complement unscaled value of the decimal.
+func decodeDebeziumDecimal(v interface{}, scale int) (string, error) {
+	str, ok := v.(string)
+	if !ok {
+		return "", errors.Errorf("invalid decimal %v", v)
+	}
+	data, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		return "", errors.Annotate(err, "invalid base64 decimal")
+	}
+	n := new(big.Int).SetBytes(data)
+	if len(data) > 0 && data[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(data)*8)))
+	}
+
+	sign := ""
+	if n.Sign() < 0 {
+		sign = "-"
+		n.Neg(n)
+	}
+	digits := n.String()
+	if scale <= 0 {
+		return sign + digits, nil
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:], nil
+}
+
+// formatDebeziumTime formats the time of day, which may be negative or over 24 hours in MySQL.
+func formatDebeziumTime(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	seconds := d / time.Second
+	d -= seconds * time.Second
+	return fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign, hours, minutes, seconds, d/time.Microsecond)
+}
+
+func unmarshalUseNumber(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func newDDLBinlog(ts int64, schema, table, query string) *pb.Binlog {
+	return &pb.Binlog{
+		Type:     pb.BinlogType_DDL,
+		CommitTs: ts,
+		DdlData: &pb.DDLData{
+			SchemaName: &schema,
+			TableName:  &table,
+			DdlQuery:   []byte(query),
+		},
+	}
+}
+
+func newDMLBinlog(ts int64, table *pb.Table) *pb.Binlog {
+	return &pb.Binlog{
+		Type:     pb.BinlogType_DML,
+		CommitTs: ts,
+		DmlData: &pb.DMLData{
+			Tables: []*pb.Table{table},
+		},
+	}
+}
+
+// columnNames returns the sorted column names found in types or rows
+func columnNames(types map[string]string, rows []map[string]interface{}) []string {
+	set := make(map[string]struct{})
+	for name := range types {
+		set[name] = struct{}{}
+	}
+	for _, row := range rows {
+		for name := range row {
+			set[name] = struct{}{}
+		}
+	}
+
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newTable(schema, name string, columns []string, getType func(string) string, pks []string) *pb.Table {
+	table := &pb.Table{
+		SchemaName: &schema,
+		TableName:  &name,
+	}
+	for _, col := range columns {
+		info := &pb.ColumnInfo{
+			Name:      col,
+			MysqlType: baseType(getType(col)),
+		}
+		for _, pk := range pks {
+			if pk == col {
+				info.IsPrimaryKey = true
+			}
+		}
+		table.ColumnInfo = append(table.ColumnInfo, info)
+	}
+	return table
+}
+
+// baseType strips the length and attributes, "varchar(20)" -> "varchar"
+func baseType(tp string) string {
+	tp = strings.ToLower(strings.TrimSpace(tp))
+	if idx := strings.IndexAny(tp, "( "); idx >= 0 {
+		tp = tp[:idx]
+	}
+	return tp
+}
+
+func newRow(columns []string, values map[string]interface{}) (*pb.Row, error) {
+	row := new(pb.Row)
+	for _, name := range columns {
+		col, err := newColumn(values[name])
+		if err != nil {
+			return nil, errors.Annotatef(err, "column %s", name)
+		}
+		row.Columns = append(row.Columns, col)
+	}
+	return row, nil
+}
+
+func newColumn(v interface{}) (*pb.Column, error) {
+	col := new(pb.Column)
+	switch val := v.(type) {
+	case nil:
+		isNull := true
+		col.IsNull = &isNull
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			col.Int64Value = &i
+		} else if u, err := strconv.ParseUint(val.String(), 10, 64); err == nil {
+			col.Uint64Value = &u
+		} else {
+			f, err := val.Float64()
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			col.DoubleValue = &f
+		}
+	case string:
+		col.StringValue = &val
+	case []byte:
+		col.BytesValue = val
+	case bool:
+		var i int64
+		if val {
+			i = 1
+		}
+		col.Int64Value = &i
+	default:
+		// nested json values
+		data, err := json.Marshal(val)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		str := string(data)
+		col.StringValue = &str
+	}
+	return col, nil
+}
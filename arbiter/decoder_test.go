@@ -0,0 +1,209 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	pb "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+)
+
+type decoderSuite struct{}
+
+var _ = Suite(&decoderSuite{})
+
+func (s *decoderSuite) TestNewDecoder(c *C) {
+	for _, format := range []string{"", FormatProtobuf, FormatCanalJSON, FormatDebezium} {
+		_, err := NewDecoder(format)
+		c.Assert(err, IsNil)
+	}
+	_, err := NewDecoder("avro")
+	c.Assert(err, ErrorMatches, ".*not supported.*")
+}
+
+func (s *decoderSuite) TestProtobuf(c *C) {
+	binlog := &pb.Binlog{Type: pb.BinlogType_DDL, CommitTs: 10}
+	data, err := binlog.Marshal()
+	c.Assert(err, IsNil)
+
+	decoder, err := NewDecoder(FormatProtobuf)
+	c.Assert(err, IsNil)
+	decoded, err := decoder.Decode(nil, data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.CommitTs, Equals, int64(10))
+}
+
+func (s *decoderSuite) TestCanalJSON(c *C) {
+	decoder, err := NewDecoder(FormatCanalJSON)
+	c.Assert(err, IsNil)
+
+	binlog, err := decoder.Decode(nil, []byte(`{"database":"test","table":"t","isDdl":true,"type":"CREATE","es":1000,"sql":"create table t(id int)"}`))
+	c.Assert(err, IsNil)
+	c.Assert(binlog.Type, Equals, pb.BinlogType_DDL)
+	c.Assert(binlog.CommitTs, Equals, physicalToTS(1000))
+	txn, err := loader.SecondaryBinlogToTxn(binlog)
+	c.Assert(err, IsNil)
+	c.Assert(txn.DDL.SQL, Equals, "create table t(id int)")
+	c.Assert(txn.DDL.Database, Equals, "test")
+
+	// same es, the commit ts should still increase
+	binlog, err = decoder.Decode(nil, []byte(`{"database":"test","table":"t","pkNames":["id"],"isDdl":false,"type":"UPDATE","es":1000,
+		"mysqlType":{"id":"int","name":"varchar(20)","data":"blob"},
+		"data":[{"id":"1","name":"b","data":"ÿ"}],
+		"old":[{"name":"a"}]}`))
+	c.Assert(err, IsNil)
+	c.Assert(binlog.CommitTs, Equals, physicalToTS(1000)+1)
+	table := binlog.DmlData.Tables[0]
+	c.Assert(table.ColumnInfo[1].IsPrimaryKey, IsTrue)
+	c.Assert(table.ColumnInfo[2].MysqlType, Equals, "varchar")
+	txn, err = loader.SecondaryBinlogToTxn(binlog)
+	c.Assert(err, IsNil)
+	c.Assert(txn.DMLs, HasLen, 1)
+	dml := txn.DMLs[0]
+	c.Assert(dml.Tp, Equals, loader.UpdateDMLType)
+	c.Assert(dml.Values, DeepEquals, map[string]interface{}{"id": "1", "name": "b", "data": []byte{0xff}})
+	c.Assert(dml.OldValues, DeepEquals, map[string]interface{}{"id": "1", "name": "a", "data": []byte{0xff}})
+
+	binlog, err = decoder.Decode(nil, []byte(`{"database":"test","table":"t","isDdl":false,"type":"DELETE","es":900,"_tidb":{"commitTs":5000000000000},
+		"mysqlType":{"id":"int","name":"varchar(20)"},"data":[{"id":"1","name":null},{"id":"2","name":"c"}]}`))
+	c.Assert(err, IsNil)
+	c.Assert(binlog.CommitTs, Equals, int64(5000000000000))
+	txn, err = loader.SecondaryBinlogToTxn(binlog)
+	c.Assert(err, IsNil)
+	c.Assert(txn.DMLs, HasLen, 2)
+	c.Assert(txn.DMLs[0].Tp, Equals, loader.DeleteDMLType)
+	c.Assert(txn.DMLs[0].Values, DeepEquals, map[string]interface{}{"id": "1", "name": nil})
+
+	// the watermark of TiCDC is a binlog without rows.
+	binlog, err = decoder.Decode(nil, []byte(`{"database":"","table":"","isDdl":false,"type":"TIDB_WATERMARK","es":900,"_tidb":{"watermarkTs":5000000000100}}`))
+	c.Assert(err, IsNil)
+	c.Assert(binlog.Type, Equals, pb.BinlogType_DML)
+	c.Assert(binlog.CommitTs, Equals, int64(5000000000100))
+	c.Assert(binlog.DmlData.Tables, HasLen, 0)
+
+	_, err = decoder.Decode(nil, []byte(`{"database":"test","table":"t","type":"TRUNCATE","es":2000}`))
+	c.Assert(err, NotNil)
+	_, err = decoder.Decode(nil, []byte(`not json`))
+	c.Assert(err, NotNil)
+}
+
+func (s *decoderSuite) TestDebezium(c *C) {
+	decoder, err := NewDecoder(FormatDebezium)
+	c.Assert(err, IsNil)
+
+	binlog, err := decoder.Decode(nil, []byte(`{"schema":{},"payload":{"before":{"id":1,"score":1.5,"ok":true},"after":{"id":1,"score":2.5,"ok":false},
+		"source":{"db":"test","table":"t","ts_ms":2000},"op":"u","ts_ms":2100}}`))
+	c.Assert(err, IsNil)
+	c.Assert(binlog.CommitTs, Equals, physicalToTS(2000))
+	txn, err := loader.SecondaryBinlogToTxn(binlog)
+	c.Assert(err, IsNil)
+	c.Assert(txn.DMLs, HasLen, 1)
+	dml := txn.DMLs[0]
+	c.Assert(dml.Database, Equals, "test")
+	c.Assert(dml.Table, Equals, "t")
+	c.Assert(dml.Tp, Equals, loader.UpdateDMLType)
+	c.Assert(dml.Values, DeepEquals, map[string]interface{}{"id": int64(1), "score": 2.5, "ok": int64(0)})
+	c.Assert(dml.OldValues, DeepEquals, map[string]interface{}{"id": int64(1), "score": 1.5, "ok": int64(1)})
+
+	// without the schema envelope
+	binlog, err = decoder.Decode(nil, []byte(`{"before":{"id":2,"doc":{"a":1}},"source":{"db":"test","table":"t","ts_ms":1000},"op":"d"}`))
+	c.Assert(err, IsNil)
+	c.Assert(binlog.CommitTs, Equals, physicalToTS(2000)+1)
+	txn, err = loader.SecondaryBinlogToTxn(binlog)
+	c.Assert(err, IsNil)
+	c.Assert(txn.DMLs[0].Tp, Equals, loader.DeleteDMLType)
+	c.Assert(txn.DMLs[0].Values, DeepEquals, map[string]interface{}{"id": int64(2), "doc": `{"a":1}`})
+
+	binlog, err = decoder.Decode(nil, []byte(`{"payload":{"source":{"db":"test","ts_ms":3000,"commit_ts":900000000000000},"databaseName":"test","ddl":"drop table t"}}`))
+	c.Assert(err, IsNil)
+	c.Assert(binlog.Type, Equals, pb.BinlogType_DDL)
+	c.Assert(binlog.CommitTs, Equals, int64(900000000000000))
+	c.Assert(string(binlog.DdlData.DdlQuery), Equals, "drop table t")
+
+	_, err = decoder.Decode(nil, []byte(`{"payload":{"source":{"db":"test","table":"t"},"op":"x"}}`))
+	c.Assert(err, NotNil)
+}
+
+func (s *decoderSuite) TestDebeziumSchema(c *C) {
+	decoder, err := NewDecoder(FormatDebezium)
+	c.Assert(err, IsNil)
+
+	key := []byte(`{"schema":{"type":"struct","fields":[{"type":"int32","field":"id"}]},"payload":{"id":1}}`)
+	binlog, err := decoder.Decode(key, []byte(`{"schema":{"type":"struct","fields":[
+		{"type":"struct","field":"after","fields":[
+			{"type":"int32","field":"id"},
+			{"type":"bytes","name":"org.apache.kafka.connect.data.Decimal","parameters":{"scale":"2"},"field":"price"},
+			{"type":"int32","name":"io.debezium.time.Date","field":"d"},
+			{"type":"int64","name":"io.debezium.time.Timestamp","field":"dt"},
+			{"type":"string","name":"io.debezium.time.ZonedTimestamp","field":"ts"},
+			{"type":"int64","name":"io.debezium.time.MicroTime","field":"t"},
+			{"type":"bytes","field":"b"}]}]},
+		"payload":{"after":{"id":1,"price":"MDk=","d":18748,"dt":1619827200123,"ts":"2021-05-01T08:00:00+08:00","t":3723000001,"b":"AQI="},
+		"source":{"db":"test","table":"t","ts_ms":1000},"op":"c"}}`))
+	c.Assert(err, IsNil)
+
+	table := binlog.DmlData.Tables[0]
+	var names, types []string
+	for _, info := range table.ColumnInfo {
+		names = append(names, info.Name)
+		types = append(types, info.MysqlType)
+		c.Assert(info.IsPrimaryKey, Equals, info.Name == "id")
+	}
+	c.Assert(names, DeepEquals, []string{"id", "price", "d", "dt", "ts", "t", "b"})
+	c.Assert(types, DeepEquals, []string{"int", "decimal", "date", "datetime", "timestamp", "time", "blob"})
+
+	txn, err := loader.SecondaryBinlogToTxn(binlog)
+	c.Assert(err, IsNil)
+	c.Assert(txn.DMLs[0].Values, DeepEquals, map[string]interface{}{
+		"id":    int64(1),
+		"price": "123.45",
+		"d":     "2021-05-01",
+		"dt":    "2021-05-01 00:00:00.123",
+		"ts":    "2021-05-01 00:00:00",
+		"t":     "01:02:03.000001",
+		"b":     []byte{1, 2},
+	})
+
+	// the tombstone following a delete is skipped.
+	binlog, err = decoder.Decode(key, nil)
+	c.Assert(err, IsNil)
+	c.Assert(binlog, IsNil)
+
+	_, err = decoder.Decode(key, []byte(`{"schema":{"type":"struct","fields":[{"type":"struct","field":"after","fields":[
+		{"type":"bytes","name":"org.apache.kafka.connect.data.Decimal","parameters":{"scale":"2"},"field":"price"}]}]},
+		"payload":{"after":{"price":"not base64"},"source":{"db":"test","table":"t","ts_ms":1000},"op":"c"}}`))
+	c.Assert(err, ErrorMatches, ".*column price.*")
+}
+
+func (s *decoderSuite) TestDecodeDebeziumDecimal(c *C) {
+	tests := []struct {
+		value    string
+		scale    int
+		expected string
+	}{
+		{"MDk=", 2, "123.45"},
+		{"MDk=", 0, "12345"},
+		{"MDk=", 6, "0.012345"},
+		{"/88=", 2, "-0.49"},
+		{"AA==", 1, "0.0"},
+	}
+	for _, test := range tests {
+		decimal, err := decodeDebeziumDecimal(test.value, test.scale)
+		c.Assert(err, IsNil)
+		c.Assert(decimal, Equals, test.expected, Commentf("value: %s, scale: %d", test.value, test.scale))
+	}
+	c.Assert(formatDebeziumTime(-90*time.Minute), Equals, "-01:30:00.000000")
+}
@@ -0,0 +1,285 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPauseSeconds = 30
+	// downstreamErrorWindow is the window the binlogs rejected by downstream are counted in.
+	downstreamErrorWindow = time.Minute
+	webhookTimeout        = 5 * time.Second
+)
+
+// FlowControlConfig is the configuration of the lag threshold and the pause of consumption.
+type FlowControlConfig struct {
+	// MaxLag is the max seconds a binlog read from kafka can wait to be loaded, arbiter is
+	// lagging once it's exceeded. Zero disables it.
+	MaxLag int `toml:"max-lag" json:"max-lag"`
+	// LagWebhook is the URL POSTed to when arbiter starts and stops lagging, like to scale
+	// the capacity of downstream.
+	LagWebhook string `toml:"lag-webhook" json:"lag-webhook"`
+	// MaxDownstreamErrors is the max number of the binlogs rejected by downstream and produced
+	// to the dead-letter topic in a minute, reading from kafka is paused for PauseSeconds once
+	// it's exceeded. Zero disables it.
+	MaxDownstreamErrors int `toml:"max-downstream-errors" json:"max-downstream-errors"`
+	PauseSeconds        int `toml:"pause-seconds" json:"pause-seconds"`
+}
+
+func (c *FlowControlConfig) enabled() bool {
+	return c.MaxLag > 0 || c.MaxDownstreamErrors > 0
+}
+
+// lagEvent is the body POSTed to the lag webhook.
+type lagEvent struct {
+	Instance   string    `json:"instance"`
+	Topic      string    `json:"topic"`
+	Lagging    bool      `json:"lagging"`
+	LagSeconds float64   `json:"lag-seconds"`
+	MaxLag     int       `json:"max-lag"`
+	Time       time.Time `json:"time"`
+}
+
+// flowControl tracks the lag of loading and the binlogs rejected by downstream. All the methods
+// do nothing if it's nil.
+type flowControl struct {
+	cfg      *FlowControlConfig
+	topic    string
+	instance string
+	pause    time.Duration
+	client   *http.Client
+
+	mu sync.Mutex
+	// pendingTS is roughly the commit ts of the oldest binlog read but not loaded yet, zero if
+	// all the binlogs read are loaded.
+	pendingTS  int64
+	receivedTS int64
+	lagging    bool
+	// errTimes are the times of the binlogs rejected by downstream in the window.
+	errTimes []time.Time
+	resumeAt time.Time
+	paused   bool
+}
+
+// newFlowControl returns nil if neither the lag threshold nor the pause is enabled.
+func newFlowControl(cfg *FlowControlConfig, topic string, instance string) *flowControl {
+	if !cfg.enabled() {
+		return nil
+	}
+	pause := cfg.PauseSeconds
+	if pause <= 0 {
+		pause = defaultPauseSeconds
+	}
+	return &flowControl{
+		cfg:      cfg,
+		topic:    topic,
+		instance: instance,
+		pause:    time.Duration(pause) * time.Second,
+		client:   &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// received records the binlog read from kafka.
+func (f *flowControl) received(ts int64) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	f.receivedTS = ts
+	if f.pendingTS == 0 {
+		f.pendingTS = ts
+	}
+	f.mu.Unlock()
+}
+
+// loaded records the binlog loaded to downstream. The next binlog read is committed after it,
+// so the lag is a bit overestimated until it's loaded too.
+func (f *flowControl) loaded(ts int64) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	if ts >= f.receivedTS {
+		f.pendingTS = 0
+	} else {
+		f.pendingTS = ts
+	}
+	f.mu.Unlock()
+}
+
+// checkLag updates the lag at now, it returns the event to notify if arbiter starts or stops lagging.
+func (f *flowControl) checkLag(now time.Time) *lagEvent {
+	f.mu.Lock()
+	var lag time.Duration
+	if f.pendingTS > 0 {
+		lag = time.Duration(now.UnixNano()/1000000-oracle.ExtractPhysical(uint64(f.pendingTS))) * time.Millisecond
+		if lag < 0 {
+			lag = 0
+		}
+	}
+	lagging := f.cfg.MaxLag > 0 && lag > time.Duration(f.cfg.MaxLag)*time.Second
+	changed := lagging != f.lagging
+	f.lagging = lagging
+	f.mu.Unlock()
+
+	lagSecondsGauge.Set(lag.Seconds())
+	if !changed {
+		return nil
+	}
+	if lagging {
+		lagExceededGauge.Set(1)
+		log.Warn("arbiter is lagging", zap.Duration("lag", lag), zap.Int("max lag seconds", f.cfg.MaxLag))
+	} else {
+		lagExceededGauge.Set(0)
+		log.Info("arbiter catches up", zap.Duration("lag", lag), zap.Int("max lag seconds", f.cfg.MaxLag))
+	}
+	return &lagEvent{
+		Instance:   f.instance,
+		Topic:      f.topic,
+		Lagging:    lagging,
+		LagSeconds: lag.Seconds(),
+		MaxLag:     f.cfg.MaxLag,
+		Time:       now,
+	}
+}
+
+// run checks the lag every interval until ctx is done, the webhook is called in order of the events.
+func (f *flowControl) run(ctx context.Context, interval time.Duration) {
+	if f == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			event := f.checkLag(now)
+			if event == nil || len(f.cfg.LagWebhook) == 0 {
+				continue
+			}
+			if err := f.notify(ctx, event); err != nil {
+				log.Warn("call lag webhook failed", zap.String("url", f.cfg.LagWebhook), zap.Bool("lagging", event.Lagging), zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (f *flowControl) notify(ctx context.Context, event *lagEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req, err := http.NewRequest("POST", f.cfg.LagWebhook, bytes.NewReader(body))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("lag webhook returns %s", resp.Status)
+	}
+	return nil
+}
+
+// downstreamError records a binlog rejected by downstream at now, consumption is paused once
+// more than MaxDownstreamErrors are rejected in the window, or extended if it's paused already.
+func (f *flowControl) downstreamError(now time.Time) {
+	if f == nil || f.cfg.MaxDownstreamErrors <= 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errTimes = append(f.errTimes, now)
+	i := 0
+	for i < len(f.errTimes) && now.Sub(f.errTimes[i]) > downstreamErrorWindow {
+		i++
+	}
+	f.errTimes = f.errTimes[i:]
+	if len(f.errTimes) <= f.cfg.MaxDownstreamErrors {
+		return
+	}
+
+	log.Warn("too many binlogs are rejected by downstream, pause reading from kafka",
+		zap.Int("errors", len(f.errTimes)), zap.Duration("window", downstreamErrorWindow), zap.Duration("pause", f.pause))
+	f.errTimes = nil
+	f.resumeAt = now.Add(f.pause)
+	f.paused = true
+	consumptionPausedGauge.Set(1)
+}
+
+// wait blocks while consumption is paused, it returns false if ctx is done.
+func (f *flowControl) wait(ctx context.Context) bool {
+	if f == nil {
+		return true
+	}
+	for {
+		f.mu.Lock()
+		d := time.Until(f.resumeAt)
+		paused := f.paused
+		if d <= 0 && paused {
+			f.paused = false
+		}
+		f.mu.Unlock()
+
+		if d <= 0 {
+			if paused {
+				consumptionPausedGauge.Set(0)
+				log.Info("resume reading from kafka")
+			}
+			return true
+		}
+
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// failedTxnHandler wraps the handler of the failed txns to record the ones rejected by downstream
+// and skipped by it, the other ones stop arbiter anyway.
+func (f *flowControl) failedTxnHandler(h func(*loader.Txn, error) error) func(*loader.Txn, error) error {
+	if f == nil {
+		return h
+	}
+	return func(txn *loader.Txn, err error) error {
+		if err = h(txn, err); err == nil {
+			f.downstreamError(time.Now())
+		}
+		return err
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-tools/tidb-binlog/driver/reader"
+	pb "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+type flowControlSuite struct{}
+
+var _ = Suite(&flowControlSuite{})
+
+func (s *flowControlSuite) TestDisabled(c *C) {
+	var f *flowControl
+	c.Assert(newFlowControl(&FlowControlConfig{PauseSeconds: 30}, "test", "arbiter"), IsNil)
+
+	f.received(1)
+	f.loaded(1)
+	f.downstreamError(time.Now())
+	c.Assert(f.wait(context.Background()), IsTrue)
+	c.Assert(f.failedTxnHandler(nil), IsNil)
+}
+
+func (s *flowControlSuite) TestCheckLag(c *C) {
+	f := newFlowControl(&FlowControlConfig{MaxLag: 10}, "test", "arbiter")
+	now := time.Now()
+	ts := func(ago time.Duration) int64 {
+		return int64(oracle.GoTimeToTS(now.Add(-ago)))
+	}
+
+	c.Assert(f.checkLag(now), IsNil)
+
+	f.received(ts(20 * time.Second))
+	f.received(ts(5 * time.Second))
+	event := f.checkLag(now)
+	c.Assert(event, NotNil)
+	c.Assert(event.Lagging, IsTrue)
+	c.Assert(event.LagSeconds, Equals, float64(20))
+	c.Assert(event.MaxLag, Equals, 10)
+	c.Assert(f.checkLag(now), IsNil)
+
+	// the next pending binlog is committed after the loaded one.
+	f.loaded(ts(8 * time.Second))
+	event = f.checkLag(now)
+	c.Assert(event, NotNil)
+	c.Assert(event.Lagging, IsFalse)
+	c.Assert(event.LagSeconds, Equals, float64(8))
+
+	f.loaded(ts(5 * time.Second))
+	c.Assert(f.checkLag(now), IsNil)
+	c.Assert(f.pendingTS, Equals, int64(0))
+
+	// the lag starts from the first binlog read after all are loaded.
+	f.received(ts(time.Second))
+	c.Assert(f.checkLag(now), IsNil)
+}
+
+func (s *flowControlSuite) TestLagWebhook(c *C) {
+	events := make(chan *lagEvent, 2)
+	failed := false
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := new(lagEvent)
+		c.Check(r.Method, Equals, "POST")
+		c.Check(json.NewDecoder(r.Body).Decode(event), IsNil)
+		if failed {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		events <- event
+	}))
+	defer svr.Close()
+
+	f := newFlowControl(&FlowControlConfig{MaxLag: 1, LagWebhook: svr.URL}, "test", "arbiter")
+	event := &lagEvent{Instance: "arbiter", Topic: "test", Lagging: true, LagSeconds: 2, MaxLag: 1}
+	c.Assert(f.notify(context.Background(), event), IsNil)
+	c.Assert(<-events, DeepEquals, event)
+
+	failed = true
+	c.Assert(f.notify(context.Background(), event), ErrorMatches, "lag webhook returns 500.*")
+	<-events
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	failed = false
+	f.received(int64(oracle.GoTimeToTS(time.Now().Add(-time.Minute))))
+	go f.run(ctx, 10*time.Millisecond)
+	select {
+	case event = <-events:
+		c.Assert(event.Lagging, IsTrue)
+		c.Assert(event.Topic, Equals, "test")
+	case <-time.After(3 * time.Second):
+		c.Fatal("webhook isn't called in time")
+	}
+}
+
+func (s *flowControlSuite) TestPause(c *C) {
+	f := newFlowControl(&FlowControlConfig{MaxDownstreamErrors: 2}, "test", "arbiter")
+	c.Assert(f.pause, Equals, defaultPauseSeconds*time.Second)
+	f.pause = 100 * time.Millisecond
+
+	now := time.Now()
+	// the errors out of the window aren't counted.
+	f.downstreamError(now.Add(-2 * time.Minute))
+	f.downstreamError(now)
+	f.downstreamError(now)
+	c.Assert(f.paused, IsFalse)
+	c.Assert(f.wait(context.Background()), IsTrue)
+
+	f.downstreamError(now)
+	c.Assert(f.paused, IsTrue)
+	c.Assert(f.errTimes, HasLen, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(f.wait(ctx), IsFalse)
+
+	start := time.Now()
+	c.Assert(f.wait(context.Background()), IsTrue)
+	c.Assert(time.Since(start), Greater, 50*time.Millisecond)
+	c.Assert(f.paused, IsFalse)
+}
+
+func (s *flowControlSuite) TestFailedTxnHandler(c *C) {
+	f := newFlowControl(&FlowControlConfig{MaxDownstreamErrors: 1}, "test", "arbiter")
+	f.pause = time.Hour
+	handler := f.failedTxnHandler(func(_ *loader.Txn, err error) error {
+		if err.Error() == "lost connection" {
+			return err
+		}
+		return nil
+	})
+
+	c.Assert(handler(nil, errors.New("lost connection")), ErrorMatches, "lost connection")
+	c.Assert(handler(nil, errors.New("duplicate key")), IsNil)
+	c.Assert(f.errTimes, HasLen, 1)
+	c.Assert(handler(nil, errors.New("duplicate key")), IsNil)
+	c.Assert(f.paused, IsTrue)
+
+	// syncBinlogs stops reading while it's paused.
+	source := make(chan *reader.Message, 1)
+	source <- &reader.Message{Binlog: &pb.Binlog{CommitTs: 1}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	dest := make(chan *loader.Txn, 1)
+	go func() {
+		done <- syncBinlogs(ctx, source, &dummyLoader{input: dest}, nil, nil, nil, f)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(dest, HasLen, 0)
+	cancel()
+	c.Assert(<-done, IsNil)
+}
@@ -18,6 +18,7 @@ import (
 	"os"
 
 	"github.com/pingcap/log"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
@@ -56,6 +57,88 @@ var (
 			Help:      "the size of queue",
 		}, []string{"name"})
 
+	workerBusyCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "arbiter",
+			Name:      "worker_busy_seconds_total",
+			Help:      "Total seconds each worker of the loader spends executing DMLs, the rate is the busy ratio.",
+		}, []string{"worker"})
+
+	queueWaitHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "binlog",
+			Subsystem: "arbiter",
+			Name:      "queue_wait_seconds",
+			Help:      "Bucketed histogram of the seconds a txn waits in the loader before executed.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 20),
+		})
+
+	conflictStallHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "binlog",
+			Subsystem: "arbiter",
+			Name:      "conflict_stall_seconds",
+			Help:      "Bucketed histogram of the seconds the loader stalls on causality conflicts.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 20),
+		})
+
+	retryCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "arbiter",
+			Name:      "retry_total",
+			Help:      "Total number of the retries of executing DMLs and DDLs in the loader.",
+		}, []string{"type"})
+
+	deadLetterCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "arbiter",
+			Name:      "dead_letter_total",
+			Help:      "Total number of the binlogs produced to the dead-letter topic by the stage they failed at.",
+		}, []string{"stage"})
+
+	incompatibleCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "arbiter",
+			Name:      "incompatible_binlog_total",
+			Help:      "Total number of the binlogs not fully understood and loaded in tolerant compatibility mode.",
+		})
+
+	undecodableCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "arbiter",
+			Name:      "undecodable_message_total",
+			Help:      "Total number of the messages failed to be decoded and skipped by up.skip-undecodable.",
+		})
+
+	lagSecondsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "arbiter",
+			Name:      "lag_seconds",
+			Help:      "Seconds the oldest binlog read from kafka but not loaded yet falls behind, zero if all are loaded.",
+		})
+
+	lagExceededGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "arbiter",
+			Name:      "lag_exceeded",
+			Help:      "1 if the lag exceeds flow-control.max-lag, 0 otherwise.",
+		})
+
+	consumptionPausedGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "arbiter",
+			Name:      "consumption_paused",
+			Help:      "1 if reading from kafka is paused for too many binlogs rejected by downstream, 0 otherwise.",
+		})
+
 	txnLatencySecondsHistogram = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Namespace: "binlog",
@@ -78,6 +161,18 @@ func init() {
 	Registry.MustRegister(eventCounter)
 	Registry.MustRegister(queueSizeGauge)
 	Registry.MustRegister(txnLatencySecondsHistogram)
+	Registry.MustRegister(workerBusyCounter)
+	Registry.MustRegister(queueWaitHistogram)
+	Registry.MustRegister(conflictStallHistogram)
+	Registry.MustRegister(retryCounter)
+	Registry.MustRegister(deadLetterCounter)
+	Registry.MustRegister(incompatibleCounter)
+	Registry.MustRegister(undecodableCounter)
+	Registry.MustRegister(lagSecondsGauge)
+	Registry.MustRegister(lagExceededGauge)
+	Registry.MustRegister(consumptionPausedGauge)
+
+	pkgsql.InitMetrics(Registry)
 }
 
 var getHostname = os.Hostname
@@ -16,6 +16,7 @@ package arbiter
 import (
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type instanceNameSuite struct{}
@@ -47,3 +48,24 @@ func (s *instanceNameSuite) TestShouldUseHostname(c *C) {
 	n := instanceName(9090)
 	c.Assert(n, Equals, "kendoka_9090")
 }
+
+type registrySuite struct{}
+
+var _ = Suite(&registrySuite{})
+
+func (s *registrySuite) TestRegisterSQLMetrics(c *C) {
+	c.Assert(isTxnReplayCounterRegistered(Registry), IsTrue)
+}
+
+// isTxnReplayCounterRegistered returns whether binlog_sql_txn_replay_total of pkg/sql is registered.
+func isTxnReplayCounterRegistered(registry *prometheus.Registry) bool {
+	err := registry.Register(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "sql",
+			Name:      "txn_replay_total",
+			Help:      "Total number of the transactions replayed in safe mode by type(dml/ddl) and result.",
+		}, []string{"type", "result"}))
+	_, ok := err.(prometheus.AlreadyRegisteredError)
+	return ok
+}
@@ -0,0 +1,367 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tidb-tools/tidb-binlog/driver/reader"
+	pb "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+	"go.uber.org/zap"
+)
+
+// checkpointName returns the name of the checkpoint of the partitions of the topic,
+// it's the topic itself if the default partition 0 is read.
+func checkpointName(topic string, partitions []int32) string {
+	if len(partitions) == 0 {
+		return topic
+	}
+	sorted := append([]int32(nil), partitions...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	ids := make([]string, 0, len(sorted))
+	for _, p := range sorted {
+		ids = append(ids, fmt.Sprint(p))
+	}
+	return topic + ":" + strings.Join(ids, ",")
+}
+
+// partitionSource is the messages of a partition, implemented by sarama.PartitionConsumer.
+type partitionSource interface {
+	Messages() <-chan *sarama.ConsumerMessage
+}
+
+type partitionState struct {
+	id      int32
+	source  partitionSource
+	decoder Decoder
+	// head is the next binlog of the partition, its commit ts is the watermark of the partition,
+	// all the binlogs before it have been read.
+	head *reader.Message
+}
+
+// partitionReader reads the binlogs from a set of partitions of the topic, the binlogs in each
+// partition must be ordered by commit ts. They're merged by commit ts, so the binlogs are loaded
+// and checkpointed like they're from one partition. The parts of a binlog in the partitions, which
+// have the same commit ts, are merged into one binlog, and it's only sent when every partition has
+// a head, so no partition can deliver a binlog with a less commit ts later. Drainer produces a part
+// of every binlog to every partition for it, the partitions without rows get the watermarks,
+// which are the binlogs without tables, and so does TiCDC with the TIDB_WATERMARK messages of
+// canal-json. The watermarks only advance the partitions and are not sent. The schema snapshots
+// are skipped since they have no rows.
+// It stops with an error on the first message failed to be decoded unless skipUndecodable.
+type partitionReader struct {
+	cfg             *reader.Config
+	skipUndecodable bool
+	client          sarama.Client
+	consumer        sarama.Consumer
+	consumers       []sarama.PartitionConsumer
+	partitions      []*partitionState
+	// sentTS is the commit ts of the last binlog sent.
+	sentTS int64
+
+	msgs chan *reader.Message
+	stop chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+var _ failingReader = &partitionReader{}
+
+// newPartitionReaderImpl creates a partitionReader of the partitions, all the partitions of the
+// topic are read if partitions is empty. More than one partition can only be read if they have
+// the watermarks.
+func newPartitionReaderImpl(cfg *reader.Config, kafkaVersion string, format string, partitions []int32, watermarks bool, skipUndecodable bool) (messageReader, error) {
+	conf, err := util.NewSaramaConfig(kafkaVersion, "arbiter.")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	conf.Net.ReadTimeout = reader.KafkaReadTimeout
+	if cfg.SaramaBufferSize > 0 {
+		conf.ChannelBufferSize = cfg.SaramaBufferSize
+	}
+
+	client, err := sarama.NewClient(cfg.KafkaAddr, conf)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	bufferSize := cfg.MessageBufferSize
+	if bufferSize <= 0 {
+		bufferSize = 1
+	}
+	r := &partitionReader{
+		cfg:             cfg,
+		skipUndecodable: skipUndecodable,
+		client:          client,
+		msgs:            make(chan *reader.Message, bufferSize),
+		stop:            make(chan struct{}),
+	}
+	if err = r.consume(conf, format, partitions, watermarks); err != nil {
+		r.closeConsumers()
+		client.Close()
+		return nil, errors.Trace(err)
+	}
+
+	go r.run()
+
+	return r, nil
+}
+
+// consume starts to consume the partitions, from the offsets after CommitTS
+// if the format is protobuf, or from the oldest offsets.
+func (r *partitionReader) consume(conf *sarama.Config, format string, partitions []int32, watermarks bool) error {
+	existing, err := r.client.Partitions(r.cfg.Topic)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(partitions) == 0 {
+		partitions = existing
+	}
+	if len(partitions) > 1 && !watermarks {
+		return errors.Errorf("the %s messages have no watermarks to merge partitions %v of topic %s, read one partition by an arbiter, "+
+			"or set up.watermarks if TiCDC produces the TIDB_WATERMARK messages of canal-json", format, partitions, r.cfg.Topic)
+	}
+	for _, p := range partitions {
+		found := false
+		for _, e := range existing {
+			found = found || e == p
+		}
+		if !found {
+			return errors.Errorf("partition %d of topic %s not found, the partitions are %v", p, r.cfg.Topic, existing)
+		}
+	}
+
+	offsets := make([]int64, len(partitions))
+	if (format == FormatProtobuf || format == "") && r.cfg.CommitTS > 0 {
+		seeker, err := reader.NewKafkaSeeker(r.cfg.KafkaAddr, conf)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		offsets, err = seeker.Seek(r.cfg.Topic, r.cfg.CommitTS, partitions)
+		seeker.Close()
+		if err != nil {
+			return errors.Trace(err)
+		}
+	} else {
+		for i, p := range partitions {
+			if offsets[i], err = r.client.GetOffset(r.cfg.Topic, p, sarama.OffsetOldest); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+
+	if r.consumer, err = sarama.NewConsumerFromClient(r.client); err != nil {
+		return errors.Trace(err)
+	}
+	for i, p := range partitions {
+		decoder, err := NewDecoder(format)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		pc, err := r.consumer.ConsumePartition(r.cfg.Topic, p, offsets[i])
+		if err != nil {
+			return errors.Trace(err)
+		}
+		r.consumers = append(r.consumers, pc)
+		r.partitions = append(r.partitions, &partitionState{
+			id:      p,
+			source:  pc,
+			decoder: decoder,
+		})
+		log.Info("consume partition", zap.String("topic", r.cfg.Topic), zap.Int32("partition", p), zap.Int64("offset", offsets[i]))
+	}
+	return nil
+}
+
+func (r *partitionReader) closeConsumers() {
+	for _, pc := range r.consumers {
+		pc.Close()
+	}
+	if r.consumer != nil {
+		r.consumer.Close()
+	}
+}
+
+// Messages implements messageReader
+func (r *partitionReader) Messages() <-chan *reader.Message {
+	return r.msgs
+}
+
+// Close implements messageReader
+func (r *partitionReader) Close() {
+	close(r.stop)
+	r.client.Close()
+}
+
+// Err implements failingReader
+func (r *partitionReader) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *partitionReader) run() {
+	defer func() {
+		r.closeConsumers()
+		close(r.msgs)
+		log.Info("partition reader stop to run")
+	}()
+
+	if err := r.merge(); err != nil {
+		log.Error("partition reader stops with error", zap.Error(err))
+		r.mu.Lock()
+		r.err = err
+		r.mu.Unlock()
+	}
+}
+
+// merge sends the binlogs of the partitions in the order of commit ts until stopped.
+func (r *partitionReader) merge() error {
+	for {
+		if msg, ok := r.nextBinlog(); ok {
+			if msg == nil {
+				continue
+			}
+			select {
+			case r.msgs <- msg:
+				continue
+			case <-r.stop:
+				return nil
+			}
+		}
+
+		// wait for the partitions without head to be read.
+		cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(r.stop)}}
+		var waiting []*partitionState
+		for _, p := range r.partitions {
+			if p.head == nil {
+				cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(p.source.Messages())})
+				waiting = append(waiting, p)
+			}
+		}
+		chosen, v, ok := reflect.Select(cases)
+		if chosen == 0 || !ok {
+			return nil
+		}
+		if err := r.receive(waiting[chosen-1], v.Interface().(*sarama.ConsumerMessage)); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
+// nextBinlog takes the heads with the min commit ts and merges them if every partition has a head,
+// it returns false if not. The merged binlog is nil if the heads are all watermarks.
+func (r *partitionReader) nextBinlog() (*reader.Message, bool) {
+	var minTS int64
+	for _, p := range r.partitions {
+		if p.head == nil {
+			return nil, false
+		}
+		if minTS == 0 || p.head.Binlog.CommitTs < minTS {
+			minTS = p.head.Binlog.CommitTs
+		}
+	}
+
+	var parts []*reader.Message
+	for _, p := range r.partitions {
+		if p.head.Binlog.CommitTs == minTS {
+			parts = append(parts, p.head)
+			p.head = nil
+		}
+	}
+	r.sentTS = minTS
+	return mergeParts(parts), true
+}
+
+// mergeParts merges the parts of a binlog in the partitions, the DDL is produced to all the partitions
+// and is taken once, the tables of the DMLs are put together. The watermarks are dropped, nil is
+// returned if all the parts are watermarks.
+func mergeParts(parts []*reader.Message) *reader.Message {
+	var dmls []*reader.Message
+	for _, part := range parts {
+		if part.Binlog.Type == pb.BinlogType_DDL {
+			return part
+		}
+		if !isWatermark(part.Binlog) {
+			dmls = append(dmls, part)
+		}
+	}
+	switch len(dmls) {
+	case 0:
+		return nil
+	case 1:
+		return dmls[0]
+	}
+	binlog := &pb.Binlog{Type: pb.BinlogType_DML, CommitTs: dmls[0].Binlog.CommitTs, DmlData: &pb.DMLData{}}
+	for _, part := range dmls {
+		binlog.DmlData.Tables = append(binlog.DmlData.Tables, part.Binlog.GetDmlData().GetTables()...)
+	}
+	return &reader.Message{Binlog: binlog, Offset: dmls[0].Offset}
+}
+
+// isWatermark returns whether the binlog is a watermark, the DML binlog without tables, which only
+// means all the binlogs before it in the partition have been read.
+func isWatermark(binlog *pb.Binlog) bool {
+	return binlog.Type == pb.BinlogType_DML && len(binlog.GetDmlData().GetTables()) == 0
+}
+
+// isSchemaSnapshot returns whether the binlog is a schema snapshot produced by drainer, the DML binlog
+// of the tables without rows.
+func isSchemaSnapshot(binlog *pb.Binlog) bool {
+	if binlog.Type != pb.BinlogType_DML || len(binlog.GetDmlData().GetTables()) == 0 {
+		return false
+	}
+	for _, table := range binlog.DmlData.Tables {
+		if len(table.Mutations) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// receive decodes the message as the head of the partition, an error is returned if it fails to be
+// decoded unless skipUndecodable.
+func (r *partitionReader) receive(p *partitionState, kmsg *sarama.ConsumerMessage) error {
+	binlog, err := p.decoder.Decode(kmsg.Key, kmsg.Value)
+	if err != nil {
+		if !r.skipUndecodable {
+			return errors.Annotatef(err, "decode the message at offset %d of partition %d", kmsg.Offset, p.id)
+		}
+		log.Warn("skip the message failed to be decoded", zap.Int32("partition", p.id), zap.Int64("offset", kmsg.Offset), zap.Error(err))
+		undecodableCounter.Inc()
+		return nil
+	}
+	if binlog == nil || isSchemaSnapshot(binlog) {
+		return nil
+	}
+	if r.cfg.CommitTS > 0 && binlog.CommitTs <= r.cfg.CommitTS {
+		log.Debug("skip binlog", zap.Int32("partition", p.id), zap.Int64("commitTS", binlog.CommitTs))
+		return nil
+	}
+	if binlog.CommitTs <= r.sentTS {
+		log.Info("skip repeated binlog", zap.Int32("partition", p.id), zap.Int64("ts", binlog.CommitTs), zap.Int64("offset", kmsg.Offset))
+		return nil
+	}
+	p.head = &reader.Message{Binlog: binlog, Offset: kmsg.Offset}
+	return nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/gogo/protobuf/proto"
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/tidb-binlog/driver/reader"
+	pb "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+)
+
+type partitionSuite struct{}
+
+var _ = check.Suite(&partitionSuite{})
+
+type fakePartition struct {
+	msgs chan *sarama.ConsumerMessage
+}
+
+func (p *fakePartition) Messages() <-chan *sarama.ConsumerMessage { return p.msgs }
+
+func (p *fakePartition) send(c *check.C, offset int64, ts int64) {
+	p.sendBinlog(c, offset, &pb.Binlog{CommitTs: ts})
+}
+
+func (p *fakePartition) sendBinlog(c *check.C, offset int64, binlog *pb.Binlog) {
+	data, err := binlog.Marshal()
+	c.Assert(err, check.IsNil)
+	p.msgs <- &sarama.ConsumerMessage{Offset: offset, Value: data}
+}
+
+// dmlPart returns the part of a binlog with the table of the rows, or a schema snapshot of it without rows.
+func dmlPart(ts int64, table string, rows int) *pb.Binlog {
+	t := &pb.Table{SchemaName: proto.String("test"), TableName: proto.String(table)}
+	for i := 0; i < rows; i++ {
+		t.Mutations = append(t.Mutations, &pb.TableMutation{Type: pb.MutationType_Insert.Enum(), Row: &pb.Row{}})
+	}
+	return &pb.Binlog{Type: pb.BinlogType_DML, CommitTs: ts, DmlData: &pb.DMLData{Tables: []*pb.Table{t}}}
+}
+
+func (s *partitionSuite) TestCheckpointName(c *check.C) {
+	c.Assert(checkpointName("test", nil), check.Equals, "test")
+	c.Assert(checkpointName("test", []int32{2, 0, 1}), check.Equals, "test:0,1,2")
+}
+
+func (s *partitionSuite) TestMerge(c *check.C) {
+	p0 := &fakePartition{msgs: make(chan *sarama.ConsumerMessage, 10)}
+	p1 := &fakePartition{msgs: make(chan *sarama.ConsumerMessage, 10)}
+	// the binlogs with ts <= 10 are skipped.
+	p0.send(c, 0, 10)
+	p0.sendBinlog(c, 1, dmlPart(20, "a", 1))
+	p0.sendBinlog(c, 2, dmlPart(40, "a", 1))
+	p1.sendBinlog(c, 5, dmlPart(30, "b", 1))
+
+	r := &partitionReader{
+		cfg:  &reader.Config{CommitTS: 10},
+		msgs: make(chan *reader.Message, 10),
+		stop: make(chan struct{}),
+	}
+	for i, p := range []*fakePartition{p0, p1} {
+		r.partitions = append(r.partitions, &partitionState{
+			id:      int32(i),
+			source:  p,
+			decoder: &protobufDecoder{},
+		})
+	}
+	done := make(chan struct{})
+	go func() {
+		r.merge()
+		close(done)
+	}()
+
+	expect := func(ts int64) *pb.Binlog {
+		select {
+		case msg := <-r.msgs:
+			c.Assert(msg.Binlog.CommitTs, check.Equals, ts)
+			return msg.Binlog
+		case <-time.After(time.Second):
+			c.Fatalf("wait for binlog %d timeout", ts)
+		}
+		return nil
+	}
+	expectNone := func() {
+		select {
+		case msg := <-r.msgs:
+			c.Fatalf("unexpected binlog %d", msg.Binlog.CommitTs)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	expect(20)
+	expect(30)
+	// 40 waits for the part of partition 1.
+	expectNone()
+	p1.sendBinlog(c, 6, dmlPart(40, "b", 2))
+	binlog := expect(40)
+	c.Assert(binlog.DmlData.Tables, check.HasLen, 2)
+	c.Assert(binlog.DmlData.Tables[0].GetTableName(), check.Equals, "a")
+	c.Assert(binlog.DmlData.Tables[1].Mutations, check.HasLen, 2)
+
+	// partition 1 is lagging, 60 waits for it even if the partition has nothing to read now.
+	p0.sendBinlog(c, 3, dmlPart(60, "a", 1))
+	expectNone()
+	p1.sendBinlog(c, 7, dmlPart(50, "b", 1))
+	expect(50)
+	expectNone()
+	// the watermark of partition 1, and the repeated one is skipped.
+	p1.send(c, 8, 60)
+	p1.send(c, 9, 60)
+	c.Assert(expect(60).DmlData.Tables, check.HasLen, 1)
+
+	// the schema snapshot before the part is skipped.
+	p0.sendBinlog(c, 4, dmlPart(70, "a", 0))
+	p0.sendBinlog(c, 5, dmlPart(70, "a", 1))
+	p1.sendBinlog(c, 10, dmlPart(70, "b", 1))
+	binlog = expect(70)
+	c.Assert(binlog.DmlData.Tables, check.HasLen, 2)
+	c.Assert(binlog.DmlData.Tables[0].Mutations, check.HasLen, 1)
+
+	// the DDL is taken once.
+	ddl := &pb.Binlog{Type: pb.BinlogType_DDL, CommitTs: 80, DdlData: &pb.DDLData{DdlQuery: []byte("create table t(id int)")}}
+	p0.sendBinlog(c, 6, ddl)
+	p1.sendBinlog(c, 11, ddl)
+	c.Assert(expect(80).Type, check.Equals, pb.BinlogType_DDL)
+	expectNone()
+
+	// the watermarks of all the partitions are not sent.
+	p0.send(c, 7, 90)
+	p1.send(c, 12, 90)
+	expectNone()
+	p0.sendBinlog(c, 8, dmlPart(100, "a", 1))
+	p1.send(c, 13, 100)
+	c.Assert(expect(100).DmlData.Tables, check.HasLen, 1)
+
+	close(r.stop)
+	<-done
+}
+
+func (s *partitionSuite) TestMergeParts(c *check.C) {
+	watermark := &reader.Message{Binlog: &pb.Binlog{CommitTs: 10, DmlData: &pb.DMLData{}}}
+	c.Assert(mergeParts([]*reader.Message{watermark}), check.IsNil)
+
+	part := &reader.Message{Binlog: dmlPart(10, "a", 1), Offset: 5}
+	c.Assert(mergeParts([]*reader.Message{watermark, part}), check.Equals, part)
+}
+
+func (s *partitionSuite) TestUndecodable(c *check.C) {
+	newReader := func(skip bool) (*partitionReader, *fakePartition) {
+		p := &fakePartition{msgs: make(chan *sarama.ConsumerMessage, 10)}
+		r := &partitionReader{
+			cfg:             &reader.Config{},
+			skipUndecodable: skip,
+			msgs:            make(chan *reader.Message, 10),
+			stop:            make(chan struct{}),
+			partitions:      []*partitionState{{source: p, decoder: &protobufDecoder{}}},
+		}
+		p.msgs <- &sarama.ConsumerMessage{Offset: 0, Value: []byte("not a binlog")}
+		return r, p
+	}
+
+	// the reader stops with the error by default.
+	r, _ := newReader(false)
+	go r.run()
+	select {
+	case _, ok := <-r.msgs:
+		c.Assert(ok, check.IsFalse)
+	case <-time.After(time.Second):
+		c.Fatal("wait for the reader to stop timeout")
+	}
+	c.Assert(readerError(r), check.ErrorMatches, ".*decode the message at offset 0 of partition 0.*")
+
+	r, p := newReader(true)
+	p.sendBinlog(c, 1, dmlPart(20, "a", 1))
+	go r.run()
+	select {
+	case msg := <-r.msgs:
+		c.Assert(msg.Binlog.CommitTs, check.Equals, int64(20))
+	case <-time.After(time.Second):
+		c.Fatal("wait for binlog timeout")
+	}
+	close(r.stop)
+	for range r.msgs {
+	}
+	c.Assert(readerError(r), check.IsNil)
+}
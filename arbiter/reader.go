@@ -0,0 +1,41 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	"github.com/pingcap/tidb-tools/tidb-binlog/driver/reader"
+)
+
+// messageReader reads binlogs from the upstream topic
+type messageReader interface {
+	Messages() <-chan *reader.Message
+	Close()
+}
+
+var _ messageReader = &reader.Reader{}
+
+// failingReader is a messageReader which stops with an error, like a message failed to be decoded.
+type failingReader interface {
+	messageReader
+	// Err returns the error the reader stops with, it's set before the messages are closed.
+	Err() error
+}
+
+// readerError returns the error the reader stops with, nil if it can't fail.
+func readerError(r messageReader) error {
+	if r, ok := r.(failingReader); ok {
+		return r.Err()
+	}
+	return nil
+}
@@ -35,9 +35,10 @@ var (
 	initSafeModeDuration = time.Minute * 5
 
 	// Make it possible to mock the following functions
-	createDB  = loader.CreateDB
-	newReader = reader.NewReader
-	newLoader = loader.NewLoader
+	createDB           = loader.CreateDB
+	newReader          = reader.NewReader
+	newPartitionReader = newPartitionReaderImpl
+	newLoader          = loader.NewLoader
 )
 
 // Server is the server to load data to mysql
@@ -47,8 +48,16 @@ type Server struct {
 
 	load loader.Loader
 
+	transform Transform
+	// deadLetter is nil if the dead-letter topic isn't configured.
+	deadLetter *deadLetterWriter
+	// compat is nil if the messages aren't in the protobuf format.
+	compat *compatChecker
+	// flow is nil if neither max-lag nor max-downstream-errors is set.
+	flow *flowControl
+
 	checkpoint  Checkpoint
-	kafkaReader *reader.Reader
+	kafkaReader messageReader
 	downDB      *sql.DB
 
 	// all txn commitTS <= finishTS has loaded to downstream
@@ -84,7 +93,7 @@ func NewServer(cfg *Config) (srv *Server, err error) {
 	}
 
 	// set checkpoint
-	srv.checkpoint, err = NewCheckpoint(srv.downDB, up.Topic)
+	srv.checkpoint, err = NewCheckpoint(srv.downDB, checkpointName(up.Topic, up.Partitions))
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -105,23 +114,70 @@ func NewServer(cfg *Config) (srv *Server, err error) {
 		MessageBufferSize: up.MessageBufferSize,
 	}
 
-	log.Info("use kafka binlog reader", zap.Reflect("cfg", readerCfg))
+	log.Info("use kafka binlog reader", zap.Reflect("cfg", readerCfg), zap.String("format", up.MessageFormat), zap.Int32s("partitions", up.Partitions))
+
+	if up.MessageFormat == FormatProtobuf || up.MessageFormat == "" {
+		srv.compat = newCompatChecker(up.Compatibility)
+	}
 
-	srv.kafkaReader, err = newReader(readerCfg)
+	// the binlogs produced by drainer are only in partition 0 unless the partitions are set, the messages
+	// of other CDC tools are read from all the partitions of the topic.
+	if len(up.Partitions) == 0 && (up.MessageFormat == FormatProtobuf || up.MessageFormat == "") {
+		srv.kafkaReader, err = newReader(readerCfg)
+	} else {
+		// drainer produces the watermarks of protobuf, TiCDC produces them of canal-json if it's configured to.
+		watermarks := up.MessageFormat == FormatProtobuf || up.MessageFormat == "" || up.Watermarks
+		srv.kafkaReader, err = newPartitionReader(readerCfg, up.KafkaVersion, up.MessageFormat, up.Partitions, watermarks, up.SkipUndecodable)
+	}
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
 	log.Info("new kafka reader success")
 
-	// set loader
-	srv.load, err = newLoader(srv.downDB,
+	if len(down.TransformPlugin) > 0 {
+		srv.transform, err = LoadTransform(down.TransformPlugin)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		log.Info("load transform plugin success", zap.String("path", down.TransformPlugin))
+	}
+
+	isolation, err := loader.ParseIsolationLevel(down.IsolationLevel)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	opts := []loader.Option{
 		loader.WorkerCount(cfg.Down.WorkerCount),
 		loader.BatchSize(cfg.Down.BatchSize),
+		loader.ConnPool(down.MaxOpenConns, down.MaxIdleConns, time.Duration(down.ConnMaxLifetime)*time.Second),
+		loader.IsolationLevel(isolation),
 		loader.Metrics(&loader.MetricsGroup{
 			EventCounterVec:   eventCounter,
 			QueryHistogramVec: queryHistogramVec,
-		}))
+			QueueSizeGauge:    queueSizeGauge,
+
+			WorkerBusySecondsCounterVec: workerBusyCounter,
+			QueueWaitHistogram:          queueWaitHistogram,
+			ConflictStallHistogram:      conflictStallHistogram,
+			RetryCounterVec:             retryCounter,
+		}),
+	}
+
+	srv.flow = newFlowControl(&cfg.FlowControl, up.Topic, instanceName(srv.port))
+
+	if cfg.DeadLetter.enabled() {
+		srv.deadLetter, err = newDeadLetterWriter(&cfg.DeadLetter, up.Topic)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		opts = append(opts, loader.FailedTxnHandler(srv.flow.failedTxnHandler(srv.deadLetter.handleFailedTxn)))
+		log.Info("produce the failed binlogs to dead-letter topic", zap.String("topic", cfg.DeadLetter.Topic))
+	}
+
+	// set loader
+	srv.load, err = newLoader(srv.downDB, opts...)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -171,6 +227,9 @@ func (s *Server) Close() error {
 // Run runs the Server, will quit once encounter error or Server is closed
 func (s *Server) Run() error {
 	defer s.downDB.Close()
+	if s.deadLetter != nil {
+		defer s.deadLetter.close()
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -188,13 +247,22 @@ func (s *Server) Run() error {
 		wg.Done()
 	}()
 
+	wg.Add(1)
+	go func() {
+		s.flow.run(ctx, time.Second)
+		wg.Done()
+	}()
+
 	var syncErr error
 
 	syncCtx, syncCancel := context.WithCancel(ctx)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		syncErr = syncBinlogs(syncCtx, s.kafkaReader.Messages(), s.load)
+		syncErr = syncBinlogs(syncCtx, s.kafkaReader.Messages(), s.load, s.transform, s.deadLetter, s.compat, s.flow)
+		if syncErr == nil {
+			syncErr = readerError(s.kafkaReader)
+		}
 		if syncErr != nil {
 			s.Close()
 		}
@@ -226,6 +294,7 @@ func (s *Server) Run() error {
 
 func (s *Server) updateFinishTS(msg *reader.Message) {
 	s.finishTS = msg.Binlog.CommitTs
+	s.flow.loaded(msg.Binlog.CommitTs)
 
 	ms := time.Now().UnixNano()/1000000 - oracle.ExtractPhysical(uint64(s.finishTS))
 	txnLatencySecondsHistogram.Observe(float64(ms) / 1000.0)
@@ -284,11 +353,18 @@ func (s *Server) loadStatus() (int, error) {
 	return status, errors.Trace(err)
 }
 
-func syncBinlogs(ctx context.Context, source <-chan *reader.Message, ld loader.Loader) (err error) {
+// syncBinlogs sends the binlogs to the loader, the binlogs failed to be translated or
+// transformed are produced to the dead-letter topic and skipped if deadLetter isn't nil.
+// The binlogs not fully understood stop it in strict compatibility mode anyway, since
+// all the following ones are likely the same. It stops reading from source while flow pauses it.
+func syncBinlogs(ctx context.Context, source <-chan *reader.Message, ld loader.Loader, transform Transform, deadLetter *deadLetterWriter, compat *compatChecker, flow *flowControl) (err error) {
 	dest := ld.Input()
 	defer ld.Close()
 	var receivedTs int64
 	for msg := range source {
+		if !flow.wait(ctx) {
+			return nil
+		}
 		log.Debug("recv msg from kafka reader", zap.Int64("ts", msg.Binlog.CommitTs), zap.Int64("offset", msg.Offset))
 
 		if msg.Binlog.CommitTs <= receivedTs {
@@ -297,12 +373,34 @@ func syncBinlogs(ctx context.Context, source <-chan *reader.Message, ld loader.L
 		}
 		receivedTs = msg.Binlog.CommitTs
 
+		if err = compat.check(msg.Binlog); err != nil {
+			log.Error("binlog isn't fully understood, program will stop handling data from loader", zap.Int64("offset", msg.Offset), zap.Error(err))
+			return err
+		}
+
 		txn, err := loader.SecondaryBinlogToTxn(msg.Binlog)
 		if err != nil {
+			if deadLetter != nil {
+				if err = deadLetter.write(msg, stageDecode, err); err != nil {
+					return err
+				}
+				continue
+			}
 			log.Error("transfer binlog failed, program will stop handling data from loader", zap.Error(err))
 			return err
 		}
 		txn.Metadata = msg
+		if err = transformTxn(transform, txn); err != nil {
+			if deadLetter != nil {
+				if err = deadLetter.write(msg, stageTransform, err); err != nil {
+					return err
+				}
+				continue
+			}
+			log.Error("transform txn failed, program will stop handling data from loader", zap.Error(err))
+			return err
+		}
+		flow.received(msg.Binlog.CommitTs)
 		// avoid block when no process is handling ld.input
 		select {
 		case dest <- txn:
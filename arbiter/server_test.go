@@ -58,6 +58,7 @@ type testNewServerSuite struct {
 	dbMock        sqlmock.Sqlmock
 	origCreateDB  func(string, string, string, int, *tls.Config) (*sql.DB, error)
 	origNewReader func(*reader.Config) (*reader.Reader, error)
+	origNewPtRdr  func(*reader.Config, string, string, []int32, bool, bool) (messageReader, error)
 	origNewLoader func(*sql.DB, ...loader.Option) (loader.Loader, error)
 }
 
@@ -81,6 +82,8 @@ func (s *testNewServerSuite) SetUpTest(c *C) {
 		return &reader.Reader{}, nil
 	}
 
+	s.origNewPtRdr = newPartitionReader
+
 	s.origNewLoader = newLoader
 	newLoader = func(db *sql.DB, opt ...loader.Option) (loader.Loader, error) {
 		return &dummyLoader{}, nil
@@ -92,6 +95,7 @@ func (s *testNewServerSuite) TearDownTest(c *C) {
 
 	createDB = s.origCreateDB
 	newReader = s.origNewReader
+	newPartitionReader = s.origNewPtRdr
 	newLoader = s.origNewLoader
 }
 
@@ -161,6 +165,76 @@ func (s *testNewServerSuite) TestStopIfCannotCreateReader(c *C) {
 	c.Assert(err, ErrorMatches, "no reader")
 }
 
+func (s *testNewServerSuite) TestCreateDecodingReader(c *C) {
+	s.dbMock.ExpectExec("CREATE DATABASE.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	s.dbMock.ExpectExec("CREATE TABLE.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	s.dbMock.ExpectQuery("SELECT ts, status.*").
+		WithArgs("test_topic").
+		WillReturnError(errors.NotFoundf(""))
+	newReader = func(cfg *reader.Config) (r *reader.Reader, err error) {
+		c.Fatal("should not create protobuf reader")
+		return nil, nil
+	}
+	var (
+		format     string
+		partitions []int32
+		watermarks bool
+		skip       bool
+	)
+	newPartitionReader = func(cfg *reader.Config, kafkaVersion string, f string, ps []int32, w bool, skipUndecodable bool) (messageReader, error) {
+		format, partitions, watermarks, skip = f, ps, w, skipUndecodable
+		return &reader.Reader{}, nil
+	}
+
+	// all the partitions are read.
+	cfg := Config{
+		ListenAddr: "localhost:8080",
+		Up: UpConfig{
+			Topic:           "test_topic",
+			MessageFormat:   FormatDebezium,
+			SkipUndecodable: true,
+		},
+	}
+	_, err := NewServer(&cfg)
+	c.Assert(err, IsNil)
+	c.Assert(format, Equals, FormatDebezium)
+	c.Assert(partitions, HasLen, 0)
+	c.Assert(watermarks, IsFalse)
+	c.Assert(skip, IsTrue)
+}
+
+func (s *testNewServerSuite) TestCreatePartitionReader(c *C) {
+	s.dbMock.ExpectExec("CREATE DATABASE.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	s.dbMock.ExpectExec("CREATE TABLE.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	s.dbMock.ExpectQuery("SELECT ts, status.*").
+		WithArgs("test_topic:1,2").
+		WillReturnError(errors.NotFoundf(""))
+	newReader = func(cfg *reader.Config) (r *reader.Reader, err error) {
+		c.Fatal("should not create protobuf reader")
+		return nil, nil
+	}
+	var (
+		partitions []int32
+		watermarks bool
+	)
+	newPartitionReader = func(cfg *reader.Config, kafkaVersion string, format string, ps []int32, w bool, _ bool) (messageReader, error) {
+		partitions, watermarks = ps, w
+		return &reader.Reader{}, nil
+	}
+
+	cfg := Config{
+		ListenAddr: "localhost:8080",
+		Up: UpConfig{
+			Topic:      "test_topic",
+			Partitions: []int32{2, 1},
+		},
+	}
+	_, err := NewServer(&cfg)
+	c.Assert(err, IsNil)
+	c.Assert(partitions, DeepEquals, []int32{2, 1})
+	c.Assert(watermarks, IsTrue)
+}
+
 func (s *testNewServerSuite) TestStopIfCannotCreateLoader(c *C) {
 	s.dbMock.ExpectExec("CREATE DATABASE.*").WillReturnResult(sqlmock.NewResult(0, 0))
 	s.dbMock.ExpectExec("CREATE TABLE.*").WillReturnResult(sqlmock.NewResult(0, 0))
@@ -416,7 +490,7 @@ func (s *syncBinlogsSuite) TestShouldSendBinlogToLoader(c *C) {
 	}()
 	ld := dummyLoader{input: dest}
 
-	err := syncBinlogs(context.Background(), source, &ld)
+	err := syncBinlogs(context.Background(), source, &ld, nil, nil, nil, nil)
 	c.Assert(err, IsNil)
 
 	c.Assert(len(dest), Equals, len(expectMsgs))
@@ -455,7 +529,7 @@ func (s *syncBinlogsSuite) TestShouldQuitWhenSomeErrorOccurs(c *C) {
 	}()
 	errCh := make(chan error)
 	go func() {
-		errCh <- syncBinlogs(ctx, readerMsgs, dummyLoaderImpl)
+		errCh <- syncBinlogs(ctx, readerMsgs, dummyLoaderImpl, nil, nil, nil, nil)
 	}()
 
 	cancel()
@@ -0,0 +1,67 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	"plugin"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+// TransformSymbol is the name of the function exported by the transform plugin.
+const TransformSymbol = "Transform"
+
+// Transform modifies the txn in place before it's loaded to downstream, like
+// dropping rows from txn.DMLs, renaming the tables of the DMLs or adding
+// derived columns to the values, which must exist in the downstream table. The
+// txn is kept to track the checkpoint even if all its DMLs and DDL are dropped.
+type Transform func(txn *loader.Txn) error
+
+var openPlugin = plugin.Open
+
+// LoadTransform loads the Transform function from the Go plugin, the plugin
+// must export a function named Transform with the signature of Transform, and
+// be built with the same version of Go and tidb-binlog as arbiter.
+func LoadTransform(path string) (Transform, error) {
+	p, err := openPlugin(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "open transform plugin %s", path)
+	}
+
+	sym, err := p.Lookup(TransformSymbol)
+	if err != nil {
+		return nil, errors.Annotatef(err, "lookup %s in transform plugin %s", TransformSymbol, path)
+	}
+
+	switch fn := sym.(type) {
+	case func(*loader.Txn) error:
+		return fn, nil
+	case *Transform:
+		return *fn, nil
+	default:
+		return nil, errors.Errorf("%s in transform plugin %s is %T, must be func(*loader.Txn) error", TransformSymbol, path, sym)
+	}
+}
+
+func transformTxn(transform Transform, txn *loader.Txn) error {
+	if transform == nil {
+		return nil
+	}
+
+	if err := transform(txn); err != nil {
+		return errors.Annotatef(err, "transform txn %s", txn)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arbiter
+
+import (
+	"context"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-tools/tidb-binlog/driver/reader"
+	pb "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+)
+
+type transformSuite struct{}
+
+var _ = Suite(&transformSuite{})
+
+func (s *transformSuite) TestLoadTransform(c *C) {
+	_, err := LoadTransform("/not/exist/transform.so")
+	c.Assert(err, ErrorMatches, "open transform plugin /not/exist/transform.so.*")
+}
+
+func (s *transformSuite) TestSyncBinlogsWithTransform(c *C) {
+	var msgs syncBinlogsSuite
+	source := make(chan *reader.Message, 2)
+	for i, table := range []string{"users", "logs"} {
+		msg := msgs.createMsg("test", table, "alter table "+table+" add column c int", int64(i+1))
+		msg.Binlog.Type = pb.BinlogType_DDL
+		source <- msg
+	}
+	close(source)
+
+	transform := func(txn *loader.Txn) error {
+		if txn.DDL.Table == "logs" {
+			// drop it
+			txn.DDL = nil
+			return nil
+		}
+		txn.DDL.Table = "users_v2"
+		return nil
+	}
+
+	dest := make(chan *loader.Txn, 2)
+	ld := dummyLoader{input: dest}
+	err := syncBinlogs(context.Background(), source, &ld, transform, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(dest, HasLen, 2)
+
+	txn := <-dest
+	c.Assert(txn.DDL.Table, Equals, "users_v2")
+	// the dropped txn is kept to track the checkpoint
+	txn = <-dest
+	c.Assert(txn.DDL, IsNil)
+	c.Assert(txn.Metadata.(*reader.Message).Binlog.CommitTs, Equals, int64(2))
+
+	source = make(chan *reader.Message, 1)
+	source <- msgs.createMsg("test", "users", "alter table users add column c int", 1)
+	close(source)
+	err = syncBinlogs(context.Background(), source, &dummyLoader{input: dest}, func(*loader.Txn) error {
+		return errors.New("unknown table")
+	}, nil, nil, nil)
+	c.Assert(err, ErrorMatches, "transform txn .*: unknown table")
+}
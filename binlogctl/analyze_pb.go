@@ -0,0 +1,211 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb-binlog/reparo/syncer"
+	"go.uber.org/zap"
+)
+
+// PBAnalysis is the report of the binlog files written by drainer with db-type file.
+type PBAnalysis struct {
+	Files         int
+	Binlogs       int
+	FirstCommitTS int64
+	LastCommitTS  int64
+	// Disordered is the count of the binlogs whose commit ts isn't after the previous one, like the
+	// binlogs written again after drainer restarts.
+	Disordered int
+	Tables     []*PBTableStats
+	DDLs       []*PBDDL
+	// Gaps are the ranges longer than the gap without any binlog.
+	Gaps []*PBGap
+	// Corrupted are the files failed to be read, the binlogs before the error are analyzed.
+	Corrupted []*PBCorruptedFile
+}
+
+// PBTableStats are the counts of the row changes of a table and the bytes of the rows.
+type PBTableStats struct {
+	Schema  string
+	Table   string
+	Inserts int64
+	Updates int64
+	Deletes int64
+	Bytes   int64
+}
+
+// PBDDL is a DDL in the binlog files.
+type PBDDL struct {
+	CommitTS int64
+	Schema   string
+	Table    string
+	Query    string
+}
+
+// PBGap is the range between two consecutive binlogs.
+type PBGap struct {
+	FromCommitTS int64
+	ToCommitTS   int64
+	Duration     time.Duration
+}
+
+// PBCorruptedFile is a file failed to be read.
+type PBCorruptedFile struct {
+	Name string
+	// Binlogs is the count of the binlogs read before the error.
+	Binlogs int
+	Err     error
+}
+
+// AnalyzePBFiles reads all the binlog files in the dir and logs the binlogs of every table, the
+// DDLs, and the gaps longer than gap between the commit time of the consecutive binlogs, so the
+// files can be validated before they're relied on as a backup. The files are never repaired.
+func AnalyzePBFiles(dir string, gap time.Duration) error {
+	analysis, err := analyzePBFiles(dir, gap)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, t := range analysis.Tables {
+		log.Info("table", zap.String("schema", t.Schema), zap.String("table", t.Table), zap.Int64("inserts", t.Inserts),
+			zap.Int64("updates", t.Updates), zap.Int64("deletes", t.Deletes), zap.Int64("bytes", t.Bytes))
+	}
+	for _, ddl := range analysis.DDLs {
+		log.Info("ddl", zap.Int64("commit ts", ddl.CommitTS), zap.Stringer("time", util.TSOToRoughTime(ddl.CommitTS)),
+			zap.String("schema", ddl.Schema), zap.String("table", ddl.Table), zap.String("query", ddl.Query))
+	}
+	for _, g := range analysis.Gaps {
+		log.Warn("no binlog in the gap", zap.Int64("from commit ts", g.FromCommitTS), zap.Stringer("from time", util.TSOToRoughTime(g.FromCommitTS)),
+			zap.Int64("to commit ts", g.ToCommitTS), zap.Stringer("to time", util.TSOToRoughTime(g.ToCommitTS)), zap.Duration("duration", g.Duration))
+	}
+	for _, f := range analysis.Corrupted {
+		log.Error("corrupted binlog file", zap.String("name", f.Name), zap.Int("binlogs read", f.Binlogs), zap.Error(f.Err))
+	}
+	log.Info("analyze pb files success", zap.String("dir", dir), zap.Int("files", analysis.Files), zap.Int("binlogs", analysis.Binlogs),
+		zap.Int64("first commit ts", analysis.FirstCommitTS), zap.Stringer("first time", util.TSOToRoughTime(analysis.FirstCommitTS)),
+		zap.Int64("last commit ts", analysis.LastCommitTS), zap.Stringer("last time", util.TSOToRoughTime(analysis.LastCommitTS)),
+		zap.Int("disordered binlogs", analysis.Disordered), zap.Int("tables", len(analysis.Tables)), zap.Int("ddls", len(analysis.DDLs)),
+		zap.Int("gaps", len(analysis.Gaps)), zap.Int("corrupted files", len(analysis.Corrupted)))
+	if len(analysis.Corrupted) > 0 {
+		return errors.Errorf("%d binlog files are corrupted", len(analysis.Corrupted))
+	}
+	return nil
+}
+
+func analyzePBFiles(dir string, gap time.Duration) (*PBAnalysis, error) {
+	names, err := binlogfile.ReadBinlogNames(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	analysis := &PBAnalysis{Files: len(names)}
+	tables := make(map[string]*PBTableStats)
+	var lastTS int64
+	for _, name := range names {
+		count := 0
+		err = readBinlogFile(path.Join(dir, name), func(payload []byte) error {
+			binlog := new(pb.Binlog)
+			if err := binlog.Unmarshal(payload); err != nil {
+				return errors.Trace(err)
+			}
+			count++
+			analysis.Binlogs++
+
+			commitTS := binlog.CommitTs
+			if commitTS <= lastTS {
+				analysis.Disordered++
+			} else {
+				if lastTS > 0 {
+					if d := util.TSOToRoughTime(commitTS).Sub(util.TSOToRoughTime(lastTS)); d > gap {
+						analysis.Gaps = append(analysis.Gaps, &PBGap{FromCommitTS: lastTS, ToCommitTS: commitTS, Duration: d})
+					}
+				}
+				lastTS = commitTS
+			}
+			if analysis.FirstCommitTS == 0 || commitTS < analysis.FirstCommitTS {
+				analysis.FirstCommitTS = commitTS
+			}
+			if commitTS > analysis.LastCommitTS {
+				analysis.LastCommitTS = commitTS
+			}
+
+			switch binlog.Tp {
+			case pb.BinlogType_DDL:
+				analysis.DDLs = append(analysis.DDLs, analyzePBDDL(binlog))
+			case pb.BinlogType_DML:
+				for _, event := range binlog.DmlData.GetEvents() {
+					analyzePBEvent(tables, &event)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			analysis.Corrupted = append(analysis.Corrupted, &PBCorruptedFile{Name: name, Binlogs: count, Err: err})
+		}
+	}
+
+	for _, t := range tables {
+		analysis.Tables = append(analysis.Tables, t)
+	}
+	sort.Slice(analysis.Tables, func(i, j int) bool {
+		if analysis.Tables[i].Schema != analysis.Tables[j].Schema {
+			return analysis.Tables[i].Schema < analysis.Tables[j].Schema
+		}
+		return analysis.Tables[i].Table < analysis.Tables[j].Table
+	})
+	return analysis, nil
+}
+
+// analyzePBDDL returns the DDL of the binlog, the schema and table are left empty if they can't
+// be parsed from the query.
+func analyzePBDDL(binlog *pb.Binlog) *PBDDL {
+	ddl := &PBDDL{CommitTS: binlog.CommitTs, Query: strings.TrimSpace(string(binlog.DdlQuery))}
+	txn, err := syncer.PBBinlogToTxn(binlog)
+	if err != nil {
+		log.Warn("parse ddl failed", zap.Int64("commit ts", binlog.CommitTs), zap.String("query", ddl.Query), zap.Error(err))
+		return ddl
+	}
+	ddl.Schema, ddl.Table = txn.DDL.Database, txn.DDL.Table
+	return ddl
+}
+
+func analyzePBEvent(tables map[string]*PBTableStats, event *pb.Event) {
+	key := event.GetSchemaName() + "." + event.GetTableName()
+	t, ok := tables[key]
+	if !ok {
+		t = &PBTableStats{Schema: event.GetSchemaName(), Table: event.GetTableName()}
+		tables[key] = t
+	}
+	switch event.GetTp() {
+	case pb.EventType_Insert:
+		t.Inserts++
+	case pb.EventType_Update:
+		t.Updates++
+	case pb.EventType_Delete:
+		t.Deletes++
+	}
+	for _, col := range event.GetRow() {
+		t.Bytes += int64(len(col))
+	}
+}
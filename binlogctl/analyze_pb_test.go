@@ -0,0 +1,94 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"os"
+	"path"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+var _ = Suite(&testAnalyzePBSuite{})
+
+type testAnalyzePBSuite struct{}
+
+func (s *testAnalyzePBSuite) TestAnalyzePBFiles(c *C) {
+	dir := c.MkDir()
+	base := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	ts := func(d time.Duration) int64 {
+		return int64(oracle.ComposeTS(oracle.GetPhysical(base.Add(d)), 0))
+	}
+	marshal := func(binlog *pb.Binlog) []byte {
+		data, err := binlog.Marshal()
+		c.Assert(err, IsNil)
+		return data
+	}
+	writeBinlogs(c, dir,
+		marshal(&pb.Binlog{Tp: pb.BinlogType_DDL, CommitTs: ts(0), DdlQuery: []byte("use `test`; create table t(id int primary key);")}),
+		marshal(&pb.Binlog{Tp: pb.BinlogType_DML, CommitTs: ts(time.Minute), DmlData: &pb.DMLData{Events: []pb.Event{
+			pbEvent(c, pb.EventType_Insert, 1, 0),
+			pbEvent(c, pb.EventType_Insert, 2, 0),
+			pbEvent(c, pb.EventType_Update, 1, 3),
+		}}}),
+		// written again after drainer restarts.
+		marshal(&pb.Binlog{Tp: pb.BinlogType_DML, CommitTs: ts(time.Minute), DmlData: &pb.DMLData{Events: []pb.Event{
+			pbEvent(c, pb.EventType_Delete, 2, 0),
+		}}}),
+		marshal(&pb.Binlog{Tp: pb.BinlogType_DDL, CommitTs: ts(3 * time.Hour), DdlQuery: []byte("create database test2")}),
+	)
+
+	analysis, err := analyzePBFiles(dir, time.Hour)
+	c.Assert(err, IsNil)
+	c.Assert(analysis.Files, Equals, 1)
+	c.Assert(analysis.Binlogs, Equals, 4)
+	c.Assert(analysis.FirstCommitTS, Equals, ts(0))
+	c.Assert(analysis.LastCommitTS, Equals, ts(3*time.Hour))
+	c.Assert(analysis.Disordered, Equals, 1)
+	c.Assert(analysis.Corrupted, HasLen, 0)
+
+	c.Assert(analysis.Tables, HasLen, 1)
+	table := analysis.Tables[0]
+	c.Assert(table.Schema, Equals, "test")
+	c.Assert(table.Table, Equals, "t")
+	c.Assert([]int64{table.Inserts, table.Updates, table.Deletes}, DeepEquals, []int64{2, 1, 1})
+	c.Assert(table.Bytes > 0, IsTrue)
+
+	c.Assert(analysis.DDLs, DeepEquals, []*PBDDL{
+		{CommitTS: ts(0), Schema: "test", Table: "t", Query: "use `test`; create table t(id int primary key);"},
+		{CommitTS: ts(3 * time.Hour), Schema: "test2", Query: "create database test2"},
+	})
+	c.Assert(analysis.Gaps, DeepEquals, []*PBGap{{FromCommitTS: ts(time.Minute), ToCommitTS: ts(3 * time.Hour), Duration: 3*time.Hour - time.Minute}})
+
+	// a truncated binlog at the end of the file.
+	names, err := binlogfile.ReadBinlogNames(dir)
+	c.Assert(err, IsNil)
+	f, err := os.OpenFile(path.Join(dir, names[0]), os.O_APPEND|os.O_WRONLY, 0600)
+	c.Assert(err, IsNil)
+	_, err = f.Write([]byte{1, 2, 3})
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	analysis, err = analyzePBFiles(dir, time.Hour)
+	c.Assert(err, IsNil)
+	c.Assert(analysis.Binlogs, Equals, 4)
+	c.Assert(analysis.Corrupted, HasLen, 1)
+	c.Assert(analysis.Corrupted[0].Name, Equals, names[0])
+	c.Assert(analysis.Corrupted[0].Binlogs, Equals, 4)
+	c.Assert(AnalyzePBFiles(dir, time.Hour), ErrorMatches, "1 binlog files are corrupted")
+}
@@ -0,0 +1,202 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	"go.uber.org/zap"
+)
+
+// QueryTableAssignment prints the tables assigned to the drainers of the group.
+func QueryTableAssignment(cfg *Config) error {
+	if len(cfg.Group) == 0 {
+		return errors.New("need to specify the drainer group by -group")
+	}
+
+	registry, err := createRegistryFuc(cfg.EtcdURLs, cfg.TLS)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	a, err := registry.Assignment(context.Background(), cfg.Group)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if a == nil {
+		log.Info("no table is assigned in the group", zap.String("group", cfg.Group))
+		return nil
+	}
+
+	for _, t := range a.Tables {
+		log.Info("query assignment", zap.String("group", cfg.Group), zap.Int64("version", a.Version),
+			zap.String("table", t.Name()), zap.String("drainer", t.Drainer), zap.Int64("since", t.Since))
+	}
+	return nil
+}
+
+// AssignDrainerTables assigns the tables of -tables to the drainer of -node-id in the group. The drainer owning
+// a table before, including by its schema, hands it over at its checkpoint, and the new owner syncs the
+// binlogs of the table committed after it. Both drainers must be paused, and the checkpoint of the new
+// owner must not be after the one of the previous owner, or the binlogs between them are lost.
+// The plan is only printed unless execute is set.
+func AssignDrainerTables(cfg *Config) error {
+	if len(cfg.Group) == 0 {
+		return errors.New("need to specify the drainer group by -group")
+	}
+	if len(cfg.NodeID) == 0 {
+		return errors.New("need to specify the drainer to assign the tables to by -node-id")
+	}
+	names, err := parseTableNames(cfg.Tables)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	registry, err := createRegistryFuc(cfg.EtcdURLs, cfg.TLS)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	ctx := context.Background()
+	receiver, err := getStoppedDrainer(ctx, registry, cfg.NodeID, "assigning the tables to it")
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	a, err := registry.Assignment(ctx, cfg.Group)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if a == nil {
+		a = &node.Assignment{}
+	}
+
+	for _, name := range names {
+		entry := &node.TableAssignment{Schema: name[0], Table: name[1], Drainer: receiver.NodeID}
+		if prev := a.Lookup(entry.Schema, entry.Table); prev != nil {
+			if prev.Drainer == receiver.NodeID {
+				return errors.Errorf("%s is assigned to drainer %s already", entry.Name(), receiver.NodeID)
+			}
+			giver, err := getStoppedDrainer(ctx, registry, prev.Drainer, "handing over its tables")
+			if err != nil {
+				return errors.Trace(err)
+			}
+			entry.Since = giver.MaxCommitTS
+			if receiver.MaxCommitTS > entry.Since {
+				return errors.Errorf("the checkpoint %d of drainer %s is after the checkpoint %d of drainer %s owning %s, "+
+					"the binlogs between them would be lost, rewind drainer %s to %d by rewind-drainer first",
+					receiver.MaxCommitTS, receiver.NodeID, entry.Since, giver.NodeID, entry.Name(), receiver.NodeID, entry.Since)
+			}
+			log.Info("assign tables plan", zap.String("table", entry.Name()), zap.String("from", giver.NodeID),
+				zap.String("to", receiver.NodeID), zap.Int64("since", entry.Since))
+		} else {
+			log.Info("assign tables plan", zap.String("table", entry.Name()), zap.String("to", receiver.NodeID),
+				zap.String("since", "the checkpoint of the drainer"))
+		}
+		a.Set(entry)
+	}
+
+	if !cfg.Execute {
+		log.Info("dry run, add -execute to assign the tables")
+		return nil
+	}
+
+	if err = registry.SaveAssignment(ctx, cfg.Group, a); err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("assign tables success, resume the drainers to sync by the new assignment",
+		zap.String("group", cfg.Group), zap.Int64("version", a.Version))
+	return nil
+}
+
+// UnassignDrainerTables removes the entries of the tables of -tables in the group, then they're not synced by any
+// drainer of the group. The drainer owning a table must be paused. A table can't be unassigned if its
+// schema is assigned to another drainer, since it would be synced by that drainer from an unknown position.
+// The plan is only printed unless execute is set.
+func UnassignDrainerTables(cfg *Config) error {
+	if len(cfg.Group) == 0 {
+		return errors.New("need to specify the drainer group by -group")
+	}
+	names, err := parseTableNames(cfg.Tables)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	registry, err := createRegistryFuc(cfg.EtcdURLs, cfg.TLS)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	ctx := context.Background()
+	a, err := registry.Assignment(ctx, cfg.Group)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if a == nil {
+		return errors.Errorf("no table is assigned in group %s", cfg.Group)
+	}
+
+	for _, name := range names {
+		entry := a.Remove(name[0], name[1])
+		if entry == nil {
+			return errors.Errorf("%s is not assigned in group %s", strings.TrimSuffix(name[0]+"."+name[1], "."), cfg.Group)
+		}
+		if len(entry.Table) > 0 {
+			if schema := a.Lookup(entry.Schema, ""); schema != nil && schema.Drainer != entry.Drainer {
+				return errors.Errorf("schema %s is assigned to drainer %s, assign %s to it by assign-tables instead",
+					entry.Schema, schema.Drainer, entry.Name())
+			}
+		}
+		if _, err := getStoppedDrainer(ctx, registry, entry.Drainer, "unassigning its tables"); err != nil {
+			return errors.Trace(err)
+		}
+		log.Info("unassign tables plan", zap.String("table", entry.Name()), zap.String("from", entry.Drainer))
+	}
+
+	if !cfg.Execute {
+		log.Info("dry run, add -execute to unassign the tables")
+		return nil
+	}
+
+	if err = registry.SaveAssignment(ctx, cfg.Group, a); err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("unassign tables success, resume the drainers to sync by the new assignment",
+		zap.String("group", cfg.Group), zap.Int64("version", a.Version))
+	return nil
+}
+
+// parseTableNames parses the comma separated list of "schema" or "schema.table" to the pairs of schema and table.
+func parseTableNames(tables string) ([][2]string, error) {
+	var names [][2]string
+	for _, name := range strings.Split(tables, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		parts := strings.SplitN(name, ".", 2)
+		if len(parts[0]) == 0 || (len(parts) == 2 && len(parts[1]) == 0) {
+			return nil, errors.Errorf("invalid table name %s", name)
+		}
+		if len(parts) == 1 {
+			parts = append(parts, "")
+		}
+		names = append(names, [2]string{strings.ToLower(parts[0]), strings.ToLower(parts[1])})
+	}
+	if len(names) == 0 {
+		return nil, errors.New("need to specify the tables by -tables, like \"db1,db2.t1\"")
+	}
+	return names, nil
+}
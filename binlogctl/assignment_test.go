@@ -0,0 +1,128 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"context"
+	"path"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/etcd"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+)
+
+var _ = Suite(&testAssignmentSuite{})
+
+type testAssignmentSuite struct{}
+
+func (s *testAssignmentSuite) SetUpTest(c *C) {
+	newEtcdClientFromCfgFunc = newFakeEtcdClientFromCfg
+	createRegistryFuc = createMockRegistry
+	_, err := createMockRegistry("127.0.0.1:2379", nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *testAssignmentSuite) TearDownTest(c *C) {
+	cli, err := createEtcdClient("127.0.0.1:2379", nil)
+	c.Assert(err, IsNil)
+	ctx := context.Background()
+	c.Assert(cli.Delete(ctx, node.NodePrefix[node.DrainerNode], true), IsNil)
+	c.Assert(cli.Delete(ctx, path.Join(node.AssignmentPrefix, "g1"), false), IsNil)
+
+	newEtcdClientFromCfgFunc = etcd.NewClientFromCfg
+	createRegistryFuc = createRegistry
+}
+
+func (s *testAssignmentSuite) registerDrainer(c *C, nodeID string, state string, checkpoint int64) {
+	status := &node.Status{NodeID: nodeID, Addr: "127.0.0.1:8249", State: state, MaxCommitTS: checkpoint}
+	c.Assert(fakeRegistry.UpdateNode(context.Background(), node.NodePrefix[node.DrainerNode], status), IsNil)
+}
+
+func (s *testAssignmentSuite) assignment(c *C) *node.Assignment {
+	a, err := fakeRegistry.Assignment(context.Background(), "g1")
+	c.Assert(err, IsNil)
+	return a
+}
+
+func (s *testAssignmentSuite) TestAssign(c *C) {
+	s.registerDrainer(c, "d1", node.Paused, 1000)
+	s.registerDrainer(c, "d2", node.Online, 500)
+
+	cfg := &Config{EtcdURLs: "127.0.0.1:2379", Group: "g1", NodeID: "d1", Tables: "DB1, db2.t1"}
+	c.Assert(QueryTableAssignment(cfg), IsNil)
+
+	// dry run
+	c.Assert(AssignDrainerTables(cfg), IsNil)
+	c.Assert(s.assignment(c), IsNil)
+
+	cfg.Execute = true
+	c.Assert(AssignDrainerTables(cfg), IsNil)
+	a := s.assignment(c)
+	c.Assert(a.Version, Equals, int64(1))
+	c.Assert(a.Tables, DeepEquals, []*node.TableAssignment{
+		{Schema: "db1", Drainer: "d1"},
+		{Schema: "db2", Table: "t1", Drainer: "d1"},
+	})
+	c.Assert(AssignDrainerTables(cfg), ErrorMatches, "db1 is assigned to drainer d1 already")
+
+	// hand db1.t1 over from d1 to d2.
+	cfg.NodeID, cfg.Tables = "d2", "db1.t1"
+	c.Assert(AssignDrainerTables(cfg), ErrorMatches, ".*drainer d2 is online, pause it before assigning the tables to it.*")
+	s.registerDrainer(c, "d2", node.Paused, 1500)
+	c.Assert(AssignDrainerTables(cfg), ErrorMatches, ".*checkpoint 1500 of drainer d2 is after the checkpoint 1000 of drainer d1.*rewind drainer d2 to 1000.*")
+	s.registerDrainer(c, "d2", node.Paused, 500)
+	s.registerDrainer(c, "d1", node.Online, 1000)
+	c.Assert(AssignDrainerTables(cfg), ErrorMatches, ".*drainer d1 is online, pause it before handing over its tables.*")
+	s.registerDrainer(c, "d1", node.Paused, 1000)
+	c.Assert(AssignDrainerTables(cfg), IsNil)
+
+	a = s.assignment(c)
+	c.Assert(a.Version, Equals, int64(2))
+	c.Assert(a.Lookup("db1", "t1"), DeepEquals, &node.TableAssignment{Schema: "db1", Table: "t1", Drainer: "d2", Since: 1000})
+	c.Assert(a.Lookup("db1", "t2").Drainer, Equals, "d1")
+}
+
+func (s *testAssignmentSuite) TestUnassign(c *C) {
+	s.registerDrainer(c, "d1", node.Paused, 1000)
+	s.registerDrainer(c, "d2", node.Paused, 1000)
+	cfg := &Config{EtcdURLs: "127.0.0.1:2379", Group: "g1", Tables: "db1.t1", Execute: true}
+	c.Assert(UnassignDrainerTables(cfg), ErrorMatches, "no table is assigned in group g1")
+
+	cfg.NodeID, cfg.Tables = "d1", "db1.t1,db2.t1"
+	c.Assert(AssignDrainerTables(cfg), IsNil)
+	cfg.NodeID, cfg.Tables = "d2", "db1"
+	c.Assert(AssignDrainerTables(cfg), IsNil)
+
+	cfg.Tables = "db1.t1"
+	c.Assert(UnassignDrainerTables(cfg), ErrorMatches, "schema db1 is assigned to drainer d2, assign db1.t1 to it by assign-tables instead")
+	cfg.Tables = "db3"
+	c.Assert(UnassignDrainerTables(cfg), ErrorMatches, "db3 is not assigned in group g1")
+
+	cfg.Tables = "db2.t1,db1"
+	c.Assert(UnassignDrainerTables(cfg), IsNil)
+	c.Assert(s.assignment(c).Tables, DeepEquals, []*node.TableAssignment{{Schema: "db1", Table: "t1", Drainer: "d1"}})
+}
+
+func (s *testAssignmentSuite) TestParseTableNames(c *C) {
+	names, err := parseTableNames("db1, Db2.T1,,db3.t.1")
+	c.Assert(err, IsNil)
+	c.Assert(names, DeepEquals, [][2]string{{"db1", ""}, {"db2", "t1"}, {"db3", "t.1"}})
+
+	_, err = parseTableNames(" , ")
+	c.Assert(err, ErrorMatches, "need to specify the tables.*")
+	_, err = parseTableNames("db1.")
+	c.Assert(err, ErrorMatches, "invalid table name db1.")
+	_, err = parseTableNames(".t1")
+	c.Assert(err, ErrorMatches, "invalid table name .t1")
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/etcd"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	"go.uber.org/zap"
+)
+
+// MetaBackup is the snapshot of all the keys of tidb-binlog stored in etcd,
+// like the registrations and states of pumps and drainers.
+type MetaBackup struct {
+	RootPath   string    `json:"root-path"`
+	ExportTime time.Time `json:"export-time"`
+	KVs        []*MetaKV `json:"kvs"`
+}
+
+// MetaKV is a key and its value, the key is relative to the root path.
+type MetaKV struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ExportMetaInfo saves all the keys of tidb-binlog stored in etcd to the file.
+func ExportMetaInfo(urls, file string, tlsConfig *tls.Config) error {
+	cli, err := createEtcdClient(urls, tlsConfig)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdDialTimeout)
+	defer cancel()
+	root, err := cli.List(ctx, "")
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	backup := &MetaBackup{
+		RootPath:   node.DefaultRootPath,
+		ExportTime: time.Now(),
+	}
+	collectKVs(root, "", &backup.KVs)
+	sort.Slice(backup.KVs, func(i, j int) bool {
+		return backup.KVs[i].Key < backup.KVs[j].Key
+	})
+
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = ioutil.WriteFile(file, data, 0600); err != nil {
+		return errors.Trace(err)
+	}
+
+	log.Info("export meta success", zap.String("file", file), zap.Int("keys", len(backup.KVs)))
+	return nil
+}
+
+func collectKVs(n *etcd.Node, key string, kvs *[]*MetaKV) {
+	if n.Value != nil {
+		*kvs = append(*kvs, &MetaKV{Key: key, Value: string(n.Value)})
+	}
+	for name, child := range n.Childs {
+		collectKVs(child, path.Join(key, name), kvs)
+	}
+}
+
+// ImportMetaInfo restores the keys of tidb-binlog saved by ExportMetaInfo to etcd.
+// The keys that already exist are skipped unless overwrite is true, because they
+// are probably registered again by the nodes running.
+func ImportMetaInfo(urls, file string, overwrite bool, tlsConfig *tls.Config) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	backup := new(MetaBackup)
+	if err = json.Unmarshal(data, backup); err != nil {
+		return errors.Annotatef(err, "parse meta file %s", file)
+	}
+	if backup.RootPath != node.DefaultRootPath {
+		return errors.Errorf("root path %s of the meta file doesn't match %s", backup.RootPath, node.DefaultRootPath)
+	}
+
+	cli, err := createEtcdClient(urls, tlsConfig)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	var restored int
+	for _, kv := range backup.KVs {
+		key := path.Join(node.DefaultRootPath, kv.Key)
+		ok, err := restoreKey(cli, key, kv.Value, overwrite)
+		if err != nil {
+			return errors.Annotatef(err, "restore key %s", key)
+		}
+		if !ok {
+			log.Warn("skip the key that already exists", zap.String("key", key))
+			continue
+		}
+		restored++
+	}
+
+	log.Info("import meta success", zap.String("file", file), zap.Time("export time", backup.ExportTime),
+		zap.Int("keys", len(backup.KVs)), zap.Int("restored", restored))
+	return nil
+}
+
+// restoreKey writes the key with its own timeout, false is returned if the key already exists and
+// isn't overwritten.
+func restoreKey(cli *etcd.Client, key, value string, overwrite bool) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdDialTimeout)
+	defer cancel()
+
+	if overwrite {
+		return true, errors.Trace(cli.UpdateOrCreate(ctx, key, value, 0))
+	}
+	err := cli.Create(ctx, key, value, nil)
+	if err != nil && errors.IsAlreadyExists(err) {
+		return false, nil
+	}
+	return true, errors.Trace(err)
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/etcd"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+)
+
+var _ = Suite(&testBackupSuite{})
+
+type testBackupSuite struct{}
+
+func (s *testBackupSuite) SetUpTest(c *C) {
+	newEtcdClientFromCfgFunc = newFakeEtcdClientFromCfg
+	createRegistryFuc = createMockRegistry
+	_, err := createMockRegistry("127.0.0.1:2379", nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *testBackupSuite) TearDownTest(c *C) {
+	newEtcdClientFromCfgFunc = etcd.NewClientFromCfg
+	createRegistryFuc = createRegistry
+}
+
+func (s *testBackupSuite) TestExportAndImport(c *C) {
+	cli, err := createEtcdClient("127.0.0.1:2379", nil)
+	c.Assert(err, IsNil)
+	ctx := context.Background()
+	defer cli.Delete(ctx, node.NodePrefix[node.PumpNode], true)
+
+	for _, nodeID := range []string{"backup-pump", "backup-pump2"} {
+		ns := &node.Status{NodeID: nodeID, Addr: "127.0.0.1:8250", State: node.Online}
+		err = fakeRegistry.UpdateNode(ctx, node.NodePrefix[node.PumpNode], ns)
+		c.Assert(err, IsNil)
+	}
+
+	file := path.Join(c.MkDir(), "meta.json")
+	err = ExportMetaInfo("127.0.0.1:2379", file, nil)
+	c.Assert(err, IsNil)
+
+	data, err := ioutil.ReadFile(file)
+	c.Assert(err, IsNil)
+	backup := new(MetaBackup)
+	c.Assert(json.Unmarshal(data, backup), IsNil)
+	c.Assert(backup.RootPath, Equals, node.DefaultRootPath)
+	keys := make(map[string]string)
+	for _, kv := range backup.KVs {
+		keys[kv.Key] = kv.Value
+	}
+	c.Assert(keys, HasKey, "pumps/backup-pump")
+	c.Assert(keys, HasKey, "pumps/backup-pump2")
+
+	// lose the keys
+	c.Assert(cli.Delete(ctx, "pumps/backup-pump", false), IsNil)
+	err = UpdateNodeState("127.0.0.1:2379", node.PumpNode, "backup-pump2", node.Paused, nil)
+	c.Assert(err, IsNil)
+
+	// the existing keys are kept without overwrite
+	err = ImportMetaInfo("127.0.0.1:2379", file, false, nil)
+	c.Assert(err, IsNil)
+	c.Assert(pumpState(c, cli, "backup-pump"), Equals, node.Online)
+	c.Assert(pumpState(c, cli, "backup-pump2"), Equals, node.Paused)
+
+	err = ImportMetaInfo("127.0.0.1:2379", file, true, nil)
+	c.Assert(err, IsNil)
+	c.Assert(pumpState(c, cli, "backup-pump2"), Equals, node.Online)
+
+	// the meta file of other versions can't be imported
+	backup.RootPath = "/tidb-binlog/v0"
+	data, err = json.Marshal(backup)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(file, data, 0600), IsNil)
+	err = ImportMetaInfo("127.0.0.1:2379", file, true, nil)
+	c.Assert(err, ErrorMatches, ".*doesn't match.*")
+}
+
+func pumpState(c *C, cli *etcd.Client, nodeID string) string {
+	data, err := cli.Get(context.Background(), path.Join("pumps", nodeID))
+	c.Assert(err, IsNil)
+	status := new(node.Status)
+	c.Assert(json.Unmarshal(data, status), IsNil)
+	return status.State
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"context"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"go.uber.org/zap"
+)
+
+// MigrateDrainerCheckPoint copies the checkpoint of the paused drainer saved by the config file
+// -drainer-config to the one saved by -to-drainer-config, like from the file in data-dir to consul,
+// then the drainer continues from the checkpoint after it's restarted with the new config file.
+// The plan is only printed unless execute is set.
+func MigrateDrainerCheckPoint(cfg *Config) error {
+	if len(cfg.NodeID) == 0 {
+		return errors.New("need to specify the drainer by -node-id")
+	}
+	if len(cfg.DrainerConfig) == 0 || len(cfg.ToDrainerConfig) == 0 {
+		return errors.New("need to specify the config files of drainer by -drainer-config and -to-drainer-config")
+	}
+
+	registry, err := createRegistryFuc(cfg.EtcdURLs, cfg.TLS)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	n, err := getStoppedDrainer(context.Background(), registry, cfg.NodeID, "migrating the checkpoint")
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	from, err := openDrainerCheckPointFunc(cfg, cfg.DrainerConfig)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer from.Close()
+	to, err := openDrainerCheckPointFunc(cfg, cfg.ToDrainerConfig)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer to.Close()
+
+	log.Info("migrate drainer checkpoint plan",
+		zap.String("drainer", n.NodeID),
+		zap.Int64("ts", from.TS()),
+		zap.Stringer("time", util.TSOToRoughTime(from.TS())),
+		zap.Int64("schema version", from.SchemaVersion()),
+		zap.Bool("consistent", from.IsConsistent()),
+		zap.Int64("safe mode until ts", from.SafeModeUntilTS()),
+		zap.Int64("overwritten ts", to.TS()))
+
+	if !cfg.Execute {
+		log.Info("dry run, add -execute to migrate the checkpoint")
+		return nil
+	}
+
+	if err = checkpoint.Copy(from, to); err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("migrate drainer checkpoint success, restart it with the new config file",
+		zap.String("drainer", n.NodeID), zap.String("config", cfg.ToDrainerConfig))
+	return nil
+}
@@ -18,6 +18,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
@@ -27,8 +28,11 @@ import (
 )
 
 const (
-	defaultEtcdURLs = "http://127.0.0.1:2379"
-	defaultDataDir  = "binlog_position"
+	defaultEtcdURLs   = "http://127.0.0.1:2379"
+	defaultDataDir    = "binlog_position"
+	defaultMetaFile   = "binlog_meta.json"
+	defaultSchemaFile = "schema_snapshot.json"
+	defaultGap        = time.Hour
 )
 
 const (
@@ -50,35 +54,102 @@ const (
 	// PausePump is command used for pause pump.
 	PausePump = "pause-pump"
 
+	// DrainPump is command used for making pump reject writing new binlogs before it's offline.
+	DrainPump = "drain-pump"
+
+	// UndrainPump is command used for making the draining pump accept writing new binlogs again.
+	UndrainPump = "undrain-pump"
+
 	// OfflinePump is command used for offline pump.
 	OfflinePump = "offline-pump"
 
+	// ResumePump is command used for resume the paused pump after it's restarted.
+	ResumePump = "resume-pump"
+
 	// PauseDrainer is comamnd used for pause drainer.
 	PauseDrainer = "pause-drainer"
 
+	// ResumeDrainer is command used for resume the paused drainer after it's restarted.
+	ResumeDrainer = "resume-drainer"
+
 	// OfflineDrainer is comamnd used for offlien drainer.
 	OfflineDrainer = "offline-drainer"
 
 	// Encrypt is command used for encrypt password.
 	Encrypt = "encrypt"
+
+	// ExportMeta is command used for saving the keys of tidb-binlog in etcd to a file.
+	ExportMeta = "export-meta"
+
+	// ImportMeta is command used for restoring the keys of tidb-binlog in etcd from a file.
+	ImportMeta = "import-meta"
+
+	// RewindDrainer is command used for setting the checkpoint of drainer backward.
+	RewindDrainer = "rewind-drainer"
+
+	// ExportSchema is command used for saving the schema of the upstream at a ts to a file.
+	ExportSchema = "export-schema"
+
+	// ConvertBinlog is command used for converting the binlog files between pb and slave-binlog.
+	ConvertBinlog = "convert-binlog"
+
+	// ExportBinlog is command used for exporting the raw binlogs in a range of commit ts from pump to files.
+	ExportBinlog = "export-binlog"
+
+	// UpgradePumps is command used for upgrading the online pumps one after another without stopping writing binlogs.
+	UpgradePumps = "rolling-upgrade-pumps"
+
+	// MigrateCheckpoint is command used for copying the checkpoint of drainer from one type of checkpoint to another.
+	MigrateCheckpoint = "migrate-checkpoint"
+
+	// QueryAssignment is command used for query the tables assigned to the drainers of a group.
+	QueryAssignment = "assignments"
+
+	// AssignTables is command used for assigning tables to a drainer of a group.
+	AssignTables = "assign-tables"
+
+	// UnassignTables is command used for removing the tables from the assignment of a group.
+	UnassignTables = "unassign-tables"
+
+	// AnalyzePB is command used for reporting the tables, DDLs and gaps of the binlog files written by drainer.
+	AnalyzePB = "analyze-pb"
 )
 
 // Config holds the configuration of drainer
 type Config struct {
 	*flag.FlagSet `toml:"-" json:"-"`
 
-	Command          string      `toml:"cmd" json:"cmd"`
-	NodeID           string      `toml:"node-id" json:"node-id"`
-	DataDir          string      `toml:"data-dir" json:"data-dir"`
-	TimeZone         string      `toml:"time-zone" json:"time-zone"`
-	EtcdURLs         string      `toml:"pd-urls" json:"pd-urls"`
-	SSLCA            string      `toml:"ssl-ca" json:"ssl-ca"`
-	SSLCert          string      `toml:"ssl-cert" json:"ssl-cert"`
-	SSLKey           string      `toml:"ssl-key" json:"ssl-key"`
-	State            string      `toml:"state" json:"state"`
-	ShowOfflineNodes bool        `toml:"state" json:"show-offline-nodes"`
-	Text             string      `toml:"text" json:"text"`
-	TLS              *tls.Config `toml:"-" json:"-"`
+	Command          string        `toml:"cmd" json:"cmd"`
+	NodeID           string        `toml:"node-id" json:"node-id"`
+	DataDir          string        `toml:"data-dir" json:"data-dir"`
+	TimeZone         string        `toml:"time-zone" json:"time-zone"`
+	EtcdURLs         string        `toml:"pd-urls" json:"pd-urls"`
+	SSLCA            string        `toml:"ssl-ca" json:"ssl-ca"`
+	SSLCert          string        `toml:"ssl-cert" json:"ssl-cert"`
+	SSLKey           string        `toml:"ssl-key" json:"ssl-key"`
+	State            string        `toml:"state" json:"state"`
+	ShowOfflineNodes bool          `toml:"state" json:"show-offline-nodes"`
+	Text             string        `toml:"text" json:"text"`
+	MetaFile         string        `toml:"meta-file" json:"meta-file"`
+	Overwrite        bool          `toml:"overwrite" json:"overwrite"`
+	FromTS           int64         `toml:"from-ts" json:"from-ts"`
+	ToTS             int64         `toml:"to-ts" json:"to-ts"`
+	DrainerConfig    string        `toml:"drainer-config" json:"drainer-config"`
+	ToDrainerConfig  string        `toml:"to-drainer-config" json:"to-drainer-config"`
+	Execute          bool          `toml:"execute" json:"execute"`
+	CommitTS         int64         `toml:"commit-ts" json:"commit-ts"`
+	SchemaFile       string        `toml:"schema-file" json:"schema-file"`
+	InputDir         string        `toml:"input-dir" json:"input-dir"`
+	OutputDir        string        `toml:"output-dir" json:"output-dir"`
+	ConvertTo        string        `toml:"convert-to" json:"convert-to"`
+	Timeout          time.Duration `toml:"timeout" json:"timeout"`
+	Binary           string        `toml:"binary" json:"binary"`
+	RestartCommand   string        `toml:"restart-command" json:"restart-command"`
+	Concurrency      int           `toml:"concurrency" json:"concurrency"`
+	Group            string        `toml:"group" json:"group"`
+	Tables           string        `toml:"tables" json:"tables"`
+	Gap              time.Duration `toml:"gap" json:"gap"`
+	TLS              *tls.Config   `toml:"-" json:"-"`
 	printVersion     bool
 }
 
@@ -87,17 +158,36 @@ func NewConfig() *Config {
 	cfg := &Config{}
 	cfg.FlagSet = flag.NewFlagSet("binlogctl", flag.ContinueOnError)
 
-	cfg.FlagSet.StringVar(&cfg.Command, "cmd", "pumps", "operator: \"generate_meta\", \"pumps\", \"drainers\", \"update-pump\", \"update-drainer\", \"pause-pump\", \"pause-drainer\", \"offline-pump\", \"offline-drainer\", \"encrypt\"")
-	cfg.FlagSet.StringVar(&cfg.NodeID, "node-id", "", "id of node, use to update some node with operation update-pump, update-drainer, pause-pump, pause-drainer, offline-pump and offline-drainer")
+	cfg.FlagSet.StringVar(&cfg.Command, "cmd", "pumps", "operator: \"generate_meta\", \"pumps\", \"drainers\", \"update-pump\", \"update-drainer\", \"pause-pump\", \"pause-drainer\", \"resume-pump\", \"resume-drainer\", \"drain-pump\", \"undrain-pump\", \"offline-pump\", \"offline-drainer\", \"encrypt\", \"export-meta\", \"import-meta\", \"rewind-drainer\", \"export-schema\", \"convert-binlog\", \"export-binlog\", \"rolling-upgrade-pumps\", \"migrate-checkpoint\", \"assignments\", \"assign-tables\", \"unassign-tables\", \"analyze-pb\"")
+	cfg.FlagSet.StringVar(&cfg.NodeID, "node-id", "", "id of node, use to update some node with operation update-pump, update-drainer, pause-pump, pause-drainer, resume-pump, resume-drainer, drain-pump, undrain-pump, offline-pump, offline-drainer, rewind-drainer, export-binlog, migrate-checkpoint and assign-tables")
 	cfg.FlagSet.StringVar(&cfg.DataDir, "data-dir", defaultDataDir, "meta directory path")
 	cfg.FlagSet.StringVar(&cfg.EtcdURLs, "pd-urls", defaultEtcdURLs, "a comma separated list of PD endpoints")
 	cfg.FlagSet.StringVar(&cfg.SSLCA, "ssl-ca", "", "Path of file that contains list of trusted SSL CAs for connection with cluster components.")
 	cfg.FlagSet.StringVar(&cfg.SSLCert, "ssl-cert", "", "Path of file that contains X509 certificate in PEM format for connection with cluster components.")
 	cfg.FlagSet.StringVar(&cfg.SSLKey, "ssl-key", "", "Path of file that contains X509 key in PEM format for connection with cluster components.")
 	cfg.FlagSet.StringVar(&cfg.TimeZone, "time-zone", "", "set time zone if you want save time info in savepoint file, for example `Asia/Shanghai` for CST time, `Local` for local time")
-	cfg.FlagSet.StringVar(&cfg.State, "state", "", "set node's state, can set to online, pausing, paused, closing or offline.")
+	cfg.FlagSet.StringVar(&cfg.State, "state", "", "set node's state, can set to online, pausing, paused, draining, closing or offline.")
 	cfg.FlagSet.BoolVar(&cfg.ShowOfflineNodes, "show-offline-nodes", false, "include offline nodes when querying pumps/drainers")
 	cfg.FlagSet.StringVar(&cfg.Text, "text", "", "text to be encrypt when using encrypt command")
+	cfg.FlagSet.StringVar(&cfg.MetaFile, "meta-file", defaultMetaFile, "file to save the keys of tidb-binlog in etcd to with export-meta, or restore them from with import-meta")
+	cfg.FlagSet.BoolVar(&cfg.Overwrite, "overwrite", false, "overwrite the keys that already exist in etcd with import-meta")
+	cfg.FlagSet.Int64Var(&cfg.FromTS, "from-ts", 0, "the binlogs committed after the ts are exported with export-binlog")
+	cfg.FlagSet.Int64Var(&cfg.ToTS, "to-ts", 0, "the commit ts to set the checkpoint of drainer back to with rewind-drainer, or the binlogs committed not after it are exported with export-binlog")
+	cfg.FlagSet.StringVar(&cfg.DrainerConfig, "drainer-config", "", "path of the config file of drainer to find its checkpoint with rewind-drainer, export-schema and migrate-checkpoint")
+	cfg.FlagSet.StringVar(&cfg.ToDrainerConfig, "to-drainer-config", "", "path of the config file of drainer with the new checkpoint type to copy the checkpoint to with migrate-checkpoint")
+	cfg.FlagSet.BoolVar(&cfg.Execute, "execute", false, "rewind the checkpoint with rewind-drainer, copy it with migrate-checkpoint, or save the assignment with assign-tables and unassign-tables, only the plan is printed if not set")
+	cfg.FlagSet.Int64Var(&cfg.CommitTS, "commit-ts", 0, "the commit ts to export the schema at with export-schema, the checkpoint of the drainer specified by -drainer-config is used if not set")
+	cfg.FlagSet.StringVar(&cfg.SchemaFile, "schema-file", defaultSchemaFile, "file to save the schema snapshot to with export-schema")
+	cfg.FlagSet.StringVar(&cfg.InputDir, "input-dir", "", "directory of the binlog files to convert with convert-binlog, or the pb files written by drainer to analyze with analyze-pb")
+	cfg.FlagSet.StringVar(&cfg.OutputDir, "output-dir", "", "empty directory to write the converted binlog files and index.json to with convert-binlog, or the exported ones with export-binlog")
+	cfg.FlagSet.StringVar(&cfg.ConvertTo, "convert-to", FormatSlaveBinlog, "format to convert the binlog files to with convert-binlog, \"slave-binlog\" converts the pb files written by drainer to the binlogs of kafka, and \"pb\" converts them back")
+	cfg.FlagSet.DurationVar(&cfg.Timeout, "timeout", time.Minute, "time to wait for the node to confirm its state is changed with pause-pump, pause-drainer, resume-pump, resume-drainer, drain-pump and undrain-pump, or for each step of upgrading a pump with rolling-upgrade-pumps")
+	cfg.FlagSet.StringVar(&cfg.Binary, "binary", "", "path of the new pump binary, it replaces {binary} in -restart-command with rolling-upgrade-pumps")
+	cfg.FlagSet.StringVar(&cfg.RestartCommand, "restart-command", "", "shell command restarting a pump with the new binary with rolling-upgrade-pumps, {node-id}, {host} and {binary} in it are replaced by the node id, the host of the pump and -binary")
+	cfg.FlagSet.IntVar(&cfg.Concurrency, "concurrency", 1, "number of pumps upgraded at the same time with rolling-upgrade-pumps")
+	cfg.FlagSet.StringVar(&cfg.Group, "group", "", "the group of drainers set by assignment-group of drainer with assignments, assign-tables and unassign-tables")
+	cfg.FlagSet.StringVar(&cfg.Tables, "tables", "", "a comma separated list of the schemas and tables like \"db1,db2.t1\" with assign-tables and unassign-tables, a schema means all its tables not assigned separately")
+	cfg.FlagSet.DurationVar(&cfg.Gap, "gap", defaultGap, "the binlogs whose commit time is more than the gap after the previous one are reported with analyze-pb")
 	cfg.FlagSet.BoolVar(&cfg.printVersion, "V", false, "prints version and exit")
 
 	return cfg
@@ -127,6 +217,8 @@ func (cfg *Config) Parse(args []string) error {
 
 	// adjust configuration
 	util.AdjustString(&cfg.DataDir, defaultDataDir)
+	util.AdjustString(&cfg.MetaFile, defaultMetaFile)
+	util.AdjustString(&cfg.SchemaFile, defaultSchemaFile)
 
 	// transfore tls config
 	sCfg := &security.Config{
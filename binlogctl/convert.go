@@ -0,0 +1,358 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb-binlog/reparo/syncer"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+	tb "github.com/pingcap/tipb/go-binlog"
+	"go.uber.org/zap"
+)
+
+const (
+	// FormatPB is the format of the binlog files written by drainer with db-type file.
+	FormatPB = "pb"
+	// FormatSlaveBinlog is the format of the binlogs written by drainer with db-type kafka.
+	FormatSlaveBinlog = "slave-binlog"
+
+	convertIndexFile = "index.json"
+)
+
+// ConvertIndex is the index of the binlog files converted by convert-binlog,
+// saved as index.json in the output directory.
+type ConvertIndex struct {
+	Format string              `json:"format"`
+	Files  []*ConvertIndexFile `json:"files"`
+}
+
+// ConvertIndexFile is the range of the commit ts of the binlogs in a file.
+type ConvertIndexFile struct {
+	Name          string `json:"name"`
+	FirstCommitTS int64  `json:"first-commit-ts"`
+	LastCommitTS  int64  `json:"last-commit-ts"`
+	Count         int    `json:"count"`
+}
+
+// ConvertBinlogFiles converts the binlog files in the input dir to the format of
+// convert-to and writes them to the output dir with an index. The binlogs are
+// written in the order of the commit ts, the ones not after the previous one
+// are skipped, like the binlogs written again after drainer restarts.
+func ConvertBinlogFiles(inputDir, outputDir, convertTo string) error {
+	var convert func(payload []byte) (commitTS int64, data []byte, err error)
+	switch convertTo {
+	case FormatSlaveBinlog:
+		convert = convertPBToSlaveBinlog
+	case FormatPB:
+		convert = convertSlaveBinlogToPB
+	default:
+		return errors.NotSupportedf("convert to %s", convertTo)
+	}
+
+	names, err := binlogfile.ReadBinlogNames(inputDir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = binlogfile.CreateDirAll(outputDir); err != nil {
+		return errors.Trace(err)
+	}
+	binlogger, err := binlogfile.OpenBinlogger(outputDir, binlogfile.SegmentSizeBytes)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer binlogger.Close()
+
+	var (
+		lastTS  int64
+		skipped int
+		files   = make(map[uint64]*ConvertIndexFile)
+	)
+	for _, name := range names {
+		err = readBinlogFile(path.Join(inputDir, name), func(payload []byte) error {
+			commitTS, data, err := convert(payload)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if commitTS <= lastTS {
+				skipped++
+				return nil
+			}
+			lastTS = commitTS
+
+			pos, err := binlogger.WriteTail(&tb.Entity{Payload: data})
+			if err != nil {
+				return errors.Trace(err)
+			}
+			file, ok := files[pos.Suffix]
+			if !ok {
+				file = &ConvertIndexFile{FirstCommitTS: commitTS}
+				files[pos.Suffix] = file
+			}
+			file.LastCommitTS = commitTS
+			file.Count++
+			return nil
+		})
+		if err != nil {
+			return errors.Annotatef(err, "convert %s failed", name)
+		}
+	}
+
+	if err = writeConvertIndex(outputDir, convertTo, files); err != nil {
+		return errors.Trace(err)
+	}
+
+	log.Info("convert binlog success", zap.String("output dir", outputDir), zap.String("format", convertTo),
+		zap.Int("files", len(files)), zap.Int("skipped binlogs", skipped), zap.Int64("last commit ts", lastTS))
+	return nil
+}
+
+// writeConvertIndex writes the index of the binlog files in the output dir, files are
+// the ranges of the binlogs written by the suffixes of the files.
+func writeConvertIndex(outputDir string, format string, files map[uint64]*ConvertIndexFile) error {
+	index := &ConvertIndex{Format: format}
+	outputNames, err := binlogfile.ReadBinlogNames(outputDir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, name := range outputNames {
+		i, _, err := binlogfile.ParseBinlogName(name)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if file, ok := files[i]; ok {
+			file.Name = name
+			index.Files = append(index.Files, file)
+		}
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(ioutil.WriteFile(path.Join(outputDir, convertIndexFile), data, 0600))
+}
+
+// readBinlogFile calls fn with the payload of every binlog in the file, the
+// file isn't opened by the binlogger to keep it from being repaired.
+func readBinlogFile(name string, fn func(payload []byte) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		payload, _, err := binlogfile.Decode(reader)
+		if err != nil {
+			if errors.Cause(err) == io.EOF {
+				return nil
+			}
+			return errors.Trace(err)
+		}
+		if err = fn(payload); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
+func convertPBToSlaveBinlog(payload []byte) (int64, []byte, error) {
+	binlog := new(pb.Binlog)
+	if err := binlog.Unmarshal(payload); err != nil {
+		return 0, nil, errors.Trace(err)
+	}
+	slave, err := pbToSlaveBinlog(binlog)
+	if err != nil {
+		return 0, nil, errors.Annotatef(err, "commit ts %d", binlog.CommitTs)
+	}
+	data, err := slave.Marshal()
+	return binlog.CommitTs, data, errors.Trace(err)
+}
+
+func convertSlaveBinlogToPB(payload []byte) (int64, []byte, error) {
+	slave := new(obinlog.Binlog)
+	if err := slave.Unmarshal(payload); err != nil {
+		return 0, nil, errors.Trace(err)
+	}
+	binlog, err := syncer.SlaveBinlogToPB(slave)
+	if err != nil {
+		return 0, nil, errors.Annotatef(err, "commit ts %d", slave.CommitTs)
+	}
+	data, err := binlog.Marshal()
+	return slave.CommitTs, data, errors.Trace(err)
+}
+
+// pbToSlaveBinlog converts the binlog in the pb files to the one in kafka.
+// The consecutive rows of a table with the same columns are put in a table,
+// the primary and unique keys are unknown in the pb files and left empty.
+func pbToSlaveBinlog(binlog *pb.Binlog) (*obinlog.Binlog, error) {
+	switch binlog.Tp {
+	case pb.BinlogType_DDL:
+		txn, err := syncer.PBBinlogToTxn(binlog)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return &obinlog.Binlog{
+			Type:     obinlog.BinlogType_DDL,
+			CommitTs: binlog.CommitTs,
+			DdlData: &obinlog.DDLData{
+				SchemaName: proto.String(txn.DDL.Database),
+				TableName:  proto.String(txn.DDL.Table),
+				DdlQuery:   []byte(strings.TrimRight(strings.TrimSpace(txn.DDL.SQL), ";")),
+			},
+		}, nil
+	case pb.BinlogType_DML:
+	default:
+		return nil, errors.Errorf("unknown type: %v", binlog.Tp)
+	}
+
+	slave := &obinlog.Binlog{
+		Type:     obinlog.BinlogType_DML,
+		CommitTs: binlog.CommitTs,
+		DmlData:  new(obinlog.DMLData),
+	}
+	var table *obinlog.Table
+	for _, event := range binlog.DmlData.GetEvents() {
+		infos, oldRow, newRow, err := pbEventToRows(&event)
+		if err != nil {
+			return nil, errors.Annotatef(err, "table %s.%s", event.GetSchemaName(), event.GetTableName())
+		}
+		if table == nil || table.GetSchemaName() != event.GetSchemaName() || table.GetTableName() != event.GetTableName() ||
+			!sameColumns(table.ColumnInfo, infos) {
+			table = &obinlog.Table{
+				SchemaName: proto.String(event.GetSchemaName()),
+				TableName:  proto.String(event.GetTableName()),
+				ColumnInfo: infos,
+			}
+			slave.DmlData.Tables = append(slave.DmlData.Tables, table)
+		}
+
+		mutation := new(obinlog.TableMutation)
+		switch event.GetTp() {
+		case pb.EventType_Insert:
+			mutation.Type = obinlog.MutationType_Insert.Enum()
+			mutation.Row = newRow
+		case pb.EventType_Update:
+			// Row is the new row and ChangeRow is the old one in the binlog of kafka.
+			mutation.Type = obinlog.MutationType_Update.Enum()
+			mutation.Row, mutation.ChangeRow = newRow, oldRow
+		case pb.EventType_Delete:
+			mutation.Type = obinlog.MutationType_Delete.Enum()
+			mutation.Row = newRow
+		default:
+			return nil, errors.Errorf("unknown type: %v", event.GetTp())
+		}
+		table.Mutations = append(table.Mutations, mutation)
+	}
+	return slave, nil
+}
+
+// pbEventToRows decodes the columns of the event, the old row is only
+// returned for update, the row of insert and delete is returned as the new row.
+func pbEventToRows(event *pb.Event) (infos []*obinlog.ColumnInfo, oldRow, newRow *obinlog.Row, err error) {
+	newRow = new(obinlog.Row)
+	if event.GetTp() == pb.EventType_Update {
+		oldRow = new(obinlog.Row)
+	}
+	for _, c := range event.GetRow() {
+		col := new(pb.Column)
+		if err = col.Unmarshal(c); err != nil {
+			return nil, nil, nil, errors.Trace(err)
+		}
+		infos = append(infos, &obinlog.ColumnInfo{Name: col.Name, MysqlType: col.MysqlType})
+
+		value := col.Value
+		if oldRow != nil {
+			column, err := pbValueToColumn(col.MysqlType, col.Value)
+			if err != nil {
+				return nil, nil, nil, errors.Annotatef(err, "column %s", col.Name)
+			}
+			oldRow.Columns = append(oldRow.Columns, column)
+			value = col.ChangedValue
+		}
+		column, err := pbValueToColumn(col.MysqlType, value)
+		if err != nil {
+			return nil, nil, nil, errors.Annotatef(err, "column %s", col.Name)
+		}
+		newRow.Columns = append(newRow.Columns, column)
+	}
+	return
+}
+
+func sameColumns(a, b []*obinlog.ColumnInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].MysqlType != b[i].MysqlType {
+			return false
+		}
+	}
+	return true
+}
+
+// pbValueToColumn converts the value encoded in the pb files to the column of
+// kafka like translator.DatumToColumn, the values of time, decimal and json are
+// already formatted to strings in the pb files.
+func pbValueToColumn(mysqlType string, value []byte) (*obinlog.Column, error) {
+	_, d, err := codec.DecodeOne(value)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	col := new(obinlog.Column)
+	if d.IsNull() {
+		col.IsNull = proto.Bool(true)
+		return col, nil
+	}
+
+	switch mysqlType {
+	case "int", "bigint", "smallint", "tinyint", "mediumint":
+		if d.Kind() == types.KindUint64 {
+			col.Uint64Value = proto.Uint64(d.GetUint64())
+		} else {
+			col.Int64Value = proto.Int64(d.GetInt64())
+		}
+	case "float", "double":
+		col.DoubleValue = proto.Float64(d.GetFloat64())
+	case "bit":
+		col.BytesValue = types.NewBinaryLiteralFromUint(d.GetUint64(), -1)
+	case "blob", "longblob", "mediumblob", "binary", "tinyblob", "varbinary":
+		col.BytesValue = d.GetBytes()
+	case "enum", "set":
+		col.Uint64Value = proto.Uint64(d.GetUint64())
+	case "json":
+		col.BytesValue = d.GetBytes()
+	default:
+		str, err := d.ToString()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		col.StringValue = proto.String(str)
+	}
+	return col, nil
+}
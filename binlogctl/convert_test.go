@@ -0,0 +1,187 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+
+	"github.com/golang/protobuf/proto"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+	tb "github.com/pingcap/tipb/go-binlog"
+)
+
+var _ = Suite(&testConvertSuite{})
+
+type testConvertSuite struct{}
+
+func encodePBColumn(c *C, name string, tp byte, mysqlType string, value, changed interface{}, update bool) []byte {
+	col := &pb.Column{Name: name, Tp: []byte{tp}, MysqlType: mysqlType}
+	var err error
+	col.Value, err = codec.EncodeValue(nil, nil, types.NewDatum(value))
+	c.Assert(err, IsNil)
+	if update {
+		col.ChangedValue, err = codec.EncodeValue(nil, nil, types.NewDatum(changed))
+		c.Assert(err, IsNil)
+	}
+	data, err := col.Marshal()
+	c.Assert(err, IsNil)
+	return data
+}
+
+func pbEvent(c *C, tp pb.EventType, id int64, changedID int64) pb.Event {
+	update := tp == pb.EventType_Update
+	return pb.Event{
+		SchemaName: proto.String("test"),
+		TableName:  proto.String("t"),
+		Tp:         tp,
+		Row: [][]byte{
+			encodePBColumn(c, "id", mysql.TypeLonglong, "bigint", id, changedID, update),
+			encodePBColumn(c, "name", mysql.TypeVarchar, "varchar", []byte("a"), []byte("a"), update),
+			encodePBColumn(c, "price", mysql.TypeNewDecimal, "decimal", "1.50", "2.50", update),
+			encodePBColumn(c, "flag", mysql.TypeBit, "bit", uint64(5), uint64(5), update),
+			encodePBColumn(c, "note", mysql.TypeBlob, "text", nil, nil, update),
+		},
+	}
+}
+
+func writeBinlogs(c *C, dir string, payloads ...[]byte) {
+	binlogger, err := binlogfile.OpenBinlogger(dir, binlogfile.SegmentSizeBytes)
+	c.Assert(err, IsNil)
+	defer binlogger.Close()
+	for _, payload := range payloads {
+		_, err = binlogger.WriteTail(&tb.Entity{Payload: payload})
+		c.Assert(err, IsNil)
+	}
+}
+
+func readBinlogs(c *C, dir string) (payloads [][]byte) {
+	names, err := binlogfile.ReadBinlogNames(dir)
+	c.Assert(err, IsNil)
+	for _, name := range names {
+		err = readBinlogFile(path.Join(dir, name), func(payload []byte) error {
+			payloads = append(payloads, payload)
+			return nil
+		})
+		c.Assert(err, IsNil)
+	}
+	return
+}
+
+func (s *testConvertSuite) TestPBToSlaveBinlog(c *C) {
+	slave, err := pbToSlaveBinlog(&pb.Binlog{
+		Tp:       pb.BinlogType_DDL,
+		CommitTs: 10,
+		DdlQuery: []byte("use `test`; create table t(id int primary key);"),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(slave.Type, Equals, obinlog.BinlogType_DDL)
+	c.Assert(slave.DdlData.GetSchemaName(), Equals, "test")
+	c.Assert(slave.DdlData.GetTableName(), Equals, "t")
+	c.Assert(string(slave.DdlData.DdlQuery), Equals, "create table t(id int primary key)")
+
+	slave, err = pbToSlaveBinlog(&pb.Binlog{
+		Tp:       pb.BinlogType_DML,
+		CommitTs: 11,
+		DmlData: &pb.DMLData{Events: []pb.Event{
+			pbEvent(c, pb.EventType_Insert, 1, 0),
+			pbEvent(c, pb.EventType_Update, 1, 2),
+		}},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(slave.DmlData.Tables, HasLen, 1)
+	table := slave.DmlData.Tables[0]
+	c.Assert(table.ColumnInfo, HasLen, 5)
+	c.Assert(table.ColumnInfo[2], DeepEquals, &obinlog.ColumnInfo{Name: "price", MysqlType: "decimal"})
+	c.Assert(table.Mutations, HasLen, 2)
+
+	insert := table.Mutations[0]
+	c.Assert(insert.GetType(), Equals, obinlog.MutationType_Insert)
+	c.Assert(insert.Row.Columns, DeepEquals, []*obinlog.Column{
+		{Int64Value: proto.Int64(1)},
+		{StringValue: proto.String("a")},
+		{StringValue: proto.String("1.50")},
+		{BytesValue: []byte{5}},
+		{IsNull: proto.Bool(true)},
+	})
+
+	// Row is the new row and ChangeRow is the old one.
+	update := table.Mutations[1]
+	c.Assert(update.GetType(), Equals, obinlog.MutationType_Update)
+	c.Assert(update.Row.Columns[0].GetInt64Value(), Equals, int64(2))
+	c.Assert(update.Row.Columns[2].GetStringValue(), Equals, "2.50")
+	c.Assert(update.ChangeRow.Columns[0].GetInt64Value(), Equals, int64(1))
+}
+
+func (s *testConvertSuite) TestConvertBinlogFiles(c *C) {
+	ddl := &pb.Binlog{Tp: pb.BinlogType_DDL, CommitTs: 10, DdlQuery: []byte("use `test`; create table t(id int primary key);")}
+	dml := &pb.Binlog{
+		Tp:       pb.BinlogType_DML,
+		CommitTs: 11,
+		DmlData: &pb.DMLData{Events: []pb.Event{
+			pbEvent(c, pb.EventType_Insert, 1, 0),
+			pbEvent(c, pb.EventType_Update, 1, 2),
+			pbEvent(c, pb.EventType_Delete, 2, 0),
+		}},
+	}
+	var payloads [][]byte
+	// the ddl is written again after drainer restarts.
+	for _, binlog := range []*pb.Binlog{ddl, ddl, dml} {
+		payload, err := binlog.Marshal()
+		c.Assert(err, IsNil)
+		payloads = append(payloads, payload)
+	}
+	pbDir := c.MkDir()
+	writeBinlogs(c, pbDir, payloads...)
+
+	slaveDir := path.Join(c.MkDir(), "slave")
+	c.Assert(ConvertBinlogFiles(pbDir, slaveDir, FormatSlaveBinlog), IsNil)
+	c.Assert(ConvertBinlogFiles(pbDir, slaveDir, FormatSlaveBinlog), ErrorMatches, ".*to be empty.*")
+	slaves := readBinlogs(c, slaveDir)
+	c.Assert(slaves, HasLen, 2)
+	slave := new(obinlog.Binlog)
+	c.Assert(slave.Unmarshal(slaves[1]), IsNil)
+	c.Assert(slave.CommitTs, Equals, int64(11))
+	c.Assert(slave.DmlData.Tables[0].Mutations, HasLen, 3)
+
+	data, err := ioutil.ReadFile(path.Join(slaveDir, convertIndexFile))
+	c.Assert(err, IsNil)
+	index := new(ConvertIndex)
+	c.Assert(json.Unmarshal(data, index), IsNil)
+	c.Assert(index.Format, Equals, FormatSlaveBinlog)
+	c.Assert(index.Files, HasLen, 1)
+	names, err := binlogfile.ReadBinlogNames(slaveDir)
+	c.Assert(err, IsNil)
+	c.Assert(index.Files[0], DeepEquals, &ConvertIndexFile{Name: names[0], FirstCommitTS: 10, LastCommitTS: 11, Count: 2})
+
+	// converted back to the same binlogs.
+	pbDir2 := path.Join(c.MkDir(), "pb")
+	c.Assert(ConvertBinlogFiles(slaveDir, pbDir2, FormatPB), IsNil)
+	binlogs := readBinlogs(c, pbDir2)
+	c.Assert(binlogs, HasLen, 2)
+	for i, expected := range []*pb.Binlog{ddl, dml} {
+		binlog := new(pb.Binlog)
+		c.Assert(binlog.Unmarshal(binlogs[i]), IsNil)
+		c.Assert(binlog, DeepEquals, expected)
+	}
+
+	c.Assert(ConvertBinlogFiles(pbDir, c.MkDir(), "json"), ErrorMatches, ".*not supported.*")
+}
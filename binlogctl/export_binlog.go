@@ -0,0 +1,177 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"context"
+	"crypto/tls"
+	"math"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	"github.com/pingcap/tidb-binlog/pkg/flags"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	tb "github.com/pingcap/tipb/go-binlog"
+	pd "github.com/tikv/pd/client"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// FormatPump is the format of the raw binlogs exported from pump by export-binlog.
+const FormatPump = "pump"
+
+var pullPumpBinlogsFunc = pullPumpBinlogs
+
+// binlogReceiver receives the binlogs pulled from pump.
+type binlogReceiver interface {
+	Recv() (*tb.PullBinlogResp, error)
+}
+
+// ExportPumpBinlogs exports the raw binlogs committed in (from-ts, to-ts] from the pump
+// to the binlog files in the output dir with an index, like the way drainer pulls them,
+// so the binlogs can be analyzed or replayed offline without a drainer. The fake binlogs
+// written by pump to advance the commit ts are skipped.
+func ExportPumpBinlogs(cfg *Config) error {
+	if len(cfg.NodeID) == 0 {
+		return errors.New("need to specify the pump by -node-id")
+	}
+	if len(cfg.OutputDir) == 0 {
+		return errors.New("need to specify the directory to export the binlogs to by -output-dir")
+	}
+	if cfg.ToTS <= cfg.FromTS {
+		return errors.Errorf("-to-ts %d should be greater than -from-ts %d", cfg.ToTS, cfg.FromTS)
+	}
+
+	registry, err := createRegistryFuc(cfg.EtcdURLs, cfg.TLS)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n, err := registry.Node(ctx, node.NodePrefix[node.PumpNode], cfg.NodeID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if n.State == node.Offline {
+		return errors.Errorf("pump %s is offline", n.NodeID)
+	}
+
+	ectdEndpoints, err := flags.ParseHostPortAddr(cfg.EtcdURLs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	pdCli, err := newPDClientFunc(ectdEndpoints, pd.SecurityOption{
+		CAPath:   cfg.SSLCA,
+		CertPath: cfg.SSLCert,
+		KeyPath:  cfg.SSLKey,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer pdCli.Close()
+	// the binlogs after to-ts are pulled to know all binlogs before it are exported.
+	latestTS, err := util.GetTSO(pdCli)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.ToTS > latestTS {
+		return errors.Errorf("-to-ts %d is in the future, the latest ts is %d", cfg.ToTS, latestTS)
+	}
+
+	source, err := pullPumpBinlogsFunc(ctx, n.Addr, cfg.TLS, pdCli.GetClusterID(ctx), cfg.FromTS)
+	if err != nil {
+		return errors.Annotatef(err, "pull binlogs from pump %s", n.NodeID)
+	}
+
+	if err = binlogfile.CreateDirAll(cfg.OutputDir); err != nil {
+		return errors.Trace(err)
+	}
+	binlogger, err := binlogfile.OpenBinlogger(cfg.OutputDir, binlogfile.SegmentSizeBytes)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer binlogger.Close()
+
+	files, count, err := exportBinlogs(source, cfg.ToTS, binlogger)
+	if err != nil {
+		return errors.Annotatef(err, "export binlogs of pump %s", n.NodeID)
+	}
+	if err = writeConvertIndex(cfg.OutputDir, FormatPump, files); err != nil {
+		return errors.Trace(err)
+	}
+
+	log.Info("export binlog success", zap.String("pump", n.NodeID), zap.String("output dir", cfg.OutputDir),
+		zap.Int64("from ts", cfg.FromTS), zap.Int64("to ts", cfg.ToTS), zap.Int("binlogs", count))
+	return nil
+}
+
+// exportBinlogs writes the binlogs received until the commit ts is greater than toTS.
+func exportBinlogs(source binlogReceiver, toTS int64, binlogger binlogfile.Binlogger) (map[uint64]*ConvertIndexFile, int, error) {
+	files := make(map[uint64]*ConvertIndexFile)
+	count := 0
+	for {
+		resp, err := source.Recv()
+		if err != nil {
+			return nil, 0, errors.Trace(err)
+		}
+
+		binlog := new(tb.Binlog)
+		if err = binlog.Unmarshal(resp.Entity.Payload); err != nil {
+			return nil, 0, errors.Trace(err)
+		}
+		if binlog.CommitTs > toTS {
+			return files, count, nil
+		}
+		if binlog.Tp == tb.BinlogType_Rollback && binlog.StartTs == binlog.CommitTs {
+			continue
+		}
+
+		pos, err := binlogger.WriteTail(&tb.Entity{Payload: resp.Entity.Payload})
+		if err != nil {
+			return nil, 0, errors.Trace(err)
+		}
+		file, ok := files[pos.Suffix]
+		if !ok {
+			file = &ConvertIndexFile{FirstCommitTS: binlog.CommitTs}
+			files[pos.Suffix] = file
+		}
+		file.LastCommitTS = binlog.CommitTs
+		file.Count++
+		count++
+	}
+}
+
+// pullPumpBinlogs pulls the binlogs committed after the ts from the pump.
+func pullPumpBinlogs(ctx context.Context, addr string, tlsConfig *tls.Config, clusterID uint64, ts int64) (binlogReceiver, error) {
+	dialOpts := []grpc.DialOption{grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(math.MaxInt32))}
+	if tlsConfig != nil {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithInsecure())
+	}
+	conn, err := grpc.DialContext(ctx, addr, dialOpts...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	cli, err := tb.NewPumpClient(conn).PullBinlogs(ctx, &tb.PullBinlogReq{ClusterID: clusterID, StartFrom: tb.Pos{Offset: ts}})
+	return cli, errors.Trace(err)
+}
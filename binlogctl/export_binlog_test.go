@@ -0,0 +1,86 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	tb "github.com/pingcap/tipb/go-binlog"
+)
+
+var _ = Suite(&testExportBinlogSuite{})
+
+type testExportBinlogSuite struct{}
+
+// fakeReceiver returns the binlogs and then an error.
+type fakeReceiver struct {
+	binlogs []*tb.Binlog
+}
+
+func (r *fakeReceiver) Recv() (*tb.PullBinlogResp, error) {
+	if len(r.binlogs) == 0 {
+		return nil, errors.New("pump closed")
+	}
+	binlog := r.binlogs[0]
+	r.binlogs = r.binlogs[1:]
+	payload, err := binlog.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &tb.PullBinlogResp{Entity: tb.Entity{Payload: payload}}, nil
+}
+
+func (s *testExportBinlogSuite) TestExportBinlogs(c *C) {
+	dir := c.MkDir()
+	binlogger, err := binlogfile.OpenBinlogger(dir, binlogfile.SegmentSizeBytes)
+	c.Assert(err, IsNil)
+
+	source := &fakeReceiver{binlogs: []*tb.Binlog{
+		{Tp: tb.BinlogType_Prewrite, StartTs: 10, CommitTs: 11, PrewriteValue: []byte("a")},
+		// fake binlog
+		{Tp: tb.BinlogType_Rollback, StartTs: 12, CommitTs: 12},
+		{Tp: tb.BinlogType_Prewrite, StartTs: 13, CommitTs: 15, PrewriteKey: []byte("k")},
+		{Tp: tb.BinlogType_Prewrite, StartTs: 16, CommitTs: 21},
+	}}
+	files, count, err := exportBinlogs(source, 20, binlogger)
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 2)
+	c.Assert(writeConvertIndex(dir, FormatPump, files), IsNil)
+	c.Assert(binlogger.Close(), IsNil)
+
+	payloads := readBinlogs(c, dir)
+	c.Assert(payloads, HasLen, 2)
+	binlog := new(tb.Binlog)
+	c.Assert(binlog.Unmarshal(payloads[1]), IsNil)
+	c.Assert(binlog.CommitTs, Equals, int64(15))
+	c.Assert(string(binlog.PrewriteKey), Equals, "k")
+
+	data, err := ioutil.ReadFile(path.Join(dir, convertIndexFile))
+	c.Assert(err, IsNil)
+	index := new(ConvertIndex)
+	c.Assert(json.Unmarshal(data, index), IsNil)
+	c.Assert(index.Format, Equals, FormatPump)
+	c.Assert(index.Files, HasLen, 1)
+	c.Assert(index.Files[0].FirstCommitTS, Equals, int64(11))
+	c.Assert(index.Files[0].LastCommitTS, Equals, int64(15))
+
+	// the pump closed before to-ts.
+	_, _, err = exportBinlogs(&fakeReceiver{}, 40, binlogger)
+	c.Assert(err, ErrorMatches, "pump closed")
+}
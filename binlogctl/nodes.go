@@ -59,7 +59,7 @@ func QueryNodesByKind(urls string, kind string, showOffline bool, tlsConfig *tls
 // UpdateNodeState update pump or drainer's state.
 func UpdateNodeState(urls, kind, nodeID, state string, tlsConfig *tls.Config) error {
 	/*
-		node's state can be online, pausing, paused, closing and offline.
+		node's state can be online, pausing, paused, draining, closing and offline.
 		if the state is one of them, will update the node's state saved in etcd directly.
 	*/
 	registry, err := createRegistryFuc(urls, tlsConfig)
@@ -73,7 +73,7 @@ func UpdateNodeState(urls, kind, nodeID, state string, tlsConfig *tls.Config) er
 	}
 
 	switch state {
-	case node.Online, node.Pausing, node.Paused, node.Closing, node.Offline:
+	case node.Online, node.Pausing, node.Paused, node.Draining, node.Closing, node.Offline:
 		n.State = state
 		return registry.UpdateNode(context.Background(), node.NodePrefix[kind], n)
 	default:
@@ -83,16 +83,22 @@ func UpdateNodeState(urls, kind, nodeID, state string, tlsConfig *tls.Config) er
 
 // createRegistry returns an ectd registry
 func createRegistry(urls string, tlsConfig *tls.Config) (*node.EtcdRegistry, error) {
-	ectdEndpoints, err := flags.ParseHostPortAddr(urls)
+	cli, err := createEtcdClient(urls, tlsConfig)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	cli, err := newEtcdClientFromCfgFunc(ectdEndpoints, etcdDialTimeout, node.DefaultRootPath, tlsConfig)
+
+	return node.NewEtcdRegistry(cli, etcdDialTimeout), nil
+}
+
+// createEtcdClient returns an etcd client with the root path of tidb-binlog
+func createEtcdClient(urls string, tlsConfig *tls.Config) (*etcd.Client, error) {
+	ectdEndpoints, err := flags.ParseHostPortAddr(urls)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-
-	return node.NewEtcdRegistry(cli, etcdDialTimeout), nil
+	cli, err := newEtcdClientFromCfgFunc(ectdEndpoints, etcdDialTimeout, node.DefaultRootPath, tlsConfig)
+	return cli, errors.Trace(err)
 }
 
 // ApplyAction applies action on pump or drainer
@@ -112,7 +118,7 @@ func ApplyAction(urls, kind, nodeID string, action string, tlsConfig *tls.Config
 		schema = "https"
 	}
 
-	url := fmt.Sprintf("%s://%s/state/%s/%s", schema, n.Addr, n.NodeID, action)
+	url := fmt.Sprintf("%s://%s/state/%s/%s", schema, n.HTTPAddr(), n.NodeID, action)
 	log.Debug("send put http request", zap.String("url", url))
 	req, err := http.NewRequest("PUT", url, nil)
 	if err != nil {
@@ -0,0 +1,200 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer"
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	"github.com/pingcap/tidb-binlog/pkg/flags"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	pd "github.com/tikv/pd/client"
+	"go.uber.org/zap"
+)
+
+var (
+	openDrainerCheckPointFunc = openDrainerCheckPoint
+	loadSchemaVersionAtFunc   = drainer.LoadSchemaVersionAt
+)
+
+// pumpStatus is the status returned by the status API of pump.
+type pumpStatus struct {
+	GCTS   int64  `json:"GCTS"`
+	ErrMsg string `json:"ErrMsg"`
+}
+
+// RewindDrainerCheckPoint sets the checkpoint of the paused drainer back to the ts, then
+// the binlogs after ts are synced again in safe mode until the checkpoint
+// reaches the ts before rewinding, so the duplicated rows are overwritten.
+// The plan is only printed unless execute is set.
+func RewindDrainerCheckPoint(cfg *Config) error {
+	if cfg.ToTS <= 0 {
+		return errors.New("need to specify the ts to rewind to by -to-ts")
+	}
+	if len(cfg.NodeID) == 0 {
+		return errors.New("need to specify the drainer by -node-id")
+	}
+
+	registry, err := createRegistryFuc(cfg.EtcdURLs, cfg.TLS)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	ctx := context.Background()
+	n, err := getStoppedDrainer(ctx, registry, cfg.NodeID, "rewinding the checkpoint")
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if err = checkPumpsRetainTS(ctx, registry, cfg.ToTS, cfg.TLS); err != nil {
+		return errors.Trace(err)
+	}
+
+	cp, err := openDrainerCheckPointFunc(cfg, cfg.DrainerConfig)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer cp.Close()
+
+	fromTS := cp.TS()
+	if cfg.ToTS >= fromTS {
+		return errors.Errorf("can only rewind backward, the checkpoint of drainer %s is %d", n.NodeID, fromTS)
+	}
+
+	version, err := loadSchemaVersionAtFunc(cfg.EtcdURLs, cfg.ToTS)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	log.Info("rewind drainer plan",
+		zap.String("drainer", n.NodeID),
+		zap.Int64("from ts", fromTS),
+		zap.Stringer("from time", util.TSOToRoughTime(fromTS)),
+		zap.Int64("to ts", cfg.ToTS),
+		zap.Stringer("to time", util.TSOToRoughTime(cfg.ToTS)),
+		zap.Int64("schema version", version),
+		zap.String("safe mode", fmt.Sprintf("enabled for the binlogs in (%d, %d] after drainer restarts", cfg.ToTS, fromTS)))
+
+	if !cfg.Execute {
+		log.Info("dry run, add -execute to rewind the checkpoint")
+		return nil
+	}
+
+	if err = checkpoint.Rewind(cp, cfg.ToTS, version); err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("rewind drainer success, restart it to sync the binlogs again", zap.String("drainer", n.NodeID))
+	return nil
+}
+
+// getStoppedDrainer returns the status of the drainer, it fails unless the drainer is paused or offline,
+// so the checkpoint isn't saved by the drainer during the action, like "rewinding the checkpoint".
+func getStoppedDrainer(ctx context.Context, registry *node.EtcdRegistry, nodeID string, action string) (*node.Status, error) {
+	n, err := registry.Node(ctx, node.NodePrefix[node.DrainerNode], nodeID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if n.State != node.Paused && n.State != node.Offline {
+		return nil, errors.Errorf("drainer %s is %s, pause it before %s", n.NodeID, n.State, action)
+	}
+	return n, nil
+}
+
+// checkPumpsRetainTS checks the binlogs after ts are not purged by any pump.
+func checkPumpsRetainTS(ctx context.Context, registry *node.EtcdRegistry, ts int64, tlsConfig *tls.Config) error {
+	pumps, err := registry.Nodes(ctx, node.NodePrefix[node.PumpNode])
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	schema := "http"
+	if tlsConfig != nil {
+		schema = "https"
+	}
+
+	for _, pump := range pumps {
+		if pump.State == node.Offline {
+			// drainer doesn't pull binlogs from the offline pumps any more
+			if pump.MaxCommitTS > ts {
+				return errors.Errorf("pump %s is offline with binlogs after %d, they can't be synced again", pump.NodeID, ts)
+			}
+			continue
+		}
+
+		url := fmt.Sprintf("%s://%s/status", schema, pump.HTTPAddr())
+		resp, err := getClient(tlsConfig).Get(url)
+		if err != nil {
+			return errors.Annotatef(err, "get status of pump %s", pump.NodeID)
+		}
+		status := new(pumpStatus)
+		err = json.NewDecoder(resp.Body).Decode(status)
+		resp.Body.Close()
+		if err != nil {
+			return errors.Annotatef(err, "decode status of pump %s", pump.NodeID)
+		}
+		if len(status.ErrMsg) > 0 {
+			return errors.Errorf("get status of pump %s failed: %s", pump.NodeID, status.ErrMsg)
+		}
+
+		if status.GCTS > ts {
+			return errors.Errorf("the binlogs not after %d are purged by pump %s, can't rewind to %d", status.GCTS, pump.NodeID, ts)
+		}
+		log.Info("pump retains the binlogs", zap.String("pump", pump.NodeID), zap.Int64("gc ts", status.GCTS))
+	}
+	return nil
+}
+
+// openDrainerCheckPoint opens the checkpoint of drainer with the config file of drainer.
+func openDrainerCheckPoint(cfg *Config, drainerConfig string) (checkpoint.CheckPoint, error) {
+	if len(drainerConfig) == 0 {
+		return nil, errors.New("need to specify the config file of drainer by -drainer-config")
+	}
+
+	drainerCfg := drainer.NewConfig()
+	if err := drainerCfg.Parse([]string{"-config", drainerConfig}); err != nil {
+		return nil, errors.Annotatef(err, "parse config file of drainer %s", drainerConfig)
+	}
+	// save the checkpoint as the drainer owning it.
+	if len(drainerCfg.NodeID) == 0 {
+		drainerCfg.NodeID = cfg.NodeID
+	}
+
+	ectdEndpoints, err := flags.ParseHostPortAddr(cfg.EtcdURLs)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	pdCli, err := newPDClientFunc(ectdEndpoints, pd.SecurityOption{
+		CAPath:   cfg.SSLCA,
+		CertPath: cfg.SSLCert,
+		KeyPath:  cfg.SSLKey,
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer pdCli.Close()
+
+	cpCfg, err := drainer.GenCheckPointCfg(drainerCfg, pdCli.GetClusterID(context.Background()))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	cp, err := checkpoint.NewCheckPoint(cpCfg)
+	return cp, errors.Trace(err)
+}
@@ -0,0 +1,190 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer"
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	"github.com/pingcap/tidb-binlog/pkg/etcd"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+)
+
+var _ = Suite(&testRewindSuite{})
+
+type testRewindSuite struct {
+	gcTS             int64
+	pumpServer       *httptest.Server
+	checkpointFile   string
+	toCheckpointFile string
+}
+
+func (s *testRewindSuite) SetUpTest(c *C) {
+	newEtcdClientFromCfgFunc = newFakeEtcdClientFromCfg
+	createRegistryFuc = createMockRegistry
+	_, err := createMockRegistry("127.0.0.1:2379", nil)
+	c.Assert(err, IsNil)
+
+	s.pumpServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"CommitTS": 2000, "GCTS": %d, "ErrMsg": ""}`, s.gcTS)
+	}))
+
+	s.checkpointFile = path.Join(c.MkDir(), "savepoint")
+	cp, err := checkpoint.NewFile(0, s.checkpointFile)
+	c.Assert(err, IsNil)
+	c.Assert(cp.Save(1000, 0, true, 10), IsNil)
+
+	s.toCheckpointFile = path.Join(c.MkDir(), "savepoint")
+	openDrainerCheckPointFunc = func(_ *Config, drainerConfig string) (checkpoint.CheckPoint, error) {
+		if drainerConfig == "to-drainer.toml" {
+			return checkpoint.NewFile(0, s.toCheckpointFile)
+		}
+		return checkpoint.NewFile(0, s.checkpointFile)
+	}
+	loadSchemaVersionAtFunc = func(string, int64) (int64, error) {
+		return 5, nil
+	}
+}
+
+func (s *testRewindSuite) TearDownTest(c *C) {
+	s.pumpServer.Close()
+	cli, err := createEtcdClient("127.0.0.1:2379", nil)
+	c.Assert(err, IsNil)
+	ctx := context.Background()
+	c.Assert(cli.Delete(ctx, node.NodePrefix[node.PumpNode], true), IsNil)
+	c.Assert(cli.Delete(ctx, node.NodePrefix[node.DrainerNode], true), IsNil)
+
+	newEtcdClientFromCfgFunc = etcd.NewClientFromCfg
+	createRegistryFuc = createRegistry
+	openDrainerCheckPointFunc = openDrainerCheckPoint
+	loadSchemaVersionAtFunc = drainer.LoadSchemaVersionAt
+}
+
+func (s *testRewindSuite) registerNodes(c *C, drainerState string, offlinePumpMaxCommitTS int64) {
+	ctx := context.Background()
+	nodes := []struct {
+		kind   string
+		status *node.Status
+	}{
+		{node.DrainerNode, &node.Status{NodeID: "drainer1", Addr: "127.0.0.1:8249", State: drainerState}},
+		{node.PumpNode, &node.Status{NodeID: "pump1", Addr: strings.TrimPrefix(s.pumpServer.URL, "http://"), State: node.Online}},
+		{node.PumpNode, &node.Status{NodeID: "pump2", Addr: "127.0.0.1:1", State: node.Offline, MaxCommitTS: offlinePumpMaxCommitTS}},
+	}
+	for _, n := range nodes {
+		c.Assert(fakeRegistry.UpdateNode(ctx, node.NodePrefix[n.kind], n.status), IsNil)
+	}
+}
+
+func (s *testRewindSuite) checkpoint(c *C) checkpoint.CheckPoint {
+	cp, err := checkpoint.NewFile(0, s.checkpointFile)
+	c.Assert(err, IsNil)
+	return cp
+}
+
+func (s *testRewindSuite) TestRewind(c *C) {
+	s.registerNodes(c, node.Paused, 100)
+	s.gcTS = 400
+	cfg := &Config{EtcdURLs: "127.0.0.1:2379", NodeID: "drainer1", ToTS: 500}
+
+	// dry run
+	c.Assert(RewindDrainerCheckPoint(cfg), IsNil)
+	c.Assert(s.checkpoint(c).TS(), Equals, int64(1000))
+
+	cfg.Execute = true
+	c.Assert(RewindDrainerCheckPoint(cfg), IsNil)
+	cp := s.checkpoint(c)
+	c.Assert(cp.TS(), Equals, int64(500))
+	c.Assert(cp.SchemaVersion(), Equals, int64(5))
+	c.Assert(cp.SafeModeUntilTS(), Equals, int64(1000))
+
+	// forward
+	cfg.ToTS = 600
+	c.Assert(RewindDrainerCheckPoint(cfg), ErrorMatches, ".*can only rewind backward.*")
+}
+
+func (s *testRewindSuite) TestCheck(c *C) {
+	cfg := &Config{EtcdURLs: "127.0.0.1:2379", NodeID: "drainer1", ToTS: 500, Execute: true}
+
+	s.registerNodes(c, node.Online, 100)
+	c.Assert(RewindDrainerCheckPoint(cfg), ErrorMatches, ".*drainer drainer1 is online, pause it.*")
+
+	s.registerNodes(c, node.Paused, 100)
+	s.gcTS = 501
+	c.Assert(RewindDrainerCheckPoint(cfg), ErrorMatches, ".*purged by pump pump1.*")
+
+	s.gcTS = 500
+	s.registerNodes(c, node.Paused, 501)
+	c.Assert(RewindDrainerCheckPoint(cfg), ErrorMatches, ".*pump pump2 is offline with binlogs after 500.*")
+
+	c.Assert(s.checkpoint(c).TS(), Equals, int64(1000))
+}
+
+func (s *testRewindSuite) TestMigrateCheckPoint(c *C) {
+	cfg := &Config{EtcdURLs: "127.0.0.1:2379", NodeID: "drainer1", DrainerConfig: "drainer.toml"}
+	c.Assert(MigrateDrainerCheckPoint(cfg), ErrorMatches, "need to specify the config files.*")
+
+	cfg.ToDrainerConfig = "to-drainer.toml"
+	s.registerNodes(c, node.Online, 100)
+	c.Assert(MigrateDrainerCheckPoint(cfg), ErrorMatches, ".*drainer drainer1 is online, pause it before migrating.*")
+
+	// dry run
+	s.registerNodes(c, node.Paused, 100)
+	c.Assert(MigrateDrainerCheckPoint(cfg), IsNil)
+	to, err := checkpoint.NewFile(0, s.toCheckpointFile)
+	c.Assert(err, IsNil)
+	c.Assert(to.TS(), Equals, int64(0))
+
+	cfg.Execute = true
+	c.Assert(MigrateDrainerCheckPoint(cfg), IsNil)
+	to, err = checkpoint.NewFile(0, s.toCheckpointFile)
+	c.Assert(err, IsNil)
+	c.Assert(to.TS(), Equals, int64(1000))
+	c.Assert(to.SchemaVersion(), Equals, int64(10))
+	c.Assert(to.IsConsistent(), IsTrue)
+}
+
+func (s *testRewindSuite) TestExportSchema(c *C) {
+	var loadTS int64
+	loadSchemaSnapshotAtFunc = func(_ string, ts int64) (*drainer.SchemaSnapshot, error) {
+		loadTS = ts
+		return &drainer.SchemaSnapshot{TS: ts, SchemaVersion: 5}, nil
+	}
+	defer func() {
+		loadSchemaSnapshotAtFunc = drainer.LoadSchemaSnapshotAt
+	}()
+
+	file := path.Join(c.MkDir(), "schema.json")
+	cfg := &Config{EtcdURLs: "127.0.0.1:2379", SchemaFile: file}
+	c.Assert(ExportSchemaSnapshot(cfg), ErrorMatches, "need to specify the ts.*")
+
+	// export at the checkpoint of the drainer.
+	cfg.DrainerConfig = "drainer.toml"
+	c.Assert(ExportSchemaSnapshot(cfg), IsNil)
+	c.Assert(loadTS, Equals, int64(1000))
+	snapshot, err := drainer.ReadSchemaSnapshot(file)
+	c.Assert(err, IsNil)
+	c.Assert(snapshot.TS, Equals, int64(1000))
+	c.Assert(snapshot.SchemaVersion, Equals, int64(5))
+
+	cfg.CommitTS = 800
+	c.Assert(ExportSchemaSnapshot(cfg), IsNil)
+	c.Assert(loadTS, Equals, int64(800))
+}
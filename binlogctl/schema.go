@@ -0,0 +1,61 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"go.uber.org/zap"
+)
+
+var loadSchemaSnapshotAtFunc = drainer.LoadSchemaSnapshotAt
+
+// ExportSchemaSnapshot saves the schema of the upstream at the commit ts to the
+// file, the checkpoint of the drainer is used if the commit ts isn't specified.
+// A new drainer starting at the ts builds its schema from the file instead of
+// replaying all the history DDL jobs.
+func ExportSchemaSnapshot(cfg *Config) error {
+	ts := cfg.CommitTS
+	if ts <= 0 {
+		if len(cfg.DrainerConfig) == 0 {
+			return errors.New("need to specify the ts by -commit-ts or the drainer by -drainer-config")
+		}
+		cp, err := openDrainerCheckPointFunc(cfg, cfg.DrainerConfig)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		ts = cp.TS()
+		cp.Close()
+	}
+
+	snapshot, err := loadSchemaSnapshotAtFunc(cfg.EtcdURLs, ts)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = snapshot.WriteFile(cfg.SchemaFile); err != nil {
+		return errors.Trace(err)
+	}
+
+	log.Info("export schema success",
+		zap.String("file", cfg.SchemaFile),
+		zap.Int64("ts", ts),
+		zap.Stringer("time", util.TSOToRoughTime(ts)),
+		zap.Int64("schema version", snapshot.SchemaVersion),
+		zap.Int("schemas", len(snapshot.Schemas)))
+	log.Info("start the new drainer with the schema snapshot by -initial-commit-ts and -schema-snapshot-file",
+		zap.Int64("initial-commit-ts", ts), zap.String("schema-snapshot-file", cfg.SchemaFile))
+	return nil
+}
@@ -0,0 +1,236 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"go.uber.org/zap"
+)
+
+// stateCheckInterval is the interval of reading the state of the node from etcd
+// while waiting for the node to confirm the state change.
+var stateCheckInterval = time.Second
+
+const (
+	actionPause   = "pause"
+	actionDrain   = "drain"
+	actionUndrain = "undrain"
+)
+
+// PauseNode pauses the pump or drainer by its API, and waits until the node saves
+// the paused state to etcd before it exits.
+func PauseNode(urls, kind, nodeID string, timeout time.Duration, tlsConfig *tls.Config) error {
+	registry, err := createRegistryFuc(urls, tlsConfig)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	ctx := context.Background()
+	n, err := registry.Node(ctx, node.NodePrefix[kind], nodeID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch n.State {
+	case node.Paused:
+		log.Info("node is already paused", zap.String("type", kind), zap.Stringer("node", n))
+		return nil
+	case node.Online, node.Pausing:
+	default:
+		return errors.Errorf("can't pause %s in state %s", nodeID, n.State)
+	}
+
+	if n.State == node.Online {
+		if err = requestAction(n, actionPause, tlsConfig); err != nil {
+			return errors.Annotatef(err, "pause %s", nodeID)
+		}
+	}
+
+	n, err = waitNodeState(ctx, registry, kind, nodeID, timeout, func(s *node.Status) bool {
+		return s.State == node.Paused
+	})
+	if err != nil {
+		// the node is exiting, so there's nothing to roll back.
+		return errors.Annotatef(err, "%s isn't paused after %s, its state is %s", nodeID, timeout, n.State)
+	}
+	log.Info("node is paused", zap.String("type", kind), zap.Stringer("node", n))
+	return nil
+}
+
+// ResumeNode sets the state of the paused pump or drainer to online in etcd, and waits
+// for the node to confirm it by the heartbeat. The node must have been restarted, the
+// heartbeat of a running node keeps its state in etcd up to date. The paused state is
+// restored if the node doesn't confirm it in time, so other nodes won't connect to a node
+// that isn't running.
+func ResumeNode(urls, kind, nodeID string, timeout time.Duration, tlsConfig *tls.Config) error {
+	registry, err := createRegistryFuc(urls, tlsConfig)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	ctx := context.Background()
+	paused, err := registry.Node(ctx, node.NodePrefix[kind], nodeID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch paused.State {
+	case node.Online:
+		log.Info("node is already online", zap.String("type", kind), zap.Stringer("node", paused))
+		return nil
+	case node.Paused:
+	default:
+		return errors.Errorf("can't resume %s in state %s", nodeID, paused.State)
+	}
+
+	online := node.CloneStatus(paused)
+	online.State = node.Online
+	if err = registry.UpdateNode(ctx, node.NodePrefix[kind], online); err != nil {
+		return errors.Trace(err)
+	}
+
+	n, err := waitNodeState(ctx, registry, kind, nodeID, timeout, func(s *node.Status) bool {
+		return s.State == node.Online && s.UpdateTS > paused.UpdateTS
+	})
+	if err == nil {
+		log.Info("node is resumed", zap.String("type", kind), zap.Stringer("node", n))
+		return nil
+	}
+
+	// only roll back the state written above, the node may have changed it.
+	if n.State == online.State && n.UpdateTS == online.UpdateTS {
+		if rerr := registry.UpdateNode(ctx, node.NodePrefix[kind], paused); rerr != nil {
+			log.Error("roll back the state failed", zap.String("type", kind), zap.Stringer("node", paused), zap.Error(rerr))
+		} else {
+			log.Warn("roll back the state", zap.String("type", kind), zap.Stringer("node", paused))
+		}
+	}
+	return errors.Annotatef(err, "%s doesn't confirm it's online in %s, please make sure it has been restarted", nodeID, timeout)
+}
+
+// DrainNode makes the pump reject writing new binlogs, so TiDB writes them to the other pumps,
+// while drainers keep pulling the binlogs saved in it. It waits until the pump saves the
+// draining state to etcd, then the pump can be taken offline by offline-pump without losing
+// any binlog.
+func DrainNode(urls, nodeID string, timeout time.Duration, tlsConfig *tls.Config) error {
+	return changeDrainState(urls, nodeID, actionDrain, node.Online, node.Draining, timeout, tlsConfig)
+}
+
+// UndrainNode makes the draining pump accept writing new binlogs again.
+func UndrainNode(urls, nodeID string, timeout time.Duration, tlsConfig *tls.Config) error {
+	return changeDrainState(urls, nodeID, actionUndrain, node.Draining, node.Online, timeout, tlsConfig)
+}
+
+func changeDrainState(urls, nodeID, action, from, to string, timeout time.Duration, tlsConfig *tls.Config) error {
+	registry, err := createRegistryFuc(urls, tlsConfig)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	ctx := context.Background()
+	n, err := registry.Node(ctx, node.NodePrefix[node.PumpNode], nodeID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch n.State {
+	case to:
+		log.Info("pump is already in the state", zap.String("state", to), zap.Stringer("node", n))
+		return nil
+	case from:
+	default:
+		return errors.Errorf("can't %s %s in state %s", action, nodeID, n.State)
+	}
+
+	if err = requestAction(n, action, tlsConfig); err != nil {
+		return errors.Annotatef(err, "%s %s", action, nodeID)
+	}
+
+	n, err = waitNodeState(ctx, registry, node.PumpNode, nodeID, timeout, func(s *node.Status) bool {
+		return s.State == to
+	})
+	if err != nil {
+		return errors.Annotatef(err, "%s isn't %s after %s, its state is %s", nodeID, to, timeout, n.State)
+	}
+	log.Info("pump state is changed", zap.String("state", to), zap.Stringer("node", n))
+	return nil
+}
+
+// waitNodeState reads the state of the node from etcd until it's confirmed or timeout,
+// the last state read is returned.
+func waitNodeState(ctx context.Context, registry *node.EtcdRegistry, kind, nodeID string, timeout time.Duration, confirmed func(*node.Status) bool) (*node.Status, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(stateCheckInterval)
+	defer ticker.Stop()
+
+	var last *node.Status
+	for {
+		n, err := registry.Node(ctx, node.NodePrefix[kind], nodeID)
+		if err != nil {
+			log.Warn("get the state of node failed", zap.String("nodeID", nodeID), zap.Error(err))
+		} else {
+			last = n
+			if confirmed(n) {
+				return n, nil
+			}
+		}
+		if last == nil {
+			last = &node.Status{NodeID: nodeID, State: "unknown"}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return last, errors.Trace(ctx.Err())
+		}
+	}
+}
+
+// requestAction applies the action on the node by its API, and checks the response.
+func requestAction(n *node.Status, action string, tlsConfig *tls.Config) error {
+	schema := "http"
+	if tlsConfig != nil {
+		schema = "https"
+	}
+
+	url := fmt.Sprintf("%s://%s/state/%s/%s", schema, n.HTTPAddr(), n.NodeID, action)
+	log.Debug("send put http request", zap.String("url", url))
+	req, err := http.NewRequest("PUT", url, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	httpResp, err := getClient(tlsConfig).Do(req)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer httpResp.Body.Close()
+
+	resp := new(util.Response)
+	if err = json.NewDecoder(httpResp.Body).Decode(resp); err != nil {
+		return errors.Annotatef(err, "invalid response of %s", url)
+	}
+	if resp.Code != http.StatusOK {
+		return errors.Errorf("%s: %s", resp.ErrorCode, resp.Message)
+	}
+	return nil
+}
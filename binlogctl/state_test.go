@@ -0,0 +1,154 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/unrolled/render"
+)
+
+type testStateSuite struct {
+	oldInterval time.Duration
+}
+
+var _ = Suite(&testStateSuite{})
+
+func (s *testStateSuite) SetUpTest(c *C) {
+	new(testNodesSuite).SetUpTest(c)
+	s.oldInterval = stateCheckInterval
+	stateCheckInterval = 10 * time.Millisecond
+}
+
+func (s *testStateSuite) TearDownTest(c *C) {
+	new(testNodesSuite).TearDownTest(c)
+	stateCheckInterval = s.oldInterval
+}
+
+func setNodeForTest(c *C, status *node.Status) {
+	c.Assert(fakeRegistry.UpdateNode(context.Background(), node.NodePrefix[node.PumpNode], status), IsNil)
+}
+
+func getNodeForTest(c *C, nodeID string) *node.Status {
+	n, err := fakeRegistry.Node(context.Background(), node.NodePrefix[node.PumpNode], nodeID)
+	c.Assert(err, IsNil)
+	return n
+}
+
+// createActionServer returns a server applying the action like pump, the paused state
+// is saved after a while if pause is true.
+func createActionServer(c *C, nodeID string, pause bool) *httptest.Server {
+	rd := render.New(render.Options{})
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !pause {
+			c.Assert(rd.JSON(w, http.StatusOK, util.ErrCodeResponsef(errorcode.InvalidState, "apply pause failed!")), IsNil)
+			return
+		}
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			n := getNodeForTest(c, nodeID)
+			n.State = node.Paused
+			setNodeForTest(c, n)
+		}()
+		c.Assert(rd.JSON(w, http.StatusOK, util.SuccessResponse("apply action pause success!", nil)), IsNil)
+	}))
+}
+
+func (s *testStateSuite) TestPauseNode(c *C) {
+	server := createActionServer(c, "pause", true)
+	defer server.Close()
+	setNodeForTest(c, &node.Status{NodeID: "pause", Addr: strings.TrimPrefix(server.URL, "http://"), State: node.Online})
+
+	err := PauseNode("127.0.0.1:2379", node.PumpNode, "pause", time.Second, nil)
+	c.Assert(err, IsNil)
+	c.Assert(getNodeForTest(c, "pause").State, Equals, node.Paused)
+
+	// it's already paused.
+	err = PauseNode("127.0.0.1:2379", node.PumpNode, "pause", time.Second, nil)
+	c.Assert(err, IsNil)
+
+	rejected := createActionServer(c, "reject", false)
+	defer rejected.Close()
+	setNodeForTest(c, &node.Status{NodeID: "reject", Addr: strings.TrimPrefix(rejected.URL, "http://"), State: node.Online})
+	err = PauseNode("127.0.0.1:2379", node.PumpNode, "reject", time.Second, nil)
+	c.Assert(err, ErrorMatches, ".*INVALID_STATE: apply pause failed!.*")
+
+	setNodeForTest(c, &node.Status{NodeID: "offline", State: node.Offline})
+	err = PauseNode("127.0.0.1:2379", node.PumpNode, "offline", time.Second, nil)
+	c.Assert(err, ErrorMatches, "can't pause offline in state offline")
+}
+
+func (s *testStateSuite) TestResumeNode(c *C) {
+	setNodeForTest(c, &node.Status{NodeID: "resume", State: node.Paused, UpdateTS: 100})
+
+	// the node isn't running, so the state is rolled back.
+	err := ResumeNode("127.0.0.1:2379", node.PumpNode, "resume", 100*time.Millisecond, nil)
+	c.Assert(err, ErrorMatches, ".*doesn't confirm it's online.*")
+	c.Assert(getNodeForTest(c, "resume").State, Equals, node.Paused)
+
+	// the heartbeat of the restarted node confirms it.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		setNodeForTest(c, &node.Status{NodeID: "resume", State: node.Online, UpdateTS: 200})
+	}()
+	err = ResumeNode("127.0.0.1:2379", node.PumpNode, "resume", time.Second, nil)
+	c.Assert(err, IsNil)
+	n := getNodeForTest(c, "resume")
+	c.Assert(n.State, Equals, node.Online)
+	c.Assert(n.UpdateTS, Equals, int64(200))
+
+	setNodeForTest(c, &node.Status{NodeID: "closing", State: node.Closing})
+	err = ResumeNode("127.0.0.1:2379", node.PumpNode, "closing", time.Second, nil)
+	c.Assert(err, ErrorMatches, "can't resume closing in state closing")
+}
+
+func (s *testStateSuite) TestDrainNode(c *C) {
+	rd := render.New(render.Options{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := node.Draining
+		if strings.HasSuffix(r.URL.Path, "/undrain") {
+			state = node.Online
+		}
+		n := getNodeForTest(c, "drain")
+		n.State = state
+		setNodeForTest(c, n)
+		c.Assert(rd.JSON(w, http.StatusOK, util.SuccessResponse("apply action success!", nil)), IsNil)
+	}))
+	defer server.Close()
+	setNodeForTest(c, &node.Status{NodeID: "drain", Addr: strings.TrimPrefix(server.URL, "http://"), State: node.Online})
+
+	err := DrainNode("127.0.0.1:2379", "drain", time.Second, nil)
+	c.Assert(err, IsNil)
+	c.Assert(getNodeForTest(c, "drain").State, Equals, node.Draining)
+
+	// it's already draining.
+	err = DrainNode("127.0.0.1:2379", "drain", time.Second, nil)
+	c.Assert(err, IsNil)
+
+	err = UndrainNode("127.0.0.1:2379", "drain", time.Second, nil)
+	c.Assert(err, IsNil)
+	c.Assert(getNodeForTest(c, "drain").State, Equals, node.Online)
+
+	setNodeForTest(c, &node.Status{NodeID: "paused", State: node.Paused})
+	err = DrainNode("127.0.0.1:2379", "paused", time.Second, nil)
+	c.Assert(err, ErrorMatches, "can't drain paused in state paused")
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"context"
+	"net"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	"go.uber.org/zap"
+)
+
+// runRestartCommand is changed in unit test for mock.
+var runRestartCommand = func(command string) error {
+	output, err := exec.Command("sh", "-c", command).CombinedOutput()
+	if err != nil {
+		return errors.Annotatef(err, "run %q, output: %s", command, output)
+	}
+	log.Info("run restart command", zap.String("command", command), zap.ByteString("output", output))
+	return nil
+}
+
+// RollingUpgradePumps upgrades the online pumps -concurrency pumps after another. Every pump is
+// drained, so TiDB writes the binlogs to the other pumps, then it's restarted by -restart-command
+// after the online drainers consume all the binlogs saved in it, and the next pumps are upgraded
+// after it's online again. It stops at the first pump failed to upgrade, a pump failed before
+// restarted is undrained.
+func RollingUpgradePumps(cfg *Config) error {
+	if len(cfg.RestartCommand) == 0 {
+		return errors.New("need to specify the command restarting a pump by -restart-command")
+	}
+	if cfg.Concurrency <= 0 {
+		return errors.Errorf("invalid concurrency %d", cfg.Concurrency)
+	}
+
+	registry, err := createRegistryFuc(cfg.EtcdURLs, cfg.TLS)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	pumps, err := registry.Nodes(context.Background(), node.NodePrefix[node.PumpNode])
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var online []*node.Status
+	for _, n := range pumps {
+		switch n.State {
+		case node.Online:
+			online = append(online, n)
+		case node.Offline:
+		default:
+			log.Warn("skip the pump not online", zap.Stringer("node", n))
+		}
+	}
+	// keep at least one pump accepting the binlogs of TiDB.
+	if cfg.Concurrency >= len(online) {
+		return errors.Errorf("concurrency %d must be less than the number of online pumps %d", cfg.Concurrency, len(online))
+	}
+	sort.Slice(online, func(i, j int) bool { return online[i].NodeID < online[j].NodeID })
+
+	for i := 0; i < len(online); i += cfg.Concurrency {
+		end := i + cfg.Concurrency
+		if end > len(online) {
+			end = len(online)
+		}
+		errs := make([]error, end-i)
+		var wg sync.WaitGroup
+		for j, n := range online[i:end] {
+			wg.Add(1)
+			go func(j int, n *node.Status) {
+				defer wg.Done()
+				errs[j] = upgradePump(registry, cfg, n)
+			}(j, n)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	log.Info("all pumps are upgraded", zap.Int("count", len(online)))
+	return nil
+}
+
+func upgradePump(registry *node.EtcdRegistry, cfg *Config, n *node.Status) error {
+	log.Info("start to upgrade pump", zap.Stringer("node", n))
+	if err := DrainNode(cfg.EtcdURLs, n.NodeID, cfg.Timeout, cfg.TLS); err != nil {
+		return errors.Trace(err)
+	}
+
+	drained, err := waitPumpConsumed(registry, n.NodeID, cfg.Timeout)
+	if err != nil {
+		if uerr := UndrainNode(cfg.EtcdURLs, n.NodeID, cfg.Timeout, cfg.TLS); uerr != nil {
+			log.Error("undrain pump failed", zap.String("nodeID", n.NodeID), zap.Error(uerr))
+		}
+		return errors.Annotatef(err, "upgrade %s", n.NodeID)
+	}
+
+	if err = runRestartCommand(restartCommand(cfg, n)); err != nil {
+		return errors.Annotatef(err, "restart %s", n.NodeID)
+	}
+	restarted, err := waitNodeState(context.Background(), registry, node.PumpNode, n.NodeID, cfg.Timeout, func(s *node.Status) bool {
+		return s.State == node.Online && s.UpdateTS > drained.UpdateTS
+	})
+	if err != nil {
+		return errors.Annotatef(err, "%s isn't online after restarted in %s, its state is %s", n.NodeID, cfg.Timeout, restarted.State)
+	}
+	log.Info("pump is upgraded", zap.Stringer("node", restarted))
+	return nil
+}
+
+// waitPumpConsumed waits until the online drainers consume the binlogs saved in the draining pump.
+// The max commit ts reported by the heartbeat after the pump is drained is waited for, the later
+// ones are the fake binlogs written by the pump itself. The last status of the pump is returned.
+func waitPumpConsumed(registry *node.EtcdRegistry, nodeID string, timeout time.Duration) (*node.Status, error) {
+	ctx := context.Background()
+	drained, err := registry.Node(ctx, node.NodePrefix[node.PumpNode], nodeID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	n, err := waitNodeState(ctx, registry, node.PumpNode, nodeID, timeout, func(s *node.Status) bool {
+		return s.UpdateTS > drained.UpdateTS
+	})
+	if err != nil {
+		return nil, errors.Annotatef(err, "no heartbeat of %s after drained", nodeID)
+	}
+	if n.State != node.Draining {
+		return nil, errors.Errorf("%s isn't draining, its state is %s", nodeID, n.State)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(stateCheckInterval)
+	defer ticker.Stop()
+	for {
+		drainers, err := registry.Nodes(ctx, node.NodePrefix[node.DrainerNode])
+		if err != nil {
+			log.Warn("get drainers failed", zap.Error(err))
+		} else {
+			var behind *node.Status
+			for _, d := range drainers {
+				if d.State == node.Online && d.MaxCommitTS < n.MaxCommitTS {
+					behind = d
+					break
+				}
+			}
+			if behind == nil {
+				log.Info("binlogs of pump are consumed", zap.String("nodeID", nodeID), zap.Int64("max commit ts", n.MaxCommitTS))
+				return n, nil
+			}
+			log.Info("waiting for drainer to consume binlogs of pump", zap.String("nodeID", nodeID),
+				zap.Int64("max commit ts", n.MaxCommitTS), zap.Stringer("drainer", behind))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, errors.Annotatef(ctx.Err(), "drainers don't consume the binlogs of %s in %s", nodeID, timeout)
+		}
+	}
+}
+
+// restartCommand replaces the placeholders {node-id}, {host} and {binary} of -restart-command.
+func restartCommand(cfg *Config, n *node.Status) string {
+	host, _, err := net.SplitHostPort(n.Addr)
+	if err != nil {
+		host = n.Addr
+	}
+	return strings.NewReplacer("{node-id}", n.NodeID, "{host}", host, "{binary}", cfg.Binary).Replace(cfg.RestartCommand)
+}
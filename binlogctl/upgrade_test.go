@@ -0,0 +1,140 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogctl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/unrolled/render"
+	"go.etcd.io/etcd/clientv3"
+)
+
+type testUpgradeSuite struct {
+	state                testStateSuite
+	oldRunRestartCommand func(string) error
+}
+
+var _ = Suite(&testUpgradeSuite{})
+
+func (s *testUpgradeSuite) SetUpTest(c *C) {
+	s.state.SetUpTest(c)
+	s.oldRunRestartCommand = runRestartCommand
+	// only the nodes of the test are registered.
+	_, err := testEtcdCluster.RandClient().Delete(context.Background(), node.DefaultRootPath, clientv3.WithPrefix())
+	c.Assert(err, IsNil)
+}
+
+func (s *testUpgradeSuite) TearDownTest(c *C) {
+	s.state.TearDownTest(c)
+	runRestartCommand = s.oldRunRestartCommand
+}
+
+// createDrainServer returns a server draining or undraining the pump like pump, the heartbeat
+// after drained reports the max commit ts.
+func createDrainServer(c *C, nodeID string, maxCommitTS int64) *httptest.Server {
+	rd := render.New(render.Options{})
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := getNodeForTest(c, nodeID)
+		n.State, n.UpdateTS = node.Draining, n.UpdateTS+1
+		if strings.HasSuffix(r.URL.Path, "/undrain") {
+			n.State = node.Online
+		}
+		setNodeForTest(c, n)
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			n.UpdateTS, n.MaxCommitTS = n.UpdateTS+1, maxCommitTS
+			setNodeForTest(c, n)
+		}()
+		c.Assert(rd.JSON(w, http.StatusOK, util.SuccessResponse("apply action success!", nil)), IsNil)
+	}))
+}
+
+func setDrainerForTest(c *C, status *node.Status) {
+	c.Assert(fakeRegistry.UpdateNode(context.Background(), node.NodePrefix[node.DrainerNode], status), IsNil)
+}
+
+func (s *testUpgradeSuite) TestRollingUpgradePumps(c *C) {
+	nodeIDs := []string{"upgrade-2", "upgrade-1"}
+	for _, nodeID := range nodeIDs {
+		server := createDrainServer(c, nodeID, 100)
+		defer server.Close()
+		setNodeForTest(c, &node.Status{NodeID: nodeID, Addr: strings.TrimPrefix(server.URL, "http://"), State: node.Online, UpdateTS: 10})
+	}
+	setNodeForTest(c, &node.Status{NodeID: "offline", State: node.Offline})
+	setDrainerForTest(c, &node.Status{NodeID: "drainer", State: node.Online, MaxCommitTS: 50})
+	setDrainerForTest(c, &node.Status{NodeID: "paused", State: node.Paused, MaxCommitTS: 10})
+
+	var mu sync.Mutex
+	var commands []string
+	runRestartCommand = func(command string) error {
+		mu.Lock()
+		commands = append(commands, command)
+		mu.Unlock()
+		nodeID := strings.Fields(command)[1]
+		// the drainer has consumed the binlogs of the pump before it's restarted.
+		c.Assert(getNodeForTest(c, nodeID).State, Equals, node.Draining)
+		n := getNodeForTest(c, nodeID)
+		n.State, n.UpdateTS = node.Online, n.UpdateTS+10
+		setNodeForTest(c, n)
+		return nil
+	}
+
+	cfg := NewConfig()
+	cfg.EtcdURLs = "127.0.0.1:2379"
+	cfg.Timeout = time.Second
+	cfg.Binary = "/tmp/pump"
+	cfg.RestartCommand = "restart {node-id} {host} {binary}"
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		setDrainerForTest(c, &node.Status{NodeID: "drainer", State: node.Online, MaxCommitTS: 100})
+	}()
+	c.Assert(RollingUpgradePumps(cfg), IsNil)
+	c.Assert(commands, DeepEquals, []string{"restart upgrade-1 127.0.0.1 /tmp/pump", "restart upgrade-2 127.0.0.1 /tmp/pump"})
+	for _, nodeID := range nodeIDs {
+		c.Assert(getNodeForTest(c, nodeID).State, Equals, node.Online)
+	}
+
+	cfg.Concurrency = 2
+	c.Assert(RollingUpgradePumps(cfg), ErrorMatches, "concurrency 2 must be less than the number of online pumps 2")
+}
+
+func (s *testUpgradeSuite) TestUndrainIfNotConsumed(c *C) {
+	for _, nodeID := range []string{"upgrade-1", "upgrade-2"} {
+		server := createDrainServer(c, nodeID, 100)
+		defer server.Close()
+		setNodeForTest(c, &node.Status{NodeID: nodeID, Addr: strings.TrimPrefix(server.URL, "http://"), State: node.Online, UpdateTS: 10})
+	}
+	setDrainerForTest(c, &node.Status{NodeID: "drainer", State: node.Online, MaxCommitTS: 50})
+	runRestartCommand = func(command string) error {
+		c.Fatalf("pump is restarted by %s", command)
+		return nil
+	}
+
+	cfg := NewConfig()
+	cfg.EtcdURLs = "127.0.0.1:2379"
+	cfg.Timeout = 200 * time.Millisecond
+	cfg.RestartCommand = "restart {node-id}"
+	err := RollingUpgradePumps(cfg)
+	c.Assert(err, ErrorMatches, "upgrade upgrade-1: drainers don't consume the binlogs of upgrade-1 in 200ms.*")
+	c.Assert(getNodeForTest(c, "upgrade-1").State, Equals, node.Online)
+	c.Assert(getNodeForTest(c, "upgrade-2").State, Equals, node.Online)
+}
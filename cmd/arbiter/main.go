@@ -50,6 +50,13 @@ func main() {
 	log.Info("start arbiter...", zap.Reflect("config", cfg))
 	version.PrintVersionInfo("Arbiter")
 
+	if cfg.DeadLetter.Replay {
+		if err := arbiter.ReplayDeadLetters(cfg); err != nil {
+			log.Fatal("replay dead letters failed", zap.Error(err))
+		}
+		return
+	}
+
 	go startHTTPServer(cfg.ListenAddr)
 
 	srv, err := arbiter.NewServer(cfg)
@@ -74,6 +81,7 @@ func main() {
 func startHTTPServer(addr string) {
 	prometheus.DefaultGatherer = arbiter.Registry
 	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/log-level", util.HandleLogLevel)
 
 	err := http.ListenAndServe(addr, nil)
 	if err != nil {
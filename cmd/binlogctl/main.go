@@ -25,7 +25,6 @@ import (
 )
 
 const (
-	pause = "pause"
 	close = "close"
 )
 
@@ -53,9 +52,17 @@ func main() {
 	case ctl.UpdateDrainer:
 		err = ctl.UpdateNodeState(cfg.EtcdURLs, node.DrainerNode, cfg.NodeID, cfg.State, cfg.TLS)
 	case ctl.PausePump:
-		err = ctl.ApplyAction(cfg.EtcdURLs, node.PumpNode, cfg.NodeID, pause, cfg.TLS)
+		err = ctl.PauseNode(cfg.EtcdURLs, node.PumpNode, cfg.NodeID, cfg.Timeout, cfg.TLS)
 	case ctl.PauseDrainer:
-		err = ctl.ApplyAction(cfg.EtcdURLs, node.DrainerNode, cfg.NodeID, pause, cfg.TLS)
+		err = ctl.PauseNode(cfg.EtcdURLs, node.DrainerNode, cfg.NodeID, cfg.Timeout, cfg.TLS)
+	case ctl.ResumePump:
+		err = ctl.ResumeNode(cfg.EtcdURLs, node.PumpNode, cfg.NodeID, cfg.Timeout, cfg.TLS)
+	case ctl.ResumeDrainer:
+		err = ctl.ResumeNode(cfg.EtcdURLs, node.DrainerNode, cfg.NodeID, cfg.Timeout, cfg.TLS)
+	case ctl.DrainPump:
+		err = ctl.DrainNode(cfg.EtcdURLs, cfg.NodeID, cfg.Timeout, cfg.TLS)
+	case ctl.UndrainPump:
+		err = ctl.UndrainNode(cfg.EtcdURLs, cfg.NodeID, cfg.Timeout, cfg.TLS)
 	case ctl.OfflinePump:
 		err = ctl.ApplyAction(cfg.EtcdURLs, node.PumpNode, cfg.NodeID, close, cfg.TLS)
 	case ctl.OfflineDrainer:
@@ -66,6 +73,30 @@ func main() {
 		} else {
 			err = ctl.EncryptHandler(cfg.Text)
 		}
+	case ctl.ExportMeta:
+		err = ctl.ExportMetaInfo(cfg.EtcdURLs, cfg.MetaFile, cfg.TLS)
+	case ctl.ImportMeta:
+		err = ctl.ImportMetaInfo(cfg.EtcdURLs, cfg.MetaFile, cfg.Overwrite, cfg.TLS)
+	case ctl.RewindDrainer:
+		err = ctl.RewindDrainerCheckPoint(cfg)
+	case ctl.ExportSchema:
+		err = ctl.ExportSchemaSnapshot(cfg)
+	case ctl.ConvertBinlog:
+		err = ctl.ConvertBinlogFiles(cfg.InputDir, cfg.OutputDir, cfg.ConvertTo)
+	case ctl.ExportBinlog:
+		err = ctl.ExportPumpBinlogs(cfg)
+	case ctl.UpgradePumps:
+		err = ctl.RollingUpgradePumps(cfg)
+	case ctl.MigrateCheckpoint:
+		err = ctl.MigrateDrainerCheckPoint(cfg)
+	case ctl.QueryAssignment:
+		err = ctl.QueryTableAssignment(cfg)
+	case ctl.AssignTables:
+		err = ctl.AssignDrainerTables(cfg)
+	case ctl.UnassignTables:
+		err = ctl.UnassignDrainerTables(cfg)
+	case ctl.AnalyzePB:
+		err = ctl.AnalyzePBFiles(cfg.InputDir, cfg.Gap)
 	default:
 		err = errors.NotSupportedf("cmd %s", cfg.Command)
 	}
@@ -14,6 +14,8 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"math/rand"
 	_ "net/http/pprof"
 	"os"
@@ -24,6 +26,7 @@ import (
 
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-binlog/drainer"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb-binlog/pkg/version"
 	"go.uber.org/zap"
@@ -43,11 +46,24 @@ func main() {
 		log.Fatal("Failed to initialize log", zap.Error(err))
 	}
 	version.PrintVersionInfo("Drainer")
+
+	if len(cfg.BenchFromDir) > 0 {
+		log.Info("start drainer bench...", zap.Reflect("config", cfg))
+		report, err := drainer.RunBench(cfg)
+		if err != nil {
+			log.Fatal("drainer bench failed", zap.Error(err))
+		}
+		log.Info("drainer bench finished", zap.Reflect("report", report))
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
 	log.Info("start drainer...", zap.Reflect("config", cfg))
 
 	bs, err := drainer.NewServer(cfg)
 	if err != nil {
-		log.Fatal("create drainer server failed", zap.Error(err))
+		log.Fatal("create drainer server failed", zap.Error(err), errorcode.Field(err))
 	}
 
 	sc := make(chan os.Signal, 1)
@@ -66,7 +82,7 @@ func main() {
 	}()
 
 	if err := bs.Start(); err != nil {
-		log.Error("start drainer server failed", zap.Error(err))
+		log.Error("start drainer server failed", zap.Error(err), errorcode.Field(err))
 		os.Exit(2)
 	}
 
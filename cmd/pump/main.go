@@ -25,6 +25,7 @@ import (
 	_ "net/http/pprof"
 
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb-binlog/pkg/version"
 	"github.com/pingcap/tidb-binlog/pump"
@@ -49,7 +50,7 @@ func main() {
 
 	p, err := pump.NewServer(cfg)
 	if err != nil {
-		log.Fatal("creating pump server failed", zap.Error(err))
+		log.Fatal("creating pump server failed", zap.Error(err), errorcode.Field(err))
 	}
 
 	sc := make(chan os.Signal, 1)
@@ -72,7 +73,7 @@ func main() {
 
 	// Start will block until the server is closed
 	if err := p.Start(); err != nil {
-		log.Error("start pump server failed", zap.Error(err))
+		log.Error("start pump server failed", zap.Error(err), errorcode.Field(err))
 		// exit when start fail
 		os.Exit(2)
 	}
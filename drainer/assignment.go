@@ -0,0 +1,80 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	pb "github.com/pingcap/tipb/go-binlog"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+// tableAssignment decides the tables synced by the drainer in a group, the others are synced by the
+// other drainers of the group.
+type tableAssignment struct {
+	nodeID     string
+	assignment *node.Assignment
+}
+
+// loadTableAssignment loads the assignment of the group from etcd, nothing is owned by the drainer
+// if nothing is assigned in the group.
+func loadTableAssignment(ctx context.Context, reg *node.EtcdRegistry, group string, nodeID string) (*tableAssignment, error) {
+	a, err := reg.Assignment(ctx, group)
+	if err != nil {
+		return nil, errors.Annotatef(err, "load assignment of group %s failed", group)
+	}
+	if a == nil {
+		a = &node.Assignment{}
+	}
+
+	owned := a.TablesOf(nodeID)
+	if len(owned) == 0 {
+		log.Warn("no table is assigned to drainer, nothing is synced", zap.String("group", group), zap.String("drainer", nodeID))
+	}
+	for _, t := range owned {
+		log.Info("table is assigned to drainer", zap.String("group", group), zap.String("table", t.Name()),
+			zap.Int64("since", t.Since), zap.Int64("version", a.Version))
+	}
+	return &tableAssignment{nodeID: nodeID, assignment: a}, nil
+}
+
+// owns returns whether the binlog of the table committed at commitTS is synced by the drainer,
+// the binlogs committed not after the ts it's assigned at were synced by the previous owner.
+// Set table empty for the DDLs of the schema itself.
+func (t *tableAssignment) owns(schema, table string, commitTS int64) bool {
+	entry := t.assignment.Lookup(schema, table)
+	return entry != nil && entry.Drainer == t.nodeID && commitTS > entry.Since
+}
+
+// filterMutations removes the mutations of the tables not owned by the drainer, ignore is true if
+// none is left.
+func (t *tableAssignment) filterMutations(pv *pb.PrewriteValue, schema *Schema, commitTS int64) (ignore bool, err error) {
+	var muts []pb.TableMutation
+	for _, mutation := range pv.GetMutations() {
+		schemaName, tableName, ok := schema.SchemaAndTableName(mutation.GetTableId())
+		if !ok {
+			return false, errors.Errorf("not found table id: %d", mutation.GetTableId())
+		}
+		if !t.owns(schemaName, tableName, commitTS) {
+			log.Debug("skip dml of table not assigned", zap.String("schema", schemaName), zap.String("table", tableName))
+			continue
+		}
+		muts = append(muts, mutation)
+	}
+
+	pv.Mutations = muts
+	return len(muts) == 0, nil
+}
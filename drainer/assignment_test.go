@@ -0,0 +1,69 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	pb "github.com/pingcap/tipb/go-binlog"
+)
+
+type assignmentSuite struct{}
+
+var _ = check.Suite(&assignmentSuite{})
+
+func (s *assignmentSuite) TestOwns(c *check.C) {
+	a := &node.Assignment{}
+	a.Set(&node.TableAssignment{Schema: "db1", Drainer: "d1"})
+	a.Set(&node.TableAssignment{Schema: "db1", Table: "t1", Drainer: "d2", Since: 100})
+	t := &tableAssignment{nodeID: "d2", assignment: a}
+
+	c.Assert(t.owns("db1", "t1", 100), check.IsFalse)
+	c.Assert(t.owns("db1", "T1", 101), check.IsTrue)
+	c.Assert(t.owns("db1", "t2", 101), check.IsFalse)
+	c.Assert(t.owns("db1", "", 101), check.IsFalse)
+	c.Assert(t.owns("db2", "t1", 101), check.IsFalse)
+
+	t.nodeID = "d1"
+	c.Assert(t.owns("db1", "t2", 1), check.IsTrue)
+	c.Assert(t.owns("db1", "", 1), check.IsTrue)
+	c.Assert(t.owns("db1", "t1", 101), check.IsFalse)
+}
+
+func (s *assignmentSuite) TestFilterMutations(c *check.C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, check.IsNil)
+	schema.tableIDToName[1] = TableName{Schema: "db1", Table: "t1"}
+	schema.tableIDToName[2] = TableName{Schema: "db1", Table: "t2"}
+
+	a := &node.Assignment{}
+	a.Set(&node.TableAssignment{Schema: "db1", Table: "t2", Drainer: "d1", Since: 100})
+	t := &tableAssignment{nodeID: "d1", assignment: a}
+
+	pv := &pb.PrewriteValue{Mutations: []pb.TableMutation{{TableId: 1}, {TableId: 2}}}
+	ignore, err := t.filterMutations(pv, schema, 200)
+	c.Assert(err, check.IsNil)
+	c.Assert(ignore, check.IsFalse)
+	c.Assert(pv.Mutations, check.HasLen, 1)
+	c.Assert(pv.Mutations[0].TableId, check.Equals, int64(2))
+
+	// synced by the previous owner.
+	ignore, err = t.filterMutations(pv, schema, 100)
+	c.Assert(err, check.IsNil)
+	c.Assert(ignore, check.IsTrue)
+
+	pv.Mutations = []pb.TableMutation{{TableId: 3}}
+	_, err = t.filterMutations(pv, schema, 200)
+	c.Assert(err, check.ErrorMatches, "not found table id: 3")
+}
@@ -0,0 +1,245 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/unrolled/render"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+const bandwidthTimeLayout = "15:04"
+
+// BandwidthConfig is the config of limiting the bytes of the binlogs synced per second by the
+// time of day, for the replication across regions sharing the links with the production traffic.
+type BandwidthConfig struct {
+	// BytesPerSecond is the limit out of the windows, 0 means unlimited.
+	BytesPerSecond int64 `toml:"bytes-per-second" json:"bytes-per-second"`
+	// Windows are the limits in the windows of the day, the first matched one is used.
+	Windows []BandwidthWindow `toml:"window" json:"windows"`
+}
+
+// BandwidthWindow is the limit in [Start, End) of the local time of the day, like "09:00" and
+// "18:00", the window crosses midnight if End is before Start.
+type BandwidthWindow struct {
+	Start string `toml:"start" json:"start"`
+	End   string `toml:"end" json:"end"`
+	// BytesPerSecond is the limit in the window, 0 means unlimited.
+	BytesPerSecond int64 `toml:"bytes-per-second" json:"bytes-per-second"`
+}
+
+// bandwidthWindow is the BandwidthWindow parsed, start and end are the minutes of the day.
+type bandwidthWindow struct {
+	start int
+	end   int
+	limit int64
+}
+
+func (w bandwidthWindow) contains(minute int) bool {
+	if w.start < w.end {
+		return w.start <= minute && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+func parseMinuteOfDay(s string) (int, error) {
+	t, err := time.Parse(bandwidthTimeLayout, s)
+	if err != nil {
+		return 0, errors.Annotatef(err, "invalid time %s, must be like 09:30", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parse validates the config and returns the windows parsed.
+func (c *BandwidthConfig) parse() ([]bandwidthWindow, error) {
+	if c.BytesPerSecond < 0 {
+		return nil, errors.Errorf("bytes-per-second of bandwidth is %d, must not be negative", c.BytesPerSecond)
+	}
+	windows := make([]bandwidthWindow, 0, len(c.Windows))
+	for _, window := range c.Windows {
+		start, err := parseMinuteOfDay(window.Start)
+		if err != nil {
+			return nil, errors.Annotate(err, "invalid start of bandwidth window")
+		}
+		end, err := parseMinuteOfDay(window.End)
+		if err != nil {
+			return nil, errors.Annotate(err, "invalid end of bandwidth window")
+		}
+		if start == end {
+			return nil, errors.Errorf("the bandwidth window [%s, %s) is empty", window.Start, window.End)
+		}
+		if window.BytesPerSecond < 0 {
+			return nil, errors.Errorf("bytes-per-second of bandwidth window [%s, %s) is %d, must not be negative",
+				window.Start, window.End, window.BytesPerSecond)
+		}
+		windows = append(windows, bandwidthWindow{start: start, end: end, limit: window.BytesPerSecond})
+	}
+	return windows, nil
+}
+
+func (c *BandwidthConfig) validate() error {
+	_, err := c.parse()
+	return errors.Trace(err)
+}
+
+// bandwidthScheduler limits the bytes of the binlogs synced per second by the limit of the window
+// the current time is in, the schedule can be changed at runtime.
+type bandwidthScheduler struct {
+	mu       sync.Mutex
+	cfg      BandwidthConfig
+	windows  []bandwidthWindow
+	limit    int64
+	limiter  *rate.Limiter
+	location *time.Location
+}
+
+func newBandwidthScheduler(cfg *BandwidthConfig) (*bandwidthScheduler, error) {
+	s := &bandwidthScheduler{location: time.Local}
+	if cfg == nil {
+		cfg = new(BandwidthConfig)
+	}
+	if err := s.set(*cfg); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return s, nil
+}
+
+// set replaces the schedule, the limit is updated on the next wait.
+func (s *bandwidthScheduler) set(cfg BandwidthConfig) error {
+	windows, err := cfg.parse()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	s.mu.Lock()
+	s.cfg = cfg
+	s.windows = windows
+	// make the limit updated on the next wait.
+	s.limit = -1
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *bandwidthScheduler) config() BandwidthConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg
+}
+
+// limitAt returns the limit of the window the time is in, or the default limit.
+func (s *bandwidthScheduler) limitAt(now time.Time) int64 {
+	now = now.In(s.location)
+	minute := now.Hour()*60 + now.Minute()
+	for _, window := range s.windows {
+		if window.contains(minute) {
+			return window.limit
+		}
+	}
+	return s.cfg.BytesPerSecond
+}
+
+// limiterAt returns the limit at the time and its limiter, the limiter is nil if it's unlimited.
+// A new limiter allowing to burst for one second is created when the limit changes.
+func (s *bandwidthScheduler) limiterAt(now time.Time) (*rate.Limiter, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limit := s.limitAt(now)
+	if limit != s.limit {
+		log.Info("change the bandwidth limit", zap.Int64("bytes per second", limit))
+		s.limit = limit
+		s.limiter = nil
+		if limit > 0 {
+			s.limiter = rate.NewLimiter(rate.Limit(limit), int(limit))
+		}
+		bandwidthLimitGauge.Set(float64(limit))
+	}
+	return s.limiter, s.limit
+}
+
+// wait blocks until n bytes are allowed by the current limit, the bytes larger than the burst are
+// waited for in several rounds.
+func (s *bandwidthScheduler) wait(ctx context.Context, n int) error {
+	limiter, _ := s.limiterAt(time.Now())
+	if limiter == nil {
+		return nil
+	}
+
+	beginTime := time.Now()
+	defer func() {
+		bandwidthWaitCounter.Add(time.Since(beginTime).Seconds())
+	}()
+
+	burst := limiter.Burst()
+	for n > 0 {
+		m := n
+		if m > burst {
+			m = burst
+		}
+		if err := limiter.WaitN(ctx, m); err != nil {
+			return errors.Trace(err)
+		}
+		n -= m
+	}
+	return nil
+}
+
+// BandwidthStatus is the schedule of the bandwidth and the limit now.
+type BandwidthStatus struct {
+	BandwidthConfig
+	// Limit is the current limit of the bytes per second, 0 means unlimited.
+	Limit int64 `json:"limit"`
+}
+
+// Bandwidth exposes api to get the schedule of the bandwidth by GET and replace it at runtime by
+// PUT with BandwidthConfig in the body, it isn't saved into the config file.
+func (s *Server) Bandwidth(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	renderJSON := func(resp *util.Response) {
+		if err := rd.JSON(w, http.StatusOK, resp); err != nil {
+			log.Error("Failed to render JSON response", zap.Error(err))
+		}
+	}
+
+	scheduler := s.syncer.bandwidth
+	if r.Method == http.MethodPut {
+		cfg := new(BandwidthConfig)
+		if err := json.NewDecoder(r.Body).Decode(cfg); err != nil {
+			renderJSON(util.ErrCodeResponsef(errorcode.InvalidArgument, "invalid request: %v", err))
+			return
+		}
+		if err := scheduler.set(*cfg); err != nil {
+			renderJSON(util.ErrCodeResponsef(errorcode.InvalidArgument, "invalid bandwidth: %v", err))
+			return
+		}
+		log.Info("change the bandwidth by HTTP", zap.Reflect("bandwidth", cfg))
+	}
+
+	_, limit := scheduler.limiterAt(time.Now())
+	renderJSON(util.SuccessResponse("success", &BandwidthStatus{
+		BandwidthConfig: scheduler.config(),
+		Limit:           limit,
+	}))
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+)
+
+type bandwidthSuite struct{}
+
+var _ = Suite(&bandwidthSuite{})
+
+func (s *bandwidthSuite) TestValidate(c *C) {
+	c.Assert((&BandwidthConfig{}).validate(), IsNil)
+	c.Assert((&BandwidthConfig{BytesPerSecond: -1}).validate(), ErrorMatches, ".*must not be negative.*")
+
+	tests := []struct {
+		window BandwidthWindow
+		err    string
+	}{
+		{BandwidthWindow{Start: "09:00", End: "18:00", BytesPerSecond: 1024}, ""},
+		{BandwidthWindow{Start: "22:00", End: "06:30"}, ""},
+		{BandwidthWindow{Start: "9am", End: "18:00"}, ".*invalid start of bandwidth window.*"},
+		{BandwidthWindow{Start: "09:00", End: "24:00"}, ".*invalid end of bandwidth window.*"},
+		{BandwidthWindow{Start: "09:00", End: "09:00"}, ".*is empty.*"},
+		{BandwidthWindow{Start: "09:00", End: "18:00", BytesPerSecond: -1}, ".*must not be negative.*"},
+	}
+	for _, test := range tests {
+		err := (&BandwidthConfig{Windows: []BandwidthWindow{test.window}}).validate()
+		if len(test.err) == 0 {
+			c.Assert(err, IsNil)
+		} else {
+			c.Assert(err, ErrorMatches, test.err, Commentf("window: %+v", test.window))
+		}
+	}
+}
+
+func (s *bandwidthSuite) TestLimitAt(c *C) {
+	scheduler, err := newBandwidthScheduler(&BandwidthConfig{
+		BytesPerSecond: 100,
+		Windows: []BandwidthWindow{
+			{Start: "09:00", End: "18:00", BytesPerSecond: 10},
+			{Start: "12:00", End: "13:00", BytesPerSecond: 50},
+			{Start: "22:00", End: "06:00"},
+		},
+	})
+	c.Assert(err, IsNil)
+	scheduler.location = time.UTC
+
+	at := func(clock string) time.Time {
+		t, err := time.Parse("15:04", clock)
+		c.Assert(err, IsNil)
+		return time.Date(2021, 5, 1, t.Hour(), t.Minute(), 0, 0, time.UTC)
+	}
+	tests := []struct {
+		clock string
+		limit int64
+	}{
+		{"08:59", 100},
+		{"09:00", 10},
+		{"12:30", 10},
+		{"17:59", 10},
+		{"18:00", 100},
+		{"22:00", 0},
+		{"00:00", 0},
+		{"05:59", 0},
+		{"06:00", 100},
+	}
+	for _, test := range tests {
+		limiter, limit := scheduler.limiterAt(at(test.clock))
+		c.Assert(limit, Equals, test.limit, Commentf("clock: %s", test.clock))
+		c.Assert(limiter == nil, Equals, test.limit == 0)
+	}
+
+	c.Assert(scheduler.set(BandwidthConfig{Windows: []BandwidthWindow{{Start: "09:00", End: "18:00", BytesPerSecond: 20}}}), IsNil)
+	_, limit := scheduler.limiterAt(at("10:00"))
+	c.Assert(limit, Equals, int64(20))
+	_, limit = scheduler.limiterAt(at("20:00"))
+	c.Assert(limit, Equals, int64(0))
+
+	c.Assert(scheduler.set(BandwidthConfig{BytesPerSecond: -1}), NotNil)
+	c.Assert(scheduler.config().Windows, HasLen, 1)
+}
+
+func (s *bandwidthSuite) TestWait(c *C) {
+	scheduler, err := newBandwidthScheduler(nil)
+	c.Assert(err, IsNil)
+	c.Assert(scheduler.wait(context.Background(), 1<<30), IsNil)
+
+	c.Assert(scheduler.set(BandwidthConfig{BytesPerSecond: 1000}), IsNil)
+	beginTime := time.Now()
+	// the burst of one second is allowed at once.
+	c.Assert(scheduler.wait(context.Background(), 1000), IsNil)
+	c.Assert(scheduler.wait(context.Background(), 200), IsNil)
+	c.Assert(time.Since(beginTime) > 150*time.Millisecond, IsTrue)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(scheduler.wait(ctx, 5000), NotNil)
+}
+
+func (s *bandwidthSuite) TestBandwidth(c *C) {
+	scheduler, err := newBandwidthScheduler(&BandwidthConfig{BytesPerSecond: 1024})
+	c.Assert(err, IsNil)
+	server := &Server{cfg: NewConfig(), syncer: &Syncer{bandwidth: scheduler}}
+	router := server.initAPIRouter()
+
+	request := func(method string, body string) *BandwidthStatus {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "/syncer/bandwidth", strings.NewReader(body)))
+		var resp struct {
+			Code      int              `json:"code"`
+			ErrorCode errorcode.Code   `json:"error_code"`
+			Data      *BandwidthStatus `json:"data"`
+		}
+		c.Assert(json.Unmarshal(w.Body.Bytes(), &resp), IsNil)
+		if resp.Code != 200 {
+			c.Assert(resp.ErrorCode, Equals, errorcode.InvalidArgument)
+			return nil
+		}
+		return resp.Data
+	}
+
+	status := request("GET", "")
+	c.Assert(status.BytesPerSecond, Equals, int64(1024))
+	c.Assert(status.Limit, Equals, int64(1024))
+
+	// an empty window is rejected, the whole day is covered by two windows.
+	status = request("PUT", `{"bytes-per-second": 1024, "windows": [{"start": "00:00", "end": "00:00", "bytes-per-second": 10}]}`)
+	c.Assert(status, IsNil)
+	status = request("PUT", `{"bytes-per-second": 1024, "windows": [{"start": "00:00", "end": "23:59", "bytes-per-second": 0}, {"start": "23:59", "end": "00:00", "bytes-per-second": 0}]}`)
+	c.Assert(status.Windows, HasLen, 2)
+	c.Assert(status.Limit, Equals, int64(0))
+	c.Assert(request("PUT", `{`), IsNil)
+	c.Assert(scheduler.config().Windows, HasLen, 2)
+}
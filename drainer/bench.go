@@ -0,0 +1,193 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"database/sql"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb-binlog/reparo/syncer"
+	"go.uber.org/zap"
+)
+
+// BenchReport is the result of replaying the binlogs in the pb files.
+type BenchReport struct {
+	Txns     int           `json:"txns"`
+	DMLs     int           `json:"dmls"`
+	DDLs     int           `json:"ddls"`
+	Duration time.Duration `json:"duration"`
+
+	TxnsPerSecond float64 `json:"txns-per-second"`
+	DMLsPerSecond float64 `json:"dmls-per-second"`
+
+	// the latency of the txns from being sent to loader until executed.
+	LatencyP50 time.Duration `json:"latency-p50"`
+	LatencyP90 time.Duration `json:"latency-p90"`
+	LatencyP99 time.Duration `json:"latency-p99"`
+	LatencyMax time.Duration `json:"latency-max"`
+}
+
+var benchCreateDB = loader.CreateDBWithSQLMode
+
+// RunBench replays the binlogs in the pb files of cfg.BenchFromDir to the
+// downstream MySQL or TiDB with the loader configured as the syncer, like
+// worker-count and txn-batch, then reports the throughput and latency.
+func RunBench(cfg *Config) (*BenchReport, error) {
+	syncerCfg := cfg.SyncerCfg
+	if syncerCfg.DestDBType != "mysql" && syncerCfg.DestDBType != "tidb" {
+		return nil, errors.Errorf("bench is only supported when db-type is mysql or tidb, but got %s", syncerCfg.DestDBType)
+	}
+
+	db, err := benchCreateDB(syncerCfg.To.User, syncerCfg.To.Password, syncerCfg.To.Host, syncerCfg.To.Port, syncerCfg.To.TLS, syncerCfg.downstreamSQLMode(), syncerCfg.To.Params)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer db.Close()
+
+	return runBench(db, cfg)
+}
+
+func runBench(db *sql.DB, cfg *Config) (*BenchReport, error) {
+	syncerCfg := cfg.SyncerCfg
+	ld, err := dsync.CreateLoader(db, syncerCfg.To, syncerCfg.WorkerCount, syncerCfg.TxnBatch, nil,
+		syncerCfg.downstreamSQLMode(), syncerCfg.DestDBType, nil, syncerCfg.EnableDispatch(), syncerCfg.EnableCausality())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	ld.SetSafeMode(syncerCfg.SafeMode)
+
+	report := new(BenchReport)
+	var latencies []time.Duration
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for txn := range ld.Successes() {
+			latencies = append(latencies, time.Since(txn.Metadata.(time.Time)))
+		}
+	}()
+
+	loaderErr := make(chan error, 1)
+	go func() {
+		loaderErr <- ld.Run()
+	}()
+
+	start := time.Now()
+	err = readPBFiles(cfg.BenchFromDir, func(binlog *pb.Binlog) error {
+		txn, err := syncer.PBBinlogToTxn(binlog)
+		if err != nil {
+			return errors.Annotatef(err, "translate binlog of commit ts %d", binlog.CommitTs)
+		}
+		if txn.DDL != nil {
+			report.DDLs++
+		}
+		report.DMLs += len(txn.DMLs)
+
+		txn.Metadata = time.Now()
+		select {
+		case ld.Input() <- txn:
+			report.Txns++
+			return nil
+		case err := <-loaderErr:
+			loaderErr <- err
+			return errors.Annotate(err, "loader quits")
+		}
+	})
+	ld.Close()
+	if runErr := <-loaderErr; err == nil {
+		err = runErr
+	}
+	wg.Wait()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	report.Duration = time.Since(start)
+	report.TxnsPerSecond = float64(report.Txns) / report.Duration.Seconds()
+	report.DMLsPerSecond = float64(report.DMLs) / report.Duration.Seconds()
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	report.LatencyP50 = percentile(latencies, 0.5)
+	report.LatencyP90 = percentile(latencies, 0.9)
+	report.LatencyP99 = percentile(latencies, 0.99)
+	report.LatencyMax = percentile(latencies, 1)
+	return report, nil
+}
+
+// percentile returns the p percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// readPBFiles reads the binlogs in the pb files of the directory in order.
+func readPBFiles(dir string, fn func(*pb.Binlog) error) error {
+	names, err := binlogfile.ReadBinlogNames(dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, name := range names {
+		log.Info("replay binlog file", zap.String("file", name))
+		if err = readPBFile(path.Join(dir, name), fn); err != nil {
+			return errors.Annotatef(err, "read binlog file %s", name)
+		}
+	}
+	return nil
+}
+
+func readPBFile(file string, fn func(*pb.Binlog) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+
+	decoder := binlogfile.NewDecoder(f, 0)
+	for {
+		payload, _, err := decoder.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		binlog := new(pb.Binlog)
+		if err = binlog.Unmarshal(payload); err != nil {
+			return errors.Trace(err)
+		}
+		if err = fn(binlog); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
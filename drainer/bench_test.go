@@ -16,7 +16,11 @@ package drainer
 import (
 	"strconv"
 	"testing"
+	"time"
 
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	pbbinlog "github.com/pingcap/tidb-binlog/proto/binlog"
 	pb "github.com/pingcap/tipb/go-binlog"
 )
 
@@ -92,3 +96,43 @@ func CreateMerger(sourceNum int, binlogNum int, strategy string) *Merger {
 
 	return merger
 }
+
+var _ = Suite(&benchSuite{})
+
+type benchSuite struct{}
+
+func (s *benchSuite) TestReadPBFiles(c *C) {
+	dir := c.MkDir()
+	// rotate after each binlog is written.
+	binlogger, err := binlogfile.OpenBinlogger(dir, 1)
+	c.Assert(err, IsNil)
+	for ts := int64(1); ts <= 3; ts++ {
+		data, err := (&pbbinlog.Binlog{CommitTs: ts}).Marshal()
+		c.Assert(err, IsNil)
+		_, err = binlogger.WriteTail(&pb.Entity{Payload: data})
+		c.Assert(err, IsNil)
+	}
+	c.Assert(binlogger.Close(), IsNil)
+
+	var tss []int64
+	err = readPBFiles(dir, func(binlog *pbbinlog.Binlog) error {
+		tss = append(tss, binlog.CommitTs)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(tss, DeepEquals, []int64{1, 2, 3})
+
+	_, err = RunBench(&Config{BenchFromDir: dir, SyncerCfg: &SyncerConfig{DestDBType: "kafka"}})
+	c.Assert(err, ErrorMatches, "bench is only supported when db-type is mysql or tidb, but got kafka")
+}
+
+func (s *benchSuite) TestPercentile(c *C) {
+	var latencies []time.Duration
+	c.Assert(percentile(latencies, 0.5), Equals, time.Duration(0))
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	c.Assert(percentile(latencies, 0.5), Equals, 50*time.Millisecond)
+	c.Assert(percentile(latencies, 0.99), Equals, 99*time.Millisecond)
+	c.Assert(percentile(latencies, 1), Equals, 100*time.Millisecond)
+}
@@ -24,6 +24,14 @@ type binlogItem struct {
 	binlog *pb.Binlog
 	nodeID string
 	job    *model.Job
+
+	// mem is the tracker accounting the size of the binlog, queued is whether it's admitted to syncer.
+	mem    *memoryTracker
+	size   int64
+	queued bool
+
+	// payloadHash is the hash of the binlog received from pump, zero if it's not received from pump.
+	payloadHash uint64
 }
 
 // GetCommitTs implements Item interface in merger.go
@@ -36,6 +44,11 @@ func (b *binlogItem) GetSourceID() string {
 	return b.nodeID
 }
 
+// fingerprint implements fingerprinter interface in merger.go
+func (b *binlogItem) fingerprint() itemFingerprint {
+	return itemFingerprint{startTS: b.binlog.StartTs, commitTS: b.binlog.CommitTs, hash: b.payloadHash}
+}
+
 // String returns the string of this binlogItem
 func (b *binlogItem) String() string {
 	return fmt.Sprintf("{startTS: %d, commitTS: %d, node: %s}", b.binlog.StartTs, b.binlog.CommitTs, b.nodeID)
@@ -54,3 +67,11 @@ func newBinlogItem(b *pb.Binlog, nodeID string) *binlogItem {
 func (b *binlogItem) SetJob(job *model.Job) {
 	b.job = job
 }
+
+// releaseMemory frees the memory of the binlog accounted by the tracker, it's safe to call more than once.
+func (b *binlogItem) releaseMemory() {
+	if b.mem != nil {
+		b.mem.release(b)
+		b.mem = nil
+	}
+}
@@ -14,6 +14,9 @@
 package checkpoint
 
 import (
+	"sort"
+	"strings"
+
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"go.uber.org/zap"
@@ -42,24 +45,90 @@ type CheckPoint interface {
 	// IsConsistent return the Consistent status saved.
 	IsConsistent() bool
 
+	// SafeModeUntilTS returns the commit timestamp until which drainer should keep safe mode,
+	// it's set when the checkpoint is rewound and cleared once the checkpoint reaches it.
+	SafeModeUntilTS() int64
+
 	// Close closes the CheckPoint and release resources, after closed other methods should not be called again.
 	Close() error
 }
 
+// safeModeSetter is implemented by the checkpoints whose safe mode ts can be set, the ts and
+// the schema version are saved with the next Save.
+type safeModeSetter interface {
+	setSafeMode(safeModeTS int64, version int64)
+}
+
+// Rewind sets the checkpoint backward to ts with the schema version at ts, the
+// binlogs after ts are synced again with safe mode until the checkpoint reaches
+// the timestamp before rewinding.
+func Rewind(cp CheckPoint, ts int64, version int64) error {
+	if ts >= cp.TS() {
+		return errors.Errorf("can't rewind checkpoint %d forward to %d", cp.TS(), ts)
+	}
+
+	sp, ok := cp.(safeModeSetter)
+	if !ok {
+		return errors.NotSupportedf("rewinding checkpoint %T", cp)
+	}
+	safeModeTS := cp.SafeModeUntilTS()
+	if cp.TS() > safeModeTS {
+		safeModeTS = cp.TS()
+	}
+	sp.setSafeMode(safeModeTS, version)
+
+	return errors.Trace(cp.Save(ts, 0, true /*consistent*/, version))
+}
+
+// Copy saves the checkpoint from into to with the safe mode ts, it migrates the checkpoint
+// from one type of CheckPoint to another.
+func Copy(from CheckPoint, to CheckPoint) error {
+	sp, ok := to.(safeModeSetter)
+	if !ok {
+		return errors.NotSupportedf("copying checkpoint to %T", to)
+	}
+	sp.setSafeMode(from.SafeModeUntilTS(), from.SchemaVersion())
+
+	return errors.Trace(to.Save(from.TS(), 0, from.IsConsistent(), from.SchemaVersion()))
+}
+
+// Factory creates a CheckPoint by the config.
+type Factory func(cfg *Config) (CheckPoint, error)
+
+var factories = make(map[string]Factory)
+
+// Register makes the type of CheckPoint created by the factory with NewCheckPoint,
+// it panics if the type is registered twice.
+func Register(tp string, factory Factory) {
+	if _, ok := factories[tp]; ok {
+		panic("checkpoint type " + tp + " is registered twice")
+	}
+	factories[tp] = factory
+}
+
+// IsRegistered returns true if the type of CheckPoint is registered.
+func IsRegistered(tp string) bool {
+	_, ok := factories[tp]
+	return ok
+}
+
+// Types returns the registered types of CheckPoint in order.
+func Types() []string {
+	types := make([]string, 0, len(factories))
+	for tp := range factories {
+		types = append(types, tp)
+	}
+	sort.Strings(types)
+	return types
+}
+
 // NewCheckPoint returns a CheckPoint instance by giving name
 func NewCheckPoint(cfg *Config) (CheckPoint, error) {
-	var (
-		cp  CheckPoint
-		err error
-	)
-	switch cfg.CheckpointType {
-	case "mysql", "tidb":
-		cp, err = newMysql(cfg)
-	case "file":
-		cp, err = NewFile(cfg.InitialCommitTS, cfg.CheckPointFile)
-	default:
-		err = errors.Errorf("unsupported checkpoint type %s", cfg.CheckpointType)
+	factory, ok := factories[cfg.CheckpointType]
+	if !ok {
+		return nil, errors.Errorf("unsupported checkpoint type %s, must be one of %s", cfg.CheckpointType, strings.Join(Types(), ", "))
 	}
+	cp, err := factory(cfg)
 	if err != nil {
 		return nil, errors.Annotatef(err, "initialize %s type checkpoint with config %+v", cfg.CheckpointType, cfg)
 	}
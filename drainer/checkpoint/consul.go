@@ -0,0 +1,172 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+)
+
+const consulTimeout = 10 * time.Second
+
+// ConsulConfig is the key of the KV store of consul the checkpoint is saved in.
+type ConsulConfig struct {
+	// Addr is the HTTP address of the consul agent, like "http://127.0.0.1:8500".
+	Addr string `toml:"addr" json:"addr"`
+	// Key is the key of the checkpoint, "tidb-binlog/checkpoint/{cluster id}" by default.
+	Key string `toml:"key" json:"key"`
+	// Token is the ACL token of consul, if any.
+	Token string      `toml:"token" json:"token"`
+	TLS   *tls.Config `toml:"-" json:"-"`
+}
+
+func init() {
+	Register("consul", newConsul)
+}
+
+func newConsul(cfg *Config) (CheckPoint, error) {
+	if cfg.Consul == nil || len(cfg.Consul.Addr) == 0 {
+		return nil, errors.New("addr of consul is not set")
+	}
+	key := cfg.Consul.Key
+	if len(key) == 0 {
+		key = fmt.Sprintf("tidb-binlog/checkpoint/%d", cfg.ClusterID)
+	}
+	addr := strings.TrimSuffix(cfg.Consul.Addr, "/")
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	client := &http.Client{Timeout: consulTimeout}
+	if cfg.Consul.TLS != nil {
+		client.Transport = &http.Transport{TLSClientConfig: cfg.Consul.TLS}
+	}
+	return newFileCheckPoint(cfg.InitialCommitTS, &consulStore{
+		client: client,
+		addr:   addr,
+		key:    strings.Trim(key, "/"),
+		token:  cfg.Consul.Token,
+	})
+}
+
+// consulStore keeps the checkpoint in a key of consul. The key is written by check-and-set with the
+// index of the last read or write, so a drainer fails to save the checkpoint after another one
+// saved it, like when two drainers are misconfigured to sync the same cluster.
+type consulStore struct {
+	client *http.Client
+	addr   string
+	key    string
+	token  string
+	// index is the ModifyIndex of the key, zero if it doesn't exist.
+	index uint64
+}
+
+// consulKV is an entry of the KV store of consul.
+type consulKV struct {
+	Verb        string `json:",omitempty"`
+	Key         string
+	Value       []byte
+	Index       uint64 `json:",omitempty"`
+	ModifyIndex uint64 `json:",omitempty"`
+}
+
+func (s *consulStore) do(method string, path string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequest(method, s.addr+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, errors.Trace(err)
+	}
+	if len(s.token) > 0 {
+		req.Header.Set("X-Consul-Token", s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, nil, errors.Annotatef(err, "request consul %s failed", s.addr)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, data, errors.Trace(err)
+}
+
+func (s *consulStore) read() ([]byte, error) {
+	code, data, err := s.do(http.MethodGet, "/v1/kv/"+s.key, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	switch code {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		s.index = 0
+		return nil, nil
+	default:
+		return nil, errors.Errorf("read key %s from consul failed, status: %d, %s", s.key, code, data)
+	}
+
+	var kvs []consulKV
+	if err = json.Unmarshal(data, &kvs); err != nil {
+		return nil, errors.Annotatef(err, "decode key %s of consul failed", s.key)
+	}
+	if len(kvs) == 0 {
+		s.index = 0
+		return nil, nil
+	}
+	s.index = kvs[0].ModifyIndex
+	return kvs[0].Value, nil
+}
+
+func (s *consulStore) write(data []byte) error {
+	// the check-and-set of the txn API returns the new index, which the plain PUT doesn't.
+	ops := []map[string]consulKV{{"KV": {Verb: "cas", Key: s.key, Value: data, Index: s.index}}}
+	body, err := json.Marshal(ops)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	code, resp, err := s.do(http.MethodPut, "/v1/txn", body)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch code {
+	case http.StatusOK:
+	case http.StatusConflict:
+		return errorcode.Newf(errorcode.DrainerCheckpointConflict,
+			"checkpoint in key %s of consul is modified by others since index %d", s.key, s.index)
+	default:
+		return errors.Errorf("write key %s to consul failed, status: %d, %s", s.key, code, resp)
+	}
+
+	var result struct {
+		Results []map[string]consulKV
+	}
+	if err = json.Unmarshal(resp, &result); err != nil {
+		return errors.Annotatef(err, "decode result of writing key %s to consul failed", s.key)
+	}
+	if len(result.Results) == 0 {
+		return errors.Errorf("no result of writing key %s to consul", s.key)
+	}
+	s.index = result.Results[0]["KV"].ModifyIndex
+	return nil
+}
+
+func (s *consulStore) close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	. "github.com/pingcap/check"
+)
+
+// fakeConsul serves the KV read and the check-and-set txn of consul on a single key.
+type fakeConsul struct {
+	sync.Mutex
+	key   string
+	value []byte
+	index uint64
+	token string
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if r.Header.Get("X-Consul-Token") != f.token {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/kv/"+f.key:
+		if f.index == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode([]consulKV{{Key: f.key, Value: f.value, ModifyIndex: f.index}})
+	case r.Method == http.MethodPut && r.URL.Path == "/v1/txn":
+		var ops []map[string]consulKV
+		if err := json.NewDecoder(r.Body).Decode(&ops); err != nil || len(ops) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		kv := ops[0]["KV"]
+		if kv.Verb != "cas" || kv.Key != f.key || kv.Index != f.index {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.index += 10
+		f.value = kv.Value
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Results": []map[string]consulKV{{"KV": {Key: f.key, ModifyIndex: f.index}}},
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (t *testCheckPointSuite) TestConsul(c *C) {
+	consul := &fakeConsul{key: "tidb-binlog/checkpoint/42", token: "secret"}
+	server := httptest.NewServer(consul)
+	defer server.Close()
+
+	cfg := &Config{
+		CheckpointType:  "consul",
+		ClusterID:       42,
+		InitialCommitTS: 10,
+		Consul:          &ConsulConfig{Addr: strings.TrimPrefix(server.URL, "http://"), Token: "secret"},
+	}
+	cp, err := NewCheckPoint(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(cp.TS(), Equals, int64(10))
+	c.Assert(cp.Save(1000, 0, true, 5), IsNil)
+	c.Assert(cp.Save(2000, 0, true, 6), IsNil)
+	c.Assert(consul.index, Equals, uint64(20))
+
+	other, err := NewCheckPoint(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(other.TS(), Equals, int64(2000))
+	c.Assert(other.SchemaVersion(), Equals, int64(6))
+	c.Assert(other.IsConsistent(), IsTrue)
+
+	// the checkpoint saved by others since the last read fails to be saved.
+	c.Assert(other.Save(3000, 0, true, 6), IsNil)
+	c.Assert(cp.Save(2500, 0, true, 6), ErrorMatches, ".*modified by others since index 20.*")
+	c.Assert(cp.Load(), IsNil)
+	c.Assert(cp.TS(), Equals, int64(3000))
+	c.Assert(cp.Close(), IsNil)
+
+	cfg.Consul.Token = "guess"
+	_, err = NewCheckPoint(cfg)
+	c.Assert(err, ErrorMatches, ".*read key tidb-binlog/checkpoint/42 from consul failed, status: 403.*")
+
+	cfg.Consul = nil
+	_, err = NewCheckPoint(cfg)
+	c.Assert(err, ErrorMatches, ".*addr of consul is not set")
+}
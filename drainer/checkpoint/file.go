@@ -16,6 +16,7 @@ package checkpoint
 import (
 	"bytes"
 	"os"
+	"path/filepath"
 	"sync"
 
 	"github.com/BurntSushi/toml"
@@ -23,24 +24,112 @@ import (
 	"github.com/pingcap/tidb-binlog/pkg/util"
 )
 
-// FileCheckPoint is local CheckPoint struct.
+func init() {
+	Register("file", func(cfg *Config) (CheckPoint, error) {
+		return NewFile(cfg.InitialCommitTS, cfg.CheckPointFile)
+	})
+	Register("file-sync", func(cfg *Config) (CheckPoint, error) {
+		return newFileCheckPoint(cfg.InitialCommitTS, &fileStore{name: cfg.CheckPointFile, sync: true})
+	})
+}
+
+// blobStore keeps the checkpoint encoded as a whole, like in a file or a key of consul.
+type blobStore interface {
+	// read returns nil if the checkpoint is never written.
+	read() ([]byte, error)
+	write(data []byte) error
+	close() error
+}
+
+// fileStore keeps the checkpoint in a file, the file is replaced atomically. If sync is set, the
+// data and the rename are flushed by fsync before a write returns, so the checkpoint survives the
+// crash of the machine, like when the file is on NFS shared by the standby drainer.
+type fileStore struct {
+	name string
+	sync bool
+}
+
+func (s *fileStore) read() ([]byte, error) {
+	data, err := os.ReadFile(s.name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, errors.Trace(err)
+}
+
+func (s *fileStore) write(data []byte) error {
+	if !s.sync {
+		return errors.Annotatef(util.WriteFileAtomic(s.name, data, 0644), "write file %s failed", s.name)
+	}
+	return errors.Annotatef(writeFileSync(s.name, data, 0644), "write file %s failed", s.name)
+}
+
+func (s *fileStore) close() error {
+	return nil
+}
+
+// writeFileSync replaces the file with data atomically like util.WriteFileAtomic, and flushes the file
+// and its directory by fsync so the new content is durable once it returns.
+func writeFileSync(filename string, data []byte, perm os.FileMode) error {
+	dir, name := filepath.Split(filename)
+	if len(dir) == 0 {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return errors.Trace(err)
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer d.Close()
+	return errors.Trace(d.Sync())
+}
+
+// FileCheckPoint is the CheckPoint encoded in TOML, it's kept in a local file by default, or in a
+// file flushed by fsync, or in a key of consul.
 type FileCheckPoint struct {
 	sync.RWMutex
 	closed          bool
 	initialCommitTS int64
 
-	name string
+	store blobStore
 
 	ConsistentSaved bool  `toml:"consistent" json:"consistent"`
 	CommitTS        int64 `toml:"commitTS" json:"commitTS"`
 	Version         int64 `toml:"schema-version" json:"schema-version"`
+	SafeModeTS      int64 `toml:"safe-mode-until-ts,omitempty" json:"safe-mode-until-ts,omitempty"`
 }
 
 // NewFile creates a new FileCheckpoint.
 func NewFile(initialCommitTS int64, filePath string) (CheckPoint, error) {
+	return newFileCheckPoint(initialCommitTS, &fileStore{name: filePath})
+}
+
+func newFileCheckPoint(initialCommitTS int64, store blobStore) (CheckPoint, error) {
 	pb := &FileCheckPoint{
 		initialCommitTS: initialCommitTS,
-		name:            filePath,
+		store:           store,
 	}
 	err := pb.Load()
 	if err != nil {
@@ -65,16 +154,15 @@ func (sp *FileCheckPoint) Load() error {
 		}
 	}()
 
-	file, err := os.Open(sp.name)
-	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+	data, err := sp.store.read()
+	if err != nil {
 		return errors.Trace(err)
 	}
-	if os.IsNotExist(errors.Cause(err)) {
+	if data == nil {
 		return nil
 	}
-	defer file.Close()
 
-	_, err = toml.DecodeReader(file, sp)
+	_, err = toml.Decode(string(data), sp)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -93,6 +181,9 @@ func (sp *FileCheckPoint) Save(ts, secondaryTS int64, consistent bool, version i
 
 	sp.CommitTS = ts
 	sp.ConsistentSaved = consistent
+	if sp.SafeModeTS > 0 && ts >= sp.SafeModeTS {
+		sp.SafeModeTS = 0
+	}
 	if version > sp.Version {
 		sp.Version = version
 	}
@@ -104,12 +195,7 @@ func (sp *FileCheckPoint) Save(ts, secondaryTS int64, consistent bool, version i
 		return errors.Annotate(err, "encode checkpoint failed")
 	}
 
-	err = util.WriteFileAtomic(sp.name, buf.Bytes(), 0644)
-	if err != nil {
-		return errors.Annotatef(err, "write file %s failed", sp.name)
-	}
-
-	return nil
+	return errors.Trace(sp.store.write(buf.Bytes()))
 }
 
 // TS implements CheckPoint.TS interface
@@ -136,6 +222,22 @@ func (sp *FileCheckPoint) IsConsistent() bool {
 	return sp.ConsistentSaved
 }
 
+// SafeModeUntilTS implements CheckPoint.SafeModeUntilTS interface.
+func (sp *FileCheckPoint) SafeModeUntilTS() int64 {
+	sp.RLock()
+	defer sp.RUnlock()
+
+	return sp.SafeModeTS
+}
+
+func (sp *FileCheckPoint) setSafeMode(safeModeTS int64, version int64) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	sp.SafeModeTS = safeModeTS
+	sp.Version = version
+}
+
 // Close implements CheckPoint.Close interface
 func (sp *FileCheckPoint) Close() error {
 	sp.Lock()
@@ -146,5 +248,5 @@ func (sp *FileCheckPoint) Close() error {
 	}
 
 	sp.closed = true
-	return nil
+	return errors.Trace(sp.store.close())
 }
@@ -73,3 +73,72 @@ func (t *testCheckPointSuite) TestFile(c *C) {
 	c.Assert(errors.Cause(meta.Save(0, 0, true, 0)), Equals, ErrCheckPointClosed)
 	c.Assert(errors.Cause(meta.Close()), Equals, ErrCheckPointClosed)
 }
+
+func (t *testCheckPointSuite) TestRewind(c *C) {
+	fileName := c.MkDir() + "/savepoint"
+	meta, err := NewFile(0, fileName)
+	c.Assert(err, IsNil)
+	c.Assert(meta.Save(1000, 0, false, 10), IsNil)
+
+	c.Assert(Rewind(meta, 1000, 5), ErrorMatches, ".*can't rewind checkpoint 1000 forward to 1000.*")
+
+	c.Assert(Rewind(meta, 500, 5), IsNil)
+	meta, err = NewFile(0, fileName)
+	c.Assert(err, IsNil)
+	c.Assert(meta.TS(), Equals, int64(500))
+	c.Assert(meta.SchemaVersion(), Equals, int64(5))
+	c.Assert(meta.IsConsistent(), IsTrue)
+	c.Assert(meta.SafeModeUntilTS(), Equals, int64(1000))
+
+	// rewinding again keeps the max ts synced before
+	c.Assert(Rewind(meta, 400, 5), IsNil)
+	c.Assert(meta.SafeModeUntilTS(), Equals, int64(1000))
+
+	c.Assert(meta.Save(999, 0, false, 6), IsNil)
+	c.Assert(meta.SafeModeUntilTS(), Equals, int64(1000))
+	c.Assert(meta.Save(1000, 0, false, 6), IsNil)
+	c.Assert(meta.SafeModeUntilTS(), Equals, int64(0))
+}
+
+func (t *testCheckPointSuite) TestFileSync(c *C) {
+	fileName := c.MkDir() + "/savepoint"
+	meta, err := NewCheckPoint(&Config{CheckpointType: "file-sync", CheckPointFile: fileName, InitialCommitTS: 10})
+	c.Assert(err, IsNil)
+	c.Assert(meta.TS(), Equals, int64(10))
+	c.Assert(meta.Save(1000, 0, true, 5), IsNil)
+
+	// the file is readable as the file type.
+	meta, err = NewFile(0, fileName)
+	c.Assert(err, IsNil)
+	c.Assert(meta.TS(), Equals, int64(1000))
+	c.Assert(meta.SchemaVersion(), Equals, int64(5))
+	c.Assert(meta.IsConsistent(), IsTrue)
+}
+
+func (t *testCheckPointSuite) TestCopy(c *C) {
+	from, err := NewFile(0, c.MkDir()+"/savepoint")
+	c.Assert(err, IsNil)
+	c.Assert(from.Save(1000, 0, false, 10), IsNil)
+	c.Assert(Rewind(from, 500, 5), IsNil)
+
+	toFile := c.MkDir() + "/savepoint"
+	to, err := NewCheckPoint(&Config{CheckpointType: "file-sync", CheckPointFile: toFile})
+	c.Assert(err, IsNil)
+	c.Assert(Copy(from, to), IsNil)
+
+	to, err = NewFile(0, toFile)
+	c.Assert(err, IsNil)
+	c.Assert(to.TS(), Equals, int64(500))
+	c.Assert(to.SchemaVersion(), Equals, int64(5))
+	c.Assert(to.IsConsistent(), IsTrue)
+	c.Assert(to.SafeModeUntilTS(), Equals, int64(1000))
+}
+
+func (t *testCheckPointSuite) TestRegistry(c *C) {
+	c.Assert(Types(), DeepEquals, []string{"consul", "file", "file-sync", "mysql", "tidb"})
+	c.Assert(IsRegistered("file-sync"), IsTrue)
+	c.Assert(IsRegistered("etcd"), IsFalse)
+	_, err := NewCheckPoint(&Config{CheckpointType: "etcd"})
+	c.Assert(err, ErrorMatches, "unsupported checkpoint type etcd, must be one of consul, file, file-sync, mysql, tidb")
+	c.Assert(func() { Register("file", nil) }, PanicMatches, "checkpoint type file is registered twice")
+}
@@ -26,7 +26,9 @@ import (
 
 	// mysql driver
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
 	"github.com/pingcap/tidb-binlog/pkg/loader"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 )
 
@@ -41,16 +43,28 @@ type MysqlCheckPoint struct {
 	schema string
 	table  string
 
+	// instanceID owns the checkpoint with fencingToken after it's claimed at the first saving,
+	// the saving fails once another instance takes over the checkpoint with a newer token.
+	instanceID    string
+	takeoverAfter time.Duration
+	fencingToken  uint64
+
 	ConsistentSaved bool             `toml:"consistent" json:"consistent"`
 	CommitTS        int64            `toml:"commitTS" json:"commitTS"`
 	TsMap           map[string]int64 `toml:"ts-map" json:"ts-map"`
 	Version         int64            `toml:"schema-version" json:"schema-version"`
+	SafeModeTS      int64            `toml:"safe-mode-until-ts,omitempty" json:"safe-mode-until-ts,omitempty"`
 }
 
 var _ CheckPoint = &MysqlCheckPoint{}
 
 var sqlOpenDB = loader.CreateDB
 
+func init() {
+	Register("mysql", newMysql)
+	Register("tidb", newMysql)
+}
+
 func newMysql(cfg *Config) (CheckPoint, error) {
 	setDefaultConfig(cfg)
 
@@ -69,6 +83,8 @@ func newMysql(cfg *Config) (CheckPoint, error) {
 		initialCommitTS: cfg.InitialCommitTS,
 		schema:          cfg.Schema,
 		table:           cfg.Table,
+		instanceID:      cfg.InstanceID,
+		takeoverAfter:   cfg.TakeoverAfter,
 		TsMap:           make(map[string]int64),
 	}
 
@@ -82,6 +98,13 @@ func newMysql(cfg *Config) (CheckPoint, error) {
 		return nil, errors.Annotatef(err, "exec failed, sql: %s", sql)
 	}
 
+	for _, column := range ownerColumns {
+		sql = genAddColumn(sp, column)
+		if _, err = db.Exec(sql); err != nil && !pkgsql.IgnoreDDLError(err) {
+			return nil, errors.Annotatef(err, "exec failed, sql: %s", sql)
+		}
+	}
+
 	if sp.clusterID == 0 {
 		id, err := getClusterID(db, sp.schema, sp.table)
 		if err != nil {
@@ -140,6 +163,9 @@ func (sp *MysqlCheckPoint) Save(ts, secondaryTS int64, consistent bool, version
 
 	sp.CommitTS = ts
 	sp.ConsistentSaved = consistent
+	if sp.SafeModeTS > 0 && ts >= sp.SafeModeTS {
+		sp.SafeModeTS = 0
+	}
 	if version > sp.Version {
 		sp.Version = version
 	}
@@ -154,14 +180,93 @@ func (sp *MysqlCheckPoint) Save(ts, secondaryTS int64, consistent bool, version
 		return errors.Annotate(err, "json marshal failed")
 	}
 
-	sql := genReplaceSQL(sp, string(b))
-	return util.RetryContext(context.TODO(), 5, time.Second, 1, func(context.Context) error {
-		_, err = sp.db.Exec(sql)
+	if sp.fencingToken == 0 {
+		return errors.Trace(sp.claim(string(b)))
+	}
+
+	sql := genUpdateSQL(sp)
+	var affected int64
+	err = util.RetryContext(context.TODO(), 5, time.Second, 1, func(context.Context) error {
+		res, err := sp.db.Exec(sql, string(b), sp.instanceID, sp.fencingToken)
 		if err != nil {
 			return errors.Annotatef(err, "query sql failed: %s", sql)
 		}
-		return nil
+		affected, err = res.RowsAffected()
+		return errors.Trace(err)
 	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if affected == 0 {
+		return errors.Trace(sp.checkFenced())
+	}
+	return nil
+}
+
+// claim saves the checkpoint as the owner with a new fencing token, it fails if the checkpoint
+// is owned by another instance which saved it in takeoverAfter, which is probably a drainer
+// misconfigured to sync the same cluster to the same downstream.
+func (sp *MysqlCheckPoint) claim(checkpoint string) error {
+	txn, err := sp.db.Begin()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	var (
+		owner string
+		token uint64
+		idle  int64
+	)
+	err = txn.QueryRow(genSelectOwnerSQL(sp)+" for update").Scan(&owner, &token, &idle)
+	switch {
+	case err == sql.ErrNoRows:
+		token = 1
+		_, err = txn.Exec(genInsertSQL(sp), checkpoint, sp.instanceID, token)
+	case err != nil:
+	case len(owner) > 0 && owner != sp.instanceID && time.Duration(idle)*time.Second < sp.takeoverAfter:
+		err = errorcode.Newf(errorcode.DrainerCheckpointConflict,
+			"checkpoint of cluster %d is owned by drainer %s which saved it %ds ago, %s can't take it over in %s",
+			sp.clusterID, owner, idle, sp.instanceID, sp.takeoverAfter)
+	default:
+		token++
+		_, err = txn.Exec(genClaimSQL(sp), checkpoint, sp.instanceID, token)
+	}
+	if err != nil {
+		if rerr := txn.Rollback(); rerr != nil {
+			log.Error("rollback failed", zap.Error(rerr))
+		}
+		return errors.Trace(err)
+	}
+	if err = txn.Commit(); err != nil {
+		return errors.Trace(err)
+	}
+
+	log.Info("claim checkpoint", zap.String("instance", sp.instanceID), zap.Uint64("fencing token", token),
+		zap.String("previous owner", owner))
+	sp.fencingToken = token
+	return nil
+}
+
+// checkFenced is called when the saving updates no row, which is fine if the row is unchanged.
+func (sp *MysqlCheckPoint) checkFenced() error {
+	var (
+		owner string
+		token uint64
+		idle  int64
+	)
+	err := sp.db.QueryRow(genSelectOwnerSQL(sp)).Scan(&owner, &token, &idle)
+	switch {
+	case err == sql.ErrNoRows:
+		return errorcode.Newf(errorcode.DrainerCheckpointConflict, "checkpoint of cluster %d is deleted", sp.clusterID)
+	case err != nil:
+		return errors.Trace(err)
+	case owner != sp.instanceID || token != sp.fencingToken:
+		return errorcode.Newf(errorcode.DrainerCheckpointConflict,
+			"checkpoint of cluster %d is taken over by drainer %s with fencing token %d, the token of %s is %d",
+			sp.clusterID, owner, token, sp.instanceID, sp.fencingToken)
+	default:
+		return nil
+	}
 }
 
 // IsConsistent implements CheckPoint interface
@@ -188,6 +293,22 @@ func (sp *MysqlCheckPoint) SchemaVersion() int64 {
 	return sp.Version
 }
 
+// SafeModeUntilTS implements CheckPoint.SafeModeUntilTS interface.
+func (sp *MysqlCheckPoint) SafeModeUntilTS() int64 {
+	sp.RLock()
+	defer sp.RUnlock()
+
+	return sp.SafeModeTS
+}
+
+func (sp *MysqlCheckPoint) setSafeMode(safeModeTS int64, version int64) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	sp.SafeModeTS = safeModeTS
+	sp.Version = version
+}
+
 // Close implements CheckPoint.Close interface
 func (sp *MysqlCheckPoint) Close() error {
 	sp.Lock()
@@ -17,10 +17,12 @@ import (
 	"crypto/tls"
 	"database/sql"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
 )
 
 func TestClient(t *testing.T) {
@@ -48,21 +50,69 @@ var _ = Suite(&saveSuite{})
 func (s *saveSuite) TestShouldSaveCheckpoint(c *C) {
 	db, mock, err := sqlmock.New()
 	c.Assert(err, IsNil)
-	mock.ExpectExec("replace into db.tbl.*").WillReturnResult(sqlmock.NewResult(0, 0))
-	cp := MysqlCheckPoint{db: db, schema: "db", table: "tbl"}
+	mock.ExpectExec("update db.tbl set checkPoint.*").WithArgs(sqlmock.AnyArg(), "d1", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	cp := MysqlCheckPoint{db: db, schema: "db", table: "tbl", instanceID: "d1", fencingToken: 1}
 	err = cp.Save(1111, 0, false, 0)
 	c.Assert(err, IsNil)
 }
 
+func (s *saveSuite) ownerRows(owner string, token uint64, idle int64) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"instance", "fencingToken", "idle"}).AddRow(owner, token, idle)
+}
+
+func (s *saveSuite) TestShouldClaimCheckpoint(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	cp := MysqlCheckPoint{db: db, schema: "db", table: "tbl", clusterID: 1, instanceID: "d1", takeoverAfter: time.Minute}
+
+	// the first drainer inserts the row.
+	mock.ExpectBegin()
+	mock.ExpectQuery("select instance, fencingToken.* for update").WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec("insert into db.tbl.*").WithArgs(sqlmock.AnyArg(), "d1", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(cp.Save(1111, 0, false, 0), IsNil)
+	c.Assert(cp.fencingToken, Equals, uint64(1))
+
+	// the row unchanged is not fenced.
+	mock.ExpectExec("update db.tbl set checkPoint.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select instance, fencingToken.*").WillReturnRows(s.ownerRows("d1", 1, 0))
+	c.Assert(cp.Save(1111, 0, false, 0), IsNil)
+
+	// another drainer can't take over it until it's not saved for a minute.
+	cp2 := MysqlCheckPoint{db: db, schema: "db", table: "tbl", clusterID: 1, instanceID: "d2", takeoverAfter: time.Minute}
+	mock.ExpectBegin()
+	mock.ExpectQuery("select instance, fencingToken.* for update").WillReturnRows(s.ownerRows("d1", 1, 10))
+	mock.ExpectRollback()
+	err = cp2.Save(1112, 0, false, 0)
+	c.Assert(errorcode.CodeOf(err), Equals, errorcode.DrainerCheckpointConflict)
+	c.Assert(err, ErrorMatches, ".*owned by drainer d1.*")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("select instance, fencingToken.* for update").WillReturnRows(s.ownerRows("d1", 1, 60))
+	mock.ExpectExec("update db.tbl set checkPoint = \\?, instance.*").WithArgs(sqlmock.AnyArg(), "d2", 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(cp2.Save(1112, 0, false, 0), IsNil)
+	c.Assert(cp2.fencingToken, Equals, uint64(2))
+
+	// the drainer taken over fails to save.
+	mock.ExpectExec("update db.tbl set checkPoint.*").WithArgs(sqlmock.AnyArg(), "d1", 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select instance, fencingToken.*").WillReturnRows(s.ownerRows("d2", 2, 0))
+	err = cp.Save(1113, 0, false, 0)
+	c.Assert(errorcode.CodeOf(err), Equals, errorcode.DrainerCheckpointConflict)
+	c.Assert(err, ErrorMatches, ".*taken over by drainer d2.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
 func (s *saveSuite) TestShouldUpdateTsMap(c *C) {
 	db, mock, err := sqlmock.New()
 	c.Assert(err, IsNil)
-	mock.ExpectExec(".*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(".*").WillReturnResult(sqlmock.NewResult(0, 1))
 	cp := MysqlCheckPoint{
-		db:     db,
-		schema: "db",
-		table:  "tbl",
-		TsMap:  make(map[string]int64),
+		db:           db,
+		schema:       "db",
+		table:        "tbl",
+		TsMap:        make(map[string]int64),
+		fencingToken: 1,
 	}
 	err = cp.Save(65536, 3333, false, 0)
 	c.Assert(err, IsNil)
@@ -18,10 +18,12 @@ import (
 	"database/sql"
 	stderrors "errors"
 	"fmt"
+	"time"
 
 	// mysql driver
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
 )
 
 // ErrNoCheckpointItem represents there's no any checkpoint item and the cluster id must be specified
@@ -47,9 +49,21 @@ type Config struct {
 
 	ClusterID       uint64
 	InitialCommitTS int64
-	CheckPointFile  string `toml:"dir" json:"dir"`
+	// CheckPointFile is the file of the file and file-sync types.
+	CheckPointFile string `toml:"dir" json:"dir"`
+	// Consul is the key of consul of the consul type.
+	Consul *ConsulConfig
+
+	// InstanceID identifies the drainer owning the mysql checkpoint, another instance
+	// can only take over it after it's not saved for TakeoverAfter.
+	InstanceID    string
+	TakeoverAfter time.Duration
 }
 
+// defaultTakeoverAfter is the default duration after which the checkpoint not saved
+// by its owner can be taken over by another instance.
+const defaultTakeoverAfter = time.Minute
+
 func setDefaultConfig(cfg *Config) {
 	if cfg.Db == nil {
 		cfg.Db = new(DBConfig)
@@ -69,6 +83,9 @@ func setDefaultConfig(cfg *Config) {
 	if cfg.Table == "" {
 		cfg.Table = "checkpoint"
 	}
+	if cfg.TakeoverAfter == 0 {
+		cfg.TakeoverAfter = defaultTakeoverAfter
+	}
 }
 
 func genCreateSchema(sp *MysqlCheckPoint) string {
@@ -76,11 +93,44 @@ func genCreateSchema(sp *MysqlCheckPoint) string {
 }
 
 func genCreateTable(sp *MysqlCheckPoint) string {
-	return fmt.Sprintf("create table if not exists %s.%s(clusterID bigint unsigned primary key, checkPoint MEDIUMTEXT)", sp.schema, sp.table)
+	return fmt.Sprintf("create table if not exists %s.%s(clusterID bigint unsigned primary key, checkPoint MEDIUMTEXT, %s, %s, %s)",
+		sp.schema, sp.table, ownerColumns[0], ownerColumns[1], ownerColumns[2])
+}
+
+// ownerColumns are the columns recording the instance owning the checkpoint, they're
+// added to the tables created by the old versions.
+var ownerColumns = []string{
+	"instance varchar(255) not null default ''",
+	"fencingToken bigint unsigned not null default 0",
+	"updateTime timestamp not null default current_timestamp",
+}
+
+func genAddColumn(sp *MysqlCheckPoint, column string) string {
+	return fmt.Sprintf("alter table %s.%s add column %s", sp.schema, sp.table, column)
+}
+
+// genSelectOwnerSQL returns the SQL querying the owner, fencing token and the seconds since
+// the last saving of the checkpoint, the time of the downstream is used to avoid the clock skew.
+func genSelectOwnerSQL(sp *MysqlCheckPoint) string {
+	return fmt.Sprintf("select instance, fencingToken, timestampdiff(second, updateTime, now()) from %s.%s where clusterID = %d",
+		sp.schema, sp.table, sp.clusterID)
+}
+
+func genInsertSQL(sp *MysqlCheckPoint) string {
+	return fmt.Sprintf("insert into %s.%s(clusterID, checkPoint, instance, fencingToken, updateTime) values(%d, ?, ?, ?, now())",
+		sp.schema, sp.table, sp.clusterID)
+}
+
+func genClaimSQL(sp *MysqlCheckPoint) string {
+	return fmt.Sprintf("update %s.%s set checkPoint = ?, instance = ?, fencingToken = ?, updateTime = now() where clusterID = %d",
+		sp.schema, sp.table, sp.clusterID)
 }
 
-func genReplaceSQL(sp *MysqlCheckPoint, str string) string {
-	return fmt.Sprintf("replace into %s.%s values(%d, '%s')", sp.schema, sp.table, sp.clusterID, str)
+// genUpdateSQL returns the SQL saving the checkpoint, it only updates the row still owned by
+// the instance with the fencing token.
+func genUpdateSQL(sp *MysqlCheckPoint) string {
+	return fmt.Sprintf("update %s.%s set checkPoint = ?, updateTime = now() where clusterID = %d and instance = ? and fencingToken = ?",
+		sp.schema, sp.table, sp.clusterID)
 }
 
 // getClusterID return the cluster id iff the checkpoint table exist only one row.
@@ -93,7 +143,7 @@ func getClusterID(db *sql.DB, schema string, table string) (id uint64, err error
 
 	for rows.Next() {
 		if id > 0 {
-			return 0, errors.New("there are multi row in checkpoint table")
+			return 0, errorcode.New(errorcode.DrainerCheckpointConflict, "there are multi row in checkpoint table")
 		}
 
 		err = rows.Scan(&id)
@@ -29,6 +29,7 @@ import (
 	"github.com/pingcap/tidb-binlog/pkg/etcd"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
 	"github.com/pingcap/tidb-binlog/pkg/node"
+	"github.com/pingcap/tidb-binlog/pkg/retry"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb-binlog/pump"
 	"github.com/pingcap/tidb/kv"
@@ -74,6 +75,11 @@ type Collector struct {
 	merger *Merger
 
 	errCh chan error
+
+	// pumpRetry is how pulling binlogs from each pump is retried.
+	pumpRetry retry.Policy
+	// mem accounts the memory of the binlogs pulled and not synced, nil if there's no quota.
+	mem *memoryTracker
 }
 
 var (
@@ -121,6 +127,8 @@ func NewCollector(cfg *Config, clusterID uint64, s *Syncer, cpt checkpoint.Check
 		syncedCheckTime: cfg.SyncedCheckTime,
 		merger:          NewMerger(cpt.TS(), heapStrategy),
 		errCh:           make(chan error, 10),
+		pumpRetry:       cfg.PumpRetry,
+		mem:             newMemoryTracker(int64(cfg.MemoryQuota)),
 	}
 
 	return c, nil
@@ -138,6 +146,10 @@ func (c *Collector) publishBinlogs(ctx context.Context) {
 				return
 			}
 			item := mergeItem.(*binlogItem)
+			// the merger and then the pumps are blocked if the memory quota is used up.
+			if err := c.mem.admit(ctx, item); err != nil {
+				return
+			}
 			if err := c.syncBinlog(item); err != nil {
 				c.reportErr(ctx, err)
 				return
@@ -178,6 +190,12 @@ func (c *Collector) updateCollectStatus(synced bool) {
 
 	for nodeID, pump := range c.pumps {
 		status.PumpPos[nodeID] = pump.latestTS
+		if pump.stats != nil {
+			if status.PumpStats == nil {
+				status.PumpStats = make(map[string]*node.PumpStats)
+			}
+			status.PumpStats[nodeID] = pump.stats
+		}
 		pumpPositionGauge.WithLabelValues(nodeID).Set(float64(oracle.ExtractPhysical(uint64(pump.latestTS))))
 	}
 
@@ -276,6 +294,7 @@ func (c *Collector) syncBinlog(item *binlogItem) error {
 	binlog := item.binlog
 	// DO NOT replicate the value of sequence now.
 	if skipQueryJob(binlog) {
+		item.releaseMemory()
 		return nil
 	}
 
@@ -306,6 +325,7 @@ func (c *Collector) syncBinlog(item *binlogItem) error {
 
 		isDelOnlyEvent := model.SchemaState(binlog.DdlSchemaState) == model.StateDeleteOnly
 		if skipJob(job) && !isDelOnlyEvent {
+			item.releaseMemory()
 			return nil
 		}
 		if isDelOnlyEvent {
@@ -330,12 +350,16 @@ func (c *Collector) handlePumpStatusUpdate(ctx context.Context, n *node.Status)
 
 		commitTS := c.merger.GetLatestTS()
 		p := NewPump(n.NodeID, n.Addr, c.tls, c.clusterID, commitTS, c.errCh)
+		p.stats = n.Stats
+		p.retryPolicy = c.pumpRetry
+		p.mem = c.mem
 		c.pumps[n.NodeID] = p
 		c.merger.AddSource(MergeSource{
 			ID:     n.NodeID,
 			Source: p.PullBinlog(ctx, commitTS),
 		})
 	} else {
+		p.stats = n.Stats
 		switch n.State {
 		case node.Pausing:
 			// do nothing
@@ -343,6 +367,8 @@ func (c *Collector) handlePumpStatusUpdate(ctx context.Context, n *node.Status)
 			p.Pause()
 		case node.Online:
 			p.Continue(ctx)
+		case node.Draining:
+			// pump only rejects writing new binlogs, keep pulling the binlogs saved in it.
 		case node.Closing:
 			// pump is closing, and need wait all the binlog is send to drainer, so do nothing here.
 		case node.Offline:
@@ -25,19 +25,26 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Shopify/sarama"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/parser/mysql"
 	"go.uber.org/zap"
 
 	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/compress"
 	"github.com/pingcap/tidb-binlog/pkg/encrypt"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/proxy"
+	"github.com/pingcap/tidb-binlog/pkg/retry"
 	"github.com/pingcap/tidb-binlog/pkg/security"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb-binlog/pkg/version"
 	"github.com/pingcap/tidb-binlog/pkg/zk"
+	"github.com/pingcap/tidb-binlog/pump/storage"
 )
 
 const (
@@ -49,13 +56,16 @@ const (
 	defaultSyncedCheckTime = 5 // 5 minute
 	defaultKafkaAddrs      = "127.0.0.1:9092"
 	defaultKafkaVersion    = "0.8.2.0"
+
+	temporaryTableSkip = "skip"
+	temporaryTableSync = "sync"
 )
 
 var (
 	maxBinlogItemCount        int
 	defaultBinlogItemCount    = 8
 	supportedCompressors      = [...]string{"gzip"}
-	newZKFromConnectionString = zk.NewFromConnectionString
+	newZKFromConnectionString = zk.NewFromConnectionStringWithConfig
 )
 
 // SyncerConfig is the Syncer's configuration.
@@ -75,6 +85,38 @@ type SyncerConfig struct {
 	DoDBs             []string           `toml:"replicate-do-db" json:"replicate-do-db"`
 	DestDBType        string             `toml:"db-type" json:"db-type"`
 	Relay             RelayConfig        `toml:"relay" json:"relay"`
+	// CaseSensitive matches the schema and table names of the filter rules case-sensitively.
+	CaseSensitive bool `toml:"case-sensitive" json:"case-sensitive"`
+	// Wildcard matches the names of the filter rules not starting with '~' as wildcards instead of regular expressions.
+	Wildcard bool `toml:"wildcard" json:"wildcard"`
+	// TemporaryTable is how to handle the temporary tables, "skip" their DDLs and DMLs or "sync" them.
+	TemporaryTable string `toml:"temporary-table" json:"temporary-table"`
+	// StrictCreateTableSelect stops syncing at CREATE TABLE ... SELECT whose selected rows may not
+	// be recorded in the binlog, instead of syncing the DDL with a warning.
+	StrictCreateTableSelect bool `toml:"strict-create-table-select" json:"strict-create-table-select"`
+	// InternalOperations is how to handle the internal operations of TiDB, like the ADMIN statements
+	// and the writes to the statistics tables, "skip" them or "sync" them to the kafka and file.
+	InternalOperations string `toml:"internal-operations" json:"internal-operations"`
+	// DecodeCharsets are the charsets of the columns whose values are encoded in them by upstream,
+	// the values are converted to utf8 for mysql, tidb, kafka and file.
+	DecodeCharsets []string `toml:"decode-charsets" json:"decode-charsets"`
+	// IgnoreColumns are the columns omitted from the DMLs of the tables, like
+	// the large blob columns never read by downstream.
+	IgnoreColumns []filter.ColumnRule `toml:"ignore-column" json:"ignore-column"`
+	// Verify is the config of verifying the synced tables periodically.
+	Verify *VerifyConfig `toml:"verify" json:"verify"`
+	// AutoTune is the config of adjusting txn-batch and worker-count automatically.
+	AutoTune *AutoTuneConfig `toml:"auto-tune" json:"auto-tune"`
+	// Hotspot is the config of sampling the keys of the rows to find the hot ranges.
+	Hotspot *HotspotConfig `toml:"hotspot" json:"hotspot"`
+	// Invalidation is the config of invalidating the caches in redis of the synced rows.
+	Invalidation *InvalidationConfig `toml:"invalidation" json:"invalidation"`
+	// Watermark is the config of tracking the max commit ts of the synced binlogs of the tables.
+	Watermark *WatermarkConfig `toml:"watermark" json:"watermark"`
+	// Dedup is the config of the persistent window of the synced rows skipped when synced again.
+	Dedup *DedupConfig `toml:"dedup" json:"dedup"`
+	// Bandwidth is the config of limiting the bytes of the binlogs synced per second by the time of day.
+	Bandwidth *BandwidthConfig `toml:"bandwidth" json:"bandwidth"`
 	// disable* is keep for backward compatibility.
 	// if both setted, the disable one take affect.
 	DisableDispatchFlag *bool `toml:"-" json:"disable-dispatch-flag"`
@@ -91,6 +133,23 @@ type SyncerConfig struct {
 	EnableCausalityFile  *bool `toml:"enable-detect" json:"enable-detect"`
 }
 
+func (c *SyncerConfig) skipTemporaryTable() bool {
+	return c.TemporaryTable != temporaryTableSync
+}
+
+func (c *SyncerConfig) skipInternalOperations() bool {
+	return c.InternalOperations != internalOperationsSync
+}
+
+// downstreamSQLMode returns the sql mode of the sessions of downstream, to.sql-mode overrides
+// sql-mode of the syncer, which is also used to parse the DDLs of upstream.
+func (c *SyncerConfig) downstreamSQLMode() *string {
+	if c.To != nil && c.To.SQLMode != nil {
+		return c.To.SQLMode
+	}
+	return c.StrSQLMode
+}
+
 // EnableDispatch return true if enable dispatch.
 func (c *SyncerConfig) EnableDispatch() bool {
 	if c.DisableDispatchFlag != nil {
@@ -160,18 +219,51 @@ type Config struct {
 	Security        security.Config `toml:"security" json:"security"`
 	SyncedCheckTime int             `toml:"synced-check-time" json:"synced-check-time"`
 	Compressor      string          `toml:"compressor" json:"compressor"`
+	// PayloadCompression is the codec requested from pump to compress each binlog payload.
+	PayloadCompression string `toml:"payload-compression" json:"payload-compression"`
+	// SchemaSnapshotFile is the schema snapshot exported by binlogctl to build the schema from.
+	SchemaSnapshotFile string `toml:"schema-snapshot-file" json:"schema-snapshot-file"`
+	// AssignmentGroup is the group of drainers the tables are assigned to by binlogctl, drainer only
+	// syncs the tables assigned to it if it's set.
+	AssignmentGroup string `toml:"assignment-group" json:"assignment-group"`
 	EtcdTimeout     time.Duration
 	MetricsAddr     string
 	MetricsInterval int
 	configFile      string
 	printVersion    bool
 	tls             *tls.Config
+
+	// StatusAddr is the addr to serve the HTTP API like /status and /metrics on instead of
+	// ListenAddr, then ListenAddr only serves gRPC. AdvertiseStatusAddr is registered in etcd
+	// for the tools to call the HTTP API, it's StatusAddr by default.
+	StatusAddr          string `toml:"status-addr" json:"status-addr"`
+	AdvertiseStatusAddr string `toml:"advertise-status-addr" json:"advertise-status-addr"`
+
+	// GCSafePoint is the service GC safepoint drainer keeps in PD at its checkpoint.
+	GCSafePoint GCSafePointConfig `toml:"gc-safepoint" json:"gc-safepoint"`
+
+	// PumpRetry is how connecting and pulling binlogs from a pump is retried, drainer
+	// exits if a pump still fails after max-attempts.
+	PumpRetry retry.Policy `toml:"pump-retry" json:"pump-retry"`
+
+	// MemoryQuota is the max size of the binlogs pulled from the pumps and not yet passed to
+	// the downstream syncer, pulling is paused once it's used up, 0 means no quota.
+	MemoryQuota storage.HumanizeBytes `toml:"memory-quota" json:"memory-quota"`
+
+	// BenchFromDir is the directory of the pb files to replay to the downstream
+	// for benchmark, drainer exits after the replay.
+	BenchFromDir string `toml:"-" json:"-"`
+	// RepairBinlogFiles repairs the relay log and the pb files before starting,
+	// see binlogfile.RepairDir.
+	RepairBinlogFiles bool `toml:"-" json:"-"`
 }
 
 // NewConfig return an instance of configuration
 func NewConfig() *Config {
 	cfg := &Config{
 		EtcdTimeout: defaultEtcdTimeout,
+		GCSafePoint: GCSafePointConfig{TTL: defaultGCSafePointTTL},
+		PumpRetry:   defaultPullRetryPolicy,
 		SyncerCfg: &SyncerConfig{
 			DisableDispatchFlag:  new(bool),
 			EnableDispatchFlag:   new(bool),
@@ -188,6 +280,8 @@ func NewConfig() *Config {
 	fs.StringVar(&cfg.NodeID, "node-id", "", "the ID of drainer node; if not specified, we will generate one from hostname and the listening port")
 	fs.StringVar(&cfg.ListenAddr, "addr", util.DefaultListenAddr(8249), "addr (i.e. 'host:port') to listen on for drainer connections")
 	fs.StringVar(&cfg.AdvertiseAddr, "advertise-addr", "", "addr(i.e. 'host:port') to advertise to the public, default to be the same value as -addr")
+	fs.StringVar(&cfg.StatusAddr, "status-addr", "", "addr (i.e. 'host:port') to listen on for the HTTP API, it's served on -addr if not specified")
+	fs.StringVar(&cfg.AdvertiseStatusAddr, "advertise-status-addr", "", "addr(i.e. 'host:port') of the HTTP API to advertise to the public, default to be the same value as -status-addr")
 	fs.StringVar(&cfg.DataDir, "data-dir", defaultDataDir, "drainer data directory path (default data.drainer)")
 	fs.IntVar(&cfg.DetectInterval, "detect-interval", defaultDetectInterval, "the interval time (in seconds) of detect pumps' status")
 	fs.StringVar(&cfg.EtcdURLs, "pd-urls", defaultEtcdURLs, "a comma separated list of PD endpoints")
@@ -199,13 +293,18 @@ func NewConfig() *Config {
 	fs.StringVar(&cfg.LogFile, "log-file", "", "log file path")
 	fs.Int64Var(&cfg.InitialCommitTS, "initial-commit-ts", -1, "if drainer donesn't have checkpoint, use initial commitTS to initial checkpoint, will get a latest timestamp from pd if setting to be -1")
 	fs.StringVar(&cfg.Compressor, "compressor", "", "use the specified compressor to compress payload between pump and drainer, only 'gzip' is supported now (default \"\", ie. compression disabled.)")
+	fs.StringVar(&cfg.PayloadCompression, "payload-compression", "", "request pump to compress each binlog payload with the codec, 'snappy' or 'zstd' (default \"\", ie. compression disabled.)")
+	fs.StringVar(&cfg.BenchFromDir, "bench-from-dir", "", "replay the binlogs in the pb files of the directory to the downstream, report the throughput and latency then exit")
+	fs.BoolVar(&cfg.RepairBinlogFiles, "repair-binlog-files", false, "truncate the partial binlog at the end of the relay log and the pb files, and move the unreadable files and the files before a gap to the '<dir>.quarantine' directory")
+	fs.StringVar(&cfg.SchemaSnapshotFile, "schema-snapshot-file", "", "build the schema from the schema snapshot exported by binlogctl instead of all the history DDL jobs, the checkpoint must not be before the snapshot")
+	fs.StringVar(&cfg.AssignmentGroup, "assignment-group", "", "only sync the tables assigned to this drainer in the group by binlogctl assign-tables")
 	fs.IntVar(&cfg.SyncerCfg.TxnBatch, "txn-batch", 20, "number of binlog events in a transaction batch")
 	fs.BoolVar(&cfg.SyncerCfg.LoopbackControl, "loopback-control", false, "set mark or not ")
 	fs.BoolVar(&cfg.SyncerCfg.SyncDDL, "sync-ddl", true, "sync ddl or not")
 	fs.Int64Var(&cfg.SyncerCfg.ChannelID, "channel-id", 0, "sync channel id ")
 	fs.StringVar(&cfg.SyncerCfg.IgnoreSchemas, "ignore-schemas", "INFORMATION_SCHEMA,PERFORMANCE_SCHEMA,mysql", "disable sync those schemas")
 	fs.IntVar(&cfg.SyncerCfg.WorkerCount, "c", 16, "parallel worker count")
-	fs.StringVar(&cfg.SyncerCfg.DestDBType, "dest-db-type", "mysql", "target db type: mysql or tidb or file or kafka; see syncer section in conf/drainer.toml")
+	fs.StringVar(&cfg.SyncerCfg.DestDBType, "dest-db-type", "mysql", "target db type: mysql or tidb or file or kafka or pubsub or kinesis; see syncer section in conf/drainer.toml")
 	fs.StringVar(&cfg.SyncerCfg.Relay.LogDir, "relay-log-dir", "", "path to relay log of syncer")
 	fs.Int64Var(&cfg.SyncerCfg.Relay.MaxFileSize, "relay-max-file-size", 10485760, "max file size of each relay log")
 	fs.BoolVar(cfg.SyncerCfg.DisableDispatchFlag, "disable-dispatch", false, "DEPRECATED, use enable-dispatch")
@@ -314,6 +413,19 @@ func (cfg *Config) Parse(args []string) error {
 		if err != nil {
 			return errors.Errorf("tls config %+v error %v", cfg.SyncerCfg.To.Checkpoint.Security, err)
 		}
+
+		cfg.SyncerCfg.To.ZKTLS, err = cfg.SyncerCfg.To.ZKSecurity.ToTLSConfig()
+		if err != nil {
+			return errors.Errorf("tls config %+v error %v", cfg.SyncerCfg.To.ZKSecurity, err)
+		}
+	}
+
+	if cfg.SyncerCfg != nil && cfg.SyncerCfg.Verify.enabled() && cfg.SyncerCfg.Verify.Upstream != nil {
+		up := cfg.SyncerCfg.Verify.Upstream
+		up.TLS, err = up.Security.ToTLSConfig()
+		if err != nil {
+			return errors.Errorf("tls config %+v error %v", up.Security, err)
+		}
 	}
 
 	if err = cfg.adjustConfig(); err != nil {
@@ -325,14 +437,22 @@ func (cfg *Config) Parse(args []string) error {
 }
 
 func (c *SyncerConfig) adjustWorkCount() {
-	if c.DestDBType == "file" || c.DestDBType == "kafka" {
+	if c.DestDBType == "file" || c.DestDBType == "kafka" || isStreamDBType(c.DestDBType) {
 		c.WorkerCount = 1
 	} else if !c.EnableDispatch() {
 		c.WorkerCount = 1
 	}
 }
 
+func (cfg *Config) configFromFile(path string) error {
+	return util.StrictDecodeFile(path, "drainer", cfg)
+}
+
+// adjustDoDBAndTable lowercases the do rules unless they're matched case-sensitively.
 func (c *SyncerConfig) adjustDoDBAndTable() {
+	if c.CaseSensitive {
+		return
+	}
 	for i := 0; i < len(c.DoTables); i++ {
 		c.DoTables[i].Table = strings.ToLower(c.DoTables[i].Table)
 		c.DoTables[i].Schema = strings.ToLower(c.DoTables[i].Schema)
@@ -342,41 +462,49 @@ func (c *SyncerConfig) adjustDoDBAndTable() {
 	}
 }
 
-func (cfg *Config) configFromFile(path string) error {
-	return util.StrictDecodeFile(path, "drainer", cfg)
+// ignoreDBs returns the schemas of ignore-schemas.
+func (c *SyncerConfig) ignoreDBs() []string {
+	if len(c.IgnoreSchemas) == 0 {
+		return nil
+	}
+	return strings.Split(c.IgnoreSchemas, ",")
+}
+
+func (c *SyncerConfig) filterOptions() []filter.Option {
+	return []filter.Option{filter.CaseSensitive(c.CaseSensitive), filter.Wildcard(c.Wildcard)}
+}
+
+// newFilter returns the filter of the tables synced.
+func (c *SyncerConfig) newFilter() (*filter.Filter, error) {
+	return filter.NewFilter(c.ignoreDBs(), c.IgnoreTables, c.DoDBs, c.DoTables, c.filterOptions()...)
 }
 
 func (cfg *Config) validateFilter() error {
-	for _, db := range cfg.SyncerCfg.DoDBs {
-		if len(db) == 0 {
-			return errors.New("empty schema name in `replicate-do-db` config")
-		}
+	opts := cfg.SyncerCfg.filterOptions()
+	if err := filter.ValidateDBs("replicate-do-db", cfg.SyncerCfg.DoDBs, opts...); err != nil {
+		return errors.Trace(err)
 	}
-
-	dbs := strings.Split(cfg.SyncerCfg.IgnoreSchemas, ",")
-	for _, db := range dbs {
-		if len(db) == 0 {
-			return errors.New("empty schema name in `ignore-schemas` config")
-		}
+	if err := filter.ValidateDBs("ignore-schemas", cfg.SyncerCfg.ignoreDBs(), opts...); err != nil {
+		return errors.Trace(err)
+	}
+	if err := filter.ValidateTables("replicate-do-table", cfg.SyncerCfg.DoTables, opts...); err != nil {
+		return errors.Trace(err)
+	}
+	if err := filter.ValidateTables("ignore-table", cfg.SyncerCfg.IgnoreTables, opts...); err != nil {
+		return errors.Trace(err)
 	}
 
-	for _, tb := range cfg.SyncerCfg.DoTables {
-		if len(tb.Schema) == 0 {
-			return errors.New("empty schema name in `replicate-do-table` config")
-		}
-
-		if len(tb.Table) == 0 {
-			return errors.New("empty table name in `replicate-do-table` config")
+	for _, rule := range cfg.SyncerCfg.IgnoreColumns {
+		if len(rule.Schema) == 0 {
+			return errors.New("empty schema name in `ignore-column` config")
 		}
-	}
 
-	for _, tb := range cfg.SyncerCfg.IgnoreTables {
-		if len(tb.Schema) == 0 {
-			return errors.New("empty schema name in `ignore-table` config")
+		if len(rule.Table) == 0 {
+			return errors.New("empty table name in `ignore-column` config")
 		}
 
-		if len(tb.Table) == 0 {
-			return errors.New("empty table name in `ignore-table` config")
+		if len(rule.Columns) == 0 {
+			return errors.Errorf("empty columns of `%s`.`%s` in `ignore-column` config", rule.Schema, rule.Table)
 		}
 	}
 
@@ -391,6 +519,16 @@ func (cfg *Config) validate() error {
 	if err := validateAddr(cfg.AdvertiseAddr); err != nil {
 		return errors.Annotate(err, "invalid advertise-addr")
 	}
+	if len(cfg.StatusAddr) > 0 {
+		if err := validateAddr(cfg.StatusAddr); err != nil {
+			return errors.Annotate(err, "invalid status-addr")
+		}
+		if err := validateAddr(cfg.AdvertiseStatusAddr); err != nil {
+			return errors.Annotate(err, "invalid advertise-status-addr")
+		}
+	} else if len(cfg.AdvertiseStatusAddr) > 0 {
+		return errors.New("advertise-status-addr is set without status-addr")
+	}
 
 	// check EtcdEndpoints
 	if _, err := flags.NewURLsValue(cfg.EtcdURLs); err != nil {
@@ -411,9 +549,341 @@ func (cfg *Config) validate() error {
 		}
 	}
 
+	if _, err := compress.ToCompressionCodec(cfg.PayloadCompression); err != nil {
+		return errors.Trace(err)
+	}
+
+	switch cfg.SyncerCfg.TemporaryTable {
+	case "", temporaryTableSkip, temporaryTableSync:
+	default:
+		return errors.Errorf("invalid temporary-table: %s, must be one of %s, %s", cfg.SyncerCfg.TemporaryTable, temporaryTableSkip, temporaryTableSync)
+	}
+
+	switch cfg.SyncerCfg.InternalOperations {
+	case "", internalOperationsSkip:
+	case internalOperationsSync:
+		if cfg.SyncerCfg.DestDBType == "mysql" || cfg.SyncerCfg.DestDBType == "tidb" {
+			return errors.Errorf("internal-operations can't be %s when db-type is %s, they're only for the consumers of kafka and file", internalOperationsSync, cfg.SyncerCfg.DestDBType)
+		}
+	default:
+		return errors.Errorf("invalid internal-operations: %s, must be one of %s, %s", cfg.SyncerCfg.InternalOperations, internalOperationsSkip, internalOperationsSync)
+	}
+
+	if err := cfg.validateVerify(); err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := cfg.PumpRetry.Validate(); err != nil {
+		return errors.Annotate(err, "invalid pump-retry")
+	}
+
+	if err := cfg.GCSafePoint.validate(); err != nil {
+		return errors.Trace(err)
+	}
+
+	if autoTune := cfg.SyncerCfg.AutoTune; autoTune.enabled() {
+		if err := autoTune.validate(cfg.SyncerCfg.WorkerCount, cfg.SyncerCfg.TxnBatch); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if hotspot := cfg.SyncerCfg.Hotspot; hotspot.enabled() {
+		if err := hotspot.validate(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if invalidation := cfg.SyncerCfg.Invalidation; invalidation.enabled() {
+		if err := invalidation.validate(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if watermark := cfg.SyncerCfg.Watermark; watermark.enabled() {
+		if err := watermark.validate(cfg.SyncerCfg.DestDBType); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if dedup := cfg.SyncerCfg.Dedup; dedup.enabled() {
+		if err := dedup.validate(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if bandwidth := cfg.SyncerCfg.Bandwidth; bandwidth != nil {
+		if err := bandwidth.validate(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if cfg.SyncerCfg.To != nil && !translator.IsValidDownstreamVersion(cfg.SyncerCfg.To.DownstreamVersion) {
+		return errors.Errorf("invalid downstream-version: %s, must be one of 5.6, 5.7, 8.0", cfg.SyncerCfg.To.DownstreamVersion)
+	}
+
+	if mode := cfg.SyncerCfg.downstreamSQLMode(); cfg.SyncerCfg.To != nil && mode != nil {
+		if err := translator.ValidateDownstreamSQLMode(*mode, cfg.SyncerCfg.To.DownstreamVersion); err != nil {
+			return errors.Annotate(err, "invalid config: the sql mode of downstream")
+		}
+	}
+
+	if cfg.SyncerCfg.To != nil {
+		for _, rule := range cfg.SyncerCfg.To.JSONUpdateRules {
+			if !translator.IsValidJSONUpdateFormat(rule.Format) {
+				return errors.Errorf("invalid format of json-update-rule: %s, must be one of full, patch, diff", rule.Format)
+			}
+		}
+		for _, rule := range cfg.SyncerCfg.To.GeneratedColumnRules {
+			if !translator.IsValidGeneratedColumnsMode(rule.Mode) {
+				return errors.Errorf("invalid mode of generated-column-rule: %s, must be one of omit, stored, all", rule.Mode)
+			}
+		}
+		for _, rule := range cfg.SyncerCfg.To.NoKeyTableRules {
+			if !translator.IsValidNoKeyTableMode(rule.Mode) {
+				return errors.Errorf("invalid mode of no-key-table-rule: %s, must be one of full-row, skip, append-only", rule.Mode)
+			}
+		}
+		if cfg.SyncerCfg.To.DDLTimeout < 0 || cfg.SyncerCfg.To.DDLBlockCheckInterval < 0 {
+			return errors.New("ddl-timeout and ddl-block-check-interval can't be negative")
+		}
+		if cfg.SyncerCfg.To.StatementTimeout < 0 {
+			return errors.New("statement-timeout can't be negative")
+		}
+		switch cfg.SyncerCfg.To.StatementTimeoutAction {
+		case "", loader.StatementTimeoutRetry, loader.StatementTimeoutError:
+		default:
+			return errors.Errorf("invalid statement-timeout-action: %s, must be one of retry, error", cfg.SyncerCfg.To.StatementTimeoutAction)
+		}
+		if cfg.SyncerCfg.To.DDL.LockWaitTimeout < 0 {
+			return errors.New("lock-wait-timeout of ddl can't be negative")
+		}
+		if cfg.SyncerCfg.To.MaxOpenConns < 0 || cfg.SyncerCfg.To.MaxIdleConns < 0 || cfg.SyncerCfg.To.ConnMaxLifetime < 0 {
+			return errors.New("max-open-conns, max-idle-conns and conn-max-lifetime can't be negative")
+		}
+		if _, err := loader.ParseIsolationLevel(cfg.SyncerCfg.To.IsolationLevel); err != nil {
+			return errors.Trace(err)
+		}
+		if err := validateDDLBroadcastRules(cfg.SyncerCfg.To.DDLBroadcastRules); err != nil {
+			return errors.Trace(err)
+		}
+		if err := validatePartitionKeyRules(cfg.SyncerCfg.To.PartitionKeyRules, cfg.SyncerCfg.DestDBType); err != nil {
+			return errors.Trace(err)
+		}
+		switch cfg.SyncerCfg.To.SchemaMoveDDL {
+		case "", dsync.SchemaMoveDDLRoute, dsync.SchemaMoveDDLBlock:
+		default:
+			return errors.Errorf("invalid schema-move-ddl: %s, must be one of route, block", cfg.SyncerCfg.To.SchemaMoveDDL)
+		}
+		if err := validateKafkaTransaction(cfg.SyncerCfg.To, cfg.SyncerCfg.DestDBType); err != nil {
+			return errors.Trace(err)
+		}
+		if err := validateSchemaRegistry(cfg.SyncerCfg.To, cfg.SyncerCfg.DestDBType); err != nil {
+			return errors.Trace(err)
+		}
+		if err := validateSchemaSnapshot(cfg.SyncerCfg.To, cfg.SyncerCfg.DestDBType); err != nil {
+			return errors.Trace(err)
+		}
+		if err := validateStream(cfg.SyncerCfg.To, cfg.SyncerCfg.DestDBType); err != nil {
+			return errors.Trace(err)
+		}
+		if err := validateProxy(&cfg.SyncerCfg.To.Proxy, cfg.SyncerCfg.DestDBType); err != nil {
+			return errors.Trace(err)
+		}
+		if err := validateCommitTSColumnRules(cfg.SyncerCfg.To, cfg.SyncerCfg.DestDBType); err != nil {
+			return errors.Trace(err)
+		}
+		if err := validateUpsertRules(cfg.SyncerCfg.To, cfg.SyncerCfg.DestDBType); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
 	return cfg.validateFilter()
 }
 
+// newZKConfig returns the config of connecting to the zookeeper of the kafka brokers.
+func newZKConfig(to *dsync.DBConfig) (*zk.Config, error) {
+	conf := zk.NewDefaultConfig()
+	conf.DialTimeout = time.Second * 5
+	conf.TLS = to.ZKTLS
+	if len(to.ZKAuth) > 0 {
+		scheme, credential, err := zk.ParseAuth(to.ZKAuth)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		conf.AuthScheme, conf.Auth = scheme, []byte(credential)
+	}
+	return conf, nil
+}
+
+// isStreamDBType returns whether the binlogs are published to a streaming service.
+func isStreamDBType(destDBType string) bool {
+	return destDBType == "pubsub" || destDBType == "kinesis"
+}
+
+func validateStream(to *dsync.DBConfig, destDBType string) error {
+	if err := to.Stream.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	switch destDBType {
+	case "pubsub":
+		return errors.Trace(to.PubSub.Validate())
+	case "kinesis":
+		return errors.Trace(to.Kinesis.Validate())
+	}
+	return nil
+}
+
+func validateProxy(cfg *proxy.Config, destDBType string) error {
+	if !cfg.Enabled() {
+		return nil
+	}
+	if destDBType != "mysql" && destDBType != "tidb" {
+		return errors.Errorf("proxy is only supported when db-type is mysql or tidb, but got %s", destDBType)
+	}
+	return errors.Trace(cfg.Validate())
+}
+
+func validateCommitTSColumnRules(to *dsync.DBConfig, destDBType string) error {
+	if len(to.CommitTSColumnRules) == 0 {
+		return nil
+	}
+	if destDBType != "mysql" && destDBType != "tidb" {
+		return errors.Errorf("commit-ts-column-rule is only supported when db-type is mysql or tidb, but got %s", destDBType)
+	}
+	for _, rule := range to.CommitTSColumnRules {
+		if len(rule.Schema) == 0 || len(rule.Table) == 0 {
+			return errors.New("db-name and tbl-name of commit-ts-column-rule must be set")
+		}
+	}
+	return nil
+}
+
+func validateUpsertRules(to *dsync.DBConfig, destDBType string) error {
+	if len(to.UpsertRules) == 0 {
+		return nil
+	}
+	if destDBType != "mysql" && destDBType != "tidb" {
+		return errors.Errorf("upsert-rule is only supported when db-type is mysql or tidb, but got %s", destDBType)
+	}
+	for _, rule := range to.UpsertRules {
+		if len(rule.Schema) == 0 || len(rule.Table) == 0 {
+			return errors.New("db-name and tbl-name of upsert-rule must be set")
+		}
+	}
+	return nil
+}
+
+func validateKafkaTransaction(to *dsync.DBConfig, destDBType string) error {
+	if !to.KafkaTransaction {
+		return nil
+	}
+	return errors.Trace(requireKafka011(to, destDBType, "kafka-transaction"))
+}
+
+func validateSchemaRegistry(to *dsync.DBConfig, destDBType string) error {
+	if err := to.SchemaRegistry.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	if len(to.SchemaRegistry.URL) == 0 {
+		return nil
+	}
+	// the schema ids are kept in the message headers.
+	return errors.Trace(requireKafka011(to, destDBType, "schema-registry"))
+}
+
+func validateSchemaSnapshot(to *dsync.DBConfig, destDBType string) error {
+	if !to.SchemaSnapshot {
+		return nil
+	}
+	// the snapshots are marked by the message header.
+	return errors.Trace(requireKafka011(to, destDBType, "schema-snapshot"))
+}
+
+// requireKafka011 checks the option is used with kafka 0.11.0.0 or later.
+func requireKafka011(to *dsync.DBConfig, destDBType string, option string) error {
+	if destDBType != "kafka" {
+		return errors.Errorf("%s is only supported when db-type is kafka, but got %s", option, destDBType)
+	}
+	version, err := sarama.ParseKafkaVersion(to.KafkaVersion)
+	if err != nil {
+		return errors.Annotate(err, "invalid kafka-version")
+	}
+	if !version.IsAtLeast(sarama.V0_11_0_0) {
+		return errors.Errorf("%s requires kafka-version 0.11.0.0 or later, but got %s", option, to.KafkaVersion)
+	}
+	return nil
+}
+
+func (cfg *Config) validateVerify() error {
+	verify := cfg.SyncerCfg.Verify
+	if !verify.enabled() {
+		return nil
+	}
+
+	if cfg.SyncerCfg.DestDBType != "mysql" && cfg.SyncerCfg.DestDBType != "tidb" {
+		return errors.Errorf("verify is only supported when db-type is mysql or tidb, but got %s", cfg.SyncerCfg.DestDBType)
+	}
+	if verify.Upstream == nil || len(verify.Upstream.Host) == 0 {
+		return errors.New("upstream of verify is not set")
+	}
+	if len(verify.Tables) == 0 {
+		return errors.New("no table to verify")
+	}
+	for _, table := range verify.Tables {
+		if len(table.Schema) == 0 || len(table.Table) == 0 {
+			return errors.Errorf("invalid table to verify: %+v, db-name and tbl-name must be set", table)
+		}
+	}
+	if verify.Sample < 0 || verify.Sample > 100 {
+		return errors.Errorf("invalid sample of verify: %d, must be in [0, 100]", verify.Sample)
+	}
+	return nil
+}
+
+func validatePartitionKeyRules(rules []dsync.PartitionKeyRule, destDBType string) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	if destDBType != "kafka" && !isStreamDBType(destDBType) {
+		return errors.Errorf("partition-key-rule is only supported when db-type is kafka, pubsub or kinesis, but got %s", destDBType)
+	}
+	for _, rule := range rules {
+		if len(rule.Schema) == 0 || len(rule.Table) == 0 {
+			return errors.Errorf("invalid partition-key-rule: %+v, db-name and tbl-name must be set", rule)
+		}
+		if len(rule.Columns) == 0 {
+			return errors.Errorf("no column in partition-key-rule of %s.%s", rule.Schema, rule.Table)
+		}
+		for _, column := range rule.Columns {
+			if len(column) == 0 {
+				return errors.Errorf("empty column in partition-key-rule of %s.%s", rule.Schema, rule.Table)
+			}
+		}
+	}
+	return nil
+}
+
+func validateDDLBroadcastRules(rules []dsync.DDLBroadcastRule) error {
+	schemas := make(map[string]struct{}, len(rules))
+	for _, rule := range rules {
+		if len(rule.Schema) == 0 {
+			return errors.New("db-name of ddl-broadcast-rule is empty")
+		}
+		if _, ok := schemas[strings.ToLower(rule.Schema)]; ok {
+			return errors.Errorf("duplicate ddl-broadcast-rule of %s", rule.Schema)
+		}
+		schemas[strings.ToLower(rule.Schema)] = struct{}{}
+
+		if rule.ShardCount <= 0 {
+			return errors.Errorf("invalid shard-count of ddl-broadcast-rule of %s: %d", rule.Schema, rule.ShardCount)
+		}
+		if shard := rule.Shards()[0]; strings.Contains(shard, "%!") {
+			return errors.Errorf("invalid target-schema of ddl-broadcast-rule of %s: %s, must contain one integer verb like %%03d", rule.Schema, rule.TargetSchema)
+		}
+	}
+	return nil
+}
+
 func (cfg *Config) adjustConfig() error {
 	// adjust configuration
 	util.AdjustString(&cfg.ListenAddr, util.DefaultListenAddr(8249))
@@ -425,8 +895,20 @@ func (cfg *Config) adjustConfig() error {
 		cfg.ListenAddr = "http://" + cfg.ListenAddr       // add 'http:' scheme to facilitate parsing
 		cfg.AdvertiseAddr = "http://" + cfg.AdvertiseAddr // add 'http:' scheme to facilitate parsing
 	}
+	if len(cfg.StatusAddr) > 0 {
+		util.AdjustString(&cfg.AdvertiseStatusAddr, cfg.StatusAddr)
+		scheme := "http://"
+		if cfg.tls != nil {
+			scheme = "https://"
+		}
+		cfg.StatusAddr = scheme + cfg.StatusAddr
+		cfg.AdvertiseStatusAddr = scheme + cfg.AdvertiseStatusAddr
+	}
 	util.AdjustString(&cfg.DataDir, defaultDataDir)
 	util.AdjustInt(&cfg.DetectInterval, defaultDetectInterval)
+	if cfg.SyncerCfg.DecodeCharsets == nil {
+		cfg.SyncerCfg.DecodeCharsets = translator.DefaultDecodeCharsets
+	}
 
 	// add default syncer.to configuration if need
 	if cfg.SyncerCfg.To == nil {
@@ -443,7 +925,11 @@ func (cfg *Config) adjustConfig() error {
 
 		// get KafkaAddrs from zookeeper if ZkAddrs is setted
 		if cfg.SyncerCfg.To.ZKAddrs != "" {
-			zkClient, err := newZKFromConnectionString(cfg.SyncerCfg.To.ZKAddrs, time.Second*5, time.Second*60)
+			zkConf, err := newZKConfig(cfg.SyncerCfg.To)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			zkClient, err := newZKFromConnectionString(cfg.SyncerCfg.To.ZKAddrs, zkConf)
 			if err != nil {
 				return errors.Trace(err)
 			}
@@ -523,9 +1009,54 @@ func (cfg *Config) adjustConfig() error {
 		cfg.SyncerCfg.To.Checkpoint.Password = decrypt
 	}
 
+	if verify := cfg.SyncerCfg.Verify; verify.enabled() && verify.Upstream != nil {
+		if verify.Upstream.Port == 0 {
+			verify.Upstream.Port = 4000
+		}
+		if len(verify.Upstream.User) == 0 {
+			verify.Upstream.User = "root"
+		}
+		if len(verify.Upstream.EncryptedPassword) > 0 {
+			decrypt, err := encrypt.Decrypt(verify.Upstream.EncryptedPassword)
+			if err != nil {
+				return errors.Annotate(err, "failed to decrypt password in `verify.upstream.encrypted_password`")
+			}
+
+			verify.Upstream.Password = decrypt
+		}
+		verify.adjust()
+	}
+
 	cfg.SyncerCfg.adjustWorkCount()
 	cfg.SyncerCfg.adjustDoDBAndTable()
 
+	if autoTune := cfg.SyncerCfg.AutoTune; autoTune.enabled() {
+		autoTune.adjust(cfg.SyncerCfg.WorkerCount, cfg.SyncerCfg.TxnBatch)
+		cfg.SyncerCfg.To.AutoTune = autoTune.loaderConfig()
+	}
+
+	charsets, err := translator.NewCharsets(cfg.SyncerCfg.DecodeCharsets)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.SyncerCfg.To.Charsets = charsets
+
+	if hotspot := cfg.SyncerCfg.Hotspot; hotspot.enabled() {
+		hotspot.adjust()
+	}
+
+	if invalidation := cfg.SyncerCfg.Invalidation; invalidation.enabled() {
+		invalidation.adjust()
+	}
+
+	if watermark := cfg.SyncerCfg.Watermark; watermark.enabled() {
+		watermark.adjust()
+	}
+
+	if dedup := cfg.SyncerCfg.Dedup; dedup.enabled() {
+		dedup.adjust(cfg.DataDir)
+	}
+
 	return nil
 }
 
@@ -19,7 +19,6 @@ import (
 	"os"
 	"path"
 	"testing"
-	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/pingcap/check"
@@ -28,6 +27,7 @@ import (
 	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
 	"github.com/pingcap/tidb-binlog/pkg/encrypt"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/proxy"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	pkgzk "github.com/pingcap/tidb-binlog/pkg/zk"
 	"github.com/samuel/go-zookeeper/zk"
@@ -83,6 +83,13 @@ func (t *testDrainerSuite) TestValidateFilter(c *C) {
 	cfg.SyncerCfg.IgnoreSchemas = "a,,c"
 	c.Assert(cfg.validateFilter(), NotNil)
 
+	// no schema is ignored.
+	cfg.SyncerCfg.IgnoreSchemas = ""
+	c.Assert(cfg.validateFilter(), IsNil)
+
+	cfg.SyncerCfg.DoDBs = []string{"~(db"}
+	c.Assert(cfg.validateFilter(), ErrorMatches, ".*invalid pattern ~\\(db.*")
+
 	emptyScheme := []filter.TableName{{Schema: "", Table: "t"}}
 	emptyTable := []filter.TableName{{Schema: "s", Table: ""}}
 
@@ -101,6 +108,17 @@ func (t *testDrainerSuite) TestValidateFilter(c *C) {
 	cfg = NewConfig()
 	cfg.SyncerCfg.IgnoreTables = emptyTable
 	c.Assert(cfg.validateFilter(), NotNil)
+
+	cfg = NewConfig()
+	cfg.SyncerCfg.IgnoreColumns = []filter.ColumnRule{{Schema: "s", Table: "t"}}
+	c.Assert(cfg.validateFilter(), ErrorMatches, ".*empty columns.*")
+
+	cfg.SyncerCfg.IgnoreColumns[0].Schema = ""
+	cfg.SyncerCfg.IgnoreColumns[0].Columns = []string{"c"}
+	c.Assert(cfg.validateFilter(), ErrorMatches, ".*empty schema name in `ignore-column`.*")
+
+	cfg.SyncerCfg.IgnoreColumns[0].Schema = "s"
+	c.Assert(cfg.validateFilter(), IsNil)
 }
 
 func (t *testDrainerSuite) TestValidate(c *C) {
@@ -134,6 +152,228 @@ func (t *testDrainerSuite) TestValidate(c *C) {
 	cfg.Compressor = "gzip"
 	err = cfg.validate()
 	c.Assert(err, IsNil)
+
+	cfg.PayloadCompression = "lz4"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*unsupported compression codec lz4.*")
+
+	cfg.PayloadCompression = "zstd"
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+
+	cfg.PumpRetry.Multiplier = 0.5
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid pump-retry.*invalid multiplier of retry.*")
+
+	cfg.PumpRetry.Multiplier = 2
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+
+	cfg.SyncerCfg.TemporaryTable = "ignore"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid temporary-table.*")
+
+	cfg.SyncerCfg.TemporaryTable = "sync"
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+
+	cfg.SyncerCfg.InternalOperations = "ignore"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid internal-operations.*")
+
+	cfg.SyncerCfg.InternalOperations = "sync"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*internal-operations can't be sync when db-type is mysql.*")
+
+	cfg.SyncerCfg.DestDBType = "kafka"
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+	cfg.SyncerCfg.DestDBType = "mysql"
+	cfg.SyncerCfg.InternalOperations = ""
+
+	cfg.SyncerCfg.To = &dsync.DBConfig{DownstreamVersion: "5.5"}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid downstream-version.*")
+
+	cfg.SyncerCfg.To.DownstreamVersion = "5.6"
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+
+	// to.sql-mode overrides sql-mode, and must be accepted by downstream-version.
+	cfg.SyncerCfg.To.DownstreamVersion = "8.0"
+	upstreamMode, downstreamMode, invalidMode := "STRICT_TRANS_TABLES,NO_AUTO_CREATE_USER", "STRICT_TRANS_TABLES,NO_ZERO_DATE", "NO_SUCH_MODE"
+	cfg.SyncerCfg.StrSQLMode = &upstreamMode
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*NO_AUTO_CREATE_USER is removed in MySQL 8.0.*")
+	cfg.SyncerCfg.To.SQLMode = &downstreamMode
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+	c.Assert(*cfg.SyncerCfg.downstreamSQLMode(), Equals, downstreamMode)
+	cfg.SyncerCfg.To.SQLMode = &invalidMode
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid sql mode.*")
+	cfg.SyncerCfg.StrSQLMode = nil
+	cfg.SyncerCfg.To.SQLMode = nil
+	cfg.SyncerCfg.To.DownstreamVersion = "5.6"
+
+	cfg.SyncerCfg.To.JSONUpdateRules = []dsync.JSONUpdateRule{{Schema: "test", Table: "t", Format: "merge"}}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid format of json-update-rule.*")
+
+	cfg.SyncerCfg.To.JSONUpdateRules[0].Format = "diff"
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+
+	cfg.SyncerCfg.To.DDLBroadcastRules = []dsync.DDLBroadcastRule{{Schema: "test", TargetSchema: "test_shard", ShardCount: 2}}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid target-schema of ddl-broadcast-rule.*")
+
+	cfg.SyncerCfg.To.DDLBroadcastRules[0].TargetSchema = "test_%03d"
+	cfg.SyncerCfg.To.DDLBroadcastRules[0].ShardCount = 0
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*invalid shard-count of ddl-broadcast-rule.*")
+
+	cfg.SyncerCfg.To.DDLBroadcastRules[0].ShardCount = 128
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.SyncerCfg.To.DDLBroadcastRules[0].Shards()[127], Equals, "test_127")
+
+	cfg.SyncerCfg.To.DDLBroadcastRules = append(cfg.SyncerCfg.To.DDLBroadcastRules, dsync.DDLBroadcastRule{Schema: "TEST", TargetSchema: "t_%d", ShardCount: 1})
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*duplicate ddl-broadcast-rule.*")
+	cfg.SyncerCfg.To.DDLBroadcastRules = nil
+
+	cfg.SyncerCfg.To.PartitionKeyRules = []dsync.PartitionKeyRule{{Schema: "shop", Table: "orders"}}
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*partition-key-rule is only supported when db-type is kafka.*")
+
+	destDBType := cfg.SyncerCfg.DestDBType
+	cfg.SyncerCfg.DestDBType = "kafka"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*no column in partition-key-rule of shop.orders.*")
+
+	cfg.SyncerCfg.To.PartitionKeyRules[0].Columns = []string{"customer_id"}
+	err = cfg.validate()
+	c.Assert(err, IsNil)
+	cfg.SyncerCfg.To.PartitionKeyRules = nil
+	cfg.SyncerCfg.DestDBType = destDBType
+
+	cfg.SyncerCfg.To.IsolationLevel = "snapshot"
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*unknown isolation level snapshot.*")
+
+	cfg.SyncerCfg.To.IsolationLevel = "READ-COMMITTED"
+	cfg.SyncerCfg.To.ConnMaxLifetime = -1
+	err = cfg.validate()
+	c.Assert(err, ErrorMatches, ".*can't be negative.*")
+}
+
+func (t *testDrainerSuite) TestValidateVerify(c *C) {
+	cfg := NewConfig()
+	cfg.SyncerCfg.DestDBType = "kafka"
+	cfg.SyncerCfg.Verify = &VerifyConfig{}
+	c.Assert(cfg.validateVerify(), IsNil)
+
+	cfg.SyncerCfg.Verify.Interval = 600
+	c.Assert(cfg.validateVerify(), ErrorMatches, ".*verify is only supported when db-type is mysql or tidb.*")
+
+	cfg.SyncerCfg.DestDBType = "tidb"
+	c.Assert(cfg.validateVerify(), ErrorMatches, ".*upstream of verify is not set.*")
+
+	cfg.SyncerCfg.Verify.Upstream = &dsync.DBConfig{Host: "127.0.0.1"}
+	c.Assert(cfg.validateVerify(), ErrorMatches, ".*no table to verify.*")
+
+	cfg.SyncerCfg.Verify.Tables = []filter.TableName{{Schema: "test"}}
+	c.Assert(cfg.validateVerify(), ErrorMatches, ".*invalid table to verify.*")
+
+	cfg.SyncerCfg.Verify.Tables[0].Table = "t"
+	cfg.SyncerCfg.Verify.Sample = 101
+	c.Assert(cfg.validateVerify(), ErrorMatches, ".*invalid sample of verify.*")
+
+	cfg.SyncerCfg.Verify.Sample = 0
+	c.Assert(cfg.validateVerify(), IsNil)
+
+	encrypted, err := encrypt.Encrypt("origin")
+	c.Assert(err, IsNil)
+	cfg.SyncerCfg.Verify.Upstream.EncryptedPassword = string(encrypted)
+	c.Assert(cfg.adjustConfig(), IsNil)
+	c.Assert(cfg.SyncerCfg.Verify.Upstream.Password, Equals, "origin")
+	c.Assert(cfg.SyncerCfg.Verify.Upstream.Port, Equals, 4000)
+	c.Assert(cfg.SyncerCfg.Verify.Sample, Equals, 100)
+	c.Assert(cfg.SyncerCfg.Verify.ChunkSize, Equals, defaultVerifyChunkSize)
+}
+
+func (t *testDrainerSuite) TestValidateKafkaTransaction(c *C) {
+	to := &dsync.DBConfig{KafkaVersion: "0.10.2.0"}
+	c.Assert(validateKafkaTransaction(to, "tidb"), IsNil)
+
+	to.KafkaTransaction = true
+	c.Assert(validateKafkaTransaction(to, "tidb"), ErrorMatches, ".*only supported when db-type is kafka.*")
+	c.Assert(validateKafkaTransaction(to, "kafka"), ErrorMatches, ".*requires kafka-version 0.11.0.0 or later.*")
+
+	to.KafkaVersion = "2.1.0"
+	c.Assert(validateKafkaTransaction(to, "kafka"), IsNil)
+}
+
+func (t *testDrainerSuite) TestValidateSchemaSnapshot(c *C) {
+	to := &dsync.DBConfig{KafkaVersion: "0.10.2.0"}
+	c.Assert(validateSchemaSnapshot(to, "file"), IsNil)
+
+	to.SchemaSnapshot = true
+	c.Assert(validateSchemaSnapshot(to, "file"), ErrorMatches, "schema-snapshot is only supported when db-type is kafka.*")
+	c.Assert(validateSchemaSnapshot(to, "kafka"), ErrorMatches, "schema-snapshot requires kafka-version 0.11.0.0 or later.*")
+
+	to.KafkaVersion = "2.1.0"
+	c.Assert(validateSchemaSnapshot(to, "kafka"), IsNil)
+}
+
+func (t *testDrainerSuite) TestValidateSchemaRegistry(c *C) {
+	to := &dsync.DBConfig{KafkaVersion: "0.10.2.0"}
+	c.Assert(validateSchemaRegistry(to, "tidb"), IsNil)
+
+	to.SchemaRegistry.URL = "http://127.0.0.1:8081"
+	c.Assert(validateSchemaRegistry(to, "tidb"), ErrorMatches, "schema-registry is only supported when db-type is kafka.*")
+	c.Assert(validateSchemaRegistry(to, "kafka"), ErrorMatches, "schema-registry requires kafka-version 0.11.0.0 or later.*")
+
+	to.KafkaVersion = "2.1.0"
+	c.Assert(validateSchemaRegistry(to, "kafka"), IsNil)
+	c.Assert(to.SchemaRegistry.OnFailure, Equals, dsync.SchemaRegistryFailureStop)
+}
+
+func (t *testDrainerSuite) TestValidateProxy(c *C) {
+	cfg := &proxy.Config{}
+	c.Assert(validateProxy(cfg, "kafka"), IsNil)
+
+	cfg.Type = proxy.TypeSOCKS5
+	c.Assert(validateProxy(cfg, "kafka"), ErrorMatches, "proxy is only supported when db-type is mysql or tidb.*")
+	c.Assert(validateProxy(cfg, "mysql"), ErrorMatches, "addr of proxy is not set")
+
+	cfg.Addr = "127.0.0.1:1080"
+	c.Assert(validateProxy(cfg, "tidb"), IsNil)
+}
+
+func (t *testDrainerSuite) TestValidateCommitTSColumnRules(c *C) {
+	to := &dsync.DBConfig{}
+	c.Assert(validateCommitTSColumnRules(to, "kafka"), IsNil)
+
+	to.CommitTSColumnRules = []dsync.CommitTSColumnRule{{Schema: "test"}}
+	c.Assert(validateCommitTSColumnRules(to, "kafka"), ErrorMatches, "commit-ts-column-rule is only supported when db-type is mysql or tidb.*")
+	c.Assert(validateCommitTSColumnRules(to, "mysql"), ErrorMatches, "db-name and tbl-name of commit-ts-column-rule must be set")
+
+	to.CommitTSColumnRules[0].Table = "~^audit_"
+	c.Assert(validateCommitTSColumnRules(to, "tidb"), IsNil)
+}
+
+func (t *testDrainerSuite) TestValidateUpsertRules(c *C) {
+	to := &dsync.DBConfig{}
+	c.Assert(validateUpsertRules(to, "kafka"), IsNil)
+
+	to.UpsertRules = []dsync.UpsertRule{{Schema: "test"}}
+	c.Assert(validateUpsertRules(to, "file"), ErrorMatches, "upsert-rule is only supported when db-type is mysql or tidb.*")
+	c.Assert(validateUpsertRules(to, "mysql"), ErrorMatches, "db-name and tbl-name of upsert-rule must be set")
+
+	to.UpsertRules[0].Table = "~^user_"
+	c.Assert(validateUpsertRules(to, "tidb"), IsNil)
 }
 
 func (t *testDrainerSuite) TestEnableDisable(c *C) {
@@ -223,6 +463,13 @@ func (t *testDrainerSuite) TestAdjustConfig(c *C) {
 	c.Assert(cfg.ListenAddr, Equals, "http://0.0.0.0:8257")
 	c.Assert(cfg.AdvertiseAddr, Equals, "http://192.168.15.12:8257")
 
+	cfg = NewConfig()
+	cfg.StatusAddr = "0.0.0.0:8259"
+	err = cfg.adjustConfig()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.StatusAddr, Equals, "http://0.0.0.0:8259")
+	c.Assert(cfg.AdvertiseStatusAddr, Equals, cfg.StatusAddr)
+
 	cfg = NewConfig()
 	encrypted, err := encrypt.Encrypt("origin")
 	c.Assert(err, IsNil)
@@ -284,10 +531,21 @@ func (t *testDrainerSuite) TestConfigParsingFileWithInvalidOptions(c *C) {
 	c.Assert(err, ErrorMatches, ".*contained unknown configuration options: unrecognized-option-test.*")
 }
 
+func (t *testDrainerSuite) TestDDLConnUsesDDLTimeout(c *C) {
+	// the DDLs on the dedicated connection are limited by ddl-timeout, it has no timeout of its own.
+	configFilename := path.Join(c.MkDir(), "drainer_ddl_timeout.toml")
+	content := "[syncer.to]\nddl-timeout = 60\n[syncer.to.ddl]\nenable = true\ntimeout = 30\n"
+	c.Assert(os.WriteFile(configFilename, []byte(content), 0644), IsNil)
+
+	cfg := NewConfig()
+	err := cfg.Parse([]string{"--config", configFilename})
+	c.Assert(err, ErrorMatches, ".*contained unknown configuration options: syncer.to.ddl.timeout.*")
+}
+
 var _ = Suite(&testKafkaSuite{})
 
 type testKafkaSuite struct {
-	origNewZKFromConnectionString func(connectionString string, dialTimeout, sessionTimeout time.Duration) (*pkgzk.Client, error)
+	origNewZKFromConnectionString func(connectionString string, conf *pkgzk.Config) (*pkgzk.Client, error)
 }
 
 func (t *testKafkaSuite) SetUpTest(c *C) {
@@ -323,7 +581,7 @@ func (t *testKafkaSuite) TestConfigDestDBTypeKafka(c *C) {
 		"-addr", "192.168.15.10:8257",
 		"-advertise-addr", "192.168.15.10:8257",
 	}
-	newZKFromConnectionString = func(connectionString string, dialTimeout, sessionTimeout time.Duration) (client *pkgzk.Client, e error) {
+	newZKFromConnectionString = func(connectionString string, conf *pkgzk.Config) (client *pkgzk.Client, e error) {
 		return pkgzk.NewWithConnection(&MockConn{}, nil), nil
 	}
 
@@ -355,3 +613,16 @@ func (t *testKafkaSuite) TestConfigDestDBTypeKafka(c *C) {
 	c.Assert(cfg.SyncerCfg.To.KafkaVersion, Equals, defaultKafkaVersion)
 	c.Assert(cfg.SyncerCfg.To.KafkaMaxMessages, Equals, 1024)
 }
+
+func (t *testKafkaSuite) TestNewZKConfig(c *C) {
+	to := &dsync.DBConfig{ZKAuth: "digest"}
+	_, err := newZKConfig(to)
+	c.Assert(err, ErrorMatches, ".*invalid zookeeper auth.*")
+
+	to.ZKAuth = "digest:user:password"
+	conf, err := newZKConfig(to)
+	c.Assert(err, IsNil)
+	c.Assert(conf.AuthScheme, Equals, "digest")
+	c.Assert(string(conf.Auth), Equals, "user:password")
+	c.Assert(conf.TLS, IsNil)
+}
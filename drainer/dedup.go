@@ -0,0 +1,349 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	pb "github.com/pingcap/tipb/go-binlog"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDedupDirName = "dedup"
+	defaultDedupWindow  = 1800
+	// dedupKeyLen is the length of the key commit ts + table id + row hash.
+	dedupKeyLen = 24
+	// dedupPruneInterval is the interval of removing the rows out of the window.
+	dedupPruneInterval = time.Minute
+)
+
+// DedupConfig is the config of keeping a persistent window of the rows applied to downstream,
+// the rows in the window are skipped when they're synced again after drainer restarts from an
+// older checkpoint, so the initialization phase of safe mode isn't needed.
+type DedupConfig struct {
+	Enable bool `toml:"enable" json:"enable"`
+	// Dir is the directory of the window, data-dir/dedup by default.
+	Dir string `toml:"dir" json:"dir"`
+	// Window is the seconds of the commit ts of the rows kept before the latest applied one.
+	Window int `toml:"window" json:"window"`
+}
+
+func (c *DedupConfig) enabled() bool {
+	return c != nil && c.Enable
+}
+
+func (c *DedupConfig) adjust(dataDir string) {
+	if len(c.Dir) == 0 {
+		c.Dir = filepath.Join(dataDir, defaultDedupDirName)
+	}
+	util.AdjustInt(&c.Window, defaultDedupWindow)
+}
+
+func (c *DedupConfig) validate() error {
+	if c.Window < 0 {
+		return errors.Errorf("invalid window of dedup %d", c.Window)
+	}
+	return nil
+}
+
+// dedupWindow saves the (commit ts, table id, row hash) of the rows of the binlogs synced to
+// downstream in leveldb, and removes the rows of the binlogs synced before from the binlogs
+// being synced again. The row hash is the hash of the encoded row, which contains the handle
+// of the row, so the rows of the tables without primary key are told apart precisely.
+type dedupWindow struct {
+	db     *leveldb.DB
+	window time.Duration
+	// minTS and maxTS are the commit ts range of the window when it's opened, only the binlogs
+	// not after maxTS may be synced before.
+	minTS int64
+	maxTS int64
+
+	mu sync.Mutex
+	// pending are the keys of the rows of the binlogs being synced by commit ts.
+	pending map[int64][][]byte
+	// appliedTS is the max commit ts of the binlogs synced.
+	appliedTS int64
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+func newDedupWindow(cfg *DedupConfig) (*dedupWindow, error) {
+	db, err := leveldb.OpenFile(cfg.Dir, &opt.Options{})
+	if err != nil {
+		return nil, errors.Annotatef(err, "open dedup window %s", cfg.Dir)
+	}
+	w := &dedupWindow{
+		db:      db,
+		window:  time.Duration(cfg.Window) * time.Second,
+		pending: make(map[int64][][]byte),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	iter := db.NewIterator(nil, nil)
+	if iter.First() {
+		w.minTS = dedupKeyTS(iter.Key())
+	}
+	if iter.Last() {
+		w.maxTS = dedupKeyTS(iter.Key())
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		db.Close()
+		return nil, errors.Annotatef(err, "read dedup window %s", cfg.Dir)
+	}
+	w.appliedTS = w.maxTS
+	log.Info("open dedup window", zap.String("dir", cfg.Dir), zap.Int64("min ts", w.minTS), zap.Int64("max ts", w.maxTS))
+	return w, nil
+}
+
+func dedupKey(commitTS int64, tableID int64, row []byte) []byte {
+	h := fnv.New64a()
+	_, _ = h.Write(row)
+	key := make([]byte, dedupKeyLen)
+	binary.BigEndian.PutUint64(key, uint64(commitTS))
+	binary.BigEndian.PutUint64(key[8:], uint64(tableID))
+	binary.BigEndian.PutUint64(key[16:], h.Sum64())
+	return key
+}
+
+func dedupKeyTS(key []byte) int64 {
+	return int64(binary.BigEndian.Uint64(key))
+}
+
+// covers returns whether the rows synced after ts are all in the window, if not, drainer
+// restarts from a checkpoint older than the window and safe mode is still needed.
+func (w *dedupWindow) covers(ts int64) bool {
+	return w.maxTS > 0 && w.minTS <= ts
+}
+
+// prepare removes the rows synced before from the DML binlog, records the keys of the
+// rows left and returns them, it returns nil if all the rows are synced before. No row is
+// removed if bypass, like when the checkpoint is rewound to sync the rows again on purpose.
+func (w *dedupWindow) prepare(binlog *pb.Binlog, pv *pb.PrewriteValue, bypass bool) (*pb.PrewriteValue, error) {
+	commitTS := binlog.GetCommitTs()
+	var keys [][]byte
+	var skipped int
+	muts := pv.GetMutations()
+	if commitTS <= w.maxTS && !bypass {
+		muts = muts[:0:0]
+		for i := range pv.Mutations {
+			mut, n, err := w.filterMutation(commitTS, &pv.Mutations[i])
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			skipped += n
+			if mut != nil {
+				muts = append(muts, *mut)
+			}
+		}
+	}
+	for i := range muts {
+		keys = append(keys, mutationKeys(commitTS, &muts[i])...)
+	}
+
+	if skipped > 0 {
+		log.Info("skip the rows synced before", zap.Int64("commit ts", commitTS), zap.Int("count", skipped))
+		if len(muts) == 0 {
+			return nil, nil
+		}
+		pv = &pb.PrewriteValue{SchemaVersion: pv.SchemaVersion, Mutations: muts}
+	}
+	if len(keys) > 0 {
+		w.mu.Lock()
+		w.pending[commitTS] = append(w.pending[commitTS], keys...)
+		w.mu.Unlock()
+	}
+	return pv, nil
+}
+
+// filterMutation returns the mutation without the rows in the window and the number of the
+// rows removed, the mutation is nil if all its rows are removed.
+func (w *dedupWindow) filterMutation(commitTS int64, mut *pb.TableMutation) (*pb.TableMutation, int, error) {
+	var err error
+	skipped := 0
+	keep := func(rows [][]byte) [][]byte {
+		var kept [][]byte
+		for _, row := range rows {
+			if err != nil {
+				return nil
+			}
+			var has bool
+			has, err = w.db.Has(dedupKey(commitTS, mut.GetTableId(), row), nil)
+			if !has {
+				kept = append(kept, row)
+			} else {
+				skipped++
+			}
+		}
+		return kept
+	}
+	if len(mut.GetSequence()) > 0 {
+		// keep the order of the rows left.
+		filtered := &pb.TableMutation{TableId: mut.TableId}
+		var inserted, updated, deleted int
+		for _, tp := range mut.GetSequence() {
+			var rows [][]byte
+			switch tp {
+			case pb.MutationType_Insert:
+				rows, inserted = keep(mut.InsertedRows[inserted:inserted+1]), inserted+1
+				filtered.InsertedRows = append(filtered.InsertedRows, rows...)
+			case pb.MutationType_Update:
+				rows, updated = keep(mut.UpdatedRows[updated:updated+1]), updated+1
+				filtered.UpdatedRows = append(filtered.UpdatedRows, rows...)
+			case pb.MutationType_DeleteRow:
+				rows, deleted = keep(mut.DeletedRows[deleted:deleted+1]), deleted+1
+				filtered.DeletedRows = append(filtered.DeletedRows, rows...)
+			default:
+				return nil, 0, errors.Errorf("unknown mutation type %v", tp)
+			}
+			if len(rows) > 0 {
+				filtered.Sequence = append(filtered.Sequence, tp)
+			}
+		}
+		if err != nil {
+			return nil, 0, errors.Annotate(err, "read dedup window")
+		}
+		if len(filtered.Sequence) == 0 {
+			return nil, skipped, nil
+		}
+		return filtered, skipped, nil
+	}
+
+	filtered := &pb.TableMutation{
+		TableId:      mut.TableId,
+		InsertedRows: keep(mut.InsertedRows),
+		UpdatedRows:  keep(mut.UpdatedRows),
+		DeletedRows:  keep(mut.DeletedRows),
+	}
+	if err != nil {
+		return nil, 0, errors.Annotate(err, "read dedup window")
+	}
+	if len(filtered.InsertedRows)+len(filtered.UpdatedRows)+len(filtered.DeletedRows) == 0 {
+		return nil, skipped, nil
+	}
+	return filtered, skipped, nil
+}
+
+func mutationKeys(commitTS int64, mut *pb.TableMutation) [][]byte {
+	keys := make([][]byte, 0, len(mut.InsertedRows)+len(mut.UpdatedRows)+len(mut.DeletedRows))
+	for _, rows := range [][][]byte{mut.InsertedRows, mut.UpdatedRows, mut.DeletedRows} {
+		for _, row := range rows {
+			keys = append(keys, dedupKey(commitTS, mut.GetTableId(), row))
+		}
+	}
+	return keys
+}
+
+// dedupCovers returns whether the rows synced after the checkpoint are all in the dedup window, it's
+// false while the checkpoint is rewound, since the rows are synced again on purpose then.
+func (s *Syncer) dedupCovers() bool {
+	return s.dedup != nil && s.dedup.covers(s.cp.TS()) && s.cp.SafeModeUntilTS() == 0
+}
+
+// dedupRows removes the rows synced before from the DML binlog by the dedup window, no row is
+// removed while the checkpoint is rewound.
+func (s *Syncer) dedupRows(binlog *pb.Binlog, pv *pb.PrewriteValue) (*pb.PrewriteValue, error) {
+	return s.dedup.prepare(binlog, pv, s.cp.SafeModeUntilTS() > 0)
+}
+
+// synced saves the rows of the binlog synced to downstream into the window.
+func (w *dedupWindow) synced(commitTS int64) error {
+	w.mu.Lock()
+	keys, ok := w.pending[commitTS]
+	delete(w.pending, commitTS)
+	if commitTS > w.appliedTS {
+		w.appliedTS = commitTS
+	}
+	w.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	var batch leveldb.Batch
+	for _, key := range keys {
+		batch.Put(key, nil)
+	}
+	return errors.Annotate(w.db.Write(&batch, nil), "write dedup window")
+}
+
+// prune removes the rows older than the window before the latest synced binlog.
+func (w *dedupWindow) prune() error {
+	w.mu.Lock()
+	appliedTS := w.appliedTS
+	w.mu.Unlock()
+	physical := oracle.ExtractPhysical(uint64(appliedTS)) - w.window.Milliseconds()
+	if appliedTS == 0 || physical <= 0 {
+		return nil
+	}
+	limit := make([]byte, 8)
+	binary.BigEndian.PutUint64(limit, oracle.ComposeTS(physical, 0))
+
+	iter := w.db.NewIterator(&lutil.Range{Limit: limit}, nil)
+	defer iter.Release()
+	var batch leveldb.Batch
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+		if batch.Len() >= 1024 {
+			if err := w.db.Write(&batch, nil); err != nil {
+				return errors.Trace(err)
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(w.db.Write(&batch, nil))
+}
+
+// run prunes the window periodically until it's closed.
+func (w *dedupWindow) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(dedupPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.quit:
+			return
+		case <-ticker.C:
+			if err := w.prune(); err != nil {
+				log.Warn("prune dedup window failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// close stops pruning and closes the window.
+func (w *dedupWindow) close() {
+	close(w.quit)
+	<-w.done
+	if err := w.db.Close(); err != nil {
+		log.Warn("close dedup window failed", zap.Error(err))
+	}
+}
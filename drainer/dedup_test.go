@@ -0,0 +1,190 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"path/filepath"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	pb "github.com/pingcap/tipb/go-binlog"
+)
+
+type dedupSuite struct{}
+
+var _ = Suite(&dedupSuite{})
+
+func (s *dedupSuite) open(c *C, dir string) *dedupWindow {
+	cfg := &DedupConfig{Enable: true, Dir: dir}
+	cfg.adjust("")
+	c.Assert(cfg.validate(), IsNil)
+	w, err := newDedupWindow(cfg)
+	c.Assert(err, IsNil)
+	go w.run()
+	return w
+}
+
+func dedupTestPrewrite() *pb.PrewriteValue {
+	return &pb.PrewriteValue{SchemaVersion: 1, Mutations: []pb.TableMutation{
+		{
+			TableId:      1,
+			InsertedRows: [][]byte{[]byte("i1"), []byte("i2")},
+			DeletedRows:  [][]byte{[]byte("d1")},
+			Sequence:     []pb.MutationType{pb.MutationType_Insert, pb.MutationType_DeleteRow, pb.MutationType_Insert},
+		},
+		{
+			TableId:     2,
+			UpdatedRows: [][]byte{[]byte("u1")},
+		},
+	}}
+}
+
+func (s *dedupSuite) TestSkipSyncedRows(c *C) {
+	dir := c.MkDir()
+	w := s.open(c, dir)
+	c.Assert(w.covers(100), IsFalse)
+
+	binlog := &pb.Binlog{CommitTs: 100}
+	pv, err := w.prepare(binlog, dedupTestPrewrite(), false)
+	c.Assert(err, IsNil)
+	c.Assert(pv, DeepEquals, dedupTestPrewrite())
+	c.Assert(w.synced(100), IsNil)
+	c.Assert(w.pending, HasLen, 0)
+
+	// the second table of 200 isn't synced before drainer restarts.
+	pv, err = w.prepare(&pb.Binlog{CommitTs: 200}, dedupTestPrewrite(), false)
+	c.Assert(err, IsNil)
+	w.mu.Lock()
+	w.pending[200] = w.pending[200][:3]
+	w.mu.Unlock()
+	c.Assert(w.synced(200), IsNil)
+	w.close()
+
+	w = s.open(c, dir)
+	defer w.close()
+	c.Assert(w.covers(50), IsFalse)
+	c.Assert(w.covers(100), IsTrue)
+
+	pv, err = w.prepare(binlog, dedupTestPrewrite(), false)
+	c.Assert(err, IsNil)
+	c.Assert(pv, IsNil)
+	pv, err = w.prepare(&pb.Binlog{CommitTs: 200}, dedupTestPrewrite(), false)
+	c.Assert(err, IsNil)
+	c.Assert(pv, DeepEquals, &pb.PrewriteValue{SchemaVersion: 1, Mutations: []pb.TableMutation{
+		{TableId: 2, UpdatedRows: [][]byte{[]byte("u1")}},
+	}})
+
+	// the rows of the binlog after the window aren't looked up.
+	pv, err = w.prepare(&pb.Binlog{CommitTs: 300}, dedupTestPrewrite(), false)
+	c.Assert(err, IsNil)
+	c.Assert(pv, DeepEquals, dedupTestPrewrite())
+}
+
+func (s *dedupSuite) TestRewindInWindow(c *C) {
+	dir := c.MkDir()
+	w := s.open(c, dir)
+	for _, ts := range []int64{100, 200} {
+		_, err := w.prepare(&pb.Binlog{CommitTs: ts}, dedupTestPrewrite(), false)
+		c.Assert(err, IsNil)
+		c.Assert(w.synced(ts), IsNil)
+	}
+	w.close()
+
+	w = s.open(c, dir)
+	defer w.close()
+	cp, err := checkpoint.NewFile(0, c.MkDir()+"/checkpoint")
+	c.Assert(err, IsNil)
+	c.Assert(cp.Save(200, 0, true, 1), IsNil)
+	syncer := &Syncer{cp: cp, dedup: w}
+	c.Assert(syncer.dedupCovers(), IsTrue)
+	pv, err := syncer.dedupRows(&pb.Binlog{CommitTs: 200}, dedupTestPrewrite())
+	c.Assert(err, IsNil)
+	c.Assert(pv, IsNil)
+
+	// the checkpoint is rewound into the window, the rows are synced again with safe mode.
+	c.Assert(checkpoint.Rewind(cp, 150, 1), IsNil)
+	c.Assert(syncer.dedupCovers(), IsFalse)
+	pv, err = syncer.dedupRows(&pb.Binlog{CommitTs: 200}, dedupTestPrewrite())
+	c.Assert(err, IsNil)
+	c.Assert(pv, DeepEquals, dedupTestPrewrite())
+	c.Assert(w.synced(200), IsNil)
+
+	// the rows are skipped again once the checkpoint reaches the ts before rewinding.
+	c.Assert(cp.Save(200, 0, true, 1), IsNil)
+	c.Assert(cp.SafeModeUntilTS(), Equals, int64(0))
+	pv, err = syncer.dedupRows(&pb.Binlog{CommitTs: 200}, dedupTestPrewrite())
+	c.Assert(err, IsNil)
+	c.Assert(pv, IsNil)
+}
+
+func (s *dedupSuite) TestKeepSequence(c *C) {
+	w := s.open(c, c.MkDir())
+	defer w.close()
+
+	// only the row i2 is synced before.
+	pv, err := w.prepare(&pb.Binlog{CommitTs: 100}, dedupTestPrewrite(), false)
+	c.Assert(err, IsNil)
+	w.mu.Lock()
+	w.pending[100] = w.pending[100][1:2]
+	w.mu.Unlock()
+	c.Assert(w.synced(100), IsNil)
+	w.maxTS = 100
+
+	pv, err = w.prepare(&pb.Binlog{CommitTs: 100}, dedupTestPrewrite(), false)
+	c.Assert(err, IsNil)
+	c.Assert(pv.Mutations, DeepEquals, []pb.TableMutation{
+		{
+			TableId:      1,
+			InsertedRows: [][]byte{[]byte("i1")},
+			DeletedRows:  [][]byte{[]byte("d1")},
+			Sequence:     []pb.MutationType{pb.MutationType_Insert, pb.MutationType_DeleteRow},
+		},
+		{
+			TableId:     2,
+			UpdatedRows: [][]byte{[]byte("u1")},
+		},
+	})
+}
+
+func (s *dedupSuite) TestPrune(c *C) {
+	dir := c.MkDir()
+	w := s.open(c, dir)
+
+	now := time.Now()
+	oldTS := int64(oracle.ComposeTS(oracle.GetPhysical(now.Add(-time.Hour)), 0))
+	newTS := int64(oracle.ComposeTS(oracle.GetPhysical(now), 0))
+	for _, ts := range []int64{oldTS, newTS} {
+		_, err := w.prepare(&pb.Binlog{CommitTs: ts}, dedupTestPrewrite(), false)
+		c.Assert(err, IsNil)
+		c.Assert(w.synced(ts), IsNil)
+	}
+	c.Assert(w.prune(), IsNil)
+	w.close()
+
+	w = s.open(c, dir)
+	defer w.close()
+	c.Assert(w.minTS, Equals, newTS)
+	c.Assert(w.maxTS, Equals, newTS)
+}
+
+func (s *dedupSuite) TestValidate(c *C) {
+	cfg := &DedupConfig{Enable: true}
+	cfg.adjust("data.drainer")
+	c.Assert(cfg.Dir, Equals, filepath.Join("data.drainer", "dedup"))
+	c.Assert(cfg.Window, Equals, defaultDedupWindow)
+	cfg.Window = -1
+	c.Assert(cfg.validate(), ErrorMatches, "invalid window of dedup -1")
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	pd "github.com/tikv/pd/client"
+	"go.uber.org/zap"
+)
+
+const defaultGCSafePointTTL = 24 * 60 * 60
+
+var gcSafePointUpdateInterval = time.Minute
+
+// GCSafePointConfig is the configuration of the service GC safepoint drainer registers
+// in PD at its checkpoint, so TiKV keeps the versions after the checkpoint which are
+// needed to load the DDL jobs and the schema when drainer restarts.
+type GCSafePointConfig struct {
+	// TTL is the seconds PD keeps the safepoint after drainer stops updating it,
+	// it's disabled if TTL is 0.
+	TTL int64 `toml:"ttl" json:"ttl"`
+	// MaxLag caps how far the safepoint holds GC back, it's never more than MaxLag
+	// seconds before now, 0 means no cap.
+	MaxLag int64 `toml:"max-lag" json:"max-lag"`
+}
+
+func (c *GCSafePointConfig) enabled() bool {
+	return c.TTL > 0
+}
+
+func (c *GCSafePointConfig) validate() error {
+	if c.TTL < 0 || c.MaxLag < 0 {
+		return errors.New("ttl and max-lag of gc-safepoint can't be negative")
+	}
+	return nil
+}
+
+// gcSafePointKeeper keeps the service GC safepoint of drainer at its checkpoint.
+type gcSafePointKeeper struct {
+	pdCli     pd.Client
+	serviceID string
+	cfg       GCSafePointConfig
+	cp        checkpoint.CheckPoint
+}
+
+func newGCSafePointKeeper(pdCli pd.Client, nodeID string, cfg GCSafePointConfig, cp checkpoint.CheckPoint) *gcSafePointKeeper {
+	return &gcSafePointKeeper{pdCli: pdCli, serviceID: "tidb-binlog-drainer-" + nodeID, cfg: cfg, cp: cp}
+}
+
+// safePoint returns the checkpoint, or the ts MaxLag seconds ago if the checkpoint is before it.
+func (k *gcSafePointKeeper) safePoint() int64 {
+	ts := k.cp.TS()
+	if k.cfg.MaxLag > 0 {
+		floor := oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-time.Duration(k.cfg.MaxLag)*time.Second)), 0)
+		if ts < int64(floor) {
+			ts = int64(floor)
+		}
+	}
+	return ts
+}
+
+func (k *gcSafePointKeeper) update(ctx context.Context) error {
+	ts := k.safePoint()
+	minSafePoint, err := k.pdCli.UpdateServiceGCSafePoint(ctx, k.serviceID, k.cfg.TTL, uint64(ts))
+	if err != nil {
+		return errors.Annotatef(err, "update service GC safepoint %s", k.serviceID)
+	}
+	gcSafePointGauge.Set(float64(oracle.ExtractPhysical(uint64(ts))))
+	if int64(minSafePoint) > ts {
+		log.Warn("the GC safepoint of the cluster is after drainer's, the versions needed may be GCed",
+			zap.Uint64("cluster safepoint", minSafePoint), zap.Int64("drainer safepoint", ts), zap.Int64("checkpoint", k.cp.TS()))
+	}
+	return nil
+}
+
+// run updates the safepoint every gcSafePointUpdateInterval until ctx is done.
+func (k *gcSafePointKeeper) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(gcSafePointUpdateInterval):
+		}
+		if err := k.update(ctx); err != nil && ctx.Err() == nil {
+			log.Warn("update GC safepoint failed", zap.Error(err))
+		}
+	}
+}
+
+// remove removes the safepoint when drainer is offline, then it doesn't hold GC back any more.
+func (k *gcSafePointKeeper) remove(ctx context.Context) error {
+	// the safepoint with a non-positive ttl is removed.
+	_, err := k.pdCli.UpdateServiceGCSafePoint(ctx, k.serviceID, 0, 0)
+	return errors.Annotatef(err, "remove service GC safepoint %s", k.serviceID)
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"context"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	pd "github.com/tikv/pd/client"
+)
+
+// gcSafePointPdCli records the service GC safepoints updated.
+type gcSafePointPdCli struct {
+	pd.Client
+	serviceID    string
+	ttl          int64
+	safePoint    uint64
+	minSafePoint uint64
+}
+
+func (pc *gcSafePointPdCli) UpdateServiceGCSafePoint(ctx context.Context, serviceID string, ttl int64, safePoint uint64) (uint64, error) {
+	pc.serviceID, pc.ttl, pc.safePoint = serviceID, ttl, safePoint
+	return pc.minSafePoint, nil
+}
+
+type gcSafePointSuite struct{}
+
+var _ = Suite(&gcSafePointSuite{})
+
+func (s *gcSafePointSuite) TestUpdate(c *C) {
+	pdCli := &gcSafePointPdCli{minSafePoint: 100}
+	cp := &dummyCheckpoint{commitTS: 1024}
+	k := newGCSafePointKeeper(pdCli, "d1", GCSafePointConfig{TTL: 60}, cp)
+
+	c.Assert(k.update(context.Background()), IsNil)
+	c.Assert(pdCli.serviceID, Equals, "tidb-binlog-drainer-d1")
+	c.Assert(pdCli.ttl, Equals, int64(60))
+	c.Assert(pdCli.safePoint, Equals, uint64(1024))
+
+	// the safepoint is capped to max-lag before now.
+	k.cfg.MaxLag = 3600
+	c.Assert(k.update(context.Background()), IsNil)
+	lag := time.Since(oracle.GetTimeFromTS(pdCli.safePoint))
+	c.Assert(lag > 59*time.Minute && lag < 61*time.Minute, IsTrue, Commentf("lag %s", lag))
+
+	now := int64(oracle.ComposeTS(oracle.GetPhysical(time.Now()), 0))
+	cp.commitTS = now
+	c.Assert(k.update(context.Background()), IsNil)
+	c.Assert(pdCli.safePoint, Equals, uint64(now))
+
+	c.Assert(k.remove(context.Background()), IsNil)
+	c.Assert(pdCli.ttl, Equals, int64(0))
+}
+
+func (s *gcSafePointSuite) TestValidate(c *C) {
+	cfg := NewConfig()
+	c.Assert(cfg.GCSafePoint.enabled(), IsTrue)
+	cfg.GCSafePoint.MaxLag = -1
+	c.Assert(cfg.GCSafePoint.validate(), ErrorMatches, ".*can't be negative")
+}
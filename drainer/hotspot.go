@@ -0,0 +1,306 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	pb "github.com/pingcap/tipb/go-binlog"
+	"github.com/unrolled/render"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultHotspotSampleRate  = 0.01
+	defaultHotspotWindow      = 60
+	defaultHotspotWindowCount = 10
+	defaultHotspotRangeSize   = 1000
+	defaultHotspotTopN        = 10
+)
+
+// HotspotConfig is the config of sampling the keys of the rows synced to downstream,
+// to find the hot ranges of the tables before they become the hotspots of downstream.
+type HotspotConfig struct {
+	Enable bool `toml:"enable" json:"enable"`
+	// SampleRate is the ratio of the DML binlogs sampled.
+	SampleRate float64 `toml:"sample-rate" json:"sample-rate"`
+	// Window is the seconds of a time window the keys are counted in.
+	Window int `toml:"window" json:"window"`
+	// WindowCount is the number of the latest windows kept.
+	WindowCount int `toml:"window-count" json:"window-count"`
+	// RangeSize is the size of the ranges the integer keys are counted by,
+	// the other keys are counted by the values.
+	RangeSize int64 `toml:"range-size" json:"range-size"`
+	// TopN is the number of the hottest ranges of a table returned by default.
+	TopN int `toml:"top-n" json:"top-n"`
+}
+
+func (c *HotspotConfig) enabled() bool {
+	return c != nil && c.Enable
+}
+
+func (c *HotspotConfig) adjust() {
+	if c.SampleRate == 0 {
+		c.SampleRate = defaultHotspotSampleRate
+	}
+	util.AdjustInt(&c.Window, defaultHotspotWindow)
+	util.AdjustInt(&c.WindowCount, defaultHotspotWindowCount)
+	if c.RangeSize <= 0 {
+		c.RangeSize = defaultHotspotRangeSize
+	}
+	util.AdjustInt(&c.TopN, defaultHotspotTopN)
+}
+
+func (c *HotspotConfig) validate() error {
+	if c.SampleRate <= 0 || c.SampleRate > 1 {
+		return errors.Errorf("invalid sample-rate of hotspot: %v, must be in (0, 1]", c.SampleRate)
+	}
+	return nil
+}
+
+// HotRange is a range of the keys of a table, Start equals End if it's counted by the value.
+type HotRange struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Count is the number of the sampled rows written in the range.
+	Count int64 `json:"count"`
+}
+
+// HotspotWindow is the hottest ranges of every table in a time window.
+type HotspotWindow struct {
+	Start  time.Time              `json:"start"`
+	Tables map[string][]*HotRange `json:"tables"`
+}
+
+type hotRangeKey struct {
+	start string
+	end   string
+}
+
+type hotspotWindow struct {
+	start  time.Time
+	tables map[string]map[hotRangeKey]int64
+}
+
+// hotspotSampler counts the keys of the sampled rows by table and time window.
+type hotspotSampler struct {
+	cfg *HotspotConfig
+
+	mu sync.Mutex
+	// windows are ordered by start time, the oldest one is first.
+	windows []*hotspotWindow
+
+	random func() float64
+	now    func() time.Time
+}
+
+func newHotspotSampler(cfg *HotspotConfig) *hotspotSampler {
+	return &hotspotSampler{
+		cfg:    cfg,
+		random: rand.Float64,
+		now:    time.Now,
+	}
+}
+
+// sample counts the keys of the rows in the mutations if the binlog is sampled,
+// the rows are decoded like the ones written to MySQL.
+func (h *hotspotSampler) sample(binlog *pb.Binlog, pv *pb.PrewriteValue, schema *Schema) {
+	if h.random() >= h.cfg.SampleRate {
+		return
+	}
+	for _, mut := range pv.GetMutations() {
+		info, ok := schema.TableByID(mut.GetTableId())
+		if !ok {
+			continue
+		}
+		keys := keyColumns(info)
+		if len(keys) == 0 {
+			continue
+		}
+		single := &pb.PrewriteValue{SchemaVersion: pv.SchemaVersion, Mutations: []pb.TableMutation{mut}}
+		txn, err := translator.TiBinlogToTxn(translator.NewContext(schema, binlog, single))
+		if err != nil {
+			log.Warn("decode rows to sample failed", zap.Int64("table id", mut.GetTableId()), zap.Error(err))
+			continue
+		}
+		for _, dml := range txn.DMLs {
+			h.record(dml.TableName(), h.rangeOf(keys, dml.Values))
+		}
+	}
+}
+
+func (h *hotspotSampler) record(table string, r hotRangeKey) {
+	now := h.now()
+	window := time.Duration(h.cfg.Window) * time.Second
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var last *hotspotWindow
+	if len(h.windows) > 0 {
+		last = h.windows[len(h.windows)-1]
+	}
+	if last == nil || !now.Before(last.start.Add(window)) {
+		last = &hotspotWindow{start: now.Truncate(window), tables: make(map[string]map[hotRangeKey]int64)}
+		h.windows = append(h.windows, last)
+		if len(h.windows) > h.cfg.WindowCount {
+			h.windows = h.windows[len(h.windows)-h.cfg.WindowCount:]
+		}
+	}
+	ranges, ok := last.tables[table]
+	if !ok {
+		ranges = make(map[hotRangeKey]int64)
+		last.tables[table] = ranges
+	}
+	ranges[r]++
+}
+
+// rangeOf returns the range of the row by the values of the key columns.
+func (h *hotspotSampler) rangeOf(keys []string, values map[string]interface{}) hotRangeKey {
+	if len(keys) == 1 {
+		size := h.cfg.RangeSize
+		switch v := values[keys[0]].(type) {
+		case int64:
+			start := v - (v%size+size)%size
+			return hotRangeKey{start: strconv.FormatInt(start, 10), end: strconv.FormatInt(start+size, 10)}
+		case uint64:
+			start := v - v%uint64(size)
+			return hotRangeKey{start: strconv.FormatUint(start, 10), end: strconv.FormatUint(start+uint64(size), 10)}
+		}
+	}
+
+	strs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		switch v := values[key].(type) {
+		case []byte:
+			strs = append(strs, string(v))
+		case nil:
+			strs = append(strs, "NULL")
+		default:
+			strs = append(strs, fmt.Sprint(v))
+		}
+	}
+	value := strings.Join(strs, ",")
+	return hotRangeKey{start: value, end: value}
+}
+
+// keyColumns returns the names of the columns identifying the rows, they're the primary key
+// or the first unique key with not null columns, nil if there is neither of them.
+func keyColumns(info *model.TableInfo) []string {
+	if info.PKIsHandle {
+		for _, col := range info.Columns {
+			if mysql.HasPriKeyFlag(col.Flag) {
+				return []string{col.Name.O}
+			}
+		}
+	}
+	for _, idx := range info.Indices {
+		if idx.Primary {
+			return indexColumnNames(idx)
+		}
+	}
+	for _, idx := range info.Indices {
+		if !idx.Unique || idx.State != model.StatePublic {
+			continue
+		}
+		notNull := true
+		for _, col := range idx.Columns {
+			notNull = notNull && mysql.HasNotNullFlag(info.Columns[col.Offset].Flag)
+		}
+		if notNull {
+			return indexColumnNames(idx)
+		}
+	}
+	return nil
+}
+
+func indexColumnNames(idx *model.IndexInfo) []string {
+	names := make([]string, 0, len(idx.Columns))
+	for _, col := range idx.Columns {
+		names = append(names, col.Name.O)
+	}
+	return names
+}
+
+// hotspots returns the topN hottest ranges of every table in the windows, the latest window is first.
+func (h *hotspotSampler) hotspots(topN int) []*HotspotWindow {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	windows := make([]*HotspotWindow, 0, len(h.windows))
+	for i := len(h.windows) - 1; i >= 0; i-- {
+		w := h.windows[i]
+		hw := &HotspotWindow{Start: w.start, Tables: make(map[string][]*HotRange, len(w.tables))}
+		for table, ranges := range w.tables {
+			hot := make([]*HotRange, 0, len(ranges))
+			for r, count := range ranges {
+				hot = append(hot, &HotRange{Start: r.start, End: r.end, Count: count})
+			}
+			sort.Slice(hot, func(i, j int) bool {
+				if hot[i].Count != hot[j].Count {
+					return hot[i].Count > hot[j].Count
+				}
+				return hot[i].Start < hot[j].Start
+			})
+			if len(hot) > topN {
+				hot = hot[:topN]
+			}
+			hw.Tables[table] = hot
+		}
+		windows = append(windows, hw)
+	}
+	return windows
+}
+
+// GetHotspots returns the hottest ranges of the tables in the latest time windows,
+// the number of the ranges of a table is set by the query parameter `top`.
+func (s *Server) GetHotspots(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	renderJSON := func(resp *util.Response) {
+		if err := rd.JSON(w, http.StatusOK, resp); err != nil {
+			log.Error("Failed to render JSON response", zap.Error(err))
+		}
+	}
+
+	if s.syncer.hotspot == nil {
+		renderJSON(util.ErrCodeResponsef(errorcode.InvalidState, "hotspot sampling is not enabled"))
+		return
+	}
+
+	topN := s.cfg.SyncerCfg.Hotspot.TopN
+	if top := r.URL.Query().Get("top"); len(top) > 0 {
+		n, err := strconv.Atoi(top)
+		if err != nil || n <= 0 {
+			renderJSON(util.ErrCodeResponsef(errorcode.InvalidArgument, "invalid top: %s", top))
+			return
+		}
+		topN = n
+	}
+	renderJSON(util.SuccessResponse("success", s.syncer.hotspot.hotspots(topN)))
+}
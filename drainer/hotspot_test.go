@@ -0,0 +1,138 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/types"
+)
+
+type hotspotSuite struct{}
+
+var _ = Suite(&hotspotSuite{})
+
+func newHotspotTestSampler(now *time.Time) *hotspotSampler {
+	cfg := &HotspotConfig{Enable: true, WindowCount: 2}
+	cfg.adjust()
+	h := newHotspotSampler(cfg)
+	h.now = func() time.Time { return *now }
+	return h
+}
+
+func (s *hotspotSuite) TestKeyColumns(c *C) {
+	col := func(name string, flag uint) *model.ColumnInfo {
+		ft := types.NewFieldType(mysql.TypeLong)
+		ft.Flag = flag
+		return &model.ColumnInfo{Name: model.NewCIStr(name), Offset: len(name) - 1, FieldType: *ft}
+	}
+	index := func(unique bool, primary bool, cols ...*model.ColumnInfo) *model.IndexInfo {
+		idx := &model.IndexInfo{Unique: unique, Primary: primary, State: model.StatePublic}
+		for _, col := range cols {
+			idx.Columns = append(idx.Columns, &model.IndexColumn{Name: col.Name, Offset: col.Offset})
+		}
+		return idx
+	}
+
+	a, bb, ccc := col("a", mysql.PriKeyFlag|mysql.NotNullFlag), col("bb", mysql.NotNullFlag), col("ccc", 0)
+	info := &model.TableInfo{Columns: []*model.ColumnInfo{a, bb, ccc}, PKIsHandle: true}
+	c.Assert(keyColumns(info), DeepEquals, []string{"a"})
+
+	info.PKIsHandle = false
+	info.Indices = []*model.IndexInfo{index(true, false, ccc), index(true, false, bb, a)}
+	c.Assert(keyColumns(info), DeepEquals, []string{"bb", "a"})
+
+	info.Indices = append(info.Indices, index(true, true, ccc, bb))
+	c.Assert(keyColumns(info), DeepEquals, []string{"ccc", "bb"})
+
+	info.Indices = []*model.IndexInfo{index(true, false, ccc), index(false, false, bb)}
+	c.Assert(keyColumns(info), IsNil)
+}
+
+func (s *hotspotSuite) TestRangeOf(c *C) {
+	now := time.Now()
+	h := newHotspotTestSampler(&now)
+
+	c.Assert(h.rangeOf([]string{"id"}, map[string]interface{}{"id": int64(1234)}), Equals, hotRangeKey{start: "1000", end: "2000"})
+	c.Assert(h.rangeOf([]string{"id"}, map[string]interface{}{"id": int64(-1)}), Equals, hotRangeKey{start: "-1000", end: "0"})
+	c.Assert(h.rangeOf([]string{"id"}, map[string]interface{}{"id": uint64(999)}), Equals, hotRangeKey{start: "0", end: "1000"})
+	c.Assert(h.rangeOf([]string{"id"}, map[string]interface{}{"id": []byte("abc")}), Equals, hotRangeKey{start: "abc", end: "abc"})
+	c.Assert(h.rangeOf([]string{"a", "b"}, map[string]interface{}{"a": int64(1), "b": nil}), Equals, hotRangeKey{start: "1,NULL", end: "1,NULL"})
+}
+
+func (s *hotspotSuite) TestWindows(c *C) {
+	now := time.Unix(1600000000, 0)
+	h := newHotspotTestSampler(&now)
+
+	for i := 0; i < 3; i++ {
+		h.record("`test`.`t1`", hotRangeKey{start: "0", end: "1000"})
+	}
+	h.record("`test`.`t1`", hotRangeKey{start: "1000", end: "2000"})
+	h.record("`test`.`t2`", hotRangeKey{start: "a", end: "a"})
+
+	windows := h.hotspots(1)
+	c.Assert(windows, HasLen, 1)
+	c.Assert(windows[0].Start, Equals, now.Truncate(time.Minute))
+	c.Assert(windows[0].Tables, DeepEquals, map[string][]*HotRange{
+		"`test`.`t1`": {{Start: "0", End: "1000", Count: 3}},
+		"`test`.`t2`": {{Start: "a", End: "a", Count: 1}},
+	})
+
+	// only the latest window-count windows are kept.
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Minute)
+		h.record("`test`.`t1`", hotRangeKey{start: "1000", end: "2000"})
+	}
+	windows = h.hotspots(10)
+	c.Assert(windows, HasLen, 2)
+	c.Assert(windows[0].Start, Equals, now.Truncate(time.Minute))
+	c.Assert(windows[1].Start, Equals, now.Add(-time.Minute).Truncate(time.Minute))
+	c.Assert(windows[0].Tables["`test`.`t1`"], DeepEquals, []*HotRange{{Start: "1000", End: "2000", Count: 1}})
+}
+
+func (s *hotspotSuite) TestGetHotspots(c *C) {
+	now := time.Unix(1600000000, 0)
+	cfg := NewConfig()
+	server := &Server{cfg: cfg, syncer: &Syncer{}}
+	router := server.initAPIRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/debug/hotspot", nil))
+	c.Assert(w.Body.String(), Matches, `(?s).*"error_code": "INVALID_STATE".*`)
+
+	server.syncer.hotspot = newHotspotTestSampler(&now)
+	cfg.SyncerCfg.Hotspot = server.syncer.hotspot.cfg
+	server.syncer.hotspot.record("`test`.`t1`", hotRangeKey{start: "0", end: "1000"})
+	server.syncer.hotspot.record("`test`.`t1`", hotRangeKey{start: "1000", end: "2000"})
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/debug/hotspot?top=1", nil))
+	var resp struct {
+		Code int              `json:"code"`
+		Data []*HotspotWindow `json:"data"`
+	}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &resp), IsNil)
+	c.Assert(resp.Code, Equals, 200)
+	c.Assert(resp.Data, HasLen, 1)
+	c.Assert(resp.Data[0].Tables["`test`.`t1`"], HasLen, 1)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/debug/hotspot?top=x", nil))
+	c.Assert(w.Body.String(), Matches, `(?s).*"error_code": "INVALID_ARGUMENT".*`)
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"strings"
+
+	"github.com/pingcap/parser/model"
+)
+
+// The internal operations of TiDB are the DDL jobs only meaningful to TiDB itself, like the ADMIN
+// statements and LOCK TABLES, and the DDLs and DMLs of its system tables, like the statistics.
+const (
+	internalOperationsSkip = "skip"
+	internalOperationsSync = "sync"
+)
+
+const systemSchema = "mysql"
+
+// internalTables are the system tables of TiDB in the mysql schema, the ones ending with "_" are prefixes.
+var internalTables = []string{
+	"tidb",
+	"stats_",
+	"gc_delete_range",
+	"gc_delete_range_done",
+	"bind_info",
+	"opt_rule_blacklist",
+	"expr_pushdown_blacklist",
+	"capture_plan_baselines_blacklist",
+	"schema_index_usage",
+}
+
+// isInternalTable returns whether the table is a system table of TiDB, maintained by TiDB itself.
+func isInternalTable(schema, table string) bool {
+	if !strings.EqualFold(schema, systemSchema) {
+		return false
+	}
+	table = strings.ToLower(table)
+	for _, name := range internalTables {
+		if table == name || (strings.HasSuffix(name, "_") && strings.HasPrefix(table, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInternalDDLJob returns whether the job is an internal operation of TiDB instead of a schema change
+// meaningful to downstream.
+func isInternalDDLJob(job *model.Job) bool {
+	switch job.Type {
+	case model.ActionLockTable, model.ActionUnlockTable, model.ActionRepairTable, model.ActionUpdateTiFlashReplicaStatus:
+		return true
+	}
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(job.Query)), "ADMIN ")
+}
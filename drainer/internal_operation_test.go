@@ -0,0 +1,41 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+)
+
+type internalOperationSuite struct{}
+
+var _ = check.Suite(&internalOperationSuite{})
+
+func (s *internalOperationSuite) TestIsInternalTable(c *check.C) {
+	c.Assert(isInternalTable("mysql", "stats_meta"), check.IsTrue)
+	c.Assert(isInternalTable("MySQL", "STATS_HISTOGRAMS"), check.IsTrue)
+	c.Assert(isInternalTable("mysql", "gc_delete_range_done"), check.IsTrue)
+	c.Assert(isInternalTable("mysql", "tidb"), check.IsTrue)
+	c.Assert(isInternalTable("mysql", "tidb_x"), check.IsFalse)
+	c.Assert(isInternalTable("mysql", "user"), check.IsFalse)
+	c.Assert(isInternalTable("test", "stats_meta"), check.IsFalse)
+}
+
+func (s *internalOperationSuite) TestIsInternalDDLJob(c *check.C) {
+	c.Assert(isInternalDDLJob(&model.Job{Type: model.ActionLockTable, Query: "LOCK TABLES t WRITE"}), check.IsTrue)
+	c.Assert(isInternalDDLJob(&model.Job{Type: model.ActionRepairTable, Query: "ADMIN REPAIR TABLE t CREATE TABLE t (a int)"}), check.IsTrue)
+	c.Assert(isInternalDDLJob(&model.Job{Type: model.ActionNone, Query: " admin check table t"}), check.IsTrue)
+	c.Assert(isInternalDDLJob(&model.Job{Type: model.ActionCreateTable, Query: "CREATE TABLE admin (a int)"}), check.IsFalse)
+	c.Assert(isInternalDDLJob(&model.Job{Type: model.ActionSetTiFlashReplica, Query: "ALTER TABLE t SET TIFLASH REPLICA 1"}), check.IsFalse)
+}
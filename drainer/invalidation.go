@@ -0,0 +1,291 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	pb "github.com/pingcap/tipb/go-binlog"
+	"go.uber.org/zap"
+)
+
+const (
+	invalidationModePublish = "publish"
+	invalidationModeDelete  = "delete"
+
+	defaultInvalidationChannel   = "tidb_binlog_invalidation"
+	defaultInvalidationKeyFormat = "{schema}:{table}:{key}"
+	defaultInvalidationTimeout   = 3
+	defaultInvalidationQueueSize = 1024
+	invalidationMaxRetry         = 3
+)
+
+// InvalidationConfig is the config of invalidating the caches in redis of the rows
+// after they're synced to downstream, so the caches are kept coherent with downstream.
+type InvalidationConfig struct {
+	Enable   bool   `toml:"enable" json:"enable"`
+	Addr     string `toml:"addr" json:"addr"`
+	Password string `toml:"password" json:"-"`
+	DB       int    `toml:"db" json:"db"`
+	// Mode is "publish" to publish the messages to Channel, or "delete" to delete
+	// the keys formatted by KeyFormat.
+	Mode    string `toml:"mode" json:"mode"`
+	Channel string `toml:"channel" json:"channel"`
+	// KeyFormat is the format of the keys deleted, "{schema}", "{table}" and "{key}"
+	// are replaced by the names and the values of the key columns joined by ",".
+	KeyFormat string `toml:"key-format" json:"key-format"`
+	// Timeout is the seconds of a request to redis.
+	Timeout int `toml:"timeout" json:"timeout"`
+	// QueueSize is the max number of the synced binlogs waiting for invalidating.
+	QueueSize int `toml:"queue-size" json:"queue-size"`
+	// Tables are the tables invalidated.
+	Tables []filter.TableName `toml:"table" json:"table"`
+}
+
+func (c *InvalidationConfig) enabled() bool {
+	return c != nil && c.Enable
+}
+
+func (c *InvalidationConfig) adjust() {
+	if len(c.Mode) == 0 {
+		c.Mode = invalidationModePublish
+	}
+	if len(c.Channel) == 0 {
+		c.Channel = defaultInvalidationChannel
+	}
+	if len(c.KeyFormat) == 0 {
+		c.KeyFormat = defaultInvalidationKeyFormat
+	}
+	util.AdjustInt(&c.Timeout, defaultInvalidationTimeout)
+	util.AdjustInt(&c.QueueSize, defaultInvalidationQueueSize)
+}
+
+func (c *InvalidationConfig) validate() error {
+	if len(c.Addr) == 0 {
+		return errors.New("addr of invalidation is required")
+	}
+	switch c.Mode {
+	case "", invalidationModePublish, invalidationModeDelete:
+	default:
+		return errors.Errorf("invalid mode of invalidation: %s, must be one of publish, delete", c.Mode)
+	}
+	if len(c.Tables) == 0 {
+		return errors.New("no table of invalidation is configured")
+	}
+	return nil
+}
+
+// invalidation is the message published to redis for a changed row.
+type invalidation struct {
+	Schema   string                 `json:"schema"`
+	Table    string                 `json:"table"`
+	Key      map[string]interface{} `json:"key"`
+	CommitTS int64                  `json:"commit-ts"`
+
+	keyColumns []string
+}
+
+// redisKey returns the key of the row's cache formatted by format.
+func (i *invalidation) redisKey(format string) string {
+	values := make([]string, 0, len(i.keyColumns))
+	for _, col := range i.keyColumns {
+		switch v := i.Key[col].(type) {
+		case []byte:
+			values = append(values, string(v))
+		case nil:
+			values = append(values, "NULL")
+		default:
+			values = append(values, fmt.Sprint(v))
+		}
+	}
+	return strings.NewReplacer("{schema}", i.Schema, "{table}", i.Table, "{key}", strings.Join(values, ",")).Replace(format)
+}
+
+// invalidator collects the keys of the changed rows of the configured tables before the
+// binlogs are synced, and invalidates them in redis after the binlogs are synced.
+type invalidator struct {
+	cfg    *InvalidationConfig
+	filter *filter.Filter
+
+	mu sync.Mutex
+	// pending are the invalidations of the binlogs being synced by commit ts.
+	pending map[int64][]*invalidation
+
+	queue chan []*invalidation
+	done  chan struct{}
+
+	conn *redisConn
+}
+
+// dialInvalidationRedis is changed in unit test for mock.
+var dialInvalidationRedis = dialRedis
+
+func newInvalidator(cfg *InvalidationConfig) (*invalidator, error) {
+	tables, err := filter.NewFilter(nil, nil, nil, cfg.Tables)
+	if err != nil {
+		return nil, errors.Annotate(err, "invalid tables of invalidation")
+	}
+	return &invalidator{
+		cfg:     cfg,
+		filter:  tables,
+		pending: make(map[int64][]*invalidation),
+		queue:   make(chan []*invalidation, cfg.QueueSize),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// prepare collects the keys of the rows changed by the binlog, the rows are decoded
+// like the ones written to MySQL.
+func (v *invalidator) prepare(binlog *pb.Binlog, pv *pb.PrewriteValue, schema *Schema) {
+	var invalidations []*invalidation
+	for _, mut := range pv.GetMutations() {
+		info, ok := schema.TableByID(mut.GetTableId())
+		if !ok {
+			continue
+		}
+		schemaName, tableName, ok := schema.SchemaAndTableName(mut.GetTableId())
+		if !ok || v.filter.SkipSchemaAndTable(schemaName, tableName) {
+			continue
+		}
+		keys := keyColumns(info)
+		if len(keys) == 0 {
+			log.Warn("skip invalidating the table without primary key or not null unique key",
+				zap.String("schema", schemaName), zap.String("table", tableName))
+			continue
+		}
+		single := &pb.PrewriteValue{SchemaVersion: pv.SchemaVersion, Mutations: []pb.TableMutation{mut}}
+		txn, err := translator.TiBinlogToTxn(translator.NewContext(schema, binlog, single))
+		if err != nil {
+			log.Warn("decode rows to invalidate failed", zap.Int64("table id", mut.GetTableId()), zap.Error(err))
+			continue
+		}
+		for _, dml := range txn.DMLs {
+			invalidations = append(invalidations, newInvalidation(dml, keys, dml.Values, binlog.CommitTs))
+			// the cache of the old key is invalidated too if the key is updated.
+			if dml.Tp == loader.UpdateDMLType && keyChanged(keys, dml.OldValues, dml.Values) {
+				invalidations = append(invalidations, newInvalidation(dml, keys, dml.OldValues, binlog.CommitTs))
+			}
+		}
+	}
+	if len(invalidations) == 0 {
+		return
+	}
+
+	v.mu.Lock()
+	v.pending[binlog.CommitTs] = invalidations
+	v.mu.Unlock()
+}
+
+func newInvalidation(dml *loader.DML, keys []string, values map[string]interface{}, commitTS int64) *invalidation {
+	key := make(map[string]interface{}, len(keys))
+	for _, col := range keys {
+		if v, ok := values[col].([]byte); ok {
+			key[col] = string(v)
+		} else {
+			key[col] = values[col]
+		}
+	}
+	return &invalidation{Schema: dml.Database, Table: dml.Table, Key: key, CommitTS: commitTS, keyColumns: keys}
+}
+
+func keyChanged(keys []string, oldValues, values map[string]interface{}) bool {
+	for _, col := range keys {
+		if fmt.Sprint(oldValues[col]) != fmt.Sprint(values[col]) {
+			return true
+		}
+	}
+	return false
+}
+
+// synced queues the invalidations of the binlog synced to downstream, it blocks
+// if the queue is full.
+func (v *invalidator) synced(commitTS int64) {
+	v.mu.Lock()
+	invalidations, ok := v.pending[commitTS]
+	delete(v.pending, commitTS)
+	v.mu.Unlock()
+	if ok {
+		v.queue <- invalidations
+	}
+}
+
+// run invalidates the queued keys until the invalidator is closed.
+func (v *invalidator) run() {
+	defer close(v.done)
+	for invalidations := range v.queue {
+		if err := v.invalidate(invalidations); err != nil {
+			log.Error("invalidate the caches failed", zap.Int64("commit ts", invalidations[0].CommitTS),
+				zap.Int("rows", len(invalidations)), zap.Error(err))
+			invalidationCounter.WithLabelValues("fail").Add(float64(len(invalidations)))
+			continue
+		}
+		invalidationCounter.WithLabelValues("success").Add(float64(len(invalidations)))
+	}
+	if v.conn != nil {
+		v.conn.close()
+	}
+}
+
+// invalidate sends the commands to redis, it reconnects and retries if it fails.
+func (v *invalidator) invalidate(invalidations []*invalidation) error {
+	cmds := make([][]string, 0, len(invalidations))
+	for _, i := range invalidations {
+		if v.cfg.Mode == invalidationModeDelete {
+			cmds = append(cmds, []string{"DEL", i.redisKey(v.cfg.KeyFormat)})
+			continue
+		}
+		msg, err := json.Marshal(i)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		cmds = append(cmds, []string{"PUBLISH", v.cfg.Channel, string(msg)})
+	}
+
+	timeout := time.Duration(v.cfg.Timeout) * time.Second
+	var err error
+	for retry := 0; retry < invalidationMaxRetry; retry++ {
+		if v.conn == nil {
+			if v.conn, err = dialInvalidationRedis(v.cfg.Addr, v.cfg.Password, v.cfg.DB, timeout); err != nil {
+				log.Warn("connect to redis failed", zap.String("addr", v.cfg.Addr), zap.Error(err))
+				continue
+			}
+		}
+		if err = v.conn.do(cmds); err == nil {
+			return nil
+		}
+		if _, ok := err.(redisError); ok {
+			return errors.Trace(err)
+		}
+		log.Warn("send the commands to redis failed", zap.String("addr", v.cfg.Addr), zap.Error(err))
+		v.conn.close()
+		v.conn = nil
+	}
+	return errors.Trace(err)
+}
+
+// close waits for the queued keys to be invalidated.
+func (v *invalidator) close() {
+	close(v.queue)
+	<-v.done
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+)
+
+type invalidationSuite struct{}
+
+var _ = Suite(&invalidationSuite{})
+
+// fakeRedis records the commands received, and replies an error to the commands in errCmds.
+type fakeRedis struct {
+	listener net.Listener
+	errCmds  map[string]string
+
+	mu   sync.Mutex
+	cmds [][]string
+}
+
+func newFakeRedis(c *C) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	r := &fakeRedis{listener: l, errCmds: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		cmd := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			line, _ = br.ReadString('\n')
+			size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			buf := make([]byte, size+2)
+			if _, err = io.ReadFull(br, buf); err != nil {
+				return
+			}
+			cmd = append(cmd, string(buf[:size]))
+		}
+
+		r.mu.Lock()
+		r.cmds = append(r.cmds, cmd)
+		msg, fail := r.errCmds[cmd[0]]
+		r.mu.Unlock()
+		if fail {
+			fmt.Fprintf(conn, "-%s\r\n", msg)
+		} else if cmd[0] == "AUTH" || cmd[0] == "SELECT" {
+			fmt.Fprint(conn, "+OK\r\n")
+		} else {
+			fmt.Fprint(conn, ":1\r\n")
+		}
+	}
+}
+
+func (r *fakeRedis) commands() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]string(nil), r.cmds...)
+}
+
+func (s *invalidationSuite) TestRedisConn(c *C) {
+	r := newFakeRedis(c)
+	defer r.listener.Close()
+	r.errCmds["DEL"] = "ERR wrong"
+
+	conn, err := dialRedis(r.listener.Addr().String(), "pass", 2, time.Second)
+	c.Assert(err, IsNil)
+	defer conn.close()
+
+	c.Assert(conn.do([][]string{{"PUBLISH", "ch", "msg"}}), IsNil)
+	err = conn.do([][]string{{"DEL", "k1"}, {"PUBLISH", "ch", "msg2"}})
+	c.Assert(err, ErrorMatches, "ERR wrong")
+	// the connection is still usable after an error reply.
+	c.Assert(conn.do([][]string{{"PUBLISH", "ch", "msg3"}}), IsNil)
+
+	c.Assert(r.commands(), DeepEquals, [][]string{
+		{"AUTH", "pass"},
+		{"SELECT", "2"},
+		{"PUBLISH", "ch", "msg"},
+		{"DEL", "k1"},
+		{"PUBLISH", "ch", "msg2"},
+		{"PUBLISH", "ch", "msg3"},
+	})
+}
+
+func (s *invalidationSuite) TestRedisKey(c *C) {
+	i := &invalidation{
+		Schema:     "test",
+		Table:      "t",
+		Key:        map[string]interface{}{"a": int64(1), "b": "x", "c": nil},
+		keyColumns: []string{"a", "b", "c"},
+	}
+	c.Assert(i.redisKey(defaultInvalidationKeyFormat), Equals, "test:t:1,x,NULL")
+	c.Assert(i.redisKey("cache/{table}/{key}"), Equals, "cache/t/1,x,NULL")
+}
+
+func (s *invalidationSuite) TestConfig(c *C) {
+	cfg := &InvalidationConfig{Enable: true}
+	c.Assert(cfg.validate(), ErrorMatches, "addr of invalidation is required")
+	cfg.Addr = "127.0.0.1:6379"
+	cfg.Mode = "set"
+	c.Assert(cfg.validate(), ErrorMatches, "invalid mode of invalidation.*")
+	cfg.Mode = ""
+	c.Assert(cfg.validate(), ErrorMatches, "no table of invalidation is configured")
+	cfg.Tables = []filter.TableName{{Schema: "test", Table: "t"}}
+	c.Assert(cfg.validate(), IsNil)
+
+	cfg.adjust()
+	c.Assert(cfg.Mode, Equals, invalidationModePublish)
+	c.Assert(cfg.Channel, Equals, defaultInvalidationChannel)
+	c.Assert(cfg.QueueSize, Equals, defaultInvalidationQueueSize)
+}
+
+func (s *invalidationSuite) TestInvalidateAfterSynced(c *C) {
+	r := newFakeRedis(c)
+	defer r.listener.Close()
+
+	cfg := &InvalidationConfig{
+		Enable: true,
+		Addr:   r.listener.Addr().String(),
+		Mode:   invalidationModeDelete,
+		Tables: []filter.TableName{{Schema: "test", Table: "t"}},
+	}
+	cfg.adjust()
+	v, err := newInvalidator(cfg)
+	c.Assert(err, IsNil)
+	go v.run()
+
+	v.pending[100] = []*invalidation{
+		{Schema: "test", Table: "t", Key: map[string]interface{}{"id": int64(1)}, CommitTS: 100, keyColumns: []string{"id"}},
+		{Schema: "test", Table: "t", Key: map[string]interface{}{"id": int64(2)}, CommitTS: 100, keyColumns: []string{"id"}},
+	}
+	v.pending[200] = []*invalidation{
+		{Schema: "test", Table: "t", Key: map[string]interface{}{"id": int64(3)}, CommitTS: 200, keyColumns: []string{"id"}},
+	}
+	// nothing is invalidated before the binlog is synced.
+	v.synced(100)
+	v.synced(300)
+	v.close()
+
+	c.Assert(r.commands(), DeepEquals, [][]string{{"DEL", "test:t:1"}, {"DEL", "test:t:2"}})
+	c.Assert(v.pending, HasLen, 1)
+}
+
+func (s *invalidationSuite) TestReconnect(c *C) {
+	r := newFakeRedis(c)
+	defer r.listener.Close()
+
+	cfg := &InvalidationConfig{Enable: true, Addr: r.listener.Addr().String()}
+	cfg.adjust()
+	v, err := newInvalidator(cfg)
+	c.Assert(err, IsNil)
+	defer func() {
+		if v.conn != nil {
+			v.conn.close()
+		}
+	}()
+
+	i := &invalidation{Schema: "test", Table: "t", Key: map[string]interface{}{"id": int64(1)}, CommitTS: 100, keyColumns: []string{"id"}}
+	c.Assert(v.invalidate([]*invalidation{i}), IsNil)
+
+	// the broken connection is replaced.
+	v.conn.conn.Close()
+	c.Assert(v.invalidate([]*invalidation{i}), IsNil)
+
+	cmds := r.commands()
+	c.Assert(cmds, HasLen, 2)
+	c.Assert(cmds[1], DeepEquals, []string{"PUBLISH", defaultInvalidationChannel, `{"schema":"test","table":"t","key":{"id":1},"commit-ts":100}`})
+}
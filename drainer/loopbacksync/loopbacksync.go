@@ -76,19 +76,25 @@ func CreateMarkTable(db *sql.DB) error {
 
 // InitMarkTableData init rowNum rows in the mark table for channelID.
 func InitMarkTableData(db *sql.DB, rowNum int, channelID int64) error {
+	return AddMarkTableData(db, 0, rowNum, channelID)
+}
+
+// AddMarkTableData adds the rows with id in [from, to) in the mark table for channelID,
+// it's used when the number of workers updating the rows is raised.
+func AddMarkTableData(db *sql.DB, from int, to int, channelID int64) error {
 	var builder strings.Builder
 	holder := "(?,?,?,?)"
 	columns := fmt.Sprintf("(%s,%s,%s,%s) ", ID, ChannelID, Val, ChannelInfo)
 	builder.WriteString("REPLACE INTO " + MarkTableName + columns + " VALUES ")
-	for i := 0; i < rowNum; i++ {
-		if i > 0 {
+	for i := from; i < to; i++ {
+		if i > from {
 			builder.WriteByte(',')
 		}
 		builder.WriteString(holder)
 	}
 
 	var args []interface{}
-	for id := 0; id < rowNum; id++ {
+	for id := from; id < to; id++ {
 		args = append(args, id, channelID, 1 /* value */, "" /*channel_info*/)
 	}
 
@@ -78,6 +78,22 @@ func (s *loopbackSuite) TestInitMarkTableData(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (s *loopbackSuite) TestAddMarkTableData(c *check.C) {
+	db, mk, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+
+	var cid int64 = 1
+	mk.ExpectExec(`REPLACE INTO .* VALUES \(\?,\?,\?,\?\),\(\?,\?,\?,\?\)$`).
+		WithArgs(16, cid, 1, "", 17, cid, 1, "").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	err = AddMarkTableData(db, 16, 18, cid)
+	c.Assert(err, check.IsNil)
+
+	err = mk.ExpectationsWereMet()
+	c.Assert(err, check.IsNil)
+}
+
 func (s *loopbackSuite) TestCleanMarkTableData(c *check.C) {
 	db, mk, err := sqlmock.New()
 	c.Assert(err, check.IsNil)
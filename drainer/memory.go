@@ -0,0 +1,119 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"context"
+	"sync"
+)
+
+// memoryTracker accounts the memory of the binlogs pulled from the pumps until the syncer
+// has translated them and passed them to the downstream syncer, it covers the binlogs
+// buffered by the pumps and the merger, the input channel of syncer and the translation.
+// The binlogs are admitted to the syncer only if the quota isn't used up, otherwise the
+// merger and then the pumps are blocked, so no more binlog is pulled until some are released.
+//
+// The methods of a nil memoryTracker do nothing, which means no quota.
+type memoryTracker struct {
+	quota int64
+
+	mu sync.Mutex
+	// used is the size of the binlogs pulled and not released.
+	used int64
+	// queued is the count of the binlogs admitted to syncer and not released. The binlogs are
+	// always admitted if it's 0, since nothing is to be released, so a binlog bigger than the
+	// quota is still synced.
+	queued int64
+	// released is closed and replaced whenever some memory is released.
+	released chan struct{}
+}
+
+func newMemoryTracker(quota int64) *memoryTracker {
+	if quota <= 0 {
+		return nil
+	}
+	memoryQuotaGauge.Set(float64(quota))
+	return &memoryTracker{quota: quota, released: make(chan struct{})}
+}
+
+// consume accounts the binlog pulled from a pump.
+func (t *memoryTracker) consume(item *binlogItem, size int64) {
+	if t == nil {
+		return
+	}
+	item.mem = t
+	item.size = size
+	t.mu.Lock()
+	t.used += size
+	memoryUsedGauge.Set(float64(t.used))
+	t.mu.Unlock()
+}
+
+// admit blocks until the quota is available, or ctx is done, and then admits the binlog to syncer.
+func (t *memoryTracker) admit(ctx context.Context, item *binlogItem) error {
+	if t == nil {
+		return nil
+	}
+	paused := false
+	defer func() {
+		if paused {
+			memoryPausedGauge.Set(0)
+		}
+	}()
+	for {
+		t.mu.Lock()
+		if t.used < t.quota || t.queued == 0 {
+			t.queued++
+			item.queued = true
+			t.mu.Unlock()
+			return nil
+		}
+		released := t.released
+		t.mu.Unlock()
+
+		if !paused {
+			paused = true
+			memoryPausedGauge.Set(1)
+			memoryPauseCounter.Inc()
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees the memory of the binlog, it's called once the binlog is handled by syncer or dropped.
+func (t *memoryTracker) release(item *binlogItem) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.used -= item.size
+	if item.queued {
+		t.queued--
+	}
+	memoryUsedGauge.Set(float64(t.used))
+	close(t.released)
+	t.released = make(chan struct{})
+	t.mu.Unlock()
+}
+
+// releaseMergeItem frees the memory of the item dropped by the merger.
+func releaseMergeItem(item MergeItem) {
+	if b, ok := item.(*binlogItem); ok {
+		b.releaseMemory()
+	}
+}
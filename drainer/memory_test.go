@@ -0,0 +1,77 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"context"
+	"time"
+
+	. "github.com/pingcap/check"
+	pb "github.com/pingcap/tipb/go-binlog"
+)
+
+type memoryTrackerSuite struct{}
+
+var _ = Suite(&memoryTrackerSuite{})
+
+func (s *memoryTrackerSuite) TestAdmit(c *C) {
+	c.Assert(newMemoryTracker(0), IsNil)
+
+	t := newMemoryTracker(100)
+	ctx := context.Background()
+	newItem := func(size int64) *binlogItem {
+		item := newBinlogItem(&pb.Binlog{}, "pump")
+		t.consume(item, size)
+		return item
+	}
+
+	// the binlog bigger than the quota is admitted if nothing is queued.
+	big := newItem(150)
+	c.Assert(t.admit(ctx, big), IsNil)
+
+	small := newItem(10)
+	admitted := make(chan error, 1)
+	go func() {
+		admitted <- t.admit(ctx, small)
+	}()
+	select {
+	case <-admitted:
+		c.Fatal("admitted when the quota is used up")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	big.releaseMemory()
+	select {
+	case err := <-admitted:
+		c.Assert(err, IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("not admitted after the memory is released")
+	}
+	// it's released only once.
+	big.releaseMemory()
+	c.Assert(t.used, Equals, int64(10))
+	c.Assert(t.queued, Equals, int64(1))
+
+	// the dropped binlog is released without being admitted.
+	dropped := newItem(100)
+	releaseMergeItem(dropped)
+	c.Assert(t.used, Equals, int64(10))
+	c.Assert(t.queued, Equals, int64(1))
+
+	// waiting is canceled with ctx.
+	over := newItem(100)
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	c.Assert(t.admit(cctx, over), Equals, context.Canceled)
+}
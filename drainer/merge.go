@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/store/tikv/oracle"
 	"go.uber.org/zap"
 )
 
@@ -28,6 +29,9 @@ const (
 	heapStrategy   = "heap"
 )
 
+// emittedFingerprintCount is how many binlogs emitted recently are remembered to tell the duplicates.
+const emittedFingerprintCount = 4096
+
 // MergeItem is the item in Merger
 type MergeItem interface {
 	GetCommitTs() int64
@@ -35,6 +39,19 @@ type MergeItem interface {
 	GetSourceID() string
 }
 
+// itemFingerprint identifies a MergeItem, the items of the same fingerprint are duplicates.
+type itemFingerprint struct {
+	startTS  int64
+	commitTS int64
+	hash     uint64
+}
+
+// fingerprinter is implemented by the MergeItems that can be told from their duplicates, like the
+// binlog of a transaction received from two pumps during pump failover.
+type fingerprinter interface {
+	fingerprint() itemFingerprint
+}
+
 // MergeItems is a heap of MergeItems.
 type MergeItems []MergeItem
 
@@ -163,6 +180,19 @@ type Merger struct {
 	// latestTS save the last binlog's ts send to syncer
 	latestTS int64
 
+	// emitted is the count of binlogs send to syncer, pushSeq records the value of
+	// emitted when the binlog buffered for each source was pushed, the difference is
+	// how many binlogs of other sources were emitted ahead of it, aka the reorder depth.
+	emitted  int64
+	pushSeq  map[string]int64
+	buffered map[string]int64
+
+	// emittedFingerprints are the fingerprints of the last emittedFingerprintCount binlogs emitted, in the ring
+	// fingerprintRing, they're only accessed by run.
+	emittedFingerprints map[itemFingerprint]struct{}
+	fingerprintRing     []itemFingerprint
+	fingerprintPos      int
+
 	close int32
 
 	pause int32
@@ -192,8 +222,12 @@ func NewMerger(ts int64, strategy string, sources ...MergeSource) *Merger {
 	m := &Merger{
 		latestTS: ts,
 		sources:  make(map[string]MergeSource),
+		pushSeq:  make(map[string]int64),
+		buffered: make(map[string]int64),
 		output:   make(chan MergeItem),
 		strategy: mergeStrategy,
+
+		emittedFingerprints: make(map[itemFingerprint]struct{}),
 	}
 
 	for i := 0; i < len(sources); i++ {
@@ -228,6 +262,7 @@ func (m *Merger) AddSource(source MergeSource) {
 func (m *Merger) RemoveSource(sourceID string) {
 	m.Lock()
 	delete(m.sources, sourceID)
+	reorderDepthHistogram.DeleteLabelValues(sourceID)
 	log.Info("merger remove source", zap.String("source id", sourceID))
 	m.setSourceChanged()
 	m.Unlock()
@@ -277,7 +312,7 @@ func (m *Merger) run() {
 				binlog, ok := <-source.Source
 				if ok {
 					m.Lock()
-					m.strategy.Push(binlog)
+					m.push(binlog)
 					m.Unlock()
 				} else {
 					// the source is closing.
@@ -298,9 +333,9 @@ func (m *Merger) run() {
 
 		var minBinlog MergeItem
 
-		m.RLock()
-		minBinlog = m.strategy.Pop()
-		m.RUnlock()
+		m.Lock()
+		minBinlog = m.pop()
+		m.Unlock()
 
 		if minBinlog == nil {
 			continue
@@ -310,22 +345,42 @@ func (m *Merger) run() {
 		if m.isSourceChanged() {
 			// push the min binlog back
 			m.Lock()
-			m.strategy.Push(minBinlog)
+			m.push(minBinlog)
 			m.Unlock()
 			continue
 		}
 
 		minBinlogTS := minBinlog.GetCommitTs()
-		if minBinlogTS < latestTS {
+		if minBinlogTS <= latestTS && m.isEmitted(minBinlog) {
+			duplicateBinlogCount.Add(1)
+			log.Info("drop duplicate binlog",
+				zap.String("source id", minBinlog.GetSourceID()),
+				zap.Int64("commit ts", minBinlogTS))
+			m.release(minBinlog, false)
+			releaseMergeItem(minBinlog)
+		} else if minBinlogTS < latestTS {
 			disorderBinlogCount.Add(1)
 			log.Error("binlog's commit ts less than the last ts",
 				zap.Int64("commit ts", minBinlogTS),
 				zap.Int64("last ts", latestTS))
+			m.release(minBinlog, false)
+			releaseMergeItem(minBinlog)
 		} else if minBinlogTS == latestTS {
-			log.Warn("duplicate binlog", zap.Int64("commit ts", minBinlogTS))
+			// it's not the binlog emitted recently, like the binlog of the checkpoint pulled again.
+			log.Warn("binlog's commit ts equals the last ts but it's not a duplicate of the emitted ones",
+				zap.String("source id", minBinlog.GetSourceID()),
+				zap.Int64("commit ts", minBinlogTS))
+			m.release(minBinlog, false)
+			releaseMergeItem(minBinlog)
 		} else {
+			m.rememberEmitted(minBinlog)
 			m.output <- minBinlog
+			if latestTS > 0 {
+				gap := oracle.ExtractPhysical(uint64(minBinlogTS)) - oracle.ExtractPhysical(uint64(latestTS))
+				commitTSGapHistogram.Observe(float64(gap) / 1000)
+			}
 			latestTS = minBinlogTS
+			m.release(minBinlog, true)
 		}
 
 		m.Lock()
@@ -334,6 +389,108 @@ func (m *Merger) run() {
 	}
 }
 
+// rememberEmitted remembers the fingerprint of the item emitted, the oldest one is forgotten if
+// there are emittedFingerprintCount ones.
+func (m *Merger) rememberEmitted(item MergeItem) {
+	f, ok := item.(fingerprinter)
+	if !ok {
+		return
+	}
+	fp := f.fingerprint()
+	if len(m.fingerprintRing) < emittedFingerprintCount {
+		m.fingerprintRing = append(m.fingerprintRing, fp)
+	} else {
+		delete(m.emittedFingerprints, m.fingerprintRing[m.fingerprintPos])
+		m.fingerprintRing[m.fingerprintPos] = fp
+		m.fingerprintPos = (m.fingerprintPos + 1) % emittedFingerprintCount
+	}
+	m.emittedFingerprints[fp] = struct{}{}
+}
+
+// isEmitted returns whether an item of the same fingerprint is emitted recently.
+func (m *Merger) isEmitted(item MergeItem) bool {
+	f, ok := item.(fingerprinter)
+	if !ok {
+		return false
+	}
+	_, ok = m.emittedFingerprints[f.fingerprint()]
+	return ok
+}
+
+// push pushes the item into the strategy, the caller should hold the lock.
+func (m *Merger) push(item MergeItem) {
+	m.strategy.Push(item)
+	sourceID := item.GetSourceID()
+	// keep the sequence if the item is pushed back
+	if _, ok := m.pushSeq[sourceID]; !ok {
+		m.pushSeq[sourceID] = atomic.LoadInt64(&m.emitted)
+	}
+	m.buffered[sourceID] = item.GetCommitTs()
+}
+
+// pop pops the min item from the strategy, the caller should hold the lock.
+func (m *Merger) pop() MergeItem {
+	item := m.strategy.Pop()
+	if item != nil {
+		delete(m.buffered, item.GetSourceID())
+	}
+	return item
+}
+
+// release forgets the push sequence of the item, and records its reorder depth if emitted.
+func (m *Merger) release(item MergeItem, emitted bool) {
+	sourceID := item.GetSourceID()
+	m.Lock()
+	seq, ok := m.pushSeq[sourceID]
+	delete(m.pushSeq, sourceID)
+	m.Unlock()
+
+	if !emitted {
+		return
+	}
+	count := atomic.AddInt64(&m.emitted, 1)
+	if ok {
+		reorderDepthHistogram.WithLabelValues(sourceID).Observe(float64(count - 1 - seq))
+	}
+}
+
+// SourceStats is the buffering status of a source in Merger
+type SourceStats struct {
+	// BufferedTS is the commit ts of the binlog waiting to be merged, 0 if nothing is buffered
+	BufferedTS int64 `json:"buffered_ts"`
+	// Pending is the number of binlogs in the source channel
+	Pending int `json:"pending"`
+	// Capacity is the capacity of the source channel
+	Capacity int `json:"capacity"`
+}
+
+// MergerStats is the snapshot of Merger's buffering status
+type MergerStats struct {
+	LatestTS int64                  `json:"latest_ts"`
+	Emitted  int64                  `json:"emitted"`
+	Sources  map[string]SourceStats `json:"sources"`
+}
+
+// Stats returns the current buffering status of each source
+func (m *Merger) Stats() MergerStats {
+	m.RLock()
+	defer m.RUnlock()
+
+	stats := MergerStats{
+		LatestTS: m.latestTS,
+		Emitted:  atomic.LoadInt64(&m.emitted),
+		Sources:  make(map[string]SourceStats, len(m.sources)),
+	}
+	for id, source := range m.sources {
+		stats.Sources[id] = SourceStats{
+			BufferedTS: m.buffered[id],
+			Pending:    len(source.Source),
+			Capacity:   cap(source.Source),
+		}
+	}
+	return stats
+}
+
 // Output get the output chan of binlog
 func (m *Merger) Output() chan MergeItem {
 	return m.output
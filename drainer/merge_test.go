@@ -20,6 +20,7 @@ import (
 
 	. "github.com/pingcap/check"
 	pb "github.com/pingcap/tipb/go-binlog"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 var _ = Suite(&testMergerSuite{})
@@ -156,3 +157,78 @@ func (s *testMergerSuite) TestCloseMerger(c *C) {
 		c.Fatal("Fail to close merger's output in 2s")
 	}
 }
+
+func (s *testMergerSuite) TestStats(c *C) {
+	sources := []MergeSource{
+		{ID: "0", Source: make(chan MergeItem, 10)},
+		{ID: "1", Source: make(chan MergeItem, 10)},
+	}
+	for _, ts := range []int64{1, 2, 3} {
+		sources[0].Source <- newBinlogItem(&pb.Binlog{CommitTs: ts}, "0")
+	}
+	sources[1].Source <- newBinlogItem(&pb.Binlog{CommitTs: 10}, "1")
+
+	merger := NewMerger(0, heapStrategy, sources...)
+	defer merger.Close()
+
+	for _, expect := range []int64{1, 2} {
+		select {
+		case item := <-merger.Output():
+			c.Assert(item.GetCommitTs(), Equals, expect)
+		case <-time.After(time.Second * 2):
+			c.Fatal("timeout to consume merger output")
+		}
+	}
+
+	// wait for the merger to pop the binlog 3, which is blocked to be sent
+	var stats MergerStats
+	for i := 0; i < 100; i++ {
+		stats = merger.Stats()
+		if stats.Emitted == 2 && stats.Sources["0"].Pending == 0 && stats.Sources["0"].BufferedTS == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(stats.LatestTS, Equals, int64(2))
+	c.Assert(stats.Emitted, Equals, int64(2))
+	c.Assert(stats.Sources["0"], DeepEquals, SourceStats{BufferedTS: 0, Pending: 0, Capacity: 10})
+	c.Assert(stats.Sources["1"], DeepEquals, SourceStats{BufferedTS: 10, Pending: 0, Capacity: 10})
+
+	// the binlog of source 1 is buffered while two binlogs of source 0 are emitted
+	merger.Lock()
+	c.Assert(merger.pushSeq["1"], Equals, int64(0))
+	merger.Unlock()
+}
+
+func (s *testMergerSuite) TestDropDuplicates(c *C) {
+	item := func(startTS, commitTS int64, hash uint64, source string) MergeItem {
+		b := newBinlogItem(&pb.Binlog{StartTs: startTS, CommitTs: commitTS}, source)
+		b.payloadHash = hash
+		return b
+	}
+	sources := []MergeSource{
+		{ID: "a", Source: make(chan MergeItem, 10)},
+		{ID: "b", Source: make(chan MergeItem, 10)},
+	}
+	sources[0].Source <- item(1, 10, 1, "a")
+	sources[0].Source <- item(3, 30, 3, "a")
+	sources[0].Source <- item(6, 60, 6, "a")
+	// the binlog of 10 is received from both pumps, while the one of 30 is another transaction.
+	sources[1].Source <- item(1, 10, 1, "b")
+	sources[1].Source <- item(4, 30, 4, "b")
+	sources[1].Source <- item(5, 50, 5, "b")
+
+	before := testutil.ToFloat64(duplicateBinlogCount)
+	merger := NewMerger(0, heapStrategy, sources...)
+	defer merger.Close()
+
+	for _, expect := range []int64{10, 30, 50} {
+		select {
+		case item := <-merger.Output():
+			c.Assert(item.GetCommitTs(), Equals, expect)
+		case <-time.After(time.Second * 2):
+			c.Fatal("timeout to consume merger output")
+		}
+	}
+	c.Assert(testutil.ToFloat64(duplicateBinlogCount)-before, Equals, float64(1))
+}
@@ -15,7 +15,9 @@ package drainer
 
 import (
 	"github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
 	bf "github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -52,6 +54,32 @@ var (
 			Help:      "Total count of binlog which is disorder.",
 		})
 
+	duplicateBinlogCount = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "duplicate_binlog_count",
+			Help:      "Total count of duplicate binlogs received from several pumps and dropped by merger.",
+		})
+
+	reorderDepthHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "merger_reorder_depth",
+			Help:      "Bucketed histogram of how many binlogs of other pumps are emitted by merger ahead of a binlog buffered.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 16),
+		}, []string{"nodeID"})
+
+	commitTSGapHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "merger_commit_ts_gap_seconds",
+			Help:      "Bucketed histogram of the physical time gap between the commit ts of adjacent binlogs emitted by merger.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 20),
+		})
+
 	eventCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: "binlog",
@@ -68,6 +96,46 @@ var (
 			Help:      "save checkpoint tso of drainer.",
 		})
 
+	gcSafePointGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "gc_safepoint_tso",
+			Help:      "the physical time of the service GC safepoint drainer keeps in PD.",
+		})
+
+	memoryQuotaGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "memory_quota_bytes",
+			Help:      "the memory quota of the binlogs pulled and not synced.",
+		})
+
+	memoryUsedGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "memory_used_bytes",
+			Help:      "the size of the binlogs pulled and not synced.",
+		})
+
+	memoryPausedGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "memory_quota_exceeded",
+			Help:      "1 if pulling binlogs is paused since the memory quota is used up.",
+		})
+
+	memoryPauseCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "memory_pause_total",
+			Help:      "the times pulling binlogs is paused since the memory quota is used up.",
+		})
+
 	checkpointDelayHistogram = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Namespace: "binlog",
@@ -120,12 +188,142 @@ var (
 			Name:      "queue_size",
 			Help:      "the size of queue",
 		}, []string{"name"})
+
+	ddlBroadcastFailureCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "ddl_broadcast_failure_total",
+			Help:      "Total number of the DDLs failed to execute on each shard.",
+		}, []string{"shard"})
+
+	ddlBlockedGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "ddl_blocked_seconds",
+			Help:      "The seconds the executing DDL has been blocked by metadata locks in downstream.",
+		})
+
+	loaderWorkerBusyCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "loader_worker_busy_seconds_total",
+			Help:      "Total seconds each worker of the loader spends executing DMLs, the rate is the busy ratio.",
+		}, []string{"worker"})
+
+	loaderQueueWaitHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "loader_queue_wait_seconds",
+			Help:      "Bucketed histogram of the seconds a txn waits in the loader before executed.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 20),
+		})
+
+	loaderConflictStallHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "loader_conflict_stall_seconds",
+			Help:      "Bucketed histogram of the seconds the loader stalls on causality conflicts.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 20),
+		})
+
+	loaderRetryCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "loader_retry_total",
+			Help:      "Total number of the retries of executing DMLs and DDLs in the loader.",
+		}, []string{"type"})
+
+	verifyCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "verify_table_total",
+			Help:      "Total number of the verified tables by result.",
+		}, []string{"result"})
+
+	verifyMismatchGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "verify_mismatch_tables",
+			Help:      "The number of the mismatched tables in the last verification.",
+		})
+
+	verifyTSGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "verify_ts",
+			Help:      "The ts of the last verification.",
+		})
+
+	killedQueryCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "killed_query_total",
+			Help:      "Total number of the DML statements killed for timeout in downstream.",
+		})
+
+	bandwidthLimitGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "bandwidth_limit_bytes",
+			Help:      "The current limit of the bytes of the binlogs synced per second, 0 means unlimited.",
+		})
+
+	bandwidthWaitCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "bandwidth_wait_seconds_total",
+			Help:      "Total seconds waited for the bandwidth limit before syncing the binlogs.",
+		})
+
+	noKeyTableDMLCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "no_key_table_dml_total",
+			Help:      "Total number of the DMLs of the tables without primary key and unique key by mode and type.",
+		}, []string{"mode", "type"})
+
+	internalOperationCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "internal_operation_total",
+			Help:      "Total number of the internal operations of TiDB skipped by type.",
+		}, []string{"type"})
+
+	invalidationCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "drainer",
+			Name:      "invalidation_total",
+			Help:      "Total number of the rows invalidated in redis by result.",
+		}, []string{"result"})
 )
 
 var registry = prometheus.NewRegistry()
 
 func init() {
 	sync.QueueSizeGauge = queueSizeGauge
+	sync.DDLBroadcastFailureCounter = ddlBroadcastFailureCounter
+	sync.DDLBlockedGauge = ddlBlockedGauge
+	sync.LoaderWorkerBusyCounter = loaderWorkerBusyCounter
+	sync.LoaderQueueWaitHistogram = loaderQueueWaitHistogram
+	sync.LoaderConflictStallHistogram = loaderConflictStallHistogram
+	sync.LoaderRetryCounter = loaderRetryCounter
+	translator.NoKeyTableDMLCounter = noKeyTableDMLCounter
+	sync.KilledQueryCounter = killedQueryCounter
 
 	registry.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
 	registry.MustRegister(prometheus.NewGoCollector())
@@ -134,13 +332,37 @@ func init() {
 	registry.MustRegister(errorCount)
 	registry.MustRegister(checkpointTSOGauge)
 	registry.MustRegister(checkpointDelayHistogram)
+	registry.MustRegister(gcSafePointGauge)
+	registry.MustRegister(memoryQuotaGauge)
+	registry.MustRegister(memoryUsedGauge)
+	registry.MustRegister(memoryPausedGauge)
+	registry.MustRegister(memoryPauseCounter)
 	registry.MustRegister(eventCounter)
 	registry.MustRegister(executeHistogram)
 	registry.MustRegister(binlogReachDurationHistogram)
 	registry.MustRegister(readBinlogSizeHistogram)
 	registry.MustRegister(queryHistogramVec)
 	registry.MustRegister(queueSizeGauge)
+	registry.MustRegister(ddlBroadcastFailureCounter)
+	registry.MustRegister(ddlBlockedGauge)
+	registry.MustRegister(loaderWorkerBusyCounter)
+	registry.MustRegister(loaderQueueWaitHistogram)
+	registry.MustRegister(loaderConflictStallHistogram)
+	registry.MustRegister(loaderRetryCounter)
+	registry.MustRegister(reorderDepthHistogram)
+	registry.MustRegister(duplicateBinlogCount)
+	registry.MustRegister(commitTSGapHistogram)
+	registry.MustRegister(verifyCounter)
+	registry.MustRegister(verifyMismatchGauge)
+	registry.MustRegister(verifyTSGauge)
+	registry.MustRegister(invalidationCounter)
+	registry.MustRegister(noKeyTableDMLCounter)
+	registry.MustRegister(internalOperationCounter)
+	registry.MustRegister(killedQueryCounter)
+	registry.MustRegister(bandwidthLimitGauge)
+	registry.MustRegister(bandwidthWaitCounter)
 
 	// for pb using it
 	bf.InitMetircs(registry)
+	pkgsql.InitMetrics(registry)
 }
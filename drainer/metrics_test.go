@@ -0,0 +1,40 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type registrySuite struct{}
+
+var _ = Suite(&registrySuite{})
+
+func (s *registrySuite) TestRegisterSQLMetrics(c *C) {
+	c.Assert(isTxnReplayCounterRegistered(registry), IsTrue)
+}
+
+// isTxnReplayCounterRegistered returns whether binlog_sql_txn_replay_total of pkg/sql is registered.
+func isTxnReplayCounterRegistered(registry *prometheus.Registry) bool {
+	err := registry.Register(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "sql",
+			Name:      "txn_replay_total",
+			Help:      "Total number of the transactions replayed in safe mode by type(dml/ddl) and result.",
+		}, []string{"type", "result"}))
+	_, ok := err.(prometheus.AlreadyRegisteredError)
+	return ok
+}
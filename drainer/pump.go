@@ -19,9 +19,13 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/dustin/go-humanize"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/compress"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	"github.com/pingcap/tidb-binlog/pkg/retry"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb-binlog/pump"
 	"github.com/pingcap/tidb/store/tikv/oracle"
@@ -31,6 +35,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -38,6 +43,9 @@ const (
 	binlogChanSize = 0
 )
 
+// defaultPullRetryPolicy retries pulling binlogs from pump every second until drainer is closed.
+var defaultPullRetryPolicy = retry.Policy{Backoff: 1000, Multiplier: 1}
+
 // Pump holds the connection to a pump node, and keeps the savepoint of binlog last read
 type Pump struct {
 	nodeID    string
@@ -46,6 +54,8 @@ type Pump struct {
 	clusterID uint64
 	// the latest binlog ts that pump had handled
 	latestTS int64
+	// the stats reported in the latest heartbeat of pump, nil if not reported
+	stats *node.PumpStats
 
 	isClosed int32
 
@@ -56,19 +66,28 @@ type Pump struct {
 	pullCli  pb.Pump_PullBinlogsClient
 	grpcConn *grpc.ClientConn
 	logger   *zap.Logger
+
+	// payloadCodec is the codec negotiated with pump to compress the payloads of pullCli
+	payloadCodec compress.CompressionCodec
+
+	// retryPolicy is how connecting and pulling binlogs from pump is retried.
+	retryPolicy retry.Policy
+	// mem accounts the memory of the binlogs pulled, nil if there's no quota.
+	mem *memoryTracker
 }
 
 // NewPump returns an instance of Pump
 func NewPump(nodeID, addr string, tlsConfig *tls.Config, clusterID uint64, startTs int64, errCh chan error) *Pump {
 	nodeID = pump.FormatNodeID(nodeID)
 	return &Pump{
-		nodeID:    nodeID,
-		addr:      addr,
-		tlsConfig: tlsConfig,
-		clusterID: clusterID,
-		latestTS:  startTs,
-		errCh:     errCh,
-		logger:    log.L().With(zap.String("id", nodeID)),
+		nodeID:      nodeID,
+		addr:        addr,
+		tlsConfig:   tlsConfig,
+		clusterID:   clusterID,
+		latestTS:    startTs,
+		errCh:       errCh,
+		logger:      log.L().With(zap.String("id", nodeID)),
+		retryPolicy: defaultPullRetryPolicy,
 	}
 }
 
@@ -119,6 +138,7 @@ func (p *Pump) PullBinlog(pctx context.Context, last int64) chan MergeItem {
 		}()
 
 		needReCreateConn := false
+		backoffer := p.retryPolicy.NewBackoffer()
 		for {
 			if atomic.LoadInt32(&p.isClosed) == 1 {
 				return
@@ -138,7 +158,9 @@ func (p *Pump) PullBinlog(pctx context.Context, last int64) chan MergeItem {
 				p.logger.Info("pump create pull binlogs client")
 				if err := p.createPullBinlogsClient(pctx, last); err != nil {
 					p.logger.Error("pump create pull binlogs client failed", zap.Error(err))
-					time.Sleep(time.Second)
+					if !p.waitRetry(pctx, backoffer, err) {
+						return
+					}
 					continue
 				}
 
@@ -155,10 +177,13 @@ func (p *Pump) PullBinlog(pctx context.Context, last int64) chan MergeItem {
 
 				needReCreateConn = true
 
-				time.Sleep(time.Second)
 				// TODO: add metric here
+				if !p.waitRetry(pctx, backoffer, err) {
+					return
+				}
 				continue
 			}
+			backoffer.Reset()
 
 			payloadSize := len(resp.Entity.Payload)
 			readBinlogSizeHistogram.WithLabelValues(p.nodeID).Observe(float64(payloadSize))
@@ -166,8 +191,16 @@ func (p *Pump) PullBinlog(pctx context.Context, last int64) chan MergeItem {
 				log.Info("receive big size binlog", zap.String("size", humanize.Bytes(uint64(payloadSize))))
 			}
 
+			payload, err := compress.Decompress(resp.Entity.Payload, p.payloadCodec)
+			if err != nil {
+				errorCount.WithLabelValues("decompress_binlog").Add(1)
+				p.logger.Error("pump decompress binlog failed", zap.Error(err))
+				p.reportErr(pctx, err)
+				return
+			}
+
 			binlog := new(pb.Binlog)
-			err = binlog.Unmarshal(resp.Entity.Payload)
+			err = binlog.Unmarshal(payload)
 			if err != nil {
 				errorCount.WithLabelValues("unmarshal_binlog").Add(1)
 				p.logger.Error("pump unmarshal binlog failed", zap.Error(err))
@@ -179,13 +212,19 @@ func (p *Pump) PullBinlog(pctx context.Context, last int64) chan MergeItem {
 			binlogReachDurationHistogram.WithLabelValues(p.nodeID).Observe(float64(millisecond) / 1000.0)
 
 			item := newBinlogItem(binlog, p.nodeID)
+			item.payloadHash = xxhash.Sum64(payload)
+			p.mem.consume(item, int64(len(payload)))
 			select {
 			case ret <- item:
 				if binlog.CommitTs > last {
 					last = binlog.CommitTs
 					p.latestTS = binlog.CommitTs
 				} else {
-					p.logger.Error("pump receive unsort binlog")
+					// the duplicates of the binlogs merged are dropped by merger.
+					p.logger.Warn("pump receive unsort binlog",
+						zap.Int64("start ts", binlog.StartTs),
+						zap.Int64("commit ts", binlog.CommitTs),
+						zap.Int64("last ts", last))
 				}
 			case <-pctx.Done():
 				return
@@ -229,7 +268,14 @@ func (p *Pump) createPullBinlogsClient(ctx context.Context, last int64) error {
 		ClusterID: p.clusterID,
 		StartFrom: pb.Pos{Offset: last},
 	}
+	codec, requested := getPayloadCompression(ctx)
+	if requested {
+		ctx = metadata.AppendToOutgoingContext(ctx, pump.PayloadCompressionKey, string(codec))
+	}
 	pullCli, err := cli.PullBinlogs(ctx, in)
+	if err == nil && requested {
+		codec, err = negotiatedPayloadCompression(pullCli)
+	}
 	if err != nil {
 		p.logger.Error("pump create PullBinlogs client failed", zap.Error(err))
 		conn.Close()
@@ -237,13 +283,30 @@ func (p *Pump) createPullBinlogsClient(ctx context.Context, last int64) error {
 		p.grpcConn = nil
 		return errors.Trace(err)
 	}
+	if requested {
+		p.logger.Info("pump payload compression negotiated", zap.String("codec", string(codec)))
+	}
 
 	p.pullCli = pullCli
 	p.grpcConn = conn
+	p.payloadCodec = codec
 
 	return nil
 }
 
+// waitRetry waits before pulling again after err by the retry policy, it returns false
+// if ctx is done, or reports the error and returns false if the retries are exhausted.
+func (p *Pump) waitRetry(ctx context.Context, backoffer *retry.Backoffer, err error) bool {
+	werr := backoffer.Wait(ctx)
+	if werr == nil {
+		return true
+	}
+	if werr == retry.ErrExhausted {
+		p.reportErr(ctx, errors.Annotatef(err, "pull binlogs from pump %s failed %d times", p.nodeID, backoffer.Failures()))
+	}
+	return false
+}
+
 func (p *Pump) reportErr(ctx context.Context, err error) {
 	select {
 	case <-ctx.Done():
@@ -260,3 +323,29 @@ func getCompressorName(ctx context.Context) (string, bool) {
 	}
 	return "", false
 }
+
+func getPayloadCompression(ctx context.Context) (compress.CompressionCodec, bool) {
+	if name, ok := ctx.Value(drainerKeyType("payloadCompression")).(string); ok {
+		codec, err := compress.ToCompressionCodec(name)
+		if err == nil && codec != compress.CompressionNone {
+			return codec, true
+		}
+	}
+	return compress.CompressionNone, false
+}
+
+// negotiatedPayloadCompression returns the codec replied by pump, it blocks
+// until the header is received, which is sent at the beginning of the stream
+// if pump supports the requested codec, or with the first binlog otherwise.
+func negotiatedPayloadCompression(pullCli pb.Pump_PullBinlogsClient) (compress.CompressionCodec, error) {
+	md, err := pullCli.Header()
+	if err != nil {
+		return compress.CompressionNone, errors.Trace(err)
+	}
+	values := md.Get(pump.PayloadCompressionKey)
+	if len(values) == 0 {
+		return compress.CompressionNone, nil
+	}
+	codec, err := compress.ToCompressionCodec(values[0])
+	return codec, errors.Trace(err)
+}
@@ -19,8 +19,11 @@ import (
 
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/compress"
+	"github.com/pingcap/tidb-binlog/pump"
 	"github.com/pingcap/tipb/go-binlog"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 type pumpSuite struct{}
@@ -46,9 +49,45 @@ func (s *pumpSuite) TestGetCompressorName(c *C) {
 	c.Assert(cp, Equals, "gzip")
 }
 
+func (s *pumpSuite) TestGetPayloadCompression(c *C) {
+	ctx := context.Background()
+	_, ok := getPayloadCompression(ctx)
+	c.Assert(ok, IsFalse)
+
+	ctx = context.WithValue(ctx, drainerKeyType("payloadCompression"), "none")
+	_, ok = getPayloadCompression(ctx)
+	c.Assert(ok, IsFalse)
+
+	ctx = context.WithValue(ctx, drainerKeyType("payloadCompression"), "zstd")
+	codec, ok := getPayloadCompression(ctx)
+	c.Assert(ok, IsTrue)
+	c.Assert(codec, Equals, compress.CompressionZSTD)
+}
+
+func (s *pumpSuite) TestNegotiatedPayloadCompression(c *C) {
+	cli := &mockPumpPullBinlogsClient{}
+	codec, err := negotiatedPayloadCompression(cli)
+	c.Assert(err, IsNil)
+	c.Assert(codec, Equals, compress.CompressionNone)
+
+	cli.header = metadata.Pairs(pump.PayloadCompressionKey, "snappy")
+	codec, err = negotiatedPayloadCompression(cli)
+	c.Assert(err, IsNil)
+	c.Assert(codec, Equals, compress.CompressionSnappy)
+
+	cli.header = metadata.Pairs(pump.PayloadCompressionKey, "lz4")
+	_, err = negotiatedPayloadCompression(cli)
+	c.Assert(err, NotNil)
+}
+
 type mockPumpPullBinlogsClient struct {
 	grpc.ClientStream
 	binlogBytesChan chan []byte
+	header          metadata.MD
+}
+
+func (x *mockPumpPullBinlogsClient) Header() (metadata.MD, error) {
+	return x.header, nil
 }
 
 func (x *mockPumpPullBinlogsClient) Recv() (*binlog.PullBinlogResp, error) {
@@ -89,13 +128,37 @@ func (s *pumpSuite) TestPullBinlog(c *C) {
 	c.Assert(p.latestTS, Equals, wrongCommitTsArray[len(wrongCommitTsArray)-2])
 }
 
-func pullBinlogCommitTSChecker(commitTsArray []int64, ret chan MergeItem, binlogBytesChan chan []byte, c *C) {
+func (s *pumpSuite) TestPullCompressedBinlog(c *C) {
+	errChan := make(chan error, 10)
+	p := NewPump("pump_test", "", nil, 0, 5, errChan)
+	p.grpcConn = &grpc.ClientConn{}
+	p.payloadCodec = compress.CompressionSnappy
+	binlogBytesChan := make(chan []byte, 10)
+	p.pullCli = &mockPumpPullBinlogsClient{binlogBytesChan: binlogBytesChan}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		p.grpcConn = nil
+		p.Close()
+		close(binlogBytesChan)
+	}()
+	ret := p.PullBinlog(ctx, 0)
+	pullBinlogCommitTSChecker([]int64{7, 9, 11}, ret, binlogBytesChan, c, compress.CompressionSnappy)
+	time.Sleep(100 * time.Microsecond)
+	c.Assert(p.latestTS, Equals, int64(11))
+}
+
+func pullBinlogCommitTSChecker(commitTsArray []int64, ret chan MergeItem, binlogBytesChan chan []byte, c *C, codec ...compress.CompressionCodec) {
 	go func() {
 		for _, commitTs := range commitTsArray {
 			binlogVal := new(binlog.Binlog)
 			binlogVal.CommitTs = commitTs
 			payload, err := binlogVal.Marshal()
 			c.Assert(err, IsNil)
+			if len(codec) > 0 {
+				payload, err = compress.Compress(payload, codec[0])
+				c.Assert(err, IsNil)
+			}
 			binlogBytesChan <- payload
 		}
 	}()
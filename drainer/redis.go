@@ -0,0 +1,141 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// redisConn is a connection to redis speaking the RESP protocol, only the commands
+// without the reply values needed are supported, like PUBLISH and DEL.
+type redisConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	timeout time.Duration
+}
+
+// dialRedis connects to redis, and authenticates and selects the db if they're set.
+func dialRedis(addr, password string, db int, timeout time.Duration) (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn), timeout: timeout}
+
+	var cmds [][]string
+	if len(password) > 0 {
+		cmds = append(cmds, []string{"AUTH", password})
+	}
+	if db > 0 {
+		cmds = append(cmds, []string{"SELECT", strconv.Itoa(db)})
+	}
+	if err = c.do(cmds); err != nil {
+		conn.Close()
+		return nil, errors.Trace(err)
+	}
+	return c, nil
+}
+
+// do sends the commands in a pipeline and reads their replies, the first error reply is returned.
+func (c *redisConn) do(cmds [][]string) error {
+	if len(cmds) == 0 {
+		return nil
+	}
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return errors.Trace(err)
+	}
+	for _, cmd := range cmds {
+		fmt.Fprintf(c.w, "*%d\r\n", len(cmd))
+		for _, arg := range cmd {
+			fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := c.w.Flush(); err != nil {
+		return errors.Trace(err)
+	}
+
+	var firstErr error
+	for range cmds {
+		if err := c.readReply(); err != nil {
+			if _, ok := err.(redisError); !ok {
+				return errors.Trace(err)
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// readReply reads a reply and discards its value, a redisError is returned for an error reply.
+func (c *redisConn) readReply() error {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return errors.Errorf("invalid redis reply %q", line)
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return errors.Annotatef(err, "invalid redis reply %q", line)
+		}
+		if n < 0 {
+			return nil
+		}
+		_, err = io.CopyN(io.Discard, c.r, int64(n)+2)
+		return errors.Trace(err)
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return errors.Annotatef(err, "invalid redis reply %q", line)
+		}
+		for i := 0; i < n; i++ {
+			if err = c.readReply(); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return errors.Errorf("invalid redis reply %q", line)
+	}
+}
+
+func (c *redisConn) close() error {
+	return c.conn.Close()
+}
@@ -43,14 +43,14 @@ func feedByRelayLogIfNeed(cfg *Config) error {
 		return errors.Annotate(err, "failed to create reader")
 	}
 
-	db, err := loader.CreateDBWithSQLMode(scfg.To.User, scfg.To.Password, scfg.To.Host, scfg.To.Port, scfg.To.TLS, scfg.StrSQLMode, scfg.To.Params)
+	db, err := loader.CreateDBWithSQLMode(scfg.To.User, scfg.To.Password, scfg.To.Host, scfg.To.Port, scfg.To.TLS, scfg.downstreamSQLMode(), scfg.To.Params)
 	if err != nil {
 		return errors.Annotate(err, "failed to create SQL db")
 	}
 	defer db.Close()
 
 	ld, err := sync.CreateLoader(db, scfg.To, scfg.WorkerCount, scfg.TxnBatch,
-		queryHistogramVec, scfg.StrSQLMode, scfg.DestDBType, nil, /*loopbacksync.LoopBackSync*/
+		queryHistogramVec, scfg.downstreamSQLMode(), scfg.DestDBType, nil, /*loopbacksync.LoopBackSync*/
 		scfg.EnableDispatch(), scfg.EnableCausality())
 	if err != nil {
 		return errors.Annotate(err, "failed to create loader")
@@ -15,9 +15,12 @@ package drainer
 
 import (
 	"encoding/json"
+	"strings"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
 	"github.com/pingcap/parser/model"
 	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
@@ -245,6 +248,56 @@ func (s *Schema) ReplaceTable(schemaVersion int64, table *model.TableInfo) error
 	return nil
 }
 
+// renameTable moves the table to the schema with the new name, the table info is
+// kept as is, including the implicit column if it's added.
+func (s *Schema) renameTable(schemaVersion int64, tableID int64, schemaID int64, name model.CIStr) error {
+	table, ok := s.TableByID(tableID)
+	if !ok {
+		return errors.NotFoundf("table %d", tableID)
+	}
+	schema, ok := s.SchemaByID(schemaID)
+	if !ok {
+		return errors.NotFoundf("schema %d", schemaID)
+	}
+	if _, err := s.DropTable(tableID); err != nil {
+		return errors.Trace(err)
+	}
+
+	table = table.Clone()
+	table.Name = name
+	schema.Tables = append(schema.Tables, table)
+	s.appendTableInfo(schemaVersion, table)
+	s.tableIDToName[table.ID] = TableName{Schema: schema.Name.O, Table: table.Name.O}
+
+	log.Debug("rename table success", zap.String("name", schema.Name.O+"."+table.Name.O), zap.Int64("id", table.ID))
+	return nil
+}
+
+// exchangePartition gives the table the id of the partition it's exchanged with, the partitioned
+// table takes the old id of the table as the id of the partition, which is in its new table info.
+func (s *Schema) exchangePartition(schemaVersion int64, tableID int64, schemaID int64, partitionID int64) error {
+	table, ok := s.TableByID(tableID)
+	if !ok {
+		return errors.NotFoundf("table %d", tableID)
+	}
+	schema, ok := s.SchemaByID(schemaID)
+	if !ok {
+		return errors.NotFoundf("schema %d", schemaID)
+	}
+	if _, err := s.DropTable(tableID); err != nil {
+		return errors.Trace(err)
+	}
+
+	table = table.Clone()
+	table.ID = partitionID
+	schema.Tables = append(schema.Tables, table)
+	s.appendTableInfo(schemaVersion, table)
+	s.tableIDToName[table.ID] = TableName{Schema: schema.Name.O, Table: table.Name.O}
+
+	log.Debug("exchange partition success", zap.String("name", schema.Name.O+"."+table.Name.O), zap.Int64("old id", tableID), zap.Int64("id", table.ID))
+	return nil
+}
+
 func (s *Schema) removeTable(tableID int64) error {
 	schema, ok := s.SchemaByTableID(tableID)
 	if !ok {
@@ -320,6 +373,14 @@ func skipUnsupportedDDLJob(job *model.Job) bool {
 	return false
 }
 
+// ddlTableID returns the id of the table after the DDL job, it's the new id of a truncated table.
+func ddlTableID(job *model.Job) int64 {
+	if job.BinlogInfo != nil && job.BinlogInfo.TableInfo != nil {
+		return job.BinlogInfo.TableInfo.ID
+	}
+	return job.TableID
+}
+
 // handleDDL has four return values,
 // the first value[string]: the schema name
 // the second value[string]: the table name
@@ -401,6 +462,60 @@ func (s *Schema) handleDDL(job *model.Job) (schemaName string, tableName string,
 		schemaName = schema.Name.O
 		tableName = table.Name.O
 
+	case model.ActionRenameTables:
+		// only the last renamed table is in the binlog info, the others are
+		// renamed by the args of the job.
+		var oldSchemaIDs, newSchemaIDs, tableIDs []int64
+		var tableNames []*model.CIStr
+		if err := job.DecodeArgs(&oldSchemaIDs, &newSchemaIDs, &tableNames, &tableIDs); err != nil {
+			return "", "", "", errors.Annotatef(err, "decode args of job %d", job.ID)
+		}
+		if len(newSchemaIDs) != len(tableIDs) || len(tableNames) != len(tableIDs) {
+			return "", "", "", errors.Errorf("invalid args of job %d", job.ID)
+		}
+		for i, id := range tableIDs {
+			if err := s.renameTable(job.BinlogInfo.SchemaVersion, id, newSchemaIDs[i], *tableNames[i]); err != nil {
+				return "", "", "", errors.Trace(err)
+			}
+		}
+
+		schema, ok := s.SchemaByID(job.SchemaID)
+		if !ok {
+			return "", "", "", errors.NotFoundf("schema %d", job.SchemaID)
+		}
+		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = TableName{Schema: schema.Name.O, Table: tableNames[len(tableNames)-1].O}
+		s.currentVersion = job.BinlogInfo.SchemaVersion
+		schemaName = schema.Name.O
+		tableName = tableNames[len(tableNames)-1].O
+
+	case model.ActionExchangeTablePartition:
+		// the job is of the non-partitioned table, and the binlog info is of the partitioned table.
+		var partitionID, ptSchemaID, ptID int64
+		var partName string
+		if err := job.DecodeArgs(&partitionID, &ptSchemaID, &ptID, &partName); err != nil {
+			return "", "", "", errors.Annotatef(err, "decode args of job %d", job.ID)
+		}
+		table := job.BinlogInfo.TableInfo
+		if table == nil {
+			return "", "", "", errors.NotFoundf("table %d", ptID)
+		}
+		schema, ok := s.SchemaByID(ptSchemaID)
+		if !ok {
+			return "", "", "", errors.NotFoundf("schema %d", ptSchemaID)
+		}
+
+		if err := s.exchangePartition(job.BinlogInfo.SchemaVersion, job.TableID, job.SchemaID, partitionID); err != nil {
+			return "", "", "", errors.Trace(err)
+		}
+		if err := s.ReplaceTable(job.BinlogInfo.SchemaVersion, table); err != nil {
+			return "", "", "", errors.Trace(err)
+		}
+
+		s.version2SchemaTable[job.BinlogInfo.SchemaVersion] = TableName{Schema: schema.Name.O, Table: table.Name.O}
+		s.currentVersion = job.BinlogInfo.SchemaVersion
+		schemaName = schema.Name.O
+		tableName = table.Name.O
+
 	case model.ActionCreateTable, model.ActionCreateView, model.ActionCreateSequence, model.ActionRecoverTable:
 		table := job.BinlogInfo.TableInfo
 		if table == nil {
@@ -524,6 +639,34 @@ func (s *Schema) IsTruncateTableID(id int64) bool {
 	return ok
 }
 
+// IsTemporaryTable returns true if the table is a temporary table, whose rows aren't recorded in the binlog.
+func (s *Schema) IsTemporaryTable(id int64) bool {
+	table, ok := s.TableByID(id)
+	return ok && table.TempTableType != model.TempTableNone
+}
+
+// isTemporaryTableJob returns true if the job changes a temporary table, the
+// dropped table is checked by the table info in the job.
+func (s *Schema) isTemporaryTableJob(job *model.Job) bool {
+	table := job.BinlogInfo.TableInfo
+	return table != nil && table.TempTableType != model.TempTableNone
+}
+
+// isCreateTableSelect returns true if the DDL is CREATE TABLE ... SELECT, the rows
+// selected into the table may not be recorded in the binlog.
+func isCreateTableSelect(sql string) bool {
+	if !strings.Contains(strings.ToLower(sql), "select") {
+		return false
+	}
+	stmt, err := parser.New().ParseOneStmt(sql, "", "")
+	if err != nil {
+		log.Warn("parse create table statement failed", zap.String("sql", sql), zap.Error(err))
+		return false
+	}
+	create, ok := stmt.(*ast.CreateTableStmt)
+	return ok && create.Select != nil
+}
+
 func (s *Schema) getSchemaTableAndDelete(version int64) (string, string, error) {
 	schemaTable, ok := s.version2SchemaTable[version]
 	if !ok {
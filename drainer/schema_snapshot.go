@@ -0,0 +1,202 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/meta"
+	"go.uber.org/zap"
+)
+
+// historyJobsBatch is the number of history DDL jobs read from TiKV at a time.
+const historyJobsBatch = 1024
+
+// SchemaSnapshot is the schema of the upstream at TS. A drainer starting at or
+// after TS builds its schema from the snapshot and the DDL jobs finished after
+// it, instead of replaying all the history DDL jobs.
+type SchemaSnapshot struct {
+	TS            int64 `json:"ts"`
+	SchemaVersion int64 `json:"schema-version"`
+	// MinJobID is the min id of the DDL jobs may finish after TS, the jobs
+	// with smaller ids are all included in the snapshot.
+	MinJobID int64 `json:"min-job-id"`
+	// DroppingColumnTables are the ids of the tables in the middle of dropping
+	// a column at TS.
+	DroppingColumnTables []int64 `json:"dropping-column-tables,omitempty"`
+	// Schemas are the databases with their tables.
+	Schemas []*SchemaTables `json:"schemas"`
+}
+
+// SchemaTables is a database with its tables, the tables of DBInfo aren't
+// encoded in JSON.
+type SchemaTables struct {
+	Schema *model.DBInfo      `json:"schema"`
+	Tables []*model.TableInfo `json:"tables"`
+}
+
+// LoadSchemaSnapshotAt reads the schema of the upstream at ts from TiKV.
+func LoadSchemaSnapshotAt(pdURLs string, ts int64) (*SchemaSnapshot, error) {
+	tiStore, err := createTiStore(pdURLs)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer tiStore.Close()
+
+	return schemaSnapshotAt(meta.NewSnapshotMeta(tiStore.GetSnapshot(kv.NewVersion(uint64(ts)))), ts)
+}
+
+func schemaSnapshotAt(m *meta.Meta, ts int64) (*SchemaSnapshot, error) {
+	snapshot := &SchemaSnapshot{TS: ts}
+
+	var err error
+	snapshot.SchemaVersion, err = m.GetSchemaVersion()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	// the jobs created after ts have larger ids than the global id at ts.
+	globalID, err := m.GetGlobalID()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	snapshot.MinJobID = globalID + 1
+	for _, key := range []meta.JobListKeyType{meta.DefaultJobListKey, meta.AddIndexJobListKey} {
+		jobs, err := m.GetAllDDLJobsInQueue(key)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for _, job := range jobs {
+			if job.ID < snapshot.MinJobID {
+				snapshot.MinJobID = job.ID
+			}
+			if job.Type == model.ActionDropColumn && job.SchemaState != model.StatePublic {
+				snapshot.DroppingColumnTables = append(snapshot.DroppingColumnTables, job.TableID)
+			}
+		}
+	}
+
+	dbs, err := m.ListDatabases()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, db := range dbs {
+		tables, err := m.ListTables(db.ID)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		snapshot.Schemas = append(snapshot.Schemas, &SchemaTables{Schema: db, Tables: tables})
+	}
+
+	return snapshot, nil
+}
+
+// ReadSchemaSnapshot reads the schema snapshot saved by WriteFile.
+func ReadSchemaSnapshot(file string) (*SchemaSnapshot, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	snapshot := new(SchemaSnapshot)
+	if err = json.Unmarshal(data, snapshot); err != nil {
+		return nil, errors.Annotatef(err, "parse schema snapshot file %s", file)
+	}
+	return snapshot, nil
+}
+
+// WriteFile saves the schema snapshot to the file.
+func (s *SchemaSnapshot) WriteFile(file string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(ioutil.WriteFile(file, data, 0600))
+}
+
+// loadDDLJobsAfterSnapshot loads the history DDL jobs finished after the
+// snapshot, they are sorted by schema version.
+func loadDDLJobsAfterSnapshot(tiStore kv.Storage, snapshot *SchemaSnapshot) ([]*model.Job, error) {
+	snapMeta, err := getSnapshotMeta(tiStore)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	iter, err := snapMeta.GetLastHistoryDDLJobsIterator()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return ddlJobsAfterSnapshot(iter.GetLastJobs, snapshot)
+}
+
+// ddlJobsAfterSnapshot reads the history DDL jobs from the latest one backward
+// until the jobs are all included in the snapshot.
+func ddlJobsAfterSnapshot(getLastJobs func(int, []*model.Job) ([]*model.Job, error), snapshot *SchemaSnapshot) ([]*model.Job, error) {
+	var jobs, batch []*model.Job
+	var err error
+	for {
+		batch, err = getLastJobs(historyJobsBatch, batch)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for _, job := range batch {
+			if job.ID < snapshot.MinJobID {
+				return sortJobsBySchemaVersion(jobs), nil
+			}
+			if job.BinlogInfo.SchemaVersion > snapshot.SchemaVersion {
+				jobs = append(jobs, job)
+			}
+		}
+		if len(batch) < historyJobsBatch {
+			return sortJobsBySchemaVersion(jobs), nil
+		}
+	}
+}
+
+func sortJobsBySchemaVersion(jobs []*model.Job) []*model.Job {
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].BinlogInfo.SchemaVersion < jobs[j].BinlogInfo.SchemaVersion
+	})
+	return jobs
+}
+
+// loadSnapshot initializes the schema with the snapshot, the jobs not after the
+// version of the snapshot are skipped.
+func (s *Schema) loadSnapshot(snapshot *SchemaSnapshot) error {
+	for _, st := range snapshot.Schemas {
+		db := st.Schema
+		db.Tables = nil
+		if err := s.CreateSchema(db); err != nil {
+			return errors.Trace(err)
+		}
+		for _, table := range st.Tables {
+			if err := s.CreateTable(snapshot.SchemaVersion, db, table); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	for _, id := range snapshot.DroppingColumnTables {
+		s.tblsDroppingCol[id] = true
+	}
+	s.currentVersion = snapshot.SchemaVersion
+
+	log.Info("load schema snapshot success", zap.Int64("ts", snapshot.TS),
+		zap.Int64("schema version", snapshot.SchemaVersion), zap.Int("schemas", len(snapshot.Schemas)))
+	return nil
+}
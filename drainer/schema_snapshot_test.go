@@ -0,0 +1,125 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"path"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+)
+
+type schemaSnapshotSuite struct{}
+
+var _ = Suite(&schemaSnapshotSuite{})
+
+func newTestSchemaSnapshot() *SchemaSnapshot {
+	return &SchemaSnapshot{
+		TS:                   100,
+		SchemaVersion:        10,
+		MinJobID:             20,
+		DroppingColumnTables: []int64{4},
+		Schemas: []*SchemaTables{{
+			Schema: &model.DBInfo{ID: 1, Name: model.NewCIStr("test"), State: model.StatePublic},
+			Tables: []*model.TableInfo{
+				{ID: 3, Name: model.NewCIStr("t1"), State: model.StatePublic, PKIsHandle: true},
+				{ID: 4, Name: model.NewCIStr("t2"), State: model.StatePublic, PKIsHandle: true},
+			},
+		}},
+	}
+}
+
+func (s *schemaSnapshotSuite) TestReadWrite(c *C) {
+	file := path.Join(c.MkDir(), "schema.json")
+	snapshot := newTestSchemaSnapshot()
+	c.Assert(snapshot.WriteFile(file), IsNil)
+
+	read, err := ReadSchemaSnapshot(file)
+	c.Assert(err, IsNil)
+	c.Assert(read.TS, Equals, snapshot.TS)
+	c.Assert(read.SchemaVersion, Equals, snapshot.SchemaVersion)
+	c.Assert(read.MinJobID, Equals, snapshot.MinJobID)
+	c.Assert(read.DroppingColumnTables, DeepEquals, snapshot.DroppingColumnTables)
+	c.Assert(read.Schemas, HasLen, 1)
+	c.Assert(read.Schemas[0].Tables, HasLen, 2)
+
+	_, err = ReadSchemaSnapshot(path.Join(c.MkDir(), "not-exist"))
+	c.Assert(err, NotNil)
+}
+
+func (s *schemaSnapshotSuite) TestLoadSnapshot(c *C) {
+	dropTable := &model.Job{
+		ID:       21,
+		Type:     model.ActionDropTable,
+		State:    model.JobStateDone,
+		SchemaID: 1,
+		TableID:  3,
+		Query:    "drop table t1",
+		BinlogInfo: &model.HistoryInfo{
+			SchemaVersion: 11,
+			FinishedTS:    101,
+		},
+	}
+	schema, err := NewSchema([]*model.Job{dropTable}, false)
+	c.Assert(err, IsNil)
+	c.Assert(schema.loadSnapshot(newTestSchemaSnapshot()), IsNil)
+
+	schemaName, tableName, ok := schema.SchemaAndTableName(3)
+	c.Assert(ok, IsTrue)
+	c.Assert(schemaName, Equals, "test")
+	c.Assert(tableName, Equals, "t1")
+	_, ok = schema.TableByID(4)
+	c.Assert(ok, IsTrue)
+	c.Assert(schema.IsDroppingColumn(4), IsTrue)
+
+	// the jobs after the snapshot are applied on it.
+	c.Assert(schema.handlePreviousDDLJobIfNeed(11), IsNil)
+	_, ok = schema.TableByID(3)
+	c.Assert(ok, IsFalse)
+	db, ok := schema.SchemaByID(1)
+	c.Assert(ok, IsTrue)
+	c.Assert(db.Tables, HasLen, 1)
+}
+
+func (s *schemaSnapshotSuite) TestDDLJobsAfterSnapshot(c *C) {
+	// the history jobs from the latest one, the job 2 is a long running job
+	// finished after the snapshot.
+	var history []*model.Job
+	for id := int64(2000); id > 0; id-- {
+		version := int64(10)
+		switch {
+		case id > 2:
+			version = id + 10
+		case id == 2:
+			version = 2005
+		}
+		history = append(history, &model.Job{ID: id, BinlogInfo: &model.HistoryInfo{SchemaVersion: version}})
+	}
+	getLastJobs := func(num int, jobs []*model.Job) ([]*model.Job, error) {
+		if num > len(history) {
+			num = len(history)
+		}
+		jobs = history[:num]
+		history = history[num:]
+		return jobs, nil
+	}
+
+	snapshot := &SchemaSnapshot{SchemaVersion: 1000, MinJobID: 2}
+	jobs, err := ddlJobsAfterSnapshot(getLastJobs, snapshot)
+	c.Assert(err, IsNil)
+	c.Assert(jobs, HasLen, 1011)
+	c.Assert(jobs[0].BinlogInfo.SchemaVersion, Equals, int64(1001))
+	c.Assert(jobs[len(jobs)-1].BinlogInfo.SchemaVersion, Equals, int64(2010))
+	c.Assert(history, HasLen, 0)
+}
@@ -385,6 +385,163 @@ func (t *schemaSuite) TestHandleDDL(c *C) {
 	}
 }
 
+func (t *schemaSuite) TestRenameTables(c *C) {
+	schema, err := NewSchema(nil, true)
+	c.Assert(err, IsNil)
+	db1 := &model.DBInfo{ID: 1, Name: model.NewCIStr("a"), State: model.StatePublic}
+	db2 := &model.DBInfo{ID: 2, Name: model.NewCIStr("b"), State: model.StatePublic}
+	c.Assert(schema.CreateSchema(db1), IsNil)
+	c.Assert(schema.CreateSchema(db2), IsNil)
+	t1 := &model.TableInfo{ID: 3, Name: model.NewCIStr("t1"), State: model.StatePublic}
+	t2 := &model.TableInfo{ID: 4, Name: model.NewCIStr("t2"), State: model.StatePublic}
+	c.Assert(schema.CreateTable(1, db1, t1), IsNil)
+	c.Assert(schema.CreateTable(1, db1, t2), IsNil)
+
+	job := &model.Job{
+		ID:       5,
+		State:    model.JobStateDone,
+		SchemaID: db2.ID,
+		TableID:  t1.ID,
+		Type:     model.ActionRenameTables,
+		Query:    "rename table a.t1 to b.t1, a.t2 to a.t3",
+		Args: []interface{}{[]int64{db1.ID, db1.ID}, []int64{db2.ID, db1.ID},
+			[]*model.CIStr{&t1.Name, {O: "t3", L: "t3"}}, []int64{t1.ID, t2.ID}},
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 2},
+	}
+	_, err = job.Encode(true)
+	c.Assert(err, IsNil)
+	schemaName, tableName, _, err := schema.handleDDL(job)
+	c.Assert(err, IsNil)
+	c.Assert(schemaName, Equals, "b")
+	c.Assert(tableName, Equals, "t3")
+
+	name, _, ok := schema.SchemaAndTableName(t1.ID)
+	c.Assert(ok, IsTrue)
+	c.Assert(name, Equals, "b")
+	tbl, ok := schema.TableByID(t2.ID)
+	c.Assert(ok, IsTrue)
+	c.Assert(tbl.Name.O, Equals, "t3")
+	// the implicit column isn't added again.
+	c.Assert(tbl.Columns, HasLen, 1)
+	c.Assert(db1.Tables, HasLen, 1)
+	c.Assert(db2.Tables, HasLen, 1)
+}
+
+func (t *schemaSuite) TestPartitionDDL(c *C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, IsNil)
+	db1 := &model.DBInfo{ID: 1, Name: model.NewCIStr("a"), State: model.StatePublic}
+	db2 := &model.DBInfo{ID: 2, Name: model.NewCIStr("b"), State: model.StatePublic}
+	c.Assert(schema.CreateSchema(db1), IsNil)
+	c.Assert(schema.CreateSchema(db2), IsNil)
+	pt := &model.TableInfo{ID: 3, Name: model.NewCIStr("pt"), State: model.StatePublic, Partition: &model.PartitionInfo{
+		Type:        model.PartitionTypeRange,
+		Definitions: []model.PartitionDefinition{{ID: 4, Name: model.NewCIStr("p0")}},
+	}}
+	nt := &model.TableInfo{ID: 5, Name: model.NewCIStr("nt"), State: model.StatePublic}
+	c.Assert(schema.CreateTable(1, db1, pt), IsNil)
+	c.Assert(schema.CreateTable(1, db2, nt), IsNil)
+
+	// add partition replaces the table info.
+	addPt := pt.Clone()
+	addPt.Partition.Definitions = append(addPt.Partition.Definitions, model.PartitionDefinition{ID: 6, Name: model.NewCIStr("p1")})
+	job := &model.Job{
+		ID:         7,
+		State:      model.JobStateDone,
+		SchemaID:   db1.ID,
+		TableID:    pt.ID,
+		Type:       model.ActionAddTablePartition,
+		Query:      "alter table pt add partition (partition p1 values less than (100))",
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 2, TableInfo: addPt},
+	}
+	schemaName, tableName, _, err := schema.handleDDL(job)
+	c.Assert(err, IsNil)
+	c.Assert(schemaName, Equals, "a")
+	c.Assert(tableName, Equals, "pt")
+	tbl, ok := schema.TableByID(pt.ID)
+	c.Assert(ok, IsTrue)
+	c.Assert(tbl.Partition.Definitions, HasLen, 2)
+
+	// the table and the partition exchange their ids.
+	exchangedPt := addPt.Clone()
+	exchangedPt.Partition.Definitions[0].ID = nt.ID
+	job = &model.Job{
+		ID:         8,
+		State:      model.JobStateDone,
+		SchemaID:   db2.ID,
+		TableID:    nt.ID,
+		Type:       model.ActionExchangeTablePartition,
+		Query:      "alter table a.pt exchange partition p0 with table b.nt",
+		Args:       []interface{}{int64(4), db1.ID, pt.ID, "p0", true},
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 3, TableInfo: exchangedPt},
+	}
+	_, err = job.Encode(true)
+	c.Assert(err, IsNil)
+	schemaName, tableName, _, err = schema.handleDDL(job)
+	c.Assert(err, IsNil)
+	c.Assert(schemaName, Equals, "a")
+	c.Assert(tableName, Equals, "pt")
+
+	_, ok = schema.TableByID(nt.ID)
+	c.Assert(ok, IsFalse)
+	name, table, ok := schema.SchemaAndTableName(4)
+	c.Assert(ok, IsTrue)
+	c.Assert(name, Equals, "b")
+	c.Assert(table, Equals, "nt")
+	tbl, ok = schema.TableByID(pt.ID)
+	c.Assert(ok, IsTrue)
+	c.Assert(tbl.Partition.Definitions[0].ID, Equals, nt.ID)
+	c.Assert(db2.Tables, HasLen, 1)
+	c.Assert(db2.Tables[0].ID, Equals, int64(4))
+}
+
+func (t *schemaSuite) TestTemporaryTable(c *C) {
+	schema, err := NewSchema(nil, false)
+	c.Assert(err, IsNil)
+	dbInfo := &model.DBInfo{ID: 1, Name: model.NewCIStr("test"), State: model.StatePublic}
+	c.Assert(schema.CreateSchema(dbInfo), IsNil)
+
+	newJob := func(tp model.ActionType, version int64, table *model.TableInfo, query string) *model.Job {
+		return &model.Job{
+			ID:         version,
+			State:      model.JobStateDone,
+			SchemaID:   dbInfo.ID,
+			TableID:    table.ID,
+			Type:       tp,
+			Query:      query,
+			BinlogInfo: &model.HistoryInfo{SchemaVersion: version, TableInfo: table},
+		}
+	}
+
+	normal := &model.TableInfo{ID: 2, Name: model.NewCIStr("t1"), State: model.StatePublic}
+	temp := &model.TableInfo{ID: 3, Name: model.NewCIStr("t2"), State: model.StatePublic, TempTableType: model.TempTableGlobal}
+	ctas := &model.TableInfo{ID: 4, Name: model.NewCIStr("t3"), State: model.StatePublic}
+	jobs := []*model.Job{
+		newJob(model.ActionCreateTable, 1, normal, "create table t1 (id int) comment 'not a select'"),
+		newJob(model.ActionCreateTable, 2, temp, "create global temporary table t2 (id int) on commit delete rows"),
+		newJob(model.ActionCreateTable, 3, ctas, "create table t3 (id int) select id from t1"),
+	}
+	for _, job := range jobs {
+		_, _, _, err = schema.handleDDL(job)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(schema.IsTemporaryTable(normal.ID), IsFalse)
+	c.Assert(schema.IsTemporaryTable(temp.ID), IsTrue)
+	// the table created by select is a normal table.
+	c.Assert(schema.IsTemporaryTable(ctas.ID), IsFalse)
+	c.Assert(schema.isTemporaryTableJob(jobs[0]), IsFalse)
+	c.Assert(schema.isTemporaryTableJob(jobs[1]), IsTrue)
+	c.Assert(schema.isTemporaryTableJob(jobs[2]), IsFalse)
+	c.Assert(isCreateTableSelect(jobs[0].Query), IsFalse)
+	c.Assert(isCreateTableSelect(jobs[2].Query), IsTrue)
+
+	// the dropped temporary table
+	job := newJob(model.ActionDropTable, 4, temp, "drop table t2")
+	_, _, _, err = schema.handleDDL(job)
+	c.Assert(err, IsNil)
+	c.Assert(schema.isTemporaryTableJob(job), IsTrue)
+}
+
 func (t *schemaSuite) TestAddImplicitColumn(c *C) {
 	tbl := model.TableInfo{}
 
@@ -15,9 +15,12 @@ package drainer
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -26,9 +29,15 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
 	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
 	"github.com/pingcap/tidb-binlog/pkg/node"
+	"github.com/pingcap/tidb-binlog/pkg/proxy"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/store"
@@ -38,6 +47,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/soheilhy/cmux"
+	pd "github.com/tikv/pd/client"
 	"github.com/unrolled/render"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
@@ -51,6 +61,12 @@ var (
 	getPdClient       = util.GetPdClient
 )
 
+// the steps of starting drainer reported by /ready.
+const (
+	readyStepSchema = "schema"
+	readyStepEtcd   = "etcd"
+)
+
 type drainerKeyType string
 
 // Server implements the gRPC interface,
@@ -72,6 +88,16 @@ type Server struct {
 	cp            checkpoint.CheckPoint
 	isClosed      int32
 
+	pdCli       pd.Client
+	gcSafePoint *gcSafePointKeeper
+	// proxy dials the connections to downstream, nil if they're dialed directly.
+	proxy proxy.Dialer
+
+	// statusLis serves the HTTP API if it's not served on tcpAddr.
+	statusLis net.Listener
+	// readiness is served by /ready, drainer is ready after the schema is loaded and it's registered to etcd.
+	readiness *util.Readiness
+
 	statusMu sync.RWMutex
 	status   *node.Status
 
@@ -99,6 +125,12 @@ func NewServer(cfg *Config) (*Server, error) {
 		return nil, err
 	}
 
+	if cfg.RepairBinlogFiles {
+		if err := repairBinlogDirs(cfg.SyncerCfg); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
 	if cfg.tls != nil {
 		// TODO: avoid this magic enabling TLS for tikv client.
 		var _ = cfg.Security.ToTiDBSecurityConfig()
@@ -116,6 +148,7 @@ func NewServer(cfg *Config) (*Server, error) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	ctx = context.WithValue(ctx, drainerKeyType("compressor"), cfg.Compressor)
+	ctx = context.WithValue(ctx, drainerKeyType("payloadCompression"), cfg.PayloadCompression)
 
 	clusterID := pdCli.GetClusterID(ctx)
 	log.Info("get cluster id from pd", zap.Uint64("id", clusterID))
@@ -132,7 +165,20 @@ func NewServer(cfg *Config) (*Server, error) {
 	}
 
 	cfg.SyncerCfg.To.ClusterID = clusterID
-	pdCli.Close()
+	cfg.SyncerCfg.To.NodeID = cfg.NodeID
+	if !cfg.GCSafePoint.enabled() {
+		pdCli.Close()
+		pdCli = nil
+	}
+
+	var downstreamProxy proxy.Dialer
+	if cfg.SyncerCfg.To.Proxy.Enabled() {
+		// register before connecting to downstream, including saving the checkpoint.
+		downstreamProxy, err = registerProxy(cfg.SyncerCfg.To)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
 
 	cpCfg, err := GenCheckPointCfg(cfg, clusterID)
 	if err != nil {
@@ -146,16 +192,34 @@ func NewServer(cfg *Config) (*Server, error) {
 
 	checkpointTSOGauge.Set(float64(oracle.ExtractPhysical(uint64(cp.TS()))))
 
-	syncer, err := createSyncer(cfg.EtcdURLs, cp, cfg.SyncerCfg)
+	var gcSafePoint *gcSafePointKeeper
+	if pdCli != nil {
+		gcSafePoint = newGCSafePointKeeper(pdCli, cfg.NodeID, cfg.GCSafePoint, cp)
+		// hold GC back before loading the schema.
+		if err = gcSafePoint.update(ctx); err != nil {
+			log.Warn("update GC safepoint failed", zap.Error(err))
+		}
+	}
+
+	readiness := util.NewReadiness(readyStepSchema, readyStepEtcd)
+	syncer, err := createSyncer(cfg.EtcdURLs, cp, cfg.SyncerCfg, cfg.SchemaSnapshotFile)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	readiness.Done(readyStepSchema)
 
 	c, err := NewCollector(cfg, clusterID, syncer, cp)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
+	if len(cfg.AssignmentGroup) > 0 {
+		syncer.assignment, err = loadTableAssignment(ctx, c.reg, cfg.AssignmentGroup, cfg.NodeID)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
 	var metrics *util.MetricClient
 	if cfg.MetricsAddr != "" && cfg.MetricsInterval != 0 {
 		metrics = util.NewMetricClient(
@@ -171,6 +235,13 @@ func NewServer(cfg *Config) (*Server, error) {
 	}
 
 	status := node.NewStatus(cfg.NodeID, advURL.Host, node.Online, 0, syncer.GetLatestCommitTS(), util.GetApproachTS(latestTS, latestTime))
+	if len(cfg.AdvertiseStatusAddr) > 0 {
+		statusURL, err := url.Parse(cfg.AdvertiseStatusAddr)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid configuration of advertise status addr(%s)", cfg.AdvertiseStatusAddr)
+		}
+		status.StatusAddr = statusURL.Host
+	}
 
 	return &Server{
 		ID:            cfg.NodeID,
@@ -186,20 +257,50 @@ func NewServer(cfg *Config) (*Server, error) {
 		syncer:        syncer,
 		cp:            cp,
 		status:        status,
+		pdCli:         pdCli,
+		gcSafePoint:   gcSafePoint,
+		proxy:         downstreamProxy,
+		readiness:     readiness,
 
 		latestTS:   latestTS,
 		latestTime: latestTime,
 	}, nil
 }
 
-func createSyncer(etcdURLs string, cp checkpoint.CheckPoint, cfg *SyncerConfig) (syncer *Syncer, err error) {
+// registerProxy makes the connections to downstream be dialed through the proxy.
+func registerProxy(to *dsync.DBConfig) (proxy.Dialer, error) {
+	dialer, err := proxy.NewDialer(&to.Proxy)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	loader.RegisterDialer(to.Host, to.Port, dialer.DialContext)
+	log.Info("connect to downstream through the proxy", zap.String("type", to.Proxy.Type),
+		zap.String("proxy", to.Proxy.Addr), zap.String("host", to.Host), zap.Int("port", to.Port))
+	return dialer, nil
+}
+
+func createSyncer(etcdURLs string, cp checkpoint.CheckPoint, cfg *SyncerConfig, schemaSnapshotFile string) (syncer *Syncer, err error) {
 	tiStore, err := createTiStore(etcdURLs)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 	defer tiStore.Close()
 
-	jobs, err := loadHistoryDDLJobs(tiStore)
+	var snapshot *SchemaSnapshot
+	var jobs []*model.Job
+	if len(schemaSnapshotFile) > 0 {
+		snapshot, err = ReadSchemaSnapshot(schemaSnapshotFile)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		// the binlogs before the snapshot can't be decoded by the schema after it.
+		if cp.TS() < snapshot.TS {
+			return nil, errors.Errorf("the checkpoint %d is before the ts %d of the schema snapshot", cp.TS(), snapshot.TS)
+		}
+		jobs, err = loadDDLJobsAfterSnapshot(tiStore, snapshot)
+	} else {
+		jobs, err = loadHistoryDDLJobs(tiStore)
+	}
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -209,10 +310,38 @@ func createSyncer(etcdURLs string, cp checkpoint.CheckPoint, cfg *SyncerConfig)
 		return nil, errors.Trace(err)
 	}
 
+	if snapshot != nil {
+		if err = syncer.schema.loadSnapshot(snapshot); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
 	return
 }
 
 // DumpBinlog implements the gRPC interface of drainer server
+// repairBinlogDirs repairs the directories of the binlog files written by drainer,
+// the problems left are reported when the files are opened.
+func repairBinlogDirs(cfg *SyncerConfig) error {
+	var dirs []string
+	if cfg.Relay.IsEnabled() {
+		dirs = append(dirs, cfg.Relay.LogDir)
+	}
+	if cfg.DestDBType == "file" {
+		dirs = append(dirs, cfg.To.BinlogFileDir)
+	}
+	for _, dir := range dirs {
+		_, err := binlogfile.RepairDir(dir, binlogfile.RepairOptions{
+			TruncateTornTail: true,
+			QuarantineDir:    filepath.Clean(dir) + ".quarantine",
+		})
+		if err != nil {
+			return errors.Annotatef(err, "repair %s", dir)
+		}
+	}
+	return nil
+}
+
 func (s *Server) DumpBinlog(req *binlog.DumpBinlogReq, stream binlog.Cistern_DumpBinlogServer) (err error) {
 	return nil
 }
@@ -261,6 +390,7 @@ func (s *Server) Start() error {
 		return errors.Trace(err)
 	}
 	log.Info("register success", zap.String("drainer node id", s.ID))
+	s.readiness.Done(readyStepEtcd)
 
 	// chan to record errors from some background goroutines, increase the cap if needed.
 	errCh := make(chan error, 10)
@@ -279,6 +409,16 @@ func (s *Server) Start() error {
 		s.collector.Start(s.ctx)
 	})
 
+	if s.gcSafePoint != nil {
+		s.tg.GoNoPanic("gc safepoint", func() {
+			s.gcSafePoint.run(s.ctx)
+		})
+	}
+
+	s.tg.GoNoPanic("systemd watchdog", func() {
+		s.readiness.KeepAlive(s.ctx)
+	})
+
 	if s.metrics != nil {
 		s.tg.GoNoPanic("metrics", func() {
 			s.metrics.Start(s.ctx, map[string]string{"instance": s.ID})
@@ -304,7 +444,17 @@ func (s *Server) Start() error {
 		cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"),
 		cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc+proto"),
 	)
-	httpL := m.Match(cmux.HTTP1Fast())
+	// the HTTP API is served on tcpAddr too if status-addr is not set
+	var httpL net.Listener
+	if len(s.cfg.StatusAddr) > 0 {
+		httpL, err = util.Listen("tcp", s.cfg.StatusAddr, s.cfg.tls)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		s.statusLis = httpL
+	} else {
+		httpL = m.Match(cmux.HTTP1Fast())
+	}
 
 	// register drainer server with gRPC server and start to serve listener
 	binlog.RegisterCisternServer(s.gs, s)
@@ -326,7 +476,7 @@ func (s *Server) Start() error {
 		}
 	}()
 
-	log.Info("start to server request", zap.String("addr", s.advertiseAddr))
+	log.Info("start to server request", zap.String("addr", s.advertiseAddr), zap.String("status addr", s.cfg.AdvertiseStatusAddr))
 	go func() {
 		defer func() { go s.Close() }()
 		if err := m.Serve(); !strings.Contains(err.Error(), "use of closed network connection") {
@@ -356,7 +506,7 @@ func (s *Server) ApplyAction(w http.ResponseWriter, r *http.Request) {
 	log.Info("receive apply action request", zap.String("nodeID", nodeID), zap.String("action", action))
 
 	if nodeID != s.ID {
-		err := rd.JSON(w, http.StatusOK, util.ErrResponsef("invalid nodeID %s, this pump's nodeID is %s", nodeID, s.ID))
+		err := rd.JSON(w, http.StatusOK, util.ErrCodeResponsef(errorcode.InvalidArgument, "invalid nodeID %s, this pump's nodeID is %s", nodeID, s.ID))
 		if err != nil {
 			log.Error("Failed to render JSON response", zap.Error(err))
 		}
@@ -365,7 +515,7 @@ func (s *Server) ApplyAction(w http.ResponseWriter, r *http.Request) {
 
 	s.statusMu.RLock()
 	if s.status.State != node.Online {
-		err := rd.JSON(w, http.StatusOK, util.ErrResponsef("this pump's state is %s, apply %s failed!", s.status.State, action))
+		err := rd.JSON(w, http.StatusOK, util.ErrCodeResponsef(errorcode.InvalidState, "this pump's state is %s, apply %s failed!", s.status.State, action))
 		if err != nil {
 			log.Error("Failed to render JSON response", zap.Error(err))
 		}
@@ -382,7 +532,7 @@ func (s *Server) ApplyAction(w http.ResponseWriter, r *http.Request) {
 		s.status.State = node.Closing
 	default:
 		s.statusMu.Unlock()
-		err := rd.JSON(w, http.StatusOK, util.ErrResponsef("invalid action %s", action))
+		err := rd.JSON(w, http.StatusOK, util.ErrCodeResponsef(errorcode.InvalidArgument, "invalid action %s", action))
 		if err != nil {
 			log.Error("Failed to render JSON response", zap.Error(err))
 		}
@@ -409,6 +559,81 @@ func (s *Server) GetLatestTS(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetStatusV1 returns the status of drainer in the stable format of v1.
+func (s *Server) GetStatusV1(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	err := rd.JSON(w, http.StatusOK, s.statusV1(time.Now()))
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+func (s *Server) statusV1(now time.Time) *StatusV1 {
+	s.statusMu.RLock()
+	state, addr := s.status.State, s.status.Addr
+	s.statusMu.RUnlock()
+
+	collectorStatus := s.collector.HTTPStatus()
+	mergerStats := s.collector.merger.Stats()
+	ts := s.cp.TS()
+
+	status := &StatusV1{
+		APIVersion: StatusAPIVersion,
+		NodeID:     s.ID,
+		Addr:       addr,
+		State:      state,
+		Synced:     collectorStatus.Synced,
+		Checkpoint: CheckpointStatusV1{
+			TS:            ts,
+			Time:          tsTime(ts),
+			SchemaVersion: s.cp.SchemaVersion(),
+			LagSeconds:    lagSeconds(ts, now),
+		},
+		Pumps: make([]PumpStatusV1, 0, len(collectorStatus.PumpPos)),
+		Queues: map[string]int{
+			"merger-output": len(s.collector.merger.Output()),
+			"syncer-input":  len(s.syncer.input),
+		},
+		LastDDL:    s.syncer.GetLastDDL(),
+		ConfigHash: configHash(s.cfg),
+	}
+	for nodeID, pullTS := range collectorStatus.PumpPos {
+		pumpStatus := PumpStatusV1{
+			NodeID:     nodeID,
+			PullTS:     pullTS,
+			Time:       tsTime(pullTS),
+			LagSeconds: lagSeconds(pullTS, now),
+			Pending:    mergerStats.Sources[nodeID].Pending,
+		}
+		if stats := collectorStatus.PumpStats[nodeID]; stats != nil {
+			pumpStatus.Stats = &PumpStatsV1{
+				WriteBytesPerSecond:    stats.WriteBytesPerSecond,
+				FsyncLatencyP99Seconds: stats.FsyncLatencyP99,
+				DiskFreeBytes:          stats.DiskFreeBytes,
+			}
+		}
+		status.Pumps = append(status.Pumps, pumpStatus)
+	}
+	sort.Slice(status.Pumps, func(i, j int) bool {
+		return status.Pumps[i].NodeID < status.Pumps[j].NodeID
+	})
+	return status
+}
+
+// GetMergerStats dumps the commit ts buffered by merger for each pump.
+func (s *Server) GetMergerStats(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	stats := s.collector.merger.Stats()
+	err := rd.JSON(w, http.StatusOK, util.SuccessResponse("get merger stats success!", stats))
+	if err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
 // commitStatus commit the node's last status to pd when close the server.
 func (s *Server) commitStatus() {
 	// update this node
@@ -447,9 +672,17 @@ func (s *Server) updateStatus() error {
 
 func (s *Server) initAPIRouter() *mux.Router {
 	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/status", s.GetStatusV1).Methods("GET")
+	router.HandleFunc("/api/v1/watermarks", s.GetWatermarks).Methods("GET")
 	router.HandleFunc("/status", s.collector.Status).Methods("GET")
 	router.HandleFunc("/commit_ts", s.GetLatestTS).Methods("GET")
 	router.HandleFunc("/state/{nodeID}/{action}", s.ApplyAction).Methods("PUT")
+	router.HandleFunc("/debug/merger", s.GetMergerStats).Methods("GET")
+	router.HandleFunc("/syncer/tuning", s.Tuning).Methods("GET", "PUT")
+	router.HandleFunc("/syncer/bandwidth", s.Bandwidth).Methods("GET", "PUT")
+	router.HandleFunc("/debug/hotspot", s.GetHotspots).Methods("GET")
+	router.HandleFunc("/log-level", util.HandleLogLevel).Methods("GET", "PUT")
+	router.Handle("/ready", s.readiness).Methods("GET")
 	prometheus.DefaultGatherer = registry
 	router.Handle("/metrics", promhttp.Handler())
 	return router
@@ -463,6 +696,9 @@ func (s *Server) Close() {
 	}
 
 	log.Info("begin to close drainer server")
+	if s.readiness != nil {
+		s.readiness.Closing()
+	}
 
 	// update drainer's status
 	s.commitStatus()
@@ -473,17 +709,51 @@ func (s *Server) Close() {
 	s.syncer.Close()
 	// waiting for goroutines exit
 	s.tg.Wait()
+	if s.gcSafePoint != nil {
+		s.updateGCSafePointOnClose()
+		s.pdCli.Close()
+	}
 	// close the CheckPoint
 	err := s.cp.Close()
 	if err != nil {
 		log.Error("close checkpoint failed", zap.Error(err))
 	}
+	if s.proxy != nil {
+		if err := s.proxy.Close(); err != nil {
+			log.Error("close proxy failed", zap.Error(err))
+		}
+	}
 
 	// stop gRPC server
 	s.gs.Stop()
+	if s.statusLis != nil {
+		if err := s.statusLis.Close(); err != nil {
+			log.Error("close status listener failed", zap.Error(err))
+		}
+	}
 	log.Info("drainer exit")
 }
 
+// updateGCSafePointOnClose removes the GC safepoint of the offline drainer, or updates it
+// to the final checkpoint which is kept by PD for the ttl.
+func (s *Server) updateGCSafePointOnClose() {
+	s.statusMu.RLock()
+	offline := s.status.State == node.Offline
+	s.statusMu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var err error
+	if offline {
+		err = s.gcSafePoint.remove(ctx)
+	} else {
+		err = s.gcSafePoint.update(ctx)
+	}
+	if err != nil {
+		log.Warn("update GC safepoint on close failed", zap.Bool("offline", offline), zap.Error(err))
+	}
+}
+
 func createTiStore(urls string) (kv.Storage, error) {
 	urlv, err := flags.NewURLsValue(urls)
 	if err != nil {
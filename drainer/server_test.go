@@ -26,10 +26,13 @@ import (
 
 	"github.com/gorilla/mux"
 	. "github.com/pingcap/check"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
 	"github.com/pingcap/tidb-binlog/pkg/etcd"
 	"github.com/pingcap/tidb-binlog/pkg/node"
 	"github.com/pingcap/tidb-binlog/pkg/security"
 	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	pb "github.com/pingcap/tipb/go-binlog"
 	pd "github.com/tikv/pd/client"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
@@ -68,6 +71,87 @@ func (t *testServerSuite) TestGetLatestTS(c *C) {
 	c.Assert(int64(ts), Equals, int64(1984))
 }
 
+type versionedCheckpoint struct {
+	dummyCheckpoint
+	schemaVersion int64
+}
+
+func (cp versionedCheckpoint) SchemaVersion() int64 {
+	return cp.schemaVersion
+}
+
+func (t *testServerSuite) TestGetStatusV1(c *C) {
+	pumpA := MergeSource{ID: "pump-a", Source: make(chan MergeItem, 10)}
+	pumpB := MergeSource{ID: "pump-b", Source: make(chan MergeItem, 10)}
+	pumpA.Source <- newBinlogItem(&pb.Binlog{CommitTs: 1}, "pump-a")
+	merger := NewMerger(0, heapStrategy, pumpB, pumpA)
+	defer merger.Close()
+
+	ts := oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-time.Minute)), 0)
+	cp := &versionedCheckpoint{dummyCheckpoint: dummyCheckpoint{commitTS: int64(ts)}, schemaVersion: 42}
+	syncer := &Syncer{cp: cp, input: make(chan *binlogItem, 10)}
+	syncer.input <- nil
+	collector := &Collector{merger: merger, syncer: syncer}
+	collector.mu.status = &HTTPStatus{
+		PumpPos:   map[string]int64{"pump-b": int64(ts), "pump-a": int64(ts)},
+		PumpStats: map[string]*node.PumpStats{"pump-a": {WriteBytesPerSecond: 1024, FsyncLatencyP99: 0.002, DiskFreeBytes: 4096}},
+	}
+	server := Server{
+		ID:        "drainer",
+		status:    &node.Status{State: node.Online, Addr: "127.0.0.1:8249"},
+		collector: collector,
+		syncer:    syncer,
+		cp:        cp,
+		cfg:       NewConfig(),
+	}
+	router := server.initAPIRouter()
+
+	get := func() *StatusV1 {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/status", nil))
+		c.Assert(w.Code, Equals, http.StatusOK)
+		status := new(StatusV1)
+		c.Assert(json.Unmarshal(w.Body.Bytes(), status), IsNil)
+		return status
+	}
+
+	status := get()
+	c.Assert(status.APIVersion, Equals, StatusAPIVersion)
+	c.Assert(status.NodeID, Equals, "drainer")
+	c.Assert(status.Addr, Equals, "127.0.0.1:8249")
+	c.Assert(status.State, Equals, node.Online)
+	c.Assert(status.Checkpoint.TS, Equals, int64(ts))
+	c.Assert(status.Checkpoint.SchemaVersion, Equals, int64(42))
+	c.Assert(status.Checkpoint.LagSeconds >= 60, IsTrue)
+	c.Assert(status.Pumps, HasLen, 2)
+	c.Assert(status.Pumps[0].NodeID, Equals, "pump-a")
+	c.Assert(status.Pumps[1].NodeID, Equals, "pump-b")
+	c.Assert(status.Pumps[0].PullTS, Equals, int64(ts))
+	c.Assert(status.Pumps[0].LagSeconds >= 60, IsTrue)
+	c.Assert(status.Pumps[0].Stats, DeepEquals, &PumpStatsV1{WriteBytesPerSecond: 1024, FsyncLatencyP99Seconds: 0.002, DiskFreeBytes: 4096})
+	c.Assert(status.Pumps[1].Stats, IsNil)
+	c.Assert(status.Queues["syncer-input"], Equals, 1)
+	c.Assert(status.LastDDL, IsNil)
+	c.Assert(status.ConfigHash, Not(Equals), "")
+
+	syncer.setLastDDL(&dsync.Item{
+		Binlog:        &pb.Binlog{CommitTs: 100, DdlJobId: 7, DdlQuery: []byte("create table t(a int)")},
+		SchemaVersion: 43,
+		Schema:        "test",
+		Table:         "t",
+	})
+	hash := status.ConfigHash
+	server.cfg.SyncerCfg.TxnBatch++
+	status = get()
+	c.Assert(status.LastDDL, NotNil)
+	c.Assert(status.LastDDL.CommitTS, Equals, int64(100))
+	c.Assert(status.LastDDL.JobID, Equals, int64(7))
+	c.Assert(status.LastDDL.SchemaVersion, Equals, int64(43))
+	c.Assert(status.LastDDL.Table, Equals, "t")
+	c.Assert(status.LastDDL.Query, Equals, "create table t(a int)")
+	c.Assert(status.ConfigHash, Not(Equals), hash)
+}
+
 func (t *testServerSuite) TestNotify(c *C) {
 	server := Server{
 		collector: &Collector{
@@ -230,6 +314,31 @@ func (s *applyActionSuite) TestShouldApplyAction(c *C) {
 	}
 }
 
+func (s *applyActionSuite) TestGetMergerStats(c *C) {
+	source := MergeSource{ID: "pump1", Source: make(chan MergeItem, 4)}
+	merger := NewMerger(0, heapStrategy, source)
+	defer merger.Close()
+	s.server.collector = &Collector{merger: merger}
+
+	req := httptest.NewRequest("GET", "/debug/merger", nil)
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	body, _ := io.ReadAll(resp.Body)
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+	var decoded struct {
+		Code int         `json:"code"`
+		Data MergerStats `json:"data"`
+	}
+	err := json.Unmarshal(body, &decoded)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Code, Equals, 200)
+	c.Assert(decoded.Data.Sources["pump1"].Capacity, Equals, 4)
+}
+
 type heartbeatSuite struct{}
 
 var _ = Suite(&heartbeatSuite{})
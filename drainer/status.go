@@ -14,10 +14,15 @@
 package drainer
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	"github.com/pingcap/tidb/store/tikv/oracle"
 	"go.uber.org/zap"
 )
 
@@ -27,6 +32,9 @@ type HTTPStatus struct {
 	Synced  bool             `json:"Synced"`
 	LastTS  int64            `json:"LastTS"`
 	TsMap   string           `json:"TsMap"`
+
+	// PumpStats are the stats reported by the pumps in their heartbeats.
+	PumpStats map[string]*node.PumpStats `json:"PumpStats,omitempty"`
 }
 
 // Status implements http.ServeHTTP interface
@@ -35,3 +43,95 @@ func (s *HTTPStatus) Status(w http.ResponseWriter, r *http.Request) {
 		log.Error("Failed to encode status", zap.Error(err), zap.Any("status", *s))
 	}
 }
+
+// StatusAPIVersion is the version of the status served by /api/v1/status.
+const StatusAPIVersion = "v1"
+
+// StatusV1 is the status of drainer served by /api/v1/status. The field names
+// are stable, new fields may be added but the existing ones are never renamed
+// or removed, see docs/drainer_status_v1.schema.json.
+type StatusV1 struct {
+	APIVersion string `json:"api-version"`
+	NodeID     string `json:"node-id"`
+	Addr       string `json:"addr"`
+	State      string `json:"state"`
+	// Synced is true if no binlog is received for synced-check-time minutes.
+	Synced     bool               `json:"synced"`
+	Checkpoint CheckpointStatusV1 `json:"checkpoint"`
+	// Pumps are sorted by node id.
+	Pumps []PumpStatusV1 `json:"pumps"`
+	// Queues are the number of binlogs in the queues of drainer.
+	Queues map[string]int `json:"queues"`
+	// LastDDL is the last DDL synced to downstream, null if no DDL is synced.
+	LastDDL *DDLStatusV1 `json:"last-ddl"`
+	// ConfigHash is the sha256 of the config, it changes if the config changes.
+	ConfigHash string `json:"config-hash"`
+}
+
+// CheckpointStatusV1 is the checkpoint of drainer.
+type CheckpointStatusV1 struct {
+	TS            int64     `json:"ts"`
+	Time          time.Time `json:"time"`
+	SchemaVersion int64     `json:"schema-version"`
+	// LagSeconds is the seconds between now and the checkpoint.
+	LagSeconds float64 `json:"lag-seconds"`
+}
+
+// PumpStatusV1 is the position drainer pulls binlogs from a pump.
+type PumpStatusV1 struct {
+	NodeID string    `json:"node-id"`
+	PullTS int64     `json:"pull-ts"`
+	Time   time.Time `json:"time"`
+	// LagSeconds is the seconds between now and the pull position.
+	LagSeconds float64 `json:"lag-seconds"`
+	// Pending is the number of binlogs pulled but not merged yet.
+	Pending int `json:"pending"`
+	// Stats is the stats reported by the pump, null if not reported.
+	Stats *PumpStatsV1 `json:"stats"`
+}
+
+// PumpStatsV1 is the stats reported by a pump in its heartbeat.
+type PumpStatsV1 struct {
+	WriteBytesPerSecond    float64 `json:"write-bytes-per-second"`
+	FsyncLatencyP99Seconds float64 `json:"fsync-latency-p99-seconds"`
+	DiskFreeBytes          uint64  `json:"disk-free-bytes"`
+}
+
+// DDLStatusV1 is a DDL synced to downstream.
+type DDLStatusV1 struct {
+	CommitTS      int64  `json:"commit-ts"`
+	JobID         int64  `json:"job-id"`
+	SchemaVersion int64  `json:"schema-version"`
+	Schema        string `json:"schema"`
+	Table         string `json:"table"`
+	Query         string `json:"query"`
+	// Skipped is true if the DDL isn't executed in downstream but only used
+	// to refresh the table info of downstream.
+	Skipped  bool      `json:"skipped"`
+	SyncedAt time.Time `json:"synced-at"`
+}
+
+func lagSeconds(ts int64, now time.Time) float64 {
+	if ts <= 0 {
+		return 0
+	}
+	return now.Sub(oracle.GetTimeFromTS(uint64(ts))).Seconds()
+}
+
+func tsTime(ts int64) time.Time {
+	if ts <= 0 {
+		return time.Time{}
+	}
+	return oracle.GetTimeFromTS(uint64(ts))
+}
+
+// configHash returns the sha256 of the config in JSON.
+func configHash(cfg *Config) string {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		log.Warn("Failed to encode config", zap.Error(err))
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -82,7 +82,7 @@ func BenchmarkKafka(b *testing.B) {
 
 	item := &Item{Binlog: &ti.Binlog{}}
 
-	syncer, err := NewKafka(cfg, nil)
+	syncer, err := NewKafka(cfg, nil, nil)
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -96,7 +96,7 @@ func BenchmarkKafka(b *testing.B) {
 	}()
 
 	for i := 0; i < b.N; i++ {
-		err = syncer.saveBinlog(binlog, item)
+		err = syncer.saveBinlogs([]partitionBinlog{{binlog: binlog}}, item, nil)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -0,0 +1,122 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultHeartbeatSchema   = "tidb_binlog"
+	defaultHeartbeatTable    = "heartbeat"
+	defaultHeartbeatInterval = 1
+)
+
+// HeartbeatConfig is the configuration of the heartbeat row written to downstream periodically,
+// the lag can be measured from downstream by the checkpoint in the row.
+type HeartbeatConfig struct {
+	Enable bool   `toml:"enable" json:"enable"`
+	Schema string `toml:"schema" json:"schema"`
+	Table  string `toml:"table" json:"table"`
+	// Interval is the interval in seconds of writing the heartbeat row.
+	Interval int `toml:"interval" json:"interval"`
+}
+
+func (c *HeartbeatConfig) adjust() {
+	if len(c.Schema) == 0 {
+		c.Schema = defaultHeartbeatSchema
+	}
+	if len(c.Table) == 0 {
+		c.Table = defaultHeartbeatTable
+	}
+	if c.Interval <= 0 {
+		c.Interval = defaultHeartbeatInterval
+	}
+}
+
+// heartbeat writes the latest checkpoint saved into the row of the cluster, the checkpoint
+// is only saved after all the binlogs before it are synced, so
+// `update_time - checkpoint_time` is the lag of the downstream.
+type heartbeat struct {
+	db        *sql.DB
+	clusterID uint64
+	table     string
+	interval  time.Duration
+
+	checkpointTS int64
+}
+
+func newHeartbeat(db *sql.DB, cfg HeartbeatConfig, clusterID uint64) (*heartbeat, error) {
+	cfg.adjust()
+	h := &heartbeat{
+		db:        db,
+		clusterID: clusterID,
+		table:     fmt.Sprintf("`%s`.`%s`", cfg.Schema, cfg.Table),
+		interval:  time.Duration(cfg.Interval) * time.Second,
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", cfg.Schema)); err != nil {
+		return nil, errors.Annotate(err, "create heartbeat schema")
+	}
+	createTable := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	cluster_id BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+	checkpoint_ts BIGINT NOT NULL,
+	checkpoint_time DATETIME(3) NOT NULL,
+	update_time DATETIME(3) NOT NULL)`, h.table)
+	if _, err := db.Exec(createTable); err != nil {
+		return nil, errors.Annotate(err, "create heartbeat table")
+	}
+	return h, nil
+}
+
+func (h *heartbeat) setCheckpoint(ts int64) {
+	atomic.StoreInt64(&h.checkpointTS, ts)
+}
+
+// write writes the heartbeat row, the times are in the time zone of downstream.
+func (h *heartbeat) write() error {
+	ts := atomic.LoadInt64(&h.checkpointTS)
+	if ts == 0 {
+		return nil
+	}
+	physical := float64(oracle.ExtractPhysical(uint64(ts))) / 1000
+	query := fmt.Sprintf("REPLACE INTO %s(cluster_id, checkpoint_ts, checkpoint_time, update_time) VALUES(?, ?, FROM_UNIXTIME(?), NOW(3))", h.table)
+	_, err := h.db.Exec(query, h.clusterID, ts, physical)
+	return errors.Trace(err)
+}
+
+func (h *heartbeat) run(quit <-chan struct{}) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			// the failure of heartbeat doesn't stop the sync, the lag measured just grows.
+			if err := h.write(); err != nil {
+				log.Warn("write heartbeat failed", zap.String("table", h.table), zap.Error(err))
+			}
+		}
+	}
+}
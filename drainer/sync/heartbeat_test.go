@@ -0,0 +1,50 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+var _ = check.Suite(&heartbeatSuite{})
+
+type heartbeatSuite struct{}
+
+func (s *heartbeatSuite) TestHeartbeat(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE DATABASE IF NOT EXISTS `monitor`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS `monitor`.`heartbeat`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	h, err := newHeartbeat(db, HeartbeatConfig{Enable: true, Schema: "monitor"}, 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(h.interval, check.Equals, time.Second)
+
+	// nothing is written before the first checkpoint.
+	c.Assert(h.write(), check.IsNil)
+
+	ts := int64(oracle.ComposeTS(1600000000123, 1))
+	syncer := &MysqlSyncer{heartbeat: h}
+	syncer.OnCheckpointSaved(ts)
+	mock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `monitor`.`heartbeat`(cluster_id, checkpoint_ts, checkpoint_time, update_time) VALUES(?, ?, FROM_UNIXTIME(?), NOW(3))")).
+		WithArgs(1, ts, 1600000000.123).WillReturnResult(sqlmock.NewResult(0, 1))
+	c.Assert(h.write(), check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
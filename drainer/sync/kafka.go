@@ -23,6 +23,7 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
 	"go.uber.org/zap"
@@ -47,15 +48,59 @@ type KafkaSyncer struct {
 
 	lastSuccessTime time.Time
 
+	jsonUpdateRules []jsonUpdateRule
+
+	// the rules of partitioner are set to produce the rows to the partitions by their keys,
+	// all binlogs are produced to partition 0 if no rule is set.
+	partitioner binlogPartitioner
+	// toBeAckMsgs is the count of the messages of a binlog not acked yet.
+	toBeAckMsgs map[int64]int
+	// schemaRegistry keeps the schema ids of the tables in the message headers, nil if it's disabled.
+	schemaRegistry *schemaRegistry
+	// schemaSnapshots produces the schema snapshots of the tables, nil if it's disabled.
+	schemaSnapshots *schemaSnapshots
+	// nodeID is the node id of drainer kept in the message headers.
+	nodeID string
+
 	shutdown chan struct{}
 	*baseSyncer
 }
 
+type jsonUpdateRule struct {
+	filter *filter.Filter
+	format string
+}
+
+func newJSONUpdateRules(rules []JSONUpdateRule) ([]jsonUpdateRule, error) {
+	res := make([]jsonUpdateRule, 0, len(rules))
+	for _, rule := range rules {
+		tables, err := filter.NewFilter(nil, nil, nil, []filter.TableName{{Schema: rule.Schema, Table: rule.Table}})
+		if err != nil {
+			return nil, errors.Annotate(err, "invalid json-update rule")
+		}
+		res = append(res, jsonUpdateRule{
+			filter: tables,
+			format: rule.Format,
+		})
+	}
+	return res, nil
+}
+
+// jsonUpdateFormat returns the format of the first rule matching the table
+func (p *KafkaSyncer) jsonUpdateFormat(schema, table string) string {
+	for _, rule := range p.jsonUpdateRules {
+		if !rule.filter.SkipSchemaAndTable(schema, table) {
+			return rule.format
+		}
+	}
+	return translator.JSONUpdateFull
+}
+
 // newAsyncProducer will only be changed in unit test for mock
 var newAsyncProducer = sarama.NewAsyncProducer
 
 // NewKafka returns a instance of KafkaSyncer
-func NewKafka(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter) (*KafkaSyncer, error) {
+func NewKafka(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter, columnFilter *filter.ColumnFilter) (*KafkaSyncer, error) {
 	var topic string
 	if len(cfg.TopicName) == 0 {
 		clusterIDStr := strconv.FormatUint(cfg.ClusterID, 10)
@@ -68,8 +113,28 @@ func NewKafka(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter) (*Kafka
 		addr:            strings.Split(cfg.KafkaAddrs, ","),
 		topic:           topic,
 		toBeAckCommitTS: make(map[int64]int),
+		toBeAckMsgs:     make(map[int64]int),
+		nodeID:          cfg.NodeID,
 		shutdown:        make(chan struct{}),
-		baseSyncer:      newBaseSyncer(tableInfoGetter),
+		baseSyncer:      newBaseSyncer(tableInfoGetter, columnFilter),
+	}
+	var err error
+	if executor.jsonUpdateRules, err = newJSONUpdateRules(cfg.JSONUpdateRules); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if executor.partitioner.rules, err = newPartitionKeyRules(cfg.PartitionKeyRules); err != nil {
+		return nil, errors.Trace(err)
+	}
+	executor.partitioner.watermarks = true
+	executor.charsets = cfg.Charsets
+	if executor.generatedColumnRules, err = newGeneratedColumnRules(cfg.GeneratedColumnRules); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if cfg.SchemaRegistry.enabled() {
+		executor.schemaRegistry = newSchemaRegistry(&cfg.SchemaRegistry, topic)
+	}
+	if cfg.SchemaSnapshot {
+		executor.schemaSnapshots = newSchemaSnapshots()
 	}
 
 	config, err := util.NewSaramaConfig(cfg.KafkaVersion, "kafka.")
@@ -104,7 +169,20 @@ func NewKafka(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter) (*Kafka
 	config.Producer.Retry.Max = 10000
 	config.Producer.Retry.Backoff = 500 * time.Millisecond
 
-	executor.producer, err = newAsyncProducer(executor.addr, config)
+	if len(executor.partitioner.rules) > 0 {
+		// the partitions added later are not used until drainer restarts, then the rows
+		// of a key may be produced to another partition, so add them with drainer stopped.
+		executor.partitioner.count, err = getPartitionCount(executor.addr, config, topic)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if executor.partitioner.count <= 0 {
+			return nil, errors.Errorf("no partition of topic %s", topic)
+		}
+		log.Info("produce the rows to the partitions by their keys", zap.String("topic", topic), zap.Int32("partitions", executor.partitioner.count))
+	}
+
+	executor.producer, err = newKafkaProducer(executor.addr, config, cfg, topic)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -114,6 +192,26 @@ func NewKafka(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter) (*Kafka
 	return executor, nil
 }
 
+// newKafkaProducer returns the transactional producer if kafka-transaction is enabled and the brokers
+// support it, or the idempotent producer if the brokers are too old, otherwise the async producer.
+func newKafkaProducer(addrs []string, config *sarama.Config, cfg *DBConfig, topic string) (sarama.AsyncProducer, error) {
+	if !cfg.KafkaTransaction {
+		return newAsyncProducer(addrs, config)
+	}
+
+	producer, err := newKafkaTxnProducer(addrs, config, cfg.NodeID, topic)
+	if err == nil {
+		return producer, nil
+	}
+	if !isKafkaTxnUnsupportedErr(err) {
+		return nil, errors.Trace(err)
+	}
+	log.Warn("kafka transaction isn't supported, fall back to the idempotent producer", zap.Error(err))
+	config.Producer.Idempotent = true
+	config.Net.MaxOpenRequests = 1
+	return newAsyncProducer(addrs, config)
+}
+
 // SetSafeMode should be ignore by KafkaSyncer
 func (p *KafkaSyncer) SetSafeMode(mode bool) bool {
 	return false
@@ -121,12 +219,59 @@ func (p *KafkaSyncer) SetSafeMode(mode bool) bool {
 
 // Sync implements Syncer interface
 func (p *KafkaSyncer) Sync(item *Item) error {
-	secondaryBinlog, err := translator.TiBinlogToSecondaryBinlog(p.tableInfoGetter, item.Schema, item.Table, item.Binlog, item.PrewriteValue)
+	ctx := p.translatorContext(item)
+	ctx.ColumnCharsets = make(map[string]map[string]string)
+	secondaryBinlog, err := translator.TiBinlogToSecondaryBinlog(ctx)
 	if err != nil {
 		return errors.Trace(err)
 	}
 
-	err = p.saveBinlog(secondaryBinlog, item)
+	// the snapshots of the tables are taken before the columns are filtered.
+	var before, after []*obinlog.Binlog
+	if p.schemaSnapshots != nil {
+		if secondaryBinlog.GetType() == obinlog.BinlogType_DML {
+			before = p.schemaSnapshots.beforeDML(secondaryBinlog)
+		} else if snapshot := p.schemaSnapshots.afterDDL(ctx, item); snapshot != nil {
+			after = append(after, snapshot)
+		}
+	}
+
+	binlogs := []partitionBinlog{{partition: 0, binlog: secondaryBinlog}}
+	if len(p.partitioner.rules) > 0 {
+		// split before filtering the columns, the key columns may be filtered out.
+		binlogs, err = p.partitioner.splitByPartition(secondaryBinlog)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if len(before) > 0 || len(after) > 0 {
+		partitions := int32(1)
+		if len(p.partitioner.rules) > 0 {
+			partitions = p.partitioner.count
+		}
+		binlogs = append(p.schemaSnapshots.snapshotBinlogs(before, partitions), binlogs...)
+		binlogs = append(binlogs, p.schemaSnapshots.snapshotBinlogs(after, partitions)...)
+	}
+
+	for i, b := range binlogs {
+		if b.snapshot {
+			binlogs[i].key = snapshotKey(b.binlog)
+		} else {
+			// the key is of the primary keys, which may be filtered out.
+			binlogs[i].key = messageKey(b.binlog)
+		}
+
+		if p.columnFilter != nil {
+			translator.FilterSecondaryBinlogColumns(b.binlog, p.columnFilter)
+		}
+
+		if len(p.jsonUpdateRules) > 0 {
+			translator.ToJSONPartialUpdate(b.binlog, p.jsonUpdateFormat)
+		}
+	}
+
+	err = p.saveBinlogs(binlogs, item, ctx.ColumnCharsets)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -143,15 +288,41 @@ func (p *KafkaSyncer) Close() error {
 	return err
 }
 
-func (p *KafkaSyncer) saveBinlog(binlog *obinlog.Binlog, item *Item) error {
-	// log.Debug("save binlog: ", binlog.String())
-	data, err := binlog.Marshal()
-	if err != nil {
-		return errors.Trace(err)
+// saveBinlogs produces the parts of a binlog, the item is successful after all of them are acked.
+// columnCharsets are the charsets of the columns of the tables in the binlogs.
+func (p *KafkaSyncer) saveBinlogs(binlogs []partitionBinlog, item *Item, columnCharsets map[string]map[string]string) error {
+	msgs := make([]*sarama.ProducerMessage, 0, len(binlogs))
+	size := 0
+	for _, b := range binlogs {
+		data, err := b.binlog.Marshal()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		msg := &sarama.ProducerMessage{Topic: p.topic, Value: sarama.ByteEncoder(data), Partition: b.partition}
+		if len(b.key) > 0 {
+			msg.Key = sarama.ByteEncoder(b.key)
+		}
+		msg.Metadata = item
+		msg.Headers = messageHeaders(item.Binlog.GetCommitTs(), item.SchemaVersion, p.nodeID)
+		if b.snapshot {
+			msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(schemaSnapshotHeader), Value: []byte("true")})
+		}
+		charsetHeaders, err := columnCharsetsHeaders(b.binlog, columnCharsets)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		msg.Headers = append(msg.Headers, charsetHeaders...)
+		if p.schemaRegistry != nil {
+			headers, err := p.schemaRegistry.headers(b.binlog)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			msg.Headers = append(msg.Headers, headers...)
+		}
+		msgs = append(msgs, msg)
+		size += len(data)
 	}
-
-	msg := &sarama.ProducerMessage{Topic: p.topic, Key: nil, Value: sarama.ByteEncoder(data), Partition: 0}
-	msg.Metadata = item
+	commitTs := item.Binlog.GetCommitTs()
 
 	waitResume := false
 
@@ -159,8 +330,9 @@ func (p *KafkaSyncer) saveBinlog(binlog *obinlog.Binlog, item *Item) error {
 	if len(p.toBeAckCommitTS) == 0 {
 		p.lastSuccessTime = time.Now()
 	}
-	p.toBeAckCommitTS[binlog.CommitTs] = len(data)
-	p.toBeAckTotalSize += len(data)
+	p.toBeAckCommitTS[commitTs] = size
+	p.toBeAckMsgs[commitTs] = len(msgs)
+	p.toBeAckTotalSize += size
 	if p.toBeAckTotalSize >= stallWriteSize && len(p.toBeAckCommitTS) > 1 {
 		p.resumeProduce = make(chan struct{})
 		p.resumeProduceCloseOnce = sync.Once{}
@@ -176,12 +348,23 @@ func (p *KafkaSyncer) saveBinlog(binlog *obinlog.Binlog, item *Item) error {
 		}
 	}
 
-	select {
-	case p.producer.Input() <- msg:
+	if txnProducer, ok := p.producer.(*kafkaTxnProducer); ok {
+		select {
+		case txnProducer.TxnInput() <- msgs:
+		case <-p.errCh:
+			return errors.Trace(p.err)
+		}
 		return nil
-	case <-p.errCh:
-		return errors.Trace(p.err)
 	}
+
+	for _, msg := range msgs {
+		select {
+		case p.producer.Input() <- msg:
+		case <-p.errCh:
+			return errors.Trace(p.err)
+		}
+	}
+	return nil
 }
 
 func (p *KafkaSyncer) run() {
@@ -199,6 +382,12 @@ func (p *KafkaSyncer) run() {
 
 			p.toBeAckCommitTSMu.Lock()
 			p.lastSuccessTime = time.Now()
+			p.toBeAckMsgs[commitTs]--
+			if p.toBeAckMsgs[commitTs] > 0 {
+				p.toBeAckCommitTSMu.Unlock()
+				continue
+			}
+			delete(p.toBeAckMsgs, commitTs)
 			size := p.toBeAckCommitTS[commitTs]
 			p.toBeAckTotalSize -= size
 			if p.toBeAckTotalSize < stallWriteSize && p.resumeProduce != nil {
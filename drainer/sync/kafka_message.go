@@ -0,0 +1,129 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/pingcap/errors"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+)
+
+// The headers of the messages, so the consumers can dedup the messages without decoding them.
+const (
+	// commitTSHeader is the commit ts of the binlog in the message.
+	commitTSHeader = "commit-ts"
+	// schemaVersionHeader is the schema version the binlog in the message is translated by.
+	schemaVersionHeader = "schema-version"
+	// nodeIDHeader is the node id of the drainer producing the message.
+	nodeIDHeader = "node-id"
+	// columnCharsetsHeader is the charsets of the string, enum and set columns of the tables in the message,
+	// a JSON object like {"<schema>.<table>": {"<column>": "<charset>"}}.
+	columnCharsetsHeader = "column-charsets"
+)
+
+// messageHeaders returns the headers of the message of a binlog committed at commitTS.
+func messageHeaders(commitTS int64, schemaVersion int64, nodeID string) []sarama.RecordHeader {
+	headers := []sarama.RecordHeader{
+		{Key: []byte(commitTSHeader), Value: []byte(strconv.FormatInt(commitTS, 10))},
+		{Key: []byte(schemaVersionHeader), Value: []byte(strconv.FormatInt(schemaVersion, 10))},
+	}
+	if len(nodeID) > 0 {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(nodeIDHeader), Value: []byte(nodeID)})
+	}
+	return headers
+}
+
+// columnCharsetsHeaders returns the header of the charsets of the columns of the binlog in the message,
+// charsets are of all the tables translated by "<schema>.<table>" and the column names. No header is
+// returned if none of the columns has a charset, like the DDLs.
+func columnCharsetsHeaders(binlog *obinlog.Binlog, charsets map[string]map[string]string) ([]sarama.RecordHeader, error) {
+	tableCharsets := make(map[string]map[string]string)
+	for _, table := range binlog.GetDmlData().GetTables() {
+		name := table.GetSchemaName() + "." + table.GetTableName()
+		for _, info := range table.GetColumnInfo() {
+			charset, ok := charsets[name][info.GetName()]
+			if !ok {
+				continue
+			}
+			if tableCharsets[name] == nil {
+				tableCharsets[name] = make(map[string]string)
+			}
+			tableCharsets[name][info.GetName()] = charset
+		}
+	}
+	if len(tableCharsets) == 0 {
+		return nil, nil
+	}
+	value, err := json.Marshal(tableCharsets)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return []sarama.RecordHeader{{Key: []byte(columnCharsetsHeader), Value: value}}, nil
+}
+
+// messageKey returns the key of the message of the binlog, "<schema>.<table>:<hash>" where hash is the
+// hex of the FNV-1a hash of the primary keys of the rows in the message, in the order of the rows. The
+// key of an updated row is the key of its new value, and all the columns are hashed for the tables
+// without primary key. The names of the tables are joined by "," if the message has several tables.
+// So the messages of the same rows have the same key and kafka keeps the last one by log compaction.
+// The key of a DDL is "<schema>.<table>" without hash, or "<schema>" if it's not on a table.
+func messageKey(binlog *obinlog.Binlog) []byte {
+	if binlog.GetType() != obinlog.BinlogType_DML {
+		ddl := binlog.GetDdlData()
+		if len(ddl.GetTableName()) == 0 {
+			return []byte(ddl.GetSchemaName())
+		}
+		return []byte(ddl.GetSchemaName() + "." + ddl.GetTableName())
+	}
+
+	tables := binlog.GetDmlData().GetTables()
+	if len(tables) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(tables))
+	h := fnv.New64a()
+	for _, table := range tables {
+		names = append(names, table.GetSchemaName()+"."+table.GetTableName())
+
+		var keyIdxs []int
+		for i, info := range table.GetColumnInfo() {
+			if info.GetIsPrimaryKey() {
+				keyIdxs = append(keyIdxs, i)
+			}
+		}
+		for _, mut := range table.GetMutations() {
+			cols := mut.GetRow().GetColumns()
+			if len(keyIdxs) == 0 {
+				for _, col := range cols {
+					data, _ := col.Marshal()
+					h.Write(data)
+				}
+				continue
+			}
+			for _, idx := range keyIdxs {
+				if idx >= len(cols) {
+					continue
+				}
+				data, _ := cols[idx].Marshal()
+				h.Write(data)
+			}
+		}
+	}
+	return []byte(strings.Join(names, ",") + ":" + strconv.FormatUint(h.Sum64(), 16))
+}
@@ -0,0 +1,202 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+)
+
+type partitionKeyRule struct {
+	filter  *filter.Filter
+	columns []string
+}
+
+func newPartitionKeyRules(rules []PartitionKeyRule) ([]partitionKeyRule, error) {
+	res := make([]partitionKeyRule, 0, len(rules))
+	for _, rule := range rules {
+		tables, err := filter.NewFilter(nil, nil, nil, []filter.TableName{{Schema: rule.Schema, Table: rule.Table}})
+		if err != nil {
+			return nil, errors.Annotate(err, "invalid partition-key rule")
+		}
+		res = append(res, partitionKeyRule{
+			filter:  tables,
+			columns: rule.Columns,
+		})
+	}
+	return res, nil
+}
+
+// getPartitionCount will only be changed in unit test for mock
+var getPartitionCount = func(addrs []string, config *sarama.Config, topic string) (int32, error) {
+	client, err := sarama.NewClient(addrs, config)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer client.Close()
+
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return 0, errors.Annotatef(err, "get partitions of topic %s", topic)
+	}
+	return int32(len(partitions)), nil
+}
+
+// binlogPartitioner splits the rows of the binlogs into count partitions by the hash of their keys.
+type binlogPartitioner struct {
+	rules []partitionKeyRule
+	count int32
+	// watermarks produces a binlog without rows to the partitions without rows of a DML binlog,
+	// so every partition has a part of every binlog and the consumers merging the partitions,
+	// like arbiter, know a partition has nothing more before the commit ts.
+	watermarks bool
+}
+
+// partitionBinlog is the part of a binlog produced to a partition.
+type partitionBinlog struct {
+	partition int32
+	binlog    *obinlog.Binlog
+	// key is the key of the message, see messageKey.
+	key []byte
+	// snapshot is true if the binlog is a schema snapshot, see schemaSnapshots.
+	snapshot bool
+}
+
+// partitionKeyColumns returns the columns of the first rule matching the table, nil if no rule matches.
+func (p *binlogPartitioner) partitionKeyColumns(schema, table string) []string {
+	for _, rule := range p.rules {
+		if !rule.filter.SkipSchemaAndTable(schema, table) {
+			return rule.columns
+		}
+	}
+	return nil
+}
+
+// splitByPartition splits the rows of the binlog into the partitions by the hash of their keys, so the
+// rows of the same key are produced to one partition in the order of commit ts. The key is the columns
+// of the first partition-key-rule matching the table, or the primary key if no rule matches, the rows of
+// the tables without primary key are produced to partition 0. The key of an updated row is the key of
+// its new value. The DDLs are produced to all partitions since the rows after them may be in any one.
+func (p *binlogPartitioner) splitByPartition(binlog *obinlog.Binlog) ([]partitionBinlog, error) {
+	if binlog.GetType() != obinlog.BinlogType_DML {
+		res := make([]partitionBinlog, 0, p.count)
+		for i := int32(0); i < p.count; i++ {
+			res = append(res, partitionBinlog{partition: i, binlog: binlog})
+		}
+		return res, nil
+	}
+
+	parts := make(map[int32]*obinlog.Binlog)
+	for _, table := range binlog.GetDmlData().GetTables() {
+		keyIdxs, err := p.partitionKeyIndexes(table)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		tables := make(map[int32]*obinlog.Table)
+		for _, mut := range table.GetMutations() {
+			partition := int32(0)
+			if len(keyIdxs) > 0 {
+				partition = p.partitionOf(mut.GetRow(), keyIdxs)
+			}
+			t, ok := tables[partition]
+			if !ok {
+				// the column infos and keys are copied since they may be modified in place by the column filter.
+				t = &obinlog.Table{
+					SchemaName: table.SchemaName,
+					TableName:  table.TableName,
+					ColumnInfo: append([]*obinlog.ColumnInfo(nil), table.ColumnInfo...),
+					UniqueKeys: append([]*obinlog.Key(nil), table.UniqueKeys...),
+				}
+				tables[partition] = t
+
+				part, ok := parts[partition]
+				if !ok {
+					part = &obinlog.Binlog{Type: binlog.Type, CommitTs: binlog.CommitTs, DmlData: &obinlog.DMLData{}}
+					parts[partition] = part
+				}
+				part.DmlData.Tables = append(part.DmlData.Tables, t)
+			}
+			t.Mutations = append(t.Mutations, mut)
+		}
+	}
+
+	// the binlog without rows is still produced to be acked.
+	if len(parts) == 0 {
+		parts[0] = binlog
+	}
+	if p.watermarks {
+		for i := int32(0); i < p.count; i++ {
+			if _, ok := parts[i]; !ok {
+				parts[i] = &obinlog.Binlog{Type: binlog.Type, CommitTs: binlog.CommitTs, DmlData: &obinlog.DMLData{}}
+			}
+		}
+	}
+	res := make([]partitionBinlog, 0, len(parts))
+	for partition, part := range parts {
+		res = append(res, partitionBinlog{partition: partition, binlog: part})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].partition < res[j].partition })
+	return res, nil
+}
+
+// partitionKeyIndexes returns the indexes of the key columns of the table in the rows.
+func (p *binlogPartitioner) partitionKeyIndexes(table *obinlog.Table) ([]int, error) {
+	infos := table.GetColumnInfo()
+	columns := p.partitionKeyColumns(table.GetSchemaName(), table.GetTableName())
+	if len(columns) == 0 {
+		var idxs []int
+		for i, info := range infos {
+			if info.GetIsPrimaryKey() {
+				idxs = append(idxs, i)
+			}
+		}
+		return idxs, nil
+	}
+
+	idxs := make([]int, 0, len(columns))
+	for _, column := range columns {
+		idx := -1
+		for i, info := range infos {
+			if strings.EqualFold(info.GetName(), column) {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, errors.Errorf("partition key column %s doesn't exist in table %s.%s", column, table.GetSchemaName(), table.GetTableName())
+		}
+		idxs = append(idxs, idx)
+	}
+	return idxs, nil
+}
+
+func (p *binlogPartitioner) partitionOf(row *obinlog.Row, keyIdxs []int) int32 {
+	h := fnv.New32a()
+	cols := row.GetColumns()
+	for _, idx := range keyIdxs {
+		if idx >= len(cols) {
+			continue
+		}
+		data, _ := cols[idx].Marshal()
+		h.Write(data)
+	}
+	return int32(h.Sum32() % uint32(p.count))
+}
@@ -0,0 +1,210 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/pingcap/check"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+	pb "github.com/pingcap/tipb/go-binlog"
+)
+
+type partitionKeyRuleSuite struct{}
+
+var _ = check.Suite(&partitionKeyRuleSuite{})
+
+func (s *partitionKeyRuleSuite) newSyncer(partitionCount int32) *KafkaSyncer {
+	rules, err := newPartitionKeyRules([]PartitionKeyRule{{Schema: "shop", Table: "~^orders.*", Columns: []string{"Customer_ID"}}})
+	if err != nil {
+		panic(err)
+	}
+	return &KafkaSyncer{
+		topic:           "test",
+		toBeAckCommitTS: make(map[int64]int),
+		toBeAckMsgs:     make(map[int64]int),
+		partitioner: binlogPartitioner{
+			rules:      rules,
+			count:      partitionCount,
+			watermarks: true,
+		},
+		shutdown:   make(chan struct{}),
+		baseSyncer: newBaseSyncer(nil, nil),
+	}
+}
+
+func int64Col(v int64) *obinlog.Column {
+	return &obinlog.Column{Int64Value: &v}
+}
+
+// ordersTable returns the table with the rows of (id, customer_id).
+func ordersTable(table string, rows ...[2]int64) *obinlog.Table {
+	schema := "shop"
+	t := &obinlog.Table{
+		SchemaName: &schema,
+		TableName:  &table,
+		ColumnInfo: []*obinlog.ColumnInfo{{Name: "id", MysqlType: "int", IsPrimaryKey: true}, {Name: "customer_id", MysqlType: "int"}},
+	}
+	for _, row := range rows {
+		t.Mutations = append(t.Mutations, &obinlog.TableMutation{
+			Type: obinlog.MutationType_Insert.Enum(),
+			Row:  &obinlog.Row{Columns: []*obinlog.Column{int64Col(row[0]), int64Col(row[1])}},
+		})
+	}
+	return t
+}
+
+func (s *partitionKeyRuleSuite) TestSplitByPartition(c *check.C) {
+	syncer := s.newSyncer(4)
+	customerPartition := func(customerID int64) int32 {
+		return syncer.partitioner.partitionOf(&obinlog.Row{Columns: []*obinlog.Column{int64Col(customerID)}}, []int{0})
+	}
+
+	binlog := &obinlog.Binlog{
+		Type:     obinlog.BinlogType_DML,
+		CommitTs: 10,
+		DmlData: &obinlog.DMLData{Tables: []*obinlog.Table{
+			ordersTable("orders", [2]int64{1, 100}, [2]int64{2, 200}, [2]int64{3, 100}),
+		}},
+	}
+	parts, err := syncer.partitioner.splitByPartition(binlog)
+	c.Assert(err, check.IsNil)
+
+	// every partition has a part, the ones without rows are the watermarks.
+	c.Assert(parts, check.HasLen, 4)
+	rows := 0
+	for i, part := range parts {
+		c.Assert(part.partition, check.Equals, int32(i))
+		c.Assert(part.binlog.CommitTs, check.Equals, int64(10))
+		tables := part.binlog.GetDmlData().GetTables()
+		if part.partition != customerPartition(100) && part.partition != customerPartition(200) {
+			c.Assert(tables, check.HasLen, 0)
+			continue
+		}
+		c.Assert(tables, check.HasLen, 1)
+		for _, mut := range tables[0].Mutations {
+			// the rows of a customer are in one partition in order.
+			c.Assert(part.partition, check.Equals, customerPartition(*mut.Row.Columns[1].Int64Value))
+			rows++
+		}
+	}
+	c.Assert(rows, check.Equals, 3)
+
+	// the key column must exist.
+	binlog.DmlData.Tables[0].ColumnInfo[1].Name = "user_id"
+	_, err = syncer.partitioner.splitByPartition(binlog)
+	c.Assert(err, check.ErrorMatches, "partition key column Customer_ID doesn't exist in table shop.orders")
+
+	// the tables not matched are partitioned by primary key.
+	binlog.DmlData.Tables[0].TableName = new(string)
+	*binlog.DmlData.Tables[0].TableName = "users"
+	parts, err = syncer.partitioner.splitByPartition(binlog)
+	c.Assert(err, check.IsNil)
+	c.Assert(parts, check.HasLen, 4)
+
+	// the binlog without rows is produced to partition 0, and the watermarks to the others.
+	parts, err = syncer.partitioner.splitByPartition(&obinlog.Binlog{Type: obinlog.BinlogType_DML, CommitTs: 12})
+	c.Assert(err, check.IsNil)
+	c.Assert(parts, check.HasLen, 4)
+	c.Assert(parts[0].binlog.CommitTs, check.Equals, int64(12))
+	c.Assert(parts[3].binlog.GetDmlData().GetTables(), check.HasLen, 0)
+
+	// the DDLs are produced to all partitions.
+	parts, err = syncer.partitioner.splitByPartition(&obinlog.Binlog{Type: obinlog.BinlogType_DDL, CommitTs: 11})
+	c.Assert(err, check.IsNil)
+	c.Assert(parts, check.HasLen, 4)
+	c.Assert(parts[3].partition, check.Equals, int32(3))
+}
+
+func (s *partitionKeyRuleSuite) TestAckAfterAllPartitions(c *check.C) {
+	syncer := s.newSyncer(2)
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(c, config)
+	syncer.producer = producer
+	go syncer.run()
+
+	item := &Item{Binlog: &pb.Binlog{CommitTs: 12}}
+	for i := 0; i < 2; i++ {
+		producer.ExpectInputAndSucceed()
+	}
+	err := syncer.saveBinlogs([]partitionBinlog{
+		{partition: 0, binlog: &obinlog.Binlog{Type: obinlog.BinlogType_DDL, CommitTs: 12}},
+		{partition: 1, binlog: &obinlog.Binlog{Type: obinlog.BinlogType_DDL, CommitTs: 12}},
+	}, item, nil)
+	c.Assert(err, check.IsNil)
+
+	select {
+	case success := <-syncer.Successes():
+		c.Assert(success, check.Equals, item)
+	case <-time.After(5 * time.Second):
+		c.Fatal("binlog not acked")
+	}
+	c.Assert(syncer.Close(), check.IsNil)
+	// the item is successful only once.
+	_, ok := <-syncer.Successes()
+	c.Assert(ok, check.IsFalse)
+}
+
+func (s *partitionKeyRuleSuite) TestMessageKeyAndHeaders(c *check.C) {
+	dml := func(tables ...*obinlog.Table) *obinlog.Binlog {
+		return &obinlog.Binlog{Type: obinlog.BinlogType_DML, CommitTs: 12, DmlData: &obinlog.DMLData{Tables: tables}}
+	}
+
+	key := string(messageKey(dml(ordersTable("orders", [2]int64{1, 100}))))
+	c.Assert(key, check.Matches, `shop\.orders:[0-9a-f]+`)
+	// the key is of the primary key only.
+	c.Assert(string(messageKey(dml(ordersTable("orders", [2]int64{1, 200})))), check.Equals, key)
+	c.Assert(string(messageKey(dml(ordersTable("orders", [2]int64{2, 100})))), check.Not(check.Equals), key)
+	c.Assert(string(messageKey(dml(ordersTable("orders", [2]int64{1, 100}), ordersTable("orders_1", [2]int64{1, 100})))),
+		check.Matches, `shop\.orders,shop\.orders_1:[0-9a-f]+`)
+
+	// all the columns are hashed without primary key.
+	noPK := ordersTable("orders", [2]int64{1, 100})
+	noPK.ColumnInfo[0].IsPrimaryKey = false
+	key = string(messageKey(dml(noPK)))
+	noPK.Mutations[0].Row.Columns[1] = int64Col(200)
+	c.Assert(string(messageKey(dml(noPK))), check.Not(check.Equals), key)
+
+	schema, table := "shop", "orders"
+	ddl := &obinlog.Binlog{Type: obinlog.BinlogType_DDL, DdlData: &obinlog.DDLData{SchemaName: &schema, TableName: &table}}
+	c.Assert(string(messageKey(ddl)), check.Equals, "shop.orders")
+	ddl.DdlData.TableName = nil
+	c.Assert(string(messageKey(ddl)), check.Equals, "shop")
+
+	c.Assert(messageHeaders(12, 3, "drainer-1"), check.DeepEquals, []sarama.RecordHeader{
+		{Key: []byte("commit-ts"), Value: []byte("12")},
+		{Key: []byte("schema-version"), Value: []byte("3")},
+		{Key: []byte("node-id"), Value: []byte("drainer-1")},
+	})
+	c.Assert(messageHeaders(12, 3, ""), check.HasLen, 2)
+
+	// the charsets are of the columns in the message, the filtered columns are omitted.
+	orders := ordersTable("orders", [2]int64{1, 100})
+	orders.ColumnInfo = append(orders.ColumnInfo, &obinlog.ColumnInfo{Name: "name", MysqlType: "varchar"})
+	charsets := map[string]map[string]string{
+		"shop.orders":   {"name": "gbk", "note": "latin1"},
+		"shop.orders_1": {"name": "gbk"},
+	}
+	headers, err := columnCharsetsHeaders(dml(orders), charsets)
+	c.Assert(err, check.IsNil)
+	c.Assert(headers, check.DeepEquals, []sarama.RecordHeader{
+		{Key: []byte("column-charsets"), Value: []byte(`{"shop.orders":{"name":"gbk"}}`)},
+	})
+	headers, err = columnCharsetsHeaders(ddl, charsets)
+	c.Assert(err, check.IsNil)
+	c.Assert(headers, check.HasLen, 0)
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"strings"
+
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+)
+
+// schemaSnapshotHeader is the header of the messages of the schema snapshots, its value is "true".
+const schemaSnapshotHeader = "schema-snapshot"
+
+// schemaSnapshots produces the schema snapshots of the tables, a snapshot is a DML binlog of one table
+// with all its columns and unique keys but no mutations, so the consumers joining late learn the schema
+// of a table from the topic. The snapshot of a table is produced after each DDL of it, and before its
+// first DML after drainer starts, or after a DDL of its schema. It's only used by the goroutine syncing
+// the items, so it's not locked.
+type schemaSnapshots struct {
+	produced map[filter.TableName]struct{}
+}
+
+func newSchemaSnapshots() *schemaSnapshots {
+	return &schemaSnapshots{produced: make(map[filter.TableName]struct{})}
+}
+
+// beforeDML returns the snapshots of the tables in the DML binlog not produced yet.
+func (s *schemaSnapshots) beforeDML(binlog *obinlog.Binlog) []*obinlog.Binlog {
+	var snapshots []*obinlog.Binlog
+	for _, table := range binlog.GetDmlData().GetTables() {
+		name := filter.TableName{Schema: table.GetSchemaName(), Table: table.GetTableName()}
+		if _, ok := s.produced[name]; ok {
+			continue
+		}
+		s.produced[name] = struct{}{}
+		// the column infos and keys are copied since they may be modified in place by the column filter.
+		snapshot := &obinlog.Table{
+			SchemaName: table.SchemaName,
+			TableName:  table.TableName,
+			ColumnInfo: append([]*obinlog.ColumnInfo(nil), table.ColumnInfo...),
+			UniqueKeys: append([]*obinlog.Key(nil), table.UniqueKeys...),
+		}
+		snapshots = append(snapshots, schemaSnapshot(binlog.GetCommitTs(), snapshot))
+	}
+	return snapshots
+}
+
+// afterDDL returns the snapshot of the table changed by the DDL item, nil if the table is dropped or
+// the DDL isn't on a table, the snapshots of the tables of the schema are produced again then.
+func (s *schemaSnapshots) afterDDL(ctx *translator.Context, item *Item) *obinlog.Binlog {
+	s.forget(item.Schema, item.Table)
+	if len(item.Table) == 0 || ctx.InfoGetter == nil {
+		return nil
+	}
+	info, ok := ctx.InfoGetter.TableByID(item.TableID)
+	if !ok {
+		return nil
+	}
+	table := translator.TableSchema(ctx, item.Schema, info)
+	s.produced[filter.TableName{Schema: table.GetSchemaName(), Table: table.GetTableName()}] = struct{}{}
+	return schemaSnapshot(item.Binlog.GetCommitTs(), table)
+}
+
+// forget drops the produced snapshots of the table, or all the tables of the schema if table is empty.
+func (s *schemaSnapshots) forget(schema string, table string) {
+	for name := range s.produced {
+		if strings.EqualFold(name.Schema, schema) && (len(table) == 0 || strings.EqualFold(name.Table, table)) {
+			delete(s.produced, name)
+		}
+	}
+}
+
+// snapshotBinlogs returns the snapshots to produce to every partition, like the DDLs.
+func (s *schemaSnapshots) snapshotBinlogs(snapshots []*obinlog.Binlog, partitions int32) []partitionBinlog {
+	res := make([]partitionBinlog, 0, len(snapshots)*int(partitions))
+	for _, snapshot := range snapshots {
+		for i := int32(0); i < partitions; i++ {
+			res = append(res, partitionBinlog{partition: i, binlog: snapshot, snapshot: true})
+		}
+	}
+	return res
+}
+
+// snapshotKey returns the key of the message of the snapshot, "<schema>.<table>:schema", so kafka keeps the
+// last snapshot of a table by log compaction.
+func snapshotKey(snapshot *obinlog.Binlog) []byte {
+	table := snapshot.GetDmlData().GetTables()[0]
+	return []byte(table.GetSchemaName() + "." + table.GetTableName() + ":schema")
+}
+
+func schemaSnapshot(commitTS int64, table *obinlog.Table) *obinlog.Binlog {
+	return &obinlog.Binlog{
+		Type:     obinlog.BinlogType_DML,
+		CommitTs: commitTS,
+		DmlData:  &obinlog.DMLData{Tables: []*obinlog.Table{table}},
+	}
+}
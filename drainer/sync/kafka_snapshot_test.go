@@ -0,0 +1,77 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+	pb "github.com/pingcap/tipb/go-binlog"
+)
+
+type schemaSnapshotSuite struct{}
+
+var _ = check.Suite(&schemaSnapshotSuite{})
+
+func (s *schemaSnapshotSuite) TestSnapshots(c *check.C) {
+	gen := &translator.BinlogGenerator{}
+	gen.SetInsert(c)
+	tableID := gen.PV.Mutations[0].TableId
+	schema, table, ok := gen.SchemaAndTableName(tableID)
+	c.Assert(ok, check.IsTrue)
+
+	item := &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV}
+	dml, err := translator.TiBinlogToSecondaryBinlog(item.translatorContext(gen))
+	c.Assert(err, check.IsNil)
+
+	snapshots := newSchemaSnapshots()
+	before := snapshots.beforeDML(dml)
+	c.Assert(before, check.HasLen, 1)
+	c.Assert(before[0].GetType(), check.Equals, obinlog.BinlogType_DML)
+	c.Assert(before[0].GetCommitTs(), check.Equals, dml.GetCommitTs())
+	snapshot := before[0].GetDmlData().GetTables()[0]
+	c.Assert(snapshot.GetSchemaName(), check.Equals, schema)
+	c.Assert(snapshot.GetTableName(), check.Equals, table)
+	c.Assert(snapshot.GetColumnInfo(), check.DeepEquals, dml.GetDmlData().GetTables()[0].GetColumnInfo())
+	c.Assert(snapshot.GetMutations(), check.HasLen, 0)
+	c.Assert(string(snapshotKey(before[0])), check.Equals, schema+"."+table+":schema")
+	// the snapshot is produced once.
+	c.Assert(snapshots.beforeDML(dml), check.HasLen, 0)
+
+	// the snapshot is produced after a DDL of the table.
+	ddl := &Item{Binlog: &pb.Binlog{CommitTs: 300, DdlJobId: 2}, Schema: schema, Table: table, TableID: tableID}
+	after := snapshots.afterDDL(item.translatorContext(gen), ddl)
+	c.Assert(after, check.NotNil)
+	c.Assert(after.GetCommitTs(), check.Equals, int64(300))
+	c.Assert(after.GetDmlData().GetTables()[0].GetColumnInfo(), check.DeepEquals, snapshot.GetColumnInfo())
+	c.Assert(snapshots.beforeDML(dml), check.HasLen, 0)
+
+	// no snapshot of the dropped table, it's produced before the next DML of a table of the same name.
+	ddl.TableID = tableID + 1
+	c.Assert(snapshots.afterDDL(item.translatorContext(gen), ddl), check.IsNil)
+	c.Assert(snapshots.beforeDML(dml), check.HasLen, 1)
+
+	// the snapshots of the tables are produced again after a DDL of their schema.
+	ddl.Table = ""
+	c.Assert(snapshots.afterDDL(item.translatorContext(gen), ddl), check.IsNil)
+	c.Assert(snapshots.beforeDML(dml), check.HasLen, 1)
+
+	parts := snapshots.snapshotBinlogs(before, 3)
+	c.Assert(parts, check.HasLen, 3)
+	for i, part := range parts {
+		c.Assert(part.partition, check.Equals, int32(i))
+		c.Assert(part.binlog, check.Equals, before[0])
+		c.Assert(part.snapshot, check.IsTrue)
+	}
+}
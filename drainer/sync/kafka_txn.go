@@ -0,0 +1,394 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// kafkaTxnTimeout is the timeout of a kafka transaction, the coordinator aborts the
+	// transaction not committed in time, like the one of a crashed drainer.
+	kafkaTxnTimeout = time.Minute
+
+	kafkaTxnIDPrefix = "tidb_binlog_"
+
+	// apiKeyInitProducerID is the api key of InitProducerId, added with the transactions in kafka 0.11.
+	apiKeyInitProducerID = 22
+)
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// kafkaTxnProducer produces the messages of a binlog in one kafka transaction, so the consumers
+// reading with isolation.level=read_committed see all or none of them, and never see the ones
+// produced twice by the retries. The transactional id is derived from the node id of drainer,
+// so a restarted drainer fences the transactions left by the previous one.
+// A message sent to Input is produced in a transaction of its own.
+type kafkaTxnProducer struct {
+	client sarama.Client
+	config *sarama.Config
+	txnID  string
+
+	// coordinator is nil until the producer id is got from it.
+	coordinator   *sarama.Broker
+	producerID    int64
+	producerEpoch int16
+	// sequences are the sequence numbers of the next records of the partitions.
+	sequences map[topicPartition]int32
+
+	input     chan *sarama.ProducerMessage
+	txns      chan []*sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+	done      chan struct{}
+}
+
+var _ sarama.AsyncProducer = &kafkaTxnProducer{}
+
+// newKafkaClient will only be changed in unit test for mock
+var newKafkaClient = sarama.NewClient
+
+func newKafkaTxnProducer(addrs []string, config *sarama.Config, nodeID string, topic string) (*kafkaTxnProducer, error) {
+	client, err := newKafkaClient(addrs, config)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	p := &kafkaTxnProducer{
+		client:    client,
+		config:    config,
+		txnID:     kafkaTxnIDPrefix + nodeID,
+		input:     make(chan *sarama.ProducerMessage),
+		txns:      make(chan []*sarama.ProducerMessage),
+		successes: make(chan *sarama.ProducerMessage),
+		errors:    make(chan *sarama.ProducerError),
+		done:      make(chan struct{}),
+	}
+	if err = client.RefreshMetadata(topic); err == nil {
+		err = p.initProducerID()
+	}
+	if err != nil {
+		client.Close()
+		return nil, errors.Trace(err)
+	}
+	log.Info("init kafka transactional producer", zap.String("transactional id", p.txnID),
+		zap.Int64("producer id", p.producerID), zap.Int16("epoch", p.producerEpoch))
+
+	go p.splitInput()
+	go p.run()
+	return p, nil
+}
+
+// Input implements sarama.AsyncProducer, every message is produced in a transaction of its own.
+func (p *kafkaTxnProducer) Input() chan<- *sarama.ProducerMessage {
+	return p.input
+}
+
+// Successes implements sarama.AsyncProducer, the messages of a transaction are returned after it's committed.
+func (p *kafkaTxnProducer) Successes() <-chan *sarama.ProducerMessage {
+	return p.successes
+}
+
+// Errors implements sarama.AsyncProducer.
+func (p *kafkaTxnProducer) Errors() <-chan *sarama.ProducerError {
+	return p.errors
+}
+
+// AsyncClose implements sarama.AsyncProducer.
+func (p *kafkaTxnProducer) AsyncClose() {
+	close(p.input)
+}
+
+// Close implements sarama.AsyncProducer, it waits for the transactions sent to be produced.
+func (p *kafkaTxnProducer) Close() error {
+	p.AsyncClose()
+	<-p.done
+	return nil
+}
+
+// TxnInput is the input of the messages produced in one transaction.
+func (p *kafkaTxnProducer) TxnInput() chan<- []*sarama.ProducerMessage {
+	return p.txns
+}
+
+func (p *kafkaTxnProducer) splitInput() {
+	for msg := range p.input {
+		p.txns <- []*sarama.ProducerMessage{msg}
+	}
+	close(p.txns)
+}
+
+func (p *kafkaTxnProducer) run() {
+	defer func() {
+		if p.coordinator != nil {
+			p.coordinator.Close()
+		}
+		p.client.Close()
+		close(p.successes)
+		close(p.errors)
+		close(p.done)
+	}()
+
+	for msgs := range p.txns {
+		if err := p.produceWithRetry(msgs); err != nil {
+			for _, msg := range msgs {
+				p.errors <- &sarama.ProducerError{Msg: msg, Err: err}
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			p.successes <- msg
+		}
+	}
+}
+
+func (p *kafkaTxnProducer) produceWithRetry(msgs []*sarama.ProducerMessage) error {
+	for retry := 0; ; retry++ {
+		err := p.produce(msgs)
+		if err == nil {
+			return nil
+		}
+		if isFatalKafkaTxnErr(err) || retry >= p.config.Producer.Retry.Max {
+			return errors.Trace(err)
+		}
+		log.Warn("produce kafka transaction failed, retry", zap.String("transactional id", p.txnID),
+			zap.Int("retry", retry), zap.Error(err))
+		// a new producer epoch aborts the transaction and resets the sequence numbers.
+		p.reset(msgs[0].Topic)
+		time.Sleep(p.config.Producer.Retry.Backoff)
+	}
+}
+
+// produce produces the messages in a transaction.
+func (p *kafkaTxnProducer) produce(msgs []*sarama.ProducerMessage) error {
+	if p.coordinator == nil {
+		if err := p.initProducerID(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	batches := make(map[topicPartition]*sarama.RecordBatch)
+	partitions := make(map[string][]int32)
+	now := time.Now()
+	for _, msg := range msgs {
+		tp := topicPartition{topic: msg.Topic, partition: msg.Partition}
+		batch, ok := batches[tp]
+		if !ok {
+			batch = &sarama.RecordBatch{
+				Version:          2,
+				Codec:            p.config.Producer.Compression,
+				CompressionLevel: p.config.Producer.CompressionLevel,
+				FirstTimestamp:   now,
+				MaxTimestamp:     now,
+				ProducerID:       p.producerID,
+				ProducerEpoch:    p.producerEpoch,
+				FirstSequence:    p.sequences[tp],
+				IsTransactional:  true,
+			}
+			batches[tp] = batch
+			partitions[tp.topic] = append(partitions[tp.topic], tp.partition)
+		}
+		record := &sarama.Record{OffsetDelta: int64(len(batch.Records))}
+		var err error
+		if msg.Key != nil {
+			if record.Key, err = msg.Key.Encode(); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if msg.Value != nil {
+			if record.Value, err = msg.Value.Encode(); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		for i := range msg.Headers {
+			record.Headers = append(record.Headers, &msg.Headers[i])
+		}
+		batch.Records = append(batch.Records, record)
+		batch.LastOffsetDelta = int32(len(batch.Records) - 1)
+	}
+
+	addResp, err := p.coordinator.AddPartitionsToTxn(&sarama.AddPartitionsToTxnRequest{
+		TransactionalID: p.txnID,
+		ProducerID:      p.producerID,
+		ProducerEpoch:   p.producerEpoch,
+		TopicPartitions: partitions,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, partitionErrs := range addResp.Errors {
+		for _, partitionErr := range partitionErrs {
+			if partitionErr.Err != sarama.ErrNoError {
+				return errors.Trace(partitionErr.Err)
+			}
+		}
+	}
+
+	// send one request to every leader.
+	requests := make(map[*sarama.Broker]*sarama.ProduceRequest)
+	requestTPs := make(map[*sarama.Broker][]topicPartition)
+	for tp, batch := range batches {
+		leader, err := p.client.Leader(tp.topic, tp.partition)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		req, ok := requests[leader]
+		if !ok {
+			req = &sarama.ProduceRequest{
+				TransactionalID: &p.txnID,
+				RequiredAcks:    sarama.WaitForAll,
+				Timeout:         int32(p.config.Producer.Timeout / time.Millisecond),
+				Version:         3,
+			}
+			requests[leader] = req
+		}
+		req.AddBatch(tp.topic, tp.partition, batch)
+		requestTPs[leader] = append(requestTPs[leader], tp)
+	}
+	for leader, req := range requests {
+		resp, err := leader.Produce(req)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, tp := range requestTPs[leader] {
+			block := resp.GetBlock(tp.topic, tp.partition)
+			if block == nil {
+				return errors.Errorf("no response of partition %d of topic %s", tp.partition, tp.topic)
+			}
+			if block.Err != sarama.ErrNoError {
+				return errors.Trace(block.Err)
+			}
+		}
+	}
+
+	endResp, err := p.coordinator.EndTxn(&sarama.EndTxnRequest{
+		TransactionalID:   p.txnID,
+		ProducerID:        p.producerID,
+		ProducerEpoch:     p.producerEpoch,
+		TransactionResult: true,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if endResp.Err != sarama.ErrNoError {
+		return errors.Trace(endResp.Err)
+	}
+
+	for tp, batch := range batches {
+		p.sequences[tp] += int32(len(batch.Records))
+	}
+	return nil
+}
+
+// initProducerID gets the producer id and a new epoch of the transactional id from the coordinator,
+// the transaction not committed by the previous epoch is aborted.
+func (p *kafkaTxnProducer) initProducerID() error {
+	coordinator, err := p.findCoordinator()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	resp, err := coordinator.InitProducerID(&sarama.InitProducerIDRequest{
+		TransactionalID:    &p.txnID,
+		TransactionTimeout: kafkaTxnTimeout,
+	})
+	if err == nil && resp.Err != sarama.ErrNoError {
+		err = resp.Err
+	}
+	if err != nil {
+		coordinator.Close()
+		return errors.Trace(err)
+	}
+	p.coordinator = coordinator
+	p.producerID, p.producerEpoch = resp.ProducerID, resp.ProducerEpoch
+	p.sequences = make(map[topicPartition]int32)
+	return nil
+}
+
+func (p *kafkaTxnProducer) findCoordinator() (*sarama.Broker, error) {
+	var lastErr error = errors.New("no kafka broker available")
+	for _, broker := range p.client.Brokers() {
+		if err := broker.Open(p.config); err != nil && err != sarama.ErrAlreadyConnected {
+			lastErr = err
+			continue
+		}
+		if err := checkKafkaTxnSupported(broker); err != nil {
+			return nil, errors.Trace(err)
+		}
+		resp, err := broker.FindCoordinator(&sarama.FindCoordinatorRequest{
+			Version:         1,
+			CoordinatorKey:  p.txnID,
+			CoordinatorType: sarama.CoordinatorTransaction,
+		})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.Err != sarama.ErrNoError {
+			return nil, errors.Trace(resp.Err)
+		}
+		coordinator := resp.Coordinator
+		if err = coordinator.Open(p.config); err != nil && err != sarama.ErrAlreadyConnected {
+			return nil, errors.Trace(err)
+		}
+		return coordinator, nil
+	}
+	return nil, errors.Trace(lastErr)
+}
+
+func checkKafkaTxnSupported(broker *sarama.Broker) error {
+	resp, err := broker.ApiVersions(&sarama.ApiVersionsRequest{})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, block := range resp.ApiVersions {
+		if block.ApiKey == apiKeyInitProducerID {
+			return nil
+		}
+	}
+	return errors.Annotatef(sarama.ErrUnsupportedVersion, "kafka broker %s doesn't support transactions", broker.Addr())
+}
+
+// reset closes the connection to the coordinator and refreshes the leaders of the partitions of topic.
+func (p *kafkaTxnProducer) reset(topic string) {
+	if p.coordinator != nil {
+		p.coordinator.Close()
+		p.coordinator = nil
+	}
+	if err := p.client.RefreshMetadata(topic); err != nil {
+		log.Warn("refresh kafka metadata failed", zap.Error(err))
+	}
+}
+
+// isFatalKafkaTxnErr returns whether the transaction can't succeed by retrying, like the
+// producer is fenced by another drainer of the same node id.
+func isFatalKafkaTxnErr(err error) bool {
+	switch errors.Cause(err) {
+	case sarama.ErrInvalidProducerEpoch, sarama.ErrTransactionCoordinatorFenced,
+		sarama.ErrTransactionalIDAuthorizationFailed, sarama.ErrUnsupportedVersion:
+		return true
+	}
+	return false
+}
+
+// isKafkaTxnUnsupportedErr returns whether the brokers are too old to support the transactions.
+func isKafkaTxnUnsupportedErr(err error) bool {
+	return errors.Cause(err) == sarama.ErrUnsupportedVersion
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pingcap/check"
+)
+
+type kafkaTxnSuite struct{}
+
+var _ = check.Suite(&kafkaTxnSuite{})
+
+func (s *kafkaTxnSuite) newBroker(c *check.C, apiKeys ...int16) (*sarama.MockBroker, map[string]sarama.MockResponse) {
+	broker := sarama.NewMockBroker(c, 1)
+	apiVersions := &sarama.ApiVersionsResponse{}
+	for _, key := range apiKeys {
+		apiVersions.ApiVersions = append(apiVersions.ApiVersions, &sarama.ApiVersionsResponseBlock{ApiKey: key})
+	}
+	handlers := map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(c).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("test", 0, broker.BrokerID()).
+			SetLeader("test", 1, broker.BrokerID()),
+		"ApiVersionsRequest": sarama.NewMockWrapper(apiVersions),
+		// the mock of sarama only responds version 0.
+		"FindCoordinatorRequest":    sarama.NewMockWrapper(&sarama.FindCoordinatorResponse{Version: 1, Coordinator: sarama.NewBroker(broker.Addr())}),
+		"InitProducerIDRequest":     sarama.NewMockWrapper(&sarama.InitProducerIDResponse{ProducerID: 100, ProducerEpoch: 1}),
+		"AddPartitionsToTxnRequest": sarama.NewMockWrapper(&sarama.AddPartitionsToTxnResponse{}),
+		"ProduceRequest":            sarama.NewMockProduceResponse(c).SetVersion(3),
+		"EndTxnRequest":             sarama.NewMockWrapper(&sarama.EndTxnResponse{}),
+	}
+	broker.SetHandlerByMap(handlers)
+	return broker, handlers
+}
+
+func (s *kafkaTxnSuite) newConfig() *sarama.Config {
+	config := sarama.NewConfig()
+	config.Version = sarama.V0_11_0_0
+	config.Producer.Retry.Max = 1
+	config.Producer.Retry.Backoff = time.Millisecond
+	return config
+}
+
+func (s *kafkaTxnSuite) TestProduce(c *check.C) {
+	broker, _ := s.newBroker(c, apiKeyInitProducerID)
+	defer broker.Close()
+
+	p, err := newKafkaTxnProducer([]string{broker.Addr()}, s.newConfig(), "drainer-1", "test")
+	c.Assert(err, check.IsNil)
+	c.Assert(p.producerID, check.Equals, int64(100))
+	c.Assert(p.producerEpoch, check.Equals, int16(1))
+
+	msgs := []*sarama.ProducerMessage{
+		{Topic: "test", Partition: 0, Value: sarama.StringEncoder("a")},
+		{Topic: "test", Partition: 1, Value: sarama.StringEncoder("b")},
+		{Topic: "test", Partition: 0, Value: sarama.StringEncoder("c")},
+	}
+	p.TxnInput() <- msgs
+	for i := range msgs {
+		c.Assert(<-p.Successes(), check.Equals, msgs[i])
+	}
+	p.Input() <- &sarama.ProducerMessage{Topic: "test", Partition: 1, Value: sarama.StringEncoder("d")}
+	<-p.Successes()
+	c.Assert(p.Close(), check.IsNil)
+
+	c.Assert(p.sequences, check.DeepEquals, map[topicPartition]int32{
+		{topic: "test", partition: 0}: 2,
+		{topic: "test", partition: 1}: 2,
+	})
+	var produces, endTxns int
+	for _, rr := range broker.History() {
+		switch req := rr.Request.(type) {
+		case *sarama.ProduceRequest:
+			produces++
+			c.Assert(*req.TransactionalID, check.Equals, kafkaTxnIDPrefix+"drainer-1")
+		case *sarama.EndTxnRequest:
+			endTxns++
+			c.Assert(req.TransactionResult, check.IsTrue)
+			c.Assert(req.ProducerID, check.Equals, int64(100))
+		}
+	}
+	c.Assert(produces, check.Equals, 2)
+	c.Assert(endTxns, check.Equals, 2)
+}
+
+func (s *kafkaTxnSuite) TestRetryAndFail(c *check.C) {
+	broker, handlers := s.newBroker(c, apiKeyInitProducerID)
+	defer broker.Close()
+
+	p, err := newKafkaTxnProducer([]string{broker.Addr()}, s.newConfig(), "drainer-1", "test")
+	c.Assert(err, check.IsNil)
+
+	// the failed transaction is retried with a new epoch.
+	handlers["ProduceRequest"] = sarama.NewMockSequence(
+		sarama.NewMockProduceResponse(c).SetVersion(3).SetError("test", 0, sarama.ErrNotLeaderForPartition),
+		sarama.NewMockProduceResponse(c).SetVersion(3))
+	handlers["InitProducerIDRequest"] = sarama.NewMockWrapper(&sarama.InitProducerIDResponse{ProducerID: 100, ProducerEpoch: 2})
+	broker.SetHandlerByMap(handlers)
+	msg := &sarama.ProducerMessage{Topic: "test", Partition: 0, Value: sarama.StringEncoder("a")}
+	p.Input() <- msg
+	c.Assert(<-p.Successes(), check.Equals, msg)
+	c.Assert(p.producerEpoch, check.Equals, int16(2))
+
+	// fenced by another producer.
+	handlers["EndTxnRequest"] = sarama.NewMockWrapper(&sarama.EndTxnResponse{Err: sarama.ErrInvalidProducerEpoch})
+	broker.SetHandlerByMap(handlers)
+	p.Input() <- msg
+	perr := <-p.Errors()
+	c.Assert(perr.Msg, check.Equals, msg)
+	c.Assert(isFatalKafkaTxnErr(perr.Err), check.IsTrue)
+	c.Assert(p.Close(), check.IsNil)
+}
+
+func (s *kafkaTxnSuite) TestUnsupported(c *check.C) {
+	broker, _ := s.newBroker(c)
+	defer broker.Close()
+
+	_, err := newKafkaTxnProducer([]string{broker.Addr()}, s.newConfig(), "drainer-1", "test")
+	c.Assert(err, check.ErrorMatches, ".*doesn't support transactions.*")
+	c.Assert(isKafkaTxnUnsupportedErr(err), check.IsTrue)
+
+	// fall back to the idempotent producer.
+	oldNewAsyncProducer := newAsyncProducer
+	defer func() { newAsyncProducer = oldNewAsyncProducer }()
+	var idempotent bool
+	newAsyncProducer = func(addrs []string, config *sarama.Config) (sarama.AsyncProducer, error) {
+		idempotent = config.Producer.Idempotent
+		return nil, nil
+	}
+	_, err = newKafkaProducer([]string{broker.Addr()}, s.newConfig(), &DBConfig{KafkaTransaction: true, NodeID: "drainer-1"}, "test")
+	c.Assert(err, check.IsNil)
+	c.Assert(idempotent, check.IsTrue)
+}
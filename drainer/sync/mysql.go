@@ -15,35 +15,81 @@ package sync
 
 import (
 	"database/sql"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pingcap/tidb-binlog/drainer/loopbacksync"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb-binlog/drainer/relay"
 	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
 	"github.com/pingcap/tidb-binlog/pkg/loader"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
 )
 
 var _ Syncer = &MysqlSyncer{}
+var _ CheckpointListener = &MysqlSyncer{}
 
 // QueueSizeGauge to be used.
 var QueueSizeGauge *prometheus.GaugeVec
 
+// DDLBroadcastFailureCounter to be used.
+var DDLBroadcastFailureCounter *prometheus.CounterVec
+
+// DDLBlockedGauge to be used.
+var DDLBlockedGauge prometheus.Gauge
+
+// LoaderWorkerBusyCounter to be used.
+var LoaderWorkerBusyCounter *prometheus.CounterVec
+
+// LoaderQueueWaitHistogram to be used.
+var LoaderQueueWaitHistogram prometheus.Histogram
+
+// LoaderConflictStallHistogram to be used.
+var LoaderConflictStallHistogram prometheus.Histogram
+
+// LoaderRetryCounter to be used.
+var LoaderRetryCounter *prometheus.CounterVec
+
+// KilledQueryCounter to be used.
+var KilledQueryCounter prometheus.Counter
+
 // MysqlSyncer sync binlog to Mysql
 type MysqlSyncer struct {
-	db      *sql.DB
+	db *sql.DB
+	// ddlDB is nil if the DDLs are executed on db.
+	ddlDB *sql.DB
+	// killDB is the control connection killing the timeout statements, nil if there's no statement timeout.
+	killDB  *sql.DB
 	loader  loader.Loader
 	relayer relay.Relayer
+
+	downstreamVersion string
+	keepDDLComments   bool
+	// sqlMode is the sql mode of the sessions of downstream the DDLs are checked under if checkSQLMode.
+	sqlMode      mysql.SQLMode
+	checkSQLMode bool
+	// commitTSTables are the tables annotated with the commit ts columns, nil if there's none.
+	commitTSTables *filter.Filter
+
+	// heartbeat is nil if it's disabled.
+	heartbeat     *heartbeat
+	heartbeatQuit chan struct{}
 	*baseSyncer
 }
 
 // should only be used for unit test to create mock db
 var createDB = loader.CreateDBWithSQLMode
 
+var createDDLDB = loader.CreateDDLDB
+
 // CreateLoader create the Loader instance.
 func CreateLoader(
 	db *sql.DB,
@@ -56,6 +102,7 @@ func CreateLoader(
 	info *loopbacksync.LoopBackSync,
 	enableDispatch bool,
 	enableCausility bool,
+	opt ...loader.Option,
 ) (ld loader.Loader, err error) {
 
 	var opts []loader.Option
@@ -65,18 +112,67 @@ func CreateLoader(
 			QueryHistogramVec: queryHistogramVec,
 			EventCounterVec:   nil,
 			QueueSizeGauge:    QueueSizeGauge,
+
+			DDLBroadcastFailureCounterVec: DDLBroadcastFailureCounter,
+			DDLBlockedGauge:               DDLBlockedGauge,
+
+			WorkerBusySecondsCounterVec: LoaderWorkerBusyCounter,
+			QueueWaitHistogram:          LoaderQueueWaitHistogram,
+			ConflictStallHistogram:      LoaderConflictStallHistogram,
+			RetryCounterVec:             LoaderRetryCounter,
+			KilledQueryCounter:          KilledQueryCounter,
 		}))
 	}
 
 	opts = append(opts, loader.EnableDispatch(enableDispatch))
 	opts = append(opts, loader.EnableCausality(enableCausility))
 	opts = append(opts, loader.Merge(cfg.Merge))
+	opts = append(opts, loader.KeepDDLComments(cfg.KeepDDLComments))
+	if cfg.TableShardCount > 0 {
+		opts = append(opts, loader.TableShardCount(cfg.TableShardCount))
+	}
+
+	if cfg.DDLTimeout > 0 {
+		opts = append(opts, loader.DDLTimeout(time.Duration(cfg.DDLTimeout)*time.Second))
+	}
+	if cfg.DDLBlockCheckInterval > 0 {
+		opts = append(opts, loader.DDLBlockCheckInterval(time.Duration(cfg.DDLBlockCheckInterval)*time.Second))
+	}
+	if cfg.AutoTune != nil {
+		opts = append(opts, loader.AutoTune(cfg.AutoTune))
+	}
+	opts = append(opts, loader.ConnPool(cfg.MaxOpenConns, cfg.MaxIdleConns, time.Duration(cfg.ConnMaxLifetime)*time.Second))
+	isolation, err := loader.ParseIsolationLevel(cfg.IsolationLevel)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	opts = append(opts, loader.IsolationLevel(isolation))
+
+	if len(cfg.DDLBroadcastRules) > 0 {
+		shards := make(map[string][]string, len(cfg.DDLBroadcastRules))
+		for _, rule := range cfg.DDLBroadcastRules {
+			shards[rule.Schema] = rule.Shards()
+		}
+		opts = append(opts, loader.DDLBroadcast(shards))
+		opts = append(opts, loader.BlockSchemaMoveDDL(cfg.SchemaMoveDDL == SchemaMoveDDLBlock))
+	}
+
+	if len(cfg.UpsertRules) > 0 {
+		upsertTables, err := newUpsertTables(cfg.UpsertRules)
+		if err != nil {
+			return nil, errors.Annotate(err, "invalid upsert rule")
+		}
+		opts = append(opts, loader.UpsertTables(func(schema, table string) bool {
+			return !upsertTables.SkipSchemaAndTable(schema, table)
+		}))
+	}
 
 	if cfg.SyncMode != 0 {
 		mode := loader.SyncMode(cfg.SyncMode)
 		opts = append(opts, loader.SyncModeOption(mode))
 	}
 
+	opts = append(opts, opt...)
 	ld, err = loader.NewLoader(db, opts...)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -89,6 +185,7 @@ func CreateLoader(
 func NewMysqlSyncer(
 	cfg *DBConfig,
 	tableInfoGetter translator.TableInfoGetter,
+	columnFilter *filter.ColumnFilter,
 	worker int,
 	batchSize int,
 	queryHistogramVec *prometheus.HistogramVec,
@@ -103,11 +200,26 @@ func NewMysqlSyncer(
 		log.Info("enable TLS to connect downstream MySQL/TiDB")
 	}
 
+	generatedColumnRules, err := newGeneratedColumnRules(cfg.GeneratedColumnRules)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	noKeyTableRules, err := newNoKeyTableRules(cfg.NoKeyTableRules)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	commitTSTables, err := newCommitTSTables(cfg.CommitTSColumnRules)
+	if err != nil {
+		return nil, errors.Annotate(err, "invalid commit-ts-column rule")
+	}
+
 	db, err := createDB(cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.TLS, sqlMode, cfg.Params)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
+	// dbMode is the sql mode of db, it's relaxed for SyncPartialColumn.
+	dbMode := sqlMode
 	syncMode := loader.SyncMode(cfg.SyncMode)
 	if syncMode == loader.SyncPartialColumn {
 		var oldMode, newMode string
@@ -119,34 +231,174 @@ func NewMysqlSyncer(
 
 		if newMode != oldMode {
 			db.Close()
-			db, err = createDB(cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.TLS, &newMode, cfg.Params)
+			dbMode = &newMode
+			db, err = createDB(cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.TLS, dbMode, cfg.Params)
 			if err != nil {
 				return nil, errors.Trace(err)
 			}
 		}
 	}
 
-	loader, err := CreateLoader(db, cfg, worker, batchSize, queryHistogramVec, sqlMode, destDBType, info, enableDispatch, enableCausility)
+	if params := downstreamParams(db, cfg.Params); len(params) > len(cfg.Params) {
+		db.Close()
+		db, err = createDB(cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.TLS, dbMode, params)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	// the sql mode is queried when it's configured, so the mode rejected by downstream is reported
+	// before syncing, and the DDLs are checked under the mode taking effect.
+	var (
+		mode      mysql.SQLMode
+		checkMode bool
+	)
+	if sqlMode != nil {
+		var strMode string
+		if strMode, err = querySQLMode(db); err != nil {
+			db.Close()
+			return nil, errors.Annotatef(err, "set the sql mode of downstream to %s", *sqlMode)
+		}
+		if mode, err = mysql.GetSQLMode(strMode); err != nil {
+			log.Warn("unknown sql mode of downstream, the ddls won't be checked", zap.String("sql mode", strMode), zap.Error(err))
+		} else {
+			log.Info("check the ddls under the sql mode of downstream", zap.String("sql mode", strMode))
+			checkMode = true
+		}
+	}
+
+	var hb *heartbeat
+	if cfg.Heartbeat.Enable {
+		if hb, err = newHeartbeat(db, cfg.Heartbeat, cfg.ClusterID); err != nil {
+			db.Close()
+			return nil, errors.Trace(err)
+		}
+	}
+
+	var (
+		ddlDB  *sql.DB
+		killDB *sql.DB
+		opts   []loader.Option
+	)
+	closeDBs := func() {
+		db.Close()
+		if ddlDB != nil {
+			ddlDB.Close()
+		}
+		if killDB != nil {
+			killDB.Close()
+		}
+	}
+	if cfg.DDL.Enable {
+		if ddlDB, err = openDDLDB(cfg, sqlMode); err != nil {
+			closeDBs()
+			return nil, errors.Trace(err)
+		}
+		opts = append(opts, loader.DDLDB(ddlDB))
+		if len(cfg.DDL.OnlineSchemaChange) > 0 {
+			opts = append(opts, loader.OnlineSchemaChange(cfg.DDL.OnlineSchemaChange))
+		}
+	}
+	if cfg.StatementTimeout > 0 {
+		if killDB, err = openKillDB(cfg, sqlMode); err != nil {
+			closeDBs()
+			return nil, errors.Trace(err)
+		}
+		timeout := time.Duration(cfg.StatementTimeout) * time.Second
+		opts = append(opts, loader.StatementTimeout(timeout, cfg.StatementTimeoutAction, killDB))
+	}
+
+	loader, err := CreateLoader(db, cfg, worker, batchSize, queryHistogramVec, sqlMode, destDBType, info, enableDispatch, enableCausility, opts...)
 	if err != nil {
+		closeDBs()
 		return nil, errors.Trace(err)
 	}
 
 	s := &MysqlSyncer{
-		db:         db,
-		loader:     loader,
-		relayer:    relayer,
-		baseSyncer: newBaseSyncer(tableInfoGetter),
+		db:                db,
+		ddlDB:             ddlDB,
+		killDB:            killDB,
+		loader:            loader,
+		relayer:           relayer,
+		downstreamVersion: cfg.DownstreamVersion,
+		keepDDLComments:   cfg.KeepDDLComments,
+		sqlMode:           mode,
+		checkSQLMode:      checkMode,
+		heartbeat:         hb,
+		heartbeatQuit:     make(chan struct{}),
+		baseSyncer:        newBaseSyncer(tableInfoGetter, columnFilter),
 	}
+	s.generatedColumnRules = generatedColumnRules
+	s.noKeyTableRules = noKeyTableRules
+	s.commitTSTables = commitTSTables
+	s.charsets = cfg.Charsets
 
 	go s.run()
+	if hb != nil {
+		go hb.run(s.heartbeatQuit)
+	}
 
 	return s, nil
 }
 
+// downstreamParams returns the session variables enabling the features downstream supports,
+// like async commit and one phase commit of TiDB, plus the ones in params. Downstream is taken
+// as MySQL if the probe fails, since the features are only optimizations.
+func downstreamParams(db *sql.DB, params map[string]string) map[string]string {
+	caps, err := loader.ProbeCapabilities(db)
+	if err != nil {
+		log.Warn("probe the capabilities of downstream failed", zap.Error(err))
+		return params
+	}
+	log.Info("probe the capabilities of downstream", zap.String("version", caps.Version),
+		zap.Bool("async commit", caps.AsyncCommit), zap.Bool("1pc", caps.OnePC))
+	return caps.SessionParams(params)
+}
+
+// openDDLDB opens the dedicated connection executing the DDLs, the DDLs are executed one by one
+// so one connection is enough.
+func openDDLDB(cfg *DBConfig, sqlMode *string) (*sql.DB, error) {
+	params := make(map[string]string, len(cfg.Params)+1)
+	for k, v := range cfg.Params {
+		params[k] = v
+	}
+	if cfg.DDL.LockWaitTimeout > 0 {
+		params["lock_wait_timeout"] = strconv.Itoa(cfg.DDL.LockWaitTimeout)
+	}
+
+	db, err := createDDLDB(cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.TLS, sqlMode, params)
+	if err != nil {
+		return nil, errors.Annotate(err, "open the ddl connection")
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	return db, nil
+}
+
+// openKillDB opens the control connection killing the timeout statements, it's apart from the
+// connections of the DML workers so the kills aren't blocked when all of them are busy.
+func openKillDB(cfg *DBConfig, sqlMode *string) (*sql.DB, error) {
+	db, err := createDB(cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.TLS, sqlMode, cfg.Params)
+	if err != nil {
+		return nil, errors.Annotate(err, "open the control connection")
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	return db, nil
+}
+
+// querySQLMode returns the sql mode of the session of db.
+func querySQLMode(db *sql.DB) (mode string, err error) {
+	row := db.QueryRow("SELECT @@SESSION.sql_mode;")
+	if err = row.Scan(&mode); err != nil {
+		return "", errors.Trace(err)
+	}
+	return mode, nil
+}
+
 // set newMode as the oldMode query from db by removing "STRICT_TRANS_TABLES".
 func relaxSQLMode(db *sql.DB) (oldMode string, newMode string, err error) {
-	row := db.QueryRow("SELECT @@SESSION.sql_mode;")
-	err = row.Scan(&oldMode)
+	oldMode, err = querySQLMode(db)
 	if err != nil {
 		return "", "", errors.Trace(err)
 	}
@@ -166,6 +418,12 @@ func relaxSQLMode(db *sql.DB) (oldMode string, newMode string, err error) {
 	return
 }
 
+// Tuner returns the tuner to change txn-batch and worker-count of the loader.
+func (m *MysqlSyncer) Tuner() loader.Tuner {
+	tuner, _ := m.loader.(loader.Tuner)
+	return tuner
+}
+
 // SetSafeMode make the MysqlSyncer to use safe mode or not
 func (m *MysqlSyncer) SetSafeMode(mode bool) bool {
 	m.loader.SetSafeMode(mode)
@@ -183,12 +441,26 @@ func (m *MysqlSyncer) Sync(item *Item) error {
 		item.RelayLogPos = pos
 	}
 
-	txn, err := translator.TiBinlogToTxn(m.tableInfoGetter, item.Schema, item.Table, item.Binlog, item.PrewriteValue, item.ShouldSkip)
+	txn, err := translator.TiBinlogToTxn(m.translatorContext(item))
 	if err != nil {
 		return errors.Trace(err)
 	}
 	txn.Metadata = item
 
+	if m.columnFilter != nil {
+		translator.FilterTxnColumns(txn, m.columnFilter)
+	}
+
+	if m.commitTSTables != nil && txn.DDL == nil {
+		translator.AddCommitTSColumns(txn, item.Binlog.CommitTs, m.isCommitTSTable)
+	}
+
+	if txn.DDL != nil && !txn.DDL.ShouldSkip {
+		if err := m.rewriteDDL(txn.DDL); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
 	select {
 	case <-m.errCh:
 		return m.err
@@ -197,8 +469,89 @@ func (m *MysqlSyncer) Sync(item *Item) error {
 	}
 }
 
+// newCommitTSTables returns the filter matching the tables of the rules, nil if there's no rule.
+func newCommitTSTables(rules []CommitTSColumnRule) (*filter.Filter, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	tables := make([]filter.TableName, 0, len(rules))
+	for _, rule := range rules {
+		tables = append(tables, filter.TableName{Schema: rule.Schema, Table: rule.Table})
+	}
+	return filter.NewFilter(nil, nil, nil, tables)
+}
+
+// newUpsertTables returns the filter matching the tables of the upsert rules.
+func newUpsertTables(rules []UpsertRule) (*filter.Filter, error) {
+	tables := make([]filter.TableName, 0, len(rules))
+	for _, rule := range rules {
+		tables = append(tables, filter.TableName{Schema: rule.Schema, Table: rule.Table})
+	}
+	return filter.NewFilter(nil, nil, nil, tables)
+}
+
+func (m *MysqlSyncer) isCommitTSTable(schema string, table string) bool {
+	return !m.commitTSTables.SkipSchemaAndTable(schema, table)
+}
+
+// rewriteDDL adds the commit ts columns to the tables created and rewrites the DDL for the
+// version of downstream, the DDL is skipped if nothing remains to be executed.
+func (m *MysqlSyncer) rewriteDDL(ddl *loader.DDL) error {
+	sql := ddl.SQL
+	if m.commitTSTables != nil && m.isCommitTSTable(ddl.Database, ddl.Table) {
+		var err error
+		if sql, err = translator.AddCommitTSColumnsToDDL(sql); err != nil {
+			return errors.Trace(err)
+		}
+		if sql != ddl.SQL {
+			log.Info("add commit ts columns to ddl", zap.String("ddl", ddl.SQL), zap.String("rewritten", sql))
+		}
+	}
+
+	if len(m.downstreamVersion) > 0 {
+		rewritten, err := translator.RewriteDDLForDownstream(sql, m.downstreamVersion)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if rewritten != sql {
+			log.Info("rewrite ddl for downstream", zap.String("version", m.downstreamVersion),
+				zap.String("ddl", sql), zap.String("rewritten", rewritten))
+		}
+		sql = rewritten
+	}
+
+	if m.checkSQLMode && len(sql) > 0 {
+		if err := translator.CheckDDLForSQLMode(sql, m.sqlMode); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if sql == ddl.SQL {
+		return nil
+	}
+	if len(sql) == 0 {
+		ddl.ShouldSkip = true
+		return nil
+	}
+	if m.keepDDLComments {
+		sql = pkgsql.KeepLeadingComments(ddl.SQL, sql)
+	}
+	ddl.SQL = sql
+	return nil
+}
+
+// OnCheckpointSaved implements CheckpointListener, the checkpoint is written to the heartbeat row.
+func (m *MysqlSyncer) OnCheckpointSaved(ts int64) {
+	if m.heartbeat != nil {
+		m.heartbeat.setCheckpoint(ts)
+	}
+}
+
 // Close implements Syncer interface
 func (m *MysqlSyncer) Close() error {
+	if m.heartbeatQuit != nil {
+		close(m.heartbeatQuit)
+	}
 	m.loader.Close()
 
 	err := <-m.Error()
@@ -238,5 +591,11 @@ func (m *MysqlSyncer) run() {
 
 	wg.Wait()
 	m.db.Close()
+	if m.ddlDB != nil {
+		m.ddlDB.Close()
+	}
+	if m.killDB != nil {
+		m.killDB.Close()
+	}
 	m.setErr(err)
 }
@@ -18,6 +18,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/pingcap/check"
 	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb-binlog/drainer/relay"
 	"github.com/pingcap/tidb-binlog/drainer/translator"
 	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
@@ -59,7 +60,7 @@ func (s *mysqlSuite) TestMySQLSyncerAvoidBlock(c *check.C) {
 	syncer := &MysqlSyncer{
 		db:         db,
 		loader:     fakeMySQLLoaderImpl,
-		baseSyncer: newBaseSyncer(infoGetter),
+		baseSyncer: newBaseSyncer(infoGetter, nil),
 	}
 	go syncer.run()
 	gen := translator.BinlogGenerator{}
@@ -134,7 +135,7 @@ func (s *mysqlSuite) TestMySQLSyncerWithRelayer(c *check.C) {
 		db:         db,
 		loader:     fakeMySQLLoaderImpl,
 		relayer:    relayer,
-		baseSyncer: newBaseSyncer(infoGetter),
+		baseSyncer: newBaseSyncer(infoGetter, nil),
 	}
 	defer syncer.Close()
 
@@ -169,6 +170,120 @@ func (s *mysqlSuite) TestMySQLSyncerWithRelayer(c *check.C) {
 	c.Assert(len(names), check.Equals, 2)
 }
 
+func (s *mysqlSuite) TestMySQLSyncerRewriteDDL(c *check.C) {
+	var infoGetter translator.TableInfoGetter
+	fakeMySQLLoaderImpl := &fakeMySQLLoaderForRelayer{
+		successes: make(chan *loader.Txn, 8),
+		input:     make(chan *loader.Txn, 8),
+	}
+	db, _, _ := sqlmock.New()
+	syncer := &MysqlSyncer{
+		db:                db,
+		loader:            fakeMySQLLoaderImpl,
+		downstreamVersion: translator.DownstreamVersion57,
+		baseSyncer:        newBaseSyncer(infoGetter, nil),
+	}
+
+	gen := translator.BinlogGenerator{}
+	gen.SetDDL()
+	gen.TiBinlog.DdlQuery = []byte("create table test(id int, index idx(id) invisible)")
+	err := syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+	txn := <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.SQL, check.Equals, "CREATE TABLE `test` (`id` INT,INDEX `idx`(`id`) )")
+	c.Assert(txn.DDL.ShouldSkip, check.IsFalse)
+
+	gen.TiBinlog.DdlQuery = []byte("alter table test alter index idx invisible")
+	err = syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+	txn = <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.ShouldSkip, check.IsTrue)
+
+	// the leading comments are dropped by rewriting unless keep-ddl-comments is set.
+	gen.TiBinlog.DdlQuery = []byte("/*vt+ SHARD=1 */ create table test(id int, index idx(id) invisible)")
+	err = syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+	txn = <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.SQL, check.Equals, "CREATE TABLE `test` (`id` INT,INDEX `idx`(`id`) )")
+
+	syncer.keepDDLComments = true
+	err = syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+	txn = <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.SQL, check.Equals, "/*vt+ SHARD=1 */ CREATE TABLE `test` (`id` INT,INDEX `idx`(`id`) )")
+}
+
+func (s *mysqlSuite) TestMySQLSyncerCommitTSColumns(c *check.C) {
+	var infoGetter translator.TableInfoGetter
+	fakeMySQLLoaderImpl := &fakeMySQLLoaderForRelayer{
+		successes: make(chan *loader.Txn, 8),
+		input:     make(chan *loader.Txn, 8),
+	}
+	commitTSTables, err := newCommitTSTables([]CommitTSColumnRule{{Schema: "test", Table: "~^audit_"}})
+	c.Assert(err, check.IsNil)
+	db, _, _ := sqlmock.New()
+	syncer := &MysqlSyncer{
+		db:                db,
+		loader:            fakeMySQLLoaderImpl,
+		downstreamVersion: translator.DownstreamVersion57,
+		keepDDLComments:   true,
+		commitTSTables:    commitTSTables,
+		baseSyncer:        newBaseSyncer(infoGetter, nil),
+	}
+
+	gen := translator.BinlogGenerator{}
+	gen.SetDDL()
+	gen.TiBinlog.DdlQuery = []byte("/* audit */ create table audit_log(id int, index idx(id) invisible)")
+	err = syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: "test", Table: "audit_log"})
+	c.Assert(err, check.IsNil)
+	txn := <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.SQL, check.Equals, "/* audit */ CREATE TABLE `audit_log` (`id` INT,`_tidb_commit_ts` BIGINT,"+
+		"`_tidb_commit_time` DATETIME(3),INDEX `idx`(`id`) )")
+
+	// the tables not matched are created as is.
+	gen.TiBinlog.DdlQuery = []byte("create table log(id int)")
+	err = syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: "test", Table: "log"})
+	c.Assert(err, check.IsNil)
+	txn = <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.SQL, check.Equals, "create table log(id int)")
+}
+
+func (s *mysqlSuite) TestMySQLSyncerCheckSQLMode(c *check.C) {
+	var infoGetter translator.TableInfoGetter
+	fakeMySQLLoaderImpl := &fakeMySQLLoaderForRelayer{
+		successes: make(chan *loader.Txn, 8),
+		input:     make(chan *loader.Txn, 8),
+	}
+	db, _, _ := sqlmock.New()
+	syncer := &MysqlSyncer{
+		db:                db,
+		loader:            fakeMySQLLoaderImpl,
+		downstreamVersion: translator.DownstreamVersion57,
+		sqlMode:           mysql.ModeStrictTransTables | mysql.ModeNoZeroDate,
+		checkSQLMode:      true,
+		baseSyncer:        newBaseSyncer(infoGetter, nil),
+	}
+
+	gen := translator.BinlogGenerator{}
+	gen.SetDDL()
+	gen.TiBinlog.DdlQuery = []byte("create table test(id int, d datetime default '2021-05-01 00:00:00')")
+	err := syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+	txn := <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.SQL, check.Equals, "create table test(id int, d datetime default '2021-05-01 00:00:00')")
+
+	gen.TiBinlog.DdlQuery = []byte("alter table test add column e date default '0000-00-00'")
+	err = syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.ErrorMatches, ".*default value '0000-00-00' of column e.*")
+
+	// the DDLs aren't checked if the sql mode of downstream is unknown.
+	syncer.checkSQLMode = false
+	err = syncer.Sync(&Item{Binlog: gen.TiBinlog, Schema: gen.Schema, Table: gen.Table})
+	c.Assert(err, check.IsNil)
+	txn = <-fakeMySQLLoaderImpl.input
+	c.Assert(txn.DDL.SQL, check.Equals, "alter table test add column e date default '0000-00-00'")
+}
+
 func (s *mysqlSuite) TestRelaxSQLMode(c *check.C) {
 	tests := []struct {
 		oldMode string
@@ -15,14 +15,18 @@ package sync
 
 import (
 	"context"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-binlog/drainer/translator"
 	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
 	tb "github.com/pingcap/tipb/go-binlog"
+	"go.uber.org/zap"
 )
 
 var _ Syncer = &pbSyncer{}
@@ -32,10 +36,45 @@ type pbSyncer struct {
 
 	binlogger binlogfile.Binlogger
 	cancel    func()
+
+	dir   string
+	guard PBRetentionGuard
+
+	guardMu sync.Mutex
+	// files are the first commit ts of the binlog files, sorted by index.
+	files []pbFile
+	// checkpoints are the latest checkpoints saved, at most guard.Checkpoints.
+	checkpoints []int64
 }
 
-// NewPBSyncer sync binlog to files
-func NewPBSyncer(dir string, retentionDays int, tableInfoGetter translator.TableInfoGetter) (*pbSyncer, error) {
+// PBRetentionGuard keeps the binlog files covering the latest hours and the
+// latest checkpoints from being deleted by retention-time, so the files still
+// needed by the readers resuming from a checkpoint are never deleted.
+type PBRetentionGuard struct {
+	// Hours is the number of hours, the files covering the binlogs written in
+	// the latest hours are kept, zero means no guard.
+	Hours int `toml:"hours" json:"hours"`
+	// Checkpoints is the number of checkpoints, the files containing the
+	// latest checkpoints and the binlogs after them are kept, zero means no guard.
+	Checkpoints int `toml:"checkpoints" json:"checkpoints"`
+}
+
+func (g PBRetentionGuard) enabled() bool {
+	return g.Hours > 0 || g.Checkpoints > 0
+}
+
+type pbFile struct {
+	index   uint64
+	firstTS int64
+}
+
+// NewPBSyncer sync binlog to files, checkpointTS is the checkpoint drainer starts at.
+func NewPBSyncer(dir string, retentionDays int, guard PBRetentionGuard, checkpointTS int64, tableInfoGetter translator.TableInfoGetter, columnFilter *filter.ColumnFilter, generatedColumnRules []GeneratedColumnRule, charsets translator.Charsets) (*pbSyncer, error) {
+	rules, err := newGeneratedColumnRules(generatedColumnRules)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	binlogger, err := binlogfile.OpenBinlogger(dir, binlogfile.SegmentSizeBytes)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -45,8 +84,26 @@ func NewPBSyncer(dir string, retentionDays int, tableInfoGetter translator.Table
 
 	s := &pbSyncer{
 		binlogger:  binlogger,
-		baseSyncer: newBaseSyncer(tableInfoGetter),
+		baseSyncer: newBaseSyncer(tableInfoGetter, columnFilter),
 		cancel:     cancel,
+		dir:        dir,
+		guard:      guard,
+	}
+	s.generatedColumnRules = rules
+	s.charsets = charsets
+
+	if guard.Checkpoints > 0 {
+		s.checkpoints = []int64{checkpointTS}
+		if s.files, err = readFirstTSOfFiles(dir, binlogger); err != nil {
+			cancel()
+			binlogger.Close()
+			return nil, errors.Trace(err)
+		}
+	}
+	if err = s.checkGuard(time.Now(), checkpointTS); err != nil {
+		cancel()
+		binlogger.Close()
+		return nil, errors.Trace(err)
 	}
 
 	if retentionDays > 0 {
@@ -62,7 +119,7 @@ func NewPBSyncer(dir string, retentionDays int, tableInfoGetter translator.Table
 					return
 				case <-ticker.C:
 					log.Info("Trying to GC binlog files")
-					binlogger.GCByTime(retentionTime)
+					s.gc(time.Now(), retentionTime)
 				}
 			}
 		}()
@@ -71,17 +128,170 @@ func NewPBSyncer(dir string, retentionDays int, tableInfoGetter translator.Table
 	return s, nil
 }
 
+// readFirstTSOfFiles reads the commit ts of the first binlog of each file.
+func readFirstTSOfFiles(dir string, binlogger binlogfile.Binlogger) ([]pbFile, error) {
+	names, err := binlogfile.ReadBinlogNames(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var files []pbFile
+	for _, name := range names {
+		index, _, err := binlogfile.ParseBinlogName(name)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		ents, err := binlogger.ReadFrom(tb.Pos{Suffix: index}, 1)
+		if err != nil {
+			return nil, errors.Annotatef(err, "read the first binlog of %s", name)
+		}
+		// the file is empty if the binlog is from the next file.
+		if len(ents) == 0 || ents[0].Pos.Suffix != index {
+			continue
+		}
+
+		binlog := new(pb.Binlog)
+		if err = binlog.Unmarshal(ents[0].Payload); err != nil {
+			return nil, errors.Annotatef(err, "decode the first binlog of %s", name)
+		}
+		files = append(files, pbFile{index: index, firstTS: binlog.CommitTs})
+	}
+	return files, nil
+}
+
+// checkGuard returns error if the files the guard keeps are already deleted,
+// i.e. the files before the oldest one covers the latest hours or contains the
+// checkpoint.
+func (p *pbSyncer) checkGuard(now time.Time, checkpointTS int64) error {
+	if !p.guard.enabled() {
+		return nil
+	}
+
+	names, err := binlogfile.ReadBinlogNames(p.dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	first, _, err := binlogfile.ParseBinlogName(names[0])
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// no file is deleted.
+	if first == 0 {
+		return nil
+	}
+
+	if p.guard.Hours > 0 {
+		createdAt, err := binlogfile.ParseBinlogDateTime(names[0])
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if since := now.Add(-time.Duration(p.guard.Hours) * time.Hour); createdAt.After(since) {
+			return errors.Errorf("the binlog files before %s are deleted, but the binlogs after %s should be kept by retention-guard.hours %d",
+				names[0], since.Format(time.RFC3339), p.guard.Hours)
+		}
+	}
+	if p.guard.Checkpoints > 0 && len(p.files) > 0 && p.files[0].firstTS > checkpointTS {
+		return errors.Errorf("the binlog files before %s are deleted, but the first binlog %d in it is after the checkpoint %d",
+			names[0], p.files[0].firstTS, checkpointTS)
+	}
+	return nil
+}
+
+// guardIndex returns the min index of the files kept by the guard.
+func (p *pbSyncer) guardIndex(now time.Time) uint64 {
+	index := uint64(math.MaxUint64)
+	if p.guard.Hours > 0 {
+		names, err := binlogfile.ReadBinlogNames(p.dir)
+		if err != nil {
+			log.Error("read binlog files failed", zap.Error(err))
+			return 0
+		}
+		since := now.Add(-time.Duration(p.guard.Hours) * time.Hour)
+		// the file created before since and the files after it cover the binlogs after since.
+		for i := len(names) - 1; i >= 0; i-- {
+			createdAt, err := binlogfile.ParseBinlogDateTime(names[i])
+			if err != nil {
+				log.Error("parse binlog file failed", zap.Error(err))
+				return 0
+			}
+			if fileIndex, _, err := binlogfile.ParseBinlogName(names[i]); err == nil && fileIndex < index {
+				index = fileIndex
+			}
+			if !createdAt.After(since) {
+				break
+			}
+		}
+	}
+
+	if p.guard.Checkpoints > 0 {
+		p.guardMu.Lock()
+		defer p.guardMu.Unlock()
+		if len(p.files) > 0 {
+			// the file containing the oldest checkpoint and the files after it.
+			cpIndex := p.files[0].index
+			for _, f := range p.files {
+				if f.firstTS > p.checkpoints[0] {
+					break
+				}
+				cpIndex = f.index
+			}
+			if cpIndex < index {
+				index = cpIndex
+			}
+		}
+	}
+	return index
+}
+
+func (p *pbSyncer) gc(now time.Time, retentionTime time.Duration) {
+	if !p.guard.enabled() {
+		p.binlogger.GCByTime(retentionTime)
+		return
+	}
+
+	index := p.guardIndex(now)
+	log.Info("GC binlog files kept by retention guard", zap.Uint64("min kept index", index))
+	p.binlogger.GCByTimeBeforeIndex(retentionTime, index)
+
+	p.guardMu.Lock()
+	for len(p.files) > 1 && p.files[0].index < index {
+		p.files = p.files[1:]
+	}
+	p.guardMu.Unlock()
+}
+
+// OnCheckpointSaved implements CheckpointListener, the files containing the
+// latest checkpoints are kept.
+func (p *pbSyncer) OnCheckpointSaved(ts int64) {
+	if p.guard.Checkpoints <= 0 {
+		return
+	}
+
+	p.guardMu.Lock()
+	p.checkpoints = append(p.checkpoints, ts)
+	if len(p.checkpoints) > p.guard.Checkpoints {
+		p.checkpoints = p.checkpoints[len(p.checkpoints)-p.guard.Checkpoints:]
+	}
+	p.guardMu.Unlock()
+}
+
 // SetSafeMode should be ignore by pbSyncer
 func (p *pbSyncer) SetSafeMode(mode bool) bool {
 	return false
 }
 
 func (p *pbSyncer) Sync(item *Item) error {
-	pbBinlog, err := translator.TiBinlogToPbBinlog(p.tableInfoGetter, item.Schema, item.Table, item.Binlog, item.PrewriteValue)
+	pbBinlog, err := translator.TiBinlogToPbBinlog(p.translatorContext(item))
 	if err != nil {
 		return errors.Trace(err)
 	}
 
+	if p.columnFilter != nil {
+		if err = translator.FilterPbBinlogColumns(pbBinlog, p.columnFilter); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
 	err = p.saveBinlog(pbBinlog)
 	if err != nil {
 		return errors.Trace(err)
@@ -98,8 +308,19 @@ func (p *pbSyncer) saveBinlog(binlog *pb.Binlog) error {
 		return errors.Trace(err)
 	}
 
-	_, err = p.binlogger.WriteTail(&tb.Entity{Payload: data})
-	return errors.Trace(err)
+	pos, err := p.binlogger.WriteTail(&tb.Entity{Payload: data})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if p.guard.Checkpoints > 0 {
+		p.guardMu.Lock()
+		if len(p.files) == 0 || p.files[len(p.files)-1].index != pos.Suffix {
+			p.files = append(p.files, pbFile{index: pos.Suffix, firstTS: binlog.CommitTs})
+		}
+		p.guardMu.Unlock()
+	}
+	return nil
 }
 
 func (p *pbSyncer) Close() error {
@@ -0,0 +1,102 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+)
+
+var _ = check.Suite(&pbSuite{})
+
+type pbSuite struct{}
+
+func binlogFileIndexes(c *check.C, dir string) []uint64 {
+	names, err := binlogfile.ReadBinlogNames(dir)
+	c.Assert(err, check.IsNil)
+	var indexes []uint64
+	for _, name := range names {
+		index, _, err := binlogfile.ParseBinlogName(name)
+		c.Assert(err, check.IsNil)
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
+
+func (s *pbSuite) TestRetentionGuardCheckpoints(c *check.C) {
+	// rotate after each binlog is written.
+	origSize := binlogfile.SegmentSizeBytes
+	binlogfile.SegmentSizeBytes = 1
+	defer func() {
+		binlogfile.SegmentSizeBytes = origSize
+	}()
+
+	dir := c.MkDir()
+	guard := PBRetentionGuard{Checkpoints: 2}
+	p, err := NewPBSyncer(dir, 0, guard, 0, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	for _, ts := range []int64{10, 20, 30, 40} {
+		c.Assert(p.saveBinlog(&pb.Binlog{CommitTs: ts}), check.IsNil)
+	}
+	c.Assert(binlogFileIndexes(c, dir), check.DeepEquals, []uint64{0, 1, 2, 3, 4})
+
+	// the file containing the oldest of the latest 2 checkpoints is 1.
+	for _, ts := range []int64{15, 25, 35} {
+		p.OnCheckpointSaved(ts)
+	}
+	c.Assert(p.guardIndex(time.Now()), check.Equals, uint64(1))
+	time.Sleep(10 * time.Millisecond)
+	p.gc(time.Now(), time.Millisecond)
+	c.Assert(binlogFileIndexes(c, dir), check.DeepEquals, []uint64{1, 2, 3, 4})
+	c.Assert(p.Close(), check.IsNil)
+
+	// the file containing the checkpoint is deleted.
+	_, err = NewPBSyncer(dir, 0, guard, 15, nil, nil, nil, nil)
+	c.Assert(err, check.ErrorMatches, "the binlog files before binlog-0000000000000001-.* are deleted, but the first binlog 20 in it is after the checkpoint 15")
+
+	p, err = NewPBSyncer(dir, 0, guard, 25, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.files, check.DeepEquals, []pbFile{{1, 20}, {2, 30}, {3, 40}})
+	c.Assert(p.Close(), check.IsNil)
+}
+
+func (s *pbSuite) TestRetentionGuardHours(c *check.C) {
+	dir := c.MkDir()
+	now := time.Now()
+	for i, ago := range []time.Duration{5 * time.Hour, 3 * time.Hour, time.Hour} {
+		name := fmt.Sprintf("binlog-%016d-%s", i+3, now.Add(-ago).Format("20060102150405"))
+		f, err := os.Create(path.Join(dir, name))
+		c.Assert(err, check.IsNil)
+		f.Close()
+	}
+
+	p, err := NewPBSyncer(dir, 0, PBRetentionGuard{Hours: 4}, 0, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	// the file created 5 hours ago covers the binlogs 4 hours ago.
+	c.Assert(p.guardIndex(now), check.Equals, uint64(3))
+	p.guard.Hours = 2
+	c.Assert(p.guardIndex(now), check.Equals, uint64(4))
+	p.gc(now, 0)
+	c.Assert(binlogFileIndexes(c, dir), check.DeepEquals, []uint64{4, 5})
+	c.Assert(p.Close(), check.IsNil)
+
+	_, err = NewPBSyncer(dir, 0, PBRetentionGuard{Hours: 4}, 0, nil, nil, nil, nil)
+	c.Assert(err, check.ErrorMatches, "the binlog files before binlog-0000000000000004-.* are deleted, but the binlogs after .* should be kept by retention-guard.hours 4")
+}
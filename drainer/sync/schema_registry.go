@@ -0,0 +1,342 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+	"go.uber.org/zap"
+)
+
+const (
+	// SchemaRegistryFailureStop stops the sync if a schema can't be registered.
+	SchemaRegistryFailureStop = "stop"
+	// SchemaRegistryFailureIgnore produces the messages without the schema ids if a schema can't be registered.
+	SchemaRegistryFailureIgnore = "ignore"
+
+	// schemaIDHeaderPrefix is the prefix of the message headers keeping the schema ids of the
+	// tables in the message, the key is followed by "<schema>.<table>".
+	schemaIDHeaderPrefix = "schema-id."
+
+	schemaRegistryContentType    = "application/vnd.schemaregistry.v1+json"
+	defaultSchemaRegistryTimeout = 10
+	schemaRegistryRetryCount     = 3
+)
+
+// schemaRegistryRetryInterval is changed in unit test.
+var schemaRegistryRetryInterval = time.Second
+
+var schemaRegistryCompatibilities = map[string]struct{}{
+	"NONE": {}, "BACKWARD": {}, "BACKWARD_TRANSITIVE": {}, "FORWARD": {},
+	"FORWARD_TRANSITIVE": {}, "FULL": {}, "FULL_TRANSITIVE": {},
+}
+
+// SchemaRegistryConfig is the config of registering the Avro schemas of the rows of the tables
+// to a Confluent compatible schema registry, the schema ids are kept in the message headers.
+type SchemaRegistryConfig struct {
+	// URL of the schema registry, registering is disabled if it's empty.
+	URL      string `toml:"url" json:"url"`
+	User     string `toml:"user" json:"user"`
+	Password string `toml:"password" json:"password"`
+	// Compatibility is set as the compatibility level of the subjects if it's not empty, like "BACKWARD".
+	Compatibility string `toml:"compatibility" json:"compatibility"`
+	// OnFailure is "stop" or "ignore", it's how the schemas failed to register are handled,
+	// like the incompatible schemas after a DDL.
+	OnFailure string `toml:"on-failure" json:"on-failure"`
+	// Timeout is the timeout in seconds of a request to the schema registry.
+	Timeout int `toml:"timeout" json:"timeout"`
+}
+
+func (c *SchemaRegistryConfig) enabled() bool {
+	return len(c.URL) > 0
+}
+
+// Validate checks the config and fills the default values, it's valid if registering is disabled.
+func (c *SchemaRegistryConfig) Validate() error {
+	if !c.enabled() {
+		return nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return errors.Errorf("invalid url of schema-registry %s, it should be like http://host:port", c.URL)
+	}
+	c.Compatibility = strings.ToUpper(c.Compatibility)
+	if _, ok := schemaRegistryCompatibilities[c.Compatibility]; len(c.Compatibility) > 0 && !ok {
+		return errors.Errorf("invalid compatibility of schema-registry %s", c.Compatibility)
+	}
+	util.AdjustString(&c.OnFailure, SchemaRegistryFailureStop)
+	if c.OnFailure != SchemaRegistryFailureStop && c.OnFailure != SchemaRegistryFailureIgnore {
+		return errors.Errorf("invalid on-failure of schema-registry %s, it should be stop or ignore", c.OnFailure)
+	}
+	util.AdjustInt(&c.Timeout, defaultSchemaRegistryTimeout)
+	return nil
+}
+
+// registeredSchema is the Avro schema of a table registered and its id, the id is 0 if
+// it failed to register with on-failure "ignore".
+type registeredSchema struct {
+	schema string
+	id     int
+}
+
+// schemaRegistry registers the Avro schemas of the tables when they're produced the first time
+// or changed by DDLs, the subject of a table is "<topic>-<schema>.<table>-value".
+type schemaRegistry struct {
+	cfg    *SchemaRegistryConfig
+	topic  string
+	client *http.Client
+
+	mu         sync.Mutex
+	registered map[filter.TableName]registeredSchema
+	// configured are the subjects whose compatibility levels are set.
+	configured map[string]struct{}
+}
+
+func newSchemaRegistry(cfg *SchemaRegistryConfig, topic string) *schemaRegistry {
+	return &schemaRegistry{
+		cfg:        cfg,
+		topic:      topic,
+		client:     &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		registered: make(map[filter.TableName]registeredSchema),
+		configured: make(map[string]struct{}),
+	}
+}
+
+// headers returns the message headers keeping the schema ids of the tables in the binlog, the
+// schemas of the tables are registered if they're new or changed.
+func (r *schemaRegistry) headers(binlog *obinlog.Binlog) ([]sarama.RecordHeader, error) {
+	if binlog.Type == obinlog.BinlogType_DDL {
+		r.forget(binlog.GetDdlData().GetSchemaName(), binlog.GetDdlData().GetTableName())
+		return nil, nil
+	}
+
+	var headers []sarama.RecordHeader
+	for _, table := range binlog.GetDmlData().GetTables() {
+		name := filter.TableName{Schema: table.GetSchemaName(), Table: table.GetTableName()}
+		schema := tableAvroSchema(table)
+		id, err := r.register(name, schema)
+		if err != nil {
+			if r.cfg.OnFailure == SchemaRegistryFailureStop {
+				return nil, errors.Annotatef(err, "register the schema of %s.%s", name.Schema, name.Table)
+			}
+			log.Warn("register the schema failed, produce the messages without its id until it's changed",
+				zap.String("schema", name.Schema), zap.String("table", name.Table), zap.Error(err))
+			r.mu.Lock()
+			r.registered[name] = registeredSchema{schema: schema}
+			r.mu.Unlock()
+			continue
+		}
+		if id == 0 {
+			// it failed to register.
+			continue
+		}
+		headers = append(headers, sarama.RecordHeader{
+			Key:   []byte(schemaIDHeaderPrefix + name.Schema + "." + name.Table),
+			Value: []byte(strconv.Itoa(id)),
+		})
+	}
+	return headers, nil
+}
+
+// forget drops the registered schemas of the table changed by a DDL, or all the tables of the
+// schema if table is empty, they're registered again when produced the next time.
+func (r *schemaRegistry) forget(schema string, table string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name := range r.registered {
+		if strings.EqualFold(name.Schema, schema) && (len(table) == 0 || strings.EqualFold(name.Table, table)) {
+			delete(r.registered, name)
+		}
+	}
+}
+
+// register registers the schema of the table if it's changed, and returns its id. Registering
+// the same schema again returns the same id, so it's safe after drainer restarts.
+func (r *schemaRegistry) register(name filter.TableName, schema string) (int, error) {
+	r.mu.Lock()
+	registered, ok := r.registered[name]
+	r.mu.Unlock()
+	if ok && registered.schema == schema {
+		return registered.id, nil
+	}
+
+	subject := fmt.Sprintf("%s-%s.%s-value", r.topic, name.Schema, name.Table)
+	var id int
+	var err error
+	for i := 0; i < schemaRegistryRetryCount; i++ {
+		if i > 0 {
+			time.Sleep(schemaRegistryRetryInterval)
+		}
+		// retrying doesn't help if the schema is incompatible or invalid.
+		if id, err = r.registerSubject(subject, schema); err == nil || isSchemaRegistryClientErr(err) {
+			break
+		}
+		log.Warn("register the schema failed, retry later", zap.String("subject", subject), zap.Error(err))
+	}
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	r.mu.Lock()
+	r.registered[name] = registeredSchema{schema: schema, id: id}
+	r.mu.Unlock()
+	log.Info("register the schema", zap.String("subject", subject), zap.Int("id", id))
+	return id, nil
+}
+
+func (r *schemaRegistry) registerSubject(subject string, schema string) (int, error) {
+	r.mu.Lock()
+	_, configured := r.configured[subject]
+	r.mu.Unlock()
+	if !configured && len(r.cfg.Compatibility) > 0 {
+		req := map[string]string{"compatibility": r.cfg.Compatibility}
+		if err := r.request(http.MethodPut, "/config/"+url.PathEscape(subject), req, nil); err != nil {
+			return 0, errors.Annotatef(err, "set the compatibility of subject %s", subject)
+		}
+		r.mu.Lock()
+		r.configured[subject] = struct{}{}
+		r.mu.Unlock()
+	}
+
+	var resp struct {
+		ID int `json:"id"`
+	}
+	req := map[string]string{"schema": schema}
+	if err := r.request(http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", req, &resp); err != nil {
+		return 0, errors.Annotatef(err, "register subject %s", subject)
+	}
+	return resp.ID, nil
+}
+
+// schemaRegistryError is the error responded by the schema registry.
+type schemaRegistryError struct {
+	status    int
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+func (e *schemaRegistryError) Error() string {
+	return fmt.Sprintf("schema registry responds %d, error code %d: %s", e.status, e.ErrorCode, e.Message)
+}
+
+// isSchemaRegistryClientErr returns whether the request is rejected by the schema registry,
+// like 409 of the incompatible schema and 422 of the invalid schema.
+func isSchemaRegistryClientErr(err error) bool {
+	rerr, ok := errors.Cause(err).(*schemaRegistryError)
+	return ok && rerr.status >= 400 && rerr.status < 500
+}
+
+func (r *schemaRegistry) request(method string, path string, req interface{}, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	httpReq, err := http.NewRequest(method, strings.TrimRight(r.cfg.URL, "/")+path, strings.NewReader(string(body)))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	httpReq.Header.Set("Content-Type", schemaRegistryContentType)
+	httpReq.Header.Set("Accept", schemaRegistryContentType)
+	if len(r.cfg.User) > 0 {
+		httpReq.SetBasicAuth(r.cfg.User, r.cfg.Password)
+	}
+
+	httpResp, err := r.client.Do(httpReq)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer httpResp.Body.Close()
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		rerr := &schemaRegistryError{status: httpResp.StatusCode}
+		if json.Unmarshal(data, rerr) != nil {
+			rerr.Message = string(data)
+		}
+		return errors.Trace(rerr)
+	}
+	if resp == nil {
+		return nil
+	}
+	return errors.Annotatef(json.Unmarshal(data, resp), "invalid response %s", data)
+}
+
+// tableAvroSchema returns the Avro record schema of the rows of the table, every field is
+// nullable with the default null, so adding or dropping a column is a compatible change.
+func tableAvroSchema(table *obinlog.Table) string {
+	type field struct {
+		Name    string        `json:"name"`
+		Type    []interface{} `json:"type"`
+		Default interface{}   `json:"default"`
+	}
+	fields := make([]field, 0, len(table.GetColumnInfo()))
+	for _, col := range table.GetColumnInfo() {
+		var tp string
+		switch col.GetMysqlType() {
+		case "int", "bigint", "smallint", "tinyint", "mediumint", "enum", "set":
+			tp = "long"
+		case "float", "double":
+			tp = "double"
+		case "bit", "blob", "longblob", "mediumblob", "binary", "tinyblob", "varbinary", "json":
+			tp = "bytes"
+		default:
+			// the decimal and time types are kept as strings in the binlogs.
+			tp = "string"
+		}
+		fields = append(fields, field{Name: avroName(col.GetName()), Type: []interface{}{"null", tp}})
+	}
+	schema := map[string]interface{}{
+		"type":      "record",
+		"name":      avroName(table.GetTableName()),
+		"namespace": avroName(table.GetSchemaName()),
+		"fields":    fields,
+	}
+	data, _ := json.Marshal(schema)
+	return string(data)
+}
+
+// avroName replaces the characters not allowed in the Avro names with "_".
+func avroName(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			b.WriteRune(c)
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
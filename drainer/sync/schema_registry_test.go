@@ -0,0 +1,185 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/gogo/protobuf/proto"
+	"github.com/pingcap/check"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+)
+
+type schemaRegistrySuite struct{}
+
+var _ = check.Suite(&schemaRegistrySuite{})
+
+// fakeSchemaRegistry registers the schemas like the schema registry, the schemas containing
+// reject are incompatible, and the requests fail with 500 if fail is set.
+type fakeSchemaRegistry struct {
+	schemas        []string
+	compatibility  map[string]string
+	registerCalled int
+	fail           bool
+}
+
+func (r *fakeSchemaRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var body map[string]string
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch {
+	case req.Method == http.MethodPut && strings.HasPrefix(req.URL.Path, "/config/"):
+		r.compatibility[strings.TrimPrefix(req.URL.Path, "/config/")] = body["compatibility"]
+		_ = json.NewEncoder(w).Encode(body)
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/versions"):
+		r.registerCalled++
+		if strings.Contains(body["schema"], "reject") {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"error_code":409,"message":"Schema being registered is incompatible with an earlier schema"}`))
+			return
+		}
+		id := len(r.schemas) + 1
+		for i, schema := range r.schemas {
+			if schema == body["schema"] {
+				id = i + 1
+			}
+		}
+		if id > len(r.schemas) {
+			r.schemas = append(r.schemas, body["schema"])
+		}
+		_ = json.NewEncoder(w).Encode(map[string]int{"id": id})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *schemaRegistrySuite) newRegistry(c *check.C, onFailure string) (*schemaRegistry, *fakeSchemaRegistry, func()) {
+	fake := &fakeSchemaRegistry{compatibility: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	cfg := &SchemaRegistryConfig{URL: server.URL, Compatibility: "backward", OnFailure: onFailure}
+	c.Assert(cfg.Validate(), check.IsNil)
+	oldInterval := schemaRegistryRetryInterval
+	schemaRegistryRetryInterval = time.Millisecond
+	return newSchemaRegistry(cfg, "test"), fake, func() {
+		server.Close()
+		schemaRegistryRetryInterval = oldInterval
+	}
+}
+
+func dmlBinlog(tables ...*obinlog.Table) *obinlog.Binlog {
+	return &obinlog.Binlog{Type: obinlog.BinlogType_DML, DmlData: &obinlog.DMLData{Tables: tables}}
+}
+
+func avroTestTable(schema string, name string, columns ...string) *obinlog.Table {
+	t := &obinlog.Table{SchemaName: proto.String(schema), TableName: proto.String(name)}
+	for _, col := range columns {
+		t.ColumnInfo = append(t.ColumnInfo, &obinlog.ColumnInfo{Name: col, MysqlType: "int"})
+	}
+	return t
+}
+
+func (s *schemaRegistrySuite) TestHeaders(c *check.C) {
+	r, fake, clean := s.newRegistry(c, "")
+	defer clean()
+
+	headers, err := r.headers(dmlBinlog(avroTestTable("db", "t1", "a"), avroTestTable("db", "t2", "a")))
+	c.Assert(err, check.IsNil)
+	c.Assert(headers, check.DeepEquals, []sarama.RecordHeader{
+		{Key: []byte("schema-id.db.t1"), Value: []byte("1")},
+		{Key: []byte("schema-id.db.t2"), Value: []byte("2")},
+	})
+	c.Assert(fake.compatibility, check.DeepEquals, map[string]string{"test-db.t1-value": "BACKWARD", "test-db.t2-value": "BACKWARD"})
+
+	// the registered schemas are cached.
+	headers, err = r.headers(dmlBinlog(avroTestTable("db", "t1", "a")))
+	c.Assert(err, check.IsNil)
+	c.Assert(headers, check.DeepEquals, []sarama.RecordHeader{{Key: []byte("schema-id.db.t1"), Value: []byte("1")}})
+	c.Assert(fake.registerCalled, check.Equals, 2)
+
+	// the schema evolved by a DDL is registered.
+	headers, err = r.headers(&obinlog.Binlog{Type: obinlog.BinlogType_DDL, DdlData: &obinlog.DDLData{SchemaName: proto.String("db"), TableName: proto.String("t1")}})
+	c.Assert(err, check.IsNil)
+	c.Assert(headers, check.HasLen, 0)
+	c.Assert(r.registered, check.HasLen, 1)
+	headers, err = r.headers(dmlBinlog(avroTestTable("db", "t1", "a", "b")))
+	c.Assert(err, check.IsNil)
+	c.Assert(headers, check.DeepEquals, []sarama.RecordHeader{{Key: []byte("schema-id.db.t1"), Value: []byte("3")}})
+
+	// the incompatible schema isn't retried.
+	_, err = r.headers(dmlBinlog(avroTestTable("db", "t1", "reject")))
+	c.Assert(err, check.ErrorMatches, ".*register the schema of db.t1.*incompatible.*")
+	c.Assert(fake.registerCalled, check.Equals, 4)
+
+	fake.fail = true
+	_, err = r.headers(dmlBinlog(avroTestTable("db", "t3", "a")))
+	c.Assert(err, check.ErrorMatches, ".*schema registry responds 500.*")
+	c.Assert(fake.registerCalled, check.Equals, 4)
+}
+
+func (s *schemaRegistrySuite) TestIgnoreFailure(c *check.C) {
+	r, fake, clean := s.newRegistry(c, SchemaRegistryFailureIgnore)
+	defer clean()
+
+	headers, err := r.headers(dmlBinlog(avroTestTable("db", "t1", "reject"), avroTestTable("db", "t2", "a")))
+	c.Assert(err, check.IsNil)
+	c.Assert(headers, check.DeepEquals, []sarama.RecordHeader{{Key: []byte("schema-id.db.t2"), Value: []byte("1")}})
+
+	// it's not registered again until the schema is changed.
+	headers, err = r.headers(dmlBinlog(avroTestTable("db", "t1", "reject")))
+	c.Assert(err, check.IsNil)
+	c.Assert(headers, check.HasLen, 0)
+	c.Assert(fake.registerCalled, check.Equals, 2)
+}
+
+func (s *schemaRegistrySuite) TestTableAvroSchema(c *check.C) {
+	t := &obinlog.Table{SchemaName: proto.String("test-db"), TableName: proto.String("1t"), ColumnInfo: []*obinlog.ColumnInfo{
+		{Name: "id", MysqlType: "bigint"},
+		{Name: "price", MysqlType: "decimal"},
+		{Name: "a b", MysqlType: "blob"},
+	}}
+	c.Assert(tableAvroSchema(t), check.Equals, `{"fields":[`+
+		`{"name":"id","type":["null","long"],"default":null},`+
+		`{"name":"price","type":["null","string"],"default":null},`+
+		`{"name":"a_b","type":["null","bytes"],"default":null}],`+
+		`"name":"_1t","namespace":"test_db","type":"record"}`)
+}
+
+func (s *schemaRegistrySuite) TestValidate(c *check.C) {
+	cfg := &SchemaRegistryConfig{}
+	c.Assert(cfg.Validate(), check.IsNil)
+
+	cfg.URL = "registry:8081"
+	c.Assert(cfg.Validate(), check.ErrorMatches, ".*invalid url of schema-registry.*")
+	cfg.URL = "http://registry:8081"
+	cfg.Compatibility = "strict"
+	c.Assert(cfg.Validate(), check.ErrorMatches, "invalid compatibility of schema-registry STRICT")
+	cfg.Compatibility = ""
+	cfg.OnFailure = "skip"
+	c.Assert(cfg.Validate(), check.ErrorMatches, "invalid on-failure of schema-registry skip.*")
+	cfg.OnFailure = ""
+	c.Assert(cfg.Validate(), check.IsNil)
+	c.Assert(cfg.OnFailure, check.Equals, SchemaRegistryFailureStop)
+	c.Assert(cfg.Timeout, check.Equals, defaultSchemaRegistryTimeout)
+}
@@ -0,0 +1,257 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/retry"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+	"go.uber.org/zap"
+)
+
+// The formats of the binlogs published to the streaming services.
+const (
+	StreamFormatPB   = "pb"
+	StreamFormatJSON = "json"
+)
+
+const (
+	defaultStreamKeyCount = 1
+	// streamQueueSize is the max number of the binlogs waiting to be published.
+	streamQueueSize = 1024
+)
+
+// streamPublishPolicy retries publishing the messages of a binlog for about 30 seconds,
+// the same as maxWaitTimeToSendMSG of kafka.
+var streamPublishPolicy = retry.Policy{MaxAttempts: 10, Backoff: 500, MaxBackoff: 5000, Multiplier: 2}
+
+// StreamConfig is the config of the binlogs published to the streaming services like
+// Google Cloud Pub/Sub and AWS Kinesis.
+type StreamConfig struct {
+	// Format is "pb" to publish the secondary binlogs in protobuf like kafka, or "json".
+	Format string `toml:"format" json:"format"`
+	// KeyCount is the number of the ordering keys the rows are published with, the rows are
+	// assigned to the keys by the hash of their partition-key-rule columns or primary keys,
+	// and the messages of a key are delivered in order. The DDLs are published with all keys.
+	KeyCount int `toml:"key-count" json:"key-count"`
+}
+
+func (c *StreamConfig) adjust() {
+	if len(c.Format) == 0 {
+		c.Format = StreamFormatPB
+	}
+	if c.KeyCount == 0 {
+		c.KeyCount = defaultStreamKeyCount
+	}
+}
+
+// Validate checks whether the config is valid.
+func (c *StreamConfig) Validate() error {
+	switch c.Format {
+	case "", StreamFormatPB, StreamFormatJSON:
+	default:
+		return errors.Errorf("invalid format of stream: %s, must be one of pb, json", c.Format)
+	}
+	if c.KeyCount < 0 {
+		return errors.Errorf("invalid key-count of stream: %d", c.KeyCount)
+	}
+	return nil
+}
+
+// streamMessage is the message of a part of a binlog published with the ordering key.
+type streamMessage struct {
+	key  string
+	data []byte
+}
+
+// streamPublisher publishes the messages to a streaming service.
+type streamPublisher interface {
+	// publish publishes the messages of a binlog, their keys are distinct. The messages failed
+	// to publish are returned with the error to be published again, so the messages of a key
+	// are still in order.
+	publish(ctx context.Context, msgs []streamMessage) ([]streamMessage, error)
+	close() error
+}
+
+var _ Syncer = &StreamSyncer{}
+
+// StreamSyncer publishes the binlogs to a streaming service in the order of commit ts, the
+// binlogs are published one by one, and the item is successful after all its messages are
+// published. The checkpoint is saved to file like kafka.
+type StreamSyncer struct {
+	name        string
+	publisher   streamPublisher
+	format      string
+	partitioner binlogPartitioner
+
+	queue  chan *streamItem
+	ctx    context.Context
+	cancel context.CancelFunc
+	*baseSyncer
+}
+
+type streamItem struct {
+	item *Item
+	msgs []streamMessage
+}
+
+// NewPubSub returns a StreamSyncer publishing the binlogs to Google Cloud Pub/Sub.
+func NewPubSub(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter, columnFilter *filter.ColumnFilter) (*StreamSyncer, error) {
+	publisher, err := newPubSubPublisher(&cfg.PubSub)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return newStreamSyncer("pubsub", publisher, cfg, tableInfoGetter, columnFilter)
+}
+
+// NewKinesis returns a StreamSyncer publishing the binlogs to AWS Kinesis.
+func NewKinesis(cfg *DBConfig, tableInfoGetter translator.TableInfoGetter, columnFilter *filter.ColumnFilter) (*StreamSyncer, error) {
+	publisher, err := newKinesisPublisher(&cfg.Kinesis)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return newStreamSyncer("kinesis", publisher, cfg, tableInfoGetter, columnFilter)
+}
+
+func newStreamSyncer(name string, publisher streamPublisher, cfg *DBConfig, tableInfoGetter translator.TableInfoGetter, columnFilter *filter.ColumnFilter) (*StreamSyncer, error) {
+	partitionKeyRules, err := newPartitionKeyRules(cfg.PartitionKeyRules)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	generatedColumnRules, err := newGeneratedColumnRules(cfg.GeneratedColumnRules)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	cfg.Stream.adjust()
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &StreamSyncer{
+		name:      name,
+		publisher: publisher,
+		format:    cfg.Stream.Format,
+		partitioner: binlogPartitioner{
+			rules: partitionKeyRules,
+			count: int32(cfg.Stream.KeyCount),
+		},
+		queue:      make(chan *streamItem, streamQueueSize),
+		ctx:        ctx,
+		cancel:     cancel,
+		baseSyncer: newBaseSyncer(tableInfoGetter, columnFilter),
+	}
+	s.generatedColumnRules = generatedColumnRules
+	s.charsets = cfg.Charsets
+	log.Info("publish the binlogs to the stream", zap.String("stream", name),
+		zap.String("format", s.format), zap.Int32("keys", s.partitioner.count))
+
+	go s.run()
+	return s, nil
+}
+
+// SetSafeMode should be ignore by StreamSyncer
+func (s *StreamSyncer) SetSafeMode(mode bool) bool {
+	return false
+}
+
+// Sync implements Syncer interface
+func (s *StreamSyncer) Sync(item *Item) error {
+	secondaryBinlog, err := translator.TiBinlogToSecondaryBinlog(s.translatorContext(item))
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	binlogs := []partitionBinlog{{partition: 0, binlog: secondaryBinlog}}
+	if s.partitioner.count > 1 {
+		// split before filtering the columns, the key columns may be filtered out.
+		binlogs, err = s.partitioner.splitByPartition(secondaryBinlog)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	msgs := make([]streamMessage, 0, len(binlogs))
+	for _, b := range binlogs {
+		if s.columnFilter != nil {
+			translator.FilterSecondaryBinlogColumns(b.binlog, s.columnFilter)
+		}
+		data, err := s.encode(b.binlog)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		msgs = append(msgs, streamMessage{key: strconv.Itoa(int(b.partition)), data: data})
+	}
+
+	select {
+	case s.queue <- &streamItem{item: item, msgs: msgs}:
+		return nil
+	case <-s.errCh:
+		return errors.Trace(s.err)
+	}
+}
+
+func (s *StreamSyncer) encode(binlog *obinlog.Binlog) ([]byte, error) {
+	if s.format == StreamFormatJSON {
+		data, err := (&jsonpb.Marshaler{}).MarshalToString(binlog)
+		return []byte(data), errors.Trace(err)
+	}
+	data, err := binlog.Marshal()
+	return data, errors.Trace(err)
+}
+
+// Close implements Syncer interface
+func (s *StreamSyncer) Close() error {
+	close(s.queue)
+	err := <-s.Error()
+	return err
+}
+
+// publish publishes the messages of the binlog, the failed ones are retried by streamPublishPolicy.
+func (s *StreamSyncer) publish(msgs []streamMessage) error {
+	err := streamPublishPolicy.Do(s.ctx, func(ctx context.Context) error {
+		failed, err := s.publisher.publish(ctx, msgs)
+		if err != nil {
+			log.Warn("publish the binlog failed, retry later", zap.String("stream", s.name),
+				zap.Int("messages", len(msgs)), zap.Int("failed", len(failed)), zap.Error(err))
+			msgs = failed
+		}
+		return err
+	})
+	return errors.Annotatef(err, "fail to publish the binlog to %s, check if it is up and working", s.name)
+}
+
+func (s *StreamSyncer) run() {
+	defer close(s.success)
+
+	for si := range s.queue {
+		if err := s.publish(si.msgs); err != nil {
+			s.setErr(err)
+			s.cancel()
+			s.publisher.close()
+			// drain the queue so Sync isn't blocked before Close.
+			for range s.queue {
+			}
+			return
+		}
+		s.success <- si.item
+	}
+
+	s.cancel()
+	s.setErr(s.publisher.close())
+}
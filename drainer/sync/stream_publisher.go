@@ -0,0 +1,166 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	pubsub "cloud.google.com/go/pubsub/apiv1"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/pingcap/errors"
+	"google.golang.org/api/option"
+	pubsubpb "google.golang.org/genproto/googleapis/pubsub/v1"
+)
+
+// PubSubConfig is the topic of Google Cloud Pub/Sub, the message ordering must be enabled on
+// the subscriptions to receive the messages of an ordering key in order.
+type PubSubConfig struct {
+	Project string `toml:"project" json:"project"`
+	Topic   string `toml:"topic" json:"topic"`
+	// CredentialsFile is the service account key file, the application default credentials
+	// are used if it's empty.
+	CredentialsFile string `toml:"credentials-file" json:"credentials-file"`
+	// Endpoint overrides the endpoint of Pub/Sub, like a regional endpoint "us-east1-pubsub.googleapis.com:443",
+	// the messages with ordering keys are only in order when published to the same region.
+	Endpoint string `toml:"endpoint" json:"endpoint"`
+}
+
+// Validate checks whether the config is valid.
+func (c *PubSubConfig) Validate() error {
+	if len(c.Project) == 0 || len(c.Topic) == 0 {
+		return errors.New("project and topic of pubsub must be set")
+	}
+	return nil
+}
+
+// KinesisConfig is the stream of AWS Kinesis, the credentials are loaded by the default
+// credential chain of AWS SDK, like the environment variables and the shared credentials file.
+type KinesisConfig struct {
+	Region string `toml:"region" json:"region"`
+	Stream string `toml:"stream" json:"stream"`
+	// Endpoint overrides the endpoint of Kinesis, like a VPC endpoint.
+	Endpoint string `toml:"endpoint" json:"endpoint"`
+}
+
+// Validate checks whether the config is valid.
+func (c *KinesisConfig) Validate() error {
+	if len(c.Stream) == 0 {
+		return errors.New("stream of kinesis must be set")
+	}
+	return nil
+}
+
+type pubSubPublisher struct {
+	client *pubsub.PublisherClient
+	topic  string
+}
+
+func newPubSubPublisher(cfg *PubSubConfig) (*pubSubPublisher, error) {
+	var opts []option.ClientOption
+	if len(cfg.CredentialsFile) > 0 {
+		opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+	if len(cfg.Endpoint) > 0 {
+		opts = append(opts, option.WithEndpoint(cfg.Endpoint))
+	}
+	client, err := pubsub.NewPublisherClient(context.Background(), opts...)
+	if err != nil {
+		return nil, errors.Annotate(err, "create pubsub client failed")
+	}
+	return &pubSubPublisher{
+		client: client,
+		topic:  fmt.Sprintf("projects/%s/topics/%s", cfg.Project, cfg.Topic),
+	}, nil
+}
+
+// publish publishes the messages in one request, either all or none of them are published.
+func (p *pubSubPublisher) publish(ctx context.Context, msgs []streamMessage) ([]streamMessage, error) {
+	req := &pubsubpb.PublishRequest{
+		Topic:    p.topic,
+		Messages: make([]*pubsubpb.PubsubMessage, 0, len(msgs)),
+	}
+	for _, msg := range msgs {
+		req.Messages = append(req.Messages, &pubsubpb.PubsubMessage{Data: msg.data, OrderingKey: msg.key})
+	}
+	if _, err := p.client.Publish(ctx, req); err != nil {
+		return msgs, errors.Trace(err)
+	}
+	return nil, nil
+}
+
+func (p *pubSubPublisher) close() error {
+	return errors.Trace(p.client.Close())
+}
+
+type kinesisPublisher struct {
+	client *kinesis.Kinesis
+	stream string
+}
+
+func newKinesisPublisher(cfg *KinesisConfig) (*kinesisPublisher, error) {
+	config := aws.NewConfig()
+	if len(cfg.Region) > 0 {
+		config = config.WithRegion(cfg.Region)
+	}
+	if len(cfg.Endpoint) > 0 {
+		config = config.WithEndpoint(cfg.Endpoint)
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, errors.Annotate(err, "create aws session failed")
+	}
+	return &kinesisPublisher{
+		client: kinesis.New(sess),
+		stream: cfg.Stream,
+	}, nil
+}
+
+// publish puts the messages as records with the keys as partition keys, the records of a key
+// are put to one shard in order. The records failed are returned in order to be put again.
+func (p *kinesisPublisher) publish(ctx context.Context, msgs []streamMessage) ([]streamMessage, error) {
+	input := &kinesis.PutRecordsInput{
+		StreamName: aws.String(p.stream),
+		Records:    make([]*kinesis.PutRecordsRequestEntry, 0, len(msgs)),
+	}
+	for _, msg := range msgs {
+		input.Records = append(input.Records, &kinesis.PutRecordsRequestEntry{
+			Data:         msg.data,
+			PartitionKey: aws.String(msg.key),
+		})
+	}
+	output, err := p.client.PutRecordsWithContext(ctx, input)
+	if err != nil {
+		return msgs, errors.Trace(err)
+	}
+	if aws.Int64Value(output.FailedRecordCount) == 0 {
+		return nil, nil
+	}
+
+	var failed []streamMessage
+	var lastErr string
+	for i, record := range output.Records {
+		if record.ErrorCode != nil {
+			failed = append(failed, msgs[i])
+			lastErr = fmt.Sprintf("%s: %s", aws.StringValue(record.ErrorCode), aws.StringValue(record.ErrorMessage))
+		}
+	}
+	return failed, errors.Errorf("%d records failed to put, last error: %s", len(failed), lastErr)
+}
+
+func (p *kinesisPublisher) close() error {
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/retry"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+)
+
+type streamSuite struct{}
+
+var _ = check.Suite(&streamSuite{})
+
+// mockPublisher records the messages published, the first failures calls fail with the
+// messages of the keys in failKeys.
+type mockPublisher struct {
+	sync.Mutex
+	published [][]streamMessage
+	failures  int
+	failKeys  map[string]bool
+	closed    bool
+}
+
+func (p *mockPublisher) publish(ctx context.Context, msgs []streamMessage) ([]streamMessage, error) {
+	p.Lock()
+	defer p.Unlock()
+	p.published = append(p.published, msgs)
+	if p.failures == 0 {
+		return nil, nil
+	}
+	p.failures--
+	var failed []streamMessage
+	for _, msg := range msgs {
+		if p.failKeys[msg.key] {
+			failed = append(failed, msg)
+		}
+	}
+	return failed, errors.New("throttled")
+}
+
+func (p *mockPublisher) close() error {
+	p.Lock()
+	defer p.Unlock()
+	p.closed = true
+	return nil
+}
+
+func (s *streamSuite) newSyncer(publisher *mockPublisher, stream StreamConfig) *StreamSyncer {
+	syncer, err := newStreamSyncer("mock", publisher, &DBConfig{Stream: stream}, nil, nil)
+	if err != nil {
+		panic(err)
+	}
+	return syncer
+}
+
+func ddlItem() *Item {
+	gen := translator.BinlogGenerator{}
+	gen.SetDDL()
+	return &Item{Binlog: gen.TiBinlog, PrewriteValue: gen.PV, Schema: gen.Schema, Table: gen.Table}
+}
+
+func waitSuccess(c *check.C, syncer Syncer, item *Item) {
+	select {
+	case success := <-syncer.Successes():
+		c.Assert(success, check.Equals, item)
+	case <-time.After(5 * time.Second):
+		c.Fatal("binlog not published")
+	}
+}
+
+func (s *streamSuite) TestPublishWithKeys(c *check.C) {
+	publisher := &mockPublisher{}
+	syncer := s.newSyncer(publisher, StreamConfig{KeyCount: 3})
+
+	item := ddlItem()
+	c.Assert(syncer.Sync(item), check.IsNil)
+	waitSuccess(c, syncer, item)
+	c.Assert(syncer.Close(), check.IsNil)
+
+	// the DDL is published with all keys.
+	c.Assert(publisher.published, check.HasLen, 1)
+	msgs := publisher.published[0]
+	c.Assert(msgs, check.HasLen, 3)
+	for i, key := range []string{"0", "1", "2"} {
+		c.Assert(msgs[i].key, check.Equals, key)
+		binlog := new(obinlog.Binlog)
+		c.Assert(binlog.Unmarshal(msgs[i].data), check.IsNil)
+		c.Assert(binlog.Type, check.Equals, obinlog.BinlogType_DDL)
+		c.Assert(binlog.CommitTs, check.Equals, item.Binlog.CommitTs)
+	}
+	c.Assert(publisher.closed, check.IsTrue)
+}
+
+func (s *streamSuite) TestPublishJSON(c *check.C) {
+	publisher := &mockPublisher{}
+	syncer := s.newSyncer(publisher, StreamConfig{Format: StreamFormatJSON})
+
+	item := ddlItem()
+	c.Assert(syncer.Sync(item), check.IsNil)
+	waitSuccess(c, syncer, item)
+	c.Assert(syncer.Close(), check.IsNil)
+
+	c.Assert(publisher.published, check.HasLen, 1)
+	msgs := publisher.published[0]
+	c.Assert(msgs, check.HasLen, 1)
+	c.Assert(msgs[0].key, check.Equals, "0")
+	var binlog map[string]interface{}
+	c.Assert(json.Unmarshal(msgs[0].data, &binlog), check.IsNil)
+	c.Assert(binlog["type"], check.Equals, "DDL")
+}
+
+func (s *streamSuite) TestRetryFailedMessages(c *check.C) {
+	oldPolicy := streamPublishPolicy
+	defer func() { streamPublishPolicy = oldPolicy }()
+	streamPublishPolicy = retry.Policy{MaxAttempts: 3, Backoff: 1}
+
+	publisher := &mockPublisher{failures: 1, failKeys: map[string]bool{"1": true}}
+	syncer := s.newSyncer(publisher, StreamConfig{KeyCount: 2})
+
+	item := ddlItem()
+	c.Assert(syncer.Sync(item), check.IsNil)
+	waitSuccess(c, syncer, item)
+	c.Assert(syncer.Close(), check.IsNil)
+
+	// only the failed message is published again.
+	c.Assert(publisher.published, check.HasLen, 2)
+	c.Assert(publisher.published[0], check.HasLen, 2)
+	c.Assert(publisher.published[1], check.HasLen, 1)
+	c.Assert(publisher.published[1][0].key, check.Equals, "1")
+
+	// fail after the retries are exhausted.
+	publisher = &mockPublisher{failures: 3, failKeys: map[string]bool{"0": true}}
+	syncer = s.newSyncer(publisher, StreamConfig{})
+	c.Assert(syncer.Sync(ddlItem()), check.IsNil)
+	c.Assert(syncer.Close(), check.ErrorMatches, "fail to publish the binlog to mock.*throttled")
+	c.Assert(publisher.published, check.HasLen, 3)
+	c.Assert(publisher.closed, check.IsTrue)
+}
+
+func (s *streamSuite) TestValidate(c *check.C) {
+	c.Assert((&StreamConfig{}).Validate(), check.IsNil)
+	c.Assert((&StreamConfig{Format: "avro"}).Validate(), check.ErrorMatches, "invalid format of stream.*")
+	c.Assert((&StreamConfig{KeyCount: -1}).Validate(), check.ErrorMatches, "invalid key-count.*")
+	c.Assert((&PubSubConfig{Project: "p"}).Validate(), check.NotNil)
+	c.Assert((&PubSubConfig{Project: "p", Topic: "t"}).Validate(), check.IsNil)
+	c.Assert((&KinesisConfig{}).Validate(), check.NotNil)
+}
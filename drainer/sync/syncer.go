@@ -16,7 +16,9 @@ package sync
 import (
 	"fmt"
 
+	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
 	pb "github.com/pingcap/tipb/go-binlog"
 )
 
@@ -26,7 +28,9 @@ type Item struct {
 	PrewriteValue *pb.PrewriteValue // only for DML
 	Schema        string
 	Table         string
-	RelayLogPos   pb.Pos
+	// TableID is the id of the table changed by a DDL, 0 if the DDL isn't on a table.
+	TableID     int64
+	RelayLogPos pb.Pos
 
 	// Each item has a schemaVersion. with amend txn feature the prewrite DML's SchemaVersion could change.
 	// which makes restart & reload history DDL with previous SchemaVersion not reliable.
@@ -45,6 +49,13 @@ func (i *Item) String() string {
 	return fmt.Sprintf("commit ts: %v", i.Binlog.CommitTs)
 }
 
+// translatorContext returns the context to translate the item by the table infos of infoGetter.
+func (i *Item) translatorContext(infoGetter translator.TableInfoGetter) *translator.Context {
+	ctx := translator.NewContext(infoGetter, i.Binlog, i.PrewriteValue).WithTable(i.Schema, i.Table)
+	ctx.ShouldSkip = i.ShouldSkip
+	return ctx
+}
+
 // Syncer sync binlog item to downstream
 type Syncer interface {
 	// Sync the binlog item to downstream
@@ -60,17 +71,72 @@ type Syncer interface {
 	SetSafeMode(mode bool) bool
 }
 
+// CheckpointListener is implemented by the Syncers need to know the checkpoints saved.
+type CheckpointListener interface {
+	// OnCheckpointSaved is called after the checkpoint ts is saved.
+	OnCheckpointSaved(ts int64)
+}
+
 type baseSyncer struct {
 	*baseError
 	success         chan *Item
 	tableInfoGetter translator.TableInfoGetter
+	// columnFilter skips the columns of the translated binlogs, nil if no column is skipped.
+	columnFilter *filter.ColumnFilter
+	// generatedColumnRules specify the generated columns in the DMLs of the tables.
+	generatedColumnRules []generatedColumnRule
+	// noKeyTableRules specify the modes of the DMLs of the tables without primary key and unique key.
+	noKeyTableRules []noKeyTableRule
+	// charsets are the charsets of the columns whose values are converted to utf8.
+	charsets translator.Charsets
+}
+
+type generatedColumnRule struct {
+	filter *filter.Filter
+	mode   string
+}
+
+func newGeneratedColumnRules(rules []GeneratedColumnRule) ([]generatedColumnRule, error) {
+	res := make([]generatedColumnRule, 0, len(rules))
+	for _, rule := range rules {
+		tables, err := filter.NewFilter(nil, nil, nil, []filter.TableName{{Schema: rule.Schema, Table: rule.Table}})
+		if err != nil {
+			return nil, errors.Annotate(err, "invalid generated-column rule")
+		}
+		res = append(res, generatedColumnRule{
+			filter: tables,
+			mode:   rule.Mode,
+		})
+	}
+	return res, nil
+}
+
+type noKeyTableRule struct {
+	filter *filter.Filter
+	mode   string
+}
+
+func newNoKeyTableRules(rules []NoKeyTableRule) ([]noKeyTableRule, error) {
+	res := make([]noKeyTableRule, 0, len(rules))
+	for _, rule := range rules {
+		tables, err := filter.NewFilter(nil, nil, nil, []filter.TableName{{Schema: rule.Schema, Table: rule.Table}})
+		if err != nil {
+			return nil, errors.Annotate(err, "invalid no-key-table rule")
+		}
+		res = append(res, noKeyTableRule{
+			filter: tables,
+			mode:   rule.Mode,
+		})
+	}
+	return res, nil
 }
 
-func newBaseSyncer(tableInfoGetter translator.TableInfoGetter) *baseSyncer {
+func newBaseSyncer(tableInfoGetter translator.TableInfoGetter, columnFilter *filter.ColumnFilter) *baseSyncer {
 	return &baseSyncer{
 		baseError:       newBaseError(),
 		success:         make(chan *Item, 8),
 		tableInfoGetter: tableInfoGetter,
+		columnFilter:    columnFilter,
 	}
 }
 
@@ -79,6 +145,41 @@ func (s *baseSyncer) Successes() <-chan *Item {
 	return s.success
 }
 
+// generatedColumnsMode returns the mode of the first rule matching the table,
+// empty if no rule matches and the default mode of the syncer is used.
+func (s *baseSyncer) generatedColumnsMode(schema, table string) string {
+	for _, rule := range s.generatedColumnRules {
+		if !rule.filter.SkipSchemaAndTable(schema, table) {
+			return rule.mode
+		}
+	}
+	return ""
+}
+
+// noKeyTableMode returns the mode of the first rule matching the table without primary key
+// and unique key, empty if no rule matches and the rows are located by all the columns.
+func (s *baseSyncer) noKeyTableMode(schema, table string) string {
+	for _, rule := range s.noKeyTableRules {
+		if !rule.filter.SkipSchemaAndTable(schema, table) {
+			return rule.mode
+		}
+	}
+	return ""
+}
+
+// translatorContext returns the context to translate the item.
+func (s *baseSyncer) translatorContext(item *Item) *translator.Context {
+	ctx := item.translatorContext(s.tableInfoGetter)
+	ctx.Charsets = s.charsets
+	if len(s.generatedColumnRules) > 0 {
+		ctx.GeneratedColumns = s.generatedColumnsMode
+	}
+	if len(s.noKeyTableRules) > 0 {
+		ctx.NoKeyTables = s.noKeyTableMode
+	}
+	return ctx
+}
+
 // Error implements Syncer interface
 func (s *baseSyncer) Error() <-chan error {
 	return s.error()
@@ -52,7 +52,7 @@ func (s *syncerSuite) SetUpTest(c *check.C) {
 	}
 
 	// create pb syncer
-	pb, err := NewPBSyncer(cfg.BinlogFileDir, cfg.BinlogFileRetentionTime, infoGetter)
+	pb, err := NewPBSyncer(cfg.BinlogFileDir, cfg.BinlogFileRetentionTime, cfg.BinlogFileRetentionGuard, 0, infoGetter, nil, nil, nil)
 	c.Assert(err, check.IsNil)
 
 	s.syncers = append(s.syncers, pb)
@@ -67,7 +67,7 @@ func (s *syncerSuite) SetUpTest(c *check.C) {
 		createDB = oldCreateDB
 	}()
 
-	mysql, err := NewMysqlSyncer(cfg, infoGetter, 1, 1, nil, nil, "mysql", nil, nil, true, true)
+	mysql, err := NewMysqlSyncer(cfg, infoGetter, nil, 1, 1, nil, nil, "mysql", nil, nil, true, true)
 	c.Assert(err, check.IsNil)
 	s.syncers = append(s.syncers, mysql)
 
@@ -81,7 +81,7 @@ func (s *syncerSuite) SetUpTest(c *check.C) {
 		return s.mockProducer, nil
 	}
 
-	kafka, err := NewKafka(cfg, infoGetter)
+	kafka, err := NewKafka(cfg, infoGetter, nil)
 	c.Assert(err, check.IsNil)
 	s.syncers = append(s.syncers, kafka)
 
@@ -156,3 +156,41 @@ func closeSyncers(c *check.C, syncers []Syncer) {
 		c.Logf("close %T success", syncer)
 	}
 }
+
+type jsonUpdateRuleSuite struct{}
+
+var _ = check.Suite(&jsonUpdateRuleSuite{})
+
+func (s *jsonUpdateRuleSuite) TestJSONUpdateFormat(c *check.C) {
+	rules, err := newJSONUpdateRules([]JSONUpdateRule{
+		{Schema: "test", Table: "~^doc.*", Format: translator.JSONUpdateDiff},
+		{Schema: "~.*", Table: "~.*", Format: translator.JSONUpdatePatch},
+	})
+	c.Assert(err, check.IsNil)
+	syncer := &KafkaSyncer{jsonUpdateRules: rules}
+	c.Assert(syncer.jsonUpdateFormat("test", "doc1"), check.Equals, translator.JSONUpdateDiff)
+	c.Assert(syncer.jsonUpdateFormat("test", "t"), check.Equals, translator.JSONUpdatePatch)
+
+	syncer = &KafkaSyncer{}
+	c.Assert(syncer.jsonUpdateFormat("test", "t"), check.Equals, translator.JSONUpdateFull)
+}
+
+type generatedColumnRuleSuite struct{}
+
+var _ = check.Suite(&generatedColumnRuleSuite{})
+
+func (s *generatedColumnRuleSuite) TestGeneratedColumnsMode(c *check.C) {
+	syncer := newBaseSyncer(nil, nil)
+	var err error
+	syncer.generatedColumnRules, err = newGeneratedColumnRules([]GeneratedColumnRule{
+		{Schema: "test", Table: "gen_contacts", Mode: translator.GeneratedColumnsStored},
+		{Schema: "~.*", Table: "~^gen_.*", Mode: translator.GeneratedColumnsAll},
+	})
+	c.Assert(err, check.IsNil)
+
+	_, err = newGeneratedColumnRules([]GeneratedColumnRule{{Schema: "test", Table: "~gen_("}})
+	c.Assert(err, check.ErrorMatches, "invalid generated-column rule: invalid pattern ~gen_\\(.*")
+	c.Assert(syncer.generatedColumnsMode("test", "gen_contacts"), check.Equals, translator.GeneratedColumnsStored)
+	c.Assert(syncer.generatedColumnsMode("db", "gen_t"), check.Equals, translator.GeneratedColumnsAll)
+	c.Assert(syncer.generatedColumnsMode("test", "t"), check.Equals, "")
+}
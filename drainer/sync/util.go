@@ -15,9 +15,14 @@ package sync
 
 import (
 	"crypto/tls"
+	"fmt"
 
 	// mysql driver
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/tidb-binlog/drainer/checkpoint"
+	"github.com/pingcap/tidb-binlog/drainer/translator"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/proxy"
 	"github.com/pingcap/tidb-binlog/pkg/security"
 )
 
@@ -36,8 +41,62 @@ type DBConfig struct {
 	BinlogFileDir           string            `toml:"dir" json:"dir"`
 	BinlogFileRetentionTime int               `toml:"retention-time" json:"retention-time"`
 	Params                  map[string]string `toml:"params" json:"params"`
+	// BinlogFileRetentionGuard keeps the binlog files still needed from being
+	// deleted by retention-time.
+	BinlogFileRetentionGuard PBRetentionGuard `toml:"retention-guard" json:"retention-guard"`
 
 	Merge bool `toml:"merge" json:"merge"`
+	// TableShardCount is the count of shards the DMLs of a table are split into by the
+	// hash of primary key when merge is enabled, so a hot table can be applied concurrently.
+	TableShardCount int `toml:"table-shard-count" json:"table-shard-count"`
+
+	// DownstreamVersion is the version of downstream MySQL, the DDL will be
+	// rewritten to be compatible with it if set.
+	DownstreamVersion string `toml:"downstream-version" json:"downstream-version"`
+	// SQLMode is the sql mode of the sessions of downstream, syncer.sql-mode is used if it's nil.
+	// The DDLs are checked to be executed as they are under it when it's set.
+	SQLMode *string `toml:"sql-mode" json:"sql-mode"`
+	// KeepDDLComments keeps the leading comments of the DDLs rewritten by drainer,
+	// like the hints `/*vt+ ... */` the proxies in downstream route the DDLs by.
+	KeepDDLComments bool `toml:"keep-ddl-comments" json:"keep-ddl-comments"`
+
+	// DDLTimeout is the timeout in seconds of executing a DDL, the timeout DDL
+	// is killed and retried, zero means no timeout. It's also the timeout of the
+	// DDLs executed on the dedicated connection of DDL.
+	DDLTimeout int `toml:"ddl-timeout" json:"ddl-timeout"`
+	// DDLBlockCheckInterval is the interval in seconds of checking whether the executing
+	// DDL is blocked by metadata locks, zero disables the check.
+	DDLBlockCheckInterval int `toml:"ddl-block-check-interval" json:"ddl-block-check-interval"`
+
+	// StatementTimeout is the timeout in seconds of executing a DML statement, the timeout statement
+	// is killed by KILL QUERY on a control connection, zero means no timeout.
+	StatementTimeout int `toml:"statement-timeout" json:"statement-timeout"`
+	// StatementTimeoutAction is "retry" to retry the DMLs after the statement is killed, the default,
+	// or "error" to stop drainer with the error.
+	StatementTimeoutAction string `toml:"statement-timeout-action" json:"statement-timeout-action"`
+
+	// Proxy is the SSH server or SOCKS5 proxy the connections to downstream are dialed through.
+	Proxy proxy.Config `toml:"proxy" json:"proxy"`
+
+	// DDL is the config of executing the DDLs on a dedicated connection.
+	DDL DDLConnConfig `toml:"ddl" json:"ddl"`
+
+	// MaxOpenConns and MaxIdleConns limit the connection pool of downstream, they're the worker
+	// count by default. ConnMaxLifetime is the max seconds a connection is reused, zero means forever.
+	MaxOpenConns    int `toml:"max-open-conns" json:"max-open-conns"`
+	MaxIdleConns    int `toml:"max-idle-conns" json:"max-idle-conns"`
+	ConnMaxLifetime int `toml:"conn-max-lifetime" json:"conn-max-lifetime"`
+	// IsolationLevel is the isolation level of the transactions executing DMLs, like "READ-COMMITTED",
+	// the default level of downstream is used if it's empty.
+	IsolationLevel string `toml:"isolation-level" json:"isolation-level"`
+
+	// Heartbeat writes the checkpoint into a downstream table periodically.
+	Heartbeat HeartbeatConfig `toml:"heartbeat" json:"heartbeat"`
+
+	// AutoTune is set by drainer from syncer.auto-tune, nil if it's disabled.
+	AutoTune *loader.AutoTuneConfig `toml:"-" json:"-"`
+	// Charsets is set by drainer from syncer.decode-charsets.
+	Charsets translator.Charsets `toml:"-" json:"-"`
 
 	ZKAddrs          string `toml:"zookeeper-addrs" json:"zookeeper-addrs"`
 	KafkaAddrs       string `toml:"kafka-addrs" json:"kafka-addrs"`
@@ -45,8 +104,135 @@ type DBConfig struct {
 	KafkaMaxMessages int    `toml:"kafka-max-messages" json:"kafka-max-messages"`
 	KafkaClientID    string `toml:"kafka-client-id" json:"kafka-client-id"`
 	TopicName        string `toml:"topic-name" json:"topic-name"`
+
+	// ZKAuth authenticates the session of zookeeper-addrs in the form of scheme:credential,
+	// like "digest:user:password".
+	ZKAuth string `toml:"zookeeper-auth" json:"zookeeper-auth"`
+	// ZKSecurity is the TLS config of connecting to zookeeper-addrs.
+	ZKSecurity security.Config `toml:"zookeeper-security" json:"zookeeper-security"`
+	ZKTLS      *tls.Config     `toml:"-" json:"-"`
+
+	// KafkaTransaction produces the messages of a binlog in one kafka transaction.
+	KafkaTransaction bool `toml:"kafka-transaction" json:"kafka-transaction"`
+	// SchemaRegistry registers the Avro schemas of the rows of the tables to a schema registry.
+	SchemaRegistry SchemaRegistryConfig `toml:"schema-registry" json:"schema-registry"`
+	// SchemaSnapshot produces the schema snapshots of the tables after their DDLs and before their first DMLs.
+	SchemaSnapshot bool `toml:"schema-snapshot" json:"schema-snapshot"`
+	// JSONUpdateRules specify how the updated JSON columns of the tables are represented in kafka
+	JSONUpdateRules []JSONUpdateRule `toml:"json-update-rule" json:"json-update-rule"`
+	// PartitionKeyRules specify the columns the rows of the tables are partitioned by in kafka
+	PartitionKeyRules []PartitionKeyRule `toml:"partition-key-rule" json:"partition-key-rule"`
+	// GeneratedColumnRules specify whether the generated columns of the tables are in the DMLs
+	GeneratedColumnRules []GeneratedColumnRule `toml:"generated-column-rule" json:"generated-column-rule"`
+	// NoKeyTableRules specify how the DMLs of the tables without primary key and unique key are synced
+	NoKeyTableRules []NoKeyTableRule `toml:"no-key-table-rule" json:"no-key-table-rule"`
+	// CommitTSColumnRules specify the tables whose rows are annotated with the commit ts columns in mysql and tidb
+	CommitTSColumnRules []CommitTSColumnRule `toml:"commit-ts-column-rule" json:"commit-ts-column-rule"`
+	// UpsertRules specify the tables whose rows are written by INSERT ... ON DUPLICATE KEY UPDATE instead of REPLACE
+	UpsertRules []UpsertRule `toml:"upsert-rule" json:"upsert-rule"`
+	// DDLBroadcastRules specify the schemas whose DDLs are executed on all their shards in downstream
+	DDLBroadcastRules []DDLBroadcastRule `toml:"ddl-broadcast-rule" json:"ddl-broadcast-rule"`
+	// SchemaMoveDDL is how the DDLs moving tables into or out of the schemas of DDLBroadcastRules
+	// are handled, "route" to move the tables between the shards, or "block" to fail the DDLs.
+	SchemaMoveDDL string `toml:"schema-move-ddl" json:"schema-move-ddl"`
+
+	// Stream is the format and ordering keys of the binlogs published to pubsub and kinesis.
+	Stream StreamConfig `toml:"stream" json:"stream"`
+	// PubSub is the topic of Google Cloud Pub/Sub the binlogs are published to if db-type is pubsub.
+	PubSub PubSubConfig `toml:"pubsub" json:"pubsub"`
+	// Kinesis is the stream of AWS Kinesis the binlogs are published to if db-type is kinesis.
+	Kinesis KinesisConfig `toml:"kinesis" json:"kinesis"`
 	// get it from pd
 	ClusterID uint64 `toml:"-" json:"-"`
+	// NodeID is the node id of drainer, the transactional id of kafka is derived from it.
+	NodeID string `toml:"-" json:"-"`
+}
+
+// DDLConnConfig is the config of executing the DDLs on a dedicated connection of downstream,
+// so the long DDLs like a huge ALTER TABLE don't occupy the connections of the DML workers.
+type DDLConnConfig struct {
+	Enable bool `toml:"enable" json:"enable"`
+	// LockWaitTimeout is the lock_wait_timeout in seconds of the DDL session, the seconds a DDL
+	// waits for the metadata locks, zero keeps the default of downstream.
+	LockWaitTimeout int `toml:"lock-wait-timeout" json:"lock-wait-timeout"`
+	// OnlineSchemaChange is the shell command executing the ALTER TABLE DDLs instead of
+	// downstream, like pt-online-schema-change or gh-ost.
+	OnlineSchemaChange string `toml:"online-schema-change" json:"online-schema-change"`
+}
+
+// JSONUpdateRule specifies the representation of the updated JSON columns of
+// the matched tables, the format is one of "full", "patch" and "diff".
+type JSONUpdateRule struct {
+	Schema string `toml:"db-name" json:"db-name"`
+	Table  string `toml:"tbl-name" json:"tbl-name"`
+	Format string `toml:"format" json:"format"`
+}
+
+// PartitionKeyRule specifies the columns the rows of the matched tables are partitioned by in kafka
+// instead of the primary key, like partitioning the orders by customer_id, so the rows of a customer
+// are produced to one partition in order.
+type PartitionKeyRule struct {
+	Schema  string   `toml:"db-name" json:"db-name"`
+	Table   string   `toml:"tbl-name" json:"tbl-name"`
+	Columns []string `toml:"columns" json:"columns"`
+}
+
+// GeneratedColumnRule specifies the generated columns in the DMLs of the matched tables,
+// the mode is one of "omit", "stored" and "all". They're omitted by default for mysql and
+// tidb since their values can't be specified, all of them are included for kafka and file.
+type GeneratedColumnRule struct {
+	Schema string `toml:"db-name" json:"db-name"`
+	Table  string `toml:"tbl-name" json:"tbl-name"`
+	Mode   string `toml:"mode" json:"mode"`
+}
+
+// NoKeyTableRule specifies how the DMLs of the matched tables without primary key and unique key
+// are synced to mysql and tidb, the mode is one of "full-row", "skip" and "append-only". The rows
+// are located by all the columns by default.
+type NoKeyTableRule struct {
+	Schema string `toml:"db-name" json:"db-name"`
+	Table  string `toml:"tbl-name" json:"tbl-name"`
+	Mode   string `toml:"mode" json:"mode"`
+}
+
+// CommitTSColumnRule specifies the tables whose inserted and updated rows carry the commit ts
+// of their transactions in the columns _tidb_commit_ts and _tidb_commit_time, the columns are
+// added to the CREATE TABLE DDLs of the tables, and must be added to the existing tables manually.
+type CommitTSColumnRule struct {
+	Schema string `toml:"db-name" json:"db-name"`
+	Table  string `toml:"tbl-name" json:"tbl-name"`
+}
+
+// UpsertRule specifies the tables whose rows are written by INSERT ... ON DUPLICATE KEY UPDATE of the
+// columns in the binlogs instead of REPLACE in safe mode and merge mode, so the columns only in downstream
+// keep their values instead of being reset to their defaults.
+type UpsertRule struct {
+	Schema string `toml:"db-name" json:"db-name"`
+	Table  string `toml:"tbl-name" json:"tbl-name"`
+}
+
+// The ways of handling the DDLs moving tables between the broadcast schemas.
+const (
+	SchemaMoveDDLRoute = "route"
+	SchemaMoveDDLBlock = "block"
+)
+
+// DDLBroadcastRule specifies the shards of a schema in downstream, the names
+// of the shards are formatted by TargetSchema with the shard number from 0
+// to ShardCount-1, like "db_%03d".
+type DDLBroadcastRule struct {
+	Schema       string `toml:"db-name" json:"db-name"`
+	TargetSchema string `toml:"target-schema" json:"target-schema"`
+	ShardCount   int    `toml:"shard-count" json:"shard-count"`
+}
+
+// Shards returns the names of the shards.
+func (r DDLBroadcastRule) Shards() []string {
+	shards := make([]string, 0, r.ShardCount)
+	for i := 0; i < r.ShardCount; i++ {
+		shards = append(shards, fmt.Sprintf(r.TargetSchema, i))
+	}
+	return shards
 }
 
 // CheckpointConfig is the Checkpoint configuration.
@@ -61,6 +247,13 @@ type CheckpointConfig struct {
 	Port              int             `toml:"port" json:"port"`
 	Security          security.Config `toml:"security" json:"security"`
 	TLS               *tls.Config     `toml:"-" json:"-"`
+	// TakeoverAfter is the seconds after which the checkpoint not saved by the drainer
+	// owning it can be taken over by another drainer.
+	TakeoverAfter int `toml:"takeover-after" json:"takeover-after"`
+	// File is the checkpoint file of the file and file-sync types, "savepoint" in data-dir by default.
+	File string `toml:"file" json:"file"`
+	// Consul is the key of consul the checkpoint is saved in of the consul type.
+	Consul checkpoint.ConsulConfig `toml:"consul" json:"consul"`
 }
 
 type baseError struct {
@@ -14,8 +14,10 @@
 package drainer
 
 import (
+	"context"
 	"reflect"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -40,6 +42,10 @@ import (
 // normally, we take record if it takes longer than this value.
 var runWaitThreshold = 10 * time.Second
 
+// safeModeCheckInterval is the interval to check whether the checkpoint has
+// reached the ts before rewinding, safe mode is kept until then.
+var safeModeCheckInterval = 10 * time.Second
+
 // Syncer converts tidb binlog to the specified DB sqls, and sync it to target DB
 type Syncer struct {
 	schema *Schema
@@ -58,6 +64,25 @@ type Syncer struct {
 
 	dsyncer dsync.Syncer
 
+	// verifier is nil if verify is disabled.
+	verifier *verifier
+	// hotspot is nil if hotspot sampling is disabled.
+	hotspot *hotspotSampler
+	// invalidator is nil if invalidating the caches in redis is disabled.
+	invalidator *invalidator
+	// watermark is nil if tracking the watermarks of the tables is disabled.
+	watermark *watermarkTracker
+	// dedup is nil if the window of the synced rows is disabled.
+	dedup *dedupWindow
+	// bandwidth limits the bytes of the DMLs synced per second by the time of day.
+	bandwidth *bandwidthScheduler
+	// assignment is nil if the drainer syncs all the tables, otherwise only the tables assigned to it.
+	assignment *tableAssignment
+
+	lastDDLMu sync.Mutex
+	// lastDDL is the last DDL synced to downstream, nil if no DDL is synced.
+	lastDDL *DDLStatusV1
+
 	shutdown chan struct{}
 	closed   chan struct{}
 }
@@ -72,21 +97,54 @@ func NewSyncer(cp checkpoint.CheckPoint, cfg *SyncerConfig, jobs []*model.Job) (
 	syncer.shutdown = make(chan struct{})
 	syncer.closed = make(chan struct{})
 
-	var ignoreDBs []string
-	if len(cfg.IgnoreSchemas) > 0 {
-		ignoreDBs = strings.Split(cfg.IgnoreSchemas, ",")
+	var err error
+	syncer.filter, err = cfg.newFilter()
+	if err != nil {
+		return nil, errors.Trace(err)
 	}
-	syncer.filter = filter.NewFilter(ignoreDBs, cfg.IgnoreTables, cfg.DoDBs, cfg.DoTables)
 	syncer.loopbackSync = loopbacksync.NewLoopBackSyncInfo(cfg.ChannelID, cfg.LoopbackControl, cfg.SyncDDL)
 
-	var err error
 	// create schema
 	syncer.schema, err = NewSchema(jobs, false)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	syncer.dsyncer, err = createDSyncer(cfg, syncer.schema, syncer.loopbackSync)
+	syncer.dsyncer, err = createDSyncer(cfg, syncer.schema, syncer.loopbackSync, cp.TS())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if cfg.Verify.enabled() {
+		syncer.verifier = newVerifier(cfg.Verify, cfg.To, cfg.DestDBType)
+	}
+
+	if cfg.Hotspot.enabled() {
+		syncer.hotspot = newHotspotSampler(cfg.Hotspot)
+	}
+
+	if cfg.Invalidation.enabled() {
+		syncer.invalidator, err = newInvalidator(cfg.Invalidation)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	if cfg.Watermark.enabled() {
+		syncer.watermark, err = newWatermarkTracker(cfg.Watermark, cfg.To, cfg.downstreamSQLMode())
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	if cfg.Dedup.enabled() {
+		syncer.dedup, err = newDedupWindow(cfg.Dedup)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	syncer.bandwidth, err = newBandwidthScheduler(cfg.Bandwidth)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -94,15 +152,29 @@ func NewSyncer(cp checkpoint.CheckPoint, cfg *SyncerConfig, jobs []*model.Job) (
 	return syncer, nil
 }
 
-func createDSyncer(cfg *SyncerConfig, schema *Schema, info *loopbacksync.LoopBackSync) (dsyncer dsync.Syncer, err error) {
+func createDSyncer(cfg *SyncerConfig, schema *Schema, info *loopbacksync.LoopBackSync, checkpointTS int64) (dsyncer dsync.Syncer, err error) {
+	columnFilter, err := filter.NewColumnFilter(cfg.IgnoreColumns)
+	if err != nil {
+		return nil, errors.Annotate(err, "invalid ignore-column")
+	}
 	switch cfg.DestDBType {
 	case "kafka":
-		dsyncer, err = dsync.NewKafka(cfg.To, schema)
+		dsyncer, err = dsync.NewKafka(cfg.To, schema, columnFilter)
 		if err != nil {
 			return nil, errors.Annotate(err, "fail to create kafka dsyncer")
 		}
+	case "pubsub":
+		dsyncer, err = dsync.NewPubSub(cfg.To, schema, columnFilter)
+		if err != nil {
+			return nil, errors.Annotate(err, "fail to create pubsub dsyncer")
+		}
+	case "kinesis":
+		dsyncer, err = dsync.NewKinesis(cfg.To, schema, columnFilter)
+		if err != nil {
+			return nil, errors.Annotate(err, "fail to create kinesis dsyncer")
+		}
 	case "file":
-		dsyncer, err = dsync.NewPBSyncer(cfg.To.BinlogFileDir, cfg.To.BinlogFileRetentionTime, schema)
+		dsyncer, err = dsync.NewPBSyncer(cfg.To.BinlogFileDir, cfg.To.BinlogFileRetentionTime, cfg.To.BinlogFileRetentionGuard, checkpointTS, schema, columnFilter, cfg.To.GeneratedColumnRules, cfg.To.Charsets)
 		if err != nil {
 			return nil, errors.Annotate(err, "fail to create pb dsyncer")
 		}
@@ -113,7 +185,7 @@ func createDSyncer(cfg *SyncerConfig, schema *Schema, info *loopbacksync.LoopBac
 				return nil, errors.Annotate(err, "fail to create relayer")
 			}
 		}
-		dsyncer, err = dsync.NewMysqlSyncer(cfg.To, schema, cfg.WorkerCount, cfg.TxnBatch, queryHistogramVec, cfg.StrSQLMode, cfg.DestDBType, relayer, info, cfg.EnableDispatch(), cfg.EnableCausality())
+		dsyncer, err = dsync.NewMysqlSyncer(cfg.To, schema, columnFilter, cfg.WorkerCount, cfg.TxnBatch, queryHistogramVec, cfg.downstreamSQLMode(), cfg.DestDBType, relayer, info, cfg.EnableDispatch(), cfg.EnableCausality())
 		if err != nil {
 			return nil, errors.Annotate(err, "fail to create mysql dsyncer")
 		}
@@ -162,6 +234,11 @@ func (s *Syncer) enableSafeModeInitializationPhase() {
 
 	// for mysql
 	// set safeMode to true, it will use the config after 5 minutes.
+	// the rows synced before are skipped by the dedup window.
+	if s.dedupCovers() {
+		log.Info("skip the initialization phase of safe mode for the dedup window covers the checkpoint", zap.Int64("checkpoint", s.cp.TS()))
+		return
+	}
 	if !s.dsyncer.SetSafeMode(true) {
 		return
 	}
@@ -169,10 +246,23 @@ func (s *Syncer) enableSafeModeInitializationPhase() {
 	go func() {
 		select {
 		case <-time.After(5 * time.Minute):
-			s.dsyncer.SetSafeMode(s.cfg.SafeMode)
 		case <-s.shutdown:
 			return
 		}
+
+		// the checkpoint is rewound, keep safe mode until the binlogs synced
+		// before are all synced again.
+		if untilTS := s.cp.SafeModeUntilTS(); untilTS > 0 {
+			log.Info("keep safe mode until the checkpoint reaches the ts before rewinding", zap.Int64("until ts", untilTS))
+		}
+		for s.cp.SafeModeUntilTS() > 0 {
+			select {
+			case <-time.After(safeModeCheckInterval):
+			case <-s.shutdown:
+				return
+			}
+		}
+		s.dsyncer.SetSafeMode(s.cfg.SafeMode)
 	}()
 }
 
@@ -210,6 +300,22 @@ func (s *Syncer) handleSuccess(fakeBinlog chan *pb.Binlog, lastTS *int64) {
 				atomic.StoreInt64(lastTS, ts)
 			}
 			latestVersion = item.SchemaVersion
+			if s.invalidator != nil {
+				s.invalidator.synced(ts)
+			}
+			if s.watermark != nil {
+				s.watermark.synced(ts)
+			}
+			if s.dedup != nil {
+				// the rows are synced again if drainer restarts from an older checkpoint.
+				if err := s.dedup.synced(ts); err != nil {
+					log.Warn("save the synced rows into dedup window failed", zap.Int64("commit ts", ts), zap.Error(err))
+				}
+			}
+
+			if item.Binlog.DdlJobId > 0 {
+				s.setLastDDL(item)
+			}
 
 			// save ASAP for DDL, and if FinishTS > 0, we should save the ts map
 			if item.Binlog.DdlJobId > 0 || item.AppliedTS > 0 {
@@ -263,6 +369,10 @@ func (s *Syncer) savePoint(ts, secondaryTS, version int64) {
 	}
 
 	checkpointTSOGauge.Set(float64(oracle.ExtractPhysical(uint64(ts))))
+
+	if listener, ok := s.dsyncer.(dsync.CheckpointListener); ok {
+		listener.OnCheckpointSaved(ts)
+	}
 }
 
 func (s *Syncer) run() error {
@@ -275,9 +385,27 @@ func (s *Syncer) run() error {
 	var fakeBinlogs []*pb.Binlog
 	var fakeBinlogPreAddTS []int64
 
+	if s.invalidator != nil {
+		go s.invalidator.run()
+	}
+	if s.watermark != nil {
+		go s.watermark.run()
+	}
+	if s.dedup != nil {
+		go s.dedup.run()
+	}
 	go func() {
 		defer close(wait)
 		s.handleSuccess(fakeBinlogCh, &lastSuccessTS)
+		if s.invalidator != nil {
+			s.invalidator.close()
+		}
+		if s.watermark != nil {
+			s.watermark.close()
+		}
+		if s.dedup != nil {
+			s.dedup.close()
+		}
 	}()
 
 	var err error
@@ -297,9 +425,34 @@ func (s *Syncer) run() error {
 	var pushFakeBinlog chan<- *pb.Binlog
 
 	var lastAddComitTS int64
+	// lastConsumedTS is the max commit ts of the consumed binlogs, all the
+	// binlogs before it have been consumed too.
+	var lastConsumedTS int64
 	dsyncError := s.dsyncer.Error()
+
+	var verifyTick <-chan time.Time
+	if s.verifier != nil {
+		ticker := time.NewTicker(time.Duration(s.cfg.Verify.Interval) * time.Second)
+		defer ticker.Stop()
+		verifyTick = ticker.C
+	}
+	// ctx is canceled on shutdown, for the verifier and waiting for the bandwidth.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 ForLoop:
 	for {
+		// the binlog consumed last has been translated and passed to the downstream syncer.
+		if b != nil {
+			b.releaseMemory()
+		}
+
 		// check if we can safely push a fake binlog
 		// We must wait previous items consumed to make sure we are safe to save this fake binlog commitTS
 		if pushFakeBinlog == nil && len(fakeBinlogs) > 0 {
@@ -319,6 +472,19 @@ ForLoop:
 		case pushFakeBinlog <- fakeBinlog:
 			pushFakeBinlog = nil
 			continue
+		case <-verifyTick:
+			if lastConsumedTS == 0 || !atomic.CompareAndSwapInt32(&s.verifier.running, 0, 1) {
+				continue
+			}
+			// stop consuming until all the consumed binlogs are synced, so
+			// the downstream is consistent with the upstream at lastConsumedTS.
+			var synced bool
+			synced, err = s.waitSynced(lastAddComitTS, &lastSuccessTS, dsyncError)
+			if err != nil || !synced {
+				break ForLoop
+			}
+			s.verifier.start(ctx, lastConsumedTS)
+			continue
 		case b = <-s.input:
 			queueSizeGauge.WithLabelValues("syncer_input").Set(float64(len(s.input)))
 			log.Debug("consume binlog item", zap.Stringer("item", b))
@@ -328,6 +494,9 @@ ForLoop:
 		startTS := binlog.GetStartTs()
 		commitTS := binlog.GetCommitTs()
 		jobID := binlog.GetDdlJobId()
+		if commitTS > lastConsumedTS {
+			lastConsumedTS = commitTS
+		}
 
 		if isIgnoreTxnCommitTS(s.cfg.IgnoreTxnCommitTS, commitTS) {
 			log.Warn("skip txn", zap.Stringer("binlog", b.binlog))
@@ -374,14 +543,48 @@ ForLoop:
 			}
 
 			var ignore bool
-			ignore, err = filterTable(preWrite, s.filter, s.schema)
+			ignore, err = filterTable(preWrite, s.filter, s.schema, s.cfg.skipTemporaryTable(), s.cfg.skipInternalOperations())
 			if err != nil {
 				err = errors.Annotate(err, "filterTable failed")
 				break ForLoop
 			}
 
+			if !ignore && s.assignment != nil {
+				ignore, err = s.assignment.filterMutations(preWrite, s.schema, binlog.GetCommitTs())
+				if err != nil {
+					err = errors.Annotate(err, "filter the tables by assignment failed")
+					break ForLoop
+				}
+			}
+
+			if !ignore && !isFilterTransaction && s.dedup != nil {
+				preWrite, err = s.dedupRows(binlog, preWrite)
+				if err != nil {
+					err = errors.Annotate(err, "dedup failed")
+					break ForLoop
+				}
+				// all the rows are synced before.
+				ignore = preWrite == nil
+			}
+
 			if !ignore && !isFilterTransaction {
 				s.addDMLEventMetrics(preWrite.GetMutations())
+				if s.hotspot != nil {
+					s.hotspot.sample(binlog, preWrite, s.schema)
+				}
+				if s.invalidator != nil {
+					s.invalidator.prepare(binlog, preWrite, s.schema)
+				}
+				if s.watermark != nil {
+					s.watermark.prepare(binlog, preWrite, s.schema)
+				}
+				if err = s.bandwidth.wait(ctx, len(binlog.GetPrewriteValue())); err != nil {
+					if ctx.Err() != nil {
+						// shutdown while waiting.
+						err = nil
+					}
+					break ForLoop
+				}
 				beginTime := time.Now()
 				lastAddComitTS = binlog.GetCommitTs()
 				err = s.dsyncer.Sync(&dsync.Item{Binlog: binlog, PrewriteValue: preWrite, SchemaVersion: preWrite.SchemaVersion})
@@ -395,6 +598,9 @@ ForLoop:
 			log.Debug("get ddl binlog job", zap.Stringer("job", b.job))
 
 			if skipUnsupportedDDLJob(b.job) {
+				if isInternalDDLJob(b.job) {
+					internalOperationCounter.WithLabelValues("ddl").Inc()
+				}
 				log.Info("skip unsupported DDL job", zap.Stringer("job", b.job))
 				continue
 			}
@@ -424,12 +630,35 @@ ForLoop:
 				break ForLoop
 			}
 
+			if s.cfg.skipInternalOperations() && (isInternalDDLJob(b.job) || isInternalTable(schema, table)) {
+				internalOperationCounter.WithLabelValues("ddl").Inc()
+				log.Info("skip internal ddl of TiDB", zap.String("schema", schema), zap.String("table", table),
+					zap.String("sql", sql), zap.Int64("commit ts", commitTS))
+				continue
+			}
+
+			if s.cfg.skipTemporaryTable() && s.schema.isTemporaryTableJob(b.job) {
+				log.Info("skip ddl of temporary table", zap.String("schema", schema), zap.String("table", table),
+					zap.String("sql", sql), zap.Int64("commit ts", commitTS))
+				continue
+			}
+
 			if s.filter.SkipSchemaAndTable(schema, table) {
 				log.Info("skip ddl by filter", zap.String("schema", schema), zap.String("table", table),
 					zap.String("sql", sql), zap.Int64("commit ts", commitTS))
 				continue
 			}
 
+			if s.assignment != nil && !s.assignment.owns(schema, table, commitTS) {
+				log.Info("skip ddl of table not assigned", zap.String("schema", schema), zap.String("table", table),
+					zap.String("sql", sql), zap.Int64("commit ts", commitTS))
+				continue
+			}
+
+			if err = checkCreateTableSelect(b.job, commitTS, s.cfg.StrictCreateTableSelect); err != nil {
+				break ForLoop
+			}
+
 			shouldSkip := false
 
 			if !s.cfg.SyncDDL {
@@ -445,13 +674,16 @@ ForLoop:
 
 			// Add ddl item to downstream.
 			s.addDDLCount()
+			if s.watermark != nil && len(table) > 0 {
+				s.watermark.prepareTables(commitTS, filter.TableName{Schema: schema, Table: table})
+			}
 			beginTime := time.Now()
 			lastAddComitTS = binlog.GetCommitTs()
 
 			log.Info("add ddl item to syncer, you can add this commit ts to `ignore-txn-commit-ts` to skip this ddl if needed",
 				zap.String("sql", sql), zap.Int64("commit ts", binlog.CommitTs))
 
-			err = s.dsyncer.Sync(&dsync.Item{Binlog: binlog, PrewriteValue: nil, Schema: schema, Table: table, ShouldSkip: shouldSkip, SchemaVersion: lastDDLSchemaVersion})
+			err = s.dsyncer.Sync(&dsync.Item{Binlog: binlog, PrewriteValue: nil, Schema: schema, Table: table, TableID: ddlTableID(b.job), ShouldSkip: shouldSkip, SchemaVersion: lastDDLSchemaVersion})
 			if err != nil {
 				err = errors.Annotatef(err, "add to dsyncer, commit ts %d", binlog.CommitTs)
 				break ForLoop
@@ -484,6 +716,24 @@ ForLoop:
 	return s.cp.Save(s.cp.TS(), 0, true /*consistent*/, lastDDLSchemaVersion)
 }
 
+// waitSynced waits until all the binlogs until ts are synced to downstream, it
+// returns false if the syncer is closed or the downstream fails.
+func (s *Syncer) waitSynced(ts int64, lastSuccessTS *int64, dsyncError <-chan error) (bool, error) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for atomic.LoadInt64(lastSuccessTS) < ts {
+		select {
+		case err := <-dsyncError:
+			return false, err
+		case <-s.shutdown:
+			return false, nil
+		case <-ticker.C:
+		}
+	}
+	return true, nil
+}
+
 func findLoopBackMark(dmls []*loader.DML, info *loopbacksync.LoopBackSync) (bool, error) {
 	for _, dml := range dmls {
 		tableName := dml.Database + "." + dml.Table
@@ -504,18 +754,31 @@ func findLoopBackMark(dmls []*loader.DML, info *loopbacksync.LoopBackSync) (bool
 }
 
 func loopBackStatus(binlog *pb.Binlog, prewriteValue *pb.PrewriteValue, infoGetter translator.TableInfoGetter, info *loopbacksync.LoopBackSync) (bool, error) {
-	var tableName string
-	var schemaName string
-	txn, err := translator.TiBinlogToTxn(infoGetter, schemaName, tableName, binlog, prewriteValue, false)
+	txn, err := translator.TiBinlogToTxn(translator.NewContext(infoGetter, binlog, prewriteValue))
 	if err != nil {
 		return false, errors.Trace(err)
 	}
 	return findLoopBackMark(txn.DMLs, info)
 }
 
+// checkCreateTableSelect warns that the rows selected by CREATE TABLE ... SELECT may not be
+// synced, it returns an error if strict.
+func checkCreateTableSelect(job *model.Job, commitTS int64, strict bool) error {
+	if job.Type != model.ActionCreateTable || !isCreateTableSelect(job.Query) {
+		return nil
+	}
+	if strict {
+		return errors.Errorf("the rows selected by ddl %s (commit ts %d) may not be recorded in binlog, "+
+			"set `strict-create-table-select` to false to sync it", job.Query, commitTS)
+	}
+	log.Warn("the rows selected by create table ... select may not be recorded in binlog, the select is executed by downstream",
+		zap.String("sql", job.Query), zap.Int64("commit ts", commitTS))
+	return nil
+}
+
 // filterTable may drop some table mutation in `PrewriteValue`
 // Return true if all table mutations are dropped.
-func filterTable(pv *pb.PrewriteValue, filter *filter.Filter, schema *Schema) (ignore bool, err error) {
+func filterTable(pv *pb.PrewriteValue, filter *filter.Filter, schema *Schema, skipTemporaryTable bool, skipInternalTable bool) (ignore bool, err error) {
 	var muts []pb.TableMutation
 	for _, mutation := range pv.GetMutations() {
 		schemaName, tableName, ok := schema.SchemaAndTableName(mutation.GetTableId())
@@ -523,6 +786,17 @@ func filterTable(pv *pb.PrewriteValue, filter *filter.Filter, schema *Schema) (i
 			return false, errors.Errorf("not found table id: %d", mutation.GetTableId())
 		}
 
+		if skipTemporaryTable && schema.IsTemporaryTable(mutation.GetTableId()) {
+			log.Debug("skip dml of temporary table", zap.String("schema", schemaName), zap.String("table", tableName))
+			continue
+		}
+
+		if skipInternalTable && isInternalTable(schemaName, tableName) {
+			internalOperationCounter.WithLabelValues("dml").Inc()
+			log.Debug("skip dml of internal table", zap.String("schema", schemaName), zap.String("table", tableName))
+			continue
+		}
+
 		if filter.SkipSchemaAndTable(schemaName, tableName) {
 			log.Debug("skip dml", zap.String("schema", schemaName), zap.String("table", tableName))
 			continue
@@ -572,6 +846,30 @@ func (s *Syncer) GetLastSyncTime() time.Time {
 	return s.lastSyncTime
 }
 
+func (s *Syncer) setLastDDL(item *dsync.Item) {
+	ddl := &DDLStatusV1{
+		CommitTS:      item.Binlog.CommitTs,
+		JobID:         item.Binlog.DdlJobId,
+		SchemaVersion: item.SchemaVersion,
+		Schema:        item.Schema,
+		Table:         item.Table,
+		Query:         string(item.Binlog.DdlQuery),
+		Skipped:       item.ShouldSkip,
+		SyncedAt:      time.Now(),
+	}
+
+	s.lastDDLMu.Lock()
+	s.lastDDL = ddl
+	s.lastDDLMu.Unlock()
+}
+
+// GetLastDDL returns the last DDL synced to downstream, nil if no DDL is synced.
+func (s *Syncer) GetLastDDL() *DDLStatusV1 {
+	s.lastDDLMu.Lock()
+	defer s.lastDDLMu.Unlock()
+	return s.lastDDL
+}
+
 // GetLatestCommitTS returns the latest commit ts.
 func (s *Syncer) GetLatestCommitTS() int64 {
 	return s.cp.TS()
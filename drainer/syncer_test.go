@@ -14,6 +14,7 @@
 package drainer
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/pingcap/tidb-binlog/drainer/loopbacksync"
@@ -38,7 +39,8 @@ func (s *syncerSuite) TestFilterTable(c *check.C) {
 	var dropID int64 = 1
 	schema.tableIDToName[dropID] = TableName{Schema: "test", Table: "test"}
 	// ignore "test" db
-	filter := filter.NewFilter([]string{"test"}, nil, nil, nil)
+	filter, err := filter.NewFilter([]string{"test"}, nil, nil, nil)
+	c.Assert(err, check.IsNil)
 
 	var pv = &pb.PrewriteValue{
 		Mutations: []pb.TableMutation{
@@ -46,7 +48,7 @@ func (s *syncerSuite) TestFilterTable(c *check.C) {
 		},
 	}
 
-	ignore, err := filterTable(pv, filter, schema)
+	ignore, err := filterTable(pv, filter, schema, true, true)
 	c.Assert(err, check.IsNil)
 	c.Assert(ignore, check.IsTrue)
 
@@ -55,10 +57,43 @@ func (s *syncerSuite) TestFilterTable(c *check.C) {
 	schema.tableIDToName[keepID] = TableName{Schema: "keep", Table: "keep"}
 	pv.Mutations = append(pv.Mutations, pb.TableMutation{TableId: keepID})
 
-	ignore, err = filterTable(pv, filter, schema)
+	ignore, err = filterTable(pv, filter, schema, true, true)
 	c.Assert(err, check.IsNil)
 	c.Assert(ignore, check.IsFalse)
 	c.Assert(len(pv.Mutations), check.Equals, 1)
+
+	// the temporary table is only skipped if skipTemporaryTable is true
+	var tempID int64 = 3
+	schema.tableIDToName[tempID] = TableName{Schema: "keep", Table: "temp"}
+	schema.appendTableInfo(1, &model.TableInfo{ID: tempID, Name: model.NewCIStr("temp"), TempTableType: model.TempTableLocal})
+	pv.Mutations = append(pv.Mutations, pb.TableMutation{TableId: tempID})
+
+	ignore, err = filterTable(pv, filter, schema, false, true)
+	c.Assert(err, check.IsNil)
+	c.Assert(ignore, check.IsFalse)
+	c.Assert(len(pv.Mutations), check.Equals, 2)
+
+	ignore, err = filterTable(pv, filter, schema, true, true)
+	c.Assert(err, check.IsNil)
+	c.Assert(ignore, check.IsFalse)
+	c.Assert(len(pv.Mutations), check.Equals, 1)
+	c.Assert(pv.Mutations[0].TableId, check.Equals, keepID)
+
+	// the internal table is only skipped if skipInternalTable is true
+	var statsID int64 = 4
+	schema.tableIDToName[statsID] = TableName{Schema: "mysql", Table: "stats_meta"}
+	pv.Mutations = append(pv.Mutations, pb.TableMutation{TableId: statsID})
+
+	ignore, err = filterTable(pv, filter, schema, true, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(ignore, check.IsFalse)
+	c.Assert(len(pv.Mutations), check.Equals, 2)
+
+	ignore, err = filterTable(pv, filter, schema, true, true)
+	c.Assert(err, check.IsNil)
+	c.Assert(ignore, check.IsFalse)
+	c.Assert(len(pv.Mutations), check.Equals, 1)
+	c.Assert(pv.Mutations[0].TableId, check.Equals, keepID)
 }
 
 func (s *syncerSuite) TestFilterMarkDatas(c *check.C) {
@@ -205,6 +240,30 @@ func (s *syncerSuite) TestNewSyncer(c *check.C) {
 	c.Assert(syncer.GetLatestCommitTS(), check.Greater, lastNoneFakeTS)
 }
 
+func (s *syncerSuite) TestWaitSynced(c *check.C) {
+	syncer := &Syncer{shutdown: make(chan struct{})}
+	lastSuccessTS := int64(5)
+	dsyncError := make(chan error, 1)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		atomic.StoreInt64(&lastSuccessTS, 10)
+	}()
+	synced, err := syncer.waitSynced(10, &lastSuccessTS, dsyncError)
+	c.Assert(err, check.IsNil)
+	c.Assert(synced, check.IsTrue)
+
+	dsyncError <- errors.New("downstream failed")
+	synced, err = syncer.waitSynced(11, &lastSuccessTS, dsyncError)
+	c.Assert(err, check.ErrorMatches, "downstream failed")
+	c.Assert(synced, check.IsFalse)
+
+	close(syncer.shutdown)
+	synced, err = syncer.waitSynced(11, &lastSuccessTS, dsyncError)
+	c.Assert(err, check.IsNil)
+	c.Assert(synced, check.IsFalse)
+}
+
 func (s *syncerSuite) TestIsIgnoreTxnCommitTS(c *check.C) {
 	c.Assert(isIgnoreTxnCommitTS(nil, 1), check.IsFalse)
 	c.Assert(isIgnoreTxnCommitTS([]int64{1, 3}, 1), check.IsTrue)
@@ -212,6 +271,17 @@ func (s *syncerSuite) TestIsIgnoreTxnCommitTS(c *check.C) {
 	c.Assert(isIgnoreTxnCommitTS([]int64{1, 3}, 3), check.IsTrue)
 }
 
+func (s *syncerSuite) TestCheckCreateTableSelect(c *check.C) {
+	ctas := &model.Job{Type: model.ActionCreateTable, Query: "create table t2 select * from t1"}
+	c.Assert(checkCreateTableSelect(ctas, 10, false), check.IsNil)
+	c.Assert(checkCreateTableSelect(ctas, 10, true), check.ErrorMatches, "the rows selected by ddl create table t2 select \\* from t1 \\(commit ts 10\\).*")
+
+	create := &model.Job{Type: model.ActionCreateTable, Query: "create table t2 (id int)"}
+	c.Assert(checkCreateTableSelect(create, 10, true), check.IsNil)
+	alter := &model.Job{Type: model.ActionAddColumn, Query: "alter table t2 add column c int default (select 1)"}
+	c.Assert(checkCreateTableSelect(alter, 10, true), check.IsNil)
+}
+
 func getEmptyPrewriteValue(schemaVersion int64, tableID int64) (data []byte) {
 	pv := &pb.PrewriteValue{
 		SchemaVersion: schemaVersion,
@@ -0,0 +1,92 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/charset"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/types"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// charsetEncodings are the non-utf8 charsets whose column values can be converted to utf8,
+// latin1 of MySQL is cp1252 actually.
+var charsetEncodings = map[string]encoding.Encoding{
+	"gbk":     simplifiedchinese.GBK,
+	"gb18030": simplifiedchinese.GB18030,
+	"latin1":  charmap.Windows1252,
+}
+
+// DefaultDecodeCharsets are the charsets decoded by default, TiDB encodes the values of the gbk
+// columns in gbk, but the values of the latin1 columns are kept as the bytes sent by the clients.
+var DefaultDecodeCharsets = []string{"gbk"}
+
+// Charsets are the charsets of the columns whose values are converted to utf8 in the SQLs and
+// the values of kafka and pb, the values of the other columns are kept as is.
+type Charsets map[string]encoding.Encoding
+
+// NewCharsets returns the Charsets of the names, or an error if any of them can't be decoded.
+func NewCharsets(names []string) (Charsets, error) {
+	charsets := make(Charsets, len(names))
+	for _, name := range names {
+		name = strings.ToLower(name)
+		enc, ok := charsetEncodings[name]
+		if !ok {
+			return nil, errors.Errorf("unsupported charset %s to decode, must be one of gbk, gb18030, latin1", name)
+		}
+		charsets[name] = enc
+	}
+	return charsets, nil
+}
+
+// decode converts the value of the column encoded in its charset to utf8, the value is
+// returned as is if the charset isn't decoded.
+func (cs Charsets) decode(ft *types.FieldType, value []byte) ([]byte, bool, error) {
+	if !isStringType(ft) {
+		return value, false, nil
+	}
+	enc, ok := cs[strings.ToLower(ft.Charset)]
+	if !ok {
+		return value, false, nil
+	}
+	decoded, err := enc.NewDecoder().Bytes(value)
+	if err != nil {
+		return nil, false, errors.Annotatef(err, "decode the value in %s", ft.Charset)
+	}
+	return decoded, true, nil
+}
+
+// isStringType returns whether the values of the column type are strings encoded in its charset.
+func isStringType(ft *types.FieldType) bool {
+	switch ft.Tp {
+	case mysql.TypeVarchar, mysql.TypeVarString, mysql.TypeString,
+		mysql.TypeTinyBlob, mysql.TypeMediumBlob, mysql.TypeLongBlob, mysql.TypeBlob:
+		return len(ft.Charset) > 0 && ft.Charset != charset.CharsetBin
+	}
+	return false
+}
+
+// columnCharset returns the charset of the string, enum or set column, empty for the other columns.
+func columnCharset(ft *types.FieldType) string {
+	isEnum := (ft.Tp == mysql.TypeEnum || ft.Tp == mysql.TypeSet) && len(ft.Charset) > 0
+	if !isStringType(ft) && !isEnum {
+		return ""
+	}
+	return ft.Charset
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
+)
+
+type testCharsetSuite struct{}
+
+var _ = check.Suite(&testCharsetSuite{})
+
+func charsetColumn(name string, tp byte, charset string) *model.ColumnInfo {
+	col := &model.ColumnInfo{Name: model.NewCIStr(name)}
+	col.Tp = tp
+	col.Charset = charset
+	return col
+}
+
+func (s *testCharsetSuite) TestFormatData(c *check.C) {
+	// "中文" in gbk and "café" in latin1.
+	gbk := []byte{0xd6, 0xd0, 0xce, 0xc4}
+	latin1 := []byte{'c', 'a', 'f', 0xe9}
+	gbkCol := charsetColumn("a", mysql.TypeVarchar, "gbk")
+	latin1Col := charsetColumn("b", mysql.TypeBlob, "latin1")
+	binaryCol := charsetColumn("c", mysql.TypeVarString, "binary")
+
+	// the values are kept as is if the charsets aren't decoded.
+	value, err := formatData(types.NewBytesDatum(gbk), gbkCol.FieldType, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(value.GetBytes(), check.DeepEquals, gbk)
+	col := DatumToColumn(gbkCol, types.NewBytesDatum(gbk), nil)
+	c.Assert([]byte(col.GetStringValue()), check.DeepEquals, gbk)
+
+	charsets, err := NewCharsets([]string{"GBK", "latin1"})
+	c.Assert(err, check.IsNil)
+	value, err = formatData(types.NewBytesDatum(gbk), gbkCol.FieldType, charsets)
+	c.Assert(err, check.IsNil)
+	c.Assert(value.GetValue(), check.Equals, "中文")
+	value, err = formatData(types.NewBytesDatum(latin1), latin1Col.FieldType, charsets)
+	c.Assert(err, check.IsNil)
+	c.Assert(value.GetValue(), check.Equals, "café")
+	value, err = formatData(types.NewBytesDatum(gbk), binaryCol.FieldType, charsets)
+	c.Assert(err, check.IsNil)
+	c.Assert(value.GetBytes(), check.DeepEquals, gbk)
+
+	col = DatumToColumn(gbkCol, types.NewBytesDatum(gbk), charsets)
+	c.Assert(col.GetStringValue(), check.Equals, "中文")
+}
+
+func (s *testCharsetSuite) TestColumnCharsets(c *check.C) {
+	table := &model.TableInfo{Name: model.NewCIStr("t"), Columns: []*model.ColumnInfo{
+		charsetColumn("a", mysql.TypeVarchar, "gbk"),
+		charsetColumn("b", mysql.TypeLong, "binary"),
+		charsetColumn("c", mysql.TypeBlob, "binary"),
+		charsetColumn("d", mysql.TypeEnum, "utf8mb4"),
+	}}
+	for i, col := range table.Columns {
+		col.ID, col.Offset, col.State = int64(i+1), i, model.StatePublic
+	}
+
+	// nothing is collected by default.
+	ctx := &Context{}
+	c.Assert(TableSchema(ctx, "test", table).ColumnInfo, check.HasLen, 4)
+	c.Assert(ctx.ColumnCharsets, check.IsNil)
+
+	ctx.ColumnCharsets = make(map[string]map[string]string)
+	TableSchema(ctx, "test", table)
+	c.Assert(ctx.ColumnCharsets, check.DeepEquals, map[string]map[string]string{
+		"test.t": {"a": "gbk", "d": "utf8mb4"},
+	})
+}
+
+func (s *testCharsetSuite) TestNewCharsets(c *check.C) {
+	charsets, err := NewCharsets(DefaultDecodeCharsets)
+	c.Assert(err, check.IsNil)
+	c.Assert(charsets, check.HasLen, 1)
+	charsets, err = NewCharsets([]string{"Latin1", "gb18030"})
+	c.Assert(err, check.IsNil)
+	c.Assert(charsets, check.HasLen, 2)
+	_, err = NewCharsets([]string{"big5"})
+	c.Assert(err, check.ErrorMatches, "unsupported charset big5 to decode.*")
+}
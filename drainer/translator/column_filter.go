@@ -0,0 +1,132 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+)
+
+// FilterTxnColumns removes the columns skipped by the filter from the DMLs of
+// the txn. If a column of the unique keys is skipped, the loader falls back to
+// locate the rows by the other columns.
+func FilterTxnColumns(txn *loader.Txn, filter *filter.ColumnFilter) {
+	for _, dml := range txn.DMLs {
+		skip := filter.SkipColumns(dml.Database, dml.Table)
+		if skip == nil {
+			continue
+		}
+
+		for name := range dml.Values {
+			if skip(name) {
+				delete(dml.Values, name)
+			}
+		}
+		for name := range dml.OldValues {
+			if skip(name) {
+				delete(dml.OldValues, name)
+			}
+		}
+	}
+}
+
+// FilterSecondaryBinlogColumns removes the columns skipped by the filter from
+// the column info and the rows of the tables, the unique keys containing them
+// are removed too.
+func FilterSecondaryBinlogColumns(binlog *obinlog.Binlog, filter *filter.ColumnFilter) {
+	if binlog.GetType() != obinlog.BinlogType_DML {
+		return
+	}
+
+	for _, table := range binlog.GetDmlData().GetTables() {
+		skip := filter.SkipColumns(table.GetSchemaName(), table.GetTableName())
+		if skip == nil {
+			continue
+		}
+
+		var kept []int
+		infos := table.ColumnInfo[:0]
+		for i, info := range table.GetColumnInfo() {
+			if !skip(info.GetName()) {
+				kept = append(kept, i)
+				infos = append(infos, info)
+			}
+		}
+		if len(infos) == len(table.ColumnInfo) {
+			continue
+		}
+		table.ColumnInfo = infos
+
+		for _, mut := range table.GetMutations() {
+			filterSecondaryRow(mut.GetRow(), kept)
+			filterSecondaryRow(mut.GetChangeRow(), kept)
+		}
+
+		keys := table.UniqueKeys[:0]
+	NextKey:
+		for _, key := range table.GetUniqueKeys() {
+			for _, name := range key.GetColumnNames() {
+				if skip(name) {
+					continue NextKey
+				}
+			}
+			keys = append(keys, key)
+		}
+		table.UniqueKeys = keys
+	}
+}
+
+func filterSecondaryRow(row *obinlog.Row, kept []int) {
+	if row == nil {
+		return
+	}
+
+	columns := make([]*obinlog.Column, 0, len(kept))
+	for _, i := range kept {
+		columns = append(columns, row.Columns[i])
+	}
+	row.Columns = columns
+}
+
+// FilterPbBinlogColumns removes the columns skipped by the filter from the
+// rows of the events.
+func FilterPbBinlogColumns(binlog *pb.Binlog, filter *filter.ColumnFilter) error {
+	if binlog.Tp != pb.BinlogType_DML {
+		return nil
+	}
+
+	for i := range binlog.GetDmlData().GetEvents() {
+		event := &binlog.DmlData.Events[i]
+		skip := filter.SkipColumns(event.GetSchemaName(), event.GetTableName())
+		if skip == nil {
+			continue
+		}
+
+		row := event.Row[:0]
+		for _, data := range event.Row {
+			col := new(pb.Column)
+			if err := col.Unmarshal(data); err != nil {
+				return errors.Annotatef(err, "unmarshal column of `%s`.`%s`", event.GetSchemaName(), event.GetTableName())
+			}
+			if !skip(col.Name) {
+				row = append(row, data)
+			}
+		}
+		event.Row = row
+	}
+	return nil
+}
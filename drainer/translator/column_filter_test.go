@@ -0,0 +1,135 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+)
+
+type testColumnFilterSuite struct{}
+
+var _ = check.Suite(&testColumnFilterSuite{})
+
+func newTestColumnFilter() *filter.ColumnFilter {
+	f, err := filter.NewColumnFilter([]filter.ColumnRule{{Schema: "test", Table: "t", Columns: []string{"blob", "name"}}})
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+func (s *testColumnFilterSuite) TestFilterTxnColumns(c *check.C) {
+	txn := &loader.Txn{DMLs: []*loader.DML{
+		{
+			Database:  "test",
+			Table:     "t",
+			Tp:        loader.UpdateDMLType,
+			Values:    map[string]interface{}{"id": 1, "blob": []byte("new"), "Name": "a"},
+			OldValues: map[string]interface{}{"id": 1, "blob": []byte("old"), "Name": "b"},
+		},
+		{
+			Database: "test",
+			Table:    "t1",
+			Tp:       loader.InsertDMLType,
+			Values:   map[string]interface{}{"id": 1, "blob": []byte("new")},
+		},
+	}}
+
+	FilterTxnColumns(txn, newTestColumnFilter())
+	c.Assert(txn.DMLs[0].Values, check.DeepEquals, map[string]interface{}{"id": 1})
+	c.Assert(txn.DMLs[0].OldValues, check.DeepEquals, map[string]interface{}{"id": 1})
+	c.Assert(txn.DMLs[1].Values, check.HasLen, 2)
+}
+
+func (s *testColumnFilterSuite) TestFilterSecondaryBinlogColumns(c *check.C) {
+	binlog := &obinlog.Binlog{
+		Type: obinlog.BinlogType_DML,
+		DmlData: &obinlog.DMLData{
+			Tables: []*obinlog.Table{{
+				SchemaName: proto.String("test"),
+				TableName:  proto.String("t"),
+				ColumnInfo: []*obinlog.ColumnInfo{
+					{Name: "id", MysqlType: "int"},
+					{Name: "blob", MysqlType: "blob"},
+					{Name: "name", MysqlType: "varchar"},
+				},
+				Mutations: []*obinlog.TableMutation{{
+					Type: obinlog.MutationType_Update.Enum(),
+					Row: &obinlog.Row{Columns: []*obinlog.Column{
+						{Int64Value: proto.Int64(1)},
+						{BytesValue: []byte("new")},
+						{StringValue: proto.String("a")},
+					}},
+					ChangeRow: &obinlog.Row{Columns: []*obinlog.Column{
+						{Int64Value: proto.Int64(1)},
+						{BytesValue: []byte("old")},
+						{StringValue: proto.String("b")},
+					}},
+				}, {
+					Type: obinlog.MutationType_Insert.Enum(),
+					Row: &obinlog.Row{Columns: []*obinlog.Column{
+						{Int64Value: proto.Int64(2)},
+						{BytesValue: []byte("new")},
+						{StringValue: proto.String("c")},
+					}},
+				}},
+				UniqueKeys: []*obinlog.Key{
+					{Name: proto.String("PRIMARY"), ColumnNames: []string{"id"}},
+					{Name: proto.String("uk"), ColumnNames: []string{"name"}},
+				},
+			}},
+		},
+	}
+
+	FilterSecondaryBinlogColumns(binlog, newTestColumnFilter())
+	table := binlog.DmlData.Tables[0]
+	c.Assert(table.ColumnInfo, check.DeepEquals, []*obinlog.ColumnInfo{{Name: "id", MysqlType: "int"}})
+	c.Assert(table.Mutations[0].Row.Columns, check.DeepEquals, []*obinlog.Column{{Int64Value: proto.Int64(1)}})
+	c.Assert(table.Mutations[0].ChangeRow.Columns, check.DeepEquals, []*obinlog.Column{{Int64Value: proto.Int64(1)}})
+	c.Assert(table.Mutations[1].Row.Columns, check.DeepEquals, []*obinlog.Column{{Int64Value: proto.Int64(2)}})
+	c.Assert(table.Mutations[1].ChangeRow, check.IsNil)
+	c.Assert(table.UniqueKeys, check.HasLen, 1)
+	c.Assert(table.UniqueKeys[0].GetName(), check.Equals, "PRIMARY")
+}
+
+func (s *testColumnFilterSuite) TestFilterPbBinlogColumns(c *check.C) {
+	var row [][]byte
+	for _, name := range []string{"id", "blob"} {
+		col := &pb.Column{Name: name, Tp: []byte{0}, MysqlType: "int", Value: []byte{1}}
+		data, err := col.Marshal()
+		c.Assert(err, check.IsNil)
+		row = append(row, data)
+	}
+	binlog := &pb.Binlog{
+		Tp: pb.BinlogType_DML,
+		DmlData: &pb.DMLData{Events: []pb.Event{
+			{SchemaName: proto.String("test"), TableName: proto.String("t"), Tp: pb.EventType_Insert, Row: append([][]byte{}, row...)},
+			{SchemaName: proto.String("test"), TableName: proto.String("t1"), Tp: pb.EventType_Insert, Row: append([][]byte{}, row...)},
+		}},
+	}
+
+	err := FilterPbBinlogColumns(binlog, newTestColumnFilter())
+	c.Assert(err, check.IsNil)
+	c.Assert(binlog.DmlData.Events[0].Row, check.DeepEquals, row[:1])
+	c.Assert(binlog.DmlData.Events[1].Row, check.DeepEquals, row)
+
+	binlog.DmlData.Events[0].Row = [][]byte{{0xff}}
+	err = FilterPbBinlogColumns(binlog, newTestColumnFilter())
+	c.Assert(err, check.ErrorMatches, ".*unmarshal column of `test`.`t`.*")
+}
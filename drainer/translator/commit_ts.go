@@ -0,0 +1,94 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/types"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+// The columns annotating the rows written to downstream with the commit ts of their transactions.
+const (
+	// CommitTSColumn is the commit ts of the transaction, BIGINT.
+	CommitTSColumn = "_tidb_commit_ts"
+	// CommitTimeColumn is the physical time of the commit ts in UTC, DATETIME(3).
+	CommitTimeColumn = "_tidb_commit_time"
+)
+
+// commitTimeFormat is the format of CommitTimeColumn, the physical time of the ts is in milliseconds.
+const commitTimeFormat = "2006-01-02 15:04:05.000"
+
+// CommitTime returns the value of CommitTimeColumn of the commit ts.
+func CommitTime(commitTS int64) string {
+	ms := oracle.ExtractPhysical(uint64(commitTS))
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC().Format(commitTimeFormat)
+}
+
+// AddCommitTSColumns sets the commit ts columns of the inserted and updated rows of the tables
+// matched by match. The old values of the updates and the deleted rows are left alone, so the
+// rows are still located by their own columns.
+func AddCommitTSColumns(txn *loader.Txn, commitTS int64, match func(schema string, table string) bool) {
+	commitTime := CommitTime(commitTS)
+	for _, dml := range txn.DMLs {
+		if dml.Tp == loader.DeleteDMLType || !match(dml.Database, dml.Table) {
+			continue
+		}
+		dml.Values[CommitTSColumn] = commitTS
+		dml.Values[CommitTimeColumn] = commitTime
+	}
+}
+
+// AddCommitTSColumnsToDDL appends the commit ts columns to the CREATE TABLE DDL, so the table created
+// in downstream can hold them. Other DDLs, CREATE TABLE ... LIKE and the tables having the columns
+// already are returned unchanged.
+func AddCommitTSColumnsToDDL(sql string) (string, error) {
+	stmt, err := getParser(sqlMode).ParseOneStmt(sql, "", "")
+	if err != nil {
+		return "", errorcode.Newf(errorcode.TranslatorUnsupportedDDL, "parse ddl %s failed: %v", sql, err)
+	}
+
+	create, ok := stmt.(*ast.CreateTableStmt)
+	if !ok || create.ReferTable != nil || create.Select != nil {
+		return sql, nil
+	}
+	for _, col := range create.Cols {
+		if col.Name.Name.L == CommitTSColumn || col.Name.Name.L == CommitTimeColumn {
+			return sql, nil
+		}
+	}
+
+	tsType := types.NewFieldType(mysql.TypeLonglong)
+	timeType := types.NewFieldType(mysql.TypeDatetime)
+	timeType.Decimal = 3
+	create.Cols = append(create.Cols,
+		&ast.ColumnDef{Name: &ast.ColumnName{Name: model.NewCIStr(CommitTSColumn)}, Tp: tsType},
+		&ast.ColumnDef{Name: &ast.ColumnName{Name: model.NewCIStr(CommitTimeColumn)}, Tp: timeType},
+	)
+
+	var sb strings.Builder
+	if err = stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+		return "", errors.Annotatef(err, "restore ddl %s failed", sql)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+)
+
+type commitTSSuite struct{}
+
+var _ = check.Suite(&commitTSSuite{})
+
+func (s *commitTSSuite) TestCommitTime(c *check.C) {
+	ts := int64(oracle.ComposeTS(1609459200123, 5))
+	c.Assert(CommitTime(ts), check.Equals, "2021-01-01 00:00:00.123")
+}
+
+func (s *commitTSSuite) TestAddCommitTSColumns(c *check.C) {
+	insert := &loader.DML{Tp: loader.InsertDMLType, Database: "test", Table: "t", Values: map[string]interface{}{"id": 1}}
+	update := &loader.DML{Tp: loader.UpdateDMLType, Database: "test", Table: "t",
+		Values: map[string]interface{}{"id": 2}, OldValues: map[string]interface{}{"id": 1}}
+	del := &loader.DML{Tp: loader.DeleteDMLType, Database: "test", Table: "t", Values: map[string]interface{}{"id": 2}}
+	other := &loader.DML{Tp: loader.InsertDMLType, Database: "test", Table: "other", Values: map[string]interface{}{"id": 1}}
+	txn := &loader.Txn{DMLs: []*loader.DML{insert, update, del, other}}
+
+	ts := int64(oracle.ComposeTS(1609459200123, 5))
+	AddCommitTSColumns(txn, ts, func(schema string, table string) bool { return table == "t" })
+
+	expected := map[string]interface{}{"id": 1, CommitTSColumn: ts, CommitTimeColumn: "2021-01-01 00:00:00.123"}
+	c.Assert(insert.Values, check.DeepEquals, expected)
+	c.Assert(update.Values[CommitTSColumn], check.Equals, ts)
+	c.Assert(update.OldValues, check.DeepEquals, map[string]interface{}{"id": 1})
+	c.Assert(del.Values, check.HasLen, 1)
+	c.Assert(other.Values, check.HasLen, 1)
+}
+
+func (s *commitTSSuite) TestAddCommitTSColumnsToDDL(c *check.C) {
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"create table t(id int primary key)",
+			"CREATE TABLE `t` (`id` INT PRIMARY KEY,`_tidb_commit_ts` BIGINT,`_tidb_commit_time` DATETIME(3))"},
+		{"create table t(id int, _tidb_commit_ts bigint)", "create table t(id int, _tidb_commit_ts bigint)"},
+		{"create table t like s", "create table t like s"},
+		{"alter table t add column a int", "alter table t add column a int"},
+	}
+	for _, test := range tests {
+		sql, err := AddCommitTSColumnsToDDL(test.sql)
+		c.Assert(err, check.IsNil)
+		c.Assert(sql, check.Equals, test.expected, check.Commentf("sql: %s", test.sql))
+	}
+
+	_, err := AddCommitTSColumnsToDDL("create tabel t")
+	c.Assert(err, check.NotNil)
+}
@@ -0,0 +1,198 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/types"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+)
+
+// The versions of downstream MySQL the DDL can be rewritten for.
+const (
+	DownstreamVersion56 = "5.6"
+	DownstreamVersion57 = "5.7"
+	DownstreamVersion80 = "8.0"
+)
+
+// IsValidDownstreamVersion returns true if the DDL can be rewritten for the version,
+// an empty version means no rewriting.
+func IsValidDownstreamVersion(version string) bool {
+	switch version {
+	case "", DownstreamVersion56, DownstreamVersion57, DownstreamVersion80:
+		return true
+	default:
+		return false
+	}
+}
+
+// RewriteDDLForDownstream rewrites the DDL so that it can be executed by the
+// specified version of MySQL, syntax the version doesn't support is removed:
+//   - 5.7 and 5.6: invisible index, expression index, CHECK constraint, expression default value
+//   - 5.6 only: the JSON type is replaced by LONGTEXT
+//
+// The DDL is returned unchanged if nothing needs to be rewritten, and an empty
+// string is returned if nothing remains to be executed. An expression index is
+// skipped as a whole, dropping it later fails with ErrCantDropFieldOrKey at
+// downstream, which is ignored by the loader.
+func RewriteDDLForDownstream(sql string, version string) (string, error) {
+	if version != DownstreamVersion56 && version != DownstreamVersion57 {
+		return sql, nil
+	}
+
+	stmt, err := getParser(sqlMode).ParseOneStmt(sql, "", "")
+	if err != nil {
+		return "", errorcode.Newf(errorcode.TranslatorUnsupportedDDL, "parse ddl %s failed: %v", sql, err)
+	}
+
+	r := &ddlRewriter{version: version}
+	switch n := stmt.(type) {
+	case *ast.CreateTableStmt:
+		r.rewriteCreateTable(n)
+	case *ast.CreateIndexStmt:
+		if isExpressionIndex(n.IndexPartSpecifications) {
+			return "", nil
+		}
+		r.rewriteIndexOption(n.IndexOption)
+	case *ast.AlterTableStmt:
+		r.rewriteAlterTable(n)
+		if len(n.Specs) == 0 {
+			return "", nil
+		}
+	}
+
+	if !r.changed {
+		return sql, nil
+	}
+
+	var sb strings.Builder
+	if err = stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+		return "", errors.Annotatef(err, "restore ddl %s failed", sql)
+	}
+	return sb.String(), nil
+}
+
+type ddlRewriter struct {
+	version string
+	changed bool
+}
+
+func (r *ddlRewriter) rewriteCreateTable(n *ast.CreateTableStmt) {
+	for _, col := range n.Cols {
+		r.rewriteColumn(col)
+	}
+	n.Constraints = r.rewriteConstraints(n.Constraints)
+}
+
+func (r *ddlRewriter) rewriteAlterTable(n *ast.AlterTableStmt) {
+	specs := n.Specs[:0]
+	for _, spec := range n.Specs {
+		switch spec.Tp {
+		case ast.AlterTableIndexInvisible, ast.AlterTableAlterCheck, ast.AlterTableDropCheck:
+			r.changed = true
+			continue
+		case ast.AlterTableAddConstraint:
+			if len(r.rewriteConstraints([]*ast.Constraint{spec.Constraint})) == 0 {
+				continue
+			}
+		case ast.AlterTableAddColumns, ast.AlterTableModifyColumn, ast.AlterTableChangeColumn:
+			for _, col := range spec.NewColumns {
+				r.rewriteColumn(col)
+			}
+			spec.NewConstraints = r.rewriteConstraints(spec.NewConstraints)
+		}
+		specs = append(specs, spec)
+	}
+	n.Specs = specs
+}
+
+func (r *ddlRewriter) rewriteConstraints(constraints []*ast.Constraint) []*ast.Constraint {
+	kept := constraints[:0]
+	for _, constraint := range constraints {
+		if constraint.Tp == ast.ConstraintCheck || isExpressionIndex(constraint.Keys) {
+			r.changed = true
+			continue
+		}
+		r.rewriteIndexOption(constraint.Option)
+		kept = append(kept, constraint)
+	}
+	return kept
+}
+
+func (r *ddlRewriter) rewriteIndexOption(option *ast.IndexOption) {
+	if option != nil && option.Visibility != ast.IndexVisibilityDefault {
+		option.Visibility = ast.IndexVisibilityDefault
+		r.changed = true
+	}
+}
+
+func (r *ddlRewriter) rewriteColumn(col *ast.ColumnDef) {
+	if r.version == DownstreamVersion56 && col.Tp != nil && col.Tp.Tp == mysql.TypeJSON {
+		col.Tp.Tp = mysql.TypeLongBlob
+		col.Tp.Flen = types.UnspecifiedLength
+		col.Tp.Charset = mysql.DefaultCharset
+		col.Tp.Collate = mysql.DefaultCollationName
+		col.Tp.Flag &^= mysql.BinaryFlag
+		r.changed = true
+	}
+
+	options := col.Options[:0]
+	for _, option := range col.Options {
+		switch option.Tp {
+		case ast.ColumnOptionCheck:
+			r.changed = true
+			continue
+		case ast.ColumnOptionDefaultValue:
+			if isExpressionDefault(option.Expr) {
+				r.changed = true
+				continue
+			}
+		}
+		options = append(options, option)
+	}
+	col.Options = options
+}
+
+// isExpressionIndex returns true if any key part of the index is an expression,
+// which is only supported since MySQL 8.0.13.
+func isExpressionIndex(keys []*ast.IndexPartSpecification) bool {
+	for _, key := range keys {
+		if key.Expr != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isExpressionDefault returns true if the default value is neither a literal
+// nor CURRENT_TIMESTAMP, which is only supported since MySQL 8.0.13.
+func isExpressionDefault(expr ast.ExprNode) bool {
+	switch e := expr.(type) {
+	case ast.ValueExpr:
+		return false
+	case *ast.UnaryOperationExpr:
+		return isExpressionDefault(e.V)
+	case *ast.FuncCallExpr:
+		switch e.FnName.L {
+		case ast.CurrentTimestamp, ast.Now, ast.LocalTime, ast.LocalTimestamp:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"github.com/pingcap/check"
+)
+
+type ddlCompatSuite struct{}
+
+var _ = check.Suite(&ddlCompatSuite{})
+
+func (s *ddlCompatSuite) TestIsValidDownstreamVersion(c *check.C) {
+	for _, version := range []string{"", "5.6", "5.7", "8.0"} {
+		c.Assert(IsValidDownstreamVersion(version), check.IsTrue)
+	}
+	c.Assert(IsValidDownstreamVersion("5.5"), check.IsFalse)
+}
+
+func (s *ddlCompatSuite) TestRewriteDDLForDownstream(c *check.C) {
+	createTable := "create table t(id int primary key, a int default -1, b int default next value for s, c json, " +
+		"d timestamp default current_timestamp, e int check (e < 10), index idx(a) invisible, check (a > 0))"
+
+	tests := []struct {
+		sql      string
+		version  string
+		expected string
+	}{
+		{createTable, "", createTable},
+		{createTable, "8.0", createTable},
+		{createTable, "5.7", "CREATE TABLE `t` (`id` INT PRIMARY KEY,`a` INT DEFAULT -1,`b` INT,`c` JSON," +
+			"`d` TIMESTAMP DEFAULT CURRENT_TIMESTAMP(),`e` INT,INDEX `idx`(`a`) )"},
+		{createTable, "5.6", "CREATE TABLE `t` (`id` INT PRIMARY KEY,`a` INT DEFAULT -1,`b` INT," +
+			"`c` LONGTEXT CHARACTER SET UTF8MB4 COLLATE utf8mb4_bin,`d` TIMESTAMP DEFAULT CURRENT_TIMESTAMP(),`e` INT,INDEX `idx`(`a`) )"},
+		{"create table t2(id int)", "5.6", "create table t2(id int)"},
+		{"create index i on t(a) invisible", "5.7", "CREATE INDEX `i` ON `t` (`a`)"},
+		{"alter table t alter index idx invisible", "5.7", ""},
+		{"alter table t add constraint ck check (a > 0)", "5.7", ""},
+		{"alter table t add column f int default 1, alter index idx visible", "5.7", "ALTER TABLE `t` ADD COLUMN `f` INT DEFAULT 1"},
+		{"create table t3(id int primary key, a int, index idx1((a + 1)), unique idx2(a, (a * 2)), index idx3(a))", "5.7",
+			"CREATE TABLE `t3` (`id` INT PRIMARY KEY,`a` INT,INDEX `idx3`(`a`))"},
+		{"create table t3(id int, index idx1((a + 1)))", "8.0", "create table t3(id int, index idx1((a + 1)))"},
+		{"create index i on t((lower(a)))", "5.7", ""},
+		{"create index i on t((lower(a)))", "8.0", "create index i on t((lower(a)))"},
+		{"alter table t add index i((a + 1)), add column h int", "5.6", "ALTER TABLE `t` ADD COLUMN `h` INT"},
+		{"alter table t add unique i((a + 1))", "5.7", ""},
+		{"alter table t add column g json", "5.7", "alter table t add column g json"},
+		{"alter table t add column g json", "5.6", "ALTER TABLE `t` ADD COLUMN `g` LONGTEXT CHARACTER SET UTF8MB4 COLLATE utf8mb4_bin"},
+		{"drop table t", "5.6", "drop table t"},
+	}
+
+	for _, test := range tests {
+		sql, err := RewriteDDLForDownstream(test.sql, test.version)
+		c.Assert(err, check.IsNil)
+		c.Assert(sql, check.Equals, test.expected, check.Commentf("sql: %s, version: %s", test.sql, test.version))
+	}
+
+	_, err := RewriteDDLForDownstream("create tabl t(id int)", "5.6")
+	c.Assert(err, check.NotNil)
+}
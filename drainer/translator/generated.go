@@ -0,0 +1,213 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb/expression"
+	// register the rewriter of the expressions.
+	_ "github.com/pingcap/tidb/planner/core"
+	"github.com/pingcap/tidb/sessionctx"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/chunk"
+	"github.com/pingcap/tidb/util/mock"
+)
+
+// The modes of the generated columns in the DMLs.
+const (
+	// GeneratedColumnsOmit omits the generated columns, the values of them
+	// can't be specified in MySQL.
+	GeneratedColumnsOmit = "omit"
+	// GeneratedColumnsStored includes the stored generated columns, whose
+	// values are in the binlog.
+	GeneratedColumnsStored = "stored"
+	// GeneratedColumnsAll includes all the generated columns, the values of
+	// the virtual ones are evaluated by their expressions.
+	GeneratedColumnsAll = "all"
+)
+
+// IsValidGeneratedColumnsMode returns true if the mode is supported.
+func IsValidGeneratedColumnsMode(mode string) bool {
+	switch mode {
+	case "", GeneratedColumnsOmit, GeneratedColumnsStored, GeneratedColumnsAll:
+		return true
+	default:
+		return false
+	}
+}
+
+// generatedColumnsMode returns the mode of the generated columns of the table,
+// defaultMode is used if it's not set.
+func (ctx *Context) generatedColumnsMode(schema string, table string, defaultMode string) string {
+	if ctx.GeneratedColumns == nil {
+		return defaultMode
+	}
+	if mode := ctx.GeneratedColumns(schema, table); len(mode) > 0 {
+		return mode
+	}
+	return defaultMode
+}
+
+// includeColumn returns true if the column is in the DMLs by the mode, the hidden
+// columns of the expression indexes are never included.
+func includeColumn(col *model.ColumnInfo, mode string) bool {
+	if col.Hidden {
+		return false
+	}
+	if !col.IsGenerated() {
+		return true
+	}
+	switch mode {
+	case GeneratedColumnsStored:
+		return col.GeneratedStored
+	case GeneratedColumnsAll:
+		return true
+	default:
+		return false
+	}
+}
+
+// dmlColumns returns the public columns in the DMLs by the mode.
+func dmlColumns(table *model.TableInfo, mode string) []*model.ColumnInfo {
+	cols := make([]*model.ColumnInfo, 0, len(table.Columns))
+	for _, col := range table.Columns {
+		if col.State == model.StatePublic && includeColumn(col, mode) {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// filterColumns returns the columns in the DMLs by the mode, the non-public columns are kept.
+func filterColumns(columns []*model.ColumnInfo, mode string) []*model.ColumnInfo {
+	cols := make([]*model.ColumnInfo, 0, len(columns))
+	for _, col := range columns {
+		if includeColumn(col, mode) {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// decodeColumns returns the public columns decoded from the rows of the binlog,
+// the virtual generated columns are never in the binlog.
+func decodeColumns(table *model.TableInfo, mode string) []*model.ColumnInfo {
+	if mode == GeneratedColumnsAll {
+		mode = GeneratedColumnsStored
+	}
+	return dmlColumns(table, mode)
+}
+
+// isVirtualColumn returns true if the column is a virtual generated column in the DMLs.
+func isVirtualColumn(col *model.ColumnInfo) bool {
+	return col.IsGenerated() && !col.GeneratedStored && !col.Hidden
+}
+
+// hasVirtualColumns returns true if the table has any virtual generated column.
+func hasVirtualColumns(table *model.TableInfo) bool {
+	for _, col := range table.Columns {
+		if isVirtualColumn(col) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasHiddenColumns returns true if the index is an expression index on the hidden columns.
+func hasHiddenColumns(table *model.TableInfo, index *model.IndexInfo) bool {
+	for _, col := range index.Columns {
+		if table.Columns[col.Offset].Hidden {
+			return true
+		}
+	}
+	return false
+}
+
+// virtualExprs are the expressions of the virtual generated columns of a table,
+// the expressions are evaluated with the session they're built by, so they're
+// evaluated one by one.
+type virtualExprs struct {
+	// updateTS is the version of the table the expressions are built by.
+	updateTS uint64
+
+	mu    sync.Mutex
+	sctx  sessionctx.Context
+	cols  []*model.ColumnInfo
+	exprs []expression.Expression
+}
+
+// virtualExprsCache caches the virtualExprs by the table id, the entry is replaced when the
+// table is changed, so only the latest version of every table is kept.
+var virtualExprsCache sync.Map
+
+func getVirtualExprs(table *model.TableInfo) (*virtualExprs, error) {
+	if v, ok := virtualExprsCache.Load(table.ID); ok && v.(*virtualExprs).updateTS == table.UpdateTS {
+		return v.(*virtualExprs), nil
+	}
+
+	ve := &virtualExprs{updateTS: table.UpdateTS, sctx: mock.NewContext()}
+	for _, col := range table.Columns {
+		if !isVirtualColumn(col) {
+			continue
+		}
+		expr, err := expression.ParseSimpleExprWithTableInfo(ve.sctx, col.GeneratedExprString, table)
+		if err != nil {
+			return nil, errors.Annotatef(err, "parse the expression of generated column %s", col.Name)
+		}
+		ve.cols = append(ve.cols, col)
+		ve.exprs = append(ve.exprs, expr)
+	}
+	virtualExprsCache.Store(table.ID, ve)
+	return ve, nil
+}
+
+// evalVirtualColumns evaluates the values of the virtual generated columns by the values
+// of the other columns in the row if the mode includes them, the columns not in the row
+// are evaluated as NULL.
+func evalVirtualColumns(table *model.TableInfo, mode string, row map[int64]types.Datum) error {
+	if mode != GeneratedColumnsAll || len(row) == 0 || !hasVirtualColumns(table) {
+		return nil
+	}
+	ve, err := getVirtualExprs(table)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	datums := make([]types.Datum, len(table.Columns))
+	for _, col := range table.Columns {
+		if v, ok := row[col.ID]; ok {
+			datums[col.Offset] = v
+		}
+	}
+
+	ve.mu.Lock()
+	defer ve.mu.Unlock()
+	sc := ve.sctx.GetSessionVars().StmtCtx
+	// the virtual columns may refer to the virtual columns before them.
+	for i, col := range ve.cols {
+		v, err := ve.exprs[i].Eval(chunk.MutRowFromDatums(datums).ToRow())
+		if err != nil {
+			return errors.Annotatef(err, "eval generated column %s", col.Name)
+		}
+		if v, err = v.ConvertTo(sc, &col.FieldType); err != nil {
+			return errors.Annotatef(err, "convert generated column %s", col.Name)
+		}
+		datums[col.Offset] = v
+		row[col.ID] = v
+	}
+	return nil
+}
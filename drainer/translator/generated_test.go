@@ -0,0 +1,177 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"time"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+type testGeneratedSuite struct{}
+
+var _ = check.Suite(&testGeneratedSuite{})
+
+// testGenContactsTable returns the table like gen_contacts of dailytest:
+// create table gen_contacts(
+//
+//	id int, first_name varchar(50), last_name varchar(50),
+//	fullname varchar(101) generated always as (concat(first_name,' ',last_name)),
+//	initial varchar(101) generated always as (concat(left(first_name, 1),' ',left(last_name,1))) stored)
+func testGenContactsTable() *model.TableInfo {
+	varchar := func(flen int) types.FieldType {
+		return types.FieldType{Tp: mysql.TypeVarchar, Flen: flen, Decimal: -1, Charset: "utf8mb4", Collate: "utf8mb4_bin"}
+	}
+	t := &model.TableInfo{ID: 100, Name: model.NewCIStr("gen_contacts"), State: model.StatePublic, UpdateTS: 1}
+	t.Columns = []*model.ColumnInfo{
+		{ID: 1, Name: model.NewCIStr("id"), Offset: 0, State: model.StatePublic,
+			FieldType: types.FieldType{Tp: mysql.TypeLong, Flen: 11, Decimal: -1, Charset: "binary", Collate: "binary"}},
+		{ID: 2, Name: model.NewCIStr("first_name"), Offset: 1, State: model.StatePublic, FieldType: varchar(50)},
+		{ID: 3, Name: model.NewCIStr("last_name"), Offset: 2, State: model.StatePublic, FieldType: varchar(50)},
+		{ID: 4, Name: model.NewCIStr("fullname"), Offset: 3, State: model.StatePublic, FieldType: varchar(101),
+			GeneratedExprString: "concat(`first_name`, ' ', `last_name`)"},
+		{ID: 5, Name: model.NewCIStr("initial"), Offset: 4, State: model.StatePublic, FieldType: varchar(101),
+			GeneratedExprString: "concat(left(`first_name`, 1), ' ', left(`last_name`, 1))", GeneratedStored: true},
+	}
+	return t
+}
+
+// testEncodeContact encodes the row without the virtual column as TiDB does.
+func testEncodeContact(c *check.C, id int64, first, last string) []byte {
+	sc := &stmtctx.StatementContext{TimeZone: time.Local}
+	row := []types.Datum{
+		types.NewIntDatum(id),
+		types.NewStringDatum(first),
+		types.NewStringDatum(last),
+		types.NewStringDatum(first[:1] + " " + last[:1]),
+	}
+	value, err := tablecodec.EncodeOldRow(sc, row, []int64{1, 2, 3, 5}, nil, nil)
+	c.Assert(err, check.IsNil)
+	return value
+}
+
+func (s *testGeneratedSuite) TestIsValidGeneratedColumnsMode(c *check.C) {
+	for _, mode := range []string{"", GeneratedColumnsOmit, GeneratedColumnsStored, GeneratedColumnsAll} {
+		c.Assert(IsValidGeneratedColumnsMode(mode), check.IsTrue)
+	}
+	c.Assert(IsValidGeneratedColumnsMode("virtual"), check.IsFalse)
+}
+
+func (s *testGeneratedSuite) TestGenMysqlInsert(c *check.C) {
+	table := testGenContactsTable()
+	sc := &stmtctx.StatementContext{TimeZone: time.Local}
+	handle, err := codec.EncodeValue(sc, nil, types.NewIntDatum(1))
+	c.Assert(err, check.IsNil)
+	row := append(handle, testEncodeContact(c, 1, "John", "Smith")...)
+
+	names, args, err := genMysqlInsert("test", table, table, row, GeneratedColumnsOmit, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(names, check.DeepEquals, []string{"id", "first_name", "last_name"})
+	c.Assert(args, check.HasLen, 3)
+
+	names, args, err = genMysqlInsert("test", table, table, row, GeneratedColumnsStored, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(names, check.DeepEquals, []string{"id", "first_name", "last_name", "initial"})
+	c.Assert(args[3], check.DeepEquals, "J S")
+
+	names, args, err = genMysqlInsert("test", table, table, row, GeneratedColumnsAll, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(names, check.DeepEquals, []string{"id", "first_name", "last_name", "fullname", "initial"})
+	c.Assert(args[3], check.DeepEquals, "John Smith")
+	c.Assert(args[4], check.DeepEquals, "J S")
+}
+
+func (s *testGeneratedSuite) TestGenMysqlUpdate(c *check.C) {
+	table := testGenContactsTable()
+	row := append(testEncodeContact(c, 1, "John", "Smith"), testEncodeContact(c, 1, "Jane", "Doe")...)
+
+	names, values, oldValues, err := genMysqlUpdate("test", table, table, row, false, GeneratedColumnsOmit, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(names, check.DeepEquals, []string{"id", "first_name", "last_name"})
+	c.Assert(values, check.HasLen, 3)
+	c.Assert(oldValues, check.HasLen, 3)
+
+	names, values, oldValues, err = genMysqlUpdate("test", table, table, row, false, GeneratedColumnsAll, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(names, check.DeepEquals, []string{"id", "first_name", "last_name", "fullname", "initial"})
+	c.Assert(oldValues[3], check.DeepEquals, "John Smith")
+	c.Assert(values[3], check.DeepEquals, "Jane Doe")
+	c.Assert(values[4], check.DeepEquals, "J D")
+}
+
+func (s *testGeneratedSuite) TestGeneratedColumnsMode(c *check.C) {
+	ctx := &Context{}
+	c.Assert(ctx.generatedColumnsMode("test", "t", GeneratedColumnsAll), check.Equals, GeneratedColumnsAll)
+
+	ctx.GeneratedColumns = func(schema string, table string) string {
+		if table == "gen_contacts" {
+			return GeneratedColumnsStored
+		}
+		return ""
+	}
+	c.Assert(ctx.generatedColumnsMode("test", "gen_contacts", GeneratedColumnsOmit), check.Equals, GeneratedColumnsStored)
+	c.Assert(ctx.generatedColumnsMode("test", "t", GeneratedColumnsOmit), check.Equals, GeneratedColumnsOmit)
+}
+
+func (s *testGeneratedSuite) TestExpressionIndex(c *check.C) {
+	// alter table gen_contacts add unique index idx((lower(first_name)))
+	table := testGenContactsTable()
+	table.Columns = append(table.Columns, &model.ColumnInfo{ID: 6, Name: model.NewCIStr("_V$_idx_0"), Offset: 5,
+		State: model.StatePublic, Hidden: true, GeneratedExprString: "lower(`first_name`)",
+		FieldType: types.FieldType{Tp: mysql.TypeVarchar, Flen: 50, Decimal: -1, Charset: "utf8mb4", Collate: "utf8mb4_bin"}})
+	table.Indices = []*model.IndexInfo{{Name: model.NewCIStr("idx"), Unique: true, State: model.StatePublic,
+		Columns: []*model.IndexColumn{{Name: model.NewCIStr("_V$_idx_0"), Offset: 5, Length: types.UnspecifiedLength}}}}
+	c.Assert(hasHiddenColumns(table, table.Indices[0]), check.IsTrue)
+
+	sc := &stmtctx.StatementContext{TimeZone: time.Local}
+	handle, err := codec.EncodeValue(sc, nil, types.NewIntDatum(1))
+	c.Assert(err, check.IsNil)
+	row := append(handle, testEncodeContact(c, 1, "John", "Smith")...)
+
+	names, args, err := genMysqlInsert("test", table, table, row, GeneratedColumnsAll, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(names, check.DeepEquals, []string{"id", "first_name", "last_name", "fullname", "initial"})
+	c.Assert(args, check.HasLen, 5)
+
+	info := genTable(&Context{}, "test", table, GeneratedColumnsAll)
+	c.Assert(info.ColumnInfo, check.HasLen, 5)
+	c.Assert(info.UniqueKeys, check.HasLen, 0)
+}
+
+func (s *testGeneratedSuite) TestVirtualExprsCache(c *check.C) {
+	table := testGenContactsTable()
+	table.ID = 101
+	ve, err := getVirtualExprs(table)
+	c.Assert(err, check.IsNil)
+	cached, err := getVirtualExprs(table)
+	c.Assert(err, check.IsNil)
+	c.Assert(cached, check.Equals, ve)
+
+	// the entry of the table is replaced when the table is changed.
+	table.UpdateTS = 2
+	table.Columns[3].GeneratedExprString = "concat(`last_name`, ' ', `first_name`)"
+	changed, err := getVirtualExprs(table)
+	c.Assert(err, check.IsNil)
+	c.Assert(changed, check.Not(check.Equals), ve)
+	c.Assert(changed.updateTS, check.Equals, uint64(2))
+	v, ok := virtualExprsCache.Load(table.ID)
+	c.Assert(ok, check.IsTrue)
+	c.Assert(v, check.Equals, changed)
+}
@@ -0,0 +1,187 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+)
+
+// The representations of the JSON columns updated.
+const (
+	// JSONUpdateFull keeps the full documents of both the old and new value.
+	JSONUpdateFull = "full"
+	// JSONUpdatePatch replaces the new value by a JSON merge patch (RFC 7386)
+	// against the old value, the old value is kept as the full document.
+	JSONUpdatePatch = "patch"
+	// JSONUpdateDiff replaces the new value by a JSON merge patch against the
+	// old value, and the old value by a merge patch against the new value,
+	// so only the old and new values of the changed members are kept.
+	JSONUpdateDiff = "diff"
+)
+
+// IsValidJSONUpdateFormat returns true if the format is supported.
+func IsValidJSONUpdateFormat(format string) bool {
+	switch format {
+	case "", JSONUpdateFull, JSONUpdatePatch, JSONUpdateDiff:
+		return true
+	default:
+		return false
+	}
+}
+
+// ToJSONPartialUpdate rewrites the values of the JSON columns in the update
+// mutations to the format returned by formatOf for the table.
+//
+// A full JSON document is carried by Column.BytesValue, while a merge patch is
+// carried by Column.StringValue, so consumers can tell them apart. The values
+// are kept as full documents if either of them is not a JSON object, or the
+// changes can't be expressed by a merge patch, like setting a member to null.
+func ToJSONPartialUpdate(binlog *obinlog.Binlog, formatOf func(schema, table string) string) {
+	if binlog.GetType() != obinlog.BinlogType_DML {
+		return
+	}
+
+	for _, table := range binlog.GetDmlData().GetTables() {
+		format := formatOf(table.GetSchemaName(), table.GetTableName())
+		if format != JSONUpdatePatch && format != JSONUpdateDiff {
+			continue
+		}
+
+		for i, info := range table.GetColumnInfo() {
+			if info.GetMysqlType() != "json" {
+				continue
+			}
+
+			for _, mut := range table.GetMutations() {
+				if mut.GetType() != obinlog.MutationType_Update {
+					continue
+				}
+				newCol := mut.GetRow().GetColumns()[i]
+				oldCol := mut.GetChangeRow().GetColumns()[i]
+				toJSONPartialUpdate(format, oldCol, newCol)
+			}
+		}
+	}
+}
+
+func toJSONPartialUpdate(format string, oldCol, newCol *obinlog.Column) {
+	if oldCol.GetIsNull() || newCol.GetIsNull() {
+		return
+	}
+
+	oldDoc, ok := decodeJSONObject(oldCol.GetBytesValue())
+	if !ok {
+		return
+	}
+	newDoc, ok := decodeJSONObject(newCol.GetBytesValue())
+	if !ok {
+		return
+	}
+
+	patch, ok := createMergePatch(oldDoc, newDoc)
+	if !ok {
+		return
+	}
+	var reversePatch map[string]interface{}
+	if format == JSONUpdateDiff {
+		if reversePatch, ok = createMergePatch(newDoc, oldDoc); !ok {
+			return
+		}
+	}
+
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return
+	}
+	newCol.BytesValue = nil
+	newCol.StringValue = proto.String(string(data))
+
+	if format == JSONUpdateDiff {
+		data, err = json.Marshal(reversePatch)
+		if err != nil {
+			return
+		}
+		oldCol.BytesValue = nil
+		oldCol.StringValue = proto.String(string(data))
+	}
+}
+
+func decodeJSONObject(data []byte) (map[string]interface{}, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil || doc == nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+// createMergePatch creates a JSON merge patch which turns from into to, false
+// is returned if a member of to is null, which can't be expressed by a merge patch.
+func createMergePatch(from, to map[string]interface{}) (map[string]interface{}, bool) {
+	patch := make(map[string]interface{})
+	for key, toVal := range to {
+		if toVal == nil {
+			return nil, false
+		}
+
+		fromVal, ok := from[key]
+		if ok && reflect.DeepEqual(fromVal, toVal) {
+			continue
+		}
+
+		fromObj, fromIsObj := fromVal.(map[string]interface{})
+		toObj, toIsObj := toVal.(map[string]interface{})
+		if ok && fromIsObj && toIsObj {
+			sub, ok := createMergePatch(fromObj, toObj)
+			if !ok {
+				return nil, false
+			}
+			patch[key] = sub
+			continue
+		}
+
+		if toIsObj && containsNull(toObj) {
+			return nil, false
+		}
+		patch[key] = toVal
+	}
+
+	for key := range from {
+		if _, ok := to[key]; !ok {
+			patch[key] = nil
+		}
+	}
+	return patch, true
+}
+
+// containsNull returns true if any member of the object is null, a null member
+// in the merge patch means removing it.
+func containsNull(obj map[string]interface{}) bool {
+	for _, val := range obj {
+		if val == nil {
+			return true
+		}
+		if sub, ok := val.(map[string]interface{}); ok && containsNull(sub) {
+			return true
+		}
+	}
+	return false
+}
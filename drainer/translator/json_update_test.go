@@ -0,0 +1,110 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/check"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+)
+
+type testJSONUpdateSuite struct{}
+
+var _ = check.Suite(&testJSONUpdateSuite{})
+
+func newJSONUpdateBinlog(oldDoc, newDoc string) *obinlog.Binlog {
+	return &obinlog.Binlog{
+		Type: obinlog.BinlogType_DML,
+		DmlData: &obinlog.DMLData{
+			Tables: []*obinlog.Table{{
+				SchemaName: proto.String("test"),
+				TableName:  proto.String("t"),
+				ColumnInfo: []*obinlog.ColumnInfo{
+					{Name: "id", MysqlType: "int"},
+					{Name: "doc", MysqlType: "json"},
+				},
+				Mutations: []*obinlog.TableMutation{{
+					Type: obinlog.MutationType_Update.Enum(),
+					Row: &obinlog.Row{Columns: []*obinlog.Column{
+						{Int64Value: proto.Int64(1)},
+						{BytesValue: []byte(newDoc)},
+					}},
+					ChangeRow: &obinlog.Row{Columns: []*obinlog.Column{
+						{Int64Value: proto.Int64(1)},
+						{BytesValue: []byte(oldDoc)},
+					}},
+				}},
+			}},
+		},
+	}
+}
+
+func jsonColumns(binlog *obinlog.Binlog) (oldCol, newCol *obinlog.Column) {
+	mut := binlog.DmlData.Tables[0].Mutations[0]
+	return mut.ChangeRow.Columns[1], mut.Row.Columns[1]
+}
+
+func (s *testJSONUpdateSuite) TestIsValidJSONUpdateFormat(c *check.C) {
+	for _, format := range []string{"", JSONUpdateFull, JSONUpdatePatch, JSONUpdateDiff} {
+		c.Assert(IsValidJSONUpdateFormat(format), check.IsTrue)
+	}
+	c.Assert(IsValidJSONUpdateFormat("merge"), check.IsFalse)
+}
+
+func (s *testJSONUpdateSuite) TestPatch(c *check.C) {
+	oldDoc := `{"a": 1, "b": {"c": "x", "d": [1, 2]}, "e": true}`
+	newDoc := `{"a": 1, "b": {"c": "y", "d": [1, 2]}, "f": 1.5}`
+
+	binlog := newJSONUpdateBinlog(oldDoc, newDoc)
+	ToJSONPartialUpdate(binlog, func(schema, table string) string { return JSONUpdatePatch })
+	oldCol, newCol := jsonColumns(binlog)
+	c.Assert(newCol.BytesValue, check.IsNil)
+	c.Assert(newCol.GetStringValue(), check.Equals, `{"b":{"c":"y"},"e":null,"f":1.5}`)
+	c.Assert(string(oldCol.GetBytesValue()), check.Equals, oldDoc)
+
+	binlog = newJSONUpdateBinlog(oldDoc, newDoc)
+	ToJSONPartialUpdate(binlog, func(schema, table string) string { return JSONUpdateDiff })
+	oldCol, newCol = jsonColumns(binlog)
+	c.Assert(newCol.GetStringValue(), check.Equals, `{"b":{"c":"y"},"e":null,"f":1.5}`)
+	c.Assert(oldCol.BytesValue, check.IsNil)
+	c.Assert(oldCol.GetStringValue(), check.Equals, `{"b":{"c":"x"},"e":true,"f":null}`)
+}
+
+func (s *testJSONUpdateSuite) TestKeepFullDocument(c *check.C) {
+	cases := []struct {
+		oldDoc string
+		newDoc string
+	}{
+		// not objects
+		{`[1, 2]`, `[1, 3]`},
+		{`{"a": 1}`, `"str"`},
+		// null can't be expressed by merge patch
+		{`{"a": 1}`, `{"a": null}`},
+		{`{"a": 1}`, `{"a": 1, "b": {"c": null}}`},
+	}
+	for _, cs := range cases {
+		binlog := newJSONUpdateBinlog(cs.oldDoc, cs.newDoc)
+		ToJSONPartialUpdate(binlog, func(schema, table string) string { return JSONUpdateDiff })
+		oldCol, newCol := jsonColumns(binlog)
+		c.Assert(string(newCol.GetBytesValue()), check.Equals, cs.newDoc)
+		c.Assert(newCol.StringValue, check.IsNil)
+		c.Assert(string(oldCol.GetBytesValue()), check.Equals, cs.oldDoc)
+	}
+
+	// not configured for the table
+	binlog := newJSONUpdateBinlog(`{"a": 1}`, `{"a": 2}`)
+	ToJSONPartialUpdate(binlog, func(schema, table string) string { return JSONUpdateFull })
+	_, newCol := jsonColumns(binlog)
+	c.Assert(string(newCol.GetBytesValue()), check.Equals, `{"a": 2}`)
+}
@@ -33,21 +33,15 @@ import (
 )
 
 // TiBinlogToSecondaryBinlog translates the format to secondary binlog
-func TiBinlogToSecondaryBinlog(
-	infoGetter TableInfoGetter,
-	schema string,
-	table string,
-	tiBinlog *pb.Binlog,
-	pv *pb.PrewriteValue,
-) (*obinlog.Binlog, error) {
-	if tiBinlog.DdlJobId > 0 { // DDL
+func TiBinlogToSecondaryBinlog(ctx *Context) (*obinlog.Binlog, error) {
+	if ctx.Binlog.DdlJobId > 0 { // DDL
 		secondaryBinlog := &obinlog.Binlog{
 			Type:     obinlog.BinlogType_DDL,
-			CommitTs: tiBinlog.GetCommitTs(),
+			CommitTs: ctx.CommitTS,
 			DdlData: &obinlog.DDLData{
-				SchemaName: proto.String(schema),
-				TableName:  proto.String(table),
-				DdlQuery:   tiBinlog.GetDdlQuery(),
+				SchemaName: proto.String(ctx.Schema),
+				TableName:  proto.String(ctx.Table),
+				DdlQuery:   ctx.Binlog.GetDdlQuery(),
 			},
 		}
 		return secondaryBinlog, nil
@@ -55,30 +49,32 @@ func TiBinlogToSecondaryBinlog(
 
 	secondaryBinlog := &obinlog.Binlog{
 		Type:     obinlog.BinlogType_DML,
-		CommitTs: tiBinlog.GetCommitTs(),
+		CommitTs: ctx.CommitTS,
 		DmlData:  new(obinlog.DMLData),
 	}
 
-	for _, mut := range pv.GetMutations() {
+	infoGetter := ctx.InfoGetter
+	for _, mut := range ctx.PrewriteValue.GetMutations() {
 		info, ok := infoGetter.TableByID(mut.GetTableId())
 		if !ok {
 			return nil, errors.Errorf("TableByID empty table id: %d", mut.GetTableId())
 		}
-		canAppendDefaultValue := infoGetter.CanAppendDefaultValue(mut.GetTableId(), pv.SchemaVersion)
+		canAppendDefaultValue := infoGetter.CanAppendDefaultValue(mut.GetTableId(), ctx.SchemaVersion)
 
-		pinfo, _ := infoGetter.TableBySchemaVersion(mut.GetTableId(), pv.SchemaVersion)
+		pinfo, _ := infoGetter.TableBySchemaVersion(mut.GetTableId(), ctx.SchemaVersion)
 
-		schema, _, ok = infoGetter.SchemaAndTableName(mut.GetTableId())
+		schema, _, ok := infoGetter.SchemaAndTableName(mut.GetTableId())
 		if !ok {
 			return nil, errors.Errorf("SchemaAndTableName empty table id: %d", mut.GetTableId())
 		}
 
+		mode := ctx.generatedColumnsMode(schema, info.Name.O, GeneratedColumnsAll)
 		iter := newSequenceIterator(&mut)
-		table := genTable(schema, info)
+		table := genTable(ctx, schema, info, mode)
 		secondaryBinlog.DmlData.Tables = append(secondaryBinlog.DmlData.Tables, table)
 
 		for {
-			tableMutation, err := nextRow(schema, pinfo, info, canAppendDefaultValue, iter)
+			tableMutation, err := nextRow(schema, pinfo, info, canAppendDefaultValue, mode, ctx.Charsets, iter)
 			if err != nil {
 				if errors.Cause(err) == io.EOF {
 					break
@@ -91,17 +87,26 @@ func TiBinlogToSecondaryBinlog(
 	return secondaryBinlog, nil
 }
 
-func genTable(schema string, tableInfo *model.TableInfo) (table *obinlog.Table) {
+// TableSchema returns the table with all the columns and unique keys of the table info but no mutations,
+// the generated columns are included like in the DMLs of the table.
+func TableSchema(ctx *Context, schema string, info *model.TableInfo) *obinlog.Table {
+	return genTable(ctx, schema, info, ctx.generatedColumnsMode(schema, info.Name.O, GeneratedColumnsAll))
+}
+
+func genTable(ctx *Context, schema string, tableInfo *model.TableInfo, mode string) (table *obinlog.Table) {
 	table = new(obinlog.Table)
 	table.SchemaName = proto.String(schema)
 	table.TableName = proto.String(tableInfo.Name.O)
 	// get obinlog.ColumnInfo
 	columnInfos := make([]*obinlog.ColumnInfo, 0, len(tableInfo.Columns))
-	for _, col := range tableInfo.Columns {
+	for _, col := range filterColumns(tableInfo.Columns, mode) {
 		info := new(obinlog.ColumnInfo)
 		info.Name = col.Name.O
 		info.MysqlType = types.TypeToStr(col.Tp, col.Charset)
 		info.IsPrimaryKey = mysql.HasPriKeyFlag(col.Flag)
+		if cs := columnCharset(&col.FieldType); len(cs) > 0 {
+			ctx.addColumnCharset(schema, tableInfo.Name.O, col.Name.O, cs)
+		}
 		columnInfos = append(columnInfos, info)
 	}
 	table.ColumnInfo = columnInfos
@@ -122,6 +127,10 @@ func genTable(schema string, tableInfo *model.TableInfo) (table *obinlog.Table)
 		if !index.Unique && !index.Primary {
 			continue
 		}
+		// the hidden columns of the expression indexes aren't in the columns.
+		if hasHiddenColumns(tableInfo, index) {
+			continue
+		}
 
 		// just a protective check
 		if tableInfo.PKIsHandle && index.Name.O == "PRIMARY" {
@@ -145,9 +154,15 @@ func genTable(schema string, tableInfo *model.TableInfo) (table *obinlog.Table)
 	return
 }
 
-func insertRowToRow(ptableInfo, tableInfo *model.TableInfo, raw []byte) (row *obinlog.Row, err error) {
+func insertRowToRow(ptableInfo, tableInfo *model.TableInfo, raw []byte, mode string, charsets Charsets) (row *obinlog.Row, err error) {
 	columnValues, err := insertRowToDatums(tableInfo, raw)
-	columns := tableInfo.Columns
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = evalVirtualColumns(tableInfo, mode, columnValues); err != nil {
+		return nil, errors.Trace(err)
+	}
+	columns := filterColumns(tableInfo.Columns, mode)
 
 	row = new(obinlog.Row)
 
@@ -157,21 +172,24 @@ func insertRowToRow(ptableInfo, tableInfo *model.TableInfo, raw []byte) (row *ob
 			val = getDefaultOrZeroValue(ptableInfo, col)
 		}
 
-		column := DatumToColumn(col, val)
+		column := DatumToColumn(col, val, charsets)
 		row.Columns = append(row.Columns, column)
 	}
 
 	return
 }
 
-func deleteRowToRow(ptableinfo, tableInfo *model.TableInfo, raw []byte) (row *obinlog.Row, err error) {
-	columns := tableInfo.Columns
+func deleteRowToRow(ptableinfo, tableInfo *model.TableInfo, raw []byte, mode string, charsets Charsets) (row *obinlog.Row, err error) {
+	columns := filterColumns(tableInfo.Columns, mode)
 
 	colsTypeMap := util.ToColumnTypeMap(tableInfo.Columns)
 	columnValues, err := tablecodec.DecodeRowToDatumMap(raw, colsTypeMap, time.Local)
 	if err != nil {
 		return nil, errors.Annotate(err, "DecodeRow failed")
 	}
+	if err = evalVirtualColumns(tableInfo, mode, columnValues); err != nil {
+		return nil, errors.Trace(err)
+	}
 
 	// log.Debugf("delete decodeRow: %+v\n", columnValues)
 
@@ -183,36 +201,42 @@ func deleteRowToRow(ptableinfo, tableInfo *model.TableInfo, raw []byte) (row *ob
 			val = getDefaultOrZeroValue(ptableinfo, col)
 		}
 
-		column := DatumToColumn(col, val)
+		column := DatumToColumn(col, val, charsets)
 		row.Columns = append(row.Columns, column)
 	}
 
 	return
 }
 
-func updateRowToRow(ptableinfo, tableInfo *model.TableInfo, raw []byte, canAppendDefaultValue bool) (row *obinlog.Row, changedRow *obinlog.Row, err error) {
-	updtDecoder := newUpdateDecoder(ptableinfo, tableInfo, canAppendDefaultValue)
+func updateRowToRow(ptableinfo, tableInfo *model.TableInfo, raw []byte, canAppendDefaultValue bool, mode string, charsets Charsets) (row *obinlog.Row, changedRow *obinlog.Row, err error) {
+	updtDecoder := newUpdateDecoder(ptableinfo, decodeColumns(tableInfo, mode), canAppendDefaultValue)
 	oldDatums, newDatums, err := updtDecoder.decode(raw, time.Local)
 	if err != nil {
 		return
 	}
+	if err = evalVirtualColumns(tableInfo, mode, oldDatums); err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	if err = evalVirtualColumns(tableInfo, mode, newDatums); err != nil {
+		return nil, nil, errors.Trace(err)
+	}
 
 	row = new(obinlog.Row)
 	changedRow = new(obinlog.Row)
-	for _, col := range tableInfo.Columns {
+	for _, col := range filterColumns(tableInfo.Columns, mode) {
 		var val types.Datum
 		var ok bool
 
 		if val, ok = newDatums[col.ID]; !ok {
 			getDefaultOrZeroValue(ptableinfo, col)
 		}
-		column := DatumToColumn(col, val)
+		column := DatumToColumn(col, val, charsets)
 		row.Columns = append(row.Columns, column)
 
 		if val, ok = oldDatums[col.ID]; !ok {
 			getDefaultOrZeroValue(ptableinfo, col)
 		}
-		column = DatumToColumn(col, val)
+		column = DatumToColumn(col, val, charsets)
 		changedRow.Columns = append(changedRow.Columns, column)
 	}
 
@@ -220,7 +244,7 @@ func updateRowToRow(ptableinfo, tableInfo *model.TableInfo, raw []byte, canAppen
 }
 
 // DatumToColumn convert types.Datum to obinlog.Column
-func DatumToColumn(colInfo *model.ColumnInfo, datum types.Datum) (col *obinlog.Column) {
+func DatumToColumn(colInfo *model.ColumnInfo, datum types.Datum, charsets Charsets) (col *obinlog.Column) {
 	col = new(obinlog.Column)
 
 	if datum.IsNull() {
@@ -262,7 +286,12 @@ func DatumToColumn(colInfo *model.ColumnInfo, datum types.Datum) (col *obinlog.C
 
 	// string type
 	case "text", "longtext", "mediumtext", "char", "tinytext", "varchar", "var_string":
-		col.StringValue = proto.String(datum.GetString())
+		value, _, err := charsets.decode(&colInfo.FieldType, datum.GetBytes())
+		if err != nil {
+			log.Warn("decode the value of the column failed", zap.String("column", colInfo.Name.O), zap.Error(err))
+			value = datum.GetBytes()
+		}
+		col.StringValue = proto.String(string(value))
 	case "blob", "longblob", "mediumblob", "binary", "tinyblob", "varbinary":
 		col.BytesValue = datum.GetBytes()
 	case "enum":
@@ -289,25 +318,25 @@ func DatumToColumn(colInfo *model.ColumnInfo, datum types.Datum) (col *obinlog.C
 	return
 }
 
-func createTableMutation(tp pb.MutationType, pinfo, info *model.TableInfo, canAppendDefaultValue bool, row []byte) (*obinlog.TableMutation, error) {
+func createTableMutation(tp pb.MutationType, pinfo, info *model.TableInfo, canAppendDefaultValue bool, mode string, charsets Charsets, row []byte) (*obinlog.TableMutation, error) {
 	var err error
 	mut := new(obinlog.TableMutation)
 	switch tp {
 	case pb.MutationType_Insert:
 		mut.Type = obinlog.MutationType_Insert.Enum()
-		mut.Row, err = insertRowToRow(pinfo, info, row)
+		mut.Row, err = insertRowToRow(pinfo, info, row, mode, charsets)
 		if err != nil {
 			return nil, err
 		}
 	case pb.MutationType_Update:
 		mut.Type = obinlog.MutationType_Update.Enum()
-		mut.Row, mut.ChangeRow, err = updateRowToRow(pinfo, info, row, canAppendDefaultValue)
+		mut.Row, mut.ChangeRow, err = updateRowToRow(pinfo, info, row, canAppendDefaultValue, mode, charsets)
 		if err != nil {
 			return nil, err
 		}
 	case pb.MutationType_DeleteRow:
 		mut.Type = obinlog.MutationType_Delete.Enum()
-		mut.Row, err = deleteRowToRow(pinfo, info, row)
+		mut.Row, err = deleteRowToRow(pinfo, info, row, mode, charsets)
 		if err != nil {
 			return nil, err
 		}
@@ -317,13 +346,13 @@ func createTableMutation(tp pb.MutationType, pinfo, info *model.TableInfo, canAp
 	return mut, nil
 }
 
-func nextRow(schema string, pinfo, info *model.TableInfo, canAppendDefaultValue bool, iter *sequenceIterator) (*obinlog.TableMutation, error) {
+func nextRow(schema string, pinfo, info *model.TableInfo, canAppendDefaultValue bool, mode string, charsets Charsets, iter *sequenceIterator) (*obinlog.TableMutation, error) {
 	mutType, row, err := iter.next()
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	tableMutation, err := createTableMutation(mutType, pinfo, info, canAppendDefaultValue, row)
+	tableMutation, err := createTableMutation(mutType, pinfo, info, canAppendDefaultValue, mode, charsets, row)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -33,7 +33,7 @@ var _ = check.Suite(&testKafkaSuite{})
 func (t *testKafkaSuite) TestDDL(c *check.C) {
 	t.SetDDL()
 
-	secondaryBinlog, err := TiBinlogToSecondaryBinlog(t, t.Schema, t.Table, t.TiBinlog, nil)
+	secondaryBinlog, err := TiBinlogToSecondaryBinlog(NewContext(t, t.TiBinlog, nil).WithTable(t.Schema, t.Table))
 	c.Assert(err, check.IsNil)
 
 	c.Assert(secondaryBinlog, check.DeepEquals, &obinlog.Binlog{
@@ -48,7 +48,7 @@ func (t *testKafkaSuite) TestDDL(c *check.C) {
 }
 
 func (t *testKafkaSuite) testDML(c *check.C, tp obinlog.MutationType) {
-	secondaryBinlog, err := TiBinlogToSecondaryBinlog(t, t.Schema, t.Table, t.TiBinlog, t.PV)
+	secondaryBinlog, err := TiBinlogToSecondaryBinlog(NewContext(t, t.TiBinlog, t.PV))
 	c.Assert(err, check.IsNil)
 
 	c.Assert(secondaryBinlog.GetCommitTs(), check.Equals, t.TiBinlog.GetCommitTs())
@@ -67,7 +67,7 @@ func (t *testKafkaSuite) testDML(c *check.C, tp obinlog.MutationType) {
 func (t *testKafkaSuite) TestAllDML(c *check.C) {
 	t.SetAllDML(c)
 
-	secondaryBinlog, err := TiBinlogToSecondaryBinlog(t, t.Schema, t.Table, t.TiBinlog, t.PV)
+	secondaryBinlog, err := TiBinlogToSecondaryBinlog(NewContext(t, t.TiBinlog, t.PV))
 	c.Assert(err, check.IsNil)
 
 	c.Assert(secondaryBinlog.Type, check.Equals, obinlog.BinlogType_DML)
@@ -244,6 +244,6 @@ func (t *testKafkaSuite) TestGenTable(c *check.C) {
 		},
 	}
 
-	getTable := genTable(schema, info)
+	getTable := genTable(&Context{}, schema, info, GeneratedColumnsAll)
 	c.Assert(expectTable, check.DeepEquals, getTable)
 }
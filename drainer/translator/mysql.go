@@ -31,13 +31,16 @@ import (
 
 const implicitColID = -1
 
-func genMysqlInsert(schema string, ptable, table *model.TableInfo, row []byte) (names []string, args []interface{}, err error) {
-	columns := writableColumns(table)
+func genMysqlInsert(schema string, ptable, table *model.TableInfo, row []byte, mode string, charsets Charsets) (names []string, args []interface{}, err error) {
+	columns := dmlColumns(table, mode)
 
 	columnValues, err := insertRowToDatums(table, row)
 	if err != nil {
 		return nil, nil, errors.Trace(err)
 	}
+	if err = evalVirtualColumns(table, mode, columnValues); err != nil {
+		return nil, nil, errors.Trace(err)
+	}
 
 	for _, col := range columns {
 		val, ok := columnValues[col.ID]
@@ -46,7 +49,7 @@ func genMysqlInsert(schema string, ptable, table *model.TableInfo, row []byte) (
 			val = getDefaultOrZeroValue(ptable, col)
 		}
 
-		value, err := formatData(val, col.FieldType)
+		value, err := formatData(val, col.FieldType, charsets)
 		if err != nil {
 			return nil, nil, errors.Trace(err)
 		}
@@ -58,9 +61,9 @@ func genMysqlInsert(schema string, ptable, table *model.TableInfo, row []byte) (
 	return names, args, nil
 }
 
-func genMysqlUpdate(schema string, ptable, table *model.TableInfo, row []byte, canAppendDefaultValue bool) (names []string, values []interface{}, oldValues []interface{}, err error) {
-	columns := writableColumns(table)
-	updtDecoder := newUpdateDecoder(ptable, table, canAppendDefaultValue)
+func genMysqlUpdate(schema string, ptable, table *model.TableInfo, row []byte, canAppendDefaultValue bool, mode string, charsets Charsets) (names []string, values []interface{}, oldValues []interface{}, err error) {
+	columns := dmlColumns(table, mode)
+	updtDecoder := newUpdateDecoder(ptable, decodeColumns(table, mode), canAppendDefaultValue)
 
 	var updateColumns []*model.ColumnInfo
 
@@ -68,13 +71,19 @@ func genMysqlUpdate(schema string, ptable, table *model.TableInfo, row []byte, c
 	if err != nil {
 		return nil, nil, nil, errors.Annotatef(err, "table `%s`.`%s`", schema, table.Name)
 	}
+	if err = evalVirtualColumns(table, mode, oldColumnValues); err != nil {
+		return nil, nil, nil, errors.Trace(err)
+	}
+	if err = evalVirtualColumns(table, mode, newColumnValues); err != nil {
+		return nil, nil, nil, errors.Trace(err)
+	}
 
-	_, oldValues, err = generateColumnAndValue(columns, oldColumnValues)
+	_, oldValues, err = generateColumnAndValue(columns, oldColumnValues, charsets)
 	if err != nil {
 		return nil, nil, nil, errors.Trace(err)
 	}
 
-	updateColumns, values, err = generateColumnAndValue(columns, newColumnValues)
+	updateColumns, values, err = generateColumnAndValue(columns, newColumnValues, charsets)
 	if err != nil {
 		return nil, nil, nil, errors.Trace(err)
 	}
@@ -84,16 +93,20 @@ func genMysqlUpdate(schema string, ptable, table *model.TableInfo, row []byte, c
 	return
 }
 
-func genMysqlDelete(schema string, table *model.TableInfo, row []byte) (names []string, values []interface{}, err error) {
-	columns := table.Columns
-	colsTypeMap := util.ToColumnTypeMap(columns)
+func genMysqlDelete(schema string, table *model.TableInfo, row []byte, mode string, charsets Charsets) (names []string, values []interface{}, err error) {
+	colsTypeMap := util.ToColumnTypeMap(table.Columns)
 
 	columnValues, err := tablecodec.DecodeRowToDatumMap(row, colsTypeMap, time.Local)
 	if err != nil {
 		return nil, nil, errors.Trace(err)
 	}
+	if err = evalVirtualColumns(table, mode, columnValues); err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+
+	columns := filterColumns(table.Columns, mode)
 
-	columns, values, err = generateColumnAndValue(columns, columnValues)
+	columns, values, err = generateColumnAndValue(columns, columnValues, charsets)
 	if err != nil {
 		return nil, nil, errors.Trace(err)
 	}
@@ -104,18 +117,19 @@ func genMysqlDelete(schema string, table *model.TableInfo, row []byte) (names []
 }
 
 // TiBinlogToTxn translate the format to loader.Txn
-func TiBinlogToTxn(infoGetter TableInfoGetter, schema string, table string, tiBinlog *tipb.Binlog, pv *tipb.PrewriteValue, shouldSkip bool) (txn *loader.Txn, err error) {
+func TiBinlogToTxn(ctx *Context) (txn *loader.Txn, err error) {
 	txn = new(loader.Txn)
+	infoGetter := ctx.InfoGetter
 
-	if tiBinlog.DdlJobId > 0 {
+	if ctx.Binlog.DdlJobId > 0 {
 		txn.DDL = &loader.DDL{
-			Database:   schema,
-			Table:      table,
-			SQL:        string(tiBinlog.GetDdlQuery()),
-			ShouldSkip: shouldSkip,
+			Database:   ctx.Schema,
+			Table:      ctx.Table,
+			SQL:        string(ctx.Binlog.GetDdlQuery()),
+			ShouldSkip: ctx.ShouldSkip,
 		}
 	} else {
-		for _, mut := range pv.GetMutations() {
+		for _, mut := range ctx.PrewriteValue.GetMutations() {
 			var info *model.TableInfo
 			var ok bool
 			info, ok = infoGetter.TableByID(mut.GetTableId())
@@ -123,15 +137,22 @@ func TiBinlogToTxn(infoGetter TableInfoGetter, schema string, table string, tiBi
 				return nil, errors.Errorf("TableByID empty table id: %d", mut.GetTableId())
 			}
 
-			pinfo, _ := infoGetter.TableBySchemaVersion(mut.GetTableId(), pv.SchemaVersion)
+			pinfo, _ := infoGetter.TableBySchemaVersion(mut.GetTableId(), ctx.SchemaVersion)
 
-			canAppendDefaultValue := infoGetter.CanAppendDefaultValue(mut.GetTableId(), pv.SchemaVersion)
+			canAppendDefaultValue := infoGetter.CanAppendDefaultValue(mut.GetTableId(), ctx.SchemaVersion)
 
-			schema, table, ok = infoGetter.SchemaAndTableName(mut.GetTableId())
+			schema, table, ok := infoGetter.SchemaAndTableName(mut.GetTableId())
 			if !ok {
 				return nil, errors.Errorf("SchemaAndTableName empty table id: %d", mut.GetTableId())
 			}
 
+			noKeyMode := ctx.noKeyTableMode(schema, table, info)
+			if noKeyMode == NoKeyTableSkip {
+				skipNoKeyTable(schema, table, &mut)
+				continue
+			}
+
+			mode := ctx.generatedColumnsMode(schema, table, GeneratedColumnsOmit)
 			iter := newSequenceIterator(&mut)
 			for {
 				mutType, row, err := iter.next()
@@ -141,10 +162,13 @@ func TiBinlogToTxn(infoGetter TableInfoGetter, schema string, table string, tiBi
 					}
 					return nil, errors.Trace(err)
 				}
+				if len(noKeyMode) > 0 {
+					countNoKeyTableDML(noKeyMode, mutType, 1)
+				}
 
 				switch mutType {
 				case tipb.MutationType_Insert:
-					names, args, err := genMysqlInsert(schema, pinfo, info, row)
+					names, args, err := genMysqlInsert(schema, pinfo, info, row, mode, ctx.Charsets)
 					if err != nil {
 						return nil, errors.Annotate(err, "gen insert fail")
 					}
@@ -160,11 +184,26 @@ func TiBinlogToTxn(infoGetter TableInfoGetter, schema string, table string, tiBi
 						dml.Values[name] = args[i]
 					}
 				case tipb.MutationType_Update:
-					names, args, oldArgs, err := genMysqlUpdate(schema, pinfo, info, row, canAppendDefaultValue)
+					names, args, oldArgs, err := genMysqlUpdate(schema, pinfo, info, row, canAppendDefaultValue, mode, ctx.Charsets)
 					if err != nil {
 						return nil, errors.Annotate(err, "gen update fail")
 					}
 
+					if noKeyMode == NoKeyTableAppendOnly {
+						// the new version of the row is appended.
+						dml := &loader.DML{
+							Tp:       loader.InsertDMLType,
+							Database: schema,
+							Table:    table,
+							Values:   make(map[string]interface{}),
+						}
+						txn.DMLs = append(txn.DMLs, dml)
+						for i, name := range names {
+							dml.Values[name] = args[i]
+						}
+						continue
+					}
+
 					dml := &loader.DML{
 						Tp:        loader.UpdateDMLType,
 						Database:  schema,
@@ -179,7 +218,10 @@ func TiBinlogToTxn(infoGetter TableInfoGetter, schema string, table string, tiBi
 					}
 
 				case tipb.MutationType_DeleteRow:
-					names, args, err := genMysqlDelete(schema, info, row)
+					if noKeyMode == NoKeyTableAppendOnly {
+						continue
+					}
+					names, args, err := genMysqlDelete(schema, info, row, mode, ctx.Charsets)
 					if err != nil {
 						return nil, errors.Annotate(err, "gen delete fail")
 					}
@@ -205,18 +247,6 @@ func TiBinlogToTxn(infoGetter TableInfoGetter, schema string, table string, tiBi
 	return
 }
 
-// writableColumns returns all columns which can be written. This excludes
-// generated and non-public columns.
-func writableColumns(table *model.TableInfo) []*model.ColumnInfo {
-	cols := make([]*model.ColumnInfo, 0, len(table.Columns))
-	for _, col := range table.Columns {
-		if col.State == model.StatePublic && !col.IsGenerated() {
-			cols = append(cols, col)
-		}
-	}
-	return cols
-}
-
 func genColumnNameList(columns []*model.ColumnInfo) (names []string) {
 	for _, column := range columns {
 		names = append(names, column.Name.O)
@@ -225,7 +255,7 @@ func genColumnNameList(columns []*model.ColumnInfo) (names []string) {
 	return
 }
 
-func generateColumnAndValue(columns []*model.ColumnInfo, columnValues map[int64]types.Datum) ([]*model.ColumnInfo, []interface{}, error) {
+func generateColumnAndValue(columns []*model.ColumnInfo, columnValues map[int64]types.Datum, charsets Charsets) ([]*model.ColumnInfo, []interface{}, error) {
 	var newColumn []*model.ColumnInfo
 	var newColumnsValues []interface{}
 
@@ -233,7 +263,7 @@ func generateColumnAndValue(columns []*model.ColumnInfo, columnValues map[int64]
 		val, ok := columnValues[col.ID]
 		if ok {
 			newColumn = append(newColumn, col)
-			value, err := formatData(val, col.FieldType)
+			value, err := formatData(val, col.FieldType, charsets)
 			if err != nil {
 				return nil, nil, errors.Trace(err)
 			}
@@ -245,11 +275,20 @@ func generateColumnAndValue(columns []*model.ColumnInfo, columnValues map[int64]
 	return newColumn, newColumnsValues, nil
 }
 
-func formatData(data types.Datum, ft types.FieldType) (types.Datum, error) {
+func formatData(data types.Datum, ft types.FieldType, charsets Charsets) (types.Datum, error) {
 	if data.GetValue() == nil {
 		return data, nil
 	}
 
+	// the values of the non-utf8 columns are converted for the connection charset utf8mb4.
+	decoded, ok, err := charsets.decode(&ft, data.GetBytes())
+	if err != nil {
+		return types.Datum{}, errors.Trace(err)
+	}
+	if ok {
+		return types.NewStringDatum(string(decoded)), nil
+	}
+
 	switch ft.Tp {
 	case mysql.TypeDate, mysql.TypeDatetime, mysql.TypeNewDate, mysql.TypeTimestamp, mysql.TypeDuration, mysql.TypeNewDecimal, mysql.TypeJSON:
 		data = types.NewDatum(fmt.Sprintf("%v", data.GetValue()))
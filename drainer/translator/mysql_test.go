@@ -37,7 +37,9 @@ func (t *testMysqlSuite) TestGenColumnList(c *check.C) {
 func (t *testMysqlSuite) TestDDL(c *check.C) {
 	t.SetDDL()
 
-	txn, err := TiBinlogToTxn(t, t.Schema, t.Table, t.TiBinlog, nil, true)
+	ctx := NewContext(t, t.TiBinlog, nil).WithTable(t.Schema, t.Table)
+	ctx.ShouldSkip = true
+	txn, err := TiBinlogToTxn(ctx)
 	c.Assert(err, check.IsNil)
 
 	c.Assert(txn, check.DeepEquals, &loader.Txn{
@@ -51,7 +53,7 @@ func (t *testMysqlSuite) TestDDL(c *check.C) {
 }
 
 func (t *testMysqlSuite) testDML(c *check.C, tp loader.DMLType) {
-	txn, err := TiBinlogToTxn(t, t.Schema, t.Table, t.TiBinlog, t.PV, false)
+	txn, err := TiBinlogToTxn(NewContext(t, t.TiBinlog, t.PV))
 	c.Assert(err, check.IsNil)
 
 	c.Assert(txn.DMLs, check.HasLen, 1)
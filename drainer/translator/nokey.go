@@ -0,0 +1,106 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"sync"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	tipb "github.com/pingcap/tipb/go-binlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// The modes of the DMLs of the tables without primary key and unique key.
+const (
+	// NoKeyTableFullRow locates the updated and deleted rows by all the columns, one of
+	// the duplicated rows is changed.
+	NoKeyTableFullRow = "full-row"
+	// NoKeyTableSkip skips the DMLs of the table and logs an error.
+	NoKeyTableSkip = "skip"
+	// NoKeyTableAppendOnly inserts the new rows of the updates and ignores the deletes,
+	// the table in downstream keeps all the versions of the rows.
+	NoKeyTableAppendOnly = "append-only"
+)
+
+// NoKeyTableDMLCounter counts the DMLs of the tables without primary key and unique key
+// by the mode and the type, nil if not counted.
+var NoKeyTableDMLCounter *prometheus.CounterVec
+
+// skippedNoKeyTables are the tables whose DMLs are skipped, the error is logged once for a table.
+var skippedNoKeyTables sync.Map
+
+// IsValidNoKeyTableMode returns true if the mode is supported.
+func IsValidNoKeyTableMode(mode string) bool {
+	switch mode {
+	case "", NoKeyTableFullRow, NoKeyTableSkip, NoKeyTableAppendOnly:
+		return true
+	default:
+		return false
+	}
+}
+
+// hasKey returns true if the table has a primary key or a unique key.
+func hasKey(info *model.TableInfo) bool {
+	if info.PKIsHandle || info.IsCommonHandle {
+		return true
+	}
+	for _, index := range info.Indices {
+		if (index.Primary || index.Unique) && index.State == model.StatePublic {
+			return true
+		}
+	}
+	return false
+}
+
+// noKeyTableMode returns the mode of the DMLs of the table, empty if the table has a key.
+func (ctx *Context) noKeyTableMode(schema string, table string, info *model.TableInfo) string {
+	if hasKey(info) {
+		return ""
+	}
+	if ctx.NoKeyTables != nil {
+		if mode := ctx.NoKeyTables(schema, table); len(mode) > 0 {
+			return mode
+		}
+	}
+	return NoKeyTableFullRow
+}
+
+func countNoKeyTableDML(mode string, tp tipb.MutationType, n int) {
+	if NoKeyTableDMLCounter == nil || n == 0 {
+		return
+	}
+	var label string
+	switch tp {
+	case tipb.MutationType_Insert:
+		label = "insert"
+	case tipb.MutationType_Update:
+		label = "update"
+	case tipb.MutationType_DeleteRow:
+		label = "delete"
+	}
+	NoKeyTableDMLCounter.WithLabelValues(mode, label).Add(float64(n))
+}
+
+// skipNoKeyTable counts the rows of the mutation of the table skipped.
+func skipNoKeyTable(schema string, table string, mut *tipb.TableMutation) {
+	key := quoteName(schema) + "." + quoteName(table)
+	if _, logged := skippedNoKeyTables.LoadOrStore(key, struct{}{}); !logged {
+		log.Error("skip the DMLs of the table without primary key and unique key", zap.String("table", key))
+	}
+	countNoKeyTableDML(NoKeyTableSkip, tipb.MutationType_Insert, len(mut.GetInsertedRows()))
+	countNoKeyTableDML(NoKeyTableSkip, tipb.MutationType_Update, len(mut.GetUpdatedRows()))
+	countNoKeyTableDML(NoKeyTableSkip, tipb.MutationType_DeleteRow, len(mut.GetDeletedRows()))
+}
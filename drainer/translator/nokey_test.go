@@ -0,0 +1,95 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+type testNoKeySuite struct {
+	BinlogGenerator
+}
+
+var _ = check.Suite(&testNoKeySuite{})
+
+// setNoKeyDML sets up an insert, update and delete of the table without primary key and unique key.
+func (t *testNoKeySuite) setNoKeyDML(c *check.C) {
+	t.SetAllDML(c)
+	info := testGenTable("normal")
+	info.ID = t.PV.Mutations[0].TableId
+	t.id2info[info.ID] = info
+
+	mut := &t.PV.Mutations[0]
+	mut.InsertedRows[0] = testGenInsertBinlog(c, info, t.datums)
+	mut.DeletedRows[0] = testGenDeleteBinlog(c, info, t.datums)
+}
+
+func (t *testNoKeySuite) TestHasKey(c *check.C) {
+	c.Assert(hasKey(testGenTable("hasID")), check.IsTrue)
+	// only the public indexes are the keys.
+	info := testGenTable("hasPK")
+	c.Assert(hasKey(info), check.IsFalse)
+	info.Indices[0].State = model.StatePublic
+	c.Assert(hasKey(info), check.IsTrue)
+	c.Assert(hasKey(testGenTable("normal")), check.IsFalse)
+}
+
+func (t *testNoKeySuite) TestIsValidNoKeyTableMode(c *check.C) {
+	for _, mode := range []string{"", NoKeyTableFullRow, NoKeyTableSkip, NoKeyTableAppendOnly} {
+		c.Assert(IsValidNoKeyTableMode(mode), check.IsTrue)
+	}
+	c.Assert(IsValidNoKeyTableMode("error"), check.IsFalse)
+}
+
+func (t *testNoKeySuite) translate(c *check.C, mode string) []*loader.DML {
+	ctx := NewContext(t, t.TiBinlog, t.PV)
+	ctx.NoKeyTables = func(schema string, table string) string {
+		c.Assert(schema, check.Equals, "test")
+		c.Assert(table, check.Equals, "account")
+		return mode
+	}
+	txn, err := TiBinlogToTxn(ctx)
+	c.Assert(err, check.IsNil)
+	return txn.DMLs
+}
+
+func (t *testNoKeySuite) TestFullRow(c *check.C) {
+	t.setNoKeyDML(c)
+	dmls := t.translate(c, "")
+	c.Assert(dmls, check.HasLen, 3)
+	c.Assert(dmls[0].Tp, check.Equals, loader.InsertDMLType)
+	c.Assert(dmls[1].Tp, check.Equals, loader.UpdateDMLType)
+	c.Assert(dmls[2].Tp, check.Equals, loader.DeleteDMLType)
+}
+
+func (t *testNoKeySuite) TestSkip(c *check.C) {
+	t.setNoKeyDML(c)
+	c.Assert(t.translate(c, NoKeyTableSkip), check.HasLen, 0)
+
+	// the tables with a key aren't skipped.
+	t.SetAllDML(c)
+	c.Assert(t.translate(c, NoKeyTableSkip), check.HasLen, 3)
+}
+
+func (t *testNoKeySuite) TestAppendOnly(c *check.C) {
+	t.setNoKeyDML(c)
+	dmls := t.translate(c, NoKeyTableAppendOnly)
+	c.Assert(dmls, check.HasLen, 2)
+	c.Assert(dmls[0].Tp, check.Equals, loader.InsertDMLType)
+	c.Assert(dmls[1].Tp, check.Equals, loader.InsertDMLType)
+	c.Assert(dmls[1].OldValues, check.IsNil)
+	c.Assert(dmls[1].Values, check.HasLen, 3)
+}
@@ -33,14 +33,15 @@ import (
 )
 
 // TiBinlogToPbBinlog translate the binlog format
-func TiBinlogToPbBinlog(infoGetter TableInfoGetter, schema string, table string, tiBinlog *tipb.Binlog, pv *tipb.PrewriteValue) (pbBinlog *pb.Binlog, err error) {
+func TiBinlogToPbBinlog(ctx *Context) (pbBinlog *pb.Binlog, err error) {
 	pbBinlog = new(pb.Binlog)
+	infoGetter := ctx.InfoGetter
 
-	pbBinlog.CommitTs = tiBinlog.CommitTs
+	pbBinlog.CommitTs = ctx.CommitTS
 
-	if tiBinlog.DdlJobId > 0 { // DDL
-		sql := string(tiBinlog.GetDdlQuery())
-		stmt, err := getParser().ParseOneStmt(sql, "", "")
+	if ctx.Binlog.DdlJobId > 0 { // DDL
+		sql := string(ctx.Binlog.GetDdlQuery())
+		stmt, err := getParser(ctx.SQLMode).ParseOneStmt(sql, "", "")
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
@@ -49,7 +50,7 @@ func TiBinlogToPbBinlog(infoGetter TableInfoGetter, schema string, table string,
 		if isCreateDatabase {
 			sql += ";"
 		} else {
-			sql = fmt.Sprintf("use %s; %s;", quoteName(schema), sql)
+			sql = fmt.Sprintf("use %s; %s;", quoteName(ctx.Schema), sql)
 		}
 
 		pbBinlog.Tp = pb.BinlogType_DDL
@@ -57,7 +58,7 @@ func TiBinlogToPbBinlog(infoGetter TableInfoGetter, schema string, table string,
 	} else {
 		pbBinlog.DmlData = new(pb.DMLData)
 
-		for _, mut := range pv.GetMutations() {
+		for _, mut := range ctx.PrewriteValue.GetMutations() {
 			var info *model.TableInfo
 			var ok bool
 			info, ok = infoGetter.TableByID(mut.GetTableId())
@@ -65,15 +66,16 @@ func TiBinlogToPbBinlog(infoGetter TableInfoGetter, schema string, table string,
 				return nil, errors.Errorf("TableByID empty table id: %d", mut.GetTableId())
 			}
 
-			canAppendDefaultValue := infoGetter.CanAppendDefaultValue(mut.GetTableId(), pv.SchemaVersion)
+			canAppendDefaultValue := infoGetter.CanAppendDefaultValue(mut.GetTableId(), ctx.SchemaVersion)
 
-			pinfo, _ := infoGetter.TableBySchemaVersion(mut.GetTableId(), pv.SchemaVersion)
+			pinfo, _ := infoGetter.TableBySchemaVersion(mut.GetTableId(), ctx.SchemaVersion)
 
-			schema, _, ok = infoGetter.SchemaAndTableName(mut.GetTableId())
+			schema, _, ok := infoGetter.SchemaAndTableName(mut.GetTableId())
 			if !ok {
 				return nil, errors.Errorf("SchemaAndTableName empty table id: %d", mut.GetTableId())
 			}
 
+			mode := ctx.generatedColumnsMode(schema, info.Name.O, GeneratedColumnsAll)
 			iter := newSequenceIterator(&mut)
 			for {
 				mutType, row, err := iter.next()
@@ -86,20 +88,20 @@ func TiBinlogToPbBinlog(infoGetter TableInfoGetter, schema string, table string,
 
 				switch mutType {
 				case tipb.MutationType_Insert:
-					event, err := genInsert(schema, pinfo, info, row)
+					event, err := genInsert(schema, pinfo, info, row, mode, ctx.Charsets)
 					if err != nil {
 						return nil, errors.Annotatef(err, "genInsert failed")
 					}
 					pbBinlog.DmlData.Events = append(pbBinlog.DmlData.Events, *event)
 				case tipb.MutationType_Update:
-					event, err := genUpdate(schema, pinfo, info, row, canAppendDefaultValue)
+					event, err := genUpdate(schema, pinfo, info, row, canAppendDefaultValue, mode, ctx.Charsets)
 					if err != nil {
 						return nil, errors.Annotatef(err, "genUpdate failed")
 					}
 					pbBinlog.DmlData.Events = append(pbBinlog.DmlData.Events, *event)
 
 				case tipb.MutationType_DeleteRow:
-					event, err := genDelete(schema, info, row)
+					event, err := genDelete(schema, info, row, mode, ctx.Charsets)
 					if err != nil {
 						return nil, errors.Annotatef(err, "genDelete failed")
 					}
@@ -115,13 +117,16 @@ func TiBinlogToPbBinlog(infoGetter TableInfoGetter, schema string, table string,
 	return
 }
 
-func genInsert(schema string, ptable, table *model.TableInfo, row []byte) (event *pb.Event, err error) {
-	columns := table.Columns
+func genInsert(schema string, ptable, table *model.TableInfo, row []byte, mode string, charsets Charsets) (event *pb.Event, err error) {
+	columns := filterColumns(table.Columns, mode)
 
 	columnValues, err := insertRowToDatums(table, row)
 	if err != nil {
 		return nil, errors.Annotatef(err, "table `%s`.`%s`", schema, table.Name)
 	}
+	if err = evalVirtualColumns(table, mode, columnValues); err != nil {
+		return nil, errors.Trace(err)
+	}
 
 	var (
 		vals       = make([]types.Datum, 0, len(columns))
@@ -139,7 +144,7 @@ func genInsert(schema string, ptable, table *model.TableInfo, row []byte) (event
 			val = getDefaultOrZeroValue(ptable, col)
 		}
 
-		value, err := formatData(val, col.FieldType)
+		value, err := formatData(val, col.FieldType, charsets)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
@@ -156,14 +161,20 @@ func genInsert(schema string, ptable, table *model.TableInfo, row []byte) (event
 	return
 }
 
-func genUpdate(schema string, ptable, table *model.TableInfo, row []byte, canAppendDefaultValue bool) (event *pb.Event, err error) {
-	columns := writableColumns(table)
-	colsMap := util.ToColumnMap(columns)
+func genUpdate(schema string, ptable, table *model.TableInfo, row []byte, canAppendDefaultValue bool, mode string, charsets Charsets) (event *pb.Event, err error) {
+	columns := dmlColumns(table, mode)
+	colsMap := util.ToColumnMap(decodeColumns(table, mode))
 
 	oldColumnValues, newColumnValues, err := DecodeOldAndNewRow(row, colsMap, time.Local, canAppendDefaultValue, ptable)
 	if err != nil {
 		return nil, errors.Annotatef(err, "table `%s`.`%s`", schema, table.Name)
 	}
+	if err = evalVirtualColumns(table, mode, oldColumnValues); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = evalVirtualColumns(table, mode, newColumnValues); err != nil {
+		return nil, errors.Trace(err)
+	}
 
 	var (
 		oldVals    = make([]types.Datum, 0, len(columns))
@@ -175,11 +186,11 @@ func genUpdate(schema string, ptable, table *model.TableInfo, row []byte, canApp
 	for _, col := range columns {
 		val, ok := newColumnValues[col.ID]
 		if ok {
-			oldValue, err := formatData(oldColumnValues[col.ID], col.FieldType)
+			oldValue, err := formatData(oldColumnValues[col.ID], col.FieldType, charsets)
 			if err != nil {
 				return nil, errors.Trace(err)
 			}
-			newValue, err := formatData(val, col.FieldType)
+			newValue, err := formatData(val, col.FieldType, charsets)
 			if err != nil {
 				return nil, errors.Trace(err)
 			}
@@ -201,14 +212,17 @@ func genUpdate(schema string, ptable, table *model.TableInfo, row []byte, canApp
 	return
 }
 
-func genDelete(schema string, table *model.TableInfo, row []byte) (event *pb.Event, err error) {
-	columns := table.Columns
-	colsTypeMap := util.ToColumnTypeMap(columns)
+func genDelete(schema string, table *model.TableInfo, row []byte, mode string, charsets Charsets) (event *pb.Event, err error) {
+	columns := filterColumns(table.Columns, mode)
+	colsTypeMap := util.ToColumnTypeMap(table.Columns)
 
 	columnValues, err := tablecodec.DecodeRowToDatumMap(row, colsTypeMap, time.Local)
 	if err != nil {
 		return nil, errors.Annotatef(err, "table `%s`.`%s`", schema, table.Name)
 	}
+	if err = evalVirtualColumns(table, mode, columnValues); err != nil {
+		return nil, errors.Trace(err)
+	}
 
 	var (
 		vals       = make([]types.Datum, 0, len(columns))
@@ -219,7 +233,7 @@ func genDelete(schema string, table *model.TableInfo, row []byte) (event *pb.Eve
 	for _, col := range columns {
 		val, ok := columnValues[col.ID]
 		if ok {
-			value, err := formatData(val, col.FieldType)
+			value, err := formatData(val, col.FieldType, charsets)
 			if err != nil {
 				return nil, errors.Trace(err)
 			}
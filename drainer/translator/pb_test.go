@@ -32,7 +32,7 @@ var _ = check.Suite(&testPbSuite{})
 func (t *testPbSuite) TestDDL(c *check.C) {
 	t.SetDDL()
 
-	pbBinog, err := TiBinlogToPbBinlog(t, t.Schema, t.Table, t.TiBinlog, nil)
+	pbBinog, err := TiBinlogToPbBinlog(NewContext(t, t.TiBinlog, nil).WithTable(t.Schema, t.Table))
 	c.Assert(err, check.IsNil)
 
 	c.Log("get ddl: ", string(pbBinog.GetDdlQuery()))
@@ -45,7 +45,7 @@ func (t *testPbSuite) TestDDL(c *check.C) {
 
 	// test create database should not contains `use db`
 	t.TiBinlog.DdlQuery = []byte("create database test")
-	pbBinog, err = TiBinlogToPbBinlog(t, t.Schema, t.Table, t.TiBinlog, nil)
+	pbBinog, err = TiBinlogToPbBinlog(NewContext(t, t.TiBinlog, nil).WithTable(t.Schema, t.Table))
 	c.Assert(err, check.IsNil)
 
 	c.Log("get ddl: ", string(pbBinog.GetDdlQuery()))
@@ -57,8 +57,22 @@ func (t *testPbSuite) TestDDL(c *check.C) {
 	})
 }
 
+func (t *testPbSuite) TestDDLWithSQLMode(c *check.C) {
+	t.SetDDL()
+	t.TiBinlog.DdlQuery = []byte(`create table "t"(id int)`)
+
+	ctx := NewContext(t, t.TiBinlog, nil).WithTable(t.Schema, t.Table)
+	_, err := TiBinlogToPbBinlog(ctx)
+	c.Assert(err, check.NotNil)
+
+	ctx.SQLMode = mysql.ModeANSIQuotes
+	pbBinlog, err := TiBinlogToPbBinlog(ctx)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(pbBinlog.GetDdlQuery()), check.Equals, fmt.Sprintf("use `%s`; %s;", t.Schema, t.TiBinlog.GetDdlQuery()))
+}
+
 func (t *testPbSuite) testDML(c *check.C, tp pb.EventType) {
-	pbBinlog, err := TiBinlogToPbBinlog(t, t.Schema, t.Table, t.TiBinlog, t.PV)
+	pbBinlog, err := TiBinlogToPbBinlog(NewContext(t, t.TiBinlog, t.PV))
 	c.Assert(err, check.IsNil)
 
 	c.Assert(pbBinlog.GetCommitTs(), check.Equals, t.TiBinlog.GetCommitTs())
@@ -0,0 +1,176 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+)
+
+// removedSQLModes80 are the sql modes removed in MySQL 8.0, setting them fails.
+var removedSQLModes80 = map[string]struct{}{
+	"NO_AUTO_CREATE_USER": {},
+	"NO_FIELD_OPTIONS":    {},
+	"NO_KEY_OPTIONS":      {},
+	"NO_TABLE_OPTIONS":    {},
+	"DB2":                 {},
+	"MAXDB":               {},
+	"MSSQL":               {},
+	"MYSQL323":            {},
+	"MYSQL40":             {},
+	"ORACLE":              {},
+	"POSTGRESQL":          {},
+}
+
+// ValidateDownstreamSQLMode returns an error if the sql mode isn't valid or can't be set on the
+// version of downstream MySQL, an empty version means it's unknown.
+func ValidateDownstreamSQLMode(mode string, version string) error {
+	if _, err := mysql.GetSQLMode(mode); err != nil {
+		return errors.Annotatef(err, "invalid sql mode %s", mode)
+	}
+	if version != DownstreamVersion80 {
+		return nil
+	}
+	for _, name := range strings.Split(mode, ",") {
+		if _, ok := removedSQLModes80[name]; ok {
+			return errors.Errorf("sql mode %s is removed in MySQL %s", name, version)
+		}
+	}
+	return nil
+}
+
+// CheckDDLForSQLMode returns an error if the DDL can't be executed as it is under the sql mode of
+// downstream, so drainer stops before the DDL instead of failing at downstream or, worse, having
+// the DDL executed with a different meaning:
+//   - the DDL can't be parsed, or is parsed into another statement, like the double quoted
+//     strings taken as identifiers under ANSI_QUOTES
+//   - the zero dates are used as the default values of the columns under the strict mode with
+//     NO_ZERO_DATE or NO_ZERO_IN_DATE
+func CheckDDLForSQLMode(sql string, mode mysql.SQLMode) error {
+	stmt, err := getParser(sqlMode).ParseOneStmt(sql, "", "")
+	if err != nil {
+		return errorcode.Newf(errorcode.TranslatorUnsupportedDDL, "parse ddl %s failed: %v", sql, err)
+	}
+	downstreamStmt, err := getParser(mode).ParseOneStmt(sql, "", "")
+	if err != nil {
+		return errorcode.Newf(errorcode.TranslatorUnsupportedDDL,
+			"ddl %s can't be parsed under the sql mode of downstream: %v", sql, err)
+	}
+
+	restored, err := restoreDDL(stmt)
+	if err != nil {
+		return errors.Annotatef(err, "restore ddl %s failed", sql)
+	}
+	downstreamRestored, err := restoreDDL(downstreamStmt)
+	if err != nil {
+		return errors.Annotatef(err, "restore ddl %s failed", sql)
+	}
+	if restored != downstreamRestored {
+		return errorcode.Newf(errorcode.TranslatorUnsupportedDDL,
+			"ddl %s is parsed as %s under the sql mode of downstream", sql, downstreamRestored)
+	}
+
+	if !mode.HasStrictMode() || !(mode.HasNoZeroDateMode() || mode.HasNoZeroInDateMode()) {
+		return nil
+	}
+	for _, col := range ddlColumns(stmt) {
+		value, ok := zeroDateDefault(col)
+		if !ok {
+			continue
+		}
+		zeroDate, zeroInDate := isZeroDate(value)
+		if (zeroDate && mode.HasNoZeroDateMode()) || (zeroInDate && mode.HasNoZeroInDateMode()) {
+			return errorcode.Newf(errorcode.TranslatorUnsupportedDDL,
+				"the default value '%s' of column %s in ddl %s is invalid under the sql mode of downstream",
+				value, col.Name.Name.O, sql)
+		}
+	}
+	return nil
+}
+
+func restoreDDL(stmt ast.StmtNode) (string, error) {
+	var sb strings.Builder
+	if err := stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+		return "", errors.Trace(err)
+	}
+	return sb.String(), nil
+}
+
+// ddlColumns returns the columns created or changed by the DDL.
+func ddlColumns(stmt ast.StmtNode) []*ast.ColumnDef {
+	switch n := stmt.(type) {
+	case *ast.CreateTableStmt:
+		return n.Cols
+	case *ast.AlterTableStmt:
+		var cols []*ast.ColumnDef
+		for _, spec := range n.Specs {
+			cols = append(cols, spec.NewColumns...)
+		}
+		return cols
+	default:
+		return nil
+	}
+}
+
+// zeroDateDefault returns the default value of the date column if it's a string, the zero dates
+// are only written as strings.
+func zeroDateDefault(col *ast.ColumnDef) (string, bool) {
+	if col.Tp == nil {
+		return "", false
+	}
+	switch col.Tp.Tp {
+	case mysql.TypeDate, mysql.TypeDatetime, mysql.TypeTimestamp:
+	default:
+		return "", false
+	}
+	for _, option := range col.Options {
+		if option.Tp != ast.ColumnOptionDefaultValue {
+			continue
+		}
+		if v, ok := option.Expr.(ast.ValueExpr); ok {
+			if s, ok := v.GetValue().(string); ok {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
+
+// isZeroDate returns whether the date part of the value, like "0000-00-00 00:00:00", is all zero,
+// and whether its month or day is zero, the values failed to be parsed are neither.
+func isZeroDate(value string) (zeroDate bool, zeroInDate bool) {
+	date := strings.TrimSpace(value)
+	if i := strings.IndexAny(date, " T"); i >= 0 {
+		date = date[:i]
+	}
+	parts := strings.FieldsFunc(date, func(r rune) bool { return r == '-' || r == '/' || r == '.' })
+	if len(parts) != 3 {
+		return false, false
+	}
+	zeros := make([]bool, len(parts))
+	for i, part := range parts {
+		if len(part) == 0 || len(strings.Trim(part, "0123456789")) > 0 {
+			return false, false
+		}
+		zeros[i] = len(strings.Trim(part, "0")) == 0
+	}
+	zeroDate = zeros[0] && zeros[1] && zeros[2]
+	zeroInDate = !zeroDate && (zeros[1] || zeros[2])
+	return
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"github.com/pingcap/check"
+	"github.com/pingcap/parser/mysql"
+)
+
+type sqlModeSuite struct{}
+
+var _ = check.Suite(&sqlModeSuite{})
+
+func (s *sqlModeSuite) TestValidateDownstreamSQLMode(c *check.C) {
+	tests := []struct {
+		mode    string
+		version string
+		err     string
+	}{
+		{"", "", ""},
+		{"STRICT_TRANS_TABLES,NO_ZERO_DATE", "8.0", ""},
+		{"NO_AUTO_CREATE_USER", "5.7", ""},
+		{"NO_AUTO_CREATE_USER", "", ""},
+		{"STRICT_TRANS_TABLES,NO_AUTO_CREATE_USER", "8.0", ".*NO_AUTO_CREATE_USER is removed in MySQL 8.0.*"},
+		{"ORACLE", "8.0", ".*ORACLE is removed in MySQL 8.0.*"},
+		{"NO_SUCH_MODE", "", ".*invalid sql mode.*"},
+	}
+	for _, test := range tests {
+		err := ValidateDownstreamSQLMode(test.mode, test.version)
+		if len(test.err) == 0 {
+			c.Assert(err, check.IsNil, check.Commentf("mode: %s, version: %s", test.mode, test.version))
+		} else {
+			c.Assert(err, check.ErrorMatches, test.err, check.Commentf("mode: %s, version: %s", test.mode, test.version))
+		}
+	}
+}
+
+func (s *sqlModeSuite) TestCheckDDLForSQLMode(c *check.C) {
+	strict, err := mysql.GetSQLMode("STRICT_TRANS_TABLES,NO_ZERO_DATE,NO_ZERO_IN_DATE")
+	c.Assert(err, check.IsNil)
+	noZeroDate, err := mysql.GetSQLMode("NO_ZERO_DATE,NO_ZERO_IN_DATE")
+	c.Assert(err, check.IsNil)
+	ansiQuotes, err := mysql.GetSQLMode("ANSI_QUOTES")
+	c.Assert(err, check.IsNil)
+
+	tests := []struct {
+		sql  string
+		mode mysql.SQLMode
+		err  string
+	}{
+		{"create table t(id int primary key, a varchar(10) default 'x')", strict, ""},
+		{"create table t(a datetime default '2021-05-01 00:00:00', b date default '2021-05-01')", strict, ""},
+		{"create table t(a datetime default '0000-00-00 00:00:00')", strict, ".*default value '0000-00-00 00:00:00' of column a.*"},
+		{"create table t(a date default '2021-00-01')", strict, ".*default value '2021-00-01' of column a.*"},
+		{"alter table t add column b timestamp not null default '0000-00-00'", strict, ".*default value '0000-00-00' of column b.*"},
+		{"alter table t modify column b timestamp default '0000-00-00'", mysql.ModeStrictAllTables | mysql.ModeNoZeroInDate, ""},
+		// the zero dates are only warned without the strict mode.
+		{"create table t(a datetime default '0000-00-00 00:00:00')", noZeroDate, ""},
+		{"create table t(a varchar(10) default '0000-00-00')", strict, ""},
+		{`create table t(a varchar(10) default "x")`, 0, ""},
+		{`create table t(a varchar(10) default "x")`, ansiQuotes, ".*under the sql mode of downstream.*"},
+		{`create table "t"(a int)`, ansiQuotes, ".*parse ddl.*"},
+		{"create table `t`(a int)", ansiQuotes, ""},
+	}
+	for _, test := range tests {
+		err := CheckDDLForSQLMode(test.sql, test.mode)
+		if len(test.err) == 0 {
+			c.Assert(err, check.IsNil, check.Commentf("sql: %s", test.sql))
+		} else {
+			c.Assert(err, check.ErrorMatches, test.err, check.Commentf("sql: %s", test.sql))
+		}
+	}
+}
+
+func (s *sqlModeSuite) TestIsZeroDate(c *check.C) {
+	tests := []struct {
+		value      string
+		zeroDate   bool
+		zeroInDate bool
+	}{
+		{"0000-00-00", true, false},
+		{"0000-00-00 00:00:00.000", true, false},
+		{"2021-00-00", false, true},
+		{"2021-05-00T00:00:00", false, true},
+		{"0000-05-01", false, false},
+		{"2021/05/01", false, false},
+		{"CURRENT_TIMESTAMP", false, false},
+		{"", false, false},
+	}
+	for _, test := range tests {
+		zeroDate, zeroInDate := isZeroDate(test.value)
+		c.Assert([]bool{zeroDate, zeroInDate}, check.DeepEquals, []bool{test.zeroDate, test.zeroInDate}, check.Commentf("value: %s", test.value))
+	}
+}
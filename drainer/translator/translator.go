@@ -27,19 +27,83 @@ import (
 	"github.com/pingcap/tidb/tablecodec"
 	"github.com/pingcap/tidb/types"
 	"github.com/pingcap/tidb/util/codec"
+	tipb "github.com/pingcap/tipb/go-binlog"
 	"go.uber.org/zap"
 )
 
 var sqlMode mysql.SQLMode
 
+// Context is what a binlog is translated with, the options of the translators are
+// added as its fields so that adding one doesn't change the signature of every translator.
+type Context struct {
+	InfoGetter    TableInfoGetter
+	Binlog        *tipb.Binlog
+	PrewriteValue *tipb.PrewriteValue // only for DML
+
+	CommitTS      int64
+	SchemaVersion int64
+	// Schema and Table are the names of the table changed by the DDL.
+	Schema string
+	Table  string
+	// SQLMode is used to parse the DDL.
+	SQLMode mysql.SQLMode
+	// ShouldSkip is true if the DDL should not be executed at downstream.
+	ShouldSkip bool
+	// GeneratedColumns returns the mode of the generated columns of the table in the DMLs,
+	// the default mode of the format is used if it's nil or returns empty.
+	GeneratedColumns func(schema string, table string) string
+	// NoKeyTables returns the mode of the DMLs of the table without primary key and unique key,
+	// NoKeyTableFullRow is used if it's nil or returns empty.
+	NoKeyTables func(schema string, table string) string
+	// Charsets are the charsets of the columns whose values are converted to utf8, the values
+	// are kept as is if it's nil.
+	Charsets Charsets
+	// ColumnCharsets collects the charsets of the string, enum and set columns of the tables translated
+	// to the secondary binlog by "<schema>.<table>" and the column names, nothing is collected if it's nil.
+	ColumnCharsets map[string]map[string]string
+}
+
+// NewContext creates a Context of the binlog with the sql mode set by SetSQLMode.
+func NewContext(infoGetter TableInfoGetter, binlog *tipb.Binlog, pv *tipb.PrewriteValue) *Context {
+	return &Context{
+		InfoGetter:    infoGetter,
+		Binlog:        binlog,
+		PrewriteValue: pv,
+		CommitTS:      binlog.GetCommitTs(),
+		SchemaVersion: pv.GetSchemaVersion(),
+		SQLMode:       sqlMode,
+	}
+}
+
+// WithTable sets the names of the table changed by the DDL.
+func (ctx *Context) WithTable(schema string, table string) *Context {
+	ctx.Schema = schema
+	ctx.Table = table
+	return ctx
+}
+
+// addColumnCharset adds the charset of the column to ColumnCharsets if it's not nil.
+func (ctx *Context) addColumnCharset(schema string, table string, column string, charset string) {
+	if ctx.ColumnCharsets == nil {
+		return
+	}
+	name := schema + "." + table
+	columns, ok := ctx.ColumnCharsets[name]
+	if !ok {
+		columns = make(map[string]string)
+		ctx.ColumnCharsets[name] = columns
+	}
+	columns[column] = charset
+}
+
 // SetSQLMode set the sql mode of parser
 func SetSQLMode(mode mysql.SQLMode) {
 	sqlMode = mode
 }
 
-func getParser() (p *parser.Parser) {
+func getParser(mode mysql.SQLMode) (p *parser.Parser) {
 	p = parser.New()
-	p.SetSQLMode(sqlMode)
+	p.SetSQLMode(mode)
 
 	return
 }
@@ -341,8 +405,7 @@ type updateDecoder struct {
 	ptable                *model.TableInfo
 }
 
-func newUpdateDecoder(ptable, table *model.TableInfo, canAppendDefaultValue bool) updateDecoder {
-	columns := writableColumns(table)
+func newUpdateDecoder(ptable *model.TableInfo, columns []*model.ColumnInfo, canAppendDefaultValue bool) updateDecoder {
 	return updateDecoder{
 		columns:               util.ToColumnMap(columns),
 		canAppendDefaultValue: canAppendDefaultValue,
@@ -0,0 +1,168 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/unrolled/render"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAutoTuneTargetLatency = 1.0
+	defaultAutoTuneMaxErrorRate  = 0.1
+	defaultAutoTuneInterval      = 10
+)
+
+// AutoTuneConfig is the config of adjusting txn-batch and worker-count of the
+// loader by the latency and error rate of downstream, in the bounds.
+type AutoTuneConfig struct {
+	Enable         bool `toml:"enable" json:"enable"`
+	MinWorkerCount int  `toml:"min-worker-count" json:"min-worker-count"`
+	MaxWorkerCount int  `toml:"max-worker-count" json:"max-worker-count"`
+	MinTxnBatch    int  `toml:"min-txn-batch" json:"min-txn-batch"`
+	MaxTxnBatch    int  `toml:"max-txn-batch" json:"max-txn-batch"`
+	// TargetLatency is the expected seconds of executing a batch of DMLs.
+	TargetLatency float64 `toml:"target-latency" json:"target-latency"`
+	// MaxErrorRate is the max ratio of the retries to the executed batches.
+	MaxErrorRate float64 `toml:"max-error-rate" json:"max-error-rate"`
+	// Interval is the seconds between the adjustments.
+	Interval int `toml:"interval" json:"interval"`
+}
+
+func (c *AutoTuneConfig) enabled() bool {
+	return c != nil && c.Enable
+}
+
+// adjust fills the bounds not set by the ones around worker-count and txn-batch.
+func (c *AutoTuneConfig) adjust(workerCount, txnBatch int) {
+	util.AdjustInt(&c.MinWorkerCount, 1)
+	util.AdjustInt(&c.MaxWorkerCount, workerCount*4)
+	util.AdjustInt(&c.MinTxnBatch, 1)
+	util.AdjustInt(&c.MaxTxnBatch, txnBatch*4)
+	if c.TargetLatency <= 0 {
+		c.TargetLatency = defaultAutoTuneTargetLatency
+	}
+	if c.MaxErrorRate <= 0 {
+		c.MaxErrorRate = defaultAutoTuneMaxErrorRate
+	}
+	util.AdjustInt(&c.Interval, defaultAutoTuneInterval)
+}
+
+func (c *AutoTuneConfig) validate(workerCount, txnBatch int) error {
+	if c.MinWorkerCount > workerCount || workerCount > c.MaxWorkerCount {
+		return errors.Errorf("worker-count %d is not in [min-worker-count, max-worker-count] of auto-tune [%d, %d]",
+			workerCount, c.MinWorkerCount, c.MaxWorkerCount)
+	}
+	if c.MinTxnBatch > txnBatch || txnBatch > c.MaxTxnBatch {
+		return errors.Errorf("txn-batch %d is not in [min-txn-batch, max-txn-batch] of auto-tune [%d, %d]",
+			txnBatch, c.MinTxnBatch, c.MaxTxnBatch)
+	}
+	return nil
+}
+
+func (c *AutoTuneConfig) loaderConfig() *loader.AutoTuneConfig {
+	return &loader.AutoTuneConfig{
+		MinWorkerCount: c.MinWorkerCount,
+		MaxWorkerCount: c.MaxWorkerCount,
+		MinBatchSize:   c.MinTxnBatch,
+		MaxBatchSize:   c.MaxTxnBatch,
+		TargetLatency:  time.Duration(c.TargetLatency * float64(time.Second)),
+		MaxErrorRate:   c.MaxErrorRate,
+		Interval:       time.Duration(c.Interval) * time.Second,
+	}
+}
+
+// TuningRequest changes txn-batch and worker-count of the loader, zero keeps
+// the current value.
+type TuningRequest struct {
+	WorkerCount int `json:"worker-count"`
+	TxnBatch    int `json:"txn-batch"`
+}
+
+// TuningStatus is the current txn-batch and worker-count of the loader.
+type TuningStatus struct {
+	WorkerCount int `json:"worker-count"`
+	TxnBatch    int `json:"txn-batch"`
+	// AutoTune is true if they are adjusted by drainer automatically.
+	AutoTune bool `json:"auto-tune"`
+}
+
+// loaderTuner returns the tuner of the loader if the syncer writes to MySQL or TiDB.
+func (s *Syncer) loaderTuner() loader.Tuner {
+	t, ok := s.dsyncer.(interface{ Tuner() loader.Tuner })
+	if !ok {
+		return nil
+	}
+	return t.Tuner()
+}
+
+// Tuning exposes api to get txn-batch and worker-count of the loader by GET
+// and change them at runtime by PUT with TuningRequest in the body. They may
+// be adjusted again by auto-tune if it's enabled.
+func (s *Server) Tuning(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	renderJSON := func(resp *util.Response) {
+		if err := rd.JSON(w, http.StatusOK, resp); err != nil {
+			log.Error("Failed to render JSON response", zap.Error(err))
+		}
+	}
+
+	tuner := s.syncer.loaderTuner()
+	if tuner == nil {
+		renderJSON(util.ErrCodeResponsef(errorcode.InvalidState, "txn-batch and worker-count can't be changed when db-type is %s", s.cfg.SyncerCfg.DestDBType))
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		req := new(TuningRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			renderJSON(util.ErrCodeResponsef(errorcode.InvalidArgument, "invalid request: %v", err))
+			return
+		}
+		if req.WorkerCount < 0 || req.TxnBatch < 0 {
+			renderJSON(util.ErrCodeResponsef(errorcode.InvalidArgument, "invalid worker-count %d or txn-batch %d", req.WorkerCount, req.TxnBatch))
+			return
+		}
+		if req.WorkerCount > 0 {
+			if err := tuner.SetWorkerCount(req.WorkerCount); err != nil {
+				renderJSON(util.ErrCodeResponsef(errorcode.InvalidState, "set worker-count failed: %v", err))
+				return
+			}
+		}
+		if req.TxnBatch > 0 {
+			if err := tuner.SetBatchSize(req.TxnBatch); err != nil {
+				renderJSON(util.ErrCodeResponsef(errorcode.InvalidState, "set txn-batch failed: %v", err))
+				return
+			}
+		}
+		log.Info("change the loader by HTTP", zap.Int("worker-count", req.WorkerCount), zap.Int("txn-batch", req.TxnBatch))
+	}
+
+	renderJSON(util.SuccessResponse("success", &TuningStatus{
+		WorkerCount: tuner.WorkerCount(),
+		TxnBatch:    tuner.BatchSize(),
+		AutoTune:    s.cfg.SyncerCfg.AutoTune.enabled(),
+	}))
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/pingcap/check"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+)
+
+type tuneSuite struct{}
+
+var _ = Suite(&tuneSuite{})
+
+type fakeTuner struct {
+	workerCount int
+	batchSize   int
+}
+
+func (t *fakeTuner) WorkerCount() int { return t.workerCount }
+func (t *fakeTuner) BatchSize() int   { return t.batchSize }
+func (t *fakeTuner) SetWorkerCount(n int) error {
+	t.workerCount = n
+	return nil
+}
+func (t *fakeTuner) SetBatchSize(n int) error {
+	t.batchSize = n
+	return nil
+}
+
+type tunableSyncer struct {
+	dsync.Syncer
+	tuner *fakeTuner
+}
+
+func (s *tunableSyncer) Tuner() loader.Tuner {
+	return s.tuner
+}
+
+func (s *tuneSuite) TestAutoTuneConfig(c *C) {
+	cfg := NewConfig()
+	cfg.SyncerCfg.WorkerCount = 16
+	cfg.SyncerCfg.TxnBatch = 20
+	cfg.SyncerCfg.DestDBType = "mysql"
+	cfg.SyncerCfg.AutoTune = &AutoTuneConfig{MinWorkerCount: 4}
+	c.Assert(cfg.adjustConfig(), IsNil)
+	c.Assert(cfg.SyncerCfg.To.AutoTune, IsNil)
+
+	cfg.SyncerCfg.AutoTune.Enable = true
+	c.Assert(cfg.adjustConfig(), IsNil)
+	c.Assert(cfg.SyncerCfg.To.AutoTune, DeepEquals, &loader.AutoTuneConfig{
+		MinWorkerCount: 4,
+		MaxWorkerCount: 64,
+		MinBatchSize:   1,
+		MaxBatchSize:   80,
+		TargetLatency:  time.Second,
+		MaxErrorRate:   defaultAutoTuneMaxErrorRate,
+		Interval:       defaultAutoTuneInterval * time.Second,
+	})
+	c.Assert(cfg.SyncerCfg.AutoTune.validate(16, 20), IsNil)
+
+	c.Assert(cfg.SyncerCfg.AutoTune.validate(2, 20), ErrorMatches, "worker-count 2 is not in .*")
+	c.Assert(cfg.SyncerCfg.AutoTune.validate(16, 100), ErrorMatches, "txn-batch 100 is not in .*")
+}
+
+func (s *tuneSuite) TestTuning(c *C) {
+	tuner := &fakeTuner{workerCount: 16, batchSize: 20}
+	server := &Server{
+		cfg:    NewConfig(),
+		syncer: &Syncer{dsyncer: &tunableSyncer{tuner: tuner}},
+	}
+	router := server.initAPIRouter()
+
+	request := func(method string, body string) *TuningStatus {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "/syncer/tuning", strings.NewReader(body)))
+		var resp struct {
+			Code      int            `json:"code"`
+			ErrorCode errorcode.Code `json:"error_code"`
+			Data      *TuningStatus  `json:"data"`
+		}
+		c.Assert(json.Unmarshal(w.Body.Bytes(), &resp), IsNil)
+		if resp.Code != 200 {
+			c.Assert(resp.ErrorCode, Equals, errorcode.InvalidArgument)
+			return nil
+		}
+		return resp.Data
+	}
+
+	c.Assert(request("GET", ""), DeepEquals, &TuningStatus{WorkerCount: 16, TxnBatch: 20})
+	c.Assert(request("PUT", `{"worker-count": 8}`), DeepEquals, &TuningStatus{WorkerCount: 8, TxnBatch: 20})
+	c.Assert(request("PUT", `{"txn-batch": 100}`), DeepEquals, &TuningStatus{WorkerCount: 8, TxnBatch: 100})
+	c.Assert(request("PUT", `{"worker-count": -1}`), IsNil)
+	c.Assert(request("PUT", `{`), IsNil)
+	c.Assert(tuner, DeepEquals, &fakeTuner{workerCount: 8, batchSize: 100})
+
+	// not supported by the syncers not to MySQL or TiDB.
+	server.syncer.dsyncer = newInterceptSyncer()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/syncer/tuning", nil))
+	c.Assert(w.Body.String(), Matches, `(?s).*"error_code": "INVALID_STATE".*`)
+}
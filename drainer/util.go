@@ -22,6 +22,7 @@ import (
 	"path"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/pingcap/errors"
@@ -87,9 +88,11 @@ func GenCheckPointCfg(cfg *Config, id uint64) (*checkpoint.Config, error) {
 		ClusterID:       id,
 		InitialCommitTS: cfg.InitialCommitTS,
 		CheckPointFile:  path.Join(cfg.DataDir, "savepoint"),
+		InstanceID:      cfg.NodeID,
 	}
 
 	toCheckpoint := cfg.SyncerCfg.To.Checkpoint
+	checkpointCfg.TakeoverAfter = time.Duration(toCheckpoint.TakeoverAfter) * time.Second
 
 	if toCheckpoint.Schema != "" {
 		checkpointCfg.Schema = toCheckpoint.Schema
@@ -118,7 +121,7 @@ func GenCheckPointCfg(cfg *Config, id uint64) (*checkpoint.Config, error) {
 			}
 		case "pb", "file":
 			checkpointCfg.CheckpointType = "file"
-		case "kafka":
+		case "kafka", "pubsub", "kinesis":
 			checkpointCfg.CheckpointType = "file"
 		case "flash":
 			return nil, errors.New("the flash DestDBType is no longer supported")
@@ -126,7 +129,16 @@ func GenCheckPointCfg(cfg *Config, id uint64) (*checkpoint.Config, error) {
 			return nil, errors.Errorf("unknown DestDBType: %s", cfg.SyncerCfg.DestDBType)
 		}
 	default:
-		return nil, errors.Errorf("unknown checkpoint type: %s", toCheckpoint.Type)
+		if !checkpoint.IsRegistered(toCheckpoint.Type) {
+			return nil, errors.Errorf("unknown checkpoint type: %s", toCheckpoint.Type)
+		}
+		checkpointCfg.CheckpointType = toCheckpoint.Type
+		if len(toCheckpoint.File) > 0 {
+			checkpointCfg.CheckPointFile = toCheckpoint.File
+		}
+		consul := toCheckpoint.Consul
+		consul.TLS = toCheckpoint.TLS
+		checkpointCfg.Consul = &consul
 	}
 
 	return checkpointCfg, nil
@@ -169,6 +181,38 @@ func loadHistoryDDLJobs(tiStore kv.Storage) ([]*model.Job, error) {
 	return jobs, nil
 }
 
+// LoadSchemaVersionAt loads the history DDL jobs from TiKV and returns the
+// schema version at the commit ts, which can be saved with the checkpoint at ts.
+func LoadSchemaVersionAt(pdURLs string, ts int64) (int64, error) {
+	tiStore, err := createTiStore(pdURLs)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer tiStore.Close()
+
+	jobs, err := loadHistoryDDLJobs(tiStore)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return schemaVersionAt(jobs, ts), nil
+}
+
+// schemaVersionAt returns the max schema version of the jobs finished not after ts,
+// the jobs without finished ts are created by the old versions of TiDB and are
+// taken as finished long ago.
+func schemaVersionAt(jobs []*model.Job, ts int64) int64 {
+	var version int64
+	for _, job := range jobs {
+		if job.BinlogInfo.FinishedTS > uint64(ts) {
+			continue
+		}
+		if job.BinlogInfo.SchemaVersion > version {
+			version = job.BinlogInfo.SchemaVersion
+		}
+	}
+	return version
+}
+
 func getSnapshotMeta(tiStore kv.Storage) (*meta.Meta, error) {
 	version, err := tiStore.CurrentVersion(oracle.GlobalTxnScope)
 	if err != nil {
@@ -15,6 +15,8 @@ package drainer
 
 import (
 	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
 )
 
 type taskGroupSuite struct{}
@@ -40,3 +42,55 @@ func (s *taskGroupSuite) TestShouldRecoverFromPanic(c *C) {
 	c.Assert(logHook.Entrys[1].Message, Matches, ".*Exit.*")
 }
 */
+
+type schemaVersionSuite struct{}
+
+var _ = Suite(&schemaVersionSuite{})
+
+func (s *schemaVersionSuite) TestSchemaVersionAt(c *C) {
+	jobs := []*model.Job{
+		{BinlogInfo: &model.HistoryInfo{SchemaVersion: 1}},
+		{BinlogInfo: &model.HistoryInfo{SchemaVersion: 2, FinishedTS: 100}},
+		{BinlogInfo: &model.HistoryInfo{SchemaVersion: 4, FinishedTS: 300}},
+		{BinlogInfo: &model.HistoryInfo{SchemaVersion: 3, FinishedTS: 200}},
+	}
+	c.Assert(schemaVersionAt(jobs, 50), Equals, int64(1))
+	c.Assert(schemaVersionAt(jobs, 100), Equals, int64(2))
+	c.Assert(schemaVersionAt(jobs, 250), Equals, int64(3))
+	c.Assert(schemaVersionAt(jobs, 1000), Equals, int64(4))
+	c.Assert(schemaVersionAt(nil, 1000), Equals, int64(0))
+}
+
+type checkpointCfgSuite struct{}
+
+var _ = Suite(&checkpointCfgSuite{})
+
+func (s *checkpointCfgSuite) TestGenCheckPointCfg(c *C) {
+	cfg := NewConfig()
+	cfg.DataDir = "/data"
+	cfg.SyncerCfg.DestDBType = "kafka"
+	cfg.SyncerCfg.To = &dsync.DBConfig{}
+
+	cpCfg, err := GenCheckPointCfg(cfg, 42)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.CheckpointType, Equals, "file")
+	c.Assert(cpCfg.CheckPointFile, Equals, "/data/savepoint")
+
+	cfg.SyncerCfg.To.Checkpoint.Type = "file-sync"
+	cfg.SyncerCfg.To.Checkpoint.File = "/nfs/drainer/savepoint"
+	cpCfg, err = GenCheckPointCfg(cfg, 42)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.CheckpointType, Equals, "file-sync")
+	c.Assert(cpCfg.CheckPointFile, Equals, "/nfs/drainer/savepoint")
+
+	cfg.SyncerCfg.To.Checkpoint.Type = "consul"
+	cfg.SyncerCfg.To.Checkpoint.Consul.Addr = "127.0.0.1:8500"
+	cpCfg, err = GenCheckPointCfg(cfg, 42)
+	c.Assert(err, IsNil)
+	c.Assert(cpCfg.CheckpointType, Equals, "consul")
+	c.Assert(cpCfg.Consul.Addr, Equals, "127.0.0.1:8500")
+
+	cfg.SyncerCfg.To.Checkpoint.Type = "etcd"
+	_, err = GenCheckPointCfg(cfg, 42)
+	c.Assert(err, ErrorMatches, "unknown checkpoint type: etcd")
+}
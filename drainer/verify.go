@@ -0,0 +1,289 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultVerifyChunkSize        = 1000
+	defaultVerifyCheckThreadCount = 4
+)
+
+// VerifyConfig is the config of verifying the synced tables by comparing the
+// checksums of upstream and downstream at the same consistent ts.
+type VerifyConfig struct {
+	// Interval is the interval in seconds between the verifications, 0 disables it.
+	Interval int `toml:"interval" json:"interval"`
+	// Upstream is the upstream TiDB to read the snapshot at the verified ts.
+	Upstream *dsync.DBConfig    `toml:"upstream" json:"upstream"`
+	Tables   []filter.TableName `toml:"table" json:"table"`
+	// ChunkSize is the number of rows in a chunk whose checksums are compared.
+	ChunkSize int `toml:"chunk-size" json:"chunk-size"`
+	// Sample is the percent of the chunks to verify, 0 means 100.
+	Sample           int `toml:"sample" json:"sample"`
+	CheckThreadCount int `toml:"check-thread-count" json:"check-thread-count"`
+	// FixSQLFile is the file the SQLs fixing the mismatched rows of downstream
+	// are appended to, they are only logged if it's empty.
+	FixSQLFile string `toml:"fix-sql-file" json:"fix-sql-file"`
+}
+
+// enabled returns true if the verification is enabled.
+func (c *VerifyConfig) enabled() bool {
+	return c != nil && c.Interval > 0
+}
+
+func (c *VerifyConfig) adjust() {
+	if c.ChunkSize <= 0 {
+		c.ChunkSize = defaultVerifyChunkSize
+	}
+	if c.Sample == 0 {
+		c.Sample = 100
+	}
+	if c.CheckThreadCount <= 0 {
+		c.CheckThreadCount = defaultVerifyCheckThreadCount
+	}
+}
+
+var createVerifyDB = loader.CreateDBWithSQLMode
+
+// verifySnapshot is the upstream and downstream data to verify at the same ts.
+type verifySnapshot struct {
+	ts         int64
+	upstream   *gosql.DB
+	downstream *gosql.DB
+	// checkpointDB is the writable downstream to save the progress of diff.
+	checkpointDB *gosql.DB
+}
+
+func (s *verifySnapshot) close() {
+	for _, db := range []*gosql.DB{s.upstream, s.downstream, s.checkpointDB} {
+		if db != nil {
+			db.Close()
+		}
+	}
+}
+
+// verifier verifies the synced tables at the ts when all the binlogs before
+// have been synced to downstream.
+type verifier struct {
+	cfg        *VerifyConfig
+	downstream *dsync.DBConfig
+	// if downstream is TiDB, it's verified with the snapshot too, so the
+	// syncing can continue during the verification.
+	downstreamSnapshot bool
+
+	running int32
+}
+
+func newVerifier(cfg *VerifyConfig, downstream *dsync.DBConfig, destDBType string) *verifier {
+	return &verifier{
+		cfg:                cfg,
+		downstream:         downstream,
+		downstreamSnapshot: destDBType == "tidb",
+	}
+}
+
+// snapshot opens the snapshot of upstream at ts, and the one of downstream
+// if it's TiDB, the downstream must have synced all binlogs until ts.
+func (v *verifier) snapshot(ctx context.Context, ts int64) (snap *verifySnapshot, err error) {
+	snap = &verifySnapshot{ts: ts}
+	defer func() {
+		if err != nil {
+			snap.close()
+		}
+	}()
+
+	up := v.cfg.Upstream
+	snap.upstream, err = createVerifyDB(up.User, up.Password, up.Host, up.Port, up.TLS, nil, map[string]string{"tidb_snapshot": strconv.FormatInt(ts, 10)})
+	if err != nil {
+		return nil, errors.Annotate(err, "open upstream snapshot")
+	}
+
+	down := v.downstream
+	snap.checkpointDB, err = createVerifyDB(down.User, down.Password, down.Host, down.Port, down.TLS, nil, nil)
+	if err != nil {
+		return nil, errors.Annotate(err, "open downstream")
+	}
+	snap.downstream = snap.checkpointDB
+
+	if v.downstreamSnapshot {
+		var downTS int64
+		downTS, err = currentTiDBTS(ctx, snap.checkpointDB)
+		if err != nil {
+			return nil, errors.Annotate(err, "get the current ts of downstream")
+		}
+		snap.downstream, err = createVerifyDB(down.User, down.Password, down.Host, down.Port, down.TLS, nil, map[string]string{"tidb_snapshot": strconv.FormatInt(downTS, 10)})
+		if err != nil {
+			return nil, errors.Annotate(err, "open downstream snapshot")
+		}
+		log.Info("verify with the snapshot of downstream", zap.Int64("ts", ts), zap.Int64("downstream ts", downTS))
+	}
+	return snap, nil
+}
+
+// start starts verifying the tables at ts, all the binlogs until ts must
+// have been synced to downstream. It returns after the verification is done if
+// the downstream is not TiDB, or the syncing would change the verified data.
+func (v *verifier) start(ctx context.Context, ts int64) {
+	log.Info("start to verify tables", zap.Int64("ts", ts))
+	snap, err := v.snapshot(ctx, ts)
+	if err != nil {
+		log.Error("open the snapshot to verify failed", zap.Int64("ts", ts), zap.Error(err))
+		verifyCounter.WithLabelValues("error").Add(float64(len(v.cfg.Tables)))
+		atomic.StoreInt32(&v.running, 0)
+		return
+	}
+
+	if v.downstreamSnapshot {
+		go v.verify(ctx, snap)
+		return
+	}
+	v.verify(ctx, snap)
+}
+
+func currentTiDBTS(ctx context.Context, db *gosql.DB) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer tx.Rollback()
+
+	var ts int64
+	err = tx.QueryRowContext(ctx, "SELECT @@tidb_current_ts").Scan(&ts)
+	return ts, errors.Trace(err)
+}
+
+// verify verifies all the tables with the snapshot and closes it, the
+// mismatches are reported by logs and metrics.
+func (v *verifier) verify(ctx context.Context, snap *verifySnapshot) {
+	defer snap.close()
+	defer atomic.StoreInt32(&v.running, 0)
+
+	var fixSQLs fixSQLWriter
+	if len(v.cfg.FixSQLFile) > 0 {
+		f, err := os.OpenFile(v.cfg.FixSQLFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Error("open fix sql file failed", zap.String("file", v.cfg.FixSQLFile), zap.Error(err))
+		} else {
+			defer f.Close()
+			fixSQLs.file = f
+		}
+	}
+
+	beginTime := time.Now()
+	mismatched := 0
+	for _, table := range v.cfg.Tables {
+		fixSQLs.setTable(snap.ts, table)
+		equal, err := v.verifyTable(ctx, snap, table, fixSQLs.write)
+		switch {
+		case err != nil:
+			log.Error("verify table failed", zap.Int64("ts", snap.ts), zap.String("schema", table.Schema),
+				zap.String("table", table.Table), zap.Error(err))
+			verifyCounter.WithLabelValues("error").Add(1)
+		case !equal:
+			log.Error("the data of downstream mismatches upstream", zap.Int64("ts", snap.ts),
+				zap.String("schema", table.Schema), zap.String("table", table.Table))
+			verifyCounter.WithLabelValues("mismatch").Add(1)
+			mismatched++
+		default:
+			verifyCounter.WithLabelValues("equal").Add(1)
+		}
+	}
+
+	verifyMismatchGauge.Set(float64(mismatched))
+	verifyTSGauge.Set(float64(snap.ts))
+	log.Info("verify tables finished", zap.Int64("ts", snap.ts), zap.Int("tables", len(v.cfg.Tables)),
+		zap.Int("mismatched", mismatched), zap.Duration("take", time.Since(beginTime)))
+}
+
+var equalTable = func(ctx context.Context, td *diff.TableDiff, writeFixSQL func(string) error) (structEqual bool, dataEqual bool, err error) {
+	return td.Equal(ctx, writeFixSQL)
+}
+
+func (v *verifier) verifyTable(ctx context.Context, snap *verifySnapshot, table filter.TableName, writeFixSQL func(string) error) (bool, error) {
+	td := &diff.TableDiff{
+		SourceTables: []*diff.TableInstance{{
+			Conn:       snap.upstream,
+			Schema:     table.Schema,
+			Table:      table.Table,
+			InstanceID: "upstream",
+		}},
+		TargetTable: &diff.TableInstance{
+			Conn:       snap.downstream,
+			Schema:     table.Schema,
+			Table:      table.Table,
+			InstanceID: "downstream",
+		},
+		ChunkSize:        v.cfg.ChunkSize,
+		Sample:           v.cfg.Sample,
+		CheckThreadCount: v.cfg.CheckThreadCount,
+		UseChecksum:      true,
+		CpDB:             snap.checkpointDB,
+	}
+
+	structEqual, dataEqual, err := equalTable(ctx, td, writeFixSQL)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	if !structEqual {
+		log.Error("the struct of downstream table mismatches upstream", zap.String("schema", table.Schema), zap.String("table", table.Table))
+	}
+	return structEqual && dataEqual, nil
+}
+
+// fixSQLWriter logs the SQLs fixing the mismatched rows, and appends them to
+// the file if set.
+type fixSQLWriter struct {
+	sync.Mutex
+	file  *os.File
+	ts    int64
+	table filter.TableName
+}
+
+func (w *fixSQLWriter) setTable(ts int64, table filter.TableName) {
+	w.Lock()
+	w.ts = ts
+	w.table = table
+	w.Unlock()
+}
+
+func (w *fixSQLWriter) write(sql string) error {
+	w.Lock()
+	defer w.Unlock()
+
+	log.Warn("mismatched row", zap.Int64("ts", w.ts), zap.String("schema", w.table.Schema),
+		zap.String("table", w.table.Table), zap.String("fix sql", sql))
+	if w.file == nil {
+		return nil
+	}
+	_, err := fmt.Fprintf(w.file, "-- ts: %d, table: `%s`.`%s`\n%s\n", w.ts, w.table.Schema, w.table.Table, sql)
+	return errors.Trace(err)
+}
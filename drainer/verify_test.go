@@ -0,0 +1,139 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"context"
+	"crypto/tls"
+	gosql "database/sql"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+)
+
+var _ = Suite(&verifySuite{})
+
+type verifySuite struct{}
+
+type verifyDBs struct {
+	mocks  map[string]sqlmock.Sqlmock
+	params []map[string]string
+}
+
+func (s *verifySuite) mockDBs(c *C) (*verifyDBs, func()) {
+	dbs := &verifyDBs{mocks: make(map[string]sqlmock.Sqlmock)}
+	origCreate := createVerifyDB
+	createVerifyDB = func(user string, password string, host string, port int, tlsConfig *tls.Config, sqlMode *string, params map[string]string) (*gosql.DB, error) {
+		db, mock, err := sqlmock.New()
+		c.Assert(err, IsNil)
+		dbs.params = append(dbs.params, params)
+		key := host
+		if params == nil {
+			key += "-rw"
+		}
+		dbs.mocks[key] = mock
+		if host == "downstream" && params == nil {
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT @@tidb_current_ts").WillReturnRows(sqlmock.NewRows([]string{"ts"}).AddRow(42))
+			mock.ExpectRollback()
+		}
+		return db, nil
+	}
+	return dbs, func() { createVerifyDB = origCreate }
+}
+
+func (s *verifySuite) TestVerify(c *C) {
+	dbs, restore := s.mockDBs(c)
+	defer restore()
+
+	origEqual := equalTable
+	defer func() { equalTable = origEqual }()
+	equalTable = func(ctx context.Context, td *diff.TableDiff, writeFixSQL func(string) error) (bool, bool, error) {
+		c.Assert(td.UseChecksum, IsTrue)
+		c.Assert(td.ChunkSize, Equals, 100)
+		switch td.TargetTable.Table {
+		case "t1":
+			return true, true, nil
+		case "t2":
+			c.Assert(writeFixSQL("REPLACE INTO `test`.`t2`(`id`) VALUES (1);"), IsNil)
+			return true, false, nil
+		default:
+			return false, false, errors.New("table not exists")
+		}
+	}
+
+	fixSQLFile := path.Join(c.MkDir(), "fix.sql")
+	cfg := &VerifyConfig{
+		Interval:   1,
+		Upstream:   &dsync.DBConfig{Host: "upstream"},
+		Tables:     []filter.TableName{{Schema: "test", Table: "t1"}, {Schema: "test", Table: "t2"}, {Schema: "test", Table: "t3"}},
+		ChunkSize:  100,
+		FixSQLFile: fixSQLFile,
+	}
+	cfg.adjust()
+	v := newVerifier(cfg, &dsync.DBConfig{Host: "downstream"}, "mysql")
+	v.running = 1
+	v.start(context.Background(), 100)
+
+	c.Assert(atomic.LoadInt32(&v.running), Equals, int32(0))
+	c.Assert(dbs.params, DeepEquals, []map[string]string{{"tidb_snapshot": "100"}, nil})
+	data, err := os.ReadFile(fixSQLFile)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "-- ts: 100, table: `test`.`t2`\nREPLACE INTO `test`.`t2`(`id`) VALUES (1);\n")
+}
+
+func (s *verifySuite) TestVerifyWithDownstreamSnapshot(c *C) {
+	dbs, restore := s.mockDBs(c)
+	defer restore()
+
+	origEqual := equalTable
+	defer func() { equalTable = origEqual }()
+	verified := make(chan *diff.TableDiff, 1)
+	equalTable = func(ctx context.Context, td *diff.TableDiff, writeFixSQL func(string) error) (bool, bool, error) {
+		verified <- td
+		return true, true, nil
+	}
+
+	cfg := &VerifyConfig{
+		Interval: 1,
+		Upstream: &dsync.DBConfig{Host: "upstream"},
+		Tables:   []filter.TableName{{Schema: "test", Table: "t1"}},
+	}
+	cfg.adjust()
+	v := newVerifier(cfg, &dsync.DBConfig{Host: "downstream"}, "tidb")
+	v.running = 1
+	v.start(context.Background(), 100)
+
+	select {
+	case td := <-verified:
+		c.Assert(td.SourceTables[0].Conn, Not(Equals), td.TargetTable.Conn)
+		c.Assert(td.TargetTable.Conn, Not(Equals), td.CpDB)
+	case <-time.After(time.Second):
+		c.Fatal("table is not verified")
+	}
+	for atomic.LoadInt32(&v.running) != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.Assert(dbs.params, DeepEquals, []map[string]string{{"tidb_snapshot": "100"}, nil, {"tidb_snapshot": "42"}})
+	c.Assert(dbs.mocks["downstream-rw"].ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,314 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	pb "github.com/pingcap/tipb/go-binlog"
+	"github.com/unrolled/render"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWatermarkSchema   = "tidb_binlog"
+	defaultWatermarkTable    = "table_watermark"
+	defaultWatermarkInterval = 1
+	// watermarkWriteBatch is the max number of the rows written by a statement.
+	watermarkWriteBatch = 256
+)
+
+// WatermarkConfig is the config of tracking the max commit ts of the binlogs synced for
+// every table, so the consumers of downstream can wait for a table to be synced up to a ts.
+type WatermarkConfig struct {
+	Enable bool `toml:"enable" json:"enable"`
+	// Write writes the watermarks into the table Schema.Table of downstream, it's only
+	// supported by mysql and tidb.
+	Write  bool   `toml:"write" json:"write"`
+	Schema string `toml:"schema" json:"schema"`
+	Table  string `toml:"table" json:"table"`
+	// Interval is the interval in seconds of writing the changed watermarks.
+	Interval int `toml:"interval" json:"interval"`
+}
+
+func (c *WatermarkConfig) enabled() bool {
+	return c != nil && c.Enable
+}
+
+func (c *WatermarkConfig) adjust() {
+	if len(c.Schema) == 0 {
+		c.Schema = defaultWatermarkSchema
+	}
+	if len(c.Table) == 0 {
+		c.Table = defaultWatermarkTable
+	}
+	util.AdjustInt(&c.Interval, defaultWatermarkInterval)
+}
+
+func (c *WatermarkConfig) validate(destDBType string) error {
+	if c.Write && destDBType != "mysql" && destDBType != "tidb" {
+		return errors.Errorf("writing the watermarks isn't supported by dest-db-type %s, only mysql and tidb", destDBType)
+	}
+	return nil
+}
+
+// WatermarksV1 are the watermarks of the tables served by /api/v1/watermarks.
+type WatermarksV1 struct {
+	// Checkpoint is the checkpoint ts of drainer, all the tables are synced up to it.
+	Checkpoint int64 `json:"checkpoint"`
+	// Tables are sorted by the schema and table names.
+	Tables []TableWatermarkV1 `json:"tables"`
+}
+
+// TableWatermarkV1 is the max commit ts of the binlogs synced for a table since drainer starts.
+type TableWatermarkV1 struct {
+	Schema    string    `json:"schema"`
+	Table     string    `json:"table"`
+	AppliedTS int64     `json:"applied-ts"`
+	Time      time.Time `json:"time"`
+}
+
+// watermarkTracker records the tables changed by the binlogs before they're synced, and
+// advances the watermarks of the tables after the binlogs are synced.
+type watermarkTracker struct {
+	// db is nil if the watermarks aren't written into downstream.
+	db        *sql.DB
+	table     string
+	clusterID uint64
+	interval  time.Duration
+
+	mu sync.Mutex
+	// pending are the tables of the binlogs being synced by commit ts.
+	pending map[int64][]filter.TableName
+	applied map[filter.TableName]int64
+	// dirty are the tables whose watermarks aren't written into downstream yet.
+	dirty map[filter.TableName]struct{}
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// createWatermarkDB is changed in unit test for mock.
+var createWatermarkDB = loader.CreateDBWithSQLMode
+
+func newWatermarkTracker(cfg *WatermarkConfig, to *dsync.DBConfig, sqlMode *string) (*watermarkTracker, error) {
+	t := &watermarkTracker{
+		table:    fmt.Sprintf("`%s`.`%s`", cfg.Schema, cfg.Table),
+		interval: time.Duration(cfg.Interval) * time.Second,
+		pending:  make(map[int64][]filter.TableName),
+		applied:  make(map[filter.TableName]int64),
+		dirty:    make(map[filter.TableName]struct{}),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if !cfg.Write {
+		return t, nil
+	}
+
+	db, err := createWatermarkDB(to.User, to.Password, to.Host, to.Port, to.TLS, sqlMode, to.Params)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if _, err = db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", cfg.Schema)); err != nil {
+		db.Close()
+		return nil, errors.Annotate(err, "create watermark schema")
+	}
+	createTable := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	cluster_id BIGINT UNSIGNED NOT NULL,
+	db_name VARCHAR(64) NOT NULL,
+	table_name VARCHAR(64) NOT NULL,
+	applied_ts BIGINT NOT NULL,
+	applied_time DATETIME(3) NOT NULL,
+	update_time DATETIME(3) NOT NULL,
+	PRIMARY KEY (cluster_id, db_name, table_name))`, t.table)
+	if _, err = db.Exec(createTable); err != nil {
+		db.Close()
+		return nil, errors.Annotate(err, "create watermark table")
+	}
+	t.db, t.clusterID = db, to.ClusterID
+	return t, nil
+}
+
+// prepare records the tables changed by the DML binlog.
+func (t *watermarkTracker) prepare(binlog *pb.Binlog, pv *pb.PrewriteValue, schema *Schema) {
+	var tables []filter.TableName
+	for _, mut := range pv.GetMutations() {
+		schemaName, tableName, ok := schema.SchemaAndTableName(mut.GetTableId())
+		if !ok {
+			continue
+		}
+		tables = append(tables, filter.TableName{Schema: schemaName, Table: tableName})
+	}
+	t.prepareTables(binlog.CommitTs, tables...)
+}
+
+// prepareTables records the tables changed by the binlog of commitTS.
+func (t *watermarkTracker) prepareTables(commitTS int64, tables ...filter.TableName) {
+	if len(tables) == 0 {
+		return
+	}
+	t.mu.Lock()
+	t.pending[commitTS] = append(t.pending[commitTS], tables...)
+	t.mu.Unlock()
+}
+
+// synced advances the watermarks of the tables changed by the binlog synced to downstream.
+func (t *watermarkTracker) synced(commitTS int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tables, ok := t.pending[commitTS]
+	if !ok {
+		return
+	}
+	delete(t.pending, commitTS)
+	for _, table := range tables {
+		if commitTS > t.applied[table] {
+			t.applied[table] = commitTS
+			t.dirty[table] = struct{}{}
+		}
+	}
+}
+
+// watermarks returns the watermarks of the tables matching schema and table, empty matches all.
+func (t *watermarkTracker) watermarks(schema string, table string) []TableWatermarkV1 {
+	t.mu.Lock()
+	watermarks := make([]TableWatermarkV1, 0, len(t.applied))
+	for name, ts := range t.applied {
+		if (len(schema) > 0 && !strings.EqualFold(schema, name.Schema)) || (len(table) > 0 && !strings.EqualFold(table, name.Table)) {
+			continue
+		}
+		watermarks = append(watermarks, TableWatermarkV1{Schema: name.Schema, Table: name.Table, AppliedTS: ts, Time: tsTime(ts)})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(watermarks, func(i, j int) bool {
+		if watermarks[i].Schema != watermarks[j].Schema {
+			return watermarks[i].Schema < watermarks[j].Schema
+		}
+		return watermarks[i].Table < watermarks[j].Table
+	})
+	return watermarks
+}
+
+// write writes the changed watermarks into downstream, a watermark never goes back in the table
+// even if drainer restarts from an older checkpoint.
+func (t *watermarkTracker) write() error {
+	t.mu.Lock()
+	tables := make([]filter.TableName, 0, len(t.dirty))
+	values := make([]int64, 0, len(t.dirty))
+	for table := range t.dirty {
+		tables = append(tables, table)
+		values = append(values, t.applied[table])
+	}
+	t.dirty = make(map[filter.TableName]struct{})
+	t.mu.Unlock()
+
+	for len(tables) > 0 {
+		n := len(tables)
+		if n > watermarkWriteBatch {
+			n = watermarkWriteBatch
+		}
+		holders := make([]string, 0, n)
+		args := make([]interface{}, 0, n*5)
+		for i := 0; i < n; i++ {
+			holders = append(holders, "(?, ?, ?, ?, FROM_UNIXTIME(?), NOW(3))")
+			physical := float64(oracle.ExtractPhysical(uint64(values[i]))) / 1000
+			args = append(args, t.clusterID, tables[i].Schema, tables[i].Table, values[i], physical)
+		}
+		query := fmt.Sprintf("INSERT INTO %s(cluster_id, db_name, table_name, applied_ts, applied_time, update_time) VALUES %s "+
+			"ON DUPLICATE KEY UPDATE applied_time = IF(VALUES(applied_ts) > applied_ts, VALUES(applied_time), applied_time), "+
+			"applied_ts = GREATEST(applied_ts, VALUES(applied_ts)), update_time = VALUES(update_time)", t.table, strings.Join(holders, ", "))
+		if _, err := t.db.Exec(query, args...); err != nil {
+			// write them again next time.
+			t.mu.Lock()
+			for _, table := range tables {
+				t.dirty[table] = struct{}{}
+			}
+			t.mu.Unlock()
+			return errors.Trace(err)
+		}
+		tables, values = tables[n:], values[n:]
+	}
+	return nil
+}
+
+// run writes the changed watermarks into downstream every interval until the tracker is closed.
+func (t *watermarkTracker) run() {
+	defer close(t.done)
+	if t.db == nil {
+		return
+	}
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.quit:
+			if err := t.write(); err != nil {
+				log.Warn("write watermarks failed", zap.String("table", t.table), zap.Error(err))
+			}
+			return
+		case <-ticker.C:
+			// the failure doesn't stop the sync, the watermarks in downstream just fall behind.
+			if err := t.write(); err != nil {
+				log.Warn("write watermarks failed", zap.String("table", t.table), zap.Error(err))
+			}
+		}
+	}
+}
+
+// close writes the last watermarks and closes the connection of downstream.
+func (t *watermarkTracker) close() {
+	close(t.quit)
+	<-t.done
+	if t.db != nil {
+		t.db.Close()
+	}
+}
+
+// GetWatermarks returns the watermarks of the tables, filtered by the query parameters db and table.
+func (s *Server) GetWatermarks(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	if s.syncer.watermark == nil {
+		if err := rd.JSON(w, http.StatusOK, util.ErrCodeResponsef(errorcode.InvalidState, "watermark is not enabled")); err != nil {
+			log.Error("Failed to render JSON response", zap.Error(err))
+		}
+		return
+	}
+
+	query := r.URL.Query()
+	watermarks := &WatermarksV1{
+		Checkpoint: s.cp.TS(),
+		Tables:     s.syncer.watermark.watermarks(query.Get("db"), query.Get("table")),
+	}
+	if err := rd.JSON(w, http.StatusOK, watermarks); err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
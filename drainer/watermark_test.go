@@ -0,0 +1,105 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drainer
+
+import (
+	"crypto/tls"
+	gosql "database/sql"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	dsync "github.com/pingcap/tidb-binlog/drainer/sync"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+)
+
+type watermarkSuite struct{}
+
+var _ = Suite(&watermarkSuite{})
+
+func (s *watermarkSuite) TestTrack(c *C) {
+	cfg := &WatermarkConfig{Enable: true}
+	cfg.adjust()
+	tracker, err := newWatermarkTracker(cfg, &dsync.DBConfig{}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(tracker.db, IsNil)
+
+	t1 := filter.TableName{Schema: "test", Table: "t1"}
+	t2 := filter.TableName{Schema: "test", Table: "t2"}
+	tracker.prepareTables(10, t1, t2)
+	tracker.prepareTables(20, t1)
+	c.Assert(tracker.watermarks("", ""), HasLen, 0)
+
+	tracker.synced(10)
+	tracker.synced(20)
+	// no table is changed by 30.
+	tracker.synced(30)
+	c.Assert(tracker.pending, HasLen, 0)
+	c.Assert(tracker.watermarks("", ""), DeepEquals, []TableWatermarkV1{
+		{Schema: "test", Table: "t1", AppliedTS: 20, Time: tsTime(20)},
+		{Schema: "test", Table: "t2", AppliedTS: 10, Time: tsTime(10)},
+	})
+	c.Assert(tracker.watermarks("TEST", "T2"), DeepEquals, []TableWatermarkV1{
+		{Schema: "test", Table: "t2", AppliedTS: 10, Time: tsTime(10)},
+	})
+	c.Assert(tracker.watermarks("other", ""), HasLen, 0)
+
+	tracker.run()
+	tracker.close()
+}
+
+func (s *watermarkSuite) TestWrite(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	origCreate := createWatermarkDB
+	createWatermarkDB = func(string, string, string, int, *tls.Config, *string, map[string]string) (*gosql.DB, error) {
+		return db, nil
+	}
+	defer func() { createWatermarkDB = origCreate }()
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE DATABASE IF NOT EXISTS `tidb_binlog`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS `tidb_binlog`.`table_watermark`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	cfg := &WatermarkConfig{Enable: true, Write: true}
+	cfg.adjust()
+	tracker, err := newWatermarkTracker(cfg, &dsync.DBConfig{ClusterID: 1}, nil)
+	c.Assert(err, IsNil)
+
+	// nothing is written if no watermark changes.
+	c.Assert(tracker.write(), IsNil)
+
+	table := filter.TableName{Schema: "test", Table: "t"}
+	tracker.prepareTables(400000000000000000, table)
+	tracker.synced(400000000000000000)
+	query := regexp.QuoteMeta("INSERT INTO `tidb_binlog`.`table_watermark`(cluster_id, db_name, table_name, applied_ts, applied_time, update_time) VALUES (?, ?, ?, ?, FROM_UNIXTIME(?), NOW(3)) ON DUPLICATE KEY UPDATE")
+	mock.ExpectExec(query).WithArgs(1, "test", "t", 400000000000000000, sqlmock.AnyArg()).WillReturnError(errors.New("connection refused"))
+	c.Assert(tracker.write(), ErrorMatches, "connection refused")
+	// the failed ones are written again.
+	mock.ExpectExec(query).WithArgs(1, "test", "t", 400000000000000000, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	c.Assert(tracker.write(), IsNil)
+	c.Assert(tracker.dirty, HasLen, 0)
+
+	mock.ExpectClose()
+	go tracker.run()
+	tracker.close()
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *watermarkSuite) TestValidate(c *C) {
+	cfg := &WatermarkConfig{Enable: true}
+	c.Assert(cfg.validate("kafka"), IsNil)
+	cfg.Write = true
+	c.Assert(cfg.validate("tidb"), IsNil)
+	c.Assert(cfg.validate("kafka"), ErrorMatches, "writing the watermarks isn't supported by dest-db-type kafka.*")
+}
@@ -17,6 +17,7 @@ import (
 	"encoding/binary"
 	"hash/crc32"
 	"io"
+	"math"
 	"os"
 	"path"
 	"sync"
@@ -66,6 +67,10 @@ type Binlogger interface {
 	// GGCByTime delete all files that's older than the specified duration, the latest file is always kept
 	GCByTime(retentionTime time.Duration)
 
+	// GCByTimeBeforeIndex deletes the files older than the specified duration and with the index smaller than
+	// the specified one, the latest file is always kept
+	GCByTimeBeforeIndex(retentionTime time.Duration, index uint64)
+
 	// GCByPos delete all files that's before the specified position, the latest file is always kept
 	GCByPos(pos binlog.Pos)
 }
@@ -125,9 +130,8 @@ func OpenBinlogger(dirpath string, maxFileSize int64) (Binlogger, error) {
 		lastFileSuffix = 0
 	} else {
 		// check binlog files and find last binlog file
-		if !IsValidBinlog(names) {
-			err = ErrFileContentCorruption
-			return nil, errors.Trace(err)
+		if err = checkDirOnOpen(dirpath); err != nil {
+			return nil, err
 		}
 
 		lastFileName = path.Join(dirpath, names[len(names)-1])
@@ -382,6 +386,12 @@ func (b *binlogger) GCByPos(pos binlog.Pos) {
 
 // GGCByTime delete all files that's older than the specified duration, the latest file is always kept
 func (b *binlogger) GCByTime(retentionTime time.Duration) {
+	b.GCByTimeBeforeIndex(retentionTime, math.MaxUint64)
+}
+
+// GCByTimeBeforeIndex deletes the files older than the specified duration and with the index smaller than
+// the specified one, the latest file is always kept
+func (b *binlogger) GCByTimeBeforeIndex(retentionTime time.Duration, index uint64) {
 	names, err := ReadBinlogNames(b.dir)
 	if err != nil {
 		log.Error("read binlog files failed", zap.Error(err))
@@ -394,6 +404,15 @@ func (b *binlogger) GCByTime(retentionTime time.Duration) {
 
 	// skip the latest binlog file
 	for _, name := range names[:len(names)-1] {
+		curIndex, _, err := ParseBinlogName(name)
+		if err != nil {
+			log.Error("parse binlog failed", zap.Error(err))
+			continue
+		}
+		if curIndex >= index {
+			break
+		}
+
 		fileName := path.Join(b.dir, name)
 		fi, err := os.Stat(fileName)
 		if err != nil {
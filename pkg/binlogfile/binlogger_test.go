@@ -270,6 +270,33 @@ func (s *testBinloggerSuite) TestGCByTime(c *C) {
 	c.Assert(suffix, Equals, uint64(1))
 }
 
+func (s *testBinloggerSuite) TestGCByTimeBeforeIndex(c *C) {
+	dir := c.MkDir()
+	bl, err := OpenBinlogger(dir, SegmentSizeBytes)
+	c.Assert(err, IsNil)
+	defer CloseBinlogger(bl)
+
+	b := bl.(*binlogger)
+	for i := 0; i < 3; i++ {
+		c.Assert(b.rotate(), IsNil)
+	}
+	assertBinlogsCount(c, dir, 4)
+
+	time.Sleep(10 * time.Millisecond)
+	// the files with index 2 and after it are kept.
+	b.GCByTimeBeforeIndex(time.Millisecond, 2)
+	names, err := ReadBinlogNames(dir)
+	c.Assert(err, IsNil)
+	c.Assert(names, HasLen, 2)
+	suffix, _, err := ParseBinlogName(names[0])
+	c.Assert(err, IsNil)
+	c.Assert(suffix, Equals, uint64(2))
+
+	// the latest file is always kept.
+	b.GCByTimeBeforeIndex(time.Millisecond, 10)
+	assertBinlogsCount(c, dir, 1)
+}
+
 func (s *testBinloggerSuite) TestSeekBinlog(c *C) {
 	f, err := os.CreateTemp(os.TempDir(), "testOffset")
 	c.Assert(err, IsNil)
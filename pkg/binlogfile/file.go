@@ -180,6 +180,17 @@ func ParseBinlogName(str string) (index uint64, ts int64, err error) {
 	return index, ts, errors.Trace(err)
 }
 
+// ParseBinlogDateTime parses the time the binlog file is created at from the name.
+func ParseBinlogDateTime(str string) (time.Time, error) {
+	items := strings.Split(str, "-")
+	if len(items) != 3 && len(items) != 4 || items[0] != "binlog" {
+		return time.Time{}, errors.Annotatef(ErrBadBinlogName, "binlog file name %s", str)
+	}
+
+	t, err := time.ParseInLocation(datetimeFormat, items[2], time.Local)
+	return t, errors.Annotatef(err, "binlog file name %s", str)
+}
+
 // BinlogName creates a binlog file name. The file name format is like binlog-0000000000000001-20181010101010
 func BinlogName(index uint64) string {
 	currentTime := time.Now()
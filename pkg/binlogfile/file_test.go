@@ -19,6 +19,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	. "github.com/pingcap/check"
 	"github.com/pingcap/tidb-binlog/pkg/file"
@@ -125,3 +126,17 @@ func (t *testFileSuite) TestParseBinlogName(c *C) {
 	c.Assert(gotIndex, Equals, index)
 	c.Assert(gotTs, Equals, int64(0))
 }
+
+func (t *testFileSuite) TestParseBinlogDateTime(c *C) {
+	datetime, err := ParseBinlogDateTime("binlog-0000000000000003-20180315121212")
+	c.Assert(err, IsNil)
+	c.Assert(datetime, Equals, time.Date(2018, 3, 15, 12, 12, 12, 0, time.Local))
+	datetime, err = ParseBinlogDateTime("binlog-0000000000000003-20180315121212-000000000000000001.tar.gz")
+	c.Assert(err, IsNil)
+	c.Assert(datetime.Year(), Equals, 2018)
+
+	_, err = ParseBinlogDateTime("binlog-0000000000000001")
+	c.Assert(err, ErrorMatches, ".*bad file name")
+	_, err = ParseBinlogDateTime("binlog-0000000000000001-2018")
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,446 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogfile
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/file"
+	"go.uber.org/zap"
+)
+
+// headerLength is the length of magic and payload size before every payload.
+const headerLength = 4 + 8
+
+// UnreadableFile is a binlog file that can't be opened or doesn't start with a binlog.
+type UnreadableFile struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// TornTail is the partial binlog at the end of the last file, which is left by a crash during writing.
+type TornTail struct {
+	Name string `json:"name"`
+	// Offset is the end of the last complete binlog.
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+}
+
+// CheckReport is the result of checking a binlog directory.
+type CheckReport struct {
+	Dir   string `json:"dir"`
+	Files int    `json:"files"`
+	// Detached are the files before the last gap of the file sequence.
+	Detached   []string          `json:"detached,omitempty"`
+	Unreadable []*UnreadableFile `json:"unreadable,omitempty"`
+	// CorruptedRecords is the number of the corrupted binlogs in the last file,
+	// they are skipped by the readers.
+	CorruptedRecords int       `json:"corrupted-records"`
+	TornTail         *TornTail `json:"torn-tail,omitempty"`
+
+	// Quarantined are the files moved to the quarantine directory.
+	Quarantined []string `json:"quarantined,omitempty"`
+	Truncated   bool     `json:"truncated"`
+}
+
+// Err returns an error describes the problems that stop the binlogger from opening the directory.
+func (r *CheckReport) Err() error {
+	var problems []string
+	if len(r.Detached) > 0 && !r.isQuarantined(r.Detached[0]) {
+		problems = append(problems, fmt.Sprintf("the files %v are not continuous with the following ones", r.Detached))
+	}
+	for _, f := range r.Unreadable {
+		if r.isQuarantined(f.Name) {
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("file %s is unreadable: %s", f.Name, f.Reason))
+	}
+	if r.TornTail != nil && !r.Truncated {
+		problems = append(problems, fmt.Sprintf("file %s has a partial binlog from offset %d to %d", r.TornTail.Name, r.TornTail.Offset, r.TornTail.Size))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.Annotatef(ErrFileContentCorruption, "directory %s: %s, repair it to move the files away and truncate the partial binlog", r.Dir, strings.Join(problems, "; "))
+}
+
+func (r *CheckReport) isQuarantined(name string) bool {
+	for _, n := range r.Quarantined {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RepairOptions decides how RepairDir fixes the problems found in the directory.
+type RepairOptions struct {
+	// TruncateTornTail truncates the partial binlog at the end of the last file.
+	TruncateTornTail bool
+	// QuarantineDir is the directory to move the detached and unreadable files to, with a report of the repair.
+	// The unreadable files are replaced by empty ones to keep the file sequence continuous.
+	// Nothing is moved if it's empty.
+	QuarantineDir string
+}
+
+// CheckDir checks the file sequence, the first binlog of every file and all the binlogs of the last file in the directory.
+func CheckDir(dirpath string) (*CheckReport, error) {
+	report, names, err := checkFiles(dirpath)
+	if err != nil || len(names) == 0 {
+		return report, errors.Trace(err)
+	}
+
+	lastName := names[len(names)-1]
+	scan, err := scanFile(path.Join(dirpath, lastName))
+	if err != nil {
+		report.Unreadable = append(report.Unreadable, &UnreadableFile{Name: lastName, Reason: err.Error()})
+		return report, nil
+	}
+	report.CorruptedRecords = scan.corrupted
+	if scan.validEnd < scan.size {
+		report.TornTail = &TornTail{Name: lastName, Offset: scan.validEnd, Size: scan.size}
+	}
+	return report, nil
+}
+
+// checkFiles checks the file sequence and the first binlog of every file but the last one.
+func checkFiles(dirpath string) (*CheckReport, []string, error) {
+	report := &CheckReport{Dir: dirpath}
+	names, err := ReadBinlogNames(dirpath)
+	if err != nil {
+		if cause := errors.Cause(err); cause == ErrFileNotFound || os.IsNotExist(cause) {
+			return report, nil, nil
+		}
+		return nil, nil, errors.Trace(err)
+	}
+	report.Files = len(names)
+
+	// only the files after the last gap can be read continuously.
+	var lastSuffix uint64
+	for i, name := range names {
+		suffix, _, err := ParseBinlogName(name)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		if i > 0 && suffix != lastSuffix+1 {
+			report.Detached = names[:i]
+		}
+		lastSuffix = suffix
+	}
+
+	for _, name := range names[len(report.Detached) : len(names)-1] {
+		if reason := checkFirstBinlog(path.Join(dirpath, name)); reason != "" {
+			report.Unreadable = append(report.Unreadable, &UnreadableFile{Name: name, Reason: reason})
+		}
+	}
+	return report, names, nil
+}
+
+// checkDirOnOpen is CheckDir for opening the directory, only the headers of the binlogs of the last
+// file and the crc of its last binlog are read, so the whole file isn't read on every opening. The
+// partial binlog at the end of the last file, which is left by a crash during writing, is reported
+// like the other problems, it's only truncated by RepairDir as the operator confirms.
+func checkDirOnOpen(dirpath string) error {
+	report, names, err := checkFiles(dirpath)
+	if err != nil || len(names) == 0 {
+		return errors.Trace(err)
+	}
+
+	lastName := path.Join(dirpath, names[len(names)-1])
+	validEnd, size, err := lastBinlogEnd(lastName)
+	if err != nil {
+		report.Unreadable = append(report.Unreadable, &UnreadableFile{Name: names[len(names)-1], Reason: err.Error()})
+	} else if validEnd < size {
+		report.TornTail = &TornTail{Name: names[len(names)-1], Offset: validEnd, Size: size}
+	}
+	if err = report.Err(); err != nil {
+		log.Error("binlog directory is corrupted", zap.Reflect("report", report))
+		return err
+	}
+	return nil
+}
+
+// lastBinlogEnd returns the end of the last complete binlog of the file and the size of the file by walking
+// the headers of the binlogs, only the crc of the last binlog is verified. The whole file is scanned if there
+// is a corrupted binlog before the end, since the binlogs after it are found by searching the magic.
+func lastBinlogEnd(name string) (int64, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+	size := stat.Size()
+
+	header := make([]byte, headerLength)
+	var offset int64
+	last := int64(-1)
+	for size-offset >= headerLength {
+		if _, err = f.ReadAt(header, offset); err != nil {
+			return 0, 0, errors.Trace(err)
+		}
+		if CheckMagic(binary.LittleEndian.Uint32(header)) != nil {
+			break
+		}
+		length := int64(binary.LittleEndian.Uint64(header[4:]))
+		if length < 0 || length > size-offset-headerLength-4 {
+			break
+		}
+		last = offset
+		offset += headerLength + length + 4
+	}
+
+	if offset < size {
+		// it's a partial binlog at the end only if there is no binlog after it.
+		_, err = seekBinlog(f, offset+1)
+		if err == nil {
+			scan, err := scanFile(name)
+			if err != nil {
+				return 0, 0, errors.Trace(err)
+			}
+			return scan.validEnd, size, nil
+		}
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, 0, errors.Trace(err)
+		}
+	}
+
+	if last >= 0 {
+		_, ok, err := checkBinlogAt(f, last, size, header)
+		if err != nil {
+			return 0, 0, errors.Trace(err)
+		}
+		if !ok {
+			// the length is written but the payload isn't.
+			return last, size, nil
+		}
+	}
+	return offset, size, nil
+}
+
+// RepairDir checks the directory and fixes the problems as allowed by the options,
+// the problems not fixed are left in the report, see CheckReport.Err.
+func RepairDir(dirpath string, opts RepairOptions) (*CheckReport, error) {
+	if !Exist(dirpath) {
+		return &CheckReport{Dir: dirpath}, nil
+	}
+	dirLock, err := file.LockFile(path.Join(dirpath, ".lock"), os.O_WRONLY|os.O_CREATE, file.PrivateFileMode)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer dirLock.Close()
+
+	report, err := CheckDir(dirpath)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if opts.QuarantineDir != "" && (len(report.Detached) > 0 || len(report.Unreadable) > 0 || report.TornTail != nil) {
+		if err = os.MkdirAll(opts.QuarantineDir, file.PrivateDirMode); err != nil {
+			return nil, errors.Trace(err)
+		}
+		for _, name := range report.Detached {
+			if err = quarantine(dirpath, name, opts.QuarantineDir, false); err != nil {
+				return nil, errors.Trace(err)
+			}
+			report.Quarantined = append(report.Quarantined, name)
+		}
+		for _, f := range report.Unreadable {
+			if err = quarantine(dirpath, f.Name, opts.QuarantineDir, true); err != nil {
+				return nil, errors.Trace(err)
+			}
+			report.Quarantined = append(report.Quarantined, f.Name)
+		}
+	}
+
+	tail := report.TornTail
+	if opts.TruncateTornTail && tail != nil {
+		name := path.Join(dirpath, tail.Name)
+		// keep the partial binlog for investigation.
+		if opts.QuarantineDir != "" {
+			if err = saveTornTail(name, tail, opts.QuarantineDir); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		if err = os.Truncate(name, tail.Offset); err != nil {
+			return nil, errors.Trace(err)
+		}
+		report.Truncated = true
+		log.Warn("truncate the partial binlog", zap.String("file", name), zap.Int64("offset", tail.Offset), zap.Int64("size", tail.Size))
+	}
+
+	if opts.QuarantineDir != "" && (len(report.Quarantined) > 0 || report.Truncated) {
+		if err = writeRepairReport(report, opts.QuarantineDir); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	log.Info("repair binlog directory", zap.Reflect("report", report))
+	return report, nil
+}
+
+// quarantine moves the file to the quarantine directory, an empty file
+// is created in its place if placeholder is true.
+func quarantine(dirpath string, name string, quarantineDir string, placeholder bool) error {
+	from := path.Join(dirpath, name)
+	to := path.Join(quarantineDir, name)
+	if err := os.Rename(from, to); err != nil {
+		return errors.Annotatef(err, "move %s to %s", from, to)
+	}
+	log.Warn("quarantine binlog file", zap.String("file", from), zap.String("to", to))
+	if !placeholder {
+		return nil
+	}
+	f, err := os.OpenFile(from, os.O_WRONLY|os.O_CREATE|os.O_EXCL, file.PrivateFileMode)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(f.Close())
+}
+
+func saveTornTail(name string, tail *TornTail, quarantineDir string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+
+	data := make([]byte, tail.Size-tail.Offset)
+	if _, err = f.ReadAt(data, tail.Offset); err != nil {
+		return errors.Trace(err)
+	}
+	tailName := path.Join(quarantineDir, fmt.Sprintf("%s.%d.tail", tail.Name, tail.Offset))
+	return errors.Trace(ioutil.WriteFile(tailName, data, file.PrivateFileMode))
+}
+
+func writeRepairReport(report *CheckReport, quarantineDir string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	name := path.Join(quarantineDir, fmt.Sprintf("repair-%s.json", time.Now().Format(datetimeFormat)))
+	return errors.Trace(ioutil.WriteFile(name, data, file.PrivateFileMode))
+}
+
+// checkFirstBinlog returns the reason why the file is unreadable, or "" if the first binlog is fine.
+func checkFirstBinlog(name string) string {
+	f, err := os.Open(name)
+	if err != nil {
+		return err.Error()
+	}
+	defer f.Close()
+
+	header := make([]byte, headerLength)
+	n, err := io.ReadFull(f, header)
+	if n == 0 && err == io.EOF {
+		return ""
+	}
+	if err != nil {
+		return err.Error()
+	}
+	if err = CheckMagic(binary.LittleEndian.Uint32(header)); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+type fileScan struct {
+	size int64
+	// validEnd is the end of the last complete binlog.
+	validEnd  int64
+	records   int
+	corrupted int
+}
+
+// scanFile verifies the crc of every binlog in the file, the corrupted ones
+// are skipped by searching the next magic like Walk does.
+func scanFile(name string) (*fileScan, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	scan := &fileScan{size: stat.Size()}
+
+	header := make([]byte, headerLength)
+	var offset int64
+	for offset < scan.size {
+		length, ok, err := checkBinlogAt(f, offset, scan.size, header)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if ok {
+			scan.records++
+			offset += length
+			scan.validEnd = offset
+			continue
+		}
+
+		next, err := seekBinlog(f, offset+1)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		scan.corrupted++
+		offset = next
+	}
+	return scan, nil
+}
+
+// checkBinlogAt returns the length of the binlog at offset and whether it's complete and its crc matches.
+func checkBinlogAt(f *os.File, offset int64, fileSize int64, header []byte) (int64, bool, error) {
+	if fileSize-offset < headerLength {
+		return 0, false, nil
+	}
+	if _, err := f.ReadAt(header, offset); err != nil {
+		return 0, false, errors.Trace(err)
+	}
+	if CheckMagic(binary.LittleEndian.Uint32(header)) != nil {
+		return 0, false, nil
+	}
+	size := int64(binary.LittleEndian.Uint64(header[4:]))
+	// the size may be corrupted too, so check it before allocating the buffer.
+	if size < 0 || size > fileSize-offset-headerLength-4 {
+		return 0, false, nil
+	}
+	data := make([]byte, size+4)
+	if _, err := f.ReadAt(data, offset+headerLength); err != nil {
+		return 0, false, errors.Trace(err)
+	}
+	if crc32.Checksum(data[:size], crcTable) != binary.LittleEndian.Uint32(data[size:]) {
+		return 0, false, nil
+	}
+	return headerLength + size + 4, true, nil
+}
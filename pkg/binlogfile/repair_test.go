@@ -0,0 +1,190 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tipb/go-binlog"
+)
+
+var _ = Suite(&testRepairSuite{})
+
+type testRepairSuite struct{}
+
+// writeFiles writes 3 files with 2 binlogs in each one, every binlog is 26 bytes.
+func writeFiles(c *C, dir string) []string {
+	bl, err := OpenBinlogger(dir, SegmentSizeBytes)
+	c.Assert(err, IsNil)
+	defer bl.Close()
+
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			c.Assert(bl.(*binlogger).rotate(), IsNil)
+		}
+		for j := 0; j < 2; j++ {
+			_, err = bl.WriteTail(&binlog.Entity{Payload: []byte("binlogtest")})
+			c.Assert(err, IsNil)
+		}
+	}
+	names, err := ReadBinlogNames(dir)
+	c.Assert(err, IsNil)
+	return names
+}
+
+func appendFile(c *C, name string, data []byte) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0600)
+	c.Assert(err, IsNil)
+	_, err = f.Write(data)
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+}
+
+func (s *testRepairSuite) TestCheckDir(c *C) {
+	dir := c.MkDir()
+	report, err := CheckDir(path.Join(dir, "none"))
+	c.Assert(err, IsNil)
+	c.Assert(report.Err(), IsNil)
+
+	names := writeFiles(c, dir)
+	report, err = CheckDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(report.Files, Equals, 3)
+	c.Assert(report.Err(), IsNil)
+
+	// garbage between the binlogs is skipped by the readers.
+	last := path.Join(dir, names[2])
+	data, err := ioutil.ReadFile(last)
+	c.Assert(err, IsNil)
+	corrupted := append(append(append([]byte{}, data[:26]...), "test"...), data[26:]...)
+	c.Assert(ioutil.WriteFile(last, corrupted, 0600), IsNil)
+	report, err = CheckDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(report.CorruptedRecords, Equals, 1)
+	c.Assert(report.Err(), IsNil)
+
+	end, size, err := lastBinlogEnd(last)
+	c.Assert(err, IsNil)
+	c.Assert([]int64{end, size}, DeepEquals, []int64{56, 56})
+
+	// a partial binlog at the end stops the binlogger from opening until it's truncated by the repair.
+	appendFile(c, last, data[:20])
+	report, err = CheckDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(report.TornTail, DeepEquals, &TornTail{Name: names[2], Offset: 56, Size: 76})
+	c.Assert(report.Err(), ErrorMatches, ".*has a partial binlog from offset 56 to 76.*")
+	end, size, err = lastBinlogEnd(last)
+	c.Assert(err, IsNil)
+	c.Assert([]int64{end, size}, DeepEquals, []int64{56, 76})
+	_, err = OpenBinlogger(dir, SegmentSizeBytes)
+	c.Assert(errors.Cause(err), Equals, ErrFileContentCorruption)
+	stat, err := os.Stat(last)
+	c.Assert(err, IsNil)
+	c.Assert(stat.Size(), Equals, int64(76))
+	report, err = RepairDir(dir, RepairOptions{TruncateTornTail: true})
+	c.Assert(err, IsNil)
+	c.Assert(report.Truncated, IsTrue)
+	bl, err := OpenBinlogger(dir, SegmentSizeBytes)
+	c.Assert(err, IsNil)
+	c.Assert(bl.Close(), IsNil)
+	stat, err = os.Stat(last)
+	c.Assert(err, IsNil)
+	c.Assert(stat.Size(), Equals, int64(56))
+
+	// the length of the last binlog is written but its payload isn't.
+	appendFile(c, last, append(data[:22:22], make([]byte, 4)...))
+	end, size, err = lastBinlogEnd(last)
+	c.Assert(err, IsNil)
+	c.Assert([]int64{end, size}, DeepEquals, []int64{56, 82})
+
+	// the file sequence has a gap.
+	c.Assert(os.Rename(last, path.Join(dir, BinlogName(5))), IsNil)
+	_, err = OpenBinlogger(dir, SegmentSizeBytes)
+	c.Assert(errors.Cause(err), Equals, ErrFileContentCorruption)
+}
+
+func (s *testRepairSuite) TestRepairDir(c *C) {
+	dir := c.MkDir()
+	quarantineDir := path.Join(c.MkDir(), "quarantine")
+	names := writeFiles(c, dir)
+	name4, name5 := BinlogName(4), BinlogName(5)
+
+	// file 1 is unreadable and file 3 is missing.
+	c.Assert(ioutil.WriteFile(path.Join(dir, names[1]), []byte("garbage"), 0600), IsNil)
+	c.Assert(os.Rename(path.Join(dir, names[2]), path.Join(dir, name4)), IsNil)
+	last := path.Join(dir, name5)
+	c.Assert(ioutil.WriteFile(last, nil, 0600), IsNil)
+	data, err := ioutil.ReadFile(path.Join(dir, name4))
+	c.Assert(err, IsNil)
+	appendFile(c, last, data)
+	appendFile(c, last, data[:20])
+
+	report, err := CheckDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(report.Detached, DeepEquals, names[:2])
+	c.Assert(report.Unreadable, HasLen, 0)
+	c.Assert(report.TornTail, DeepEquals, &TornTail{Name: name5, Offset: 52, Size: 72})
+
+	// nothing is changed without the options.
+	report, err = RepairDir(dir, RepairOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(report.Err(), NotNil)
+	left, err := ReadBinlogNames(dir)
+	c.Assert(err, IsNil)
+	c.Assert(left, HasLen, 4)
+
+	report, err = RepairDir(dir, RepairOptions{TruncateTornTail: true, QuarantineDir: quarantineDir})
+	c.Assert(err, IsNil)
+	c.Assert(report.Err(), IsNil)
+	c.Assert(report.Quarantined, DeepEquals, names[:2])
+	c.Assert(report.Truncated, IsTrue)
+
+	left, err = ReadBinlogNames(dir)
+	c.Assert(err, IsNil)
+	c.Assert(left, DeepEquals, []string{name4, name5})
+	fi, err := os.Stat(last)
+	c.Assert(err, IsNil)
+	c.Assert(fi.Size(), Equals, int64(52))
+	tail, err := ioutil.ReadFile(path.Join(quarantineDir, name5+".52.tail"))
+	c.Assert(err, IsNil)
+	c.Assert(tail, DeepEquals, data[:20])
+	reports, err := filepath.Glob(path.Join(quarantineDir, "repair-*.json"))
+	c.Assert(err, IsNil)
+	c.Assert(reports, HasLen, 1)
+
+	// the unreadable file is replaced by an empty one.
+	c.Assert(ioutil.WriteFile(path.Join(dir, name4), []byte("garbage garbage"), 0600), IsNil)
+	report, err = RepairDir(dir, RepairOptions{QuarantineDir: quarantineDir})
+	c.Assert(err, IsNil)
+	c.Assert(report.Quarantined, DeepEquals, []string{name4})
+	c.Assert(report.Unreadable[0].Reason, Equals, ErrMagicMismatch.Error())
+	c.Assert(report.Err(), IsNil)
+	fi, err = os.Stat(path.Join(dir, name4))
+	c.Assert(err, IsNil)
+	c.Assert(fi.Size(), Equals, int64(0))
+
+	bl, err := OpenBinlogger(dir, SegmentSizeBytes)
+	c.Assert(err, IsNil)
+	_, err = bl.WriteTail(&binlog.Entity{Payload: []byte("binlogtest")})
+	c.Assert(err, IsNil)
+	ents, err := bl.ReadFrom(binlog.Pos{Suffix: 4}, 10)
+	c.Assert(err, IsNil)
+	c.Assert(ents, HasLen, 3)
+	c.Assert(bl.Close(), IsNil)
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compress
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pingcap/errors"
+)
+
+// CompressionCodec is the codec used to compress the binlog payload.
+type CompressionCodec string
+
+// the supported compression codecs.
+const (
+	CompressionNone   CompressionCodec = ""
+	CompressionSnappy CompressionCodec = "snappy"
+	CompressionZSTD   CompressionCodec = "zstd"
+)
+
+// SupportedCodecs are the codecs can be negotiated between pump and drainer.
+var SupportedCodecs = []CompressionCodec{CompressionSnappy, CompressionZSTD}
+
+var (
+	initZSTDOnce sync.Once
+	zstdEncoder  *zstd.Encoder
+	zstdDecoder  *zstd.Decoder
+	initZSTDErr  error
+)
+
+// the encoder and decoder are safe for concurrent use with EncodeAll and DecodeAll.
+func initZSTD() error {
+	initZSTDOnce.Do(func() {
+		zstdEncoder, initZSTDErr = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		if initZSTDErr != nil {
+			return
+		}
+		zstdDecoder, initZSTDErr = zstd.NewReader(nil)
+	})
+	return errors.Trace(initZSTDErr)
+}
+
+// ToCompressionCodec converts the name to CompressionCodec, the name "none"
+// and empty name means no compression.
+func ToCompressionCodec(name string) (CompressionCodec, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == "none" {
+		return CompressionNone, nil
+	}
+	for _, codec := range SupportedCodecs {
+		if CompressionCodec(name) == codec {
+			return codec, nil
+		}
+	}
+	return CompressionNone, errors.Errorf("unsupported compression codec %s, must be one of %v", name, SupportedCodecs)
+}
+
+// Compress compresses the data with the codec.
+func Compress(data []byte, codec CompressionCodec) ([]byte, error) {
+	switch codec {
+	case CompressionNone:
+		return data, nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	case CompressionZSTD:
+		if err := initZSTD(); err != nil {
+			return nil, err
+		}
+		return zstdEncoder.EncodeAll(data, make([]byte, 0, len(data)/2)), nil
+	default:
+		return nil, errors.Errorf("unsupported compression codec %s", codec)
+	}
+}
+
+// Decompress decompresses the data compressed by the codec.
+func Decompress(data []byte, codec CompressionCodec) ([]byte, error) {
+	switch codec {
+	case CompressionNone:
+		return data, nil
+	case CompressionSnappy:
+		res, err := snappy.Decode(nil, data)
+		return res, errors.Trace(err)
+	case CompressionZSTD:
+		if err := initZSTD(); err != nil {
+			return nil, err
+		}
+		res, err := zstdDecoder.DecodeAll(data, nil)
+		return res, errors.Trace(err)
+	default:
+		return nil, errors.Errorf("unsupported compression codec %s", codec)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compress
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/pingcap/check"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testCompressSuite{})
+
+type testCompressSuite struct{}
+
+func (s *testCompressSuite) TestToCompressionCodec(c *C) {
+	for name, expected := range map[string]CompressionCodec{
+		"":       CompressionNone,
+		"none":   CompressionNone,
+		"snappy": CompressionSnappy,
+		" ZSTD ": CompressionZSTD,
+	} {
+		codec, err := ToCompressionCodec(name)
+		c.Assert(err, IsNil)
+		c.Assert(codec, Equals, expected)
+	}
+
+	_, err := ToCompressionCodec("lz4")
+	c.Assert(err, ErrorMatches, "unsupported compression codec lz4.*")
+}
+
+func (s *testCompressSuite) TestCompress(c *C) {
+	data := bytes.Repeat([]byte("tidb-binlog"), 1024)
+	for _, codec := range []CompressionCodec{CompressionNone, CompressionSnappy, CompressionZSTD} {
+		compressed, err := Compress(data, codec)
+		c.Assert(err, IsNil)
+		if codec != CompressionNone {
+			c.Assert(len(compressed), Less, len(data))
+		}
+
+		res, err := Decompress(compressed, codec)
+		c.Assert(err, IsNil)
+		c.Assert(res, DeepEquals, data)
+	}
+
+	_, err := Decompress([]byte("not compressed"), CompressionZSTD)
+	c.Assert(err, NotNil)
+	_, err = Compress(data, CompressionCodec("lz4"))
+	c.Assert(err, NotNil)
+}
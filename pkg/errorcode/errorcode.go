@@ -0,0 +1,153 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package errorcode defines the codes identifying the causes of the errors
+// returned by pump and drainer, so the clients can handle them without
+// matching the error messages, which may change between releases.
+package errorcode
+
+import (
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Domain is the domain of the error codes in the gRPC status details.
+const Domain = "tidb-binlog"
+
+// Code identifies the cause of an error, the codes are stable across releases.
+type Code string
+
+// The error codes.
+const (
+	// Unknown is the code of the errors without a code.
+	Unknown Code = "UNKNOWN"
+	// InvalidArgument means the request is invalid, like an unknown action.
+	InvalidArgument Code = "INVALID_ARGUMENT"
+	// InvalidState means the request can't be applied in the current state of the node.
+	InvalidState Code = "INVALID_STATE"
+	// ClusterIDMismatch means the request is from another TiDB cluster.
+	ClusterIDMismatch Code = "CLUSTER_ID_MISMATCH"
+
+	// PumpNotOnline means pump rejects writing binlogs because it's not online.
+	PumpNotOnline Code = "PUMP_NOT_ONLINE"
+	// PumpDraining means pump rejects writing new binlogs because it's draining
+	// for decommission, the binlogs should be written to the other pumps.
+	PumpDraining Code = "PUMP_DRAINING"
+	// PumpDiskFull means pump rejects writing binlogs because the available
+	// space is less than stop-write-at-available-space.
+	PumpDiskFull Code = "PUMP_DISK_FULL"
+
+	// DrainerCheckpointConflict means the checkpoint table has more than one
+	// row, or the checkpoint is owned or taken over by another drainer, it's
+	// probably shared by multiple drainers.
+	DrainerCheckpointConflict Code = "DRAINER_CHECKPOINT_CONFLICT"
+
+	// TranslatorUnsupportedDDL means the DDL can't be parsed or translated for the downstream.
+	TranslatorUnsupportedDDL Code = "TRANSLATOR_UNSUPPORTED_DDL"
+)
+
+var grpcCodes = map[Code]codes.Code{
+	InvalidArgument:           codes.InvalidArgument,
+	InvalidState:              codes.FailedPrecondition,
+	ClusterIDMismatch:         codes.FailedPrecondition,
+	PumpNotOnline:             codes.Unavailable,
+	PumpDraining:              codes.Unavailable,
+	PumpDiskFull:              codes.ResourceExhausted,
+	DrainerCheckpointConflict: codes.Aborted,
+	TranslatorUnsupportedDDL:  codes.Unimplemented,
+}
+
+// Error is an error with a code.
+type Error struct {
+	code    Code
+	message string
+}
+
+// Error implements the error interface, the code is not included so the
+// message stays the same as before the code was added.
+func (e *Error) Error() string {
+	return e.message
+}
+
+// Code returns the code of the error.
+func (e *Error) Code() Code {
+	return e.code
+}
+
+// New returns an error with the code and message.
+func New(code Code, message string) error {
+	return errors.WithStack(&Error{code: code, message: message})
+}
+
+// Newf returns an error with the code and formatted message.
+func Newf(code Code, format string, args ...interface{}) error {
+	return New(code, fmt.Sprintf(format, args...))
+}
+
+// CodeOf returns the code of the error, Unknown is returned if the cause of
+// the error has no code.
+func CodeOf(err error) Code {
+	if e, ok := errors.Cause(err).(*Error); ok {
+		return e.code
+	}
+	return Unknown
+}
+
+// Field returns the zap field of the error code, so the code can be found in the log.
+func Field(err error) zap.Field {
+	return zap.String("error-code", string(CodeOf(err)))
+}
+
+// ToGRPCError converts the error to a gRPC status error carrying the code as
+// an ErrorInfo in the details, the message of the error is kept.
+func ToGRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code := CodeOf(err)
+	grpcCode, ok := grpcCodes[code]
+	if !ok {
+		grpcCode = codes.Unknown
+	}
+
+	st := status.New(grpcCode, err.Error())
+	withDetails, detailsErr := st.WithDetails(&errdetails.ErrorInfo{Type: string(code), Domain: Domain})
+	if detailsErr != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// FromGRPCError returns the code carried by the gRPC status error, Unknown is
+// returned if there is no code.
+func FromGRPCError(err error) Code {
+	st, ok := status.FromError(err)
+	if !ok || st == nil {
+		return Unknown
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == Domain {
+			return Code(info.Type)
+		}
+	}
+	return Unknown
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errorcode
+
+import (
+	"testing"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorCode(t *testing.T) {
+	TestingT(t)
+}
+
+type errorCodeSuite struct{}
+
+var _ = Suite(&errorCodeSuite{})
+
+func (s *errorCodeSuite) TestCodeOf(c *C) {
+	err := Newf(PumpDiskFull, "no available space, available: %d", 10)
+	c.Assert(err, ErrorMatches, "no available space, available: 10")
+	c.Assert(CodeOf(err), Equals, PumpDiskFull)
+	c.Assert(CodeOf(errors.Trace(err)), Equals, PumpDiskFull)
+	c.Assert(CodeOf(errors.Annotate(err, "write binlog")), Equals, PumpDiskFull)
+
+	c.Assert(CodeOf(errors.New("no code")), Equals, Unknown)
+	c.Assert(CodeOf(nil), Equals, Unknown)
+}
+
+func (s *errorCodeSuite) TestGRPCError(c *C) {
+	c.Assert(ToGRPCError(nil), IsNil)
+
+	err := ToGRPCError(errors.Trace(New(PumpNotOnline, "no online: paused")))
+	st, ok := status.FromError(err)
+	c.Assert(ok, IsTrue)
+	c.Assert(st.Code(), Equals, codes.Unavailable)
+	c.Assert(st.Message(), Equals, "no online: paused")
+	c.Assert(FromGRPCError(err), Equals, PumpNotOnline)
+
+	// converted only once
+	c.Assert(ToGRPCError(err), Equals, err)
+
+	err = ToGRPCError(errors.New("no code"))
+	c.Assert(status.Code(err), Equals, codes.Unknown)
+	c.Assert(FromGRPCError(err), Equals, Unknown)
+
+	c.Assert(FromGRPCError(status.Error(codes.Canceled, "canceled")), Equals, Unknown)
+	c.Assert(FromGRPCError(errors.New("not a status")), Equals, Unknown)
+}
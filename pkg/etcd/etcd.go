@@ -21,6 +21,7 @@ import (
 
 	"github.com/pingcap/errors"
 	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/etcdserver/api/v3rpc/rpctypes"
 	"golang.org/x/net/context"
 )
 
@@ -152,6 +153,37 @@ func (e *Client) UpdateOrCreate(ctx context.Context, key string, val string, ttl
 	return errors.Trace(err)
 }
 
+// Grant creates a lease expiring after ttl seconds unless it's kept alive
+func (e *Client) Grant(ctx context.Context, ttl int64) (clientv3.LeaseID, error) {
+	resp, err := e.client.Lease.Grant(ctx, ttl)
+	if err != nil {
+		return clientv3.NoLease, errors.Trace(err)
+	}
+	return resp.ID, nil
+}
+
+// KeepAliveOnce renews the lease once, it returns a NotFound error if the lease is expired
+func (e *Client) KeepAliveOnce(ctx context.Context, id clientv3.LeaseID) error {
+	_, err := e.client.Lease.KeepAliveOnce(ctx, id)
+	if errors.Cause(err) == rpctypes.ErrLeaseNotFound {
+		return errors.NotFoundf("lease %x in etcd", int64(id))
+	}
+	return errors.Trace(err)
+}
+
+// PutWithLease sets a key = value attached to the lease, the key is deleted when the lease is expired.
+// the key isn't attached to any lease if the lease is clientv3.NoLease
+func (e *Client) PutWithLease(ctx context.Context, key string, val string, id clientv3.LeaseID) error {
+	key = keyWithPrefix(e.rootPath, key)
+
+	var opts []clientv3.OpOption
+	if id != clientv3.NoLease {
+		opts = []clientv3.OpOption{clientv3.WithLease(id)}
+	}
+	_, err := e.client.KV.Do(ctx, clientv3.OpPut(key, val, opts...))
+	return errors.Trace(err)
+}
+
 // List returns the trie struct that constructed by the key/value with same prefix
 func (e *Client) List(ctx context.Context, key string) (*Node, error) {
 	key = keyWithPrefix(e.rootPath, key)
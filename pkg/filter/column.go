@@ -0,0 +1,91 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// ColumnRule specifies the columns of the tables matching Schema and Table,
+// the Schema and Table can be regex starting with '~' like TableName.
+type ColumnRule struct {
+	Schema  string   `toml:"db-name" json:"db-name"`
+	Table   string   `toml:"tbl-name" json:"tbl-name"`
+	Columns []string `toml:"columns" json:"columns"`
+}
+
+// ColumnFilter to skip the columns of tables by the rules, a nil ColumnFilter
+// doesn't skip any column.
+type ColumnFilter struct {
+	rules []columnRule
+}
+
+type columnRule struct {
+	filter  *Filter
+	columns map[string]struct{}
+}
+
+// NewColumnFilter creates a instance of ColumnFilter, it returns nil if there's no rules.
+func NewColumnFilter(rules []ColumnRule) (*ColumnFilter, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	f := &ColumnFilter{rules: make([]columnRule, 0, len(rules))}
+	for _, rule := range rules {
+		columns := make(map[string]struct{}, len(rule.Columns))
+		for _, column := range rule.Columns {
+			columns[strings.ToLower(column)] = struct{}{}
+		}
+		filter, err := NewFilter(nil, nil, nil, []TableName{{Schema: rule.Schema, Table: rule.Table}})
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		f.rules = append(f.rules, columnRule{
+			filter:  filter,
+			columns: columns,
+		})
+	}
+	return f, nil
+}
+
+// SkipColumns returns the function telling whether to skip the column of the
+// table, it returns nil if no column of the table is skipped.
+func (f *ColumnFilter) SkipColumns(schema string, table string) func(column string) bool {
+	if f == nil {
+		return nil
+	}
+
+	var matched []map[string]struct{}
+	for _, rule := range f.rules {
+		if !rule.filter.SkipSchemaAndTable(schema, table) {
+			matched = append(matched, rule.columns)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	return func(column string) bool {
+		column = strings.ToLower(column)
+		for _, columns := range matched {
+			if _, ok := columns[column]; ok {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -11,17 +11,37 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// Package filter filters the binlogs of drainer and reparo by schema name and table name.
+//
+// A pattern of schema name or table name starting with '~' is a regular expression matching
+// any part of the name, like "~^order_\d+$". Otherwise it's a regular expression matching the
+// whole name, like "order_\d+", or a wildcard matching the whole name if the filter is created
+// with Wildcard, where '*' matches any sequence of characters and '?' matches any single
+// character, like "order_*". The names are matched case-insensitively unless the filter is
+// created with CaseSensitive.
+//
+// The rules take precedence in the order:
+//  1. if any do-db or do-table is set, a table is skipped unless it matches one of them,
+//     a table matches a do-db if its schema matches it.
+//  2. a table is skipped if it matches any ignore-db or ignore-table, even if it also matches
+//     a do-db or do-table.
+//
+// The schema-level DDLs like CREATE DATABASE are matched with an empty table name, which only
+// matches the table patterns matching an empty name like "*".
 package filter
 
 import (
-	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/pingcap/errors"
 )
 
 // Filter to skip data by schema name and table name.
 type Filter struct {
-	reMap map[string]*regexp.Regexp
+	reMap         map[string]*regexp.Regexp
+	caseSensitive bool
+	wildcard      bool
 
 	doDBs    []string
 	doTables []TableName
@@ -30,8 +50,25 @@ type Filter struct {
 	ignoreTables []TableName
 }
 
-// NewFilter creates a instance of Filter
-func NewFilter(ignoreDBs []string, ignoreTables []TableName, doDBs []string, doTables []TableName) *Filter {
+// Option configures the Filter.
+type Option func(*Filter)
+
+// CaseSensitive makes the Filter match the names case-sensitively.
+func CaseSensitive(caseSensitive bool) Option {
+	return func(f *Filter) {
+		f.caseSensitive = caseSensitive
+	}
+}
+
+// Wildcard makes the Filter match the patterns not starting with '~' as wildcards.
+func Wildcard(wildcard bool) Option {
+	return func(f *Filter) {
+		f.wildcard = wildcard
+	}
+}
+
+// NewFilter creates a instance of Filter, it returns an error if any pattern is invalid.
+func NewFilter(ignoreDBs []string, ignoreTables []TableName, doDBs []string, doTables []TableName, opts ...Option) (*Filter, error) {
 	filter := &Filter{
 		ignoreDBs:    ignoreDBs,
 		ignoreTables: ignoreTables,
@@ -39,42 +76,65 @@ func NewFilter(ignoreDBs []string, ignoreTables []TableName, doDBs []string, doT
 		doTables:     doTables,
 		reMap:        make(map[string]*regexp.Regexp),
 	}
+	for _, opt := range opts {
+		opt(filter)
+	}
 
-	filter.genRegexMap()
+	if err := filter.genRegexMap(); err != nil {
+		return nil, errors.Trace(err)
+	}
 
-	return filter
+	return filter, nil
 }
 
-func (s *Filter) addOneRegex(originStr string) {
+// compilePattern compiles the pattern of schema name or table name to a regular expression.
+func (s *Filter) compilePattern(pattern string) (*regexp.Regexp, error) {
+	var expr string
+	if len(pattern) > 0 && pattern[0] == '~' {
+		expr = pattern[1:]
+	} else if s.wildcard { // wildcard must match completely
+		expr = regexp.QuoteMeta(pattern)
+		expr = strings.ReplaceAll(expr, `\*`, ".*")
+		expr = strings.ReplaceAll(expr, `\?`, ".")
+		expr = "^" + expr + "$"
+	} else { // must match completely
+		expr = "^" + pattern + "$"
+	}
+	if !s.caseSensitive {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	return re, errors.Annotatef(err, "invalid pattern %s", pattern)
+}
+
+func (s *Filter) addOneRegex(originStr string) error {
 	if _, ok := s.reMap[originStr]; !ok {
-		var re *regexp.Regexp
-		if len(originStr) > 0 && originStr[0] == '~' {
-			re = regexp.MustCompile(fmt.Sprintf("(?i)%s", originStr[1:]))
-		} else { // must match completely
-			re = regexp.MustCompile(fmt.Sprintf("(?i)^%s$", originStr))
+		re, err := s.compilePattern(originStr)
+		if err != nil {
+			return errors.Trace(err)
 		}
 		s.reMap[originStr] = re
 	}
+	return nil
 }
 
-func (s *Filter) genRegexMap() {
-	for _, db := range s.doDBs {
-		s.addOneRegex(db)
-	}
-
+func (s *Filter) genRegexMap() error {
+	patterns := make([]string, 0, len(s.doDBs)+len(s.ignoreDBs)+2*(len(s.doTables)+len(s.ignoreTables)))
+	patterns = append(patterns, s.doDBs...)
 	for _, tb := range s.doTables {
-		s.addOneRegex(tb.Schema)
-		s.addOneRegex(tb.Table)
+		patterns = append(patterns, tb.Schema, tb.Table)
 	}
-
-	for _, db := range s.ignoreDBs {
-		s.addOneRegex(db)
+	patterns = append(patterns, s.ignoreDBs...)
+	for _, tb := range s.ignoreTables {
+		patterns = append(patterns, tb.Schema, tb.Table)
 	}
 
-	for _, tb := range s.ignoreTables {
-		s.addOneRegex(tb.Schema)
-		s.addOneRegex(tb.Table)
+	for _, pattern := range patterns {
+		if err := s.addOneRegex(pattern); err != nil {
+			return errors.Trace(err)
+		}
 	}
+	return nil
 }
 
 // allowFilter allowlist filtering
@@ -117,7 +177,7 @@ func (s *Filter) blockFilter(stbs []TableName) []TableName {
 
 // SkipSchemaAndTable skips data based on schema and table rules.
 func (s *Filter) SkipSchemaAndTable(schema string, table string) bool {
-	tbs := []TableName{{Schema: strings.ToLower(schema), Table: strings.ToLower(table)}}
+	tbs := []TableName{{Schema: schema, Table: table}}
 
 	tbs = s.allowFilter(tbs)
 	tbs = s.blockFilter(tbs)
@@ -150,6 +210,47 @@ func (s *Filter) matchTable(patternTBS []TableName, tb TableName) bool {
 	return false
 }
 
+// ValidateDBs checks the patterns of the schemas in the config item, like replicate-do-db.
+func ValidateDBs(item string, dbs []string, opts ...Option) error {
+	f := newValidator(opts)
+	for _, db := range dbs {
+		if len(db) == 0 {
+			return errors.Errorf("empty schema name in `%s` config", item)
+		}
+		if _, err := f.compilePattern(db); err != nil {
+			return errors.Annotatef(err, "in `%s` config", item)
+		}
+	}
+	return nil
+}
+
+// ValidateTables checks the patterns of the tables in the config item, like replicate-do-table.
+func ValidateTables(item string, tables []TableName, opts ...Option) error {
+	f := newValidator(opts)
+	for _, tb := range tables {
+		if len(tb.Schema) == 0 {
+			return errors.Errorf("empty schema name in `%s` config", item)
+		}
+		if len(tb.Table) == 0 {
+			return errors.Errorf("empty table name in `%s` config", item)
+		}
+		for _, pattern := range []string{tb.Schema, tb.Table} {
+			if _, err := f.compilePattern(pattern); err != nil {
+				return errors.Annotatef(err, "in `%s` config", item)
+			}
+		}
+	}
+	return nil
+}
+
+func newValidator(opts []Option) *Filter {
+	f := new(Filter)
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
 // TableName specify a Schema name and Table name
 type TableName struct {
 	Schema string `toml:"db-name" json:"db-name"`
@@ -26,11 +26,17 @@ type testFilterSuite struct {
 
 var _ = Suite(&testFilterSuite{})
 
+func mustNewFilter(c *C, ignoreDBs []string, ignoreTables []TableName, doDBs []string, doTables []TableName, opts ...Option) *Filter {
+	filter, err := NewFilter(ignoreDBs, ignoreTables, doDBs, doTables, opts...)
+	c.Assert(err, IsNil)
+	return filter
+}
+
 func (t *testFilterSuite) TestFilter(c *C) {
 	DoDBs := []string{"fulldb", "~fulldb_re.*"}
 	DoTables := []TableName{{"db", "table"}, {"db2", "~table"}}
 
-	filter := NewFilter(nil, nil, DoDBs, DoTables)
+	filter := mustNewFilter(c, nil, nil, DoDBs, DoTables)
 
 	c.Assert(filter.SkipSchemaAndTable("Fulldb", "t1"), IsFalse)
 	c.Assert(filter.SkipSchemaAndTable("fulldb_re_x", ""), IsFalse)
@@ -38,7 +44,7 @@ func (t *testFilterSuite) TestFilter(c *C) {
 	c.Assert(filter.SkipSchemaAndTable("db2", "table"), IsFalse)
 
 	// with ignore db
-	filter = NewFilter([]string{"db2"}, nil, DoDBs, DoTables)
+	filter = mustNewFilter(c, []string{"db2"}, nil, DoDBs, DoTables)
 	c.Assert(filter.SkipSchemaAndTable("Fulldb", "t1"), IsFalse)
 	c.Assert(filter.SkipSchemaAndTable("fulldb_re_x", ""), IsFalse)
 	c.Assert(filter.SkipSchemaAndTable("db", "table_skip"), IsTrue)
@@ -46,12 +52,108 @@ func (t *testFilterSuite) TestFilter(c *C) {
 
 	// with ignore table
 	ignoreTables := []TableName{{"ignore", "ignore"}}
-	filter = NewFilter(nil, ignoreTables, nil, nil)
+	filter = mustNewFilter(c, nil, ignoreTables, nil, nil)
 	c.Assert(filter.SkipSchemaAndTable("ignore", "ignore"), IsTrue)
 	c.Assert(filter.SkipSchemaAndTable("not_ignore", "not_ignore"), IsFalse)
 
 	// with empty string
-	filter = NewFilter(nil, nil, []string{""} /*doDBs*/, nil)
+	filter = mustNewFilter(c, nil, nil, []string{""} /*doDBs*/, nil)
 	c.Assert(filter.SkipSchemaAndTable("", "any"), IsFalse)
 	c.Assert(filter.SkipSchemaAndTable("any", ""), IsTrue)
+
+	// the patterns not starting with '~' are regular expressions matching the whole name.
+	filter = mustNewFilter(c, nil, nil, []string{"shop_\\d"}, []TableName{{"db", "order_.*"}})
+	c.Assert(filter.SkipSchemaAndTable("shop_1", "t"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("shop_10", "t"), IsTrue)
+	c.Assert(filter.SkipSchemaAndTable("db", "order_2021"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("db", "orders"), IsTrue)
+
+	_, err := NewFilter(nil, nil, []string{"db("}, nil)
+	c.Assert(err, ErrorMatches, "invalid pattern db\\(.*")
+	_, err = NewFilter(nil, []TableName{{"db", "~["}}, nil, nil)
+	c.Assert(err, ErrorMatches, "invalid pattern ~\\[.*")
+}
+
+func (t *testFilterSuite) TestWildcard(c *C) {
+	filter := mustNewFilter(c, nil, nil, []string{"shop_?"}, []TableName{{"db", "order_*"}, {"db.1", "t"}, {"db", "~^log_\\d+$"}}, Wildcard(true))
+	c.Assert(filter.SkipSchemaAndTable("shop_1", "t"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("shop_10", "t"), IsTrue)
+	c.Assert(filter.SkipSchemaAndTable("db", "order_2021"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("db", "Order_"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("db", "orders"), IsTrue)
+	c.Assert(filter.SkipSchemaAndTable("db", "log_1"), IsFalse)
+	// the characters other than the wildcards are literal.
+	c.Assert(filter.SkipSchemaAndTable("db.1", "t"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("dbx1", "t"), IsTrue)
+
+	// the same patterns are regular expressions without Wildcard.
+	filter = mustNewFilter(c, nil, nil, nil, []TableName{{"db.1", "t"}})
+	c.Assert(filter.SkipSchemaAndTable("dbx1", "t"), IsFalse)
+}
+
+func (t *testFilterSuite) TestCaseSensitive(c *C) {
+	doTables := []TableName{{"db", "Orders"}, {"db", "~^Log"}}
+	filter := mustNewFilter(c, nil, nil, nil, doTables, CaseSensitive(true))
+	c.Assert(filter.SkipSchemaAndTable("db", "Orders"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("db", "orders"), IsTrue)
+	c.Assert(filter.SkipSchemaAndTable("DB", "Orders"), IsTrue)
+	c.Assert(filter.SkipSchemaAndTable("db", "Log1"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("db", "log1"), IsTrue)
+
+	filter = mustNewFilter(c, nil, nil, nil, doTables)
+	c.Assert(filter.SkipSchemaAndTable("DB", "orders"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("db", "log1"), IsFalse)
+}
+
+func (t *testFilterSuite) TestPrecedence(c *C) {
+	// the ignore rules take precedence over the do rules.
+	filter := mustNewFilter(c, []string{"db"}, []TableName{{"shop", "audit_.*"}}, []string{"shop", "db"}, []TableName{{"shop", "audit_1"}})
+	c.Assert(filter.SkipSchemaAndTable("shop", "orders"), IsFalse)
+	c.Assert(filter.SkipSchemaAndTable("shop", "audit_1"), IsTrue)
+	c.Assert(filter.SkipSchemaAndTable("db", "t"), IsTrue)
+	c.Assert(filter.SkipSchemaAndTable("other", "t"), IsTrue)
+
+	// the schema-level DDLs only match the table patterns matching an empty name.
+	filter = mustNewFilter(c, nil, nil, nil, []TableName{{"shop", "orders"}, {"db", ".*"}})
+	c.Assert(filter.SkipSchemaAndTable("shop", ""), IsTrue)
+	c.Assert(filter.SkipSchemaAndTable("db", ""), IsFalse)
+}
+
+func (t *testFilterSuite) TestValidate(c *C) {
+	c.Assert(ValidateDBs("replicate-do-db", []string{"db", "~^db_\\d+$", "db_.*"}), IsNil)
+	c.Assert(ValidateDBs("replicate-do-db", []string{"db", ""}), ErrorMatches, "empty schema name in `replicate-do-db` config")
+	c.Assert(ValidateDBs("replicate-do-db", []string{"~db("}), ErrorMatches, "in `replicate-do-db` config: invalid pattern ~db\\(.*")
+	c.Assert(ValidateDBs("replicate-do-db", []string{"db("}), ErrorMatches, "in `replicate-do-db` config: invalid pattern db\\(.*")
+
+	c.Assert(ValidateTables("ignore-table", []TableName{{"db", "t(1)"}}), IsNil)
+	c.Assert(ValidateTables("ignore-table", []TableName{{"db", "t(1"}}, Wildcard(true)), IsNil)
+	c.Assert(ValidateTables("ignore-table", []TableName{{"db", "t(1"}}), ErrorMatches, "in `ignore-table` config: invalid pattern t\\(1.*")
+	c.Assert(ValidateTables("ignore-table", []TableName{{"", "t"}}), ErrorMatches, "empty schema name in `ignore-table` config")
+	c.Assert(ValidateTables("ignore-table", []TableName{{"db", ""}}), ErrorMatches, "empty table name in `ignore-table` config")
+	c.Assert(ValidateTables("ignore-table", []TableName{{"db", "~["}}), ErrorMatches, "in `ignore-table` config: invalid pattern ~\\[.*")
+}
+
+func (t *testFilterSuite) TestColumnFilter(c *C) {
+	filter, err := NewColumnFilter(nil)
+	c.Assert(err, IsNil)
+	c.Assert(filter, IsNil)
+	var nilFilter *ColumnFilter
+	c.Assert(nilFilter.SkipColumns("db", "t"), IsNil)
+
+	filter, err = NewColumnFilter([]ColumnRule{
+		{Schema: "db", Table: "t", Columns: []string{"Blob"}},
+		{Schema: "db", Table: "~^t.*", Columns: []string{"audit"}},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(filter.SkipColumns("db", "a"), IsNil)
+
+	skip := filter.SkipColumns("DB", "T")
+	c.Assert(skip, NotNil)
+	c.Assert(skip("blob"), IsTrue)
+	c.Assert(skip("AUDIT"), IsTrue)
+	c.Assert(skip("id"), IsFalse)
+
+	skip = filter.SkipColumns("db", "t1")
+	c.Assert(skip("blob"), IsFalse)
+	c.Assert(skip("audit"), IsTrue)
 }
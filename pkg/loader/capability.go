@@ -0,0 +1,121 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	gosql "database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+const (
+	tidbVersionMark = "-TiDB-v"
+
+	varAsyncCommit = "tidb_enable_async_commit"
+	varOnePC       = "tidb_enable_1pc"
+)
+
+// Capabilities are the features of downstream found by ProbeCapabilities.
+type Capabilities struct {
+	// Version is the result of VERSION(), like "5.7.25-TiDB-v5.0.0" of TiDB.
+	Version string
+	// TiDBVersion is the version of TiDB like "5.0.0", it's empty if downstream isn't TiDB.
+	TiDBVersion string
+
+	// AsyncCommit and OnePC are whether the transactions can be committed by async commit
+	// and one phase commit, which save one or two round trips of committing a transaction.
+	AsyncCommit bool
+	OnePC       bool
+}
+
+// ProbeCapabilities finds the version of downstream and the features it supports.
+func ProbeCapabilities(db *gosql.DB) (*Capabilities, error) {
+	caps := new(Capabilities)
+	if err := db.QueryRow("SELECT VERSION()").Scan(&caps.Version); err != nil {
+		return nil, errors.Annotate(err, "query the version of downstream failed")
+	}
+	if idx := strings.Index(caps.Version, tidbVersionMark); idx >= 0 {
+		caps.TiDBVersion = caps.Version[idx+len(tidbVersionMark):]
+	}
+	if !caps.IsTiDB() {
+		return caps, nil
+	}
+
+	rows, err := db.Query("SHOW VARIABLES WHERE Variable_name IN ('" + varAsyncCommit + "', '" + varOnePC + "')")
+	if err != nil {
+		return nil, errors.Annotate(err, "query the variables of downstream failed")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value string
+		if err = rows.Scan(&name, &value); err != nil {
+			return nil, errors.Trace(err)
+		}
+		switch name {
+		case varAsyncCommit:
+			caps.AsyncCommit = true
+		case varOnePC:
+			caps.OnePC = true
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	// Both are experimental before 5.0, so don't enable them even if the variables exist.
+	if major, _ := caps.tidbMajorMinor(); major < 5 {
+		caps.AsyncCommit, caps.OnePC = false, false
+	}
+	return caps, nil
+}
+
+// IsTiDB returns whether downstream is TiDB.
+func (c *Capabilities) IsTiDB() bool {
+	return len(c.TiDBVersion) > 0
+}
+
+// tidbMajorMinor returns the major and minor version of TiDB, they're zero if they can't be parsed.
+func (c *Capabilities) tidbMajorMinor() (major int, minor int) {
+	parts := strings.SplitN(c.TiDBVersion, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0
+	}
+	var err error
+	if major, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, 0
+	}
+	if minor, err = strconv.Atoi(parts[1]); err != nil {
+		return 0, 0
+	}
+	return major, minor
+}
+
+// SessionParams returns the session variables enabling the features, they can be passed to
+// CreateDBWithSQLMode. The variables of params are kept, so the users can disable a feature
+// by setting its variable explicitly.
+func (c *Capabilities) SessionParams(params map[string]string) map[string]string {
+	merged := make(map[string]string, len(params)+2)
+	if c.AsyncCommit {
+		merged[varAsyncCommit] = "1"
+	}
+	if c.OnePC {
+		merged[varOnePC] = "1"
+	}
+	for k, v := range params {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"regexp"
+	"strings"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	check "github.com/pingcap/check"
+)
+
+type capabilitySuite struct{}
+
+var _ = check.Suite(&capabilitySuite{})
+
+func (s *capabilitySuite) probe(c *check.C, version string, vars ...string) *Capabilities {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT VERSION()")).
+		WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow(version))
+	if strings.Contains(version, "TiDB") {
+		rows := sqlmock.NewRows([]string{"Variable_name", "Value"})
+		for _, v := range vars {
+			rows.AddRow(v, "OFF")
+		}
+		mock.ExpectQuery("SHOW VARIABLES WHERE .*").WillReturnRows(rows)
+	}
+	caps, err := ProbeCapabilities(db)
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+	return caps
+}
+
+func (s *capabilitySuite) TestProbeCapabilities(c *check.C) {
+	caps := s.probe(c, "8.0.21")
+	c.Assert(caps.IsTiDB(), check.IsFalse)
+	c.Assert(caps.SessionParams(nil), check.HasLen, 0)
+
+	caps = s.probe(c, "5.7.25-TiDB-v5.0.0", varAsyncCommit, varOnePC)
+	c.Assert(caps.IsTiDB(), check.IsTrue)
+	c.Assert(caps.TiDBVersion, check.Equals, "5.0.0")
+	c.Assert(caps.AsyncCommit, check.IsTrue)
+	c.Assert(caps.OnePC, check.IsTrue)
+
+	// experimental before 5.0.
+	caps = s.probe(c, "5.7.25-TiDB-v4.0.9", varAsyncCommit)
+	c.Assert(caps.IsTiDB(), check.IsTrue)
+	c.Assert(caps.AsyncCommit, check.IsFalse)
+
+	caps = s.probe(c, "5.7.25-TiDB-v3.0.20")
+	c.Assert(caps.IsTiDB(), check.IsTrue)
+	c.Assert(caps.AsyncCommit, check.IsFalse)
+	c.Assert(caps.OnePC, check.IsFalse)
+}
+
+func (s *capabilitySuite) TestSessionParams(c *check.C) {
+	caps := &Capabilities{TiDBVersion: "5.1.0", AsyncCommit: true, OnePC: true}
+	c.Assert(caps.SessionParams(map[string]string{"tidb_enable_1pc": "0", "time_zone": "UTC"}), check.DeepEquals, map[string]string{
+		"tidb_enable_async_commit": "1",
+		"tidb_enable_1pc":          "0",
+		"time_zone":                "UTC",
+	})
+}
@@ -0,0 +1,236 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	"github.com/pingcap/parser/model"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"go.uber.org/zap"
+)
+
+// schemaRewriter replaces the schemas of the tables and databases in a DDL by
+// the lower case names in schemas, the tables without schema are qualified
+// with defaultSchema if it's set.
+type schemaRewriter struct {
+	schemas       map[string]string
+	defaultSchema string
+}
+
+func (r *schemaRewriter) rewrite(name string) (string, bool) {
+	to, ok := r.schemas[strings.ToLower(name)]
+	return to, ok
+}
+
+// Enter implements ast.Visitor interface.
+func (r *schemaRewriter) Enter(in ast.Node) (ast.Node, bool) {
+	switch n := in.(type) {
+	case *ast.TableName:
+		if len(n.Schema.O) == 0 && len(r.defaultSchema) > 0 {
+			n.Schema = model.NewCIStr(r.defaultSchema)
+		}
+		if to, ok := r.rewrite(n.Schema.O); ok {
+			n.Schema = model.NewCIStr(to)
+		}
+	case *ast.CreateDatabaseStmt:
+		if to, ok := r.rewrite(n.Name); ok {
+			n.Name = to
+		}
+	case *ast.AlterDatabaseStmt:
+		if to, ok := r.rewrite(n.Name); ok {
+			n.Name = to
+		}
+	case *ast.DropDatabaseStmt:
+		if to, ok := r.rewrite(n.Name); ok {
+			n.Name = to
+		}
+	}
+	return in, false
+}
+
+// Leave implements ast.Visitor interface.
+func (r *schemaRewriter) Leave(in ast.Node) (ast.Node, bool) {
+	return in, true
+}
+
+// rewriteDDLSchema replaces the schemas in the DDL by the rewriter, the tables
+// without schema are left as is by default because the DDL is executed after
+// `use` the schema it's rewritten to.
+func rewriteDDLSchema(sql string, rewriter *schemaRewriter) (string, error) {
+	stmt, err := parser.New().ParseOneStmt(sql, "", "")
+	if err != nil {
+		return "", errors.Annotatef(err, "parse ddl %s", sql)
+	}
+
+	stmt.Accept(rewriter)
+
+	var sb strings.Builder
+	if err = stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+		return "", errors.Annotatef(err, "restore ddl %s", sql)
+	}
+	return sb.String(), nil
+}
+
+// movedSchemas returns the lower case schemas of the tables renamed across
+// schemas by the DDL, like `RENAME TABLE a.t TO b.t` or `ALTER TABLE a.t RENAME
+// TO b.t`, the tables without schema are in defaultSchema. TiDB doesn't support
+// renaming a database, so it's how a schema is renamed in upstream.
+func movedSchemas(sql string, defaultSchema string) ([]string, error) {
+	stmt, err := parser.New().ParseOneStmt(sql, "", "")
+	if err != nil {
+		return nil, errors.Annotatef(err, "parse ddl %s", sql)
+	}
+
+	var pairs [][2]*ast.TableName
+	switch n := stmt.(type) {
+	case *ast.RenameTableStmt:
+		for _, t2t := range n.TableToTables {
+			pairs = append(pairs, [2]*ast.TableName{t2t.OldTable, t2t.NewTable})
+		}
+	case *ast.AlterTableStmt:
+		for _, spec := range n.Specs {
+			if spec.Tp == ast.AlterTableRenameTable {
+				pairs = append(pairs, [2]*ast.TableName{n.Table, spec.NewTable})
+			}
+		}
+	}
+
+	schemaOf := func(t *ast.TableName) string {
+		if len(t.Schema.O) == 0 {
+			return strings.ToLower(defaultSchema)
+		}
+		return t.Schema.L
+	}
+	var schemas []string
+	moved := make(map[string]struct{})
+	for _, pair := range pairs {
+		from, to := schemaOf(pair[0]), schemaOf(pair[1])
+		if from == to {
+			continue
+		}
+		for _, schema := range []string{from, to} {
+			if _, ok := moved[schema]; !ok {
+				moved[schema] = struct{}{}
+				schemas = append(schemas, schema)
+			}
+		}
+	}
+	return schemas, nil
+}
+
+// routeSchemaMove returns the shards of the schemas the DDL moves tables between
+// if any of them is broadcast, the table in the i-th shard of a schema is moved
+// to the i-th shard of the other. It fails if the move can't be followed by the
+// shards, like a table moved from a broadcast schema to a schema not broadcast,
+// or it's blocked by BlockSchemaMoveDDL.
+func (s *loaderImpl) routeSchemaMove(ddl *DDL) (map[string][]string, error) {
+	if len(s.opts.ddlBroadcast) == 0 {
+		return nil, nil
+	}
+	schemas, err := movedSchemas(ddl.SQL, ddl.Database)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var routed []string
+	for _, schema := range schemas {
+		if _, ok := s.opts.ddlBroadcast[schema]; ok {
+			routed = append(routed, schema)
+		}
+	}
+	if len(routed) == 0 {
+		return nil, nil
+	}
+	if s.opts.blockSchemaMoveDDL {
+		return nil, errors.Errorf("ddl moving tables between schemas %s is blocked since %s are broadcast to shards, ddl: %s",
+			strings.Join(schemas, ","), strings.Join(routed, ","), ddl.SQL)
+	}
+	if len(routed) != len(schemas) {
+		return nil, errors.Errorf("can't route ddl moving tables between schemas %s, only %s are broadcast to shards, ddl: %s",
+			strings.Join(schemas, ","), strings.Join(routed, ","), ddl.SQL)
+	}
+
+	routes := make(map[string][]string, len(schemas))
+	for _, schema := range schemas {
+		shards := s.opts.ddlBroadcast[schema]
+		if len(shards) != len(s.opts.ddlBroadcast[schemas[0]]) {
+			return nil, errors.Errorf("can't route ddl moving tables between schemas %s with different shard counts, ddl: %s",
+				strings.Join(schemas, ","), ddl.SQL)
+		}
+		routes[schema] = shards
+	}
+	return routes, nil
+}
+
+// broadcastDDL executes the DDL on every shard of the schema, the failure of
+// one shard doesn't stop the others so that the failed shards can be found
+// and fixed at once. The executed shards are executed again when the DDL is
+// retried after drainer restarts, the errors like table exists are ignored then.
+// The error returned is of the first failed shard, so it's handled like the
+// error of a DDL executed on one schema.
+// The other schemas in routes are replaced by their shards of the same number,
+// and the tables without schema are qualified in the DDL executed then.
+func (s *loaderImpl) broadcastDDL(ddl *DDL, shards []string, routes map[string][]string) error {
+	var (
+		failed   []string
+		firstErr error
+	)
+	for i, shard := range shards {
+		rewriter := &schemaRewriter{schemas: map[string]string{strings.ToLower(ddl.Database): shard}}
+		if len(routes) > 0 {
+			rewriter.defaultSchema = ddl.Database
+			for schema, targets := range routes {
+				rewriter.schemas[schema] = targets[i]
+			}
+		}
+		sql, err := rewriteDDLSchema(ddl.SQL, rewriter)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if s.opts.keepDDLComments {
+			sql = pkgsql.KeepLeadingComments(ddl.SQL, sql)
+		}
+
+		err = s.execDDL(&DDL{Database: shard, Table: ddl.Table, SQL: sql})
+		if err == nil {
+			continue
+		}
+		if pkgsql.IgnoreDDLError(err) {
+			log.Warn("ignore ddl of shard", zap.String("shard", shard), zap.String("ddl", sql), zap.Error(err))
+			continue
+		}
+
+		log.Error("exec ddl of shard failed", zap.String("shard", shard), zap.String("ddl", sql), zap.Error(err))
+		if s.metrics != nil && s.metrics.DDLBroadcastFailureCounterVec != nil {
+			s.metrics.DDLBroadcastFailureCounterVec.WithLabelValues(shard).Add(1)
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		failed = append(failed, shard)
+	}
+
+	if len(failed) > 0 {
+		// the error of the first failed shard is kept for the handler of the failed DDLs.
+		return errors.Annotatef(firstErr, "failed to exec ddl on %d of %d shards of %s, failed shards: %s, ddl: %s",
+			len(failed), len(shards), ddl.Database, strings.Join(failed, ","), ddl.SQL)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type ddlBroadcastSuite struct{}
+
+var _ = check.Suite(&ddlBroadcastSuite{})
+
+func (s *ddlBroadcastSuite) TestRewriteDDLSchema(c *check.C) {
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"create database test", "CREATE DATABASE `test_001`"},
+		{"drop database if exists TEST", "DROP DATABASE IF EXISTS `test_001`"},
+		{"create table t(id int)", "CREATE TABLE `t` (`id` INT)"},
+		{"alter table test.t add column c int", "ALTER TABLE `test_001`.`t` ADD COLUMN `c` INT"},
+		{"rename table test.t to other.t, test.t2 to test.t3",
+			"RENAME TABLE `test_001`.`t` TO `other`.`t`, `test_001`.`t2` TO `test_001`.`t3`"},
+		{"create table test.t like other.t", "CREATE TABLE `test_001`.`t` LIKE `other`.`t`"},
+	}
+	for _, t := range tests {
+		sql, err := rewriteDDLSchema(t.sql, &schemaRewriter{schemas: map[string]string{"test": "test_001"}})
+		c.Assert(err, check.IsNil)
+		c.Assert(sql, check.Equals, t.expected)
+	}
+
+	_, err := rewriteDDLSchema("create tablee t", &schemaRewriter{})
+	c.Assert(err, check.NotNil)
+}
+
+func (s *ddlBroadcastSuite) TestBroadcastDDL(c *check.C) {
+	origWait := execDDLRetryWait
+	execDDLRetryWait = time.Millisecond
+	defer func() {
+		execDDLRetryWait = origWait
+	}()
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	failures := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "failure"}, []string{"shard"})
+	ld := &loaderImpl{
+		db:      db,
+		metrics: &MetricsGroup{DDLBroadcastFailureCounterVec: failures},
+		opts:    options{ddlBroadcast: map[string][]string{"test": {"test_0", "test_1", "test_2"}}},
+		ctx:     context.Background(),
+	}
+
+	ddl := &DDL{Database: "test", Table: "t", SQL: "alter table test.t add column c int"}
+	mock.ExpectBegin()
+	mock.ExpectExec("use `test_0`;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `test_0`.`t` ADD COLUMN `c` INT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// the column is added before, the error is ignored
+	for i := 0; i < maxDDLRetryCount; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec("use `test_1`;").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("ALTER TABLE `test_1`.`t` ADD COLUMN `c` INT").WillReturnError(&mysql.MySQLError{Number: 1060})
+		mock.ExpectRollback()
+	}
+	for i := 0; i < maxDDLRetryCount; i++ {
+		mock.ExpectBegin().WillReturnError(errors.New("connection refused"))
+	}
+	err = ld.execDDLOrBroadcast(ddl)
+	c.Assert(err, check.ErrorMatches, "failed to exec ddl on 1 of 3 shards of test, failed shards: test_2.*")
+	// the error of the failed shard is kept.
+	c.Assert(errors.Cause(err), check.ErrorMatches, "connection refused")
+	c.Assert(testutil.ToFloat64(failures.WithLabelValues("test_2")), check.Equals, 1.0)
+	c.Assert(testutil.ToFloat64(failures.WithLabelValues("test_1")), check.Equals, 0.0)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	// the DDLs of other schemas are not broadcast
+	mock.ExpectBegin()
+	mock.ExpectExec("use `other`;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table t").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	err = ld.execDDLOrBroadcast(&DDL{Database: "other", Table: "t", SQL: "create table t(id int)"})
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	// the leading comments are kept if required.
+	ld.opts.ddlBroadcast = map[string][]string{"test": {"test_0"}}
+	ld.opts.keepDDLComments = true
+	mock.ExpectBegin()
+	mock.ExpectExec("use `test_0`;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("/*vt+ SHARD=0 */ ALTER TABLE `test_0`.`t` ADD COLUMN `d` INT")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	err = ld.execDDLOrBroadcast(&DDL{Database: "test", Table: "t", SQL: "/*vt+ SHARD=0 */ alter table test.t add column d int"})
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *ddlBroadcastSuite) TestMovedSchemas(c *check.C) {
+	tests := []struct {
+		sql      string
+		expected []string
+	}{
+		{"rename table a.t to a.t2", nil},
+		{"rename table t to b.t", []string{"a", "b"}},
+		{"rename table A.t to a.t2, c.t to B.t", []string{"c", "b"}},
+		{"alter table a.t rename to b.t", []string{"a", "b"}},
+		{"alter table t rename to t2", nil},
+		{"alter table a.t add column c int", nil},
+	}
+	for _, t := range tests {
+		schemas, err := movedSchemas(t.sql, "a")
+		c.Assert(err, check.IsNil)
+		c.Assert(schemas, check.DeepEquals, t.expected, check.Commentf("sql: %s", t.sql))
+	}
+}
+
+func (s *ddlBroadcastSuite) TestRouteSchemaMove(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	ld := &loaderImpl{
+		db: db,
+		opts: options{ddlBroadcast: map[string][]string{
+			"a": {"a_0", "a_1"},
+			"b": {"b_0", "b_1"},
+			"c": {"c_0", "c_1", "c_2"},
+		}},
+		ctx: context.Background(),
+	}
+
+	// the tables are moved between the shards of the same number.
+	for i := 0; i < 2; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec(fmt.Sprintf("use `b_%d`;", i)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf("RENAME TABLE `a_%d`.`t` TO `b_%d`.`t`", i, i))).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+	}
+	err = ld.execDDLOrBroadcast(&DDL{Database: "b", Table: "t", SQL: "rename table a.t to t"})
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	err = ld.execDDLOrBroadcast(&DDL{Database: "other", Table: "t", SQL: "rename table a.t to other.t"})
+	c.Assert(err, check.ErrorMatches, "can't route ddl moving tables between schemas a,other, only a are broadcast.*")
+	err = ld.execDDLOrBroadcast(&DDL{Database: "c", Table: "t", SQL: "alter table a.t rename to c.t"})
+	c.Assert(err, check.ErrorMatches, ".*with different shard counts.*")
+
+	// the renames in one schema are broadcast as before.
+	for i := 0; i < 2; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec(fmt.Sprintf("use `a_%d`;", i)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("RENAME TABLE `t` TO `t2`")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+	}
+	err = ld.execDDLOrBroadcast(&DDL{Database: "a", Table: "t2", SQL: "rename table t to t2"})
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+
+	ld.opts.blockSchemaMoveDDL = true
+	err = ld.execDDLOrBroadcast(&DDL{Database: "b", Table: "t", SQL: "rename table a.t to b.t"})
+	c.Assert(err, check.ErrorMatches, "ddl moving tables between schemas a,b is blocked.*")
+
+	// the schemas not broadcast are not affected.
+	mock.ExpectBegin()
+	mock.ExpectExec("use `y`;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("rename table x.t to y.t")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	err = ld.execDDLOrBroadcast(&DDL{Database: "y", Table: "t", SQL: "rename table x.t to y.t"})
+	c.Assert(err, check.IsNil)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
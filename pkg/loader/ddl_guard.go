@@ -0,0 +1,232 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+const (
+	queryMetadataLockHoldersSQL = `SELECT t.PROCESSLIST_ID, t.PROCESSLIST_TIME, t.PROCESSLIST_INFO
+FROM performance_schema.metadata_locks l JOIN performance_schema.threads t ON l.OWNER_THREAD_ID = t.THREAD_ID
+WHERE l.OBJECT_SCHEMA = ? AND l.OBJECT_NAME = ? AND l.LOCK_STATUS = 'GRANTED' AND t.PROCESSLIST_ID <> ?`
+
+	queryProcessStateSQL = "SELECT STATE FROM information_schema.PROCESSLIST WHERE ID = ?"
+)
+
+// killQuerySQL returns the statement killing the running query of the connection. KILL QUERY
+// of TiDB is ignored unless compatible-kill-query is set, since the connection may be of another
+// TiDB instance, so KILL TIDB QUERY is used then and the kill connection must be the same instance.
+func killQuerySQL(connID int64, tidb bool) string {
+	if tidb {
+		return fmt.Sprintf("KILL TIDB QUERY %d", connID)
+	}
+	return fmt.Sprintf("KILL QUERY %d", connID)
+}
+
+// getMetadataLockHolders returns the sessions holding the metadata locks of
+// the table, it fails if performance_schema is unavailable like TiDB.
+var getMetadataLockHolders = queryMetadataLockHolders
+
+func queryMetadataLockHolders(ctx context.Context, db *gosql.DB, schema string, table string, excludeID int64) ([]string, error) {
+	rows, err := db.QueryContext(ctx, queryMetadataLockHoldersSQL, schema, table, excludeID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	var holders []string
+	for rows.Next() {
+		var (
+			id   int64
+			t    gosql.NullInt64
+			info gosql.NullString
+		)
+		if err = rows.Scan(&id, &t, &info); err != nil {
+			return nil, errors.Trace(err)
+		}
+		holders = append(holders, fmt.Sprintf("id: %d, time: %ds, info: %s", id, t.Int64, info.String))
+	}
+	return holders, errors.Trace(rows.Err())
+}
+
+// isWaitingForMetadataLock checks whether the session is waiting for a metadata lock.
+func isWaitingForMetadataLock(ctx context.Context, db *gosql.DB, connID int64) (bool, error) {
+	var state gosql.NullString
+	err := db.QueryRowContext(ctx, queryProcessStateSQL, connID).Scan(&state)
+	if err != nil {
+		if errors.Cause(err) == gosql.ErrNoRows {
+			return false, nil
+		}
+		return false, errors.Trace(err)
+	}
+	return strings.Contains(strings.ToLower(state.String), "metadata lock"), nil
+}
+
+// ddlConnDB returns the db the DDLs are executed on.
+func (s *loaderImpl) ddlConnDB() *gosql.DB {
+	if s.opts.ddlDB != nil {
+		return s.opts.ddlDB
+	}
+	return s.db
+}
+
+func (s *loaderImpl) ddlGuardEnabled() bool {
+	return s.opts.ddlTimeout > 0 || s.opts.ddlBlockCheckInterval > 0
+}
+
+func (s *loaderImpl) setDDLBlocked(seconds float64) {
+	if s.metrics != nil && s.metrics.DDLBlockedGauge != nil {
+		s.metrics.DDLBlockedGauge.Set(seconds)
+	}
+}
+
+// execDDLWithGuard executes the DDL on a dedicated connection, the DDL is
+// killed if it doesn't finish in the DDL timeout, and the sessions holding the
+// metadata locks are logged if the DDL is blocked by them.
+func (s *loaderImpl) execDDLWithGuard(ctx context.Context, ddl *DDL) error {
+	conn, err := s.ddlConnDB().Conn(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer conn.Close()
+
+	var (
+		connID  int64
+		version string
+	)
+	if err = conn.QueryRowContext(ctx, "SELECT CONNECTION_ID(), VERSION()").Scan(&connID, &version); err != nil {
+		return errors.Trace(err)
+	}
+	tidb := strings.Contains(version, tidbVersionMark)
+
+	if len(ddl.Table) > 0 && !tidb {
+		holders, err := getMetadataLockHolders(ctx, s.db, ddl.Database, ddl.Table, connID)
+		if err != nil {
+			log.Debug("check metadata locks failed", zap.String("ddl", ddl.SQL), zap.Error(err))
+		} else if len(holders) > 0 {
+			log.Warn("the table is locked by other sessions, the ddl may be blocked",
+				zap.String("ddl", ddl.SQL), zap.Strings("holders", holders))
+		}
+	}
+
+	execCtx := ctx
+	if s.opts.ddlTimeout > 0 {
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithTimeout(ctx, s.opts.ddlTimeout)
+		defer cancel()
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	if s.opts.ddlBlockCheckInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.watchDDL(ctx, ddl, connID, done)
+		}()
+	}
+
+	err = execDDLOnConn(execCtx, conn, ddl)
+	close(done)
+	wg.Wait()
+
+	if err != nil && execCtx.Err() == context.DeadlineExceeded {
+		// the DDL keeps running in downstream after the connection is closed
+		if _, killErr := s.ddlConnDB().ExecContext(ctx, killQuerySQL(connID, tidb)); killErr != nil {
+			log.Warn("kill the timeout ddl failed", zap.Int64("connection id", connID), zap.Error(killErr))
+		}
+		return errors.Errorf("exec ddl timeout after %s, ddl: %s", s.opts.ddlTimeout, ddl.SQL)
+	}
+	return errors.Trace(err)
+}
+
+func execDDLOnConn(ctx context.Context, conn *gosql.Conn, ddl *DDL) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if len(ddl.Database) > 0 && !isCreateDatabaseDDL(ddl.SQL) {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("use %s;", quoteName(ddl.Database)))
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Error("Rollback failed", zap.Error(rbErr))
+			}
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, ddl.SQL); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Error("Rollback failed", zap.String("sql", ddl.SQL), zap.Error(rbErr))
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// watchDDL checks whether the DDL is waiting for metadata locks every check
+// interval until done, the blocked DDL is logged and reported by metrics.
+func (s *loaderImpl) watchDDL(ctx context.Context, ddl *DDL, connID int64, done <-chan struct{}) {
+	ticker := time.NewTicker(s.opts.ddlBlockCheckInterval)
+	defer ticker.Stop()
+	defer s.setDDLBlocked(0)
+
+	var blockedSince time.Time
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		waiting, err := isWaitingForMetadataLock(ctx, s.db, connID)
+		if err != nil {
+			log.Warn("check the state of ddl failed", zap.String("ddl", ddl.SQL), zap.Error(err))
+			continue
+		}
+		if !waiting {
+			blockedSince = time.Time{}
+			s.setDDLBlocked(0)
+			continue
+		}
+
+		if blockedSince.IsZero() {
+			blockedSince = time.Now()
+		}
+		var holders []string
+		if len(ddl.Table) > 0 {
+			holders, err = getMetadataLockHolders(ctx, s.db, ddl.Database, ddl.Table, connID)
+			if err != nil {
+				log.Debug("check metadata locks failed", zap.String("ddl", ddl.SQL), zap.Error(err))
+			}
+		}
+		log.Error("ddl is blocked by metadata lock", zap.String("ddl", ddl.SQL),
+			zap.Duration("blocked", time.Since(blockedSince)), zap.Strings("holders", holders))
+		s.setDDLBlocked(time.Since(blockedSince).Seconds())
+	}
+}
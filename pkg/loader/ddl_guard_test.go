@@ -0,0 +1,120 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	gosql "database/sql"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+)
+
+type ddlGuardSuite struct{}
+
+var _ = check.Suite(&ddlGuardSuite{})
+
+func (s *ddlGuardSuite) mockHolders(c *check.C) *int32 {
+	var calls int32
+	getMetadataLockHolders = func(_ context.Context, _ *gosql.DB, schema string, table string, excludeID int64) ([]string, error) {
+		c.Assert(schema, check.Equals, "test")
+		c.Assert(table, check.Equals, "t")
+		c.Assert(excludeID, check.Equals, int64(42))
+		atomic.AddInt32(&calls, 1)
+		return []string{"id: 1, time: 100s, info: "}, nil
+	}
+	return &calls
+}
+
+func (s *ddlGuardSuite) TearDownTest(c *check.C) {
+	getMetadataLockHolders = queryMetadataLockHolders
+}
+
+func (s *ddlGuardSuite) TestTimeout(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+	calls := s.mockHolders(c)
+
+	ld := &loaderImpl{db: db, opts: options{ddlTimeout: 50 * time.Millisecond}}
+	ddl := &DDL{Database: "test", Table: "t", SQL: "alter table t add column c int"}
+
+	for _, version := range []string{"5.7.25", "5.7.25-TiDB-v5.0.0"} {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT CONNECTION_ID(), VERSION()")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(42, version))
+		mock.ExpectBegin()
+		mock.ExpectExec("use `test`;").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("alter table t add column c int").WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(0, 0))
+		// the query is killed by KILL TIDB QUERY on TiDB.
+		if strings.Contains(version, "TiDB") {
+			mock.ExpectExec("KILL TIDB QUERY 42").WillReturnResult(sqlmock.NewResult(0, 0))
+		} else {
+			mock.ExpectExec("KILL QUERY 42").WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+
+		err = ld.execDDLWithGuard(context.Background(), ddl)
+		c.Assert(err, check.ErrorMatches, "exec ddl timeout after 50ms.*")
+		c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+	}
+	// the metadata locks aren't checked on TiDB without performance_schema.
+	c.Assert(atomic.LoadInt32(calls), check.Equals, int32(1))
+}
+
+func (s *ddlGuardSuite) TestBlocked(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+	calls := s.mockHolders(c)
+
+	ld := &loaderImpl{db: db, opts: options{ddlBlockCheckInterval: 20 * time.Millisecond}}
+	ddl := &DDL{Database: "test", Table: "t", SQL: "alter table t add column c int"}
+
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT CONNECTION_ID(), VERSION()")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(42, "5.7.25"))
+	mock.ExpectBegin()
+	mock.ExpectExec("use `test`;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("alter table t add column c int").WillDelayFor(200 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT STATE FROM information_schema.PROCESSLIST").WithArgs(42).
+		WillReturnRows(sqlmock.NewRows([]string{"STATE"}).AddRow("Waiting for table metadata lock"))
+
+	err = ld.execDDLWithGuard(context.Background(), ddl)
+	c.Assert(err, check.IsNil)
+	// checked before executing and when the DDL is blocked
+	c.Assert(atomic.LoadInt32(calls), check.Equals, int32(2))
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *ddlGuardSuite) TestIsWaitingForMetadataLock(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT STATE FROM information_schema.PROCESSLIST").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"STATE"}).AddRow("altering table"))
+	mock.ExpectQuery("SELECT STATE FROM information_schema.PROCESSLIST").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"STATE"}))
+
+	for i := 0; i < 2; i++ {
+		waiting, err := isWaitingForMetadataLock(context.Background(), db, 1)
+		c.Assert(err, check.IsNil)
+		c.Assert(waiting, check.IsFalse)
+	}
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
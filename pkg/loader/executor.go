@@ -26,6 +26,7 @@ import (
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/retry"
 	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/prometheus/client_golang/prometheus"
@@ -39,13 +40,41 @@ var (
 	index              int64
 )
 
+// The actions after a DML statement is killed for timeout.
+const (
+	// StatementTimeoutRetry retries the DMLs like the other errors.
+	StatementTimeoutRetry = "retry"
+	// StatementTimeoutError fails the DMLs at once without retrying.
+	StatementTimeoutError = "error"
+)
+
+// errStatementTimeout is the cause of the errors of the DML statements killed for timeout.
+var errStatementTimeout = errors.New("statement timeout")
+
+func isStatementTimeout(err error) bool {
+	return errors.Cause(err) == errStatementTimeout
+}
+
 type executor struct {
 	db                *gosql.DB
 	batchSize         int
 	workerCount       int
 	info              *loopbacksync.LoopBackSync
 	queryHistogramVec *prometheus.HistogramVec
+	retryCounter      prometheus.Counter
+	retryCallback     func()
 	refreshTableInfo  func(schema string, table string) (info *tableInfo, err error)
+	isolation         gosql.IsolationLevel
+
+	// stmtTimeout is the timeout of executing a statement, zero means no timeout.
+	stmtTimeout        time.Duration
+	stmtTimeoutAction  string
+	killDB             *gosql.DB
+	killedQueryCounter prometheus.Counter
+
+	// upsertTables returns whether the rows of the table are written by INSERT ... ON DUPLICATE KEY UPDATE
+	// instead of REPLACE, nil if REPLACE is used for all the tables.
+	upsertTables func(schema, table string) bool
 }
 
 func newExecutor(db *gosql.DB) *executor {
@@ -68,6 +97,31 @@ func (e *executor) withBatchSize(batchSize int) *executor {
 	return e
 }
 
+func (e *executor) withIsolation(level gosql.IsolationLevel) *executor {
+	e.isolation = level
+	return e
+}
+
+// withStatementTimeout kills the statements by KILL QUERY on killDB if they don't finish in timeout.
+func (e *executor) withStatementTimeout(timeout time.Duration, action string, killDB *gosql.DB, killedQueryCounter prometheus.Counter) *executor {
+	e.stmtTimeout = timeout
+	e.stmtTimeoutAction = action
+	e.killDB = killDB
+	e.killedQueryCounter = killedQueryCounter
+	return e
+}
+
+// withUpsertTables writes the rows of the tables matched by fn with INSERT ... ON DUPLICATE KEY UPDATE
+// instead of REPLACE, so the columns only in downstream aren't reset to their defaults.
+func (e *executor) withUpsertTables(fn func(schema, table string) bool) *executor {
+	e.upsertTables = fn
+	return e
+}
+
+func (e *executor) upsert(dml *DML) bool {
+	return e.upsertTables != nil && e.upsertTables(dml.Database, dml.Table)
+}
+
 func (e *executor) setSyncInfo(info *loopbacksync.LoopBackSync) {
 	e.info = info
 }
@@ -81,8 +135,60 @@ func (e *executor) withQueryHistogramVec(queryHistogramVec *prometheus.Histogram
 	return e
 }
 
+func (e *executor) withRetryCounter(retryCounter prometheus.Counter) *executor {
+	e.retryCounter = retryCounter
+	return e
+}
+
+func (e *executor) withRetryCallback(cb func()) *executor {
+	e.retryCallback = cb
+	return e
+}
+
+// countRetry wraps fn to count the calls after the first one as retries.
+func countRetry(counter prometheus.Counter, fn func(context.Context) error) func(context.Context) error {
+	if counter == nil {
+		return fn
+	}
+	return onRetry(counter.Inc, fn)
+}
+
+// onRetry wraps fn to call cb before each call after the first one.
+func onRetry(cb func(), fn func(context.Context) error) func(context.Context) error {
+	var attempts int
+	return func(ctx context.Context) error {
+		if attempts++; attempts > 1 {
+			cb()
+		}
+		return fn(ctx)
+	}
+}
+
+// countRetry wraps fn to count the retries by the retry counter and callback.
+func (e *executor) countRetry(fn func(context.Context) error) func(context.Context) error {
+	if e.retryCallback != nil {
+		fn = onRetry(e.retryCallback, fn)
+	}
+	return countRetry(e.retryCounter, fn)
+}
+
+// retry calls fn like util.RetryContext, and the statements killed for timeout aren't retried
+// if the action is StatementTimeoutError.
+func (e *executor) retry(ctx context.Context, retryNum int, backoff time.Duration, fn func(context.Context) error) error {
+	if e.stmtTimeoutAction != StatementTimeoutError {
+		return util.RetryContext(ctx, retryNum, backoff, 1, e.countRetry(fn))
+	}
+	if retryNum <= 0 {
+		return nil
+	}
+	policy := retry.NewPolicy(retryNum, backoff, 1).WithRetryable(func(err error) bool {
+		return !isStatementTimeout(err)
+	})
+	return policy.Do(ctx, e.countRetry(fn))
+}
+
 func (e *executor) execTableBatchRetry(ctx context.Context, dmls []*DML, retryNum int, backoff time.Duration) error {
-	err := util.RetryContext(ctx, retryNum, backoff, 1, func(context.Context) error {
+	err := e.retry(ctx, retryNum, backoff, func(context.Context) error {
 		return e.execTableBatch(ctx, dmls)
 	})
 	return errors.Trace(err)
@@ -92,12 +198,26 @@ func (e *executor) execTableBatchRetry(ctx context.Context, dmls []*DML, retryNu
 type tx struct {
 	*gosql.Tx
 	queryHistogramVec *prometheus.HistogramVec
+
+	// the statements are killed by KILL QUERY connID, or KILL TIDB QUERY connID on TiDB, on killDB
+	// if timeout > 0.
+	timeout            time.Duration
+	connID             int64
+	tidb               bool
+	killDB             *gosql.DB
+	killedQueryCounter prometheus.Counter
 }
 
 // wrap of sql.Tx.Exec()
 func (tx *tx) exec(query string, args ...interface{}) (gosql.Result, error) {
 	start := time.Now()
-	res, err := tx.Tx.Exec(query, args...)
+	var res gosql.Result
+	var err error
+	if tx.timeout > 0 {
+		res, err = tx.execWithTimeout(query, args...)
+	} else {
+		res, err = tx.Tx.Exec(query, args...)
+	}
 	if tx.queryHistogramVec != nil {
 		tx.queryHistogramVec.WithLabelValues("exec").Observe(time.Since(start).Seconds())
 	}
@@ -105,6 +225,44 @@ func (tx *tx) exec(query string, args ...interface{}) (gosql.Result, error) {
 	return res, err
 }
 
+// execWithTimeout kills the statement if it doesn't finish in the timeout, and stops waiting
+// for it after another timeout in case the kill doesn't work, so a hung statement in downstream
+// doesn't block the worker forever.
+func (tx *tx) execWithTimeout(query string, args ...interface{}) (gosql.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*tx.timeout)
+	defer cancel()
+
+	killed := make(chan struct{})
+	timer := time.AfterFunc(tx.timeout, func() {
+		defer close(killed)
+		tx.kill()
+	})
+	res, err := tx.Tx.ExecContext(ctx, query, args...)
+	if timer.Stop() {
+		return res, err
+	}
+	// wait for the kill, or it may kill the next statement of the connection.
+	<-killed
+	if err != nil {
+		return nil, errors.Annotatef(errStatementTimeout, "exec timeout after %s, connection id: %d, error: %v", tx.timeout, tx.connID, err)
+	}
+	return res, nil
+}
+
+func (tx *tx) kill() {
+	ctx, cancel := context.WithTimeout(context.Background(), tx.timeout)
+	defer cancel()
+
+	log.Warn("kill the timeout statement", zap.Int64("connection id", tx.connID), zap.Duration("timeout", tx.timeout))
+	if _, err := tx.killDB.ExecContext(ctx, killQuerySQL(tx.connID, tx.tidb)); err != nil {
+		log.Warn("kill the timeout statement failed", zap.Int64("connection id", tx.connID), zap.Error(err))
+		return
+	}
+	if tx.killedQueryCounter != nil {
+		tx.killedQueryCounter.Inc()
+	}
+}
+
 func (tx *tx) autoRollbackExec(query string, args ...interface{}) (res gosql.Result, err error) {
 	res, err = tx.exec(query, args...)
 	if err != nil {
@@ -134,7 +292,7 @@ func (e *executor) addIndex() int64 {
 
 // return a wrap of sql.Tx
 func (e *executor) begin() (*tx, error) {
-	sqlTx, err := e.db.Begin()
+	sqlTx, err := e.db.BeginTx(context.Background(), &gosql.TxOptions{Isolation: e.isolation})
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -144,6 +302,20 @@ func (e *executor) begin() (*tx, error) {
 		queryHistogramVec: e.queryHistogramVec,
 	}
 
+	if e.stmtTimeout > 0 {
+		var version string
+		if err = sqlTx.QueryRow("SELECT CONNECTION_ID(), VERSION()").Scan(&tx.connID, &version); err != nil {
+			if rerr := tx.Rollback(); rerr != nil {
+				log.Error("fail to rollback", zap.Error(rerr))
+			}
+			return nil, errors.Annotate(err, "failed to query connection id")
+		}
+		tx.tidb = strings.Contains(version, tidbVersionMark)
+		tx.timeout = e.stmtTimeout
+		tx.killDB = e.killDB
+		tx.killedQueryCounter = e.killedQueryCounter
+	}
+
 	if e.info != nil && e.info.LoopbackControl {
 		start := time.Now()
 
@@ -231,6 +403,56 @@ func (e *executor) bulkReplace(inserts []*DML) error {
 	return errors.Trace(err)
 }
 
+// bulkUpsert writes the rows by INSERT ... ON DUPLICATE KEY UPDATE of the columns in their values, the rows
+// with different columns, like the ones before and after a column is added, are written by separate statements.
+func (e *executor) bulkUpsert(inserts []*DML) error {
+	if len(inserts) == 0 {
+		return nil
+	}
+
+	var groups [][]*DML
+	groupByColumns := make(map[string]int)
+	for _, insert := range inserts {
+		key := buildColumnList(insert.columnNames())
+		i, ok := groupByColumns[key]
+		if !ok {
+			i = len(groups)
+			groupByColumns[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], insert)
+	}
+
+	tx, err := e.begin()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, group := range groups {
+		names := group[0].columnNames()
+
+		var builder strings.Builder
+		builder.WriteString("INSERT INTO " + group[0].TableName() + "(" + buildColumnList(names) + ") VALUES ")
+		holder := fmt.Sprintf("(%s)", holderString(len(names)))
+		args := make([]interface{}, 0, len(group)*len(names))
+		for i, insert := range group {
+			if i > 0 {
+				builder.WriteByte(',')
+			}
+			builder.WriteString(holder)
+			for _, name := range names {
+				args = append(args, insert.Values[name])
+			}
+		}
+		builder.WriteString(" ON DUPLICATE KEY UPDATE " + buildUpsertList(names))
+
+		if _, err = tx.autoRollbackExec(builder.String(), args...); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	err = tx.commit()
+	return errors.Trace(err)
+}
+
 // we merge dmls by primary key, after merge by key, we
 // have only one dml for one primary key which contains the newest value(like a kv store),
 // to avoid other column's duplicate entry, we should apply delete dmls first, then insert&update
@@ -255,14 +477,19 @@ func (e *executor) execTableBatch(ctx context.Context, dmls []*DML) error {
 		}
 	}
 
+	bulkWrite := e.bulkReplace
+	if e.upsert(dmls[0]) {
+		bulkWrite = e.bulkUpsert
+	}
+
 	if allInserts, ok := types[InsertDMLType]; ok {
-		if err := e.splitExecDML(ctx, allInserts, e.bulkReplace); err != nil {
+		if err := e.splitExecDML(ctx, allInserts, bulkWrite); err != nil {
 			return errors.Trace(err)
 		}
 	}
 
 	if allUpdates, ok := types[UpdateDMLType]; ok {
-		if err := e.splitExecDML(ctx, allUpdates, e.bulkReplace); err != nil {
+		if err := e.splitExecDML(ctx, allUpdates, bulkWrite); err != nil {
 			return errors.Trace(err)
 		}
 	}
@@ -304,7 +531,7 @@ func tryRefreshTableErr(err error) bool {
 
 func (e *executor) singleExecRetry(ctx context.Context, allDMLs []*DML, safeMode bool, retryNum int, backoff time.Duration) error {
 	for _, dmls := range splitDMLs(allDMLs, e.batchSize) {
-		err := util.RetryContext(ctx, retryNum, backoff, 1, func(context.Context) error {
+		err := e.retry(ctx, retryNum, backoff, func(context.Context) error {
 			execErr := e.singleExec(dmls, safeMode)
 			if execErr == nil {
 				return nil
@@ -352,7 +579,23 @@ func (e *executor) singleExec(dmls []*DML, safeMode bool) error {
 	}
 
 	for _, dml := range dmls {
-		if safeMode && dml.Tp == UpdateDMLType {
+		if safeMode && e.upsert(dml) && (dml.Tp == UpdateDMLType || dml.Tp == InsertDMLType) {
+			// the old row is only deleted if the key is updated, so the row updated in place keeps
+			// the columns not in the values.
+			if dml.Tp == UpdateDMLType && dml.updateKey() {
+				sql, args := dml.deleteSQL()
+				_, err := tx.autoRollbackExec(sql, args...)
+				if err != nil {
+					return errors.Trace(err)
+				}
+			}
+
+			sql, args := dml.upsertSQL()
+			_, err := tx.autoRollbackExec(sql, args...)
+			if err != nil {
+				return errors.Trace(err)
+			}
+		} else if safeMode && dml.Tp == UpdateDMLType {
 			sql, args := dml.deleteSQL()
 			_, err := tx.autoRollbackExec(sql, args...)
 			if err != nil {
@@ -18,7 +18,9 @@ import (
 	"database/sql"
 	"fmt"
 	"regexp"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-sql-driver/mysql"
@@ -26,6 +28,7 @@ import (
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 type executorSuite struct{}
@@ -219,6 +222,74 @@ func (s *singleExecSuite) TestSafeUpdate(c *C) {
 	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
 }
 
+func (s *singleExecSuite) TestSafeUpsert(c *C) {
+	dml := DML{
+		Database: "unicorn",
+		Table:    "users",
+		Tp:       UpdateDMLType,
+		OldValues: map[string]interface{}{
+			"id":  1,
+			"age": 1999,
+		},
+		Values: map[string]interface{}{
+			"id":  1,
+			"age": 2019,
+		},
+		info: &tableInfo{
+			columns:    []string{"id", "age", "note"},
+			uniqueKeys: []indexInfo{{name: "PRIMARY", columns: []string{"id"}}},
+		},
+	}
+	dml.info.primaryKey = &dml.info.uniqueKeys[0]
+	upsertSQL := "INSERT INTO `unicorn`.`users`(`age`,`id`) VALUES(?,?) ON DUPLICATE KEY UPDATE `age`=VALUES(`age`),`id`=VALUES(`id`)"
+	upsertTables := func(schema, table string) bool {
+		return schema == "unicorn" && table == "users"
+	}
+
+	// the row is updated in place if the key isn't updated.
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec(regexp.QuoteMeta(upsertSQL)).
+		WithArgs(2019, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectCommit()
+
+	e := newExecutor(s.db).withUpsertTables(upsertTables)
+	err := e.singleExec([]*DML{&dml}, true)
+	c.Assert(err, IsNil)
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+
+	s.resetMock(c)
+
+	// the old row is deleted if the key is updated.
+	dml.Values["id"] = 2
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec("DELETE FROM `unicorn`.`users`.*").
+		WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectExec(regexp.QuoteMeta(upsertSQL)).
+		WithArgs(2019, 2).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectCommit()
+
+	e = newExecutor(s.db).withUpsertTables(upsertTables)
+	err = e.singleExec([]*DML{&dml}, true)
+	c.Assert(err, IsNil)
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+
+	s.resetMock(c)
+
+	// REPLACE is used for the other tables.
+	dml.Table = "others"
+	s.dbMock.ExpectBegin()
+	s.dbMock.ExpectExec("DELETE FROM `unicorn`.`others`.*").
+		WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectExec(regexp.QuoteMeta("REPLACE INTO `unicorn`.`others`(`age`,`id`) VALUES(?,?)")).
+		WithArgs(2019, 2).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.dbMock.ExpectCommit()
+
+	e = newExecutor(s.db).withUpsertTables(upsertTables)
+	err = e.singleExec([]*DML{&dml}, true)
+	c.Assert(err, IsNil)
+	c.Assert(s.dbMock.ExpectationsWereMet(), IsNil)
+}
+
 type bulkDelSuite struct{}
 
 var _ = Suite(&bulkDelSuite{})
@@ -313,3 +384,113 @@ func (s *bulkReplaceSuite) TestReplaceInBulk(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(mock.ExpectationsWereMet(), IsNil)
 }
+
+func (s *bulkReplaceSuite) TestUpsertInBulk(c *C) {
+	var dmls []*DML
+	for i := 0; i < 3; i++ {
+		dml := DML{
+			Database: "d",
+			Table:    "t",
+			Tp:       InsertDMLType,
+			Values: map[string]interface{}{
+				"a": fmt.Sprintf("a_%d", i),
+				"b": fmt.Sprintf("b_%d", i),
+			},
+			info: &tableInfo{
+				columns: []string{"a", "b", "c"},
+			},
+		}
+		dmls = append(dmls, &dml)
+	}
+	// the row before column b is added.
+	delete(dmls[1].Values, "b")
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	mock.ExpectBegin()
+	sql := "INSERT INTO `d`.`t`(`a`,`b`) VALUES (?,?),(?,?) ON DUPLICATE KEY UPDATE `a`=VALUES(`a`),`b`=VALUES(`b`)"
+	mock.ExpectExec(regexp.QuoteMeta(sql)).
+		WithArgs("a_0", "b_0", "a_2", "b_2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	sql = "INSERT INTO `d`.`t`(`a`) VALUES (?) ON DUPLICATE KEY UPDATE `a`=VALUES(`a`)"
+	mock.ExpectExec(regexp.QuoteMeta(sql)).
+		WithArgs("a_1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	e := newExecutor(db)
+	err = e.bulkUpsert(dmls)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+type stmtTimeoutSuite struct{}
+
+var _ = Suite(&stmtTimeoutSuite{})
+
+func (s *stmtTimeoutSuite) TestKillTimeoutStatement(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	killDB, killMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	killed := prometheus.NewCounter(prometheus.CounterOpts{Name: "killed"})
+
+	dml := &DML{
+		Database: "unicorn",
+		Table:    "users",
+		Tp:       InsertDMLType,
+		Values:   map[string]interface{}{"name": "tester"},
+		info:     &tableInfo{columns: []string{"name"}},
+	}
+	e := newExecutor(db).withStatementTimeout(50*time.Millisecond, StatementTimeoutError, killDB, killed)
+
+	for _, version := range []string{"5.7.25", "5.7.25-TiDB-v5.0.0"} {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT CONNECTION_ID(), VERSION()")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(42, version))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `unicorn`.`users`(`name`) VALUES(?)")).
+			WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectRollback()
+		// KILL QUERY is ignored by TiDB unless compatible-kill-query is set.
+		if strings.Contains(version, "TiDB") {
+			killMock.ExpectExec(regexp.QuoteMeta("KILL TIDB QUERY 42")).WillReturnResult(sqlmock.NewResult(0, 0))
+		} else {
+			killMock.ExpectExec(regexp.QuoteMeta("KILL QUERY 42")).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+
+		// the killed statement isn't retried with StatementTimeoutError.
+		err = e.singleExecRetry(context.Background(), []*DML{dml}, false, 3, time.Millisecond)
+		c.Assert(isStatementTimeout(err), IsTrue)
+		c.Assert(err, ErrorMatches, "exec timeout after 50ms, connection id: 42.*")
+		c.Assert(mock.ExpectationsWereMet(), IsNil)
+		c.Assert(killMock.ExpectationsWereMet(), IsNil)
+	}
+
+	metric := &dto.Metric{}
+	c.Assert(killed.Write(metric), IsNil)
+	c.Assert(metric.GetCounter().GetValue(), Equals, float64(2))
+}
+
+func (s *stmtTimeoutSuite) TestRetryTimeoutStatement(c *C) {
+	e := newExecutor(nil).withStatementTimeout(time.Second, StatementTimeoutRetry, nil, nil)
+	var calls int
+	err := e.retry(context.Background(), 3, time.Millisecond, func(context.Context) error {
+		calls++
+		return errors.Trace(errStatementTimeout)
+	})
+	c.Assert(isStatementTimeout(err), IsTrue)
+	c.Assert(calls, Equals, 3)
+
+	e.stmtTimeoutAction = StatementTimeoutError
+	calls = 0
+	err = e.retry(context.Background(), 3, time.Millisecond, func(context.Context) error {
+		calls++
+		if calls == 1 {
+			return errors.New("other")
+		}
+		return errors.Trace(errStatementTimeout)
+	})
+	c.Assert(isStatementTimeout(err), IsTrue)
+	c.Assert(calls, Equals, 2)
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -74,9 +75,16 @@ type loaderImpl struct {
 
 	tableInfos sync.Map
 
+	// tuneMu protects batchSize, workerCount, markRows and tuneStats, the batchSize and
+	// workerCount may be changed at runtime.
+	tuneMu      sync.Mutex
+	tuneStats   tuneStats
 	batchSize   int
 	workerCount int
-	syncMode    SyncMode
+	// markRows is the number of the mark rows created for loopback sync, every worker updates
+	// the mark row of its index, so it's raised with workerCount and never reduced.
+	markRows int
+	syncMode SyncMode
 
 	loopBackSyncInfo *loopbacksync.LoopBackSync
 
@@ -108,6 +116,23 @@ type MetricsGroup struct {
 	EventCounterVec   *prometheus.CounterVec
 	QueryHistogramVec *prometheus.HistogramVec
 	QueueSizeGauge    *prometheus.GaugeVec
+	// DDLBroadcastFailureCounterVec counts the failed DDLs of each shard when
+	// the DDLs are broadcast to the shards.
+	DDLBroadcastFailureCounterVec *prometheus.CounterVec
+	// DDLBlockedGauge is the seconds the executing DDL has been waiting for metadata locks.
+	DDLBlockedGauge prometheus.Gauge
+	// WorkerBusySecondsCounterVec is the seconds each worker spends executing
+	// DMLs, labeled by worker, its rate is the busy ratio of the worker.
+	WorkerBusySecondsCounterVec *prometheus.CounterVec
+	// QueueWaitHistogram is the seconds a txn waits in the loader before executed.
+	QueueWaitHistogram prometheus.Histogram
+	// ConflictStallHistogram is the seconds the DMLs wait for the DMLs before
+	// them to be executed when a causality conflict is detected.
+	ConflictStallHistogram prometheus.Histogram
+	// RetryCounterVec counts the retries of executing DMLs and DDLs, labeled by type.
+	RetryCounterVec *prometheus.CounterVec
+	// KilledQueryCounter counts the DML statements killed for timeout.
+	KilledQueryCounter prometheus.Counter
 }
 
 // SyncMode represents the sync mode of DML.
@@ -129,6 +154,31 @@ type options struct {
 	enableDispatch   bool
 	enableCausality  bool
 	merge            bool
+	tableShardCount  int
+	ddlBroadcast     map[string][]string
+	keepDDLComments  bool
+
+	blockSchemaMoveDDL bool
+
+	failedTxnHandler func(txn *Txn, err error) error
+
+	ddlTimeout            time.Duration
+	ddlBlockCheckInterval time.Duration
+	ddlDB                 *gosql.DB
+	onlineSchemaChange    string
+
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	isolation       gosql.IsolationLevel
+
+	stmtTimeout       time.Duration
+	stmtTimeoutAction string
+	killDB            *gosql.DB
+
+	autoTune *AutoTuneConfig
+
+	upsertTables func(schema, table string) bool
 }
 
 var defaultLoaderOptions = options{
@@ -141,6 +191,7 @@ var defaultLoaderOptions = options{
 	enableDispatch:   true,
 	enableCausality:  true,
 	merge:            false,
+	tableShardCount:  1,
 }
 
 // A Option sets options such batch size, worker count etc.
@@ -191,7 +242,153 @@ func Merge(v bool) Option {
 	}
 }
 
-//SetloopBackSyncInfo set loop back sync info of loader
+// TableShardCount set the count of shards the DMLs of a table are split into by
+// the hash of primary key when merge is enabled, the shards are executed concurrently.
+func TableShardCount(n int) Option {
+	return func(o *options) {
+		o.tableShardCount = n
+	}
+}
+
+// DDLBroadcast set the shards of the schemas in downstream, the DDLs of a
+// schema in the map are executed on all its shards instead of the schema itself.
+func DDLBroadcast(shards map[string][]string) Option {
+	return func(o *options) {
+		o.ddlBroadcast = make(map[string][]string, len(shards))
+		for schema, targets := range shards {
+			o.ddlBroadcast[strings.ToLower(schema)] = targets
+		}
+	}
+}
+
+// BlockSchemaMoveDDL set whether the DDLs moving tables into or out of the schemas
+// of DDLBroadcast fail instead of being routed to their shards, they're routed
+// by default if the schemas are broadcast to the same number of shards.
+func BlockSchemaMoveDDL(b bool) Option {
+	return func(o *options) {
+		o.blockSchemaMoveDDL = b
+	}
+}
+
+// FailedTxnHandler set the handler of the txns failed to load after retries, the loader
+// skips the txn and continues if the handler returns nil, like after saving the txn to fix
+// it later, or stops with the error returned. The txns of a failed batch of DMLs are
+// executed again one by one in safe mode to find out the failed ones, and the skipped txns
+// are still sent to Successes() so the checkpoint moves on.
+func FailedTxnHandler(h func(txn *Txn, err error) error) Option {
+	return func(o *options) {
+		o.failedTxnHandler = h
+	}
+}
+
+// UpsertTables set the tables whose rows are written by INSERT ... ON DUPLICATE KEY UPDATE of the columns
+// in the DMLs instead of REPLACE in safe mode and merge mode, fn returns whether the table is one of them.
+// REPLACE deletes the existing row and resets the columns not in the DML, like the columns only added in
+// downstream, to their defaults, while the upsert keeps them. The upsert updates the row conflicting on
+// any unique key in place instead of deleting all the conflicting rows like REPLACE.
+func UpsertTables(fn func(schema, table string) bool) Option {
+	return func(o *options) {
+		o.upsertTables = fn
+	}
+}
+
+// KeepDDLComments keeps the leading comments of the DDLs rewritten by the
+// loader, like the DDLs executed on the shards by DDLBroadcast.
+func KeepDDLComments(keep bool) Option {
+	return func(o *options) {
+		o.keepDDLComments = keep
+	}
+}
+
+// DDLTimeout set the timeout of executing a DDL, the DDL is killed and
+// retried if it's timeout, zero means no timeout.
+func DDLTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.ddlTimeout = d
+	}
+}
+
+// StatementTimeout set the timeout of executing a DML statement, the statement is killed by
+// KILL QUERY, or KILL TIDB QUERY on TiDB, on killDB if it's timeout, or on the db of the loader
+// if killDB is nil. KILL TIDB QUERY only works on the TiDB instance of the statement, so killDB
+// should reach the same instance. The DMLs are retried after the kill if action is
+// StatementTimeoutRetry, or fail at once if it's StatementTimeoutError. Zero means no timeout.
+// killDB is not closed by the loader.
+func StatementTimeout(d time.Duration, action string, killDB *gosql.DB) Option {
+	return func(o *options) {
+		o.stmtTimeout = d
+		o.stmtTimeoutAction = action
+		o.killDB = killDB
+	}
+}
+
+// DDLBlockCheckInterval set the interval of checking whether the executing
+// DDL is blocked by metadata locks, zero disables the check.
+func DDLBlockCheckInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.ddlBlockCheckInterval = d
+	}
+}
+
+// DDLDB set the db the DDLs are executed on instead of the db of the loader, so
+// the long DDLs don't occupy the connections of the DML workers. The db is
+// not closed by the loader.
+func DDLDB(db *gosql.DB) Option {
+	return func(o *options) {
+		o.ddlDB = db
+	}
+}
+
+// OnlineSchemaChange set the shell command executing the ALTER TABLE DDLs
+// instead of downstream, like pt-online-schema-change or gh-ost. The schema,
+// the table and the alter specs are passed by the environment variables
+// DDL_DATABASE, DDL_TABLE and DDL_ALTER, and the whole DDL by DDL_SQL.
+func OnlineSchemaChange(command string) Option {
+	return func(o *options) {
+		o.onlineSchemaChange = command
+	}
+}
+
+// ConnPool set the limits of the connection pool of db, the zero values keep the defaults:
+// maxOpen and maxIdle are the worker count, and the connections are reused forever.
+// Set maxLifetime shorter than the idle timeout of the load balancers in front of
+// downstream, which may drop the long-lived connections silently.
+func ConnPool(maxOpen int, maxIdle int, maxLifetime time.Duration) Option {
+	return func(o *options) {
+		o.maxOpenConns = maxOpen
+		o.maxIdleConns = maxIdle
+		o.connMaxLifetime = maxLifetime
+	}
+}
+
+// IsolationLevel set the isolation level of the transactions executing DMLs.
+func IsolationLevel(level gosql.IsolationLevel) Option {
+	return func(o *options) {
+		o.isolation = level
+	}
+}
+
+// ParseIsolationLevel parses the isolation level like "READ-COMMITTED" or "read committed",
+// the empty string is the default level of downstream.
+func ParseIsolationLevel(s string) (gosql.IsolationLevel, error) {
+	name := strings.ToUpper(strings.NewReplacer("-", " ", "_", " ").Replace(strings.TrimSpace(s)))
+	switch name {
+	case "":
+		return gosql.LevelDefault, nil
+	case "READ UNCOMMITTED":
+		return gosql.LevelReadUncommitted, nil
+	case "READ COMMITTED":
+		return gosql.LevelReadCommitted, nil
+	case "REPEATABLE READ":
+		return gosql.LevelRepeatableRead, nil
+	case "SERIALIZABLE":
+		return gosql.LevelSerializable, nil
+	default:
+		return gosql.LevelDefault, errors.Errorf("unknown isolation level %s", s)
+	}
+}
+
+// SetloopBackSyncInfo set loop back sync info of loader
 func SetloopBackSyncInfo(loopBackSyncInfo *loopbacksync.LoopBackSync) Option {
 	return func(o *options) {
 		o.loopBackSyncInfo = loopBackSyncInfo
@@ -249,12 +446,28 @@ func NewLoader(db *gosql.DB, opt ...Option) (Loader, error) {
 		cancel: cancel,
 	}
 
-	db.SetMaxOpenConns(opts.workerCount)
-	db.SetMaxIdleConns(opts.workerCount)
+	s.resizeConnPool(opts.workerCount)
+	if opts.connMaxLifetime > 0 {
+		db.SetConnMaxLifetime(opts.connMaxLifetime)
+	}
 
 	return s, nil
 }
 
+// resizeConnPool sets the size of the connection pool by the worker count,
+// unless it's set by ConnPool.
+func (s *loaderImpl) resizeConnPool(workerCount int) {
+	maxOpen, maxIdle := workerCount, workerCount
+	if s.opts.maxOpenConns > 0 {
+		maxOpen = s.opts.maxOpenConns
+	}
+	if s.opts.maxIdleConns > 0 {
+		maxIdle = s.opts.maxIdleConns
+	}
+	s.db.SetMaxOpenConns(maxOpen)
+	s.db.SetMaxIdleConns(maxIdle)
+}
+
 func (s *loaderImpl) metricsInputTxn(txn *Txn) {
 	if s.metrics == nil || s.metrics.EventCounterVec == nil {
 		return
@@ -272,6 +485,34 @@ func (s *loaderImpl) metricsInputTxn(txn *Txn) {
 	}
 }
 
+func (s *loaderImpl) metricsQueueWait(txns ...*Txn) {
+	if s.metrics == nil || s.metrics.QueueWaitHistogram == nil {
+		return
+	}
+
+	now := time.Now()
+	for _, txn := range txns {
+		if !txn.inputTime.IsZero() {
+			s.metrics.QueueWaitHistogram.Observe(now.Sub(txn.inputTime).Seconds())
+		}
+	}
+}
+
+func (s *loaderImpl) metricsWorkerBusy(worker string, start time.Time) {
+	if s.metrics == nil || s.metrics.WorkerBusySecondsCounterVec == nil {
+		return
+	}
+	s.metrics.WorkerBusySecondsCounterVec.WithLabelValues(worker).Add(time.Since(start).Seconds())
+}
+
+// retryCounter returns the counter of retries of the type, or nil if it's not set.
+func (s *loaderImpl) retryCounter(tp string) prometheus.Counter {
+	if s.metrics == nil || s.metrics.RetryCounterVec == nil {
+		return nil
+	}
+	return s.metrics.RetryCounterVec.WithLabelValues(tp)
+}
+
 // SetSafeMode set safe mode
 func (s *loaderImpl) SetSafeMode(safe bool) {
 	if safe {
@@ -393,8 +634,27 @@ func (s *loaderImpl) execDDL(ddl *DDL) error {
 		return nil
 	}
 
-	err := util.RetryContext(s.ctx, maxDDLRetryCount, execDDLRetryWait, 1, func(context.Context) error {
-		tx, err := s.db.Begin()
+	err := util.RetryContext(s.ctx, maxDDLRetryCount, execDDLRetryWait, 1, countRetry(s.retryCounter("ddl"), func(ctx context.Context) error {
+		if len(s.opts.onlineSchemaChange) > 0 {
+			handled, err := s.execOnlineDDL(ctx, ddl)
+			if err != nil {
+				return err
+			}
+			if handled {
+				log.Info("exec ddl by online schema change success", zap.String("sql", ddl.SQL))
+				return nil
+			}
+		}
+
+		if s.ddlGuardEnabled() {
+			if err := s.execDDLWithGuard(ctx, ddl); err != nil {
+				return err
+			}
+			log.Info("exec ddl success", zap.String("sql", ddl.SQL))
+			return nil
+		}
+
+		tx, err := s.ddlConnDB().Begin()
 		if err != nil {
 			return err
 		}
@@ -422,7 +682,7 @@ func (s *loaderImpl) execDDL(ddl *DDL) error {
 
 		log.Info("exec ddl success", zap.String("sql", ddl.SQL))
 		return nil
-	})
+	}))
 
 	if err != nil && isSetTiFlashReplica(ddl.SQL) {
 		return nil
@@ -431,17 +691,39 @@ func (s *loaderImpl) execDDL(ddl *DDL) error {
 	return errors.Trace(err)
 }
 
+// execDDLOrBroadcast executes the DDL on the shards of its schema if the
+// schema is broadcast, or on the schema itself.
+func (s *loaderImpl) execDDLOrBroadcast(ddl *DDL) error {
+	if ddl.ShouldSkip {
+		return nil
+	}
+	routes, err := s.routeSchemaMove(ddl)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	shards, ok := s.opts.ddlBroadcast[strings.ToLower(ddl.Database)]
+	if len(routes) > 0 && !ok {
+		return errors.Errorf("can't route ddl moving tables between the broadcast schemas in %s which isn't broadcast, ddl: %s", ddl.Database, ddl.SQL)
+	}
+	if ok {
+		return errors.Trace(s.broadcastDDL(ddl, shards, routes))
+	}
+	return errors.Trace(s.execDDL(ddl))
+}
+
 func (s *loaderImpl) execByHash(executor *executor, byHash [][]*DML) error {
 	errg, _ := errgroup.WithContext(s.ctx)
 
-	for _, dmls := range byHash {
+	for i, dmls := range byHash {
 		if len(dmls) == 0 {
 			continue
 		}
 
 		dmls := dmls
+		worker := "worker_" + strconv.Itoa(i)
 
 		errg.Go(func() error {
+			defer s.metricsWorkerBusy(worker, time.Now())
 			err := executor.singleExecRetry(s.ctx, dmls, s.GetSafeMode(), maxDMLRetryCount, time.Second)
 			return err
 		})
@@ -455,7 +737,7 @@ func (s *loaderImpl) execByHash(executor *executor, byHash [][]*DML) error {
 func (s *loaderImpl) singleExec(executor *executor, dmls []*DML) error {
 	causality := NewCausality()
 
-	var byHash = make([][]*DML, s.workerCount)
+	var byHash = make([][]*DML, s.WorkerCount())
 
 	for _, dml := range dmls {
 		keys := getKeys(dml)
@@ -468,9 +750,13 @@ func (s *loaderImpl) singleExec(executor *executor, dmls []*DML) error {
 				log.Info("meet causality.DetectConflict exec now",
 					zap.String("table name", dml.TableName()),
 					zap.Strings("keys", keys))
+				start := time.Now()
 				if err := s.execByHash(executor, byHash); err != nil {
 					return errors.Trace(err)
 				}
+				if s.metrics != nil && s.metrics.ConflictStallHistogram != nil {
+					s.metrics.ConflictStallHistogram.Observe(time.Since(start).Seconds())
+				}
 
 				causality.Reset()
 				for i := 0; i < len(byHash); i++ {
@@ -529,6 +815,10 @@ func (s *loaderImpl) execDMLs(dmls []*DML) error {
 		}
 	}
 
+	defer func(start time.Time) {
+		s.observeBatch(len(dmls), time.Since(start))
+	}(time.Now())
+
 	batchTables, singleDMLs := s.groupDMLs(dmls)
 
 	executor := s.getExecutor()
@@ -538,6 +828,7 @@ func (s *loaderImpl) execDMLs(dmls []*DML) error {
 		// https://golang.org/doc/faq#closures_and_goroutines
 		dmls := dmls
 		errg.Go(func() error {
+			defer s.metricsWorkerBusy("table_batch", time.Now())
 			err := executor.execTableBatchRetry(s.ctx, dmls, maxDMLRetryCount, time.Second)
 			return err
 		})
@@ -553,11 +844,49 @@ func (s *loaderImpl) execDMLs(dmls []*DML) error {
 	return errors.Trace(err)
 }
 
+// handleFailedDMLs executes the DMLs of the txns txn by txn in safe mode after the batch
+// of them failed with batchErr, the txns still failed are passed to the failed txn handler.
+func (s *loaderImpl) handleFailedDMLs(txns []*Txn, batchErr error) error {
+	log.Warn("exec dmls failed, retry them txn by txn", zap.Int("txns", len(txns)), zap.Error(batchErr))
+
+	executor := s.getExecutor()
+	for _, txn := range txns {
+		err := s.execTxnSafely(executor, txn)
+		if err == nil {
+			continue
+		}
+		if err = s.opts.failedTxnHandler(txn, err); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func (s *loaderImpl) execTxnSafely(executor *executor, txn *Txn) error {
+	for _, dml := range txn.DMLs {
+		if err := s.setDMLInfo(dml); err != nil {
+			return errors.Trace(err)
+		}
+		filterGeneratedCols(dml)
+		if s.syncMode == SyncPartialColumn {
+			removeOrphanCols(dml.info, dml)
+		}
+	}
+	return errors.Trace(executor.singleExecRetry(s.ctx, txn.DMLs, true, maxDMLRetryCount, time.Second))
+}
+
 func (s *loaderImpl) initMarkTable() error {
 	if err := loopbacksync.CreateMarkTable(s.db); err != nil {
 		return errors.Trace(err)
 	}
-	return loopbacksync.InitMarkTableData(s.db, s.workerCount, s.loopBackSyncInfo.ChannelID)
+
+	s.tuneMu.Lock()
+	defer s.tuneMu.Unlock()
+	if err := loopbacksync.InitMarkTableData(s.db, s.workerCount, s.loopBackSyncInfo.ChannelID); err != nil {
+		return errors.Trace(err)
+	}
+	s.markRows = s.workerCount
+	return nil
 }
 
 // Run will quit when meet any error, or all the txn are drained
@@ -583,6 +912,12 @@ func (s *loaderImpl) Run() error {
 	txnManager := newTxnManager(100*1024 /* limit dml number */, s.input)
 	defer txnManager.Close()
 
+	if s.opts.autoTune != nil && s.opts.enableDispatch {
+		done := make(chan struct{})
+		defer close(done)
+		go s.autoTune(s.opts.autoTune, done)
+	}
+
 	batch := fNewBatchManager(s)
 	input := txnManager.run()
 
@@ -646,9 +981,50 @@ func (s *loaderImpl) groupDMLs(dmls []*DML) (batchByTbls map[string][]*DML, sing
 			singleDMLs = append(singleDMLs, dml)
 		}
 	}
+
+	if s.opts.tableShardCount > 1 {
+		sharded := make(map[string][]*DML, len(batchByTbls))
+		for tblName, tblDMLs := range batchByTbls {
+			for i, shard := range shardByPrimaryKey(tblDMLs, s.opts.tableShardCount) {
+				sharded[tblName+"#"+strconv.Itoa(i)] = shard
+			}
+		}
+		batchByTbls = sharded
+	}
 	return
 }
 
+// shardByPrimaryKey splits the DMLs of a table into at most n shards by the hash of
+// primary key, the DMLs linked by unique keys are put into the same shard by causality.
+// If some DML links DMLs already in different shards, the DMLs can't be split safely,
+// and all of them are returned as one shard.
+func shardByPrimaryKey(dmls []*DML, n int) [][]*DML {
+	causality := NewCausality()
+	shards := make([][]*DML, n)
+	for _, dml := range dmls {
+		keys := getKeys(dml)
+		if causality.DetectConflict(keys) {
+			log.Debug("unique keys conflict across shards, execute the table in one shard",
+				zap.String("table name", dml.TableName()), zap.Strings("keys", keys))
+			return [][]*DML{dmls}
+		}
+		if err := causality.Add(keys); err != nil {
+			return [][]*DML{dmls}
+		}
+
+		idx := int(genHashKey(causality.Get(keys[0]))) % n
+		shards[idx] = append(shards[idx], dml)
+	}
+
+	res := shards[:0]
+	for _, shard := range shards {
+		if len(shard) > 0 {
+			res = append(res, shard)
+		}
+	}
+	return res
+}
+
 func countEvents(dmls []*DML) (insertEvent float64, deleteEvent float64, updateEvent float64) {
 	for _, dml := range dmls {
 		switch dml.Tp {
@@ -683,25 +1059,47 @@ func filterGeneratedCols(dml *DML) {
 }
 
 func (s *loaderImpl) getExecutor() *executor {
-	e := newExecutor(s.db).withBatchSize(s.batchSize)
+	e := newExecutor(s.db).withBatchSize(s.BatchSize()).withIsolation(s.opts.isolation)
 	if s.syncMode == SyncPartialColumn {
 		e = e.withRefreshTableInfo(s.refreshTableInfo)
 	}
+	if s.opts.upsertTables != nil {
+		e = e.withUpsertTables(s.opts.upsertTables)
+	}
 	e.setSyncInfo(s.loopBackSyncInfo)
-	e.setWorkerCount(s.workerCount)
+	e.setWorkerCount(s.WorkerCount())
 	if s.metrics != nil && s.metrics.QueryHistogramVec != nil {
 		e = e.withQueryHistogramVec(s.metrics.QueryHistogramVec)
 	}
+	if retries := s.retryCounter("dml"); retries != nil {
+		e = e.withRetryCounter(retries)
+	}
+	if s.opts.autoTune != nil {
+		e = e.withRetryCallback(s.observeRetry)
+	}
+	if s.opts.stmtTimeout > 0 {
+		killDB := s.opts.killDB
+		if killDB == nil {
+			killDB = s.db
+		}
+		var killed prometheus.Counter
+		if s.metrics != nil {
+			killed = s.metrics.KilledQueryCounter
+		}
+		e = e.withStatementTimeout(s.opts.stmtTimeout, s.opts.stmtTimeoutAction, killDB, killed)
+	}
 	return e
 }
 
 func newBatchManager(s *loaderImpl) *batchManager {
-	return &batchManager{
-		limit:                s.batchSize * s.workerCount * execLimitMultiple,
+	b := &batchManager{
+		limit:                s.batchLimit(),
+		fLimit:               s.batchLimit,
 		enableDispatch:       s.opts.enableDispatch,
 		fExecDMLs:            s.execDMLs,
+		fExecStartCallback:   s.metricsQueueWait,
 		fDMLsSuccessCallback: s.markSuccess,
-		fExecDDL:             s.execDDL,
+		fExecDDL:             s.execDDLOrBroadcast,
 		fDDLSuccessCallback: func(txn *Txn) {
 			s.markSuccess(txn)
 			if txn.DDL.ShouldSkip {
@@ -714,6 +1112,11 @@ func newBatchManager(s *loaderImpl) *batchManager {
 			}
 		},
 	}
+	if s.opts.failedTxnHandler != nil {
+		b.fHandleFailedDMLs = s.handleFailedDMLs
+		b.fHandleFailedDDL = s.opts.failedTxnHandler
+	}
+	return b
 }
 
 type batchManager struct {
@@ -721,10 +1124,14 @@ type batchManager struct {
 	dmls                 []*DML
 	enableDispatch       bool
 	limit                int
+	fLimit               func() int
 	fExecDMLs            func([]*DML) error
+	fExecStartCallback   func(...*Txn)
 	fDMLsSuccessCallback func(...*Txn)
 	fExecDDL             func(*DDL) error
 	fDDLSuccessCallback  func(*Txn)
+	fHandleFailedDMLs    func([]*Txn, error) error
+	fHandleFailedDDL     func(*Txn, error) error
 }
 
 func (b *batchManager) execAccumulatedDMLs() (err error) {
@@ -732,8 +1139,16 @@ func (b *batchManager) execAccumulatedDMLs() (err error) {
 		return nil
 	}
 
+	if b.fExecStartCallback != nil {
+		b.fExecStartCallback(b.txns...)
+	}
 	if err := b.fExecDMLs(b.dmls); err != nil {
-		return errors.Trace(err)
+		if b.fHandleFailedDMLs == nil {
+			return errors.Trace(err)
+		}
+		if err = b.fHandleFailedDMLs(b.txns, err); err != nil {
+			return errors.Trace(err)
+		}
 	}
 
 	if b.fDMLsSuccessCallback != nil {
@@ -745,11 +1160,17 @@ func (b *batchManager) execAccumulatedDMLs() (err error) {
 }
 
 func (b *batchManager) execDDL(txn *Txn) error {
+	if b.fExecStartCallback != nil {
+		b.fExecStartCallback(txn)
+	}
 	if err := b.fExecDDL(txn.DDL); err != nil {
-		if !pkgsql.IgnoreDDLError(err) {
+		if pkgsql.IgnoreDDLError(err) {
+			log.Warn("ignore ddl", zap.Error(err), zap.String("ddl", txn.DDL.SQL))
+		} else if b.fHandleFailedDDL == nil {
+			return errors.Trace(err)
+		} else if err = b.fHandleFailedDDL(txn, err); err != nil {
 			return errors.Trace(err)
 		}
-		log.Warn("ignore ddl", zap.Error(err), zap.String("ddl", txn.DDL.SQL))
 	}
 
 	b.fDDLSuccessCallback(txn)
@@ -781,6 +1202,11 @@ func (b *batchManager) put(txn *Txn) error {
 	b.dmls = append(b.dmls, txn.DMLs...)
 	b.txns = append(b.txns, txn)
 
+	// the limit may be changed at runtime.
+	if b.fLimit != nil {
+		b.limit = b.fLimit()
+	}
+
 	// reach a limit size to exec or disable dispatch.
 	if len(b.dmls) >= b.limit || !b.enableDispatch {
 		if err := b.execAccumulatedDMLs(); err != nil {
@@ -833,6 +1259,7 @@ func (t *txnManager) run() chan *Txn {
 			case <-t.shutdown:
 				return
 			}
+			txn.inputTime = time.Now()
 			txnSize := len(txn.DMLs)
 
 			t.cond.L.Lock()
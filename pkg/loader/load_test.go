@@ -25,7 +25,10 @@ import (
 	"github.com/pingcap/check"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 )
 
 type LoadSuite struct {
@@ -155,6 +158,44 @@ func (cs *LoadSuite) TestOptions(c *check.C) {
 	c.Assert(o.saveAppliedTS, check.Equals, true)
 }
 
+func (cs *LoadSuite) TestConnPool(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	ld, err := NewLoader(db, WorkerCount(8), ConnPool(16, 0, time.Minute), IsolationLevel(sql.LevelReadCommitted))
+	c.Assert(err, check.IsNil)
+	c.Assert(db.Stats().MaxOpenConnections, check.Equals, 16)
+	c.Assert(ld.(*loaderImpl).getExecutor().isolation, check.Equals, sql.LevelReadCommitted)
+
+	// the pool isn't resized by the worker count if it's set.
+	c.Assert(ld.(*loaderImpl).SetWorkerCount(4), check.IsNil)
+	c.Assert(db.Stats().MaxOpenConnections, check.Equals, 16)
+
+	ld, err = NewLoader(db, WorkerCount(8))
+	c.Assert(err, check.IsNil)
+	c.Assert(db.Stats().MaxOpenConnections, check.Equals, 8)
+	c.Assert(ld.(*loaderImpl).SetWorkerCount(4), check.IsNil)
+	c.Assert(db.Stats().MaxOpenConnections, check.Equals, 4)
+}
+
+func (cs *LoadSuite) TestParseIsolationLevel(c *check.C) {
+	for s, expected := range map[string]sql.IsolationLevel{
+		"":                 sql.LevelDefault,
+		"READ-COMMITTED":   sql.LevelReadCommitted,
+		"read committed":   sql.LevelReadCommitted,
+		"repeatable_read":  sql.LevelRepeatableRead,
+		"READ-UNCOMMITTED": sql.LevelReadUncommitted,
+		"serializable":     sql.LevelSerializable,
+	} {
+		level, err := ParseIsolationLevel(s)
+		c.Assert(err, check.IsNil)
+		c.Assert(level, check.Equals, expected, check.Commentf("%s", s))
+	}
+	_, err := ParseIsolationLevel("snapshot")
+	c.Assert(err, check.ErrorMatches, "unknown isolation level snapshot")
+}
+
 func (cs *LoadSuite) TestGetExecutor(c *check.C) {
 	db, _, err := sqlmock.New()
 	c.Assert(err, check.IsNil)
@@ -172,6 +213,42 @@ func (cs *LoadSuite) TestGetExecutor(c *check.C) {
 	c.Assert(e.queryHistogramVec, check.NotNil)
 }
 
+func (cs *LoadSuite) TestMetrics(c *check.C) {
+	retries := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "retry"}, []string{"type"})
+	queueWait := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "queue_wait"})
+	busy := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "busy"}, []string{"worker"})
+	loader := &loaderImpl{metrics: &MetricsGroup{
+		RetryCounterVec:             retries,
+		QueueWaitHistogram:          queueWait,
+		WorkerBusySecondsCounterVec: busy,
+	}}
+
+	var calls int
+	err := util.RetryContext(context.Background(), 5, time.Millisecond, 1, countRetry(loader.retryCounter("dml"), func(context.Context) error {
+		if calls++; calls < 3 {
+			return errors.New("retry")
+		}
+		return nil
+	}))
+	c.Assert(err, check.IsNil)
+	c.Assert(testutil.ToFloat64(retries.WithLabelValues("dml")), check.Equals, float64(2))
+
+	loader.metricsQueueWait(&Txn{inputTime: time.Now().Add(-time.Second)}, &Txn{})
+	var m dto.Metric
+	c.Assert(queueWait.Write(&m), check.IsNil)
+	c.Assert(m.GetHistogram().GetSampleCount(), check.Equals, uint64(1))
+	c.Assert(m.GetHistogram().GetSampleSum() >= 1, check.IsTrue)
+
+	loader.metricsWorkerBusy("worker_0", time.Now().Add(-time.Second))
+	c.Assert(testutil.ToFloat64(busy.WithLabelValues("worker_0")) >= 1, check.IsTrue)
+
+	// no metrics
+	loader.metrics = nil
+	c.Assert(loader.retryCounter("dml"), check.IsNil)
+	loader.metricsQueueWait(&Txn{inputTime: time.Now()})
+	loader.metricsWorkerBusy("worker_0", time.Now())
+}
+
 func (cs *LoadSuite) TestCountEvents(c *check.C) {
 	dmls := []*DML{
 		{Tp: UpdateDMLType},
@@ -218,7 +295,7 @@ func (cs *LoadSuite) TestNewBatchManager(c *check.C) {
 	c.Assert(bm.limit, check.Equals, 30000)
 
 	c.Assert(reflect.ValueOf(bm.fExecDMLs).Pointer(), check.Equals, reflect.ValueOf(loader.execDMLs).Pointer())
-	c.Assert(reflect.ValueOf(bm.fExecDDL).Pointer(), check.Equals, reflect.ValueOf(loader.execDDL).Pointer())
+	c.Assert(reflect.ValueOf(bm.fExecDDL).Pointer(), check.Equals, reflect.ValueOf(loader.execDDLOrBroadcast).Pointer())
 }
 
 func (cs *LoadSuite) TestNewClose(c *check.C) {
@@ -297,6 +374,78 @@ func (s *groupDMLsSuite) TestGroupByTableName(c *check.C) {
 	c.Assert(single, check.HasLen, 2)
 }
 
+func (s *groupDMLsSuite) TestShardByPrimaryKey(c *check.C) {
+	ld := loaderImpl{merge: true, opts: options{tableShardCount: 4}}
+	info := &tableInfo{
+		columns:    []string{"id", "uk"},
+		uniqueKeys: []indexInfo{{name: "PRIMARY", columns: []string{"id"}}},
+	}
+	info.primaryKey = &info.uniqueKeys[0]
+	var dmls []*DML
+	for i := 0; i < 100; i++ {
+		dmls = append(dmls, &DML{
+			Database: "test",
+			Table:    "t",
+			Tp:       InsertDMLType,
+			Values:   map[string]interface{}{"id": i, "uk": i},
+			info:     info,
+		})
+	}
+	batch, single := ld.groupDMLs(dmls)
+	c.Assert(single, check.HasLen, 0)
+	c.Assert(len(batch), check.Greater, 1)
+	c.Assert(len(batch), check.LessEqual, 4)
+	total := 0
+	for name, shard := range batch {
+		c.Assert(name, check.Matches, "`test`.`t`#[0-3]")
+		total += len(shard)
+	}
+	c.Assert(total, check.Equals, 100)
+}
+
+func (s *groupDMLsSuite) TestShardByPrimaryKeyWithUniqueKey(c *check.C) {
+	info := &tableInfo{
+		columns: []string{"id", "uk"},
+		uniqueKeys: []indexInfo{
+			{name: "PRIMARY", columns: []string{"id"}},
+			{name: "uk", columns: []string{"uk"}},
+		},
+	}
+	info.primaryKey = &info.uniqueKeys[0]
+	newDML := func(tp DMLType, id, uk int) *DML {
+		return &DML{
+			Database: "test",
+			Table:    "t",
+			Tp:       tp,
+			Values:   map[string]interface{}{"id": id, "uk": uk},
+			info:     info,
+		}
+	}
+
+	// the rows linked by the unique key must be in the same shard
+	dmls := []*DML{
+		newDML(DeleteDMLType, 1, 10),
+		newDML(InsertDMLType, 2, 10),
+		newDML(InsertDMLType, 3, 30),
+	}
+	shards := shardByPrimaryKey(dmls, 1024)
+	var found bool
+	for _, shard := range shards {
+		if shard[0] == dmls[0] {
+			c.Assert(shard, check.HasLen, 2)
+			c.Assert(shard[1], check.Equals, dmls[1])
+			found = true
+		}
+	}
+	c.Assert(found, check.IsTrue)
+
+	// the last DML links the rows in different shards
+	dmls = append(dmls, newDML(InsertDMLType, 1, 30))
+	shards = shardByPrimaryKey(dmls, 1024)
+	c.Assert(shards, check.HasLen, 1)
+	c.Assert(shards[0], check.HasLen, 4)
+}
+
 type getTblInfoSuite struct{}
 
 var _ = check.Suite(&getTblInfoSuite{})
@@ -448,7 +597,7 @@ func (s *batchManagerSuite) TestShouldHandleDDLError(c *check.C) {
 
 func (s *batchManagerSuite) TestShouldExecAccumulatedDMLs(c *check.C) {
 	var executed []*DML
-	var calledback []*Txn
+	var calledback, started []*Txn
 	bm := batchManager{
 		limit:          3,
 		enableDispatch: true,
@@ -459,6 +608,9 @@ func (s *batchManagerSuite) TestShouldExecAccumulatedDMLs(c *check.C) {
 		fDMLsSuccessCallback: func(txns ...*Txn) {
 			calledback = append(calledback, txns...)
 		},
+		fExecStartCallback: func(txns ...*Txn) {
+			started = append(started, txns...)
+		},
 	}
 	var txns []*Txn
 	// Set up the number of DMLs so that only the first 3 txns get executed
@@ -475,10 +627,55 @@ func (s *batchManagerSuite) TestShouldExecAccumulatedDMLs(c *check.C) {
 	}
 	c.Assert(executed, check.HasLen, 5)
 	c.Assert(calledback, check.DeepEquals, txns[:3])
+	c.Assert(started, check.DeepEquals, txns[:3])
 	c.Assert(bm.dmls, check.HasLen, 2)
 	c.Assert(bm.txns, check.HasLen, 1)
 }
 
+func (s *batchManagerSuite) TestShouldHandleFailedTxns(c *check.C) {
+	var calledback, failed []*Txn
+	bm := batchManager{
+		limit:          2,
+		enableDispatch: true,
+		fExecDMLs: func(dmls []*DML) error {
+			return errors.New("DML")
+		},
+		fDMLsSuccessCallback: func(txns ...*Txn) {
+			calledback = append(calledback, txns...)
+		},
+		fExecDDL: func(ddl *DDL) error {
+			return errors.New("DDL")
+		},
+		fDDLSuccessCallback: func(t *Txn) {
+			calledback = append(calledback, t)
+		},
+		fHandleFailedDMLs: func(txns []*Txn, err error) error {
+			failed = append(failed, txns...)
+			return nil
+		},
+		fHandleFailedDDL: func(txn *Txn, err error) error {
+			if txn.DDL.SQL == "DROP" {
+				return err
+			}
+			failed = append(failed, txn)
+			return nil
+		},
+	}
+
+	// the failed txns are skipped and marked as success.
+	txns := []*Txn{{DMLs: []*DML{{}}}, {DMLs: []*DML{{}}}, {DDL: &DDL{Database: "test", SQL: "CREATE"}}}
+	for _, txn := range txns {
+		c.Assert(bm.put(txn), check.IsNil)
+	}
+	c.Assert(failed, check.DeepEquals, txns)
+	c.Assert(calledback, check.DeepEquals, txns)
+
+	// the error returned by the handler stops the loader.
+	err := bm.put(&Txn{DDL: &DDL{Database: "test", SQL: "DROP"}})
+	c.Assert(err, check.ErrorMatches, "DDL")
+	c.Assert(calledback, check.HasLen, 3)
+}
+
 type txnManagerSuite struct{}
 
 var _ = check.Suite(&txnManagerSuite{})
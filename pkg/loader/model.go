@@ -18,6 +18,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pingcap/log"
 	"go.uber.org/zap"
@@ -67,6 +68,9 @@ type Txn struct {
 	// This field is used to hold arbitrary data you wish to include so it
 	// will be available when receiving on the Successes channel
 	Metadata interface{}
+
+	// the time the txn is received by the loader
+	inputTime time.Time
 }
 
 // AppendDML append a dml
@@ -234,8 +238,12 @@ func (dml *DML) whereSlice() (colNames []string, args []interface{}) {
 		}
 	}
 
-	// Fallback to use all columns
+	// Fallback to use all columns, the old columns of the update since the new ones may carry
+	// the columns added by drainer, like the commit ts.
 	names := dml.columnNames()
+	if dml.Tp == UpdateDMLType {
+		names = dml.oldColumnNames()
+	}
 	return names, dml.whereValues(names)
 }
 
@@ -261,6 +269,17 @@ func (dml *DML) columnNames() []string {
 	return names
 }
 
+func (dml *DML) oldColumnNames() []string {
+	names := make([]string, 0, len(dml.OldValues))
+
+	for name := range dml.OldValues {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
 func (dml *DML) replaceSQL() (sql string, args []interface{}) {
 	names := dml.columnNames()
 	sql = fmt.Sprintf("REPLACE INTO %s(%s) VALUES(%s)", dml.TableName(), buildColumnList(names), holderString(len(names)))
@@ -277,6 +296,14 @@ func (dml *DML) insertSQL() (sql string, args []interface{}) {
 	return
 }
 
+// upsertSQL returns the INSERT ... ON DUPLICATE KEY UPDATE of the values, unlike REPLACE the existing
+// row is updated in place, so the columns not in the values, like the ones only in downstream, are kept.
+func (dml *DML) upsertSQL() (sql string, args []interface{}) {
+	sql, args = dml.insertSQL()
+	sql += " ON DUPLICATE KEY UPDATE " + buildUpsertList(dml.columnNames())
+	return
+}
+
 func (dml *DML) sql() (sql string, args []interface{}) {
 	switch dml.Tp {
 	case InsertDMLType:
@@ -318,6 +345,19 @@ func getKey(names []string, values map[string]interface{}) string {
 	return builder.String()
 }
 
+// getUniqueKey returns the key of the unique index, it's empty if any column
+// of the index is NULL. Like MySQL, a unique index doesn't constrain the rows
+// with NULL in it, so such rows never conflict with each other by the index.
+func getUniqueKey(names []string, values map[string]interface{}) string {
+	for _, name := range names {
+		if v, ok := values[name]; ok && v == nil {
+			return ""
+		}
+	}
+
+	return getKey(names, values)
+}
+
 func getKeys(dml *DML) (keys []string) {
 	info := dml.info
 
@@ -327,7 +367,7 @@ func getKeys(dml *DML) (keys []string) {
 	var addNewKey int
 
 	for _, index := range info.uniqueKeys {
-		key := getKey(index.columns, dml.Values)
+		key := getUniqueKey(index.columns, dml.Values)
 		if len(key) > 0 {
 			addNewKey++
 			keys = append(keys, key+tableName)
@@ -336,7 +376,7 @@ func getKeys(dml *DML) (keys []string) {
 
 	if dml.Tp == UpdateDMLType {
 		for _, index := range info.uniqueKeys {
-			key := getKey(index.columns, dml.OldValues)
+			key := getUniqueKey(index.columns, dml.OldValues)
 			if len(key) > 0 {
 				addOldKey++
 				keys = append(keys, key+tableName)
@@ -168,6 +168,81 @@ func (s *getKeysSuite) TestShouldCollectNewOldUniqKeyVals(c *check.C) {
 	c.Assert(keys, check.DeepEquals, expected)
 }
 
+// the table is like binlog_uk_with_no_pk in tests/dailytest:
+// CREATE TABLE binlog_uk_with_no_pk (id INT, a1 INT, a3 INT, UNIQUE KEY dex1(a1, a3))
+func newUKWithNoPKDML(tp DMLType, values, oldValues map[string]interface{}) *DML {
+	return &DML{
+		Database: "test",
+		Table:    "binlog_uk_with_no_pk",
+		Tp:       tp,
+		info: &tableInfo{
+			columns: []string{"id", "a1", "a3"},
+			uniqueKeys: []indexInfo{
+				{
+					name:    "dex1",
+					columns: []string{"a1", "a3"},
+				},
+			},
+		},
+		Values:    values,
+		OldValues: oldValues,
+	}
+}
+
+func (s *getKeysSuite) TestGetUniqueKeyShouldIgnoreNullIndex(c *check.C) {
+	names := []string{"a1", "a3"}
+	c.Assert(getUniqueKey(names, map[string]interface{}{"a1": 1, "a3": nil}), check.Equals, "")
+	c.Assert(getUniqueKey(names, map[string]interface{}{"a1": 1, "a3": 2}), check.Equals, "(a1: 1)(a3: 2)")
+	// the column not in values is not taken as NULL.
+	c.Assert(getUniqueKey(names, map[string]interface{}{"a1": 1}), check.Equals, "(a1: 1)")
+}
+
+// addToCausality adds the keys of the dml and returns the group it belongs to.
+func addToCausality(c *check.C, causality *Causality, dml *DML) string {
+	keys := getKeys(dml)
+	c.Assert(causality.Add(keys), check.IsNil)
+	return causality.Get(keys[0])
+}
+
+func (s *getKeysSuite) TestNullUniqueKeysShouldNotConflict(c *check.C) {
+	// INSERT INTO binlog_uk_with_no_pk(id, a1, a3) VALUES(1, 1, NULL);
+	// INSERT INTO binlog_uk_with_no_pk(id, a1, a3) VALUES(2, 1, NULL);
+	insert1 := newUKWithNoPKDML(InsertDMLType, map[string]interface{}{"id": 1, "a1": 1, "a3": nil}, nil)
+	insert2 := newUKWithNoPKDML(InsertDMLType, map[string]interface{}{"id": 2, "a1": 1, "a3": nil}, nil)
+	c.Assert(getKeys(insert1), check.HasLen, 1)
+
+	causality := NewCausality()
+	c.Assert(addToCausality(c, causality, insert1), check.Not(check.Equals), addToCausality(c, causality, insert2))
+
+	// the non-NULL unique keys are still causal.
+	insert3 := newUKWithNoPKDML(InsertDMLType, map[string]interface{}{"id": 3, "a1": 1, "a3": 1}, nil)
+	insert4 := newUKWithNoPKDML(InsertDMLType, map[string]interface{}{"id": 4, "a1": 1, "a3": 1}, nil)
+	c.Assert(addToCausality(c, causality, insert3), check.Equals, addToCausality(c, causality, insert4))
+}
+
+func (s *getKeysSuite) TestNullUniqueKeysOfUpdate(c *check.C) {
+	// UPDATE binlog_uk_with_no_pk SET id = 10 WHERE id = 1;
+	// UPDATE binlog_uk_with_no_pk SET id = 100 WHERE id = 10;
+	update1 := newUKWithNoPKDML(UpdateDMLType,
+		map[string]interface{}{"id": 10, "a1": 1, "a3": nil},
+		map[string]interface{}{"id": 1, "a1": 1, "a3": nil})
+	update2 := newUKWithNoPKDML(UpdateDMLType,
+		map[string]interface{}{"id": 100, "a1": 1, "a3": nil},
+		map[string]interface{}{"id": 10, "a1": 1, "a3": nil})
+	insert := newUKWithNoPKDML(InsertDMLType, map[string]interface{}{"id": 2, "a1": 1, "a3": nil}, nil)
+
+	// the keys of the rows are hashed from all the columns.
+	keys := getKeys(update1)
+	c.Assert(keys, check.HasLen, 2)
+	c.Assert(keys[0], check.Not(check.Equals), keys[1])
+
+	causality := NewCausality()
+	group := addToCausality(c, causality, update1)
+	c.Assert(addToCausality(c, causality, insert), check.Not(check.Equals), group)
+	// the same row updated again is causal.
+	c.Assert(addToCausality(c, causality, update2), check.Equals, group)
+}
+
 type SQLSuite struct{}
 
 var _ = check.Suite(&SQLSuite{})
@@ -192,6 +267,24 @@ func (s *SQLSuite) TestInsertSQL(c *check.C) {
 	c.Assert(args[1], check.Equals, "pc")
 }
 
+func (s *SQLSuite) TestUpsertSQL(c *check.C) {
+	dml := DML{
+		Tp:       InsertDMLType,
+		Database: "test",
+		Table:    "hello",
+		Values: map[string]interface{}{
+			"name": "pc",
+			"age":  42,
+		},
+		info: &tableInfo{
+			columns: []string{"name", "age", "note"},
+		},
+	}
+	sql, args := dml.upsertSQL()
+	c.Assert(sql, check.Equals, "INSERT INTO `test`.`hello`(`age`,`name`) VALUES(?,?) ON DUPLICATE KEY UPDATE `age`=VALUES(`age`),`name`=VALUES(`name`)")
+	c.Assert(args, check.DeepEquals, []interface{}{42, "pc"})
+}
+
 func (s *SQLSuite) TestDeleteSQL(c *check.C) {
 	dml := DML{
 		Tp:       DeleteDMLType,
@@ -238,6 +331,30 @@ func (s *SQLSuite) TestUpdateSQL(c *check.C) {
 	c.Assert(args[1], check.Equals, "pingcap")
 }
 
+func (s *SQLSuite) TestUpdateSQLWithExtraColumns(c *check.C) {
+	// the columns only in the new values, like the commit ts added by drainer, aren't in the where clause.
+	dml := DML{
+		Tp:       UpdateDMLType,
+		Database: "db",
+		Table:    "tbl",
+		Values: map[string]interface{}{
+			"name":            "pc",
+			"_tidb_commit_ts": int64(42),
+		},
+		OldValues: map[string]interface{}{
+			"name": "pingcap",
+		},
+		info: &tableInfo{
+			columns: []string{"name", "_tidb_commit_ts"},
+		},
+	}
+	sql, args := dml.sql()
+	c.Assert(
+		sql, check.Equals,
+		"UPDATE `db`.`tbl` SET `_tidb_commit_ts` = ?,`name` = ? WHERE `name` = ? LIMIT 1")
+	c.Assert(args, check.DeepEquals, []interface{}{int64(42), "pc", "pingcap"})
+}
+
 func (s *SQLSuite) TestUpdateMarkSQL(c *check.C) {
 	db, mock, err := sqlmock.New()
 	c.Assert(err, check.IsNil)
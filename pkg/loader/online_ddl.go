@@ -0,0 +1,107 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	"go.uber.org/zap"
+)
+
+// onlineAlter is an ALTER TABLE DDL executed by the online schema change command.
+type onlineAlter struct {
+	database string
+	table    string
+	// specs are the alter specs without the table name, like "ADD COLUMN c INT, ADD INDEX (c)".
+	specs string
+}
+
+// parseOnlineAlter returns the ALTER TABLE DDL to execute by the online schema change
+// command, nil if the DDL isn't an ALTER TABLE or can't be executed by the tools, like
+// renaming the table.
+func parseOnlineAlter(ddl *DDL) (*onlineAlter, error) {
+	stmt, err := parser.New().ParseOneStmt(ddl.SQL, "", "")
+	if err != nil {
+		return nil, errors.Annotatef(err, "parse ddl %s", ddl.SQL)
+	}
+	alter, ok := stmt.(*ast.AlterTableStmt)
+	if !ok || len(alter.Specs) == 0 {
+		return nil, nil
+	}
+
+	specs := make([]string, 0, len(alter.Specs))
+	for _, spec := range alter.Specs {
+		switch spec.Tp {
+		case ast.AlterTableRenameTable, ast.AlterTableSetTiFlashReplica:
+			return nil, nil
+		}
+		var sb strings.Builder
+		if err = spec.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+			return nil, errors.Annotatef(err, "restore ddl %s", ddl.SQL)
+		}
+		specs = append(specs, sb.String())
+	}
+
+	database := alter.Table.Schema.O
+	if len(database) == 0 {
+		database = ddl.Database
+	}
+	return &onlineAlter{database: database, table: alter.Table.Name.O, specs: strings.Join(specs, ", ")}, nil
+}
+
+// runOnlineSchemaChange runs the command by shell with the environment variables.
+var runOnlineSchemaChange = func(ctx context.Context, command string, env []string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	return cmd.CombinedOutput()
+}
+
+// execOnlineDDL executes the ALTER TABLE DDL by the online schema change command,
+// handled is false if the DDL should be executed in downstream directly.
+func (s *loaderImpl) execOnlineDDL(ctx context.Context, ddl *DDL) (handled bool, err error) {
+	alter, err := parseOnlineAlter(ddl)
+	if err != nil || alter == nil {
+		return false, errors.Trace(err)
+	}
+
+	if s.opts.ddlTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.opts.ddlTimeout)
+		defer cancel()
+	}
+
+	env := []string{
+		"DDL_DATABASE=" + alter.database,
+		"DDL_TABLE=" + alter.table,
+		"DDL_ALTER=" + alter.specs,
+		"DDL_SQL=" + ddl.SQL,
+	}
+	log.Info("exec ddl by online schema change", zap.String("sql", ddl.SQL), zap.Strings("env", env))
+	output, err := runOnlineSchemaChange(ctx, s.opts.onlineSchemaChange, env)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return true, errors.Errorf("online schema change timeout after %s, ddl: %s, output: %s", s.opts.ddlTimeout, ddl.SQL, output)
+		}
+		return true, errors.Annotatef(err, "online schema change failed, ddl: %s, output: %s", ddl.SQL, output)
+	}
+	return true, nil
+}
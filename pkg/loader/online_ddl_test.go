@@ -0,0 +1,100 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"errors"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+)
+
+type onlineDDLSuite struct {
+	origRun func(context.Context, string, []string) ([]byte, error)
+}
+
+var _ = check.Suite(&onlineDDLSuite{})
+
+func (s *onlineDDLSuite) SetUpTest(c *check.C) {
+	s.origRun = runOnlineSchemaChange
+}
+
+func (s *onlineDDLSuite) TearDownTest(c *check.C) {
+	runOnlineSchemaChange = s.origRun
+}
+
+func (s *onlineDDLSuite) TestParseOnlineAlter(c *check.C) {
+	alter, err := parseOnlineAlter(&DDL{Database: "test", SQL: "alter table t add column c int, add index idx(c)"})
+	c.Assert(err, check.IsNil)
+	c.Assert(alter, check.DeepEquals, &onlineAlter{database: "test", table: "t", specs: "ADD COLUMN `c` INT, ADD INDEX `idx`(`c`)"})
+
+	alter, err = parseOnlineAlter(&DDL{Database: "test", SQL: "alter table db2.t drop column c"})
+	c.Assert(err, check.IsNil)
+	c.Assert(alter, check.DeepEquals, &onlineAlter{database: "db2", table: "t", specs: "DROP COLUMN `c`"})
+
+	for _, sql := range []string{
+		"create table t(a int)",
+		"alter table t rename to t2",
+		"alter table t set tiflash replica 1",
+	} {
+		alter, err = parseOnlineAlter(&DDL{Database: "test", SQL: sql})
+		c.Assert(err, check.IsNil)
+		c.Assert(alter, check.IsNil, check.Commentf("sql: %s", sql))
+	}
+
+	_, err = parseOnlineAlter(&DDL{Database: "test", SQL: "alter table"})
+	c.Assert(err, check.NotNil)
+}
+
+func (s *onlineDDLSuite) TestExecDDL(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+	ddlDB, ddlMock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer ddlDB.Close()
+
+	var envs [][]string
+	runOnlineSchemaChange = func(_ context.Context, command string, env []string) ([]byte, error) {
+		c.Assert(command, check.Equals, "osc")
+		envs = append(envs, env)
+		if len(envs) == 1 {
+			return []byte("lost connection"), errors.New("exit status 1")
+		}
+		return nil, nil
+	}
+
+	ld := &loaderImpl{db: db, ctx: context.Background(), opts: options{ddlDB: ddlDB, onlineSchemaChange: "osc"}}
+
+	// the ALTER TABLE is executed by the command, and retried if it fails.
+	err = ld.execDDL(&DDL{Database: "test", Table: "t", SQL: "alter table t add column c int"})
+	c.Assert(err, check.IsNil)
+	c.Assert(envs, check.HasLen, 2)
+	c.Assert(envs[1], check.DeepEquals, []string{
+		"DDL_DATABASE=test",
+		"DDL_TABLE=t",
+		"DDL_ALTER=ADD COLUMN `c` INT",
+		"DDL_SQL=alter table t add column c int",
+	})
+
+	// the other DDLs are executed on the dedicated connection.
+	ddlMock.ExpectBegin()
+	ddlMock.ExpectExec("use `test`;").WillReturnResult(sqlmock.NewResult(0, 0))
+	ddlMock.ExpectExec("create table t2").WillReturnResult(sqlmock.NewResult(0, 0))
+	ddlMock.ExpectCommit()
+	err = ld.execDDL(&DDL{Database: "test", Table: "t2", SQL: "create table t2(a int)"})
+	c.Assert(err, check.IsNil)
+	c.Assert(ddlMock.ExpectationsWereMet(), check.IsNil)
+}
@@ -0,0 +1,218 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/drainer/loopbacksync"
+	"go.uber.org/zap"
+)
+
+// Tuner is implemented by the Loader whose worker count and batch size can be
+// changed at runtime, the changes take effect from the next batch of DMLs.
+type Tuner interface {
+	WorkerCount() int
+	BatchSize() int
+	SetWorkerCount(n int) error
+	SetBatchSize(n int) error
+}
+
+var _ Tuner = &loaderImpl{}
+
+// AutoTuneConfig is the config of the feedback controller adjusting the worker
+// count and batch size by the latency and error rate of downstream.
+type AutoTuneConfig struct {
+	MinWorkerCount int
+	MaxWorkerCount int
+	MinBatchSize   int
+	MaxBatchSize   int
+	// TargetLatency is the expected latency of executing a batch of DMLs.
+	TargetLatency time.Duration
+	// MaxErrorRate is the max ratio of the retries to the executed batches.
+	MaxErrorRate float64
+	// Interval is the interval between the adjustments.
+	Interval time.Duration
+}
+
+// tuneStats is the feedback of the batches executed since the last adjustment.
+type tuneStats struct {
+	batches int
+	// full is the number of the batches reaching the limit, the loader can't
+	// keep up with the input if most batches are full.
+	full    int
+	retries int
+	latency time.Duration
+}
+
+// adjust returns the worker count and batch size for the next interval:
+//   - both are halved if the error rate is too high, the downstream may be overloaded.
+//   - the worker count is decreased by one and the batch size by a quarter if
+//     the latency is higher than the target.
+//   - the worker count is increased by one and the batch size by a quarter if
+//     the latency is lower than half of the target and the loader is saturated.
+func (c *AutoTuneConfig) adjust(workerCount, batchSize int, stats tuneStats) (int, int) {
+	if stats.batches == 0 {
+		return workerCount, batchSize
+	}
+
+	latency := stats.latency / time.Duration(stats.batches)
+	switch {
+	case float64(stats.retries)/float64(stats.batches) > c.MaxErrorRate:
+		workerCount /= 2
+		batchSize /= 2
+	case latency > c.TargetLatency:
+		workerCount--
+		batchSize -= batchSize / 4
+	case latency < c.TargetLatency/2 && stats.full*2 >= stats.batches:
+		workerCount++
+		batchSize += (batchSize + 3) / 4
+	}
+
+	return clamp(workerCount, c.MinWorkerCount, c.MaxWorkerCount), clamp(batchSize, c.MinBatchSize, c.MaxBatchSize)
+}
+
+func clamp(n, lower, upper int) int {
+	if n < lower {
+		return lower
+	}
+	if n > upper {
+		return upper
+	}
+	return n
+}
+
+// AutoTune enables the feedback controller adjusting the worker count and
+// batch size, it only works when dispatch is enabled.
+func AutoTune(cfg *AutoTuneConfig) Option {
+	return func(o *options) {
+		o.autoTune = cfg
+	}
+}
+
+// WorkerCount returns the number of workers executing DMLs.
+func (s *loaderImpl) WorkerCount() int {
+	s.tuneMu.Lock()
+	defer s.tuneMu.Unlock()
+	return s.workerCount
+}
+
+// BatchSize returns the max number of DMLs executed in a transaction.
+func (s *loaderImpl) BatchSize() int {
+	s.tuneMu.Lock()
+	defer s.tuneMu.Unlock()
+	return s.batchSize
+}
+
+// SetWorkerCount changes the number of workers executing DMLs, the mark rows of the new workers
+// are added first if loopback sync is enabled.
+func (s *loaderImpl) SetWorkerCount(n int) error {
+	if !s.opts.enableDispatch {
+		return errors.New("worker count can't be changed when dispatch is disabled")
+	}
+	if n <= 0 {
+		return errors.Errorf("invalid worker count %d", n)
+	}
+
+	s.tuneMu.Lock()
+	if n > s.markRows && s.markRows > 0 {
+		if err := loopbacksync.AddMarkTableData(s.db, s.markRows, n, s.loopBackSyncInfo.ChannelID); err != nil {
+			s.tuneMu.Unlock()
+			return errors.Annotatef(err, "add the mark rows of %d workers", n)
+		}
+		s.markRows = n
+	}
+	s.workerCount = n
+	s.tuneMu.Unlock()
+
+	s.resizeConnPool(n)
+	return nil
+}
+
+// SetBatchSize changes the max number of DMLs executed in a transaction.
+func (s *loaderImpl) SetBatchSize(n int) error {
+	if !s.opts.enableDispatch {
+		return errors.New("batch size can't be changed when dispatch is disabled")
+	}
+	if n <= 0 {
+		return errors.Errorf("invalid batch size %d", n)
+	}
+
+	s.tuneMu.Lock()
+	s.batchSize = n
+	s.tuneMu.Unlock()
+	return nil
+}
+
+// batchLimit returns the number of DMLs accumulated to execute at a time.
+func (s *loaderImpl) batchLimit() int {
+	s.tuneMu.Lock()
+	defer s.tuneMu.Unlock()
+	return s.batchSize * s.workerCount * execLimitMultiple
+}
+
+func (s *loaderImpl) observeBatch(dmls int, latency time.Duration) {
+	limit := s.batchLimit()
+
+	s.tuneMu.Lock()
+	defer s.tuneMu.Unlock()
+	s.tuneStats.batches++
+	s.tuneStats.latency += latency
+	if dmls >= limit {
+		s.tuneStats.full++
+	}
+}
+
+func (s *loaderImpl) observeRetry() {
+	s.tuneMu.Lock()
+	s.tuneStats.retries++
+	s.tuneMu.Unlock()
+}
+
+// autoTune adjusts the worker count and batch size by the feedback of each
+// interval until done is closed.
+func (s *loaderImpl) autoTune(cfg *AutoTuneConfig, done <-chan struct{}) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		s.tuneMu.Lock()
+		stats := s.tuneStats
+		s.tuneStats = tuneStats{}
+		workerCount, batchSize := s.workerCount, s.batchSize
+		s.tuneMu.Unlock()
+
+		newWorkerCount, newBatchSize := cfg.adjust(workerCount, batchSize, stats)
+		if newWorkerCount == workerCount && newBatchSize == batchSize {
+			continue
+		}
+		log.Info("auto tune the loader", zap.Int("batches", stats.batches), zap.Int("full batches", stats.full),
+			zap.Int("retries", stats.retries), zap.Duration("total latency", stats.latency),
+			zap.Int("worker count", newWorkerCount), zap.Int("batch size", newBatchSize))
+		if err := s.SetWorkerCount(newWorkerCount); err != nil {
+			log.Warn("set worker count failed", zap.Error(err))
+		}
+		if err := s.SetBatchSize(newBatchSize); err != nil {
+			log.Warn("set batch size failed", zap.Error(err))
+		}
+	}
+}
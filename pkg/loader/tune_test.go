@@ -0,0 +1,151 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"context"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/drainer/loopbacksync"
+)
+
+type tuneSuite struct{}
+
+var _ = check.Suite(&tuneSuite{})
+
+func (s *tuneSuite) TestAdjust(c *check.C) {
+	cfg := &AutoTuneConfig{
+		MinWorkerCount: 2,
+		MaxWorkerCount: 32,
+		MinBatchSize:   10,
+		MaxBatchSize:   100,
+		TargetLatency:  100 * time.Millisecond,
+		MaxErrorRate:   0.1,
+	}
+
+	tests := []struct {
+		stats       tuneStats
+		workerCount int
+		batchSize   int
+	}{
+		// no feedback.
+		{tuneStats{}, 16, 20},
+		// too many errors.
+		{tuneStats{batches: 10, retries: 2, latency: 10 * time.Millisecond}, 8, 10},
+		// too slow.
+		{tuneStats{batches: 10, latency: 2 * time.Second}, 15, 15},
+		// fast and saturated.
+		{tuneStats{batches: 10, full: 5, latency: 100 * time.Millisecond}, 17, 25},
+		// fast but not saturated.
+		{tuneStats{batches: 10, full: 4, latency: 100 * time.Millisecond}, 16, 20},
+		// between half of the target and the target.
+		{tuneStats{batches: 10, full: 10, latency: 800 * time.Millisecond}, 16, 20},
+	}
+	for _, t := range tests {
+		workerCount, batchSize := cfg.adjust(16, 20, t.stats)
+		c.Assert(workerCount, check.Equals, t.workerCount, check.Commentf("%+v", t.stats))
+		c.Assert(batchSize, check.Equals, t.batchSize, check.Commentf("%+v", t.stats))
+	}
+
+	// the results are in the bounds.
+	workerCount, batchSize := cfg.adjust(2, 10, tuneStats{batches: 1, retries: 1})
+	c.Assert(workerCount, check.Equals, 2)
+	c.Assert(batchSize, check.Equals, 10)
+	workerCount, batchSize = cfg.adjust(32, 100, tuneStats{batches: 1, full: 1})
+	c.Assert(workerCount, check.Equals, 32)
+	c.Assert(batchSize, check.Equals, 100)
+}
+
+func (s *tuneSuite) TestSetWorkerCountAndBatchSize(c *check.C) {
+	db, _, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	ld, err := NewLoader(db, WorkerCount(4), BatchSize(10))
+	c.Assert(err, check.IsNil)
+	tuner := ld.(Tuner)
+	c.Assert(tuner.WorkerCount(), check.Equals, 4)
+	c.Assert(tuner.BatchSize(), check.Equals, 10)
+
+	bm := newBatchManager(ld.(*loaderImpl))
+	c.Assert(bm.limit, check.Equals, 4*10*execLimitMultiple)
+
+	c.Assert(tuner.SetWorkerCount(8), check.IsNil)
+	c.Assert(tuner.SetBatchSize(5), check.IsNil)
+	c.Assert(tuner.SetWorkerCount(0), check.NotNil)
+	c.Assert(tuner.SetBatchSize(-1), check.NotNil)
+	c.Assert(tuner.WorkerCount(), check.Equals, 8)
+	c.Assert(tuner.BatchSize(), check.Equals, 5)
+	c.Assert(db.Stats().MaxOpenConnections, check.Equals, 8)
+
+	// the new limit takes effect from the next txn.
+	bm.fExecDMLs = func([]*DML) error { return nil }
+	c.Assert(bm.put(&Txn{DMLs: []*DML{{}}}), check.IsNil)
+	c.Assert(bm.limit, check.Equals, 8*5*execLimitMultiple)
+	e := ld.(*loaderImpl).getExecutor()
+	c.Assert(e.workerCount, check.Equals, 8)
+	c.Assert(e.batchSize, check.Equals, 5)
+
+	// can't be changed if dispatch is disabled.
+	ld, err = NewLoader(db, EnableDispatch(false))
+	c.Assert(err, check.IsNil)
+	c.Assert(ld.(Tuner).SetWorkerCount(8), check.NotNil)
+	c.Assert(ld.(Tuner).SetBatchSize(8), check.NotNil)
+}
+
+func (s *tuneSuite) TestSetWorkerCountWithLoopback(c *check.C) {
+	db, mk, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	defer db.Close()
+
+	ld, err := NewLoader(db, WorkerCount(2), SetloopBackSyncInfo(&loopbacksync.LoopBackSync{LoopbackControl: true, ChannelID: 1}))
+	c.Assert(err, check.IsNil)
+	impl := ld.(*loaderImpl)
+
+	mk.ExpectExec("create database.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mk.ExpectExec("CREATE TABLE.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mk.ExpectExec("REPLACE INTO .*").WithArgs(0, 1, 1, "", 1, 1, 1, "").WillReturnResult(sqlmock.NewResult(0, 2))
+	c.Assert(impl.initMarkTable(), check.IsNil)
+
+	// the mark rows of the new workers are added, and are kept when the workers are reduced.
+	mk.ExpectExec("REPLACE INTO .*").WithArgs(2, 1, 1, "", 3, 1, 1, "").WillReturnResult(sqlmock.NewResult(0, 2))
+	c.Assert(impl.SetWorkerCount(4), check.IsNil)
+	c.Assert(impl.SetWorkerCount(1), check.IsNil)
+	c.Assert(impl.SetWorkerCount(3), check.IsNil)
+	c.Assert(mk.ExpectationsWereMet(), check.IsNil)
+	c.Assert(impl.markRows, check.Equals, 4)
+
+	// the worker count isn't changed if the mark rows fail to be added.
+	mk.ExpectExec("REPLACE INTO .*").WillReturnError(errors.New("mock error"))
+	c.Assert(impl.SetWorkerCount(8), check.ErrorMatches, ".*mock error.*")
+	c.Assert(impl.WorkerCount(), check.Equals, 3)
+}
+
+func (s *tuneSuite) TestObserve(c *check.C) {
+	ld := &loaderImpl{batchSize: 2, workerCount: 1}
+	ld.observeBatch(6, time.Second)
+	ld.observeBatch(1, time.Second)
+	ld.observeRetry()
+	c.Assert(ld.tuneStats, check.Equals, tuneStats{batches: 2, full: 1, retries: 1, latency: 2 * time.Second})
+
+	e := newExecutor(nil).withRetryCallback(ld.observeRetry)
+	fn := e.countRetry(func(context.Context) error { return nil })
+	for i := 0; i < 3; i++ {
+		c.Assert(fn(context.Background()), check.IsNil)
+	}
+	c.Assert(ld.tuneStats.retries, check.Equals, 3)
+}
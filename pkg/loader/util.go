@@ -18,9 +18,11 @@ import (
 	gosql "database/sql"
 	"fmt"
 	"hash/crc32"
+	"net"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 
 	"github.com/go-sql-driver/mysql"
@@ -86,6 +88,34 @@ func getTableInfo(db *gosql.DB, schema string, table string) (info *tableInfo, e
 
 var customID int64
 
+var (
+	dialNetworksMu sync.RWMutex
+	// dialNetworks are the networks of the mysql driver registered by RegisterDialer by address.
+	dialNetworks = make(map[string]string)
+)
+
+// RegisterDialer makes the connections to host:port of the DBs created later be dialed by dial,
+// like through an SSH tunnel or a SOCKS5 proxy, instead of TCP.
+func RegisterDialer(host string, port int, dial mysql.DialContextFunc) {
+	network := "dial_" + strconv.FormatInt(atomic.AddInt64(&customID, 1), 10)
+	mysql.RegisterDialContext(network, dial)
+
+	dialNetworksMu.Lock()
+	dialNetworks[net.JoinHostPort(host, strconv.Itoa(port))] = network
+	dialNetworksMu.Unlock()
+}
+
+// dialNetwork returns the network of the mysql driver dialing host:port.
+func dialNetwork(host string, port int) string {
+	dialNetworksMu.RLock()
+	defer dialNetworksMu.RUnlock()
+
+	if network, ok := dialNetworks[net.JoinHostPort(host, strconv.Itoa(port))]; ok {
+		return network
+	}
+	return "tcp"
+}
+
 func isUnknownSystemVariableErr(err error) bool {
 	code, ok := sql.GetSQLErrCode(err)
 	if !ok {
@@ -102,6 +132,8 @@ func createDBWitSessions(dsn string, params map[string]string) (db *gosql.DB, er
 		// default is false, must enable for insert value explicit, or can't replicate.
 		"allow_auto_random_explicit_insert": "1",
 		"tidb_txn_mode":                     defaultTiDBTxnMode,
+		// EXCHANGE PARTITION is ignored with a warning if it's not enabled.
+		"tidb_enable_exchange_partition": "1",
 	}
 	var tryDB *gosql.DB
 	tryDB, err = gosql.Open("mysql", dsn)
@@ -146,7 +178,17 @@ func createDBWitSessions(dsn string, params map[string]string) (db *gosql.DB, er
 
 // CreateDBWithSQLMode return sql.DB
 func CreateDBWithSQLMode(user string, password string, host string, port int, tlsConfig *tls.Config, sqlMode *string, params map[string]string) (db *gosql.DB, err error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/?charset=utf8mb4,utf8&interpolateParams=true&readTimeout=1m&multiStatements=true", user, password, host, port)
+	return createDBWithReadTimeout(user, password, host, port, tlsConfig, sqlMode, params, "1m")
+}
+
+// CreateDDLDB return sql.DB to execute the DDLs by the DDLDB option, the connections have
+// no read timeout since a DDL may run much longer than a DML, use DDLTimeout to limit it.
+func CreateDDLDB(user string, password string, host string, port int, tlsConfig *tls.Config, sqlMode *string, params map[string]string) (db *gosql.DB, err error) {
+	return createDBWithReadTimeout(user, password, host, port, tlsConfig, sqlMode, params, "0")
+}
+
+func createDBWithReadTimeout(user string, password string, host string, port int, tlsConfig *tls.Config, sqlMode *string, params map[string]string, readTimeout string) (db *gosql.DB, err error) {
+	dsn := fmt.Sprintf("%s:%s@%s(%s:%d)/?charset=utf8mb4,utf8&interpolateParams=true&readTimeout=%s&multiStatements=true", user, password, dialNetwork(host, port), host, port, readTimeout)
 	if sqlMode != nil {
 		// same as "set sql_mode = '<sqlMode>'"
 		dsn += "&sql_mode='" + url.QueryEscape(*sqlMode) + "'"
@@ -221,6 +263,18 @@ func buildColumnList(names []string) string {
 	return b.String()
 }
 
+// buildUpsertList returns the assignments of ON DUPLICATE KEY UPDATE setting the columns to the values inserted.
+func buildUpsertList(names []string) string {
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, "%s=VALUES(%s)", quoteName(name), quoteName(name))
+	}
+	return b.String()
+}
+
 // getColsOfTbl returns a slice of the names of all columns,
 // generated columns are excluded.
 // https://dev.mysql.com/doc/mysql-infoschema-excerpt/5.7/en/columns-table.html
@@ -14,6 +14,8 @@
 package loader
 
 import (
+	"context"
+	"net"
 	"regexp"
 	"testing"
 
@@ -84,3 +86,18 @@ func (cs *UtilSuite) TestGetTableInfo(c *check.C) {
 			{"dex2", []string{"a2", "a3"}},
 		}})
 }
+
+func (cs *UtilSuite) TestRegisterDialer(c *check.C) {
+	var dialed []string
+	RegisterDialer("db.internal", 3306, func(ctx context.Context, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return nil, errors.New("proxy unavailable")
+	})
+	c.Assert(dialNetwork("db.internal", 3306), check.Matches, "dial_[0-9]+")
+	c.Assert(dialNetwork("db.internal", 4000), check.Equals, "tcp")
+
+	_, err := CreateDBWithSQLMode("root", "", "db.internal", 3306, nil, nil, nil)
+	c.Assert(err, check.ErrorMatches, ".*proxy unavailable.*")
+	c.Assert(len(dialed), check.Greater, 0)
+	c.Assert(dialed[0], check.Equals, "db.internal:3306")
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"golang.org/x/net/context"
+)
+
+// AssignmentPrefix is the prefix of the keys saving the assignments of the drainer groups in etcd.
+const AssignmentPrefix = "assignments"
+
+// TableAssignment assigns a table, or all the tables of a schema if Table is empty, to a drainer.
+type TableAssignment struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table,omitempty"`
+	// Drainer is the node id of the drainer owning the tables.
+	Drainer string `json:"drainer"`
+	// Since is the commit ts the drainer owns the tables after, the binlogs of the tables committed
+	// not after it were synced by the previous owner.
+	Since int64 `json:"since"`
+}
+
+// Name returns "schema.table", or "schema" if the whole schema is assigned.
+func (t *TableAssignment) Name() string {
+	if len(t.Table) == 0 {
+		return t.Schema
+	}
+	return t.Schema + "." + t.Table
+}
+
+// Assignment is the tables assigned to the drainers of a group, every table is owned by one drainer at most.
+type Assignment struct {
+	// Version is increased every time the assignment is saved.
+	Version int64              `json:"version"`
+	Tables  []*TableAssignment `json:"tables"`
+}
+
+// Lookup returns the entry owning the table, the entry of the table is preferred to the one of its schema.
+// Set table empty to look up the schema itself, like for the DDLs creating or dropping the schema.
+func (a *Assignment) Lookup(schema, table string) *TableAssignment {
+	schema, table = strings.ToLower(schema), strings.ToLower(table)
+	var schemaEntry *TableAssignment
+	for _, t := range a.Tables {
+		if t.Schema != schema {
+			continue
+		}
+		if len(t.Table) == 0 {
+			schemaEntry = t
+		} else if len(table) > 0 && t.Table == table {
+			return t
+		}
+	}
+	return schemaEntry
+}
+
+// Set assigns the table to the drainer since the ts, the previous entry of the table is replaced.
+func (a *Assignment) Set(t *TableAssignment) {
+	t.Schema, t.Table = strings.ToLower(t.Schema), strings.ToLower(t.Table)
+	a.Remove(t.Schema, t.Table)
+	a.Tables = append(a.Tables, t)
+	sort.Slice(a.Tables, func(i, j int) bool {
+		return a.Tables[i].Name() < a.Tables[j].Name()
+	})
+}
+
+// Remove removes the entry of exactly the table, or the schema if table is empty, and returns it.
+func (a *Assignment) Remove(schema, table string) *TableAssignment {
+	schema, table = strings.ToLower(schema), strings.ToLower(table)
+	for i, t := range a.Tables {
+		if t.Schema == schema && t.Table == table {
+			a.Tables = append(a.Tables[:i], a.Tables[i+1:]...)
+			return t
+		}
+	}
+	return nil
+}
+
+// TablesOf returns the entries assigned to the drainer.
+func (a *Assignment) TablesOf(nodeID string) []*TableAssignment {
+	var tables []*TableAssignment
+	for _, t := range a.Tables {
+		if t.Drainer == nodeID {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+// Assignment returns the assignment of the drainer group, nil if nothing is assigned.
+func (r *EtcdRegistry) Assignment(pctx context.Context, group string) (*Assignment, error) {
+	ctx, cancel := context.WithTimeout(pctx, r.reqTimeout)
+	defer cancel()
+
+	data, err := r.client.Get(ctx, path.Join(AssignmentPrefix, group))
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Trace(err)
+	}
+
+	a := &Assignment{}
+	if err = json.Unmarshal(data, a); err != nil {
+		return nil, errors.Annotatef(err, "invalid assignment of group %s", group)
+	}
+	return a, nil
+}
+
+// SaveAssignment saves the assignment of the drainer group, the version of it is increased.
+func (r *EtcdRegistry) SaveAssignment(pctx context.Context, group string, a *Assignment) error {
+	ctx, cancel := context.WithTimeout(pctx, r.reqTimeout)
+	defer cancel()
+
+	a.Version++
+	data, err := json.Marshal(a)
+	if err != nil {
+		return errors.Annotatef(err, "error marshal assignment of group %s", group)
+	}
+	err = r.client.UpdateOrCreate(ctx, path.Join(AssignmentPrefix, group), string(data), 0)
+	return errors.Trace(err)
+}
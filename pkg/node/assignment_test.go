@@ -0,0 +1,73 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/etcd"
+	"golang.org/x/net/context"
+)
+
+type assignmentSuite struct{}
+
+var _ = Suite(&assignmentSuite{})
+
+func (s *assignmentSuite) TestLookup(c *C) {
+	a := &Assignment{}
+	a.Set(&TableAssignment{Schema: "DB1", Drainer: "d1"})
+	a.Set(&TableAssignment{Schema: "db1", Table: "T1", Drainer: "d2", Since: 100})
+	a.Set(&TableAssignment{Schema: "db2", Table: "t1", Drainer: "d2"})
+
+	c.Assert(a.Lookup("db1", "t1").Drainer, Equals, "d2")
+	c.Assert(a.Lookup("db1", "t2").Drainer, Equals, "d1")
+	c.Assert(a.Lookup("Db1", "").Drainer, Equals, "d1")
+	c.Assert(a.Lookup("db2", "t2"), IsNil)
+	c.Assert(a.Lookup("db2", ""), IsNil)
+	c.Assert(a.TablesOf("d2"), HasLen, 2)
+
+	// replace the entry of the table.
+	a.Set(&TableAssignment{Schema: "db1", Table: "t1", Drainer: "d3", Since: 200})
+	c.Assert(a.Tables, HasLen, 3)
+	c.Assert(a.Lookup("db1", "t1").Since, Equals, int64(200))
+
+	c.Assert(a.Remove("db1", "t1").Drainer, Equals, "d3")
+	c.Assert(a.Remove("db1", "t1"), IsNil)
+	c.Assert(a.Lookup("db1", "t1").Drainer, Equals, "d1")
+}
+
+func (s *assignmentSuite) TestSaveAssignment(c *C) {
+	etcdclient := etcd.NewClient(testEtcdCluster.RandClient(), DefaultRootPath)
+	r := NewEtcdRegistry(etcdclient, time.Duration(5)*time.Second)
+	ctx := context.Background()
+
+	a, err := r.Assignment(ctx, "group1")
+	c.Assert(err, IsNil)
+	c.Assert(a, IsNil)
+
+	a = &Assignment{}
+	a.Set(&TableAssignment{Schema: "db1", Drainer: "d1"})
+	c.Assert(r.SaveAssignment(ctx, "group1", a), IsNil)
+	c.Assert(r.SaveAssignment(ctx, "group1", a), IsNil)
+
+	saved, err := r.Assignment(ctx, "group1")
+	c.Assert(err, IsNil)
+	c.Assert(saved, DeepEquals, a)
+	c.Assert(saved.Version, Equals, int64(2))
+
+	other, err := r.Assignment(ctx, "group2")
+	c.Assert(err, IsNil)
+	c.Assert(other, IsNil)
+}
@@ -15,6 +15,7 @@ package node
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	"golang.org/x/net/context"
@@ -68,6 +69,10 @@ const (
 	// Paused means the node is already paused.
 	Paused = "paused"
 
+	// Draining means the pump rejects writing new binlogs, so TiDB writes them to the other
+	// pumps, but its binlogs are still pulled by drainers until it's offline.
+	Draining = "draining"
+
 	// Closing means the node is closing, and the state will be Offline when closed.
 	Closing = "closing"
 
@@ -88,6 +93,9 @@ type Status struct {
 	// the host of pump or node.
 	Addr string `json:"host"`
 
+	// the address serving the HTTP API like /status, it's empty if the API is served on Addr.
+	StatusAddr string `json:"statusAddr,omitempty"`
+
 	// the state of pump.
 	State string `json:"state"`
 
@@ -108,6 +116,22 @@ type Status struct {
 
 	// UpdateTS is the last update ts of node's status.
 	UpdateTS int64 `json:"updateTS"`
+
+	// the write throughput and disk stats of pump, nil for drainer.
+	Stats *PumpStats `json:"stats,omitempty"`
+}
+
+// PumpStats is the stats reported by pump in the heartbeat for capacity planning,
+// the max commit ts written is reported as MaxCommitTS of the Status.
+type PumpStats struct {
+	// the bytes written to the value log per second since the last heartbeat.
+	WriteBytesPerSecond float64 `json:"writeBytesPerSecond"`
+
+	// the p99 latency of the recent fsyncs in seconds.
+	FsyncLatencyP99 float64 `json:"fsyncLatencyP99"`
+
+	// the available space of the data dir.
+	DiskFreeBytes uint64 `json:"diskFreeBytes"`
 }
 
 // NewStatus returns a new status.
@@ -127,16 +151,34 @@ func CloneStatus(status *Status) *Status {
 	return &Status{
 		NodeID:      status.NodeID,
 		Addr:        status.Addr,
+		StatusAddr:  status.StatusAddr,
 		State:       status.State,
 		IsAlive:     status.IsAlive,
 		Score:       status.Score,
 		Label:       status.Label,
 		MaxCommitTS: status.MaxCommitTS,
 		UpdateTS:    status.UpdateTS,
+		Stats:       status.Stats,
 	}
 }
 
+// HTTPAddr returns the address serving the HTTP API of the node.
+func (s *Status) HTTPAddr() string {
+	if len(s.StatusAddr) > 0 {
+		return s.StatusAddr
+	}
+	return s.Addr
+}
+
 func (s *Status) String() string {
 	updateTime := util.TSOToRoughTime(s.UpdateTS)
+	if s.Stats != nil {
+		return fmt.Sprintf("{NodeID: %s, Addr: %s, State: %s, MaxCommitTS: %d, UpdateTime: %v, %s}", s.NodeID, s.Addr, s.State, s.MaxCommitTS, updateTime, s.Stats)
+	}
 	return fmt.Sprintf("{NodeID: %s, Addr: %s, State: %s, MaxCommitTS: %d, UpdateTime: %v}", s.NodeID, s.Addr, s.State, s.MaxCommitTS, updateTime)
 }
+
+func (s *PumpStats) String() string {
+	return fmt.Sprintf("WriteBytesPerSecond: %.0f, FsyncLatencyP99: %v, DiskFreeBytes: %d",
+		s.WriteBytesPerSecond, time.Duration(s.FsyncLatencyP99*float64(time.Second)), s.DiskFreeBytes)
+}
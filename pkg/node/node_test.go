@@ -28,8 +28,26 @@ func (s *testNodeSuite) TestClone(c *C) {
 	c.Assert(*status, Equals, *status2)
 }
 
+func (s *testNodeSuite) TestHTTPAddr(c *C) {
+	status := NewStatus("nodeID", "10.0.0.1:8250", Online, 100, 407775642342881, 407775645599649)
+	c.Assert(status.HTTPAddr(), Equals, "10.0.0.1:8250")
+
+	status.StatusAddr = "192.168.0.1:8260"
+	c.Assert(CloneStatus(status).StatusAddr, Equals, status.StatusAddr)
+	c.Assert(status.HTTPAddr(), Equals, "192.168.0.1:8260")
+}
+
 func (s *testNodeSuite) TestString(c *C) {
 	status := NewStatus("nodeID", "localhost", Online, 100, 407775642342881, 407775645599649)
 	str := status.String()
 	c.Assert(str, Matches, "{NodeID: nodeID, Addr: localhost, State: online, MaxCommitTS: 407775642342881, UpdateTime: 1970-01-19 .*}")
 }
+
+func (s *testNodeSuite) TestStringWithStats(c *C) {
+	status := NewStatus("nodeID", "localhost", Online, 100, 407775642342881, 407775645599649)
+	status.Stats = &PumpStats{WriteBytesPerSecond: 1024, FsyncLatencyP99: 0.002, DiskFreeBytes: 1 << 30}
+	c.Assert(CloneStatus(status).Stats, DeepEquals, status.Stats)
+
+	str := status.String()
+	c.Assert(str, Matches, "{NodeID: nodeID, .*, WriteBytesPerSecond: 1024, FsyncLatencyP99: 2ms, DiskFreeBytes: 1073741824}")
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-binlog/pkg/etcd"
+	"go.etcd.io/etcd/clientv3"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
 )
@@ -100,6 +101,39 @@ func (r *EtcdRegistry) UpdateNode(pctx context.Context, prefix string, status *S
 	}
 }
 
+// GrantLease creates a lease expiring after ttl seconds to attach the nodes to.
+func (r *EtcdRegistry) GrantLease(pctx context.Context, ttl int64) (clientv3.LeaseID, error) {
+	ctx, cancel := context.WithTimeout(pctx, r.reqTimeout)
+	defer cancel()
+
+	id, err := r.client.Grant(ctx, ttl)
+	return id, errors.Trace(err)
+}
+
+// KeepAliveLease renews the lease, it returns a NotFound error if the lease is expired and the
+// nodes attached to it are deleted.
+func (r *EtcdRegistry) KeepAliveLease(pctx context.Context, id clientv3.LeaseID) error {
+	ctx, cancel := context.WithTimeout(pctx, r.reqTimeout)
+	defer cancel()
+
+	return errors.Trace(r.client.KeepAliveOnce(ctx, id))
+}
+
+// UpdateNodeWithLease updates the node information attached to the lease, the node is created if
+// it doesn't exist, e.g. it's deleted as the lease was expired.
+func (r *EtcdRegistry) UpdateNodeWithLease(pctx context.Context, prefix string, status *Status, id clientv3.LeaseID) error {
+	ctx, cancel := context.WithTimeout(pctx, r.reqTimeout)
+	defer cancel()
+
+	objstr, err := json.Marshal(status)
+	if err != nil {
+		return errors.Annotatef(err, "error marshal NodeStatus(%v)", status)
+	}
+	key := r.prefixed(prefix, status.NodeID)
+	err = r.client.PutWithLease(ctx, key, string(objstr), id)
+	return errors.Trace(err)
+}
+
 func (r *EtcdRegistry) checkNodeExists(ctx context.Context, prefix, nodeID string) (bool, error) {
 	_, err := r.client.Get(ctx, r.prefixed(prefix, nodeID))
 	if err != nil {
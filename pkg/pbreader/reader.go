@@ -0,0 +1,296 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pbreader reads the binlogs written by drainer with the pb (file)
+// destination, and keeps tailing the directory for the new binlogs.
+package pbreader
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"go.uber.org/zap"
+)
+
+const defaultPollInterval = time.Second
+
+// Position is the position of a binlog in the directory, the files are named
+// like binlog-{index}-{datetime}, and drainer rotates to the file with the
+// next index once the current one is full.
+type Position struct {
+	Index  uint64 `json:"index"`
+	Offset int64  `json:"offset"`
+}
+
+// Message is a binlog read, Pos is the position right after the binlog,
+// reading from Pos resumes from the next binlog.
+type Message struct {
+	Binlog *pb.Binlog
+	Pos    Position
+}
+
+// Config is the configuration of Reader
+type Config struct {
+	// Dir is the directory of the binlog files
+	Dir string
+	// Pos is the position to start reading, read from the first file if nil
+	Pos *Position
+	// CommitTS skips the binlogs whose commit ts is not greater than it
+	CommitTS int64
+	// PollInterval is the interval to check for new binlogs at the end of the directory
+	PollInterval time.Duration
+	// MessageBufferSize is the size of the channel buffering the messages
+	MessageBufferSize int
+}
+
+// Reader reads binlogs from the directory in order, and keeps waiting for the
+// new binlogs written by drainer until closed.
+type Reader struct {
+	cfg *Config
+
+	msgs chan *Message
+	stop chan struct{}
+	wg   sync.WaitGroup
+	err  error
+}
+
+// NewReader creates a Reader and starts reading
+func NewReader(cfg *Config) (*Reader, error) {
+	info, err := os.Stat(cfg.Dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if !info.IsDir() {
+		return nil, errors.Errorf("%s is not a directory", cfg.Dir)
+	}
+
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+
+	r := &Reader{
+		cfg:  cfg,
+		msgs: make(chan *Message, cfg.MessageBufferSize),
+		stop: make(chan struct{}),
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.err = r.run()
+		if r.err != nil {
+			log.Error("pb reader stop", zap.String("dir", cfg.Dir), zap.Error(r.err))
+		}
+		close(r.msgs)
+	}()
+
+	return r, nil
+}
+
+// Messages returns the channel of the binlogs read, it's closed once the
+// Reader is closed or meets an error, which can be got by Error.
+func (r *Reader) Messages() <-chan *Message {
+	return r.msgs
+}
+
+// Error returns the error which stops the Reader, it should be called after
+// the channel returned by Messages is closed.
+func (r *Reader) Error() error {
+	return r.err
+}
+
+// Close stops reading and waits for the reading goroutine to exit
+func (r *Reader) Close() {
+	close(r.stop)
+	r.wg.Wait()
+}
+
+// wait returns false if the Reader is closed during waiting
+func (r *Reader) wait() bool {
+	select {
+	case <-r.stop:
+		return false
+	case <-time.After(r.cfg.PollInterval):
+		return true
+	}
+}
+
+func (r *Reader) run() error {
+	var pos Position
+	if r.cfg.Pos != nil {
+		pos = *r.cfg.Pos
+	} else {
+		name, ok, err := r.waitFile(func(names []string) (string, bool, error) {
+			return names[0], true, nil
+		})
+		if err != nil || !ok {
+			return errors.Trace(err)
+		}
+		if pos.Index, _, err = binlogfile.ParseBinlogName(name); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	for {
+		index := pos.Index
+		name, ok, err := r.waitFile(func(names []string) (string, bool, error) {
+			return findFile(names, index)
+		})
+		if err != nil || !ok {
+			return errors.Trace(err)
+		}
+
+		ok, err = r.tailFile(path.Join(r.cfg.Dir, name), &pos)
+		if err != nil || !ok {
+			return errors.Trace(err)
+		}
+
+		pos = Position{Index: pos.Index + 1}
+	}
+}
+
+// findFile returns the name of the file with the index, false is returned if
+// it's not created yet, and an error if it has been purged.
+func findFile(names []string, index uint64) (string, bool, error) {
+	for _, name := range names {
+		curIndex, _, err := binlogfile.ParseBinlogName(name)
+		if err != nil {
+			return "", false, errors.Trace(err)
+		}
+		if curIndex == index {
+			return name, true, nil
+		}
+		if curIndex > index {
+			return "", false, errors.Annotatef(binlogfile.ErrFileNotFound, "index %d", index)
+		}
+	}
+	return "", false, nil
+}
+
+// waitFile waits until find returns a file name, false is returned if the
+// Reader is closed during waiting.
+func (r *Reader) waitFile(find func(names []string) (string, bool, error)) (string, bool, error) {
+	for {
+		names, err := binlogfile.ReadDir(r.cfg.Dir)
+		if err != nil {
+			return "", false, errors.Trace(err)
+		}
+		names = binlogfile.FilterBinlogNames(names)
+
+		if len(names) > 0 {
+			name, ok, err := find(names)
+			if err != nil {
+				return "", false, errors.Trace(err)
+			}
+			if ok {
+				return name, true, nil
+			}
+		}
+
+		if !r.wait() {
+			return "", false, nil
+		}
+	}
+}
+
+// nextFileExists returns true if drainer has rotated to the next file, which
+// means no more binlogs will be written to the file of the index.
+func (r *Reader) nextFileExists(index uint64) (bool, error) {
+	names, err := binlogfile.ReadDir(r.cfg.Dir)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	_, ok, err := findFile(binlogfile.FilterBinlogNames(names), index+1)
+	return ok, errors.Trace(err)
+}
+
+// tailFile reads the binlogs from the file starting at pos.Offset, and returns
+// true once all binlogs are read and drainer has rotated to the next file.
+func (r *Reader) tailFile(fpath string, pos *Position) (bool, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	defer f.Close()
+
+	log.Info("pb reader open file", zap.String("file", fpath), zap.Int64("offset", pos.Offset))
+
+	reset := func() (*bufio.Reader, error) {
+		if _, err := f.Seek(pos.Offset, io.SeekStart); err != nil {
+			return nil, errors.Trace(err)
+		}
+		return bufio.NewReader(f), nil
+	}
+
+	reader, err := reset()
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	rotated := false
+	for {
+		payload, length, err := binlogfile.Decode(reader)
+		if err == nil {
+			pos.Offset += length
+
+			binlog := new(pb.Binlog)
+			if err = binlog.Unmarshal(payload); err != nil {
+				return false, errors.Annotatef(err, "unmarshal binlog in %s at offset %d", fpath, pos.Offset-length)
+			}
+			if binlog.CommitTs <= r.cfg.CommitTS {
+				continue
+			}
+
+			select {
+			case r.msgs <- &Message{Binlog: binlog, Pos: *pos}:
+			case <-r.stop:
+				return false, nil
+			}
+			continue
+		}
+
+		cause := errors.Cause(err)
+		if cause != io.EOF && cause != io.ErrUnexpectedEOF {
+			return false, errors.Annotatef(err, "decode binlog in %s at offset %d", fpath, pos.Offset)
+		}
+
+		if rotated {
+			// the file is complete once the next file is created
+			if cause == io.ErrUnexpectedEOF {
+				return false, errors.Errorf("incomplete binlog in %s at offset %d", fpath, pos.Offset)
+			}
+			return true, nil
+		}
+
+		// the binlog may be partially written, read it again later
+		if reader, err = reset(); err != nil {
+			return false, errors.Trace(err)
+		}
+
+		if rotated, err = r.nextFileExists(pos.Index); err != nil {
+			return false, errors.Trace(err)
+		}
+		// read again to make sure all the binlogs written before rotating are read
+		if !rotated && !r.wait() {
+			return false, nil
+		}
+	}
+}
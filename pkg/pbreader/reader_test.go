@@ -0,0 +1,162 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pbreader
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	gb "github.com/pingcap/tipb/go-binlog"
+)
+
+func TestReader(t *testing.T) {
+	TestingT(t)
+}
+
+type readerSuite struct{}
+
+var _ = Suite(&readerSuite{})
+
+func writeBinlogs(c *C, binlogger binlogfile.Binlogger, from, to int64) {
+	for ts := from; ts <= to; ts++ {
+		binlog := &pb.Binlog{CommitTs: ts}
+		data, err := binlog.Marshal()
+		c.Assert(err, IsNil)
+		_, err = binlogger.WriteTail(&gb.Entity{Payload: data})
+		c.Assert(err, IsNil)
+	}
+}
+
+func readBinlogs(c *C, r *Reader, n int) []*Message {
+	var msgs []*Message
+	for len(msgs) < n {
+		select {
+		case msg, ok := <-r.Messages():
+			c.Assert(ok, IsTrue, Commentf("error: %v", r.Error()))
+			msgs = append(msgs, msg)
+		case <-time.After(5 * time.Second):
+			c.Fatalf("timeout, %d binlogs read", len(msgs))
+		}
+	}
+	return msgs
+}
+
+func (s *readerSuite) TestTail(c *C) {
+	dir := c.MkDir()
+	// rotate every 3 binlogs
+	binlogger, err := binlogfile.OpenBinlogger(dir, 40)
+	c.Assert(err, IsNil)
+	defer binlogger.Close()
+
+	writeBinlogs(c, binlogger, 1, 5)
+
+	r, err := NewReader(&Config{Dir: dir, CommitTS: 1, PollInterval: 10 * time.Millisecond})
+	c.Assert(err, IsNil)
+
+	msgs := readBinlogs(c, r, 4)
+	for i, msg := range msgs {
+		c.Assert(msg.Binlog.CommitTs, Equals, int64(i+2))
+	}
+
+	// keep reading the binlogs written later
+	writeBinlogs(c, binlogger, 6, 10)
+	msgs = append(msgs, readBinlogs(c, r, 5)...)
+	for i, msg := range msgs {
+		c.Assert(msg.Binlog.CommitTs, Equals, int64(i+2))
+	}
+	r.Close()
+	_, ok := <-r.Messages()
+	c.Assert(ok, IsFalse)
+	c.Assert(r.Error(), IsNil)
+
+	names, err := binlogfile.ReadBinlogNames(dir)
+	c.Assert(err, IsNil)
+	c.Assert(len(names), Greater, 2)
+
+	// resume from the position of each binlog
+	for i, msg := range msgs[:len(msgs)-1] {
+		pos := msg.Pos
+		r, err = NewReader(&Config{Dir: dir, Pos: &pos, PollInterval: 10 * time.Millisecond})
+		c.Assert(err, IsNil)
+		next := readBinlogs(c, r, 1)[0]
+		c.Assert(next.Binlog.CommitTs, Equals, msgs[i+1].Binlog.CommitTs)
+		c.Assert(next.Pos, Equals, msgs[i+1].Pos)
+		r.Close()
+	}
+}
+
+func (s *readerSuite) TestPartialBinlog(c *C) {
+	dir := c.MkDir()
+
+	binlog := &pb.Binlog{CommitTs: 1}
+	data, err := binlog.Marshal()
+	c.Assert(err, IsNil)
+	record := binlogfile.Encode(data)
+
+	fpath := path.Join(dir, binlogfile.BinlogName(0))
+	f, err := os.Create(fpath)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	_, err = f.Write(record[:len(record)-3])
+	c.Assert(err, IsNil)
+
+	r, err := NewReader(&Config{Dir: dir, PollInterval: 10 * time.Millisecond})
+	c.Assert(err, IsNil)
+	defer r.Close()
+
+	select {
+	case msg := <-r.Messages():
+		c.Fatalf("unexpected binlog %v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the rest of the binlog is written
+	_, err = f.Write(record[len(record)-3:])
+	c.Assert(err, IsNil)
+	msg := readBinlogs(c, r, 1)[0]
+	c.Assert(msg.Binlog.CommitTs, Equals, int64(1))
+	c.Assert(msg.Pos, Equals, Position{Index: 0, Offset: int64(len(record))})
+}
+
+func (s *readerSuite) TestPurgedFile(c *C) {
+	dir := c.MkDir()
+	binlogger, err := binlogfile.OpenBinlogger(dir, 1)
+	c.Assert(err, IsNil)
+	defer binlogger.Close()
+	writeBinlogs(c, binlogger, 1, 3)
+
+	r, err := NewReader(&Config{Dir: dir, Pos: &Position{Index: 100}, PollInterval: 10 * time.Millisecond})
+	c.Assert(err, IsNil)
+	defer r.Close()
+
+	// wait until the index is created
+	select {
+	case <-r.Messages():
+		c.Fatal("unexpected binlog")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.Assert(os.Remove(path.Join(dir, binlogfile.BinlogName(0))), IsNil)
+	r2, err := NewReader(&Config{Dir: dir, Pos: &Position{Index: 0}, PollInterval: 10 * time.Millisecond})
+	c.Assert(err, IsNil)
+	defer r2.Close()
+	_, ok := <-r2.Messages()
+	c.Assert(ok, IsFalse)
+	c.Assert(r2.Error(), ErrorMatches, ".*file not found.*")
+}
@@ -0,0 +1,239 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	xproxy "golang.org/x/net/proxy"
+)
+
+// The types of the proxies.
+const (
+	TypeSSH    = "ssh"
+	TypeSOCKS5 = "socks5"
+)
+
+const dialTimeout = 10 * time.Second
+
+// Config is the proxy the connections are dialed through, like an SSH bastion or a SOCKS5 proxy.
+type Config struct {
+	// Type is "ssh" or "socks5", empty if the connections are dialed directly.
+	Type string `toml:"type" json:"type"`
+	// Addr is the host:port of the SSH server or the SOCKS5 proxy.
+	Addr     string `toml:"addr" json:"addr"`
+	User     string `toml:"user" json:"user"`
+	Password string `toml:"password" json:"password"`
+	// KeyFile is the private key authenticating the SSH user, it's tried before the password.
+	KeyFile string `toml:"key-file" json:"key-file"`
+	// KnownHostsFile is the known_hosts file verifying the host key of the SSH server.
+	KnownHostsFile string `toml:"known-hosts-file" json:"known-hosts-file"`
+}
+
+// Enabled returns whether the connections are dialed through the proxy.
+func (c *Config) Enabled() bool {
+	return len(c.Type) > 0
+}
+
+// Validate checks whether the config is valid.
+func (c *Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if len(c.Addr) == 0 {
+		return errors.New("addr of proxy is not set")
+	}
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		return errors.Annotatef(err, "invalid addr of proxy: %s", c.Addr)
+	}
+	switch c.Type {
+	case TypeSSH:
+		if len(c.User) == 0 {
+			return errors.New("user of ssh proxy is not set")
+		}
+		if len(c.KeyFile) == 0 && len(c.Password) == 0 {
+			return errors.New("key-file or password of ssh proxy must be set")
+		}
+		// the host key must be verified, or the bastion may be impersonated to steal the password.
+		if len(c.KnownHostsFile) == 0 {
+			return errors.New("known-hosts-file of ssh proxy is not set")
+		}
+	case TypeSOCKS5:
+	default:
+		return errors.Errorf("invalid type of proxy: %s, must be one of ssh, socks5", c.Type)
+	}
+	return nil
+}
+
+// Dialer dials the connections through the proxy.
+type Dialer interface {
+	// DialContext dials the TCP address through the proxy.
+	DialContext(ctx context.Context, addr string) (net.Conn, error)
+	// Close closes the connection to the proxy, the connections dialed through it may be closed too.
+	Close() error
+}
+
+// NewDialer returns the Dialer of the proxy.
+func NewDialer(cfg *Config) (Dialer, error) {
+	switch cfg.Type {
+	case TypeSSH:
+		return newSSHDialer(cfg)
+	case TypeSOCKS5:
+		return newSOCKS5Dialer(cfg)
+	default:
+		return nil, errors.Errorf("invalid type of proxy: %s", cfg.Type)
+	}
+}
+
+type socks5Dialer struct {
+	dialer xproxy.ContextDialer
+}
+
+func newSOCKS5Dialer(cfg *Config) (*socks5Dialer, error) {
+	var auth *xproxy.Auth
+	if len(cfg.User) > 0 {
+		auth = &xproxy.Auth{User: cfg.User, Password: cfg.Password}
+	}
+	dialer, err := xproxy.SOCKS5("tcp", cfg.Addr, auth, &net.Dialer{Timeout: dialTimeout})
+	if err != nil {
+		return nil, errors.Annotate(err, "create socks5 dialer failed")
+	}
+	return &socks5Dialer{dialer: dialer.(xproxy.ContextDialer)}, nil
+}
+
+func (d *socks5Dialer) DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(ctx, "tcp", addr)
+	return conn, errors.Annotatef(err, "dial %s through socks5 proxy failed", addr)
+}
+
+func (d *socks5Dialer) Close() error {
+	return nil
+}
+
+// sshDialer dials the connections as the channels of one SSH connection to the server,
+// the SSH connection is established again if it's broken.
+type sshDialer struct {
+	addr   string
+	config *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+func newSSHDialer(cfg *Config) (*sshDialer, error) {
+	hostKeyCallback, err := knownhosts.New(cfg.KnownHostsFile)
+	if err != nil {
+		return nil, errors.Annotatef(err, "load known-hosts-file %s failed", cfg.KnownHostsFile)
+	}
+
+	var auths []ssh.AuthMethod
+	if len(cfg.KeyFile) > 0 {
+		key, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, errors.Annotatef(err, "read key-file %s failed", cfg.KeyFile)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, errors.Annotatef(err, "parse key-file %s failed", cfg.KeyFile)
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+	if len(cfg.Password) > 0 {
+		auths = append(auths, ssh.Password(cfg.Password))
+	}
+
+	return &sshDialer{
+		addr: cfg.Addr,
+		config: &ssh.ClientConfig{
+			User:            cfg.User,
+			Auth:            auths,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         dialTimeout,
+		},
+	}, nil
+}
+
+func (d *sshDialer) getClient(ctx context.Context) (*ssh.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	conn, err := (&net.Dialer{Timeout: dialTimeout}).DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, errors.Annotatef(err, "dial ssh server %s failed", d.addr)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, d.addr, d.config)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Annotatef(err, "connect to ssh server %s failed", d.addr)
+	}
+	log.Info("connected to ssh server", zap.String("addr", d.addr))
+	d.client = ssh.NewClient(c, chans, reqs)
+	return d.client, nil
+}
+
+// resetClient closes the client if it's still used, so the next dial establishes a new one.
+func (d *sshDialer) resetClient(client *ssh.Client) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client == client {
+		d.client.Close()
+		d.client = nil
+	}
+}
+
+func (d *sshDialer) DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	client, err := d.getClient(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	conn, err := client.Dial("tcp", addr)
+	if err == nil {
+		return conn, nil
+	}
+
+	// the ssh connection may be broken, like after the server restarts, dial again with a new one.
+	log.Warn("dial through ssh server failed, reconnect to it", zap.String("addr", addr), zap.Error(err))
+	d.resetClient(client)
+	if client, err = d.getClient(ctx); err != nil {
+		return nil, errors.Trace(err)
+	}
+	conn, err = client.Dial("tcp", addr)
+	return conn, errors.Annotatef(err, "dial %s through ssh server %s failed", addr, d.addr)
+}
+
+func (d *sshDialer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client == nil {
+		return nil
+	}
+	err := d.client.Close()
+	d.client = nil
+	return errors.Trace(err)
+}
@@ -0,0 +1,225 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	. "github.com/pingcap/check"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type testProxySuite struct{}
+
+var _ = Suite(&testProxySuite{})
+
+// listen serves the connections by handle until the listener is closed.
+func listen(c *C, handle func(net.Conn)) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return l
+}
+
+func echo(conn net.Conn) {
+	defer conn.Close()
+	io.Copy(conn, conn)
+}
+
+func assertEcho(c *C, conn net.Conn) {
+	defer conn.Close()
+	_, err := conn.Write([]byte("ping"))
+	c.Assert(err, IsNil)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "ping")
+}
+
+func (s *testProxySuite) TestValidate(c *C) {
+	c.Assert((&Config{}).Validate(), IsNil)
+	c.Assert((&Config{Type: "http", Addr: "127.0.0.1:80"}).Validate(), ErrorMatches, "invalid type of proxy.*")
+	c.Assert((&Config{Type: TypeSOCKS5}).Validate(), ErrorMatches, "addr of proxy is not set")
+	c.Assert((&Config{Type: TypeSOCKS5, Addr: "127.0.0.1"}).Validate(), ErrorMatches, "invalid addr of proxy.*")
+	c.Assert((&Config{Type: TypeSOCKS5, Addr: "127.0.0.1:1080"}).Validate(), IsNil)
+
+	cfg := &Config{Type: TypeSSH, Addr: "bastion:22", User: "binlog"}
+	c.Assert(cfg.Validate(), ErrorMatches, "key-file or password.*")
+	cfg.KeyFile = "id_ed25519"
+	c.Assert(cfg.Validate(), ErrorMatches, "known-hosts-file.*")
+	cfg.KnownHostsFile = "known_hosts"
+	c.Assert(cfg.Validate(), IsNil)
+}
+
+// serveSOCKS5 serves a SOCKS5 connection without authentication, it only supports CONNECT to an IPv4 address.
+func serveSOCKS5(conn net.Conn) {
+	defer conn.Close()
+	// greeting: version, the count of methods and the methods.
+	buf := make([]byte, 262)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0})
+	// request: version, CONNECT, reserved, IPv4, address and port.
+	if _, err := io.ReadFull(conn, buf[:10]); err != nil || buf[3] != 1 {
+		return
+	}
+	addr := net.JoinHostPort(net.IP(buf[4:8]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(buf[8:10]))))
+	target, err := net.Dial("tcp", addr)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func (s *testProxySuite) TestSOCKS5(c *C) {
+	target := listen(c, echo)
+	defer target.Close()
+	server := listen(c, serveSOCKS5)
+	defer server.Close()
+
+	dialer, err := NewDialer(&Config{Type: TypeSOCKS5, Addr: server.Addr().String()})
+	c.Assert(err, IsNil)
+	defer dialer.Close()
+
+	conn, err := dialer.DialContext(context.Background(), target.Addr().String())
+	c.Assert(err, IsNil)
+	assertEcho(c, conn)
+}
+
+// newSSHServer returns the handler of the SSH connections authenticated by the password,
+// it forwards the direct-tcpip channels to their targets.
+func newSSHServer(signer ssh.Signer, password string) func(net.Conn) {
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if string(pass) != password {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	return func(conn net.Conn) {
+		_, chans, reqs, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		for newChan := range chans {
+			var req struct {
+				Host       string
+				Port       uint32
+				OriginHost string
+				OriginPort uint32
+			}
+			if newChan.ChannelType() != "direct-tcpip" || ssh.Unmarshal(newChan.ExtraData(), &req) != nil {
+				newChan.Reject(ssh.UnknownChannelType, "unsupported")
+				continue
+			}
+			target, err := net.Dial("tcp", net.JoinHostPort(req.Host, strconv.Itoa(int(req.Port))))
+			if err != nil {
+				newChan.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			ch, chReqs, err := newChan.Accept()
+			if err != nil {
+				target.Close()
+				continue
+			}
+			go ssh.DiscardRequests(chReqs)
+			go func() {
+				defer ch.Close()
+				defer target.Close()
+				go io.Copy(target, ch)
+				io.Copy(ch, target)
+			}()
+		}
+	}
+}
+
+func (s *testProxySuite) TestSSH(c *C) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	c.Assert(err, IsNil)
+	signer, err := ssh.NewSignerFromKey(key)
+	c.Assert(err, IsNil)
+
+	target := listen(c, echo)
+	defer target.Close()
+	server := listen(c, newSSHServer(signer, "secret"))
+	defer server.Close()
+
+	knownHosts := filepath.Join(c.MkDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(server.Addr().String())}, signer.PublicKey())
+	c.Assert(os.WriteFile(knownHosts, []byte(line+"\n"), 0600), IsNil)
+
+	cfg := &Config{Type: TypeSSH, Addr: server.Addr().String(), User: "binlog", Password: "secret", KnownHostsFile: knownHosts}
+	dialer, err := NewDialer(cfg)
+	c.Assert(err, IsNil)
+	defer dialer.Close()
+
+	conn, err := dialer.DialContext(context.Background(), target.Addr().String())
+	c.Assert(err, IsNil)
+	assertEcho(c, conn)
+
+	// reconnect after the ssh connection is broken.
+	d := dialer.(*sshDialer)
+	d.client.Close()
+	conn, err = dialer.DialContext(context.Background(), target.Addr().String())
+	c.Assert(err, IsNil)
+	assertEcho(c, conn)
+
+	// the host key must be known.
+	c.Assert(os.WriteFile(knownHosts, nil, 0600), IsNil)
+	dialer, err = NewDialer(cfg)
+	c.Assert(err, IsNil)
+	_, err = dialer.DialContext(context.Background(), target.Addr().String())
+	c.Assert(err, ErrorMatches, ".*knownhosts: key is unknown.*")
+
+	// wrong password.
+	cfg.Password = "guess"
+	c.Assert(os.WriteFile(knownHosts, []byte(line+"\n"), 0600), IsNil)
+	dialer, err = NewDialer(cfg)
+	c.Assert(err, IsNil)
+	_, err = dialer.DialContext(context.Background(), target.Addr().String())
+	c.Assert(err, ErrorMatches, ".*unable to authenticate.*")
+}
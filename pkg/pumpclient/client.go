@@ -0,0 +1,372 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pumpclient writes the binlogs to the pumps like TiDB does, the pump of a prewrite binlog is
+// selected by a strategy, and its commit binlog is written to the same pump. It's used to test the
+// high availability of writing binlogs deterministically with MockPump.
+package pumpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	pb "github.com/pingcap/tipb/go-binlog"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWriteTimeout     = 15 * time.Second
+	defaultCommitRetryTimes = 3
+	defaultCommitRetryWait  = 100 * time.Millisecond
+	maxCommitRetryWait      = 10 * time.Second
+)
+
+// ErrNoAvailablePump is returned if a prewrite binlog can't be written to any pump.
+var ErrNoAvailablePump = errors.New("no available pump to write binlog")
+
+// Config is the configuration of Client.
+type Config struct {
+	// Strategy is the strategy to select the pump of a prewrite binlog, one of Hash, Range and LocalFirst.
+	Strategy string
+	// LocalHost is the host of the local pumps for LocalFirst, the hostname by default.
+	LocalHost string
+	// WriteTimeout is the timeout of writing a binlog to a pump.
+	WriteTimeout time.Duration
+	// CommitRetryTimes is the times to retry writing a commit binlog to the pump of its prewrite binlog.
+	CommitRetryTimes int
+	// CommitRetryWait is the interval between the retries of writing a commit binlog.
+	CommitRetryWait time.Duration
+	TLS             *tls.Config
+}
+
+func (cfg *Config) adjust() error {
+	if len(cfg.Strategy) == 0 {
+		cfg.Strategy = Range
+	}
+	if cfg.Strategy == LocalFirst && len(cfg.LocalHost) == 0 {
+		host, err := os.Hostname()
+		if err != nil {
+			return errors.Annotate(err, "get hostname for local-first strategy")
+		}
+		cfg.LocalHost = host
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = defaultWriteTimeout
+	}
+	if cfg.CommitRetryTimes <= 0 {
+		cfg.CommitRetryTimes = defaultCommitRetryTimes
+	}
+	if cfg.CommitRetryWait <= 0 {
+		cfg.CommitRetryWait = defaultCommitRetryWait
+	}
+	return nil
+}
+
+// Stats are the counts of the binlogs written by Client.
+type Stats struct {
+	Prewrites int64
+	Commits   int64
+	// Failures are the failed writes to the pumps, including the retries.
+	Failures int64
+	// LostCommits are the commit binlogs failed to be written, pump resolves them by the status of
+	// the txns in TiKV.
+	LostCommits int64
+}
+
+// Client writes the binlogs to the pumps.
+type Client struct {
+	clusterID uint64
+	cfg       Config
+	selector  Selector
+
+	mu sync.Mutex
+	// available and unavailable are the online pumps by whether the last write succeeded, the
+	// selector selects from the available ones.
+	available   map[string]*Pump
+	unavailable map[string]*Pump
+	// prewritten maps the start ts of a txn to the pump its prewrite binlog is written to.
+	prewritten map[int64]*Pump
+	stats      Stats
+}
+
+// NewClient creates a Client writing the binlogs of the cluster, set the pumps by SetPumps.
+func NewClient(clusterID uint64, cfg Config) (*Client, error) {
+	if err := cfg.adjust(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	selector, err := NewSelector(cfg.Strategy, cfg.LocalHost)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Client{
+		clusterID:   clusterID,
+		cfg:         cfg,
+		selector:    selector,
+		available:   make(map[string]*Pump),
+		unavailable: make(map[string]*Pump),
+		prewritten:  make(map[int64]*Pump),
+	}, nil
+}
+
+// SetPumps sets the pumps by their status in etcd, only the online ones are written to. A pump
+// unavailable for a failed write keeps unavailable until it succeeds in a retry of a prewrite binlog
+// or it's set again after it's offline.
+func (c *Client) SetPumps(statuses []*node.Status) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	online := make(map[string]*node.Status, len(statuses))
+	for _, status := range statuses {
+		if status.State == node.Online {
+			online[status.NodeID] = status
+		}
+	}
+	for _, pumps := range []map[string]*Pump{c.available, c.unavailable} {
+		for id, pump := range pumps {
+			if status, ok := online[id]; !ok || status.Addr != pump.Addr {
+				pump.reset()
+				delete(pumps, id)
+			}
+		}
+	}
+	for id, status := range online {
+		if _, ok := c.unavailable[id]; ok {
+			continue
+		}
+		if _, ok := c.available[id]; !ok {
+			c.available[id] = newPump(id, status.Addr, c.cfg.TLS)
+		}
+	}
+	c.updateSelector()
+}
+
+func (c *Client) updateSelector() {
+	pumps := make([]*Pump, 0, len(c.available))
+	for _, pump := range c.available {
+		pumps = append(pumps, pump)
+	}
+	c.selector.SetPumps(pumps)
+}
+
+// setAvailable moves the pump between the available and unavailable ones, it's ignored if the pump
+// is removed by SetPumps.
+func (c *Client) setAvailable(pump *Pump, available bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	from, to := c.available, c.unavailable
+	if available {
+		from, to = to, from
+	}
+	if from[pump.NodeID] != pump {
+		return
+	}
+	delete(from, pump.NodeID)
+	to[pump.NodeID] = pump
+	c.updateSelector()
+	log.Info("set pump available", zap.String("node id", pump.NodeID), zap.Bool("available", available))
+}
+
+// Pumps returns the node IDs of the available and unavailable pumps.
+func (c *Client) Pumps() (available []string, unavailable []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id := range c.available {
+		available = append(available, id)
+	}
+	for id := range c.unavailable {
+		unavailable = append(unavailable, id)
+	}
+	return
+}
+
+// Stats returns the counts of the binlogs written.
+func (c *Client) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// WriteBinlog writes the binlog to a pump. A prewrite binlog is written to the pump selected by the
+// strategy, the other available pumps are tried in the order of the strategy if it fails, then the
+// unavailable ones, ErrNoAvailablePump is returned if all fail. A commit or rollback binlog is written
+// to the pump of its prewrite binlog with retries, no error is returned if it fails since pump
+// resolves the txn by its status in TiKV.
+func (c *Client) WriteBinlog(ctx context.Context, binlog *pb.Binlog) error {
+	payload, err := binlog.Marshal()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req := &pb.WriteBinlogReq{ClusterID: c.clusterID, Payload: payload}
+
+	if binlog.Tp == pb.BinlogType_Prewrite {
+		pump, err := c.writePrewrite(ctx, binlog.StartTs, req)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		c.mu.Lock()
+		c.prewritten[binlog.StartTs] = pump
+		c.stats.Prewrites++
+		c.mu.Unlock()
+		return nil
+	}
+
+	c.mu.Lock()
+	pump, ok := c.prewritten[binlog.StartTs]
+	delete(c.prewritten, binlog.StartTs)
+	c.mu.Unlock()
+	if !ok {
+		return errors.Errorf("the prewrite binlog of start ts %d isn't written by the client", binlog.StartTs)
+	}
+	return c.writeCommit(ctx, pump, binlog, req)
+}
+
+func (c *Client) writePrewrite(ctx context.Context, startTS int64, req *pb.WriteBinlogReq) (*Pump, error) {
+	c.mu.Lock()
+	count := len(c.available)
+	c.mu.Unlock()
+
+	tried := make(map[*Pump]struct{})
+	var failed []*Pump
+	defer func() {
+		for _, pump := range failed {
+			c.setAvailable(pump, false)
+		}
+	}()
+
+	var lastErr error
+	for retry := 0; retry < count; retry++ {
+		pump := c.selector.Select(startTS, retry)
+		if pump == nil {
+			break
+		}
+		if _, ok := tried[pump]; ok {
+			continue
+		}
+		tried[pump] = struct{}{}
+
+		err := c.write(ctx, pump, req)
+		if err == nil {
+			return pump, nil
+		}
+		if !isRetryableError(err) {
+			return nil, errors.Annotatef(err, "write prewrite binlog of start ts %d to pump %s", startTS, pump.NodeID)
+		}
+		failed = append(failed, pump)
+		lastErr = err
+	}
+
+	// try the unavailable pumps, they're available again once they succeed.
+	c.mu.Lock()
+	unavailable := make([]*Pump, 0, len(c.unavailable))
+	for _, pump := range c.unavailable {
+		unavailable = append(unavailable, pump)
+	}
+	c.mu.Unlock()
+	for _, pump := range sortPumps(unavailable) {
+		if _, ok := tried[pump]; ok {
+			continue
+		}
+		err := c.write(ctx, pump, req)
+		if err == nil {
+			c.setAvailable(pump, true)
+			return pump, nil
+		}
+		lastErr = err
+	}
+
+	if lastErr != nil {
+		return nil, errors.Annotatef(ErrNoAvailablePump, "start ts %d, the last error: %v", startTS, lastErr)
+	}
+	return nil, errors.Annotatef(ErrNoAvailablePump, "start ts %d", startTS)
+}
+
+func (c *Client) writeCommit(ctx context.Context, pump *Pump, binlog *pb.Binlog, req *pb.WriteBinlogReq) error {
+	wait := c.cfg.CommitRetryWait
+	var err error
+	for i := 0; i <= c.cfg.CommitRetryTimes; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return errors.Trace(ctx.Err())
+			}
+			if wait *= 2; wait > maxCommitRetryWait {
+				wait = maxCommitRetryWait
+			}
+		}
+		if err = c.write(ctx, pump, req); err == nil {
+			c.mu.Lock()
+			c.stats.Commits++
+			c.mu.Unlock()
+			return nil
+		}
+		if !isRetryableError(err) {
+			break
+		}
+	}
+
+	log.Warn("write commit binlog failed, pump resolves it by the status of the txn",
+		zap.String("node id", pump.NodeID), zap.Stringer("type", binlog.Tp), zap.Int64("start ts", binlog.StartTs),
+		zap.Int64("commit ts", binlog.CommitTs), zap.Error(err))
+	c.setAvailable(pump, false)
+	c.mu.Lock()
+	c.stats.LostCommits++
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Client) write(ctx context.Context, pump *Pump, req *pb.WriteBinlogReq) error {
+	err := pump.write(ctx, req, c.cfg.WriteTimeout)
+	if err == nil {
+		return nil
+	}
+	log.Warn("write binlog to pump failed", zap.String("node id", pump.NodeID), zap.Error(err))
+	c.mu.Lock()
+	c.stats.Failures++
+	c.mu.Unlock()
+	if errorcode.FromGRPCError(err) == errorcode.Unknown {
+		// the connection may be broken, create it again on the next write.
+		pump.reset()
+	}
+	return err
+}
+
+// isRetryableError returns false if the binlog is rejected by every pump, like from another cluster.
+func isRetryableError(err error) bool {
+	switch errorcode.FromGRPCError(err) {
+	case errorcode.ClusterIDMismatch, errorcode.InvalidArgument:
+		return false
+	}
+	return true
+}
+
+// Close closes the connections to the pumps.
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, pumps := range []map[string]*Pump{c.available, c.unavailable} {
+		for _, pump := range pumps {
+			pump.reset()
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pumpclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	pb "github.com/pingcap/tipb/go-binlog"
+)
+
+const testClusterID = 42
+
+type clientSuite struct {
+	pumps  []*MockPump
+	client *Client
+}
+
+var _ = Suite(&clientSuite{})
+
+func (s *clientSuite) SetUpTest(c *C) {
+	s.pumps = nil
+	var statuses []*node.Status
+	for i := 1; i <= 3; i++ {
+		pump, err := NewMockPump(fmt.Sprintf("pump%d", i), "127.0.0.1:0", testClusterID)
+		c.Assert(err, IsNil)
+		s.pumps = append(s.pumps, pump)
+		statuses = append(statuses, pump.Status())
+	}
+
+	var err error
+	s.client, err = NewClient(testClusterID, Config{Strategy: Hash, WriteTimeout: time.Second, CommitRetryWait: time.Millisecond})
+	c.Assert(err, IsNil)
+	s.client.SetPumps(statuses)
+}
+
+func (s *clientSuite) TearDownTest(c *C) {
+	s.client.Close()
+	for _, pump := range s.pumps {
+		pump.Close()
+	}
+}
+
+func (s *clientSuite) writeTxn(c *C, startTS int64) {
+	ctx := context.Background()
+	c.Assert(s.client.WriteBinlog(ctx, &pb.Binlog{Tp: pb.BinlogType_Prewrite, StartTs: startTS}), IsNil)
+	c.Assert(s.client.WriteBinlog(ctx, &pb.Binlog{Tp: pb.BinlogType_Commit, StartTs: startTS, CommitTs: startTS + 1}), IsNil)
+}
+
+// startTSs returns the start ts of the binlogs written to the pump.
+func (s *clientSuite) startTSs(pump *MockPump) []int64 {
+	var ts []int64
+	for _, binlog := range pump.Binlogs() {
+		ts = append(ts, binlog.StartTs)
+	}
+	return ts
+}
+
+func (s *clientSuite) pumpIDs(c *C) (available []string, unavailable []string) {
+	available, unavailable = s.client.Pumps()
+	sort.Strings(available)
+	sort.Strings(unavailable)
+	return
+}
+
+func (s *clientSuite) TestHash(c *C) {
+	for ts := int64(3); ts <= 5; ts++ {
+		s.writeTxn(c, ts)
+	}
+	c.Assert(s.startTSs(s.pumps[0]), DeepEquals, []int64{3, 3})
+	c.Assert(s.startTSs(s.pumps[1]), DeepEquals, []int64{4, 4})
+	c.Assert(s.startTSs(s.pumps[2]), DeepEquals, []int64{5, 5})
+	c.Assert(s.client.Stats(), DeepEquals, Stats{Prewrites: 3, Commits: 3})
+
+	err := s.client.WriteBinlog(context.Background(), &pb.Binlog{Tp: pb.BinlogType_Rollback, StartTs: 6})
+	c.Assert(err, ErrorMatches, "the prewrite binlog of start ts 6 isn't written by the client")
+}
+
+func (s *clientSuite) TestFailover(c *C) {
+	s.pumps[0].SetError(errorcode.New(errorcode.PumpDraining, "pump is draining"), -1)
+	s.writeTxn(c, 3)
+	c.Assert(s.pumps[0].Binlogs(), HasLen, 0)
+	c.Assert(s.startTSs(s.pumps[1]), DeepEquals, []int64{3, 3})
+	available, unavailable := s.pumpIDs(c)
+	c.Assert(available, DeepEquals, []string{"pump2", "pump3"})
+	c.Assert(unavailable, DeepEquals, []string{"pump1"})
+
+	// the broken connection is failed over too.
+	s.pumps[2].Close()
+	s.writeTxn(c, 5)
+	c.Assert(s.startTSs(s.pumps[1]), DeepEquals, []int64{3, 3, 5, 5})
+	available, unavailable = s.pumpIDs(c)
+	c.Assert(available, DeepEquals, []string{"pump2"})
+	c.Assert(unavailable, DeepEquals, []string{"pump1", "pump3"})
+
+	// the unavailable pumps are tried if all the available ones fail.
+	s.pumps[0].SetError(nil, 0)
+	s.pumps[1].SetError(errorcode.New(errorcode.PumpDiskFull, "disk is full"), -1)
+	s.writeTxn(c, 6)
+	c.Assert(s.startTSs(s.pumps[0]), DeepEquals, []int64{6, 6})
+	available, unavailable = s.pumpIDs(c)
+	c.Assert(available, DeepEquals, []string{"pump1"})
+	c.Assert(unavailable, DeepEquals, []string{"pump2", "pump3"})
+
+	s.pumps[0].SetError(errorcode.New(errorcode.PumpNotOnline, "pump is paused"), -1)
+	err := s.client.WriteBinlog(context.Background(), &pb.Binlog{Tp: pb.BinlogType_Prewrite, StartTs: 7})
+	c.Assert(errors.Cause(err), Equals, ErrNoAvailablePump)
+
+	// the unavailable pump is available again once it succeeds.
+	s.pumps[0].SetError(nil, 0)
+	s.writeTxn(c, 8)
+	c.Assert(s.startTSs(s.pumps[0]), DeepEquals, []int64{6, 6, 8, 8})
+	available, unavailable = s.pumpIDs(c)
+	c.Assert(available, DeepEquals, []string{"pump1"})
+	c.Assert(unavailable, DeepEquals, []string{"pump2", "pump3"})
+
+	// the removed pumps are dropped, and they're available after they're set again.
+	s.client.SetPumps([]*node.Status{s.pumps[0].Status()})
+	available, unavailable = s.pumpIDs(c)
+	c.Assert(available, DeepEquals, []string{"pump1"})
+	c.Assert(unavailable, HasLen, 0)
+	s.pumps[1].SetError(nil, 0)
+	s.client.SetPumps([]*node.Status{s.pumps[0].Status(), s.pumps[1].Status()})
+	available, unavailable = s.pumpIDs(c)
+	c.Assert(available, DeepEquals, []string{"pump1", "pump2"})
+	c.Assert(unavailable, HasLen, 0)
+}
+
+func (s *clientSuite) TestNotRetryable(c *C) {
+	client, err := NewClient(testClusterID+1, Config{Strategy: Range})
+	c.Assert(err, IsNil)
+	defer client.Close()
+	client.SetPumps([]*node.Status{s.pumps[0].Status(), s.pumps[1].Status()})
+
+	err = client.WriteBinlog(context.Background(), &pb.Binlog{Tp: pb.BinlogType_Prewrite, StartTs: 1})
+	c.Assert(err, ErrorMatches, ".*cluster ID are mismatch.*")
+	c.Assert(client.Stats(), DeepEquals, Stats{Failures: 1})
+	available, _ := client.Pumps()
+	c.Assert(available, HasLen, 2)
+}
+
+func (s *clientSuite) TestCommitRetry(c *C) {
+	ctx := context.Background()
+	c.Assert(s.client.WriteBinlog(ctx, &pb.Binlog{Tp: pb.BinlogType_Prewrite, StartTs: 3}), IsNil)
+	s.pumps[0].SetError(errors.New("timeout"), 2)
+	c.Assert(s.client.WriteBinlog(ctx, &pb.Binlog{Tp: pb.BinlogType_Commit, StartTs: 3, CommitTs: 4}), IsNil)
+	c.Assert(s.startTSs(s.pumps[0]), DeepEquals, []int64{3, 3})
+	c.Assert(s.client.Stats(), DeepEquals, Stats{Prewrites: 1, Commits: 1, Failures: 2})
+
+	// the commit binlog is never written to the other pumps.
+	c.Assert(s.client.WriteBinlog(ctx, &pb.Binlog{Tp: pb.BinlogType_Prewrite, StartTs: 6}), IsNil)
+	s.pumps[0].SetError(errors.New("timeout"), -1)
+	c.Assert(s.client.WriteBinlog(ctx, &pb.Binlog{Tp: pb.BinlogType_Commit, StartTs: 6, CommitTs: 7}), IsNil)
+	c.Assert(s.startTSs(s.pumps[0]), DeepEquals, []int64{3, 3, 6})
+	c.Assert(s.pumps[1].Binlogs(), HasLen, 0)
+	c.Assert(s.pumps[2].Binlogs(), HasLen, 0)
+	c.Assert(s.client.Stats(), DeepEquals, Stats{Prewrites: 2, Commits: 1, Failures: 6, LostCommits: 1})
+	_, unavailable := s.pumpIDs(c)
+	c.Assert(unavailable, DeepEquals, []string{"pump1"})
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pumpclient
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	pb "github.com/pingcap/tipb/go-binlog"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// MockPump is a pump server keeping the binlogs written to it in memory for the tests, the errors of
+// the writes can be injected by SetError.
+type MockPump struct {
+	NodeID    string
+	Addr      string
+	ClusterID uint64
+
+	listener net.Listener
+	server   *grpc.Server
+
+	mu      sync.Mutex
+	binlogs []*pb.Binlog
+	err     error
+	// failures is the number of the following writes failed with err, negative means all.
+	failures int
+}
+
+// NewMockPump starts a MockPump of the cluster listening on addr, like "127.0.0.1:0" for a random port.
+func NewMockPump(nodeID string, addr string, clusterID uint64) (*MockPump, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	p := &MockPump{
+		NodeID:    nodeID,
+		Addr:      listener.Addr().String(),
+		ClusterID: clusterID,
+		listener:  listener,
+		server:    grpc.NewServer(),
+	}
+	pb.RegisterPumpServer(p.server, p)
+	go func() {
+		if err := p.server.Serve(listener); err != nil {
+			log.Warn("mock pump stops serving", zap.String("node id", nodeID), zap.Error(err))
+		}
+	}()
+	return p, nil
+}
+
+// Status returns the online status of the pump, to be set to Client.SetPumps.
+func (p *MockPump) Status() *node.Status {
+	return &node.Status{NodeID: p.NodeID, Addr: p.Addr, State: node.Online}
+}
+
+// SetError makes the following times writes fail with err, all the writes fail if times is negative,
+// the writes succeed again if err is nil. The errors with a code of errorcode are returned with it,
+// like errorcode.PumpDraining.
+func (p *MockPump) SetError(err error, times int) {
+	p.mu.Lock()
+	p.err = err
+	p.failures = times
+	p.mu.Unlock()
+}
+
+// Binlogs returns the binlogs written to the pump.
+func (p *MockPump) Binlogs() []*pb.Binlog {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*pb.Binlog(nil), p.binlogs...)
+}
+
+// WriteBinlog implements pb.PumpServer.
+func (p *MockPump) WriteBinlog(ctx context.Context, req *pb.WriteBinlogReq) (*pb.WriteBinlogResp, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if req.ClusterID != p.ClusterID {
+		err := errorcode.Newf(errorcode.ClusterIDMismatch, "cluster ID are mismatch, %v vs %v", req.ClusterID, p.ClusterID)
+		return nil, errorcode.ToGRPCError(err)
+	}
+	if p.err != nil && p.failures != 0 {
+		if p.failures > 0 {
+			p.failures--
+		}
+		return nil, errorcode.ToGRPCError(p.err)
+	}
+
+	binlog := new(pb.Binlog)
+	if err := binlog.Unmarshal(req.Payload); err != nil {
+		return &pb.WriteBinlogResp{Errmsg: err.Error()}, nil
+	}
+	p.binlogs = append(p.binlogs, binlog)
+	return &pb.WriteBinlogResp{}, nil
+}
+
+// PullBinlogs implements pb.PumpServer, it's not supported.
+func (p *MockPump) PullBinlogs(req *pb.PullBinlogReq, stream pb.Pump_PullBinlogsServer) error {
+	return errorcode.ToGRPCError(errorcode.New(errorcode.InvalidArgument, "pull binlogs isn't supported by mock pump"))
+}
+
+// Close stops the pump, the writes to it fail with Unavailable.
+func (p *MockPump) Close() {
+	p.server.Stop()
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pumpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	pb "github.com/pingcap/tipb/go-binlog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Pump is a pump the binlogs are written to.
+type Pump struct {
+	NodeID string
+	Addr   string
+
+	tlsConfig *tls.Config
+
+	mu     sync.Mutex
+	conn   *grpc.ClientConn
+	client pb.PumpClient
+}
+
+func newPump(nodeID, addr string, tlsConfig *tls.Config) *Pump {
+	return &Pump{NodeID: nodeID, Addr: addr, tlsConfig: tlsConfig}
+}
+
+// Host returns the host of the address of the pump.
+func (p *Pump) Host() string {
+	host, _, err := net.SplitHostPort(p.Addr)
+	if err != nil {
+		return p.Addr
+	}
+	return host
+}
+
+// write writes the request to the pump in the timeout, the connection is created on the first write
+// and after it's reset.
+func (p *Pump) write(ctx context.Context, req *pb.WriteBinlogReq, timeout time.Duration) error {
+	client, err := p.getClient()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	resp, err := client.WriteBinlog(ctx, req)
+	if err != nil {
+		return err
+	}
+	if len(resp.Errmsg) > 0 {
+		return errors.Errorf("write binlog to pump %s failed: %s", p.NodeID, resp.Errmsg)
+	}
+	return nil
+}
+
+func (p *Pump) getClient() (pb.PumpClient, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client != nil {
+		return p.client, nil
+	}
+	opt := grpc.WithInsecure()
+	if p.tlsConfig != nil {
+		opt = grpc.WithTransportCredentials(credentials.NewTLS(p.tlsConfig))
+	}
+	conn, err := grpc.Dial(p.Addr, opt)
+	if err != nil {
+		return nil, errors.Annotatef(err, "dial pump %s(%s)", p.NodeID, p.Addr)
+	}
+	p.conn = conn
+	p.client = pb.NewPumpClient(conn)
+	return p.client, nil
+}
+
+// reset closes the connection, it's created again on the next write.
+func (p *Pump) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.conn = nil
+	p.client = nil
+}
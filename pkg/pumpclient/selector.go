@@ -0,0 +1,148 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pumpclient
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pingcap/errors"
+)
+
+// The strategies to select the pump to write a prewrite binlog to.
+const (
+	// Hash selects the pump by the start ts of the txn.
+	Hash = "hash"
+	// Range selects the pumps in turn.
+	Range = "range"
+	// LocalFirst selects the pumps on the local host by the start ts first, and the other pumps
+	// by the start ts if all the local ones fail.
+	LocalFirst = "local-first"
+)
+
+// Selector selects the pump to write a prewrite binlog to, the commit binlog is always written to the
+// pump of its prewrite binlog. The pumps are sorted by node ID, so the selection is deterministic.
+type Selector interface {
+	// SetPumps sets the available pumps to select from.
+	SetPumps(pumps []*Pump)
+	// Select returns the pump to write the prewrite binlog of the start ts to on the retry-th try
+	// counted from 0, it returns nil if there is no pump.
+	Select(startTS int64, retry int) *Pump
+}
+
+// NewSelector returns the selector of the strategy, localHost is the host of the local pumps
+// for LocalFirst.
+func NewSelector(strategy string, localHost string) (Selector, error) {
+	switch strategy {
+	case Hash:
+		return &hashSelector{}, nil
+	case Range:
+		return &rangeSelector{}, nil
+	case LocalFirst:
+		return &localFirstSelector{host: localHost}, nil
+	default:
+		return nil, errors.Errorf("unknown strategy %s, must be one of %s, %s, %s", strategy, Hash, Range, LocalFirst)
+	}
+}
+
+func sortPumps(pumps []*Pump) []*Pump {
+	sorted := append([]*Pump(nil), pumps...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].NodeID < sorted[j].NodeID })
+	return sorted
+}
+
+func hashPump(pumps []*Pump, startTS int64, retry int) *Pump {
+	if len(pumps) == 0 {
+		return nil
+	}
+	return pumps[int(uint64(startTS+int64(retry))%uint64(len(pumps)))]
+}
+
+type hashSelector struct {
+	mu    sync.RWMutex
+	pumps []*Pump
+}
+
+func (s *hashSelector) SetPumps(pumps []*Pump) {
+	s.mu.Lock()
+	s.pumps = sortPumps(pumps)
+	s.mu.Unlock()
+}
+
+func (s *hashSelector) Select(startTS int64, retry int) *Pump {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return hashPump(s.pumps, startTS, retry)
+}
+
+type rangeSelector struct {
+	mu     sync.Mutex
+	pumps  []*Pump
+	offset int
+}
+
+func (s *rangeSelector) SetPumps(pumps []*Pump) {
+	s.mu.Lock()
+	s.pumps = sortPumps(pumps)
+	s.offset = 0
+	s.mu.Unlock()
+}
+
+func (s *rangeSelector) Select(startTS int64, retry int) *Pump {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pumps) == 0 {
+		return nil
+	}
+	if s.offset >= len(s.pumps) {
+		s.offset = 0
+	}
+	pump := s.pumps[s.offset]
+	s.offset++
+	return pump
+}
+
+type localFirstSelector struct {
+	host string
+
+	mu     sync.RWMutex
+	local  []*Pump
+	remote []*Pump
+}
+
+func (s *localFirstSelector) SetPumps(pumps []*Pump) {
+	var local, remote []*Pump
+	for _, pump := range sortPumps(pumps) {
+		if pump.Host() == s.host {
+			local = append(local, pump)
+		} else {
+			remote = append(remote, pump)
+		}
+	}
+
+	s.mu.Lock()
+	s.local, s.remote = local, remote
+	s.mu.Unlock()
+}
+
+func (s *localFirstSelector) Select(startTS int64, retry int) *Pump {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if retry < len(s.local) {
+		return hashPump(s.local, startTS, retry)
+	}
+	return hashPump(s.remote, startTS, retry-len(s.local))
+}
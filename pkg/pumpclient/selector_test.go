@@ -0,0 +1,88 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pumpclient
+
+import (
+	"testing"
+
+	. "github.com/pingcap/check"
+)
+
+func TestClient(t *testing.T) {
+	TestingT(t)
+}
+
+type selectorSuite struct{}
+
+var _ = Suite(&selectorSuite{})
+
+func (s *selectorSuite) pumps() []*Pump {
+	return []*Pump{
+		newPump("pump3", "192.168.0.2:8250", nil),
+		newPump("pump1", "192.168.0.1:8250", nil),
+		newPump("pump2", "192.168.0.2:8251", nil),
+	}
+}
+
+func (s *selectorSuite) selectIDs(selector Selector, startTS int64, retries int) []string {
+	var ids []string
+	for retry := 0; retry < retries; retry++ {
+		pump := selector.Select(startTS, retry)
+		if pump == nil {
+			ids = append(ids, "")
+			continue
+		}
+		ids = append(ids, pump.NodeID)
+	}
+	return ids
+}
+
+func (s *selectorSuite) TestHash(c *C) {
+	selector, err := NewSelector(Hash, "")
+	c.Assert(err, IsNil)
+	c.Assert(selector.Select(1, 0), IsNil)
+
+	selector.SetPumps(s.pumps())
+	c.Assert(s.selectIDs(selector, 4, 3), DeepEquals, []string{"pump2", "pump3", "pump1"})
+	c.Assert(s.selectIDs(selector, 4, 1), DeepEquals, []string{"pump2"})
+	c.Assert(s.selectIDs(selector, 6, 1), DeepEquals, []string{"pump1"})
+}
+
+func (s *selectorSuite) TestRange(c *C) {
+	selector, err := NewSelector(Range, "")
+	c.Assert(err, IsNil)
+	selector.SetPumps(s.pumps())
+	c.Assert(s.selectIDs(selector, 1, 4), DeepEquals, []string{"pump1", "pump2", "pump3", "pump1"})
+
+	// start over after the pumps are changed.
+	selector.SetPumps(s.pumps()[1:])
+	c.Assert(s.selectIDs(selector, 1, 1), DeepEquals, []string{"pump1"})
+}
+
+func (s *selectorSuite) TestLocalFirst(c *C) {
+	selector, err := NewSelector(LocalFirst, "192.168.0.2")
+	c.Assert(err, IsNil)
+	selector.SetPumps(s.pumps())
+	c.Assert(s.selectIDs(selector, 1, 4), DeepEquals, []string{"pump3", "pump2", "pump1", "pump1"})
+	c.Assert(s.selectIDs(selector, 2, 3), DeepEquals, []string{"pump2", "pump3", "pump1"})
+
+	// no local pump.
+	selector, err = NewSelector(LocalFirst, "192.168.0.3")
+	c.Assert(err, IsNil)
+	selector.SetPumps(s.pumps())
+	c.Assert(s.selectIDs(selector, 1, 3), DeepEquals, []string{"pump2", "pump3", "pump1"})
+
+	_, err = NewSelector("score", "")
+	c.Assert(err, ErrorMatches, "unknown strategy score.*")
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package retry provides the policies of retrying the failed operations, they're
+// shared by the components so the retries behave the same and can be tuned in TOML.
+package retry
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// Policy is how an operation is retried. The wait before the n-th retry is
+// Backoff * Multiplier^(n-1), capped by MaxBackoff, and then randomized by up
+// to Jitter of itself.
+type Policy struct {
+	// MaxAttempts is the max times the operation is tried in total, zero means it's
+	// retried until it succeeds or the context is done.
+	MaxAttempts int `toml:"max-attempts" json:"max-attempts"`
+	// Backoff is the milliseconds waited before the first retry.
+	Backoff int `toml:"backoff" json:"backoff"`
+	// MaxBackoff caps the milliseconds waited before a retry, zero means no cap.
+	MaxBackoff int `toml:"max-backoff" json:"max-backoff"`
+	// Multiplier is how much the wait grows after each retry, 1 or zero keeps it constant.
+	Multiplier float64 `toml:"multiplier" json:"multiplier"`
+	// Jitter is the fraction in [0, 1] of a wait it's randomly shortened or lengthened by,
+	// so the clients failed at the same time don't retry at the same time.
+	Jitter float64 `toml:"jitter" json:"jitter"`
+
+	// IsRetryable classifies the errors, the operation fails at once with an error
+	// not retryable, nil means all errors are retryable.
+	IsRetryable func(error) bool `toml:"-" json:"-"`
+}
+
+// NewPolicy returns the policy trying at most maxAttempts times, and waiting backoff
+// before each retry, the wait is multiplied by multiplier after each retry.
+func NewPolicy(maxAttempts int, backoff time.Duration, multiplier float64) Policy {
+	return Policy{
+		MaxAttempts: maxAttempts,
+		Backoff:     int(backoff / time.Millisecond),
+		Multiplier:  multiplier,
+	}
+}
+
+// Validate checks whether the policy is valid.
+func (p *Policy) Validate() error {
+	if p.MaxAttempts < 0 || p.Backoff < 0 || p.MaxBackoff < 0 {
+		return errors.New("max-attempts, backoff and max-backoff of retry can't be negative")
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return errors.Errorf("invalid multiplier of retry: %v, must be at least 1", p.Multiplier)
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return errors.Errorf("invalid jitter of retry: %v, must be in [0, 1]", p.Jitter)
+	}
+	return nil
+}
+
+// WithRetryable returns a copy of the policy classifying the errors by isRetryable.
+func (p Policy) WithRetryable(isRetryable func(error) bool) Policy {
+	p.IsRetryable = isRetryable
+	return p
+}
+
+func (p *Policy) retryable(err error) bool {
+	return p.IsRetryable == nil || p.IsRetryable(err)
+}
+
+// backoff returns the wait before the n-th retry without jitter.
+func (p *Policy) backoff(n int) time.Duration {
+	wait := float64(p.Backoff)
+	if p.Multiplier > 1 && n > 1 {
+		wait *= math.Pow(p.Multiplier, float64(n-1))
+	}
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	return time.Duration(wait * float64(time.Millisecond))
+}
+
+// Do calls fn until it returns nil, an error not retryable, or it's tried MaxAttempts
+// times, the last error of fn is returned, which is also returned at once if ctx is
+// done while waiting.
+func (p *Policy) Do(ctx context.Context, fn func(context.Context) error) error {
+	b := p.NewBackoffer()
+	for {
+		err := fn(ctx)
+		if err == nil || !p.retryable(err) {
+			return err
+		}
+		if werr := b.Wait(ctx); werr != nil {
+			return err
+		}
+	}
+}
+
+// ErrExhausted is returned by Backoffer.Wait when the policy has been tried MaxAttempts times.
+var ErrExhausted = errors.New("retry attempts exhausted")
+
+// Backoffer tracks the consecutive failures of an operation retried in a loop.
+type Backoffer struct {
+	policy   *Policy
+	failures int
+}
+
+// NewBackoffer returns a Backoffer of the policy.
+func (p *Policy) NewBackoffer() *Backoffer {
+	return &Backoffer{policy: p}
+}
+
+// Failures returns the count of the consecutive failures.
+func (b *Backoffer) Failures() int {
+	return b.failures
+}
+
+// Next records a failure and returns the wait before the next retry, it returns false
+// if the operation has been tried MaxAttempts times.
+func (b *Backoffer) Next() (time.Duration, bool) {
+	b.failures++
+	if b.policy.MaxAttempts > 0 && b.failures >= b.policy.MaxAttempts {
+		return 0, false
+	}
+
+	wait := b.policy.backoff(b.failures)
+	if b.policy.Jitter > 0 && wait > 0 {
+		delta := float64(wait) * b.policy.Jitter
+		wait += time.Duration(delta * (2*rand.Float64() - 1))
+	}
+	return wait, true
+}
+
+// Wait records a failure and waits before the next retry, it returns ErrExhausted if the
+// operation has been tried MaxAttempts times, or the error of ctx if it's done while waiting.
+func (b *Backoffer) Wait(ctx context.Context) error {
+	wait, ok := b.Next()
+	if !ok {
+		return ErrExhausted
+	}
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reset clears the failures after the operation succeeds.
+func (b *Backoffer) Reset() {
+	b.failures = 0
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testRetrySuite{})
+
+type testRetrySuite struct{}
+
+func (s *testRetrySuite) TestValidate(c *C) {
+	p := Policy{MaxAttempts: 3, Backoff: 100, Multiplier: 2, Jitter: 0.2}
+	c.Assert(p.Validate(), IsNil)
+
+	p.Multiplier = 0.5
+	c.Assert(p.Validate(), ErrorMatches, "invalid multiplier of retry.*")
+
+	p.Multiplier = 0
+	p.Jitter = 1.5
+	c.Assert(p.Validate(), ErrorMatches, "invalid jitter of retry.*")
+
+	p.Jitter = 0
+	p.Backoff = -1
+	c.Assert(p.Validate(), ErrorMatches, ".*can't be negative")
+}
+
+func (s *testRetrySuite) TestBackoff(c *C) {
+	p := Policy{MaxAttempts: 5, Backoff: 100, MaxBackoff: 500, Multiplier: 2}
+	b := p.NewBackoffer()
+	var waits []time.Duration
+	for {
+		wait, ok := b.Next()
+		if !ok {
+			break
+		}
+		waits = append(waits, wait)
+	}
+	c.Assert(waits, DeepEquals, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 500 * time.Millisecond})
+	c.Assert(b.Failures(), Equals, 5)
+
+	b.Reset()
+	wait, ok := b.Next()
+	c.Assert(ok, IsTrue)
+	c.Assert(wait, Equals, 100*time.Millisecond)
+
+	p.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		b.Reset()
+		wait, _ = b.Next()
+		c.Assert(wait >= 50*time.Millisecond && wait <= 150*time.Millisecond, IsTrue, Commentf("wait %s", wait))
+	}
+}
+
+func (s *testRetrySuite) TestDo(c *C) {
+	ctx := context.Background()
+	p := Policy{MaxAttempts: 3, Backoff: 1}
+
+	var calls int
+	err := p.Do(ctx, func(context.Context) error {
+		calls++
+		return errors.New("fail")
+	})
+	c.Assert(err, ErrorMatches, "fail")
+	c.Assert(calls, Equals, 3)
+
+	calls = 0
+	err = p.Do(ctx, func(context.Context) error {
+		calls++
+		if calls == 2 {
+			return nil
+		}
+		return errors.New("fail")
+	})
+	c.Assert(err, IsNil)
+	c.Assert(calls, Equals, 2)
+
+	// the errors not retryable fail at once.
+	fatal := errors.New("fatal")
+	p = p.WithRetryable(func(err error) bool { return errors.Cause(err) != fatal })
+	calls = 0
+	err = p.Do(ctx, func(context.Context) error {
+		calls++
+		return errors.Trace(fatal)
+	})
+	c.Assert(errors.Cause(err), Equals, fatal)
+	c.Assert(calls, Equals, 1)
+
+	// retry until the context is done without max attempts.
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	p = Policy{Backoff: 10}
+	calls = 0
+	err = p.Do(ctx, func(context.Context) error {
+		calls++
+		return errors.New("fail")
+	})
+	c.Assert(err, ErrorMatches, "fail")
+	c.Assert(calls, Greater, 1)
+}
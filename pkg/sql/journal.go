@@ -0,0 +1,182 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	tmysql "github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb-binlog/pkg/retry"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Journal records the statements of a transaction, so the whole transaction is replayed
+// when it fails instead of the failing statement only. We can't know which statements are
+// applied when the connection is lost, even the commit may succeed in downstream, so the
+// replays run in safe mode, the INSERTs are replayed as REPLACEs to be idempotent.
+type Journal struct {
+	sqls    []string
+	args    [][]interface{}
+	replays int
+}
+
+// NewJournal creates a Journal of the statements.
+func NewJournal(sqls []string, args [][]interface{}) *Journal {
+	return &Journal{sqls: sqls, args: args}
+}
+
+// Append records a statement.
+func (j *Journal) Append(sql string, args ...interface{}) {
+	j.sqls = append(j.sqls, sql)
+	j.args = append(j.args, args)
+}
+
+// Len returns the number of statements recorded.
+func (j *Journal) Len() int {
+	return len(j.sqls)
+}
+
+// Replays returns how many times the transaction is replayed.
+func (j *Journal) Replays() int {
+	return j.replays
+}
+
+// statements returns the statements to execute, they're rewritten in safe mode in the replays.
+func (j *Journal) statements() []string {
+	if j.replays == 0 {
+		return j.sqls
+	}
+	sqls := make([]string, len(j.sqls))
+	for i, sql := range j.sqls {
+		sqls[i] = SafeModeSQL(sql)
+	}
+	return sqls
+}
+
+var (
+	insertPrefixRegex = regexp.MustCompile(`(?is)^INSERT(\s+(?:LOW_PRIORITY|DELAYED|HIGH_PRIORITY))?(\s+IGNORE)?\s`)
+	onDuplicateRegex  = regexp.MustCompile(`(?i)\sON\s+DUPLICATE\s+KEY\s+UPDATE\s`)
+)
+
+// SafeModeSQL rewrites the INSERT statement to REPLACE, so it can be executed again after
+// it's applied. The INSERT IGNORE and INSERT ... ON DUPLICATE KEY UPDATE statements are
+// kept since they don't fail on the duplicate keys, the other statements are kept too.
+func SafeModeSQL(sql string) string {
+	comments := leadingComments(sql)
+	stmt := strings.TrimLeft(sql[len(comments):], " \t\r\n")
+	loc := insertPrefixRegex.FindStringSubmatchIndex(stmt)
+	if loc == nil || loc[4] >= 0 || onDuplicateRegex.MatchString(stmt) {
+		return sql
+	}
+
+	replace := "REPLACE "
+	// REPLACE doesn't support HIGH_PRIORITY.
+	if loc[2] >= 0 && !strings.EqualFold(strings.TrimSpace(stmt[loc[2]:loc[3]]), "HIGH_PRIORITY") {
+		replace = "REPLACE" + stmt[loc[2]:loc[3]] + " "
+	}
+	return sql[:len(sql)-len(stmt)] + replace + stmt[loc[1]:]
+}
+
+// IsRetryableError checks whether the transaction failed with err can be replayed, the errors
+// of the connection and the transient errors of downstream are retryable, the other errors
+// returned by downstream like the syntax errors are not.
+func IsRetryableError(err error) bool {
+	cause := errors.Cause(err)
+	if cause == driver.ErrBadConn || cause == mysql.ErrInvalidConn || cause == io.EOF {
+		return true
+	}
+	mysqlErr, ok := cause.(*mysql.MySQLError)
+	if !ok {
+		// the outcome is unknown, like the errors of the network.
+		return true
+	}
+	switch mysqlErr.Number {
+	case tmysql.ErrLockWaitTimeout, tmysql.ErrLockDeadlock,
+		tmysql.ErrUnknown, // the transient errors of TiDB like "tikv server is busy"
+		8002,              // ErrForUpdateCantRetry
+		8022,              // ErrTxnRetryable
+		8027,              // ErrInfoSchemaExpired
+		8028,              // ErrInfoSchemaChanged
+		9001,              // ErrPDServerTimeout
+		9002,              // ErrTiKVServerTimeout
+		9003,              // ErrTiKVServerBusy
+		9005,              // ErrRegionUnavailable
+		9007:              // ErrWriteConflict
+		return true
+	default:
+		return false
+	}
+}
+
+// ExecuteJournal executes the statements of the journal in a transaction, the whole
+// transaction is replayed in safe mode on the retryable errors, it's executed at most
+// MaxDMLRetryCount or MaxDDLRetryCount times in total.
+func ExecuteJournal(db *sql.DB, journal *Journal, isDDL bool, hist *prometheus.HistogramVec) error {
+	return ExecuteJournalWithPolicy(db, journal, isDDL, NewRetryPolicy(isDDL), hist)
+}
+
+// NewRetryPolicy returns the policy of replaying the DMLs or the DDLs, it's tried MaxDMLRetryCount
+// or MaxDDLRetryCount times and waits RetryWaitTime before each retry on the retryable errors.
+func NewRetryPolicy(isDDL bool) retry.Policy {
+	retryCount := MaxDMLRetryCount
+	if isDDL {
+		retryCount = MaxDDLRetryCount
+	}
+	return retry.NewPolicy(retryCount, RetryWaitTime, 1).WithRetryable(IsRetryableError)
+}
+
+// ExecuteJournalWithPolicy is like ExecuteJournal, but the transaction is replayed by the policy.
+func ExecuteJournalWithPolicy(db *sql.DB, journal *Journal, isDDL bool, policy retry.Policy, hist *prometheus.HistogramVec) error {
+	if journal.Len() == 0 {
+		return nil
+	}
+
+	tp := "dml"
+	if isDDL {
+		tp = "ddl"
+	}
+
+	var lastErr error
+	err := policy.Do(context.Background(), func(context.Context) error {
+		replay := lastErr != nil
+		if replay {
+			journal.replays++
+			log.Warn("[SQL] replay txn in safe mode", zap.Int("replays", journal.replays), zap.Error(lastErr))
+		}
+
+		lastErr = ExecuteTxnWithHistogram(db, journal.statements(), journal.args, hist)
+		if replay {
+			result := "success"
+			if lastErr != nil {
+				result = "fail"
+			}
+			txnReplayCounter.WithLabelValues(tp, result).Inc()
+		}
+		if lastErr != nil && IsRetryableError(lastErr) {
+			log.Error("[SQL]", zap.Error(lastErr))
+		}
+		return lastErr
+	})
+
+	return errors.Trace(err)
+}
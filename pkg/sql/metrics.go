@@ -0,0 +1,32 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var txnReplayCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "binlog",
+		Subsystem: "sql",
+		Name:      "txn_replay_total",
+		Help:      "Total number of the transactions replayed in safe mode by type(dml/ddl) and result.",
+	}, []string{"type", "result"})
+
+// InitMetrics registers the metrics to registry, it's called by the components executing the
+// transactions by this package.
+func InitMetrics(registry *prometheus.Registry) {
+	registry.MustRegister(txnReplayCounter)
+}
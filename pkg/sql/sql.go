@@ -26,7 +26,6 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	tmysql "github.com/pingcap/parser/mysql"
-	"github.com/pingcap/tidb-binlog/pkg/util"
 	tddl "github.com/pingcap/tidb/ddl"
 	"github.com/pingcap/tidb/infoschema"
 	"github.com/prometheus/client_golang/prometheus"
@@ -50,22 +49,10 @@ func ExecuteSQLs(db *sql.DB, sqls []string, args [][]interface{}, isDDL bool) er
 	return ExecuteSQLsWithHistogram(db, sqls, args, isDDL, nil)
 }
 
-// ExecuteSQLsWithHistogram execute sqls in a transaction with retry.
+// ExecuteSQLsWithHistogram execute sqls in a transaction with retry, the whole
+// transaction is replayed in safe mode on the retryable errors, see ExecuteJournal.
 func ExecuteSQLsWithHistogram(db *sql.DB, sqls []string, args [][]interface{}, isDDL bool, hist *prometheus.HistogramVec) error {
-	if len(sqls) == 0 {
-		return nil
-	}
-
-	retryCount := MaxDMLRetryCount
-	if isDDL {
-		retryCount = MaxDDLRetryCount
-	}
-
-	err := util.RetryOnError(retryCount, RetryWaitTime, "[SQL]", func() error {
-		return ExecuteTxnWithHistogram(db, sqls, args, hist)
-	})
-
-	return errors.Trace(err)
+	return errors.Trace(ExecuteJournal(db, NewJournal(sqls, args), isDDL, hist))
 }
 
 // ExecuteTxn executes transaction
@@ -301,3 +288,46 @@ func QuoteName(name string) string {
 func escapeName(name string) string {
 	return strings.Replace(name, "`", "``", -1)
 }
+
+// KeepLeadingComments prepends the leading comments of origin to sql rewritten
+// from it, like the hints `/*vt+ ... */` and `/*+ ... */` the proxies route
+// the statements by, which are dropped when the statement is restored from AST.
+func KeepLeadingComments(origin string, sql string) string {
+	comments := leadingComments(origin)
+	if len(comments) == 0 || len(sql) == 0 || strings.HasPrefix(sql, comments) {
+		return sql
+	}
+	if !strings.HasSuffix(comments, "\n") {
+		comments += " "
+	}
+	return comments + sql
+}
+
+// leadingComments returns the comments before the statement, the executable
+// comments `/*! ... */` and `/*T! ... */` are not included since they are
+// parts of the statement.
+func leadingComments(sql string) string {
+	end := 0
+	for {
+		rest := strings.TrimLeft(sql[end:], " \t\r\n")
+		start := len(sql) - len(rest)
+		switch {
+		case strings.HasPrefix(rest, "/*!"), strings.HasPrefix(rest, "/*T!"):
+			return sql[:end]
+		case strings.HasPrefix(rest, "/*"):
+			i := strings.Index(rest[2:], "*/")
+			if i < 0 {
+				return sql[:end]
+			}
+			end = start + 2 + i + 2
+		case strings.HasPrefix(rest, "#"), strings.HasPrefix(rest, "-- "), strings.HasPrefix(rest, "--\t"):
+			i := strings.IndexByte(rest, '\n')
+			if i < 0 {
+				return sql[:end]
+			}
+			end = start + i + 1
+		default:
+			return sql[:end]
+		}
+	}
+}
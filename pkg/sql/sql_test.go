@@ -23,6 +23,7 @@ import (
 	"github.com/go-sql-driver/mysql"
 	. "github.com/pingcap/check"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	io_prometheus_client "github.com/prometheus/client_model/go"
 )
 
@@ -37,6 +38,51 @@ func (s *quoteSuite) TestQuoteSchema(c *C) {
 	c.Assert(QuoteSchema("wEi`rd", "Na`me"), Equals, "`wEi``rd`.`Na``me`")
 }
 
+func (s *quoteSuite) TestKeepLeadingComments(c *C) {
+	tests := []struct {
+		origin   string
+		sql      string
+		expected string
+	}{
+		{"/*vt+ SHARD=1 */ create table t(id int)", "CREATE TABLE `t` (`id` INT)", "/*vt+ SHARD=1 */ CREATE TABLE `t` (`id` INT)"},
+		{" /*+ a */ /* b */create table t(id int)", "CREATE TABLE `t` (`id` INT)", " /*+ a */ /* b */ CREATE TABLE `t` (`id` INT)"},
+		{"-- a\n# b\ncreate table t(id int)", "CREATE TABLE `t` (`id` INT)", "-- a\n# b\nCREATE TABLE `t` (`id` INT)"},
+		// the executable comments are parts of the statement.
+		{"/*!40101 create table t(id int) */", "CREATE TABLE `t` (`id` INT)", "CREATE TABLE `t` (`id` INT)"},
+		{"/* a */ /*T![auto_rand] create table t(id int) */", "CREATE TABLE `t` (`id` INT)", "/* a */ CREATE TABLE `t` (`id` INT)"},
+		// not closed.
+		{"/* a create table t(id int)", "CREATE TABLE `t` (`id` INT)", "CREATE TABLE `t` (`id` INT)"},
+		{"create table t(id int) /* a */", "CREATE TABLE `t` (`id` INT)", "CREATE TABLE `t` (`id` INT)"},
+		// not rewritten.
+		{"/* a */ create table t(id int)", "/* a */ create table t(id int)", "/* a */ create table t(id int)"},
+		{"/* a */ alter table t drop index i", "", ""},
+	}
+	for _, t := range tests {
+		c.Assert(KeepLeadingComments(t.origin, t.sql), Equals, t.expected, Commentf("%s", t.origin))
+	}
+}
+
+func (s *quoteSuite) TestSafeModeSQL(c *C) {
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"INSERT INTO t VALUES (?)", "REPLACE INTO t VALUES (?)"},
+		{"/* a */ insert low_priority into t values (?)", "/* a */ REPLACE low_priority into t values (?)"},
+		{"INSERT HIGH_PRIORITY INTO t VALUES (?)", "REPLACE INTO t VALUES (?)"},
+		{"insert\tinto t select * from s", "REPLACE into t select * from s"},
+		// idempotent already.
+		{"INSERT IGNORE INTO t VALUES (?)", "INSERT IGNORE INTO t VALUES (?)"},
+		{"INSERT INTO t VALUES (?) ON DUPLICATE KEY UPDATE a = VALUES(a)", "INSERT INTO t VALUES (?) ON DUPLICATE KEY UPDATE a = VALUES(a)"},
+		{"UPDATE t SET a = ? WHERE id = ?", "UPDATE t SET a = ? WHERE id = ?"},
+		{"/*!40101 INSERT INTO t VALUES (?) */", "/*!40101 INSERT INTO t VALUES (?) */"},
+		{"INSERTED", "INSERTED"},
+	}
+	for _, t := range tests {
+		c.Assert(SafeModeSQL(t.sql), Equals, t.expected, Commentf("%s", t.sql))
+	}
+}
+
 type parseCHAddrSuite struct{}
 
 var _ = Suite(&parseCHAddrSuite{})
@@ -80,6 +126,15 @@ func (s *SQLErrSuite) TestGetSQLErrCode(c *C) {
 	c.Assert(ok, IsTrue)
 }
 
+func (s *SQLErrSuite) TestIsRetryableError(c *C) {
+	c.Assert(IsRetryableError(mysql.ErrInvalidConn), IsTrue)
+	c.Assert(IsRetryableError(errors.New("connection reset by peer")), IsTrue)
+	c.Assert(IsRetryableError(&mysql.MySQLError{Number: 1213}), IsTrue)
+	c.Assert(IsRetryableError(&mysql.MySQLError{Number: 9007}), IsTrue)
+	c.Assert(IsRetryableError(&mysql.MySQLError{Number: 1064}), IsFalse)
+	c.Assert(IsRetryableError(&mysql.MySQLError{Number: 1062}), IsFalse)
+}
+
 func (s *SQLErrSuite) TestIgnoreDDLError(c *C) {
 	c.Assert(IgnoreDDLError(&mysql.MySQLError{Number: 1146}), IsTrue)
 	c.Assert(IgnoreDDLError(&mysql.MySQLError{Number: 1032}), IsFalse)
@@ -250,3 +305,37 @@ func (s *sqlSuite) TestExecuteSQLsWithRetryAndFailure(c *C) {
 	err := ExecuteSQLs(s.db, []string{query}, [][]interface{}{nil}, true)
 	c.Assert(err, ErrorMatches, "syntax error")
 }
+
+func (s *sqlSuite) TestExecuteJournalReplayInSafeMode(c *C) {
+	insert := "INSERT INTO foo VALUES (?)"
+	before := testutil.ToFloat64(txnReplayCounter.WithLabelValues("dml", "success"))
+
+	// the commit may succeed in downstream though the connection is lost.
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(insert).WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectExec(testQuery1).WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectCommit().WillReturnError(mysql.ErrInvalidConn)
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec("REPLACE INTO foo VALUES").WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectExec(testQuery1).WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectCommit()
+
+	journal := NewJournal(nil, nil)
+	journal.Append(insert, 1)
+	journal.Append(testQuery1, 1)
+	c.Assert(ExecuteJournal(s.db, journal, false, nil), IsNil)
+	c.Assert(journal.Replays(), Equals, 1)
+	c.Assert(testutil.ToFloat64(txnReplayCounter.WithLabelValues("dml", "success"))-before, Equals, 1.0)
+}
+
+func (s *sqlSuite) TestExecuteJournalNotRetryable(c *C) {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(testQuery1).WithArgs(1).WillReturnError(&mysql.MySQLError{Number: 1146, Message: "table doesn't exist"})
+	s.mock.ExpectRollback()
+
+	journal := NewJournal([]string{testQuery1}, [][]interface{}{{1}})
+	err := ExecuteJournal(s.db, journal, false, nil)
+	c.Assert(err, ErrorMatches, ".*table doesn't exist")
+	c.Assert(journal.Replays(), Equals, 0)
+}
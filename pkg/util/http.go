@@ -17,6 +17,8 @@ import (
 	"fmt"
 
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+	"go.uber.org/zap"
 )
 
 const (
@@ -29,9 +31,10 @@ const (
 
 // Response represents message that returns to client
 type Response struct {
-	Message string      `json:"message"`
-	Code    int         `json:"code"`
-	Data    interface{} `json:"data"`
+	Message   string         `json:"message"`
+	Code      int            `json:"code"`
+	ErrorCode errorcode.Code `json:"error_code,omitempty"`
+	Data      interface{}    `json:"data"`
 }
 
 // SuccessResponse returns a success response.
@@ -54,10 +57,16 @@ func NotFoundResponsef(format string, args ...interface{}) *Response {
 
 // ErrResponsef returns a error response.
 func ErrResponsef(format string, args ...interface{}) *Response {
+	return ErrCodeResponsef(errorcode.Unknown, format, args...)
+}
+
+// ErrCodeResponsef returns a error response with the error code.
+func ErrCodeResponsef(code errorcode.Code, format string, args ...interface{}) *Response {
 	errMsg := fmt.Sprintf(format, args...)
-	log.Warn(errMsg)
+	log.Warn(errMsg, zap.String("error-code", string(code)))
 	return &Response{
-		Code:    statusOtherError,
-		Message: errMsg,
+		Code:      statusOtherError,
+		ErrorCode: code,
+		Message:   errMsg,
 	}
 }
@@ -15,6 +15,7 @@ package util
 
 import (
 	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
 )
 
 type httpSuite struct{}
@@ -39,3 +40,10 @@ func (s *httpSuite) TestErrResponsef(c *C) {
 	c.Assert(resp.Message, Equals, "doctor 42")
 	c.Assert(resp.Code, Equals, statusOtherError)
 }
+
+func (s *httpSuite) TestErrCodeResponsef(c *C) {
+	resp := ErrCodeResponsef(errorcode.InvalidState, "state is %s", "paused")
+	c.Assert(resp.Message, Equals, "state is paused")
+	c.Assert(resp.Code, Equals, statusOtherError)
+	c.Assert(resp.ErrorCode, Equals, errorcode.InvalidState)
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+	"github.com/unrolled/render"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LogLevelRequest is the request to change the log level at runtime.
+type LogLevelRequest struct {
+	// Level is one of debug, info, warn and error.
+	Level string `json:"level"`
+	// TTL is the seconds the level lasts, then the level is reverted to the
+	// one before the change, zero means the level lasts until changed again.
+	TTL int `json:"ttl"`
+}
+
+// LogLevelStatus is the current log level.
+type LogLevelStatus struct {
+	Level string `json:"level"`
+	// RevertAt is the time the level is reverted, nil if not to revert.
+	RevertAt *time.Time `json:"revert-at,omitempty"`
+	// RevertTo is the level reverted to.
+	RevertTo string `json:"revert-to,omitempty"`
+}
+
+type logLevelController struct {
+	mu sync.Mutex
+	// the timer to revert the level, nil if not to revert.
+	revert   *time.Timer
+	revertAt time.Time
+	revertTo zapcore.Level
+}
+
+var globalLogLevel logLevelController
+
+func parseLogLevel(level string) (zapcore.Level, error) {
+	var l zapcore.Level
+	switch level {
+	case "debug", "info", "warn", "error":
+		err := l.UnmarshalText([]byte(level))
+		return l, errors.Trace(err)
+	default:
+		return l, errors.Errorf("invalid log level %s, must be debug, info, warn or error", level)
+	}
+}
+
+// set changes the log level, the level is reverted to the one before the
+// first change with TTL after ttl if it's positive.
+func (c *logLevelController) set(level zapcore.Level, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	origin := log.GetLevel()
+	if c.revert != nil {
+		c.revert.Stop()
+		c.revert = nil
+		origin = c.revertTo
+	}
+
+	log.SetLevel(level)
+	log.Info("change log level", zap.Stringer("level", level), zap.Duration("ttl", ttl))
+	if ttl <= 0 {
+		return
+	}
+
+	c.revertAt = time.Now().Add(ttl)
+	c.revertTo = origin
+	var timer *time.Timer
+	timer = time.AfterFunc(ttl, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// the level is changed again.
+		if c.revert != timer {
+			return
+		}
+		c.revert = nil
+		log.SetLevel(origin)
+		log.Info("revert log level", zap.Stringer("level", origin))
+	})
+	c.revert = timer
+}
+
+func (c *logLevelController) status() *LogLevelStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := &LogLevelStatus{Level: log.GetLevel().String()}
+	if c.revert != nil {
+		revertAt := c.revertAt
+		status.RevertAt = &revertAt
+		status.RevertTo = c.revertTo.String()
+	}
+	return status
+}
+
+// HandleLogLevel exposes api to get the log level by GET and change it at
+// runtime by PUT with LogLevelRequest in the body.
+func HandleLogLevel(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	renderJSON := func(resp *Response) {
+		if err := rd.JSON(w, http.StatusOK, resp); err != nil {
+			log.Error("Failed to render JSON response", zap.Error(err))
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		req := new(LogLevelRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			renderJSON(ErrCodeResponsef(errorcode.InvalidArgument, "invalid request: %v", err))
+			return
+		}
+		level, err := parseLogLevel(req.Level)
+		if err != nil {
+			renderJSON(ErrCodeResponsef(errorcode.InvalidArgument, "%v", err))
+			return
+		}
+		if req.TTL < 0 {
+			renderJSON(ErrCodeResponsef(errorcode.InvalidArgument, "invalid ttl %d", req.TTL))
+			return
+		}
+		globalLogLevel.set(level, time.Duration(req.TTL)*time.Second)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	renderJSON(SuccessResponse("success", globalLogLevel.status()))
+}
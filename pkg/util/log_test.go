@@ -14,7 +14,10 @@
 package util
 
 import (
+	"encoding/json"
+	"net/http/httptest"
 	"path"
+	"strings"
 	"time"
 
 	. "github.com/pingcap/check"
@@ -51,3 +54,48 @@ func (s *logSuite) TestInitLogger(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(log.GetLevel(), Equals, zapcore.ErrorLevel)
 }
+
+func (s *logSuite) TestHandleLogLevel(c *C) {
+	origin := log.GetLevel()
+	defer log.SetLevel(origin)
+	log.SetLevel(zapcore.InfoLevel)
+
+	request := func(method string, body string) *Response {
+		w := httptest.NewRecorder()
+		HandleLogLevel(w, httptest.NewRequest(method, "/log-level", strings.NewReader(body)))
+		resp := new(Response)
+		c.Assert(json.Unmarshal(w.Body.Bytes(), resp), IsNil)
+		return resp
+	}
+
+	resp := request("PUT", `{"level": "debug"}`)
+	c.Assert(resp.Code, Equals, 200)
+	c.Assert(log.GetLevel(), Equals, zapcore.DebugLevel)
+	c.Assert(resp.Data.(map[string]interface{})["level"], Equals, "debug")
+
+	// the level is reverted to the one before the first change with ttl.
+	globalLogLevel.set(zapcore.WarnLevel, time.Hour)
+	globalLogLevel.set(zapcore.ErrorLevel, 50*time.Millisecond)
+	status := globalLogLevel.status()
+	c.Assert(status.Level, Equals, "error")
+	c.Assert(status.RevertTo, Equals, "debug")
+	c.Assert(status.RevertAt, NotNil)
+	time.Sleep(200 * time.Millisecond)
+	c.Assert(log.GetLevel(), Equals, zapcore.DebugLevel)
+	c.Assert(globalLogLevel.status().RevertAt, IsNil)
+
+	// the revert is canceled by the change without ttl.
+	globalLogLevel.set(zapcore.WarnLevel, 50*time.Millisecond)
+	resp = request("PUT", `{"level": "info"}`)
+	c.Assert(resp.Code, Equals, 200)
+	time.Sleep(200 * time.Millisecond)
+	c.Assert(log.GetLevel(), Equals, zapcore.InfoLevel)
+
+	resp = request("GET", "")
+	c.Assert(resp.Data.(map[string]interface{})["level"], Equals, "info")
+	resp = request("PUT", `{"level": "fatal"}`)
+	c.Assert(resp.Message, Equals, "invalid log level fatal, must be debug, info, warn or error")
+	resp = request("PUT", `{"level": "debug", "ttl": -1}`)
+	c.Assert(resp.Message, Equals, "invalid ttl -1")
+	c.Assert(log.GetLevel(), Equals, zapcore.InfoLevel)
+}
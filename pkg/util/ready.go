@@ -0,0 +1,141 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/daemon"
+	"github.com/pingcap/log"
+	"github.com/unrolled/render"
+	"go.uber.org/zap"
+)
+
+// sdNotify notifies systemd of the state, it does nothing if the process isn't started by
+// systemd with Type=notify, variable for test.
+var sdNotify = func(state string) {
+	if _, err := daemon.SdNotify(false, state); err != nil {
+		log.Warn("notify systemd failed", zap.String("state", state), zap.Error(err))
+	}
+}
+
+// ReadyStatus is the readiness of a server returned by the /ready API.
+type ReadyStatus struct {
+	Ready bool `json:"ready"`
+	// Pending are the steps of starting not done yet.
+	Pending []string `json:"pending,omitempty"`
+	Closing bool     `json:"closing,omitempty"`
+}
+
+// Readiness tracks the steps of starting a server, like registering to etcd, the server is ready
+// after all the steps are done, and not ready any more once it's closing. systemd is notified of
+// READY=1 and STOPPING=1 if the server is started by it with Type=notify.
+type Readiness struct {
+	mu       sync.Mutex
+	pending  []string
+	closing  bool
+	notified bool
+}
+
+// NewReadiness returns the Readiness of the steps.
+func NewReadiness(steps ...string) *Readiness {
+	return &Readiness{pending: append([]string(nil), steps...)}
+}
+
+// Done marks the step is done.
+func (r *Readiness) Done(step string) {
+	r.mu.Lock()
+	for i, s := range r.pending {
+		if s == step {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			break
+		}
+	}
+	notify := len(r.pending) == 0 && !r.closing && !r.notified
+	if notify {
+		r.notified = true
+	}
+	r.mu.Unlock()
+
+	log.Info("start step is done", zap.String("step", step))
+	if notify {
+		log.Info("server is ready")
+		sdNotify(daemon.SdNotifyReady)
+	}
+}
+
+// Closing marks the server is closing, it's not ready any more.
+func (r *Readiness) Closing() {
+	r.mu.Lock()
+	closing := r.closing
+	r.closing = true
+	r.mu.Unlock()
+
+	if !closing {
+		sdNotify(daemon.SdNotifyStopping)
+	}
+}
+
+// Status returns the readiness of the server.
+func (r *Readiness) Status() ReadyStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return ReadyStatus{
+		Ready:   len(r.pending) == 0 && !r.closing,
+		Pending: append([]string(nil), r.pending...),
+		Closing: r.closing,
+	}
+}
+
+// ServeHTTP serves the /ready API, it responds 200 if the server is ready, otherwise 503,
+// so the orchestration like the readiness probe of kubernetes can tell starting from healthy.
+func (r *Readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	status := r.Status()
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	rd := render.New(render.Options{IndentJSON: true})
+	if err := rd.JSON(w, code, status); err != nil {
+		log.Error("render readiness failed", zap.Error(err))
+	}
+}
+
+// KeepAlive notifies systemd of WATCHDOG=1 at half of the watchdog interval until ctx is done,
+// it returns at once if the watchdog isn't enabled by WatchdogSec of the service.
+func (r *Readiness) KeepAlive(ctx context.Context) {
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		log.Warn("check systemd watchdog failed", zap.Error(err))
+		return
+	}
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sdNotify(daemon.SdNotifyWatchdog)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/pingcap/check"
+)
+
+type readySuite struct{}
+
+var _ = Suite(&readySuite{})
+
+func (s *readySuite) getReady(c *C, r *Readiness) (int, ReadyStatus) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+	var status ReadyStatus
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &status), IsNil)
+	return w.Code, status
+}
+
+func (s *readySuite) TestReadiness(c *C) {
+	var states []string
+	origNotify := sdNotify
+	sdNotify = func(state string) { states = append(states, state) }
+	defer func() { sdNotify = origNotify }()
+
+	r := NewReadiness("storage", "etcd")
+	code, status := s.getReady(c, r)
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(status.Ready, IsFalse)
+	c.Assert(status.Pending, DeepEquals, []string{"storage", "etcd"})
+
+	r.Done("storage")
+	code, status = s.getReady(c, r)
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(status.Pending, DeepEquals, []string{"etcd"})
+	c.Assert(states, HasLen, 0)
+
+	// systemd is notified once when all the steps are done.
+	r.Done("etcd")
+	r.Done("etcd")
+	code, status = s.getReady(c, r)
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(status.Ready, IsTrue)
+	c.Assert(status.Pending, HasLen, 0)
+	c.Assert(states, DeepEquals, []string{"READY=1"})
+
+	r.Closing()
+	r.Closing()
+	code, status = s.getReady(c, r)
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(status.Closing, IsTrue)
+	c.Assert(states, DeepEquals, []string{"READY=1", "STOPPING=1"})
+}
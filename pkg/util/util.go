@@ -28,6 +28,7 @@ import (
 	"github.com/pingcap/log"
 	"github.com/pingcap/parser/model"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
+	"github.com/pingcap/tidb-binlog/pkg/retry"
 	"github.com/pingcap/tidb-binlog/pkg/security"
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/store/tikv/oracle"
@@ -158,16 +159,17 @@ func ToColumnMap(columns []*model.ColumnInfo) map[int64]*model.ColumnInfo {
 
 // RetryOnError defines a action with retry when fn returns error
 func RetryOnError(retryCount int, sleepTime time.Duration, errStr string, fn func() error) error {
-	var err error
-	for i := 0; i < retryCount; i++ {
-		err = fn()
-		if err == nil {
-			break
-		}
-
-		log.Error(errStr, zap.Error(err))
-		time.Sleep(sleepTime)
+	if retryCount <= 0 {
+		return nil
 	}
+	policy := retry.NewPolicy(retryCount, sleepTime, 1)
+	err := policy.Do(context.Background(), func(context.Context) error {
+		err := fn()
+		if err != nil {
+			log.Error(errStr, zap.Error(err))
+		}
+		return err
+	})
 
 	return errors.Trace(err)
 }
@@ -176,21 +178,11 @@ func RetryOnError(retryCount int, sleepTime time.Duration, errStr string, fn fun
 // for at most `retryCount` times.
 // The wait time before the `i`th retry is calculated with `sleepTime` * (`backoffFactor` ** i).
 func RetryContext(ctx context.Context, retryCount int, sleepTime time.Duration, backoffFactor int, fn func(context.Context) error) error {
-	var err error
-	for i := 0; i < retryCount; i++ {
-		err = fn(ctx)
-		if err == nil {
-			break
-		}
-
-		select {
-		case <-time.After(sleepTime):
-		case <-ctx.Done():
-			return err
-		}
-		sleepTime = sleepTime * time.Duration(backoffFactor)
+	if retryCount <= 0 {
+		return nil
 	}
-	return err
+	policy := retry.NewPolicy(retryCount, sleepTime, float64(backoffFactor))
+	return policy.Do(ctx, fn)
 }
 
 // StrictDecodeFile decodes the toml file strictly. If any item in confFile file is not mapped
@@ -14,6 +14,7 @@
 package zk
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -28,20 +29,39 @@ import (
 
 // ParseConnectionString parses a zookeeper connection string in the form of
 // host1:2181,host2:2181/chroot and returns the list of servers, and the chroot.
+// The trailing slashes of chroot are trimmed, so "host:2181/" has no chroot.
 func ParseConnectionString(connectionString string) (nodes []string, chroot string) {
 	nodesAndChroot := strings.SplitN(connectionString, "/", 2)
 	if len(nodesAndChroot) == 2 {
-		chroot = fmt.Sprintf("/%s", nodesAndChroot[1])
+		if trimmed := strings.TrimRight(nodesAndChroot[1], "/"); len(trimmed) > 0 {
+			chroot = fmt.Sprintf("/%s", trimmed)
+		}
 	}
 	nodes = strings.Split(nodesAndChroot[0], ",")
 	return
 }
 
+// ParseAuth parses the authentication in the form of scheme:credential, like
+// digest:user:password, and returns the scheme and the credential.
+func ParseAuth(auth string) (scheme string, credential string, err error) {
+	schemeAndCredential := strings.SplitN(auth, ":", 2)
+	if len(schemeAndCredential) != 2 || len(schemeAndCredential[0]) == 0 || len(schemeAndCredential[1]) == 0 {
+		return "", "", errors.Errorf("invalid zookeeper auth, it should be in the form of scheme:credential")
+	}
+	return schemeAndCredential[0], schemeAndCredential[1], nil
+}
+
 // Config for zookeeper client.
 type Config struct {
 	Chroot         string
 	SessionTimeout time.Duration
 	DialTimeout    time.Duration
+	// TLS is used to connect to the servers if it's not nil.
+	TLS *tls.Config
+	// AuthScheme and Auth are added to the session after connected, like "digest" and "user:password",
+	// they're resubmitted when the session reconnects.
+	AuthScheme string
+	Auth       []byte
 }
 
 // NewDefaultConfig creates a default config.
@@ -71,30 +91,65 @@ func New(servers []string, conf *Config) (*Client, error) {
 	}
 
 	dialer := func(network, address string, timeout time.Duration) (net.Conn, error) {
-		return (&net.Dialer{
+		netDialer := &net.Dialer{
 			Timeout:   conf.DialTimeout, // ignore timeout , since we want to set our own DialTimeout.
 			KeepAlive: time.Second * 60,
-		}).Dial(network, address)
+		}
+		if conf.TLS != nil {
+			return tls.DialWithDialer(netDialer, network, address, conf.TLS)
+		}
+		return netDialer.Dial(network, address)
 	}
 	conn, _, err := zk.Connect(servers, conf.SessionTimeout, zk.WithDialer(dialer))
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
+	if len(conf.AuthScheme) > 0 {
+		if err = addAuth(conn, conf); err != nil {
+			conn.Close()
+			return nil, errors.Trace(err)
+		}
+	}
+
 	return &Client{conn: conn, conf: conf}, nil
 }
 
+// addAuth adds the authentication to the session, it waits for the session to be established
+// at most SessionTimeout.
+func addAuth(conn *zk.Conn, conf *Config) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- conn.AddAuth(conf.AuthScheme, conf.Auth)
+	}()
+	select {
+	case err := <-errCh:
+		return errors.Annotatef(err, "add zookeeper auth of scheme %s", conf.AuthScheme)
+	case <-time.After(conf.SessionTimeout):
+		return errors.Errorf("add zookeeper auth of scheme %s timeout", conf.AuthScheme)
+	}
+}
+
 // NewFromConnectionString creates a new connection instance based on a zookeeer connection string that can include a chroot.
 func NewFromConnectionString(connectionString string, dialTimeout, sessionTimeout time.Duration) (*Client, error) {
-	nodes, chroot := ParseConnectionString(connectionString)
 	conf := NewDefaultConfig()
-	conf.Chroot = chroot
 	if dialTimeout != 0 {
 		conf.DialTimeout = dialTimeout
 	}
 	if sessionTimeout != 0 {
 		conf.SessionTimeout = sessionTimeout
 	}
+	return NewFromConnectionStringWithConfig(connectionString, conf)
+}
+
+// NewFromConnectionStringWithConfig is like NewFromConnectionString, but connects with conf,
+// the chroot of conf is overwritten by the one of the connection string.
+func NewFromConnectionStringWithConfig(connectionString string, conf *Config) (*Client, error) {
+	nodes, chroot := ParseConnectionString(connectionString)
+	if conf == nil {
+		conf = NewDefaultConfig()
+	}
+	conf.Chroot = chroot
 	return New(nodes, conf)
 }
 
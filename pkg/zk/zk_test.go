@@ -60,6 +60,25 @@ func (s *testZKSuite) TestParseConnectionString(c *C) {
 	nodes, chroot = zk.ParseConnectionString("host3:2181,host4:2181,host5:2181")
 	c.Assert(nodes, DeepEquals, []string{"host3:2181", "host4:2181", "host5:2181"})
 	c.Assert(chroot, Equals, "")
+
+	nodes, chroot = zk.ParseConnectionString("host6:2181/")
+	c.Assert(nodes, DeepEquals, []string{"host6:2181"})
+	c.Assert(chroot, Equals, "")
+
+	_, chroot = zk.ParseConnectionString("host7:2181/kafka/")
+	c.Assert(chroot, Equals, "/kafka")
+}
+
+func (s *testZKSuite) TestParseAuth(c *C) {
+	scheme, credential, err := zk.ParseAuth("digest:user:pass:word")
+	c.Assert(err, IsNil)
+	c.Assert(scheme, Equals, "digest")
+	c.Assert(credential, Equals, "user:pass:word")
+
+	for _, auth := range []string{"", "digest", "digest:", ":user:password"} {
+		_, _, err = zk.ParseAuth(auth)
+		c.Assert(err, ErrorMatches, ".*invalid zookeeper auth.*")
+	}
 }
 
 func (s *testZKSuite) TestConnectToVoid(c *C) {
@@ -72,6 +91,18 @@ func (s *testZKSuite) TestConnectToUnreachableNetwork(c *C) {
 	c.Assert(err, NotNil)
 }
 
+func (s *testZKSuite) TestAuthToUnreachableNetwork(c *C) {
+	conf := &zk.Config{
+		SessionTimeout: 100 * time.Millisecond,
+		DialTimeout:    time.Nanosecond,
+		AuthScheme:     "digest",
+		Auth:           []byte("user:password"),
+	}
+	_, err := zk.NewFromConnectionStringWithConfig("127.0.0.1:1/ch", conf)
+	c.Assert(err, ErrorMatches, ".*add zookeeper auth of scheme digest.*")
+	c.Assert(conf.Chroot, Equals, "/ch")
+}
+
 func (s *testZKSuite) TestTopics(c *C) {
 	s.setUpTest(c)
 	defer s.tearDownTest()
@@ -0,0 +1,118 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pump
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// ClientIDKey is the key of the gRPC metadata to identify the TiDB instance
+// writing binlogs, the host of the peer address is used if it's not set.
+const ClientIDKey = "binlog-client-id"
+
+const (
+	unknownClient = "unknown"
+	// otherClients is the id the clients beyond maxAuditClients are counted by.
+	otherClients = "other"
+	// maxAuditClients is the max number of the clients counted by their own ids, which keeps the cardinality
+	// of the client label low if the ids in the metadata are unexpected.
+	maxAuditClients = 256
+)
+
+// ClientStats is the statistics of the binlogs written by a client.
+type ClientStats struct {
+	Writes    int64     `json:"writes"`
+	Bytes     int64     `json:"bytes"`
+	Errors    int64     `json:"errors"`
+	ErrorRate float64   `json:"error-rate"`
+	LastWrite time.Time `json:"last-write"`
+}
+
+// clientAudit counts the binlogs written by every client, the zero value is ready to use. The first
+// maxAuditClients clients are counted by their own ids, the later ones are counted as "other".
+type clientAudit struct {
+	mu      sync.Mutex
+	clients map[string]*ClientStats
+}
+
+// clientID returns the id in the metadata or the host of the peer address.
+func clientID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(ClientIDKey); len(ids) > 0 && len(ids[0]) > 0 {
+			return ids[0]
+		}
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return unknownClient
+	}
+	// the port differs among the connections of a client.
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+func (a *clientAudit) record(client string, size int, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.clients == nil {
+		a.clients = make(map[string]*ClientStats)
+	}
+	stats, ok := a.clients[client]
+	if !ok {
+		if len(a.clients) >= maxAuditClients {
+			client = otherClients
+			stats = a.clients[client]
+		}
+		if stats == nil {
+			stats = new(ClientStats)
+			a.clients[client] = stats
+		}
+	}
+
+	label := "succ"
+	if err != nil {
+		label = "fail"
+	}
+	writeBinlogByClientCounter.WithLabelValues(client, label).Inc()
+	writeBinlogBytesByClientCounter.WithLabelValues(client).Add(float64(size))
+
+	stats.Writes++
+	stats.Bytes += int64(size)
+	if err != nil {
+		stats.Errors++
+	}
+	stats.LastWrite = time.Now()
+}
+
+// snapshot returns a copy of the statistics of all the clients.
+func (a *clientAudit) snapshot() map[string]*ClientStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	clients := make(map[string]*ClientStats, len(a.clients))
+	for id, stats := range a.clients {
+		s := *stats
+		s.ErrorRate = float64(s.Errors) / float64(s.Writes)
+		clients[id] = &s
+	}
+	return clients
+}
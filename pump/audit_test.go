@@ -0,0 +1,78 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pump
+
+import (
+	"fmt"
+	"net"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+type auditSuite struct{}
+
+var _ = Suite(&auditSuite{})
+
+func (s *auditSuite) TestClientID(c *C) {
+	c.Assert(clientID(context.Background()), Equals, unknownClient)
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 52000}})
+	c.Assert(clientID(ctx), Equals, "10.0.0.1")
+
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(ClientIDKey, "tidb-1:4000"))
+	c.Assert(clientID(ctx), Equals, "tidb-1:4000")
+}
+
+func (s *auditSuite) TestRecord(c *C) {
+	var audit clientAudit
+	c.Assert(audit.snapshot(), HasLen, 0)
+
+	audit.record("tidb-1", 10, nil)
+	audit.record("tidb-1", 20, errors.New("write failed"))
+	audit.record("tidb-2", 5, nil)
+
+	clients := audit.snapshot()
+	c.Assert(clients, HasLen, 2)
+	c.Assert(clients["tidb-1"].Writes, Equals, int64(2))
+	c.Assert(clients["tidb-1"].Bytes, Equals, int64(30))
+	c.Assert(clients["tidb-1"].Errors, Equals, int64(1))
+	c.Assert(clients["tidb-1"].ErrorRate, Equals, 0.5)
+	c.Assert(clients["tidb-2"].ErrorRate, Equals, 0.0)
+	c.Assert(clients["tidb-2"].LastWrite.IsZero(), IsFalse)
+}
+
+func (s *auditSuite) TestMaxClients(c *C) {
+	var audit clientAudit
+	for i := 0; i < maxAuditClients; i++ {
+		audit.record(fmt.Sprintf("tidb-%d", i), 10, nil)
+	}
+	audit.record("tidb-new-1", 20, nil)
+	audit.record("tidb-new-2", 30, errors.New("write failed"))
+	// the clients counted already are still counted by their own ids.
+	audit.record("tidb-0", 10, nil)
+
+	clients := audit.snapshot()
+	c.Assert(clients, HasLen, maxAuditClients+1)
+	c.Assert(clients["tidb-0"].Writes, Equals, int64(2))
+	c.Assert(clients["tidb-new-1"], IsNil)
+	c.Assert(clients[otherClients].Writes, Equals, int64(2))
+	c.Assert(clients[otherClients].Bytes, Equals, int64(50))
+	c.Assert(clients[otherClients].Errors, Equals, int64(1))
+	c.Assert(testutil.ToFloat64(writeBinlogBytesByClientCounter.WithLabelValues(otherClients)), Equals, 50.0)
+}
@@ -0,0 +1,328 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pump
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+	pb "github.com/pingcap/tipb/go-binlog"
+)
+
+// decodedBinlog is the JSON rendering of a binlog for debugging.
+type decodedBinlog struct {
+	Tp             string            `json:"tp"`
+	StartTS        int64             `json:"start-ts"`
+	CommitTS       int64             `json:"commit-ts"`
+	PrewriteKey    string            `json:"prewrite-key,omitempty"`
+	DDLJobID       int64             `json:"ddl-job-id,omitempty"`
+	DDLQuery       string            `json:"ddl-query,omitempty"`
+	DDLSchemaState int32             `json:"ddl-schema-state,omitempty"`
+	SchemaVersion  int64             `json:"schema-version,omitempty"`
+	Mutations      []decodedMutation `json:"mutations,omitempty"`
+}
+
+type decodedMutation struct {
+	TableID      int64         `json:"table-id"`
+	Table        string        `json:"table,omitempty"`
+	Sequence     []string      `json:"sequence,omitempty"`
+	InsertedRows []interface{} `json:"inserted-rows,omitempty"`
+	UpdatedRows  []interface{} `json:"updated-rows,omitempty"`
+	DeletedIDs   []int64       `json:"deleted-ids,omitempty"`
+	DeletedPKs   []interface{} `json:"deleted-pks,omitempty"`
+	DeletedRows  []interface{} `json:"deleted-rows,omitempty"`
+}
+
+type decodedInsertedRow struct {
+	Handle []interface{}          `json:"handle"`
+	Row    map[string]interface{} `json:"row"`
+}
+
+type decodedUpdatedRow struct {
+	Old map[string]interface{} `json:"old"`
+	New map[string]interface{} `json:"new"`
+}
+
+// undecodableRow is rendered if the row can't be decoded with the table info.
+type undecodableRow struct {
+	Error string `json:"error"`
+	Hex   string `json:"hex"`
+}
+
+// binlogDecoder decodes the rows of the binlogs by the table infos, the rows
+// of the tables without table info are rendered as hex.
+type binlogDecoder struct {
+	tables map[int64]*model.TableInfo
+	hex    bool
+}
+
+// newBinlogDecoder creates a binlogDecoder with the table infos in JSON, which
+// is one or an array of the table infos returned by the status API of TiDB.
+func newBinlogDecoder(tableInfos io.Reader, hexOnly bool) (*binlogDecoder, error) {
+	d := &binlogDecoder{tables: make(map[int64]*model.TableInfo), hex: hexOnly}
+
+	data, err := io.ReadAll(tableInfos)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return d, nil
+	}
+
+	var infos []*model.TableInfo
+	if data[0] == '[' {
+		err = json.Unmarshal(data, &infos)
+	} else {
+		info := new(model.TableInfo)
+		err = json.Unmarshal(data, info)
+		infos = append(infos, info)
+	}
+	if err != nil {
+		return nil, errors.Annotate(err, "invalid table info")
+	}
+
+	for _, info := range infos {
+		d.tables[info.ID] = info
+		// the mutations of partitioned tables are of the partitions.
+		if pi := info.GetPartitionInfo(); pi != nil {
+			for _, def := range pi.Definitions {
+				d.tables[def.ID] = info
+			}
+		}
+	}
+	return d, nil
+}
+
+// decode renders the binlog, the binlog must be a P-Binlog or a C-Binlog whose
+// prewrite value and DDL are filled from the P-Binlog.
+func (d *binlogDecoder) decode(binlog *pb.Binlog) (*decodedBinlog, error) {
+	res := &decodedBinlog{
+		Tp:             binlog.Tp.String(),
+		StartTS:        binlog.StartTs,
+		CommitTS:       binlog.CommitTs,
+		PrewriteKey:    hex.EncodeToString(binlog.PrewriteKey),
+		DDLJobID:       binlog.DdlJobId,
+		DDLQuery:       string(binlog.DdlQuery),
+		DDLSchemaState: binlog.DdlSchemaState,
+	}
+	if len(binlog.PrewriteValue) == 0 {
+		return res, nil
+	}
+
+	pv := new(pb.PrewriteValue)
+	if err := pv.Unmarshal(binlog.PrewriteValue); err != nil {
+		return nil, errors.Annotate(err, "unmarshal prewrite value")
+	}
+	res.SchemaVersion = pv.SchemaVersion
+	for _, mut := range pv.Mutations {
+		res.Mutations = append(res.Mutations, d.decodeMutation(mut))
+	}
+	return res, nil
+}
+
+func (d *binlogDecoder) decodeMutation(mut pb.TableMutation) decodedMutation {
+	res := decodedMutation{
+		TableID:    mut.TableId,
+		DeletedIDs: mut.DeletedIds,
+	}
+	for _, tp := range mut.Sequence {
+		res.Sequence = append(res.Sequence, tp.String())
+	}
+
+	info := d.tables[mut.TableId]
+	if info != nil {
+		res.Table = info.Name.O
+	}
+	decodeRows := func(rows [][]byte, decodeRow func(*model.TableInfo, []byte) (interface{}, error)) []interface{} {
+		res := make([]interface{}, 0, len(rows))
+		for _, row := range rows {
+			if info == nil || d.hex {
+				res = append(res, hex.EncodeToString(row))
+				continue
+			}
+			v, err := decodeRow(info, row)
+			if err != nil {
+				v = undecodableRow{Error: err.Error(), Hex: hex.EncodeToString(row)}
+			}
+			res = append(res, v)
+		}
+		return res
+	}
+
+	res.InsertedRows = decodeRows(mut.InsertedRows, decodeInsertedRow)
+	res.UpdatedRows = decodeRows(mut.UpdatedRows, decodeUpdatedRow)
+	res.DeletedPKs = decodeRows(mut.DeletedPks, decodeDeletedPK)
+	res.DeletedRows = decodeRows(mut.DeletedRows, decodeDeletedRow)
+	return res
+}
+
+// decodeInsertedRow decodes the row which is the handle followed by the row value.
+func decodeInsertedRow(info *model.TableInfo, row []byte) (interface{}, error) {
+	var pkCols []*model.ColumnInfo
+	if info.IsCommonHandle {
+		for _, idx := range info.Indices {
+			if idx.Primary {
+				for _, col := range idx.Columns {
+					pkCols = append(pkCols, info.Columns[col.Offset])
+				}
+				break
+			}
+		}
+		if len(pkCols) == 0 {
+			return nil, errors.New("clustered index without primary key")
+		}
+	}
+
+	res := decodedInsertedRow{}
+	remain := row
+	for i := 0; i < len(pkCols) || (i == 0 && !info.IsCommonHandle); i++ {
+		var handle types.Datum
+		var err error
+		remain, handle, err = codec.DecodeOne(remain)
+		if err != nil {
+			return nil, errors.Annotate(err, "decode handle")
+		}
+		if info.IsCommonHandle {
+			handle, err = tablecodec.Unflatten(handle, &pkCols[i].FieldType, time.Local)
+			if err != nil {
+				return nil, errors.Annotate(err, "decode handle")
+			}
+		}
+		res.Handle = append(res.Handle, datumValue(handle))
+	}
+
+	datums, err := tablecodec.DecodeRowToDatumMap(remain, util.ToColumnTypeMap(info.Columns), time.Local)
+	if err != nil {
+		return nil, errors.Annotate(err, "decode row")
+	}
+	res.Row = namedValues(info, datums)
+	return res, nil
+}
+
+// decodeUpdatedRow decodes the row which is the pairs of the column id and
+// value, the old value of a column comes before the new value.
+func decodeUpdatedRow(info *model.TableInfo, row []byte) (interface{}, error) {
+	cols := make(map[int64]*model.ColumnInfo, len(info.Columns))
+	for _, col := range info.Columns {
+		cols[col.ID] = col
+	}
+
+	oldDatums := make(map[int64]types.Datum)
+	newDatums := make(map[int64]types.Datum)
+	for remain := row; len(remain) > 0; {
+		var id, data []byte
+		var err error
+		if id, remain, err = codec.CutOne(remain); err != nil {
+			return nil, errors.Annotate(err, "decode column id")
+		}
+		if data, remain, err = codec.CutOne(remain); err != nil {
+			return nil, errors.Annotate(err, "decode column value")
+		}
+		_, cid, err := codec.DecodeOne(id)
+		if err != nil {
+			return nil, errors.Annotate(err, "decode column id")
+		}
+		col, ok := cols[cid.GetInt64()]
+		if !ok {
+			continue
+		}
+
+		v, err := tablecodec.DecodeColumnValue(data, &col.FieldType, time.Local)
+		if err != nil {
+			return nil, errors.Annotatef(err, "decode column %s", col.Name.O)
+		}
+		if _, ok := oldDatums[col.ID]; ok {
+			newDatums[col.ID] = v
+		} else {
+			oldDatums[col.ID] = v
+		}
+	}
+
+	return decodedUpdatedRow{Old: namedValues(info, oldDatums), New: namedValues(info, newDatums)}, nil
+}
+
+func decodeDeletedPK(info *model.TableInfo, pk []byte) (interface{}, error) {
+	datums, err := codec.Decode(pk, 1)
+	if err != nil {
+		return nil, errors.Annotate(err, "decode pk")
+	}
+	values := make([]interface{}, 0, len(datums))
+	for _, d := range datums {
+		values = append(values, datumValue(d))
+	}
+	return values, nil
+}
+
+func decodeDeletedRow(info *model.TableInfo, row []byte) (interface{}, error) {
+	datums, err := tablecodec.DecodeRowToDatumMap(row, util.ToColumnTypeMap(info.Columns), time.Local)
+	if err != nil {
+		return nil, errors.Annotate(err, "decode row")
+	}
+	return namedValues(info, datums), nil
+}
+
+// namedValues converts the datums to the values keyed by the column names,
+// the datums of the unknown columns are keyed by their ids.
+func namedValues(info *model.TableInfo, datums map[int64]types.Datum) map[string]interface{} {
+	values := make(map[string]interface{}, len(datums))
+	for id, d := range datums {
+		name := fmt.Sprintf("#%d", id)
+		for _, col := range info.Columns {
+			if col.ID == id {
+				name = col.Name.O
+				break
+			}
+		}
+		values[name] = datumValue(d)
+	}
+	return values
+}
+
+// datumValue converts the datum to the value rendered in JSON, the numbers are
+// kept as numbers, the invalid utf8 bytes are rendered as hex prefixed by "0x".
+func datumValue(d types.Datum) interface{} {
+	switch d.Kind() {
+	case types.KindNull:
+		return nil
+	case types.KindInt64:
+		return d.GetInt64()
+	case types.KindUint64:
+		return d.GetUint64()
+	case types.KindFloat32, types.KindFloat64:
+		return d.GetFloat64()
+	case types.KindString, types.KindBytes:
+		if b := d.GetBytes(); !utf8.Valid(b) {
+			return "0x" + hex.EncodeToString(b)
+		}
+		return d.GetString()
+	default:
+		s, err := d.ToString()
+		if err != nil {
+			return fmt.Sprintf("%v", d.GetValue())
+		}
+		return s
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pump
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/pingcap/tipb/go-binlog"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+var _ = Suite(&testBinlogDecoderSuite{})
+
+type testBinlogDecoderSuite struct{}
+
+type mapStorage struct {
+	noOpStorage
+	binlogs map[int64]*binlog.Binlog
+}
+
+func (s *mapStorage) GetBinlog(ts int64) (*binlog.Binlog, error) {
+	b, ok := s.binlogs[ts]
+	if !ok {
+		return nil, errors.Annotatef(leveldb.ErrNotFound, "fail read binlog by ts: %d", ts)
+	}
+	return b, nil
+}
+
+func newDecoderTestTable() *model.TableInfo {
+	id := &model.ColumnInfo{ID: 1, Name: model.NewCIStr("id"), Offset: 0, FieldType: *types.NewFieldType(mysql.TypeLong)}
+	id.Flag = mysql.PriKeyFlag
+	name := &model.ColumnInfo{ID: 2, Name: model.NewCIStr("name"), Offset: 1, FieldType: *types.NewFieldType(mysql.TypeVarchar)}
+	data := &model.ColumnInfo{ID: 3, Name: model.NewCIStr("data"), Offset: 2, FieldType: *types.NewFieldType(mysql.TypeBlob)}
+	return &model.TableInfo{
+		ID:         42,
+		Name:       model.NewCIStr("t"),
+		PKIsHandle: true,
+		Columns:    []*model.ColumnInfo{id, name, data},
+	}
+}
+
+func encodeTestRow(c *C, datums ...types.Datum) []byte {
+	var colIDs []int64
+	for i := range datums {
+		colIDs = append(colIDs, int64(i+2))
+	}
+	row, err := tablecodec.EncodeOldRow(&stmtctx.StatementContext{TimeZone: time.Local}, datums, colIDs, nil, nil)
+	c.Assert(err, IsNil)
+	return row
+}
+
+func (s *testBinlogDecoderSuite) TestDecodeBinlog(c *C) {
+	handle, err := codec.EncodeValue(nil, nil, types.NewIntDatum(1))
+	c.Assert(err, IsNil)
+	inserted := append(handle, encodeTestRow(c, types.NewStringDatum("a"), types.NewBytesDatum([]byte{0xff, 0x00}))...)
+
+	// the updated row is the pairs of the encoded column id and value.
+	sc := &stmtctx.StatementContext{TimeZone: time.Local}
+	var updated []byte
+	for _, d := range []types.Datum{types.NewStringDatum("a"), types.NewStringDatum("b")} {
+		id, err := codec.EncodeValue(sc, nil, types.NewIntDatum(2))
+		c.Assert(err, IsNil)
+		updated = append(updated, id...)
+		updated = append(updated, codecValue(c, d)...)
+	}
+	deleted := encodeTestRow(c, types.NewStringDatum("b"))
+
+	pv := &binlog.PrewriteValue{
+		SchemaVersion: 10,
+		Mutations: []binlog.TableMutation{
+			{
+				TableId:      42,
+				InsertedRows: [][]byte{inserted},
+				UpdatedRows:  [][]byte{updated},
+				DeletedRows:  [][]byte{deleted, {0xff}},
+				Sequence:     []binlog.MutationType{binlog.MutationType_Insert, binlog.MutationType_Update, binlog.MutationType_DeleteRow},
+			},
+			{TableId: 43, InsertedRows: [][]byte{inserted}},
+		},
+	}
+	pvData, err := pv.Marshal()
+	c.Assert(err, IsNil)
+
+	server := &Server{storage: &mapStorage{binlogs: map[int64]*binlog.Binlog{
+		100: {Tp: binlog.BinlogType_Prewrite, StartTs: 100, PrewriteValue: pvData},
+		101: {Tp: binlog.BinlogType_Commit, StartTs: 100, CommitTs: 101},
+	}}}
+
+	infoData, err := json.Marshal([]*model.TableInfo{newDecoderTestTable()})
+	c.Assert(err, IsNil)
+
+	request := func(url string, body []byte) *util.Response {
+		w := httptest.NewRecorder()
+		server.DecodeBinlog(w, httptest.NewRequest("GET", url, bytes.NewReader(body)))
+		resp := new(util.Response)
+		c.Assert(json.Unmarshal(w.Body.Bytes(), resp), IsNil)
+		return resp
+	}
+
+	resp := request("/binlog?ts=101", infoData)
+	c.Assert(resp.Code, Equals, 200, Commentf("%s", resp.Message))
+	data, err := json.Marshal(resp.Data)
+	c.Assert(err, IsNil)
+	decoded := new(decodedBinlog)
+	c.Assert(json.Unmarshal(data, decoded), IsNil)
+	c.Assert(decoded.Tp, Equals, "Commit")
+	c.Assert(decoded.StartTS, Equals, int64(100))
+	c.Assert(decoded.CommitTS, Equals, int64(101))
+	c.Assert(decoded.SchemaVersion, Equals, int64(10))
+	c.Assert(decoded.Mutations, HasLen, 2)
+
+	mut := decoded.Mutations[0]
+	c.Assert(mut.Table, Equals, "t")
+	c.Assert(mut.Sequence, DeepEquals, []string{"Insert", "Update", "DeleteRow"})
+	c.Assert(mut.InsertedRows, DeepEquals, []interface{}{map[string]interface{}{
+		"handle": []interface{}{float64(1)},
+		"row":    map[string]interface{}{"name": "a", "data": "0xff00"},
+	}})
+	c.Assert(mut.UpdatedRows, DeepEquals, []interface{}{map[string]interface{}{
+		"old": map[string]interface{}{"name": "a"},
+		"new": map[string]interface{}{"name": "b"},
+	}})
+	c.Assert(mut.DeletedRows[0], DeepEquals, map[string]interface{}{"name": "b"})
+	c.Assert(mut.DeletedRows[1].(map[string]interface{})["hex"], Equals, "ff")
+
+	// the rows of the table without table info are rendered as hex.
+	c.Assert(decoded.Mutations[1].Table, Equals, "")
+	c.Assert(decoded.Mutations[1].InsertedRows, DeepEquals, []interface{}{hex.EncodeToString(inserted)})
+
+	// all rows are rendered as hex in hex format.
+	resp = request("/binlog?ts=100&format=hex", infoData)
+	c.Assert(resp.Code, Equals, 200)
+	c.Assert(resp.Data.(map[string]interface{})["mutations"].([]interface{})[0].(map[string]interface{})["inserted-rows"],
+		DeepEquals, []interface{}{hex.EncodeToString(inserted)})
+
+	resp = request("/binlog?ts=102", nil)
+	c.Assert(resp.Message, Equals, "binlog of ts 102 not found")
+	resp = request("/binlog?ts=abc", nil)
+	c.Assert(resp.Message, Matches, "invalid parameter ts: abc")
+	resp = request("/binlog?ts=101&format=xml", nil)
+	c.Assert(resp.Message, Matches, "invalid parameter format: xml.*")
+	resp = request("/binlog?ts=101", []byte("{"))
+	c.Assert(resp.Message, Matches, "invalid table info.*")
+}
+
+func codecValue(c *C, d types.Datum) []byte {
+	data, err := tablecodec.EncodeValue(&stmtctx.StatementContext{TimeZone: time.Local}, nil, d)
+	c.Assert(err, IsNil)
+	return data
+}
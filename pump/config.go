@@ -43,6 +43,10 @@ const (
 
 	// default interval time to generate fake binlog, the unit is second
 	defaultGenFakeBinlogInterval = 3
+
+	// default intervals of retrying the heartbeat after it fails, the unit is second
+	defaultEtcdRetryInterval    = 1
+	defaultEtcdMaxRetryInterval = 30
 )
 
 // globalConfig is global config of pump to be used in any where
@@ -65,6 +69,13 @@ type Config struct {
 	EtcdDialTimeout   time.Duration
 	DataDir           string `toml:"data-dir" json:"data-dir"`
 	HeartbeatInterval int    `toml:"heartbeat-interval" json:"heartbeat-interval"`
+	// LeaseTTL is the seconds of the lease the online pump registered in etcd is attached to, the
+	// registration is deleted if pump doesn't renew it in time. 0 means no lease.
+	LeaseTTL int `toml:"lease-ttl" json:"lease-ttl"`
+	// EtcdRetryInterval and EtcdMaxRetryInterval are the seconds of the backoff of retrying the
+	// heartbeat after it fails, pump registers itself again after etcd is recovered.
+	EtcdRetryInterval    int `toml:"etcd-retry-interval" json:"etcd-retry-interval"`
+	EtcdMaxRetryInterval int `toml:"etcd-max-retry-interval" json:"etcd-max-retry-interval"`
 	// pump only stores binlog events whose ts >= current time - GC Time. The default unit is day
 	GC       util.Duration   `toml:"gc" json:"gc"`
 	LogFile  string          `toml:"log-file" json:"log-file"`
@@ -72,6 +83,19 @@ type Config struct {
 
 	GenFakeBinlogInterval int `toml:"gen-binlog-interval" json:"gen-binlog-interval"`
 
+	// StatusAddr is the addr to serve the HTTP API like /status and /metrics on instead of
+	// ListenAddr, then ListenAddr only serves gRPC. AdvertiseStatusAddr is registered in etcd
+	// for the tools to call the HTTP API, it's StatusAddr by default.
+	StatusAddr          string `toml:"status-addr" json:"status-addr"`
+	AdvertiseStatusAddr string `toml:"advertise-status-addr" json:"advertise-status-addr"`
+
+	// EnableImport serves the HTTP API /binlog/import to import the binlogs generated outside TiDB,
+	// it isn't authenticated unless cert-allowed-cn of the security config is set to verify the client certificates.
+	EnableImport bool `toml:"enable-import" json:"enable-import"`
+
+	// DatabaseMetrics breaks down the binlogs written by their databases in the metrics.
+	DatabaseMetrics DatabaseMetricsConfig `toml:"database-metrics" json:"database-metrics"`
+
 	MetricsAddr     string
 	MetricsInterval int
 	configFile      string
@@ -96,12 +120,19 @@ func NewConfig() *Config {
 	fs.StringVar(&cfg.NodeID, "node-id", "", "the ID of pump node; if not specified, we will generate one from hostname and the listening port")
 	fs.StringVar(&cfg.ListenAddr, "addr", util.DefaultListenAddr(8250), "addr(i.e. 'host:port') to listen on for client traffic")
 	fs.StringVar(&cfg.AdvertiseAddr, "advertise-addr", "", "addr(i.e. 'host:port') to advertise to the public")
+	fs.StringVar(&cfg.StatusAddr, "status-addr", "", "addr(i.e. 'host:port') to listen on for the HTTP API, it's served on -addr if not specified")
+	fs.StringVar(&cfg.AdvertiseStatusAddr, "advertise-status-addr", "", "addr(i.e. 'host:port') of the HTTP API to advertise to the public, default to be the same value as -status-addr")
+	fs.BoolVar(&cfg.EnableImport, "enable-import", false, "serve the HTTP API to import the binlogs generated outside TiDB")
 	fs.StringVar(&cfg.Socket, "socket", "", "unix socket addr to listen on for client traffic")
 	fs.StringVar(&cfg.EtcdURLs, "pd-urls", defaultEtcdURLs, "a comma separated list of the PD endpoints")
 	fs.StringVar(&cfg.DataDir, "data-dir", "", "the path to store binlog data")
 	fs.IntVar(&cfg.HeartbeatInterval, "heartbeat-interval", defaultHeartbeatInterval, "number of seconds between heartbeat ticks")
+	fs.IntVar(&cfg.LeaseTTL, "lease-ttl", 0, "number of seconds of the lease of the registration of the online pump in etcd, 0 means no lease")
+	fs.IntVar(&cfg.EtcdRetryInterval, "etcd-retry-interval", defaultEtcdRetryInterval, "number of seconds before retrying the failed heartbeat, doubled on every failure")
+	fs.IntVar(&cfg.EtcdMaxRetryInterval, "etcd-max-retry-interval", defaultEtcdMaxRetryInterval, "max number of seconds before retrying the failed heartbeat")
 	fs.StringVar((*string)(&cfg.GC), "gc", defaultGC, "recycle binlog files older than gc time. default unit is day. also accept 8h format time(max unit is hour)")
 	fs.StringVar(&cfg.LogLevel, "L", "info", "log level: debug, info, warn, error, fatal")
+	fs.IntVar(&cfg.DatabaseMetrics.TopN, "database-metrics-top-n", 0, "max number of the databases with their own series in the metrics of the binlogs written, 0 disables the breakdown by database")
 	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", "", "prometheus pushgateway address, leaves it empty will disable prometheus push")
 	fs.IntVar(&cfg.MetricsInterval, "metrics-interval", 15, "prometheus client push interval in second, set \"0\" to disable prometheus push")
 	fs.StringVar(&cfg.configFile, "config", "", "path to the pump configuration file")
@@ -172,9 +203,22 @@ func (cfg *Config) Parse(arguments []string) error {
 		cfg.ListenAddr = "http://" + cfg.ListenAddr       // add 'http:' scheme to facilitate parsing
 		cfg.AdvertiseAddr = "http://" + cfg.AdvertiseAddr // add 'http:' scheme to facilitate parsing
 	}
+	if len(cfg.StatusAddr) > 0 {
+		util.AdjustString(&cfg.AdvertiseStatusAddr, cfg.StatusAddr)
+		scheme := "http://"
+		if cfg.tls != nil {
+			scheme = "https://"
+		}
+		cfg.StatusAddr = scheme + cfg.StatusAddr
+		cfg.AdvertiseStatusAddr = scheme + cfg.AdvertiseStatusAddr
+	} else if len(cfg.AdvertiseStatusAddr) > 0 {
+		return errors.New("advertise-status-addr is set without status-addr")
+	}
 	util.AdjustDuration(&cfg.EtcdDialTimeout, defaultEtcdDialTimeout)
 	util.AdjustString(&cfg.DataDir, defaultDataDir)
 	util.AdjustInt(&cfg.HeartbeatInterval, defaultHeartbeatInterval)
+	util.AdjustInt(&cfg.EtcdRetryInterval, defaultEtcdRetryInterval)
+	util.AdjustInt(&cfg.EtcdMaxRetryInterval, defaultEtcdMaxRetryInterval)
 
 	return cfg.validate()
 }
@@ -194,6 +238,16 @@ func (cfg *Config) validate() error {
 		return errors.Errorf("parse GC time failed, err: %s", err)
 	}
 
+	if cfg.LeaseTTL < 0 || (cfg.LeaseTTL > 0 && cfg.LeaseTTL <= cfg.HeartbeatInterval) {
+		return errors.Errorf("lease-ttl is %d, must be 0 or bigger than heartbeat-interval %d", cfg.LeaseTTL, cfg.HeartbeatInterval)
+	}
+	if cfg.DatabaseMetrics.TopN < 0 {
+		return errors.Errorf("database-metrics.top-n is %d, must not be negative", cfg.DatabaseMetrics.TopN)
+	}
+	if cfg.EtcdMaxRetryInterval < cfg.EtcdRetryInterval {
+		return errors.Errorf("etcd-max-retry-interval is %d, must not be smaller than etcd-retry-interval %d", cfg.EtcdMaxRetryInterval, cfg.EtcdRetryInterval)
+	}
+
 	// check ListenAddr
 	urllis, err := url.Parse(cfg.ListenAddr)
 	if err != nil {
@@ -218,6 +272,28 @@ func (cfg *Config) validate() error {
 		return errors.Errorf("invalid advertiseAddr host: %v", host)
 	}
 
+	// check StatusAddr and AdvertiseStatusAddr
+	if len(cfg.StatusAddr) > 0 {
+		urlstatus, err := url.Parse(cfg.StatusAddr)
+		if err != nil {
+			return errors.Errorf("parse StatusAddr error: %s, %v", cfg.StatusAddr, err)
+		}
+		if _, _, err = net.SplitHostPort(urlstatus.Host); err != nil {
+			return errors.Errorf("bad StatusAddr host format: %s, %v", urlstatus.Host, err)
+		}
+		urladvstatus, err := url.Parse(cfg.AdvertiseStatusAddr)
+		if err != nil {
+			return errors.Errorf("parse AdvertiseStatusAddr error: %s, %v", cfg.AdvertiseStatusAddr, err)
+		}
+		host, _, err = net.SplitHostPort(urladvstatus.Host)
+		if err != nil {
+			return errors.Errorf("bad AdvertiseStatusAddr host format: %s, %v", urladvstatus.Host, err)
+		}
+		if len(host) == 0 || host == "0.0.0.0" {
+			return errors.Errorf("invalid advertiseStatusAddr host: %v", host)
+		}
+	}
+
 	// check socketAddr
 	if len(cfg.Socket) > 0 {
 		urlsock, err := url.Parse(cfg.Socket)
@@ -240,5 +316,15 @@ func (cfg *Config) validate() error {
 		}
 	}
 
+	if _, err := storage.ParseChecksumAlgorithm(cfg.Storage.Checksum); err != nil {
+		return errors.Annotate(err, "invalid storage.checksum")
+	}
+
+	if len(cfg.Storage.ScrubInterval) > 0 {
+		if _, err := cfg.Storage.ScrubInterval.ParseDuration(); err != nil {
+			return errors.Annotate(err, "invalid storage.scrub-interval")
+		}
+	}
+
 	return nil
 }
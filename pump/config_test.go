@@ -49,6 +49,31 @@ func (s *testConfigSuite) TestValidate(c *C) {
 	cfg.AdvertiseAddr = "http://192.168.11.11:8250"
 	err = cfg.validate()
 	c.Check(err, IsNil)
+
+	cfg.StatusAddr = "http://:8260"
+	cfg.AdvertiseStatusAddr = "http://0.0.0.0:8260"
+	err = cfg.validate()
+	c.Check(err, ErrorMatches, ".*advertiseStatusAddr.*")
+
+	cfg.AdvertiseStatusAddr = "http://10.0.0.1:8260"
+	err = cfg.validate()
+	c.Check(err, IsNil)
+
+	cfg.Storage.Checksum = "md5"
+	err = cfg.validate()
+	c.Check(err, ErrorMatches, "invalid storage.checksum: unknown checksum algorithm md5.*")
+	cfg.Storage.Checksum = ""
+
+	cfg.HeartbeatInterval = 2
+	cfg.LeaseTTL = 2
+	err = cfg.validate()
+	c.Check(err, ErrorMatches, "lease-ttl is 2, must be 0 or bigger than heartbeat-interval 2")
+
+	cfg.LeaseTTL = 10
+	cfg.EtcdRetryInterval = 5
+	cfg.EtcdMaxRetryInterval = 1
+	err = cfg.validate()
+	c.Check(err, ErrorMatches, "etcd-max-retry-interval is 1, must not be smaller than etcd-retry-interval 5")
 }
 
 func (s *testConfigSuite) TestConfigParsingCmdLineFlags(c *C) {
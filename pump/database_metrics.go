@@ -0,0 +1,217 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pump
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/meta"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tipb/go-binlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// DatabaseKey is the key of the gRPC metadata to specify the database of the binlogs written, the
+// database of the table of the primary key of the txn is used if it's not set.
+const DatabaseKey = "binlog-database"
+
+const (
+	// otherDatabases is the label of the databases not in the top N.
+	otherDatabases = "other"
+	// unknownDatabase is the label of the binlogs whose database can't be found.
+	unknownDatabase = "unknown"
+
+	databaseRankInterval   = time.Minute
+	databaseReloadInterval = 10 * time.Second
+)
+
+// DatabaseMetricsConfig is the config of breaking down the binlogs written by their databases.
+type DatabaseMetricsConfig struct {
+	// TopN is the max number of the databases with their own series, the others are counted as
+	// "other". 0 disables the breakdown.
+	TopN int `toml:"top-n" json:"top-n"`
+}
+
+// tableDatabasesLoader returns the names of the databases of the tables by their ids, including the
+// ids of the partitions.
+type tableDatabasesLoader func() (map[int64]string, error)
+
+// databaseMetrics counts the prewrite binlogs and their bytes by the databases. To keep the cardinality
+// low, the databases written most in a minute get their own series until there are TopN of them, the
+// others are counted as "other". All the methods do nothing if it's nil.
+type databaseMetrics struct {
+	topN int
+	load tableDatabasesLoader
+
+	mu sync.Mutex
+	// tracked are the databases with their own series.
+	tracked map[string]struct{}
+	// pending are the bytes of the databases not tracked since rankedAt.
+	pending  map[string]int64
+	rankedAt time.Time
+
+	// tables are the databases of the tables, they're loaded again in the background if a table isn't found.
+	tables   map[int64]string
+	loadedAt time.Time
+	loading  bool
+}
+
+func newDatabaseMetrics(cfg DatabaseMetricsConfig, load tableDatabasesLoader) *databaseMetrics {
+	if cfg.TopN <= 0 {
+		return nil
+	}
+	return &databaseMetrics{
+		topN:     cfg.TopN,
+		load:     load,
+		tracked:  make(map[string]struct{}),
+		pending:  make(map[string]int64),
+		rankedAt: time.Now(),
+		tables:   make(map[int64]string),
+	}
+}
+
+// loadTableDatabases reads the databases of the tables from the schema in TiKV.
+func loadTableDatabases(store kv.Storage) (map[int64]string, error) {
+	version, err := store.CurrentVersion(oracle.GlobalTxnScope)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	m := meta.NewSnapshotMeta(store.GetSnapshot(version))
+	dbs, err := m.ListDatabases()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	tables := make(map[int64]string)
+	for _, db := range dbs {
+		infos, err := m.ListTables(db.ID)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for _, info := range infos {
+			tables[info.ID] = db.Name.O
+			if info.Partition != nil {
+				for _, def := range info.Partition.Definitions {
+					tables[def.ID] = db.Name.O
+				}
+			}
+		}
+	}
+	return tables, nil
+}
+
+// record counts the prewrite binlog written of size bytes.
+func (m *databaseMetrics) record(ctx context.Context, blog *binlog.Binlog, size int) {
+	if m == nil || blog.Tp != binlog.BinlogType_Prewrite {
+		return
+	}
+	now := time.Now()
+	label := m.label(m.databaseOf(ctx, blog.PrewriteKey), int64(size), now)
+	// the start ts of the binlog is kept as the exemplar of the series, to look up the txn of the writes.
+	exemplar := prometheus.Labels{"start_ts": strconv.FormatInt(blog.StartTs, 10)}
+	writeBinlogByDatabaseCounter.addWithExemplar(label, 1, exemplar, now)
+	writeBinlogBytesByDatabaseCounter.addWithExemplar(label, float64(size), exemplar, now)
+}
+
+// databaseOf returns the database in the metadata, or the database of the table of the key.
+func (m *databaseMetrics) databaseOf(ctx context.Context, key []byte) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if dbs := md.Get(DatabaseKey); len(dbs) > 0 && len(dbs[0]) > 0 {
+			return dbs[0]
+		}
+	}
+	tableID := tablecodec.DecodeTableID(key)
+	if tableID == 0 {
+		return unknownDatabase
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if db, ok := m.tables[tableID]; ok {
+		return db
+	}
+	if m.load != nil && !m.loading && time.Since(m.loadedAt) >= databaseReloadInterval {
+		m.loading = true
+		go m.reload()
+	}
+	return unknownDatabase
+}
+
+func (m *databaseMetrics) reload() {
+	tables, err := m.load()
+	if err != nil {
+		log.Warn("load the databases of the tables failed", zap.Error(err))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		m.tables = tables
+	}
+	m.loadedAt = time.Now()
+	m.loading = false
+}
+
+// label returns the label the binlog of the database is counted by, and ranks the databases not
+// tracked every minute.
+func (m *databaseMetrics) label(db string, size int64, now time.Time) string {
+	if db == unknownDatabase {
+		return db
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.tracked[db]; ok {
+		return db
+	}
+	if len(m.tracked) < m.topN {
+		m.pending[db] += size
+		if now.Sub(m.rankedAt) >= databaseRankInterval {
+			m.rank(now)
+		}
+	}
+	return otherDatabases
+}
+
+// rank tracks the databases written most since the last rank until there are topN databases tracked.
+func (m *databaseMetrics) rank(now time.Time) {
+	dbs := make([]string, 0, len(m.pending))
+	for db := range m.pending {
+		dbs = append(dbs, db)
+	}
+	sort.Slice(dbs, func(i, j int) bool {
+		if m.pending[dbs[i]] != m.pending[dbs[j]] {
+			return m.pending[dbs[i]] > m.pending[dbs[j]]
+		}
+		return dbs[i] < dbs[j]
+	})
+	for _, db := range dbs {
+		if len(m.tracked) >= m.topN {
+			break
+		}
+		m.tracked[db] = struct{}{}
+		log.Info("count the binlogs of the database by its own series", zap.String("database", db), zap.Int64("bytes", m.pending[db]))
+	}
+	m.pending = make(map[string]int64)
+	m.rankedAt = now
+}
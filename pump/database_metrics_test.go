@@ -0,0 +1,157 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pump
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tipb/go-binlog"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+type databaseMetricsSuite struct{}
+
+var _ = Suite(&databaseMetricsSuite{})
+
+func (s *databaseMetricsSuite) TestDisabled(c *C) {
+	m := newDatabaseMetrics(DatabaseMetricsConfig{}, nil)
+	c.Assert(m, IsNil)
+	// it does nothing if it's disabled.
+	m.record(context.Background(), &binlog.Binlog{Tp: binlog.BinlogType_Prewrite}, 10)
+}
+
+func (s *databaseMetricsSuite) TestDatabaseOf(c *C) {
+	loaded := make(chan struct{}, 1)
+	var loadErr error
+	m := newDatabaseMetrics(DatabaseMetricsConfig{TopN: 2}, func() (map[int64]string, error) {
+		defer func() { loaded <- struct{}{} }()
+		return map[int64]string{41: "shop", 42: "shop", 50: "log"}, loadErr
+	})
+	ctx := context.Background()
+
+	c.Assert(m.databaseOf(ctx, []byte("m_not_table_key")), Equals, unknownDatabase)
+	// the tables are loaded in the background on the first miss.
+	c.Assert(m.databaseOf(ctx, tablecodec.EncodeRowKeyWithHandle(42, kv.IntHandle(1))), Equals, unknownDatabase)
+	select {
+	case <-loaded:
+	case <-time.After(5 * time.Second):
+		c.Fatal("the tables are not loaded")
+	}
+	c.Assert(waitLoaded(m), IsTrue)
+	c.Assert(m.databaseOf(ctx, tablecodec.EncodeTablePrefix(42)), Equals, "shop")
+	c.Assert(m.databaseOf(ctx, tablecodec.EncodeTablePrefix(50)), Equals, "log")
+
+	// the tables aren't loaded again in a while.
+	c.Assert(m.databaseOf(ctx, tablecodec.EncodeTablePrefix(60)), Equals, unknownDatabase)
+	select {
+	case <-loaded:
+		c.Fatal("the tables are loaded again")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the database in the metadata is used first.
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(DatabaseKey, "billing"))
+	c.Assert(m.databaseOf(ctx, tablecodec.EncodeTablePrefix(42)), Equals, "billing")
+
+	// the loaded tables are kept if the reload fails.
+	loadErr = errors.New("tikv is down")
+	m.mu.Lock()
+	m.loadedAt = time.Time{}
+	m.mu.Unlock()
+	c.Assert(m.databaseOf(context.Background(), tablecodec.EncodeTablePrefix(60)), Equals, unknownDatabase)
+	<-loaded
+	c.Assert(waitLoaded(m), IsTrue)
+	c.Assert(m.databaseOf(context.Background(), tablecodec.EncodeTablePrefix(42)), Equals, "shop")
+}
+
+// waitLoaded waits until the background loading finishes.
+func waitLoaded(m *databaseMetrics) bool {
+	for i := 0; i < 100; i++ {
+		m.mu.Lock()
+		loading := m.loading
+		m.mu.Unlock()
+		if !loading {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func (s *databaseMetricsSuite) TestLabel(c *C) {
+	m := newDatabaseMetrics(DatabaseMetricsConfig{TopN: 2}, nil)
+	now := m.rankedAt
+
+	// the databases are counted as other until they're ranked.
+	c.Assert(m.label("shop", 100, now), Equals, otherDatabases)
+	c.Assert(m.label("log", 300, now), Equals, otherDatabases)
+	c.Assert(m.label("billing", 200, now), Equals, otherDatabases)
+	c.Assert(m.label(unknownDatabase, 1000, now), Equals, unknownDatabase)
+
+	// the databases written most in the minute are tracked.
+	now = now.Add(databaseRankInterval)
+	c.Assert(m.label("shop", 10, now), Equals, otherDatabases)
+	c.Assert(m.label("log", 10, now), Equals, "log")
+	c.Assert(m.label("billing", 10, now), Equals, "billing")
+	c.Assert(m.label("shop", 10, now), Equals, otherDatabases)
+	c.Assert(m.pending, HasLen, 0)
+
+	// no more database is tracked.
+	now = now.Add(databaseRankInterval)
+	c.Assert(m.label("shop", 1000, now), Equals, otherDatabases)
+	c.Assert(m.label("shop", 1000, now.Add(databaseRankInterval)), Equals, otherDatabases)
+	c.Assert(m.tracked, HasLen, 2)
+}
+
+func (s *databaseMetricsSuite) TestRecord(c *C) {
+	m := newDatabaseMetrics(DatabaseMetricsConfig{TopN: 1}, nil)
+	m.tracked["orders"] = struct{}{}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(DatabaseKey, "orders"))
+
+	count := testutil.ToFloat64(writeBinlogByDatabaseCounter.WithLabelValues("orders"))
+	bytes := testutil.ToFloat64(writeBinlogBytesByDatabaseCounter.WithLabelValues("orders"))
+	m.record(ctx, &binlog.Binlog{Tp: binlog.BinlogType_Prewrite}, 64)
+	// only the prewrite binlogs are counted.
+	m.record(ctx, &binlog.Binlog{Tp: binlog.BinlogType_Commit}, 16)
+	c.Assert(testutil.ToFloat64(writeBinlogByDatabaseCounter.WithLabelValues("orders")), Equals, count+1)
+	c.Assert(testutil.ToFloat64(writeBinlogBytesByDatabaseCounter.WithLabelValues("orders")), Equals, bytes+64)
+}
+
+func (s *databaseMetricsSuite) TestExemplar(c *C) {
+	m := newDatabaseMetrics(DatabaseMetricsConfig{TopN: 1}, nil)
+	m.tracked["payments"] = struct{}{}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(DatabaseKey, "payments"))
+	m.record(ctx, &binlog.Binlog{Tp: binlog.BinlogType_Prewrite, StartTs: 42}, 64)
+
+	families, err := registry.Gather()
+	c.Assert(err, IsNil)
+	var buf bytes.Buffer
+	for _, family := range families {
+		if strings.HasPrefix(family.GetName(), "binlog_pump_database_write_binlog") {
+			_, err = expfmt.MetricFamilyToOpenMetrics(&buf, family)
+			c.Assert(err, IsNil)
+		}
+	}
+	c.Assert(buf.String(), Matches, `(?s).*binlog_pump_database_write_binlog_count\{database="payments"\} \S+ # \{start_ts="42"\} 1\.0 \S+\n.*`)
+	c.Assert(buf.String(), Matches, `(?s).*binlog_pump_database_write_binlog_bytes\{database="payments"\} \S+ # \{start_ts="42"\} 64\.0 \S+\n.*`)
+}
@@ -0,0 +1,230 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pump
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	pb "github.com/pingcap/tipb/go-binlog"
+	"github.com/unrolled/render"
+	"go.uber.org/zap"
+)
+
+// The ways to assign the commit ts of the imported binlogs.
+const (
+	// CommitTSAssign means pump allocates the start ts and commit ts of each
+	// binlog from PD, like TiDB does for a transaction.
+	CommitTSAssign = "assign"
+	// CommitTSExplicit means the start ts and commit ts are specified by the
+	// importer, e.g. the ts the data is imported at. The ts must be larger
+	// than the max commit ts in pump and not larger than the current ts of PD,
+	// otherwise the binlog may be skipped by drainer, and the ts of the
+	// binlogs in a batch must be increasing without overlapping.
+	CommitTSExplicit = "explicit"
+)
+
+// ImportRequest is a batch of binlogs generated outside TiDB, e.g. for the
+// data imported by lightning or BR, so they are synced to downstream through
+// the same channel as the binlogs written by TiDB.
+type ImportRequest struct {
+	ClusterID uint64 `json:"cluster-id"`
+	// CommitTSMode is assign or explicit, default is assign.
+	CommitTSMode string          `json:"commit-ts-mode"`
+	Binlogs      []*ImportBinlog `json:"binlogs"`
+}
+
+// ImportBinlog is a transaction to import.
+type ImportBinlog struct {
+	// StartTS and CommitTS must be specified in the explicit mode only.
+	StartTS  int64 `json:"start-ts,omitempty"`
+	CommitTS int64 `json:"commit-ts,omitempty"`
+	// PrewriteValue is the marshaled binlog.PrewriteValue, in base64 in JSON.
+	// DDL can't be imported, drainer gets the DDL jobs from TiKV.
+	PrewriteValue []byte `json:"prewrite-value"`
+}
+
+// ImportedBinlog is the ts of an imported binlog.
+type ImportedBinlog struct {
+	StartTS  int64 `json:"start-ts"`
+	CommitTS int64 `json:"commit-ts"`
+}
+
+// ImportBinlogs exposes api to import a batch of binlogs, the binlogs are
+// written in order and the ts of the written ones are returned. A binlog is
+// written as a P-Binlog followed by a C-Binlog, it's not synced if pump quits
+// between them, so the failed binlogs should be imported again.
+func (s *Server) ImportBinlogs(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	renderJSON := func(resp *util.Response) {
+		if err := rd.JSON(w, http.StatusOK, resp); err != nil {
+			log.Error("Failed to render JSON response", zap.Error(err))
+		}
+	}
+
+	req := new(ImportRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		renderJSON(util.ErrCodeResponsef(errorcode.InvalidArgument, "invalid import request: %v", err))
+		return
+	}
+
+	imported, err := s.importBinlogs(req)
+	if err != nil {
+		resp := util.ErrCodeResponsef(errorcode.CodeOf(err), "import binlogs failed: %v", err)
+		resp.Data = imported
+		renderJSON(resp)
+		return
+	}
+	renderJSON(util.SuccessResponse("success", imported))
+}
+
+// importBinlogs writes the binlogs and returns the ts of the written ones.
+func (s *Server) importBinlogs(req *ImportRequest) ([]ImportedBinlog, error) {
+	if req.ClusterID != s.clusterID {
+		return nil, errorcode.Newf(errorcode.ClusterIDMismatch, "cluster ID are mismatch, %v vs %v", req.ClusterID, s.clusterID)
+	}
+	if req.CommitTSMode == "" {
+		req.CommitTSMode = CommitTSAssign
+	}
+	if err := s.checkImportBinlogs(req); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	// the imports are serialized, so the binlogs of a batch are not interleaved
+	// with the ones of another import.
+	s.importMu.Lock()
+	defer s.importMu.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	// the start ts is checked against the commit ts of the binlogs written when
+	// the P-Binlog is written, see importBinlog.
+	if req.CommitTSMode == CommitTSExplicit {
+		ts, err := s.getTSO()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if last := req.Binlogs[len(req.Binlogs)-1].CommitTS; last > ts {
+			return nil, errorcode.Newf(errorcode.InvalidArgument, "commit ts %d is larger than the current ts %d", last, ts)
+		}
+	}
+
+	imported := make([]ImportedBinlog, 0, len(req.Binlogs))
+	for _, b := range req.Binlogs {
+		ts, err := s.importBinlog(req.CommitTSMode, b)
+		if err != nil {
+			importBinlogCounter.WithLabelValues(req.CommitTSMode, "fail").Add(1)
+			log.Error("import binlog failed", zap.Int("imported", len(imported)), zap.Error(err))
+			return imported, errors.Trace(err)
+		}
+		importBinlogCounter.WithLabelValues(req.CommitTSMode, "succ").Add(1)
+		imported = append(imported, ts)
+	}
+	log.Info("import binlogs success", zap.String("commit ts mode", req.CommitTSMode), zap.Int("count", len(imported)),
+		zap.Int64("first commit ts", imported[0].CommitTS), zap.Int64("last commit ts", imported[len(imported)-1].CommitTS))
+	return imported, nil
+}
+
+func (s *Server) checkImportBinlogs(req *ImportRequest) error {
+	if req.CommitTSMode != CommitTSAssign && req.CommitTSMode != CommitTSExplicit {
+		return errorcode.Newf(errorcode.InvalidArgument, "invalid commit-ts-mode %s, must be %s or %s", req.CommitTSMode, CommitTSAssign, CommitTSExplicit)
+	}
+	if len(req.Binlogs) == 0 {
+		return errorcode.New(errorcode.InvalidArgument, "no binlogs to import")
+	}
+
+	var lastCommitTS int64
+	for i, b := range req.Binlogs {
+		pv := new(pb.PrewriteValue)
+		if err := pv.Unmarshal(b.PrewriteValue); err != nil {
+			return errorcode.Newf(errorcode.InvalidArgument, "invalid prewrite value of binlog %d: %v", i, err)
+		}
+		if len(pv.Mutations) == 0 {
+			return errorcode.Newf(errorcode.InvalidArgument, "binlog %d has no mutations", i)
+		}
+
+		if req.CommitTSMode == CommitTSAssign {
+			if b.StartTS != 0 || b.CommitTS != 0 {
+				return errorcode.Newf(errorcode.InvalidArgument, "ts of binlog %d can't be specified in the %s mode", i, CommitTSAssign)
+			}
+			continue
+		}
+		if b.StartTS <= 0 || b.StartTS >= b.CommitTS {
+			return errorcode.Newf(errorcode.InvalidArgument, "invalid ts of binlog %d, start ts %d, commit ts %d", i, b.StartTS, b.CommitTS)
+		}
+		// the binlogs are stored by ts, so the ts can't overlap.
+		if b.StartTS <= lastCommitTS {
+			return errorcode.Newf(errorcode.InvalidArgument, "start ts of binlog %d is not larger than the commit ts of the previous one", i)
+		}
+		lastCommitTS = b.CommitTS
+	}
+	return nil
+}
+
+// importBinlog writes the binlog as a P-Binlog and a C-Binlog, the ts are
+// allocated from PD in the assign mode. In the explicit mode, the P-Binlog is
+// only written if its start ts is larger than the commit ts of all the
+// binlogs written, including the ones written by TiDB meanwhile.
+func (s *Server) importBinlog(mode string, b *ImportBinlog) (ImportedBinlog, error) {
+	ts := ImportedBinlog{StartTS: b.StartTS, CommitTS: b.CommitTS}
+
+	var err error
+	if mode == CommitTSAssign {
+		ts.StartTS, err = s.getTSO()
+		if err != nil {
+			return ts, errors.Trace(err)
+		}
+	}
+
+	pbinlog := &pb.Binlog{
+		Tp:            pb.BinlogType_Prewrite,
+		StartTs:       ts.StartTS,
+		PrewriteValue: b.PrewriteValue,
+	}
+	if mode == CommitTSExplicit {
+		err = s.storage.WriteBinlogAfterCommitted(pbinlog)
+	} else {
+		err = s.storage.WriteBinlog(pbinlog)
+	}
+	if err != nil {
+		return ts, errors.Annotatef(err, "write P-Binlog of start ts %d", ts.StartTS)
+	}
+
+	// the commit ts is allocated after the P-Binlog is written, so it's larger
+	// than the commit ts of the binlogs pulled by drainer.
+	if mode == CommitTSAssign {
+		ts.CommitTS, err = s.getTSO()
+		if err != nil {
+			return ts, errors.Trace(err)
+		}
+	}
+
+	cbinlog := &pb.Binlog{
+		Tp:       pb.BinlogType_Commit,
+		StartTs:  ts.StartTS,
+		CommitTs: ts.CommitTS,
+	}
+	if err = s.storage.WriteBinlog(cbinlog); err != nil {
+		return ts, errors.Annotatef(err, "write C-Binlog of start ts %d, commit ts %d", ts.StartTS, ts.CommitTS)
+	}
+	return ts, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pump
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
+	"github.com/pingcap/tidb-binlog/pkg/node"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tipb/go-binlog"
+	pd "github.com/tikv/pd/client"
+)
+
+var _ = Suite(&importBinlogsSuite{})
+
+type importBinlogsSuite struct{}
+
+type onlineNode struct{ fakeNode }
+
+func (n *onlineNode) NodeStatus() *node.Status { return &node.Status{State: node.Online} }
+
+type maxCommitTSWritable struct {
+	fakeWritable
+	maxCommitTS int64
+}
+
+func (s *maxCommitTSWritable) MaxCommitTS() int64 { return s.maxCommitTS }
+
+func (s *maxCommitTSWritable) WriteBinlog(binlogItem *binlog.Binlog) error {
+	if binlogItem.CommitTs > s.maxCommitTS {
+		s.maxCommitTS = binlogItem.CommitTs
+	}
+	return s.fakeWritable.WriteBinlog(binlogItem)
+}
+
+func (s *maxCommitTSWritable) WriteBinlogAfterCommitted(binlogItem *binlog.Binlog) error {
+	if binlogItem.StartTs <= s.maxCommitTS {
+		return errorcode.Newf(errorcode.InvalidArgument, "start ts %d is not larger than the commit ts %d of the binlogs written", binlogItem.StartTs, s.maxCommitTS)
+	}
+	return s.WriteBinlog(binlogItem)
+}
+
+func newImportPrewriteValue(c *C) []byte {
+	pv := &binlog.PrewriteValue{Mutations: []binlog.TableMutation{{TableId: 42, InsertedRows: [][]byte{{1}}}}}
+	data, err := pv.Marshal()
+	c.Assert(err, IsNil)
+	return data
+}
+
+func (s *importBinlogsSuite) TestImportAssign(c *C) {
+	var tso int64 = 100
+	origGetTSO := utilGetTSO
+	utilGetTSO = func(cli pd.Client) (int64, error) {
+		tso++
+		return tso, nil
+	}
+	defer func() {
+		utilGetTSO = origGetTSO
+	}()
+
+	storage := &maxCommitTSWritable{}
+	server := &Server{clusterID: 42, node: &onlineNode{}, storage: storage}
+	pv := newImportPrewriteValue(c)
+	req := &ImportRequest{ClusterID: 42, Binlogs: []*ImportBinlog{{PrewriteValue: pv}, {PrewriteValue: pv}}}
+	body, err := json.Marshal(req)
+	c.Assert(err, IsNil)
+
+	w := httptest.NewRecorder()
+	server.ImportBinlogs(w, httptest.NewRequest("POST", "/binlog/import", bytes.NewReader(body)))
+	resp := new(util.Response)
+	c.Assert(json.Unmarshal(w.Body.Bytes(), resp), IsNil)
+	c.Assert(resp.Code, Equals, 200, Commentf("%s", resp.Message))
+	c.Assert(resp.Data, DeepEquals, []interface{}{
+		map[string]interface{}{"start-ts": float64(101), "commit-ts": float64(102)},
+		map[string]interface{}{"start-ts": float64(103), "commit-ts": float64(104)},
+	})
+
+	c.Assert(storage.binlogs, HasLen, 4)
+	c.Assert(storage.binlogs[0].Tp, Equals, binlog.BinlogType_Prewrite)
+	c.Assert(storage.binlogs[0].StartTs, Equals, int64(101))
+	c.Assert(storage.binlogs[0].PrewriteValue, DeepEquals, pv)
+	c.Assert(storage.binlogs[1].Tp, Equals, binlog.BinlogType_Commit)
+	c.Assert(storage.binlogs[1].StartTs, Equals, int64(101))
+	c.Assert(storage.binlogs[1].CommitTs, Equals, int64(102))
+
+	// the ts can't be specified in the assign mode.
+	req.Binlogs[0].CommitTS = 1
+	_, err = server.importBinlogs(req)
+	c.Assert(err, ErrorMatches, ".*can't be specified in the assign mode")
+}
+
+func (s *importBinlogsSuite) TestImportExplicit(c *C) {
+	origGetTSO := utilGetTSO
+	utilGetTSO = func(cli pd.Client) (int64, error) {
+		return 1000, nil
+	}
+	defer func() {
+		utilGetTSO = origGetTSO
+	}()
+
+	storage := &maxCommitTSWritable{maxCommitTS: 100}
+	server := &Server{clusterID: 42, node: &onlineNode{}, storage: storage}
+	pv := newImportPrewriteValue(c)
+	newRequest := func(ts ...int64) *ImportRequest {
+		req := &ImportRequest{ClusterID: 42, CommitTSMode: CommitTSExplicit}
+		for i := 0; i < len(ts); i += 2 {
+			req.Binlogs = append(req.Binlogs, &ImportBinlog{StartTS: ts[i], CommitTS: ts[i+1], PrewriteValue: pv})
+		}
+		return req
+	}
+
+	imported, err := server.importBinlogs(newRequest(101, 102, 103, 104))
+	c.Assert(err, IsNil)
+	c.Assert(imported, DeepEquals, []ImportedBinlog{{StartTS: 101, CommitTS: 102}, {StartTS: 103, CommitTS: 104}})
+	c.Assert(storage.binlogs, HasLen, 4)
+	c.Assert(storage.binlogs[3].CommitTs, Equals, int64(104))
+
+	tests := []struct {
+		req *ImportRequest
+		err string
+	}{
+		{newRequest(104, 105), "write P-Binlog of start ts 104: start ts 104 is not larger than the commit ts 104 of the binlogs written"},
+		{newRequest(101, 1001), "commit ts 1001 is larger than the current ts 1000"},
+		{newRequest(102, 102), "invalid ts of binlog 0.*"},
+		{newRequest(101, 103, 103, 104), "start ts of binlog 1 is not larger than the commit ts of the previous one"},
+		{newRequest(), "no binlogs to import"},
+		{&ImportRequest{ClusterID: 42, CommitTSMode: "none"}, "invalid commit-ts-mode none.*"},
+		{&ImportRequest{ClusterID: 42, Binlogs: []*ImportBinlog{{PrewriteValue: []byte("invalid")}}}, "invalid prewrite value of binlog 0.*"},
+		{&ImportRequest{ClusterID: 42, Binlogs: []*ImportBinlog{{}}}, "binlog 0 has no mutations"},
+	}
+	for _, t := range tests {
+		_, err = server.importBinlogs(t.req)
+		c.Assert(err, ErrorMatches, t.err)
+		c.Assert(errorcode.CodeOf(err), Equals, errorcode.InvalidArgument)
+	}
+	c.Assert(storage.binlogs, HasLen, 4)
+
+	_, err = server.importBinlogs(&ImportRequest{ClusterID: 1})
+	c.Assert(errorcode.CodeOf(err), Equals, errorcode.ClusterIDMismatch)
+
+	server.node = &fakeNode{}
+	_, err = server.importBinlogs(newRequest(105, 106))
+	c.Assert(errorcode.CodeOf(err), Equals, errorcode.PumpNotOnline)
+}
@@ -14,8 +14,14 @@
 package pump
 
 import (
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
 	"github.com/pingcap/tidb-binlog/pump/storage"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 var (
@@ -43,6 +49,62 @@ var (
 			Name:      "detected_drainer_binlog_purge_count",
 			Help:      "binlog purge count > 0 means some unread binlog was purged",
 		}, []string{"id"})
+
+	writeBinlogByClientCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "pump",
+			Name:      "client_write_binlog_count",
+			Help:      "Total count of the binlogs written by every client.",
+		}, []string{"client", "label"})
+
+	writeBinlogBytesByClientCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "pump",
+			Name:      "client_write_binlog_bytes",
+			Help:      "Total size of the binlogs written by every client.",
+		}, []string{"client"})
+
+	writeBinlogByDatabaseCounter = newExemplarCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "pump",
+			Name:      "database_write_binlog_count",
+			Help:      "Total count of the prewrite binlogs written of the top N databases, the others are counted as other.",
+		}, "database")
+
+	writeBinlogBytesByDatabaseCounter = newExemplarCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "pump",
+			Name:      "database_write_binlog_bytes",
+			Help:      "Total size of the prewrite binlogs written of the top N databases, the others are counted as other.",
+		}, "database")
+
+	registrationStateGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "pump",
+			Name:      "registration_state",
+			Help:      "State of the registration of pump in etcd, 1 if the last heartbeat succeeded, 0 if it's being retried.",
+		})
+
+	heartbeatFailureCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "pump",
+			Name:      "heartbeat_failure_total",
+			Help:      "Total number of the failed heartbeats to etcd.",
+		})
+
+	importBinlogCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "pump",
+			Name:      "import_binlog_count",
+			Help:      "Total count of the binlogs imported by the import API.",
+		}, []string{"mode", "label"})
 )
 
 var registry = prometheus.NewRegistry()
@@ -55,4 +117,82 @@ func init() {
 
 	registry.MustRegister(rpcHistogram)
 	registry.MustRegister(lossBinlogCacheCounter)
+	registry.MustRegister(importBinlogCounter)
+	registry.MustRegister(registrationStateGauge)
+	registry.MustRegister(heartbeatFailureCounter)
+	registry.MustRegister(writeBinlogByClientCounter)
+	registry.MustRegister(writeBinlogBytesByClientCounter)
+	registry.MustRegister(writeBinlogByDatabaseCounter)
+	registry.MustRegister(writeBinlogBytesByDatabaseCounter)
+}
+
+// exemplarCounterVec is a CounterVec of one label whose series carry the exemplar of the last value added,
+// which is exposed when /metrics is scraped in the OpenMetrics format.
+type exemplarCounterVec struct {
+	*prometheus.CounterVec
+	label string
+
+	mu        sync.Mutex
+	exemplars map[string]*dto.Exemplar
+}
+
+func newExemplarCounterVec(opts prometheus.CounterOpts, label string) *exemplarCounterVec {
+	return &exemplarCounterVec{
+		CounterVec: prometheus.NewCounterVec(opts, []string{label}),
+		label:      label,
+		exemplars:  make(map[string]*dto.Exemplar),
+	}
+}
+
+// addWithExemplar adds value to the series of labelValue and keeps the exemplar of it.
+func (v *exemplarCounterVec) addWithExemplar(labelValue string, value float64, exemplar prometheus.Labels, now time.Time) {
+	v.WithLabelValues(labelValue).Add(value)
+
+	e := &dto.Exemplar{Value: proto.Float64(value)}
+	for name, value := range exemplar {
+		e.Label = append(e.Label, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+	}
+	if ts, err := ptypes.TimestampProto(now); err == nil {
+		e.Timestamp = ts
+	}
+
+	v.mu.Lock()
+	v.exemplars[labelValue] = e
+	v.mu.Unlock()
+}
+
+// Collect implements prometheus.Collector.
+func (v *exemplarCounterVec) Collect(ch chan<- prometheus.Metric) {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		v.CounterVec.Collect(metrics)
+		close(metrics)
+	}()
+	for m := range metrics {
+		ch <- exemplarMetric{Metric: m, vec: v}
+	}
+}
+
+type exemplarMetric struct {
+	prometheus.Metric
+	vec *exemplarCounterVec
+}
+
+// Write implements prometheus.Metric.
+func (m exemplarMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	if out.Counter == nil {
+		return nil
+	}
+	for _, l := range out.Label {
+		if l.GetName() != m.vec.label {
+			continue
+		}
+		m.vec.mu.Lock()
+		out.Counter.Exemplar = m.vec.exemplars[l.GetValue()]
+		m.vec.mu.Unlock()
+	}
+	return nil
 }
@@ -32,6 +32,7 @@ import (
 	"github.com/pingcap/tidb-binlog/pkg/node"
 	"github.com/pingcap/tidb-binlog/pkg/util"
 	pb "github.com/pingcap/tipb/go-binlog"
+	"go.etcd.io/etcd/clientv3"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
@@ -53,18 +54,27 @@ type pumpNode struct {
 	heartbeatInterval time.Duration
 	tls               *tls.Config
 
+	// leaseTTL is the seconds of the lease the online status is attached to, 0 means no lease.
+	leaseTTL int64
+	lease    clientv3.LeaseID
+	// retryInterval and maxRetryInterval are the backoff of retrying the failed heartbeat.
+	retryInterval    time.Duration
+	maxRetryInterval time.Duration
+
 	// latestTS and latestTime is used for get approach ts
 	latestTS   int64
 	latestTime time.Time
 
 	// use this function to update max commit ts
 	getMaxCommitTs func() int64
+	// use this function to update the stats reported in heartbeat, may be nil
+	getStats func() *node.PumpStats
 }
 
 var _ node.Node = &pumpNode{}
 
 // NewPumpNode returns a pumpNode obj that initialized by server config
-func NewPumpNode(cfg *Config, getMaxCommitTs func() int64) (node.Node, error) {
+func NewPumpNode(cfg *Config, getMaxCommitTs func() int64, getStats func() *node.PumpStats) (node.Node, error) {
 	if err := checkExclusive(cfg.DataDir); err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -115,13 +125,24 @@ func NewPumpNode(cfg *Config, getMaxCommitTs func() int64) (node.Node, error) {
 		State:   state,
 		IsAlive: true,
 	}
+	if len(cfg.AdvertiseStatusAddr) > 0 {
+		statusURL, err := url.Parse(cfg.AdvertiseStatusAddr)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid configuration of advertise status addr(%s)", cfg.AdvertiseStatusAddr)
+		}
+		status.StatusAddr = statusURL.Host
+	}
 
 	node := &pumpNode{
 		tls:               cfg.tls,
 		EtcdRegistry:      etcdRegistry,
 		status:            status,
 		heartbeatInterval: time.Duration(cfg.HeartbeatInterval) * time.Second,
+		leaseTTL:          int64(cfg.LeaseTTL),
+		retryInterval:     time.Duration(cfg.EtcdRetryInterval) * time.Second,
+		maxRetryInterval:  time.Duration(cfg.EtcdMaxRetryInterval) * time.Second,
 		getMaxCommitTs:    getMaxCommitTs,
+		getStats:          getStats,
 	}
 	return node, nil
 }
@@ -153,13 +174,42 @@ func (p *pumpNode) RefreshStatus(ctx context.Context, status *node.Status) error
 		p.updateStatus()
 	}
 
-	err := p.UpdateNode(ctx, nodePrefix, status)
+	err := p.register(ctx)
 	if err != nil {
 		return errors.Trace(err)
 	}
 	return nil
 }
 
+// register saves the status to etcd, the online status is attached to the lease if leaseTTL is set,
+// and a new lease is granted if the old one is expired and the status is deleted. the status of the
+// other states isn't attached to any lease, so drainers still know the offline pump after it exits.
+// the caller must hold the lock.
+func (p *pumpNode) register(ctx context.Context) error {
+	if p.leaseTTL <= 0 || p.status.State != node.Online {
+		p.lease = clientv3.NoLease
+		return errors.Trace(p.UpdateNode(ctx, nodePrefix, p.status))
+	}
+
+	if p.lease != clientv3.NoLease {
+		if err := p.KeepAliveLease(ctx, p.lease); err != nil {
+			if !errors.IsNotFound(err) {
+				return errors.Trace(err)
+			}
+			log.Warn("the lease of pump is expired, register again", zap.String("id", p.status.NodeID))
+			p.lease = clientv3.NoLease
+		}
+	}
+	if p.lease == clientv3.NoLease {
+		lease, err := p.GrantLease(ctx, p.leaseTTL)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		p.lease = lease
+	}
+	return errors.Trace(p.UpdateNodeWithLease(ctx, nodePrefix, p.status, p.lease))
+}
+
 func (p *pumpNode) Notify(ctx context.Context) error {
 	drainers, err := p.Nodes(ctx, "drainers")
 	if err != nil {
@@ -235,26 +285,64 @@ func (p *pumpNode) Heartbeat(ctx context.Context) <-chan error {
 			log.Info("Heartbeat goroutine exited")
 		}()
 
+		interval := p.heartbeatInterval
+		failed := false
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-time.After(p.heartbeatInterval):
-				p.Lock()
-				p.updateStatus()
-				if err := p.UpdateNode(ctx, nodePrefix, p.status); err != nil {
-					errc <- errors.Trace(err)
+			case <-time.After(interval):
+			}
+
+			p.Lock()
+			p.updateStatus()
+			err := p.register(ctx)
+			p.Unlock()
+
+			if err == nil {
+				if failed {
+					log.Info("pump is registered again after the heartbeat recovers", zap.String("id", p.status.NodeID))
 				}
-				p.Unlock()
+				failed = false
+				interval = p.heartbeatInterval
+				registrationStateGauge.Set(1)
+				continue
+			}
+
+			// retry with backoff until etcd recovers, e.g. from the loss of quorum.
+			if failed {
+				interval = p.nextRetryInterval(interval)
+			} else {
+				interval = p.retryInterval
+			}
+			failed = true
+			registrationStateGauge.Set(0)
+			heartbeatFailureCounter.Inc()
+			select {
+			case errc <- errors.Trace(err):
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
 	return errc
 }
 
+// nextRetryInterval doubles the interval of retrying the failed heartbeat up to maxRetryInterval.
+func (p *pumpNode) nextRetryInterval(interval time.Duration) time.Duration {
+	interval *= 2
+	if interval > p.maxRetryInterval {
+		interval = p.maxRetryInterval
+	}
+	return interval
+}
+
 func (p *pumpNode) updateStatus() {
 	p.status.UpdateTS = util.GetApproachTS(p.latestTS, p.latestTime)
 	p.status.MaxCommitTS = p.getMaxCommitTs()
+	if p.getStats != nil {
+		p.status.Stats = p.getStats()
+	}
 }
 
 func (p *pumpNode) Quit() error {
@@ -30,6 +30,7 @@ import (
 	"github.com/pingcap/tidb-binlog/pkg/node"
 	pkgnode "github.com/pingcap/tidb-binlog/pkg/node"
 	"github.com/pingcap/tipb/go-binlog"
+	"go.etcd.io/etcd/clientv3"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 )
@@ -61,7 +62,7 @@ func (t *testNodeSuite) TestNode(c *C) {
 		AdvertiseAddr:     listenAddr,
 	}
 
-	node, err := NewPumpNode(cfg, func() int64 { return 0 })
+	node, err := NewPumpNode(cfg, func() int64 { return 0 }, nil)
 	c.Assert(err, IsNil)
 
 	testCheckNodeID(c, node, exceptedNodeID)
@@ -174,6 +175,46 @@ func (s *heartbeatSuite) TestShouldUpdateStatus(c *C) {
 	c.Assert(p.status.MaxCommitTS, LessEqual, int64(3))
 }
 
+func (s *heartbeatSuite) TestRegisterWithLease(c *C) {
+	cli := etcd.NewClient(testEtcdCluster.RandClient(), "heartbeat")
+	registry := node.NewEtcdRegistry(cli, time.Second)
+	p := pumpNode{
+		status:       &node.Status{NodeID: "lease", State: node.Online},
+		leaseTTL:     10,
+		EtcdRegistry: registry,
+	}
+	ctx := context.Background()
+	c.Assert(p.register(ctx), IsNil)
+	lease := p.lease
+	c.Assert(lease, Not(Equals), clientv3.NoLease)
+	c.Assert(p.register(ctx), IsNil)
+	c.Assert(p.lease, Equals, lease)
+
+	// the status is registered again with a new lease after the lease is expired.
+	_, err := testEtcdCluster.RandClient().Revoke(ctx, lease)
+	c.Assert(err, IsNil)
+	_, err = registry.Node(ctx, nodePrefix, "lease")
+	c.Assert(errors.IsNotFound(err), IsTrue)
+	c.Assert(p.register(ctx), IsNil)
+	c.Assert(p.lease, Not(Equals), lease)
+	mustEqualStatus(c, registry, "lease", p.status)
+
+	// the offline status isn't attached to any lease.
+	lease = p.lease
+	p.status.State = node.Offline
+	c.Assert(p.register(ctx), IsNil)
+	c.Assert(p.lease, Equals, clientv3.NoLease)
+	_, err = testEtcdCluster.RandClient().Revoke(ctx, lease)
+	c.Assert(err, IsNil)
+	mustEqualStatus(c, registry, "lease", p.status)
+}
+
+func (s *heartbeatSuite) TestNextRetryInterval(c *C) {
+	p := pumpNode{retryInterval: time.Second, maxRetryInterval: 5 * time.Second}
+	c.Assert(p.nextRetryInterval(p.retryInterval), Equals, 2*time.Second)
+	c.Assert(p.nextRetryInterval(4*time.Second), Equals, 5*time.Second)
+}
+
 type notifyDrainerSuite struct{}
 
 var _ = Suite(&notifyDrainerSuite{})
@@ -14,6 +14,7 @@
 package pump
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -28,6 +29,8 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/compress"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
 	"github.com/pingcap/tidb-binlog/pkg/flags"
 	"github.com/pingcap/tidb-binlog/pkg/node"
 	"github.com/pingcap/tidb-binlog/pkg/util"
@@ -42,11 +45,13 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/soheilhy/cmux"
+	"github.com/syndtr/goleveldb/leveldb"
 	pd "github.com/tikv/pd/client"
 	"github.com/unrolled/render"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 var (
@@ -63,6 +68,12 @@ var (
 	newKVStoreFn          = kvstore.New
 )
 
+// the steps of starting pump reported by /ready.
+const (
+	readyStepStorage = "storage"
+	readyStepEtcd    = "etcd"
+)
+
 // Server implements the gRPC interface,
 // and maintains pump's status at run time.
 type Server struct {
@@ -94,6 +105,18 @@ type Server struct {
 
 	writeBinlogCount int64
 	alivePullerCount int64
+	// audit counts the binlogs written by every TiDB instance.
+	audit clientAudit
+	// databases counts the binlogs written by their databases, nil if it's disabled.
+	databases *databaseMetrics
+
+	// importMu serializes the imports of binlogs.
+	importMu sync.Mutex
+
+	// statusLis serves the HTTP API if it's not served on tcpAddr.
+	statusLis net.Listener
+	// readiness is served by /ready, pump is ready after the storage is opened and it's registered to etcd.
+	readiness *util.Readiness
 
 	isClosed int32
 }
@@ -159,13 +182,24 @@ func NewServer(cfg *Config) (*Server, error) {
 	options = options.WithKVChanCapacity(cfg.Storage.GetKVChanCapacity())
 	options = options.WithSlowWriteThreshold(cfg.Storage.GetSlowWriteThreshold())
 	options = options.WithStopWriteAtAvailableSpace(cfg.Storage.GetStopWriteAtAvailableSpace())
+	options = options.WithReadCacheSize(cfg.Storage.GetReadCacheSize())
+	options = options.WithWriteBatchWait(cfg.Storage.GetWriteBatchWait())
+	options = options.WithWriteBatchSize(cfg.Storage.GetWriteBatchSize())
+	options = options.WithWriteLimit(cfg.Storage.WriteRateLimit.IOLimit())
+	options = options.WithReadLimit(cfg.Storage.ReadRateLimit.IOLimit())
+	options = options.WithChecksum(cfg.Storage.GetChecksum())
+	options = options.WithScrub(cfg.Storage.GetScrubInterval(), cfg.Storage.GetScrubLimit())
 
 	storage, err := storage.NewAppendWithResolver(cfg.DataDir, options, tiStore, lockResolver)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	readiness := util.NewReadiness(readyStepStorage, readyStepEtcd)
+	readiness.Done(readyStepStorage)
 
-	n, err := NewPumpNode(cfg, storage.MaxCommitTS)
+	n, err := NewPumpNode(cfg, storage.MaxCommitTS, func() *node.PumpStats {
+		return toPumpStats(storage.Stats())
+	})
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -188,6 +222,10 @@ func NewServer(cfg *Config) (*Server, error) {
 		cfg:           cfg,
 		triggerGC:     make(chan time.Time),
 		pullClose:     make(chan struct{}),
+		readiness:     readiness,
+		databases: newDatabaseMetrics(cfg.DatabaseMetrics, func() (map[int64]string, error) {
+			return loadTableDatabases(tiStore)
+		}),
 	}, nil
 }
 
@@ -200,6 +238,7 @@ func (s *Server) WriteBinlog(ctx context.Context, in *binlog.WriteBinlogReq) (*b
 // WriteBinlog implements the gRPC interface of pump server
 func (s *Server) writeBinlog(ctx context.Context, in *binlog.WriteBinlogReq, isFakeBinlog bool) (*binlog.WriteBinlogResp, error) {
 	var err error
+	blog := new(binlog.Binlog)
 	beginTime := time.Now()
 	atomic.StoreInt64(&s.lastWriteBinlogUnixNano, beginTime.UnixNano())
 
@@ -213,6 +252,12 @@ func (s *Server) writeBinlog(ctx context.Context, in *binlog.WriteBinlogReq, isF
 
 		takeSecond := time.Since(beginTime).Seconds()
 		rpcHistogram.WithLabelValues("WriteBinlog", label).Observe(takeSecond)
+		if !isFakeBinlog {
+			s.audit.record(clientID(ctx), len(in.Payload), err)
+			if err == nil {
+				s.databases.record(ctx, blog, len(in.Payload))
+			}
+		}
 
 		if takeSecond >= 1 {
 			log.Warn("slow write binlog RPC response",
@@ -224,22 +269,20 @@ func (s *Server) writeBinlog(ctx context.Context, in *binlog.WriteBinlogReq, isF
 	}()
 
 	if in.ClusterID != s.clusterID {
-		err = errors.Errorf("cluster ID are mismatch, %v vs %v", in.ClusterID, s.clusterID)
-		return nil, err
+		err = errorcode.Newf(errorcode.ClusterIDMismatch, "cluster ID are mismatch, %v vs %v", in.ClusterID, s.clusterID)
+		return nil, errorcode.ToGRPCError(err)
 	}
 
 	ret := new(binlog.WriteBinlogResp)
 
-	blog := new(binlog.Binlog)
 	err = blog.Unmarshal(in.Payload)
 	if err != nil {
 		goto errHandle
 	}
 
+	// the commit binlogs are still written while draining, their prewrite binlogs are in this pump.
 	if !isFakeBinlog && blog.Tp == binlog.BinlogType_Prewrite {
-		state := s.node.NodeStatus().State
-		if state != node.Online {
-			err = errors.Errorf("no online: %v", state)
+		if err = s.checkWritable(); err != nil {
 			goto errHandle
 		}
 	}
@@ -253,13 +296,49 @@ func (s *Server) writeBinlog(ctx context.Context, in *binlog.WriteBinlogReq, isF
 
 errHandle:
 	lossBinlogCacheCounter.Add(1)
-	if strings.HasPrefix(err.Error(), "no online") {
+	if code := errorcode.CodeOf(err); code == errorcode.PumpNotOnline || code == errorcode.PumpDraining {
 		log.Warn("reject write binlog for not online state", zap.String("state", s.node.NodeStatus().State))
 	} else {
-		log.Error("write binlog failed", zap.Error(err))
+		log.Error("write binlog failed", zap.Error(err), errorcode.Field(err))
 	}
 	ret.Errmsg = err.Error()
-	return ret, err
+	return ret, errorcode.ToGRPCError(err)
+}
+
+// checkWritable returns an error if the new binlogs can't be written to pump.
+func (s *Server) checkWritable() error {
+	switch state := s.node.NodeStatus().State; state {
+	case node.Online:
+		return nil
+	case node.Draining:
+		return errorcode.New(errorcode.PumpDraining, "pump is draining, write binlogs to the other pumps")
+	default:
+		return errorcode.Newf(errorcode.PumpNotOnline, "no online: %v", state)
+	}
+}
+
+// PayloadCompressionKey is the key of the gRPC metadata to negotiate the
+// compression of the pulled binlog payloads. Drainer sends the codecs it
+// accepts in order of preference, then pump replies the chosen one in the
+// header and compresses every payload with it. The payloads are not
+// compressed if there is no such key in the header.
+const PayloadCompressionKey = "binlog-payload-compression"
+
+func negotiatePayloadCompression(ctx context.Context) compress.CompressionCodec {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return compress.CompressionNone
+	}
+
+	for _, name := range md.Get(PayloadCompressionKey) {
+		codec, err := compress.ToCompressionCodec(name)
+		if err != nil {
+			log.Warn("ignore unsupported payload compression", zap.String("codec", name))
+			continue
+		}
+		return codec
+	}
+	return compress.CompressionNone
 }
 
 // PullBinlogs sends binlogs in the streaming way
@@ -283,7 +362,8 @@ func (s *Server) PullBinlogs(in *binlog.PullBinlogReq, stream binlog.Pump_PullBi
 	}()
 
 	if in.ClusterID != s.clusterID {
-		return errors.Errorf("cluster ID are mismatch, %v vs %v", in.ClusterID, s.clusterID)
+		err = errorcode.Newf(errorcode.ClusterIDMismatch, "cluster ID are mismatch, %v vs %v", in.ClusterID, s.clusterID)
+		return errorcode.ToGRPCError(err)
 	}
 
 	// don't use pos.Suffix now, use offset like last commitTS
@@ -294,6 +374,15 @@ func (s *Server) PullBinlogs(in *binlog.PullBinlogReq, stream binlog.Pump_PullBi
 		log.Error("drainer request a purged binlog TS, some binlog events may be loss", zap.Int64("gc TS", gcTS), zap.Reflect("request", in))
 	}
 
+	codec := negotiatePayloadCompression(stream.Context())
+	if codec != compress.CompressionNone {
+		if err = stream.SendHeader(metadata.Pairs(PayloadCompressionKey, string(codec))); err != nil {
+			log.Warn("send header failed", zap.Error(err))
+			return err
+		}
+		log.Info("compress the pulled binlog payloads", zap.String("codec", string(codec)), zap.Reflect("request", in))
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	binlogs := s.storage.PullCommitBinlog(ctx, last)
@@ -308,7 +397,11 @@ func (s *Server) PullBinlogs(in *binlog.PullBinlogReq, stream binlog.Pump_PullBi
 			}
 			resp := new(binlog.PullBinlogResp)
 
-			resp.Entity.Payload = data
+			resp.Entity.Payload, err = compress.Compress(data, codec)
+			if err != nil {
+				log.Error("compress binlog payload failed", zap.Error(err))
+				return err
+			}
 			err = stream.Send(resp)
 			if err != nil {
 				log.Warn("send failed", zap.Error(err))
@@ -325,9 +418,19 @@ func (s *Server) PullBinlogs(in *binlog.PullBinlogReq, stream binlog.Pump_PullBi
 func (s *Server) registerNode(ctx context.Context, state string, updateTS int64) error {
 	n := s.node
 	status := node.NewStatus(n.NodeStatus().NodeID, n.NodeStatus().Addr, state, 0, s.storage.MaxCommitTS(), updateTS)
+	status.StatusAddr = n.NodeStatus().StatusAddr
 	return n.RefreshStatus(ctx, status)
 }
 
+// toPumpStats converts the stats of the storage to the stats reported in heartbeat.
+func toPumpStats(stats *storage.WriteStats) *node.PumpStats {
+	return &node.PumpStats{
+		WriteBytesPerSecond: stats.WriteBytesPerSecond,
+		FsyncLatencyP99:     stats.FsyncLatencyP99.Seconds(),
+		DiskFreeBytes:       stats.DiskFreeBytes,
+	}
+}
+
 func (s *Server) startHeartbeat() {
 	errc := s.node.Heartbeat(s.ctx)
 	go func() {
@@ -378,6 +481,12 @@ func (s *Server) Start() error {
 	s.wg.Add(1)
 	go s.detectDrainerCheckpoint()
 
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.readiness.KeepAlive(s.ctx)
+	}()
+
 	// register pump with gRPC server and start to serve listeners
 	binlog.RegisterPumpServer(s.gs, s)
 
@@ -390,6 +499,16 @@ func (s *Server) Start() error {
 		}()
 	}
 
+	// the HTTP API is served on tcpAddr too if status-addr is not set
+	var statusLis net.Listener
+	if len(s.cfg.StatusAddr) > 0 {
+		statusLis, err = util.Listen("tcp", s.cfg.StatusAddr, s.cfg.tls)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		s.statusLis = statusLis
+	}
+
 	// grpc and http will use the same tcp connection
 	m := cmux.New(tcpLis)
 	// sets a timeout for the read of matchers
@@ -401,7 +520,10 @@ func (s *Server) Start() error {
 		cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc+proto"),
 	)
 
-	httpL := m.Match(cmux.HTTP1Fast())
+	httpL := statusLis
+	if httpL == nil {
+		httpL = m.Match(cmux.HTTP1Fast())
+	}
 
 	go func() {
 		if err := s.gs.Serve(grpcL); err != nil {
@@ -414,10 +536,22 @@ func (s *Server) Start() error {
 	router.HandleFunc("/state/{nodeID}/{action}", s.ApplyAction).Methods("PUT")
 	router.HandleFunc("/drainers", s.AllDrainers).Methods("GET")
 	router.HandleFunc("/debug/binlog/{ts}", s.BinlogByTS).Methods("GET")
+	router.HandleFunc("/binlog", s.DecodeBinlog).Methods("GET", "POST")
 	router.HandleFunc("/debug/gc/trigger", s.TriggerGC).Methods("POST")
+	router.HandleFunc("/debug/gc/status", s.GCStatus).Methods("GET")
+	router.HandleFunc("/debug/scrub/status", s.ScrubStatus).Methods("GET")
+	if s.cfg.EnableImport {
+		if s.cfg.tls == nil || s.cfg.tls.ClientAuth != tls.RequireAndVerifyClientCert {
+			log.Warn("the HTTP API to import binlogs is served without verifying the client certificates, anyone reaching pump can write binlogs")
+		}
+		router.HandleFunc("/binlog/import", s.ImportBinlogs).Methods("POST")
+	}
+	router.HandleFunc("/log-level", util.HandleLogLevel).Methods("GET", "PUT")
+	router.Handle("/ready", s.readiness).Methods("GET")
 	http.Handle("/", router)
 	prometheus.DefaultGatherer = registry
-	http.Handle("/metrics", promhttp.Handler())
+	// the OpenMetrics format is negotiated by the Accept header to expose the exemplars.
+	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{EnableOpenMetrics: true}))
 
 	go func() {
 		err := http.Serve(httpL, nil)
@@ -452,8 +586,9 @@ func (s *Server) Start() error {
 	}
 
 	s.startHeartbeat()
+	s.readiness.Done(readyStepEtcd)
 
-	log.Info("start to server request", zap.String("addr", s.advertiseAddr))
+	log.Info("start to server request", zap.String("addr", s.advertiseAddr), zap.String("status addr", s.cfg.AdvertiseStatusAddr))
 	err = m.Serve()
 	if strings.Contains(err.Error(), "use of closed network connection") {
 		err = nil
@@ -684,8 +819,25 @@ func (s *Server) Status(w http.ResponseWriter, r *http.Request) {
 	s.PumpStatus().Status(w, r)
 }
 
-// TriggerGC trigger pump to gc now
+// TriggerGC trigger pump to gc now, the binlogs are deleted up to the ts by
+// gc-duration, or the parameter ts if it's set.
 func (s *Server) TriggerGC(w http.ResponseWriter, r *http.Request) {
+	if tsStr := r.URL.Query().Get("ts"); len(tsStr) > 0 {
+		ts, err := strconv.ParseInt(tsStr, 10, 64)
+		if err != nil {
+			fmt.Fprintf(w, "invalid parameter ts: %s\n", tsStr)
+			return
+		}
+		if err = s.checkGCTS(r.Context(), ts); err != nil {
+			fmt.Fprintln(w, err.Error())
+			return
+		}
+		log.Info("send gc request to storage by api", zap.Int64("request gc ts", ts))
+		s.storage.GC(ts)
+		fmt.Fprintf(w, "trigger gc to ts %d success\n", ts)
+		return
+	}
+
 	select {
 	case s.triggerGC <- time.Now():
 		fmt.Fprintln(w, "trigger gc success")
@@ -694,6 +846,45 @@ func (s *Server) TriggerGC(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// checkGCTS checks whether the binlogs not greater than ts can be deleted, they must
+// have been sorted and consumed by all the drainers.
+func (s *Server) checkGCTS(ctx context.Context, ts int64) error {
+	if gcTS := s.storage.GetGCTS(); ts <= gcTS {
+		return errors.Errorf("ts %d is not greater than the gc ts %d", ts, gcTS)
+	}
+	if maxCommitTS := s.storage.MaxCommitTS(); ts >= maxCommitTS {
+		return errors.Errorf("ts %d is not less than the max commit ts %d", ts, maxCommitTS)
+	}
+	safeTS, err := s.getSafeGCTSOForDrainers(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if ts > safeTS {
+		return errors.Errorf("ts %d is greater than the min checkpoint %d of the drainers", ts, safeTS)
+	}
+	return nil
+}
+
+// GCStatus exposes api to get the progress of gc.
+func (s *Server) GCStatus(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	if err := rd.JSON(w, http.StatusOK, util.SuccessResponse("success", s.storage.GCStatus())); err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
+// ScrubStatus exposes api to get the corrupt records found by scrubbing the value log files.
+func (s *Server) ScrubStatus(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	if err := rd.JSON(w, http.StatusOK, util.SuccessResponse("success", s.storage.ScrubReport())); err != nil {
+		log.Error("Failed to render JSON response", zap.Error(err))
+	}
+}
+
 // BinlogByTS exposes api get get binlog by ts
 func (s *Server) BinlogByTS(w http.ResponseWriter, r *http.Request) {
 	tsStr := mux.Vars(r)["ts"]
@@ -740,6 +931,80 @@ func (s *Server) BinlogByTS(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// DecodeBinlog exposes api to get the binlog by ts and render it in JSON. The
+// rows are decoded by the table infos in the request body, which is one or an
+// array of the table infos returned by the status API of TiDB, the rows of the
+// other tables are rendered as hex, and all the rows are rendered as hex if
+// the parameter format is hex.
+func (s *Server) DecodeBinlog(w http.ResponseWriter, r *http.Request) {
+	rd := render.New(render.Options{
+		IndentJSON: true,
+	})
+	renderJSON := func(resp *util.Response) {
+		if err := rd.JSON(w, http.StatusOK, resp); err != nil {
+			log.Error("Failed to render JSON response", zap.Error(err))
+		}
+	}
+
+	tsStr := r.URL.Query().Get("ts")
+	ts, err := strconv.ParseInt(tsStr, 10, 64)
+	if err != nil {
+		renderJSON(util.ErrCodeResponsef(errorcode.InvalidArgument, "invalid parameter ts: %s", tsStr))
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "hex" {
+		renderJSON(util.ErrCodeResponsef(errorcode.InvalidArgument, "invalid parameter format: %s, must be json or hex", format))
+		return
+	}
+
+	decoder, err := newBinlogDecoder(r.Body, format == "hex")
+	if err != nil {
+		renderJSON(util.ErrCodeResponsef(errorcode.InvalidArgument, "%v", err))
+		return
+	}
+
+	binlog, err := s.getBinlogWithPrewriteValue(ts)
+	if err != nil {
+		if errors.Cause(err) == leveldb.ErrNotFound {
+			renderJSON(util.NotFoundResponsef("binlog of ts %d", ts))
+		} else {
+			renderJSON(util.ErrResponsef("get binlog of ts %d failed: %v", ts, err))
+		}
+		return
+	}
+
+	decoded, err := decoder.decode(binlog)
+	if err != nil {
+		renderJSON(util.ErrResponsef("decode binlog of ts %d failed: %v", ts, err))
+		return
+	}
+	renderJSON(util.SuccessResponse("success", decoded))
+}
+
+// getBinlogWithPrewriteValue gets the binlog by ts, the prewrite value and DDL
+// of a C-Binlog are filled from its P-Binlog.
+func (s *Server) getBinlogWithPrewriteValue(ts int64) (*pb.Binlog, error) {
+	binlog, err := s.storage.GetBinlog(ts)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if binlog.Tp != pb.BinlogType_Commit || binlog.StartTs == binlog.CommitTs {
+		return binlog, nil
+	}
+
+	pbinlog, err := s.storage.GetBinlog(binlog.StartTs)
+	if err != nil {
+		return nil, errors.Annotatef(err, "get P-Binlog of start ts %d", binlog.StartTs)
+	}
+	binlog.PrewriteValue = pbinlog.PrewriteValue
+	binlog.DdlQuery = pbinlog.DdlQuery
+	binlog.DdlJobId = pbinlog.DdlJobId
+	binlog.DdlSchemaState = pbinlog.DdlSchemaState
+	return binlog, nil
+}
+
 // PumpStatus returns all pumps' status.
 func (s *Server) PumpStatus() *HTTPStatus {
 	status, err := s.node.NodesStatus(s.ctx)
@@ -764,10 +1029,15 @@ func (s *Server) PumpStatus() *HTTPStatus {
 		}
 	}
 
-	return &HTTPStatus{
+	httpStatus := &HTTPStatus{
 		StatusMap: statusMap,
 		CommitTS:  commitTS,
+		Clients:   s.audit.snapshot(),
+	}
+	if s.storage != nil {
+		httpStatus.GCTS = s.storage.GetGCTS()
 	}
+	return httpStatus
 }
 
 // ChangeStateReq is the request struct for change state.
@@ -787,15 +1057,25 @@ func (s *Server) ApplyAction(w http.ResponseWriter, r *http.Request) {
 	log.Info("receive action", zap.String("nodeID", nodeID), zap.String("action", action))
 
 	if nodeID != s.node.NodeStatus().NodeID {
-		err := rd.JSON(w, http.StatusOK, util.ErrResponsef("invalide nodeID %s, this pump's nodeID is %s", nodeID, s.node.NodeStatus().NodeID))
+		err := rd.JSON(w, http.StatusOK, util.ErrCodeResponsef(errorcode.InvalidArgument, "invalide nodeID %s, this pump's nodeID is %s", nodeID, s.node.NodeStatus().NodeID))
+		if err != nil {
+			log.Error("Failed to render JSON response", zap.Error(err))
+		}
+		return
+	}
+
+	fromStates, ok := actionFromStates[action]
+	if !ok {
+		err := rd.JSON(w, http.StatusOK, util.ErrCodeResponsef(errorcode.InvalidArgument, "invalide action %s", action))
 		if err != nil {
 			log.Error("Failed to render JSON response", zap.Error(err))
 		}
 		return
 	}
 
-	if s.node.NodeStatus().State != node.Online {
-		err := rd.JSON(w, http.StatusOK, util.ErrResponsef("this pump's state is %s, apply %s failed!", s.node.NodeStatus().State, action))
+	state := s.node.NodeStatus().State
+	if !containsState(fromStates, state) {
+		err := rd.JSON(w, http.StatusOK, util.ErrCodeResponsef(errorcode.InvalidState, "this pump's state is %s, apply %s failed!", state, action))
 		if err != nil {
 			log.Error("Failed to render JSON response", zap.Error(err))
 		}
@@ -806,24 +1086,50 @@ func (s *Server) ApplyAction(w http.ResponseWriter, r *http.Request) {
 	case "pause":
 		log.Info("pump's state change to pausing", zap.String("nodeID", nodeID))
 		s.node.NodeStatus().State = node.Pausing
+		go s.Close()
 	case "close":
 		log.Info("pump's state change to closing", zap.String("nodeID", nodeID))
 		s.node.NodeStatus().State = node.Closing
-	default:
-		err := rd.JSON(w, http.StatusOK, util.ErrResponsef("invalide action %s", action))
-		if err != nil {
-			log.Error("Failed to render JSON response", zap.Error(err))
+		go s.Close()
+	case "drain", "undrain":
+		newState := node.Draining
+		if action == "undrain" {
+			newState = node.Online
 		}
-		return
+		// save the state to etcd right now, so TiDB and drainers know it before the next heartbeat.
+		if err := s.registerNode(r.Context(), newState, 0); err != nil {
+			log.Error("save the state of pump failed", zap.String("state", newState), zap.Error(err))
+			if err = rd.JSON(w, http.StatusOK, util.ErrResponsef("apply action %s failed: %v", action, err)); err != nil {
+				log.Error("Failed to render JSON response", zap.Error(err))
+			}
+			return
+		}
+		log.Info("pump's state change", zap.String("nodeID", nodeID), zap.String("state", newState))
 	}
 
-	go s.Close()
 	err := rd.JSON(w, http.StatusOK, util.SuccessResponse(fmt.Sprintf("apply action %s success!", action), nil))
 	if err != nil {
 		log.Error("Failed to render JSON response", zap.Error(err))
 	}
 }
 
+// actionFromStates are the states of pump the actions can be applied in.
+var actionFromStates = map[string][]string{
+	"pause":   {node.Online},
+	"close":   {node.Online, node.Draining},
+	"drain":   {node.Online},
+	"undrain": {node.Draining},
+}
+
+func containsState(states []string, state string) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
 var utilGetTSO = util.GetTSO
 
 func (s *Server) getTSO() (int64, error) {
@@ -883,7 +1189,7 @@ func (s *Server) commitStatus() {
 	// update this node
 	var state string
 	switch s.node.NodeStatus().State {
-	case node.Pausing, node.Online:
+	case node.Pausing, node.Online, node.Draining:
 		state = node.Paused
 	case node.Closing:
 		err := s.waitSafeToOffline(context.Background())
@@ -911,6 +1217,9 @@ func (s *Server) Close() {
 		log.Debug("server had closed")
 		return
 	}
+	if s.readiness != nil {
+		s.readiness.Closing()
+	}
 
 	// notify other goroutines to exit
 	s.cancel()
@@ -927,6 +1236,12 @@ func (s *Server) Close() {
 		log.Info("grpc is stopped")
 	}, 10*time.Second)
 
+	if s.statusLis != nil {
+		if err := s.statusLis.Close(); err != nil {
+			log.Error("close status listener failed", zap.Error(err))
+		}
+	}
+
 	if err := s.storage.Close(); err != nil {
 		log.Error("close storage failed", zap.Error(err))
 	}
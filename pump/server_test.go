@@ -20,17 +20,22 @@ import (
 	"io"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"path"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/gorilla/mux"
 	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/compress"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
 	"github.com/pingcap/tidb-binlog/pkg/etcd"
 	"github.com/pingcap/tidb-binlog/pkg/node"
 	"github.com/pingcap/tidb-binlog/pkg/security"
 	"github.com/pingcap/tidb-binlog/pkg/util"
+	"github.com/pingcap/tidb-binlog/pump/storage"
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/store/tikv"
 	"github.com/pingcap/tidb/store/tikv/config"
@@ -40,6 +45,9 @@ import (
 	"go.etcd.io/etcd/integration"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 var testEtcdCluster *integration.ClusterV3
@@ -62,6 +70,7 @@ func (s *writeBinlogSuite) TestReturnErrIfClusterIDMismatched(c *C) {
 	resp, err := server.writeBinlog(context.Background(), req, false)
 	c.Assert(resp, IsNil)
 	c.Assert(err, ErrorMatches, ".*mismatch.*")
+	c.Assert(errorcode.FromGRPCError(err), Equals, errorcode.ClusterIDMismatch)
 }
 
 func (s *writeBinlogSuite) TestIgnoreReqWithInvalidPayload(c *C) {
@@ -94,8 +103,28 @@ func (s *writeBinlogSuite) TestDetectNoOnline(c *C) {
 		c.Fatal("Fail to marshal binlog")
 	}
 	req := &binlog.WriteBinlogReq{ClusterID: 42, Payload: data}
-	_, err = server.writeBinlog(context.Background(), req, false)
+	resp, err := server.writeBinlog(context.Background(), req, false)
 	c.Assert(err, ErrorMatches, ".*no online.*")
+	c.Assert(resp.Errmsg, Equals, "no online: paused")
+	c.Assert(errorcode.FromGRPCError(err), Equals, errorcode.PumpNotOnline)
+	c.Assert(status.Code(err), Equals, codes.Unavailable)
+}
+
+func (s *writeBinlogSuite) TestRejectPrewriteIfDraining(c *C) {
+	server := &Server{clusterID: 42, node: &nodeWithState{state: node.Draining}, storage: &noOpStorage{}}
+
+	prewrite, err := (&binlog.Binlog{Tp: binlog.BinlogType_Prewrite}).Marshal()
+	c.Assert(err, IsNil)
+	resp, err := server.writeBinlog(context.Background(), &binlog.WriteBinlogReq{ClusterID: 42, Payload: prewrite}, false)
+	c.Assert(errorcode.FromGRPCError(err), Equals, errorcode.PumpDraining)
+	c.Assert(status.Code(err), Equals, codes.Unavailable)
+	c.Assert(resp.Errmsg, Matches, ".*draining.*")
+
+	// the commit binlogs of the transactions prewritten before are still written.
+	commit, err := (&binlog.Binlog{Tp: binlog.BinlogType_Commit}).Marshal()
+	c.Assert(err, IsNil)
+	_, err = server.writeBinlog(context.Background(), &binlog.WriteBinlogReq{ClusterID: 42, Payload: commit}, false)
+	c.Assert(err, IsNil)
 }
 
 type pullBinlogsSuite struct{}
@@ -104,8 +133,9 @@ var _ = Suite(&pullBinlogsSuite{})
 
 type fakePullBinlogsServer struct {
 	grpc.ServerStream
-	ctx  context.Context
-	sent []*binlog.PullBinlogResp
+	ctx    context.Context
+	sent   []*binlog.PullBinlogResp
+	header metadata.MD
 }
 
 func newFakePullBinlogsServer() *fakePullBinlogsServer {
@@ -120,6 +150,10 @@ func (x *fakePullBinlogsServer) Send(m *binlog.PullBinlogResp) error {
 	x.sent = append(x.sent, m)
 	return nil
 }
+func (x *fakePullBinlogsServer) SendHeader(md metadata.MD) error {
+	x.header = md
+	return nil
+}
 
 func (s *pullBinlogsSuite) TestReturnErrIfClusterIDMismatched(c *C) {
 	server := &Server{clusterID: 42}
@@ -135,10 +169,16 @@ func (s *noOpStorage) WriteBinlog(binlogItem *binlog.Binlog) error { return nil
 func (s *noOpStorage) GetGCTS() int64                              { return 0 }
 func (s *noOpStorage) GC(ts int64)                                 {}
 func (s *noOpStorage) MaxCommitTS() int64                          { return 0 }
+func (s *noOpStorage) Stats() *storage.WriteStats                  { return &storage.WriteStats{} }
+func (s *noOpStorage) GCStatus() *storage.GCStatus                 { return &storage.GCStatus{} }
+func (s *noOpStorage) ScrubReport() *storage.ScrubReport           { return &storage.ScrubReport{} }
 func (s *noOpStorage) GetBinlog(ts int64) (*binlog.Binlog, error)  { return nil, nil }
 func (s *noOpStorage) PullCommitBinlog(ctx context.Context, last int64) <-chan []byte {
 	return make(chan []byte)
 }
+func (s *noOpStorage) WriteBinlogAfterCommitted(binlogItem *binlog.Binlog) error {
+	return nil
+}
 func (s *noOpStorage) Close() error { return nil }
 
 type fakePullable struct{ noOpStorage }
@@ -171,6 +211,25 @@ func (s *pullBinlogsSuite) TestPullBinlogFromStorage(c *C) {
 	for i, resp := range stream.sent {
 		c.Assert(string(resp.Entity.Payload), Equals, fmt.Sprintf("payload_%d", i))
 	}
+	c.Assert(stream.header, IsNil)
+}
+
+func (s *pullBinlogsSuite) TestPullCompressedBinlog(c *C) {
+	server := &Server{clusterID: 42, storage: &fakePullable{}, ctx: context.Background()}
+	req := &binlog.PullBinlogReq{ClusterID: 42}
+	stream := newFakePullBinlogsServer()
+	// the first supported codec is chosen
+	stream.ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		PayloadCompressionKey, "lz4", PayloadCompressionKey, "zstd", PayloadCompressionKey, "snappy"))
+	err := server.PullBinlogs(req, stream)
+	c.Assert(err, IsNil)
+	c.Assert(stream.header.Get(PayloadCompressionKey), DeepEquals, []string{"zstd"})
+	c.Assert(stream.sent, HasLen, 3)
+	for i, resp := range stream.sent {
+		payload, err := compress.Decompress(resp.Entity.Payload, compress.CompressionZSTD)
+		c.Assert(err, IsNil)
+		c.Assert(string(payload), Equals, fmt.Sprintf("payload_%d", i))
+	}
 }
 
 type genForwardBinlogSuite struct{}
@@ -384,10 +443,11 @@ func (s *pumpStatusSuite) TestCorrectlyGetStatusAndCommitTS(c *C) {
 	utilGetTSO = func(cli pd.Client) (int64, error) { return 1024, nil }
 	defer func() { utilGetTSO = origGetTSO }()
 
-	server := &Server{node: nodeWithStatus{}}
+	server := &Server{node: nodeWithStatus{}, storage: &dummyStorage{gcTS: 512}}
 	status := server.PumpStatus()
 	c.Assert(status.ErrMsg, Equals, "")
 	c.Assert(status.CommitTS, Equals, int64(1024))
+	c.Assert(status.GCTS, Equals, int64(512))
 	c.Assert(status.StatusMap, HasLen, 3)
 	c.Assert(status.StatusMap, HasKey, "pump1")
 	c.Assert(status.StatusMap, HasKey, "pump2")
@@ -418,9 +478,10 @@ func (n *nodeWithState) RefreshStatus(ctx context.Context, status *node.Status)
 
 func (s commitStatusSuite) TestShouldChangeToCorrectState(c *C) {
 	tests := map[string]string{
-		node.Pausing: node.Paused,
-		node.Online:  node.Paused,
-		"unknown":    "unknown",
+		node.Pausing:  node.Paused,
+		node.Online:   node.Paused,
+		node.Draining: node.Paused,
+		"unknown":     "unknown",
 	}
 	for from, to := range tests {
 		server := &Server{
@@ -432,6 +493,39 @@ func (s commitStatusSuite) TestShouldChangeToCorrectState(c *C) {
 	}
 }
 
+type applyActionSuite struct{}
+
+var _ = Suite(&applyActionSuite{})
+
+func (s *applyActionSuite) TestDrain(c *C) {
+	applyAction := func(server *Server, action string) *util.Response {
+		router := mux.NewRouter()
+		router.HandleFunc("/state/{nodeID}/{action}", server.ApplyAction)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("PUT", "/state/test/"+action, nil))
+		resp := new(util.Response)
+		c.Assert(json.Unmarshal(w.Body.Bytes(), resp), IsNil)
+		return resp
+	}
+
+	online := &nodeWithState{state: node.Online}
+	resp := applyAction(&Server{node: online, storage: &dummyStorage{}}, "drain")
+	c.Assert(resp.Code, Equals, 200)
+	c.Assert(online.newState, Equals, node.Draining)
+
+	draining := &nodeWithState{state: node.Draining}
+	resp = applyAction(&Server{node: draining, storage: &dummyStorage{}}, "undrain")
+	c.Assert(resp.Code, Equals, 200)
+	c.Assert(draining.newState, Equals, node.Online)
+
+	resp = applyAction(&Server{node: draining, storage: &dummyStorage{}}, "pause")
+	c.Assert(resp.ErrorCode, Equals, errorcode.InvalidState)
+	resp = applyAction(&Server{node: online, storage: &dummyStorage{}}, "undrain")
+	c.Assert(resp.ErrorCode, Equals, errorcode.InvalidState)
+	resp = applyAction(&Server{node: online, storage: &dummyStorage{}}, "stop")
+	c.Assert(resp.ErrorCode, Equals, errorcode.InvalidArgument)
+}
+
 type closeSuite struct{}
 
 var _ = Suite(&closeSuite{})
@@ -498,6 +592,34 @@ func (s *gcBinlogFileSuite) TestShouldGCMinDrainerTSO(c *C) {
 	// todo: add in and out of alert test while binlog has failpoint
 }
 
+func (s *gcBinlogFileSuite) TestTriggerGCToTS(c *C) {
+	storage := dummyStorage{gcTS: 100, maxCommitTS: 1000}
+
+	cli := etcd.NewClient(testEtcdCluster.RandClient(), "triggergc")
+	registry := node.NewEtcdRegistry(cli, time.Second)
+	server := Server{
+		storage: &storage,
+		node:    &pumpNode{EtcdRegistry: registry},
+	}
+	mustUpdateNode(context.Background(), registry, "drainers/1", &node.Status{MaxCommitTS: 500, State: node.Online})
+	mustUpdateNode(context.Background(), registry, "drainers/2", &node.Status{MaxCommitTS: 10, State: node.Offline})
+
+	trigger := func(ts string) string {
+		w := httptest.NewRecorder()
+		server.TriggerGC(w, httptest.NewRequest("POST", "/debug/gc/trigger?ts="+ts, nil))
+		return w.Body.String()
+	}
+
+	c.Assert(trigger("x"), Matches, "invalid parameter ts: x\n")
+	c.Assert(trigger("50"), Matches, "ts 50 is not greater than the gc ts 100\n")
+	c.Assert(trigger("1000"), Matches, "ts 1000 is not less than the max commit ts 1000\n")
+	c.Assert(trigger("600"), Matches, "ts 600 is greater than the min checkpoint 500 of the drainers\n")
+	c.Assert(storage.gcTS, Equals, int64(100))
+
+	c.Assert(trigger("400"), Matches, "trigger gc to ts 400 success\n")
+	c.Assert(storage.gcTS, Equals, int64(400))
+}
+
 func mustUpdateNode(pctx context.Context, r *node.EtcdRegistry, prefix string, status *node.Status) {
 	if err := r.UpdateNode(pctx, prefix, status); err != nil {
 		panic(err)
@@ -661,12 +783,18 @@ func (s *startStorage) WriteBinlog(binlogItem *binlog.Binlog) error { return nil
 func (s *startStorage) GetGCTS() int64                              { return 0 }
 func (s *startStorage) GC(ts int64)                                 {}
 func (s *startStorage) MaxCommitTS() int64                          { return 0 }
+func (s *startStorage) Stats() *storage.WriteStats                  { return &storage.WriteStats{} }
+func (s *startStorage) GCStatus() *storage.GCStatus                 { return &storage.GCStatus{} }
+func (s *startStorage) ScrubReport() *storage.ScrubReport           { return &storage.ScrubReport{} }
 func (s *startStorage) GetBinlog(ts int64) (*binlog.Binlog, error) {
 	return nil, errors.New("server_test")
 }
 func (s *startStorage) PullCommitBinlog(ctx context.Context, last int64) <-chan []byte {
 	return make(chan []byte)
 }
+func (s *startStorage) WriteBinlogAfterCommitted(binlogItem *binlog.Binlog) error {
+	return nil
+}
 func (s *startStorage) Close() error {
 	<-s.sig
 	// wait for pump server to change node back to startNode, or test etcd server might be closed
@@ -724,7 +852,8 @@ func (s *startServerSuite) TestStartPumpServer(c *C) {
 		pdCli:      nil,
 		cfg:        cfg,
 		triggerGC:  make(chan time.Time),
-		pullClose:  make(chan struct{})}
+		pullClose:  make(chan struct{}),
+		readiness:  util.NewReadiness(readyStepEtcd)}
 	defer func() {
 		close(sig)
 		p.Close()
@@ -781,6 +910,9 @@ WAIT:
 	// test triggerGC
 	resultStr = httpRequest(c, http.MethodPost, "http://127.0.0.1:8250/debug/gc/trigger")
 	c.Assert(resultStr, Matches, `.*trigger gc success[\s\S]*`)
+	// test ready
+	resultStr = httpRequest(c, http.MethodGet, "http://127.0.0.1:8250/ready")
+	c.Assert(resultStr, Matches, `[\s\S]*"ready"[\s\S]*`)
 
 	// change node to pump node
 	cli := etcd.NewClient(testEtcdCluster.RandClient(), "drainers")
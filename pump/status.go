@@ -29,7 +29,10 @@ type HTTPStatus struct {
 	StatusMap  map[string]*node.Status `json:"status"`
 	CommitTS   int64                   `json:"CommitTS"`
 	CheckPoint pb.Pos                  `json:"Checkpoint"`
+	GCTS       int64                   `json:"GCTS"`
 	ErrMsg     string                  `json:"ErrMsg"`
+	// Clients are the statistics of the binlogs written to this pump by every TiDB instance.
+	Clients map[string]*ClientStats `json:"clients,omitempty"`
 }
 
 // Status implements http.ServeHTTP interface
@@ -15,6 +15,7 @@ package storage
 
 import (
 	"context"
+	"math/rand"
 	"os"
 	"runtime"
 	"sync/atomic"
@@ -55,6 +56,30 @@ func BenchmarkWriteNoSync100K(b *testing.B) {
 	benchmarkWrite(b, 100*1024, 100, false)
 }
 
+func BenchmarkChecksumCRC32_1K(b *testing.B) {
+	benchmarkChecksum(b, ChecksumCRC32, 1024)
+}
+
+func BenchmarkChecksumXXH64_1K(b *testing.B) {
+	benchmarkChecksum(b, ChecksumXXH64, 1024)
+}
+
+func BenchmarkChecksumCRC32_1M(b *testing.B) {
+	benchmarkChecksum(b, ChecksumCRC32, 1024*1024)
+}
+
+func BenchmarkChecksumXXH64_1M(b *testing.B) {
+	benchmarkChecksum(b, ChecksumXXH64, 1024*1024)
+}
+
+func BenchmarkChecksumCRC32_16M(b *testing.B) {
+	benchmarkChecksum(b, ChecksumCRC32, 16*1024*1024)
+}
+
+func BenchmarkChecksumXXH64_16M(b *testing.B) {
+	benchmarkChecksum(b, ChecksumXXH64, 16*1024*1024)
+}
+
 func BenchmarkPull128B(b *testing.B) {
 	benchmarkPull(b, 128, b.N)
 }
@@ -151,3 +176,14 @@ func benchmarkWrite(b *testing.B, prewriteValueSize int, parallelism int, sync b
 	b.SetBytes(int64(prewriteValueSize))
 	b.ReportAllocs()
 }
+
+func benchmarkChecksum(b *testing.B, checksum ChecksumAlgorithm, size int) {
+	payload := make([]byte, size)
+	rand.Read(payload)
+
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		checksum.checksum(payload)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"container/list"
+	"sync"
+)
+
+type cacheEntry struct {
+	vp      valuePointer
+	payload []byte
+}
+
+// readCache keeps the payloads of the most recently appended binlogs in memory,
+// the oldest ones are evicted first once the total size exceeds the capacity.
+// So the drainers nearly caught up can pull binlogs without reading the value log.
+type readCache struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	entries  *list.List
+	index    map[valuePointer]*list.Element
+}
+
+func newReadCache(capacity int64) *readCache {
+	return &readCache{
+		capacity: capacity,
+		entries:  list.New(),
+		index:    make(map[valuePointer]*list.Element),
+	}
+}
+
+// add puts the payload into the cache, the payload must not be modified after.
+func (c *readCache) add(vp valuePointer, payload []byte) {
+	if c == nil || int64(len(payload)) > c.capacity {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.index[vp]; ok {
+		return
+	}
+
+	c.index[vp] = c.entries.PushBack(&cacheEntry{vp: vp, payload: payload})
+	c.size += int64(len(payload))
+
+	for c.size > c.capacity {
+		front := c.entries.Front()
+		entry := front.Value.(*cacheEntry)
+		c.entries.Remove(front)
+		delete(c.index, entry.vp)
+		c.size -= int64(len(entry.payload))
+	}
+	readCacheSizeGauge.Set(float64(c.size))
+}
+
+// get returns the cached payload of vp, the returned payload must not be modified.
+func (c *readCache) get(vp valuePointer) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	elem, ok := c.index[vp]
+	c.mu.Unlock()
+
+	if !ok {
+		readCacheCounter.WithLabelValues("miss").Add(1)
+		return nil, false
+	}
+
+	readCacheCounter.WithLabelValues("hit").Add(1)
+	return elem.Value.(*cacheEntry).payload, true
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	"github.com/pingcap/check"
+	pb "github.com/pingcap/tipb/go-binlog"
+)
+
+type readCacheSuite struct{}
+
+var _ = check.Suite(&readCacheSuite{})
+
+func (s *readCacheSuite) TestEvictOldest(c *check.C) {
+	cache := newReadCache(10)
+
+	cache.add(valuePointer{Fid: 0, Offset: 0}, []byte("abcd"))
+	cache.add(valuePointer{Fid: 0, Offset: 4}, []byte("efgh"))
+	value, ok := cache.get(valuePointer{Fid: 0, Offset: 0})
+	c.Assert(ok, check.IsTrue)
+	c.Assert(string(value), check.Equals, "abcd")
+
+	// exceed the capacity, the oldest one should be evicted
+	cache.add(valuePointer{Fid: 1, Offset: 0}, []byte("ijk"))
+	_, ok = cache.get(valuePointer{Fid: 0, Offset: 0})
+	c.Assert(ok, check.IsFalse)
+	value, ok = cache.get(valuePointer{Fid: 0, Offset: 4})
+	c.Assert(ok, check.IsTrue)
+	c.Assert(string(value), check.Equals, "efgh")
+	c.Assert(cache.size, check.Equals, int64(7))
+
+	// too big to be cached
+	cache.add(valuePointer{Fid: 1, Offset: 3}, []byte("01234567890"))
+	_, ok = cache.get(valuePointer{Fid: 1, Offset: 3})
+	c.Assert(ok, check.IsFalse)
+	c.Assert(cache.size, check.Equals, int64(7))
+}
+
+func (s *readCacheSuite) TestNilCache(c *check.C) {
+	var cache *readCache
+	cache.add(valuePointer{}, []byte("abc"))
+	_, ok := cache.get(valuePointer{})
+	c.Assert(ok, check.IsFalse)
+}
+
+func (s *readCacheSuite) TestReadFromCache(c *check.C) {
+	dir := c.MkDir()
+	append, err := NewAppend(dir, DefaultOptions().WithReadCacheSize(1<<20))
+	c.Assert(err, check.IsNil)
+	defer append.Close()
+
+	populateBinlog(c, append, 128, 10)
+
+	// wait until the binlogs are saved in metadata
+	var binlog *pb.Binlog
+	for i := 0; i < 100; i++ {
+		if binlog, err = append.GetBinlog(2); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(err, check.IsNil)
+
+	// the binlog should be read from the cache once the vlog is unavailable
+	append.vlog.filesLock.Lock()
+	files := append.vlog.filesMap
+	append.vlog.filesMap = nil
+	append.vlog.filesLock.Unlock()
+	binlog, err = append.GetBinlog(2)
+	append.vlog.filesLock.Lock()
+	append.vlog.filesMap = files
+	append.vlog.filesLock.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Assert(binlog, check.NotNil)
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"hash/crc32"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/pingcap/errors"
+)
+
+// ChecksumAlgorithm is the algorithm of the checksums of the records in a value log file.
+type ChecksumAlgorithm uint8
+
+const (
+	// ChecksumCRC32 is crc32 Castagnoli, the files of it have no file header, so they can
+	// still be read by the older versions.
+	ChecksumCRC32 ChecksumAlgorithm = 0
+	// ChecksumXXH64 is the lower 32 bits of XXH64, it's slower than crc32 on amd64 and 386,
+	// see BenchmarkChecksum* to measure it on other platforms.
+	ChecksumXXH64 ChecksumAlgorithm = 1
+)
+
+var checksumNames = map[ChecksumAlgorithm]string{
+	ChecksumCRC32: "crc32",
+	ChecksumXXH64: "xxh64",
+}
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ParseChecksumAlgorithm parses the name of the checksum algorithm, empty means crc32.
+func ParseChecksumAlgorithm(name string) (ChecksumAlgorithm, error) {
+	if len(name) == 0 {
+		return ChecksumCRC32, nil
+	}
+	for algorithm, n := range checksumNames {
+		if n == name {
+			return algorithm, nil
+		}
+	}
+	return ChecksumCRC32, errors.Errorf("unknown checksum algorithm %s, must be crc32 or xxh64", name)
+}
+
+func (a ChecksumAlgorithm) String() string {
+	if name, ok := checksumNames[a]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+func (a ChecksumAlgorithm) known() bool {
+	_, ok := checksumNames[a]
+	return ok
+}
+
+func (a ChecksumAlgorithm) checksum(payload []byte) uint32 {
+	if a == ChecksumXXH64 {
+		return uint32(xxhash.Sum64(payload))
+	}
+	return crc32.Checksum(payload, crcTable)
+}
@@ -17,7 +17,6 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
-	"hash/crc32"
 	"io"
 	"os"
 	"sync"
@@ -31,7 +30,11 @@ import (
 )
 
 /*
-log file := record* footer
+log file := header? record* footer
+header := // only the files of the checksum algorithms other than crc32 have it
+  fileHeaderMagic: uint32
+  checksumAlgorithm: uint8 // the algorithm of the checksums of the records
+  reserved: uint8[3]
 record :=
   magic: uint32   // magic number of a record start
   length: uint64  // payload 长度
@@ -46,8 +49,8 @@ const recordMagic uint32 = 0x823a56e8
 const fileEndMagic uint32 = 0x123ab922
 const fileFooterLength int64 = 4 + 8 // fileEndMagic + maxTS
 const headerLength int64 = 16        // 4 + 8 + 4 magic + length + checksum
-
-var crcTable = crc32.MakeTable(crc32.Castagnoli)
+const fileHeaderMagic uint32 = 0x4b1f0c65
+const fileHeaderLength int64 = 8 // fileHeaderMagic + checksumAlgorithm + reserved
 
 type logFile struct {
 	fid  uint32
@@ -62,6 +65,10 @@ type logFile struct {
 	maxTS int64
 	// end means the file has a footer and can not append record to it anymore
 	end bool
+	// checksum is the algorithm of the checksums of the records
+	checksum ChecksumAlgorithm
+	// dataOffset is the offset of the first record, it's the length of the file header if any.
+	dataOffset int64
 	// Some corruption was detected.  "bytes" is the approximate number
 	// of bytes dropped due to the corruption.
 	// If "corruptionReporter" is non-NULL, it is notified whenever some data is
@@ -81,12 +88,12 @@ func (r *Record) recordLength() int64 {
 	return headerLength + int64(len(r.payload))
 }
 
-func encodeRecord(writer io.Writer, payload []byte) (int, error) {
+func encodeRecord(writer io.Writer, payload []byte, algorithm ChecksumAlgorithm) (int, error) {
 	header := make([]byte, headerLength)
 	binary.LittleEndian.PutUint32(header, recordMagic)
 	binary.LittleEndian.PutUint64(header[4:], uint64(len(payload)))
 
-	checksum := crc32.Checksum(payload, crcTable)
+	checksum := algorithm.checksum(payload)
 	binary.LittleEndian.PutUint32(header[4+8:], checksum)
 
 	n, err := writer.Write(header)
@@ -119,11 +126,13 @@ func (r *Record) readHeader(reader io.Reader) error {
 	return nil
 }
 
-func (r *Record) isValid() bool {
-	return crc32.Checksum(r.payload, crcTable) == r.checksum
+func (r *Record) isValid(algorithm ChecksumAlgorithm) bool {
+	return algorithm.checksum(r.payload) == r.checksum
 }
 
-func newLogFile(fid uint32, name string) (lf *logFile, err error) {
+// newLogFile opens the log file, or creates it with the checksum algorithm if it doesn't exist.
+// The checksum algorithm of an existing file is detected by its file header.
+func newLogFile(fid uint32, name string, checksum ChecksumAlgorithm) (lf *logFile, err error) {
 	fd, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -146,6 +155,16 @@ func newLogFile(fid uint32, name string) (lf *logFile, err error) {
 		writeOffset:        info.Size(),
 	}
 
+	if info.Size() == 0 {
+		err = lf.writeFileHeader(checksum)
+	} else {
+		err = lf.readFileHeader(info.Size())
+	}
+	if err != nil {
+		fd.Close()
+		return nil, errors.Trace(err)
+	}
+
 	if info.Size() >= fileFooterLength {
 		footer := make([]byte, fileFooterLength)
 		_, err = fd.ReadAt(footer, info.Size()-fileFooterLength)
@@ -185,6 +204,46 @@ func newLogFile(fid uint32, name string) (lf *logFile, err error) {
 	return
 }
 
+// writeFileHeader writes the header of the new file, the files of crc32 have no header.
+func (lf *logFile) writeFileHeader(checksum ChecksumAlgorithm) error {
+	lf.checksum = checksum
+	if checksum == ChecksumCRC32 {
+		return nil
+	}
+
+	header := make([]byte, fileHeaderLength)
+	binary.LittleEndian.PutUint32(header, fileHeaderMagic)
+	header[4] = byte(checksum)
+	if err := lf.Write(header, false); err != nil {
+		return errors.Trace(err)
+	}
+	lf.dataOffset = fileHeaderLength
+	return nil
+}
+
+// readFileHeader detects the checksum algorithm of the existing file.
+func (lf *logFile) readFileHeader(size int64) error {
+	lf.checksum = ChecksumCRC32
+	if size < fileHeaderLength {
+		return nil
+	}
+
+	header := make([]byte, fileHeaderLength)
+	if _, err := lf.fd.ReadAt(header, 0); err != nil {
+		return errors.Annotatef(err, "read header of file %s failed", lf.path)
+	}
+	if binary.LittleEndian.Uint32(header) != fileHeaderMagic {
+		return nil
+	}
+	checksum := ChecksumAlgorithm(header[4])
+	if !checksum.known() {
+		return errors.Errorf("unknown checksum algorithm %d of file %s, it may be written by a newer pump", checksum, lf.path)
+	}
+	lf.checksum = checksum
+	lf.dataOffset = fileHeaderLength
+	return nil
+}
+
 func (lf *logFile) updateMaxTS(ts int64) {
 	if ts > lf.maxTS {
 		lf.maxTS = ts
@@ -212,14 +271,21 @@ func (lf *logFile) Write(data []byte, sync bool) error {
 		return errors.Annotatef(err, "unable to write to log file: %s", lf.path)
 	}
 	if sync {
-		fsyncT0 := time.Now()
-		err = lf.fdatasync()
-		writeBinlogTimeHistogram.WithLabelValues("fsync").Observe(time.Since(fsyncT0).Seconds())
-		if err != nil {
-			return errors.Annotatef(err, "fdatasync file %s failed", lf.path)
-		}
+		_, err = lf.sync()
 	}
-	return nil
+	return err
+}
+
+// sync flushes the written data to disk and returns the time it takes.
+func (lf *logFile) sync() (time.Duration, error) {
+	fsyncT0 := time.Now()
+	err := lf.fdatasync()
+	d := time.Since(fsyncT0)
+	writeBinlogTimeHistogram.WithLabelValues("fsync").Observe(d.Seconds())
+	if err != nil {
+		return d, errors.Annotatef(err, "fdatasync file %s failed", lf.path)
+	}
+	return d, nil
 }
 
 // finalize write the footer to the file, then we never write this file anymore
@@ -254,7 +320,10 @@ func (lf *logFile) close() error {
 
 // recover scan all the record get the state like maxTS which only saved when the file is finalized
 func (lf *logFile) recover() error {
+	validEnd := lf.dataOffset
 	err := lf.scan(0, func(vp valuePointer, r *Record) error {
+		validEnd = vp.Offset + r.recordLength()
+
 		// save ts in header to avoid this?
 		b := new(pb.Binlog)
 		err := b.Unmarshal(r.payload)
@@ -272,12 +341,31 @@ func (lf *logFile) recover() error {
 
 		return nil
 	})
+	if err != nil {
+		return errors.Trace(err)
+	}
 
-	return errors.Trace(err)
+	// the partial record at the end is left by a crash during writing, it's truncated
+	// so the records written later follow the last complete one.
+	if validEnd < lf.writeOffset {
+		log.Warn("truncate the partial record at the end of the file", zap.String("file", lf.path),
+			zap.Int64("offset", validEnd), zap.Int64("size", lf.writeOffset))
+		if err = lf.fd.Truncate(validEnd); err != nil {
+			return errors.Annotatef(err, "truncate file %s", lf.path)
+		}
+		lf.writeOffset = validEnd
+	}
+	return nil
 }
 
 // thread-safe to read record at specify offset
 func (lf *logFile) readRecord(offset int64) (record *Record, err error) {
+	return lf.readRecordWait(offset, nil)
+}
+
+// readRecordWait is readRecord calling wait with the length of the payload before reading it,
+// so the reading can be rate limited, wait is skipped if it's nil.
+func (lf *logFile) readRecordWait(offset int64, wait func(n int) error) (record *Record, err error) {
 	header := make([]byte, headerLength)
 	_, err = lf.fd.ReadAt(header, offset)
 	if err != nil {
@@ -300,6 +388,12 @@ func (lf *logFile) readRecord(offset int64) (record *Record, err error) {
 		return nil, ErrWrongMagic
 	}
 
+	if wait != nil {
+		if err = wait(int(record.length)); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
 	record.payload = make([]byte, record.length)
 
 	_, err = lf.fd.ReadAt(record.payload, offset)
@@ -308,7 +402,7 @@ func (lf *logFile) readRecord(offset int64) (record *Record, err error) {
 		return
 	}
 
-	if !record.isValid() {
+	if !record.isValid(lf.checksum) {
 		err = errors.New("checksum mismatch")
 		return
 	}
@@ -316,7 +410,7 @@ func (lf *logFile) readRecord(offset int64) (record *Record, err error) {
 	return
 }
 
-func readRecord(reader io.Reader) (record *Record, err error) {
+func readRecord(reader io.Reader, checksum ChecksumAlgorithm) (record *Record, err error) {
 	record = new(Record)
 	err = record.readHeader(reader)
 	if err != nil {
@@ -345,7 +439,7 @@ func readRecord(reader io.Reader) (record *Record, err error) {
 		record.payload = buf.Bytes()
 	}
 
-	if !record.isValid() {
+	if !record.isValid(checksum) {
 		return nil, errors.New("checksum mismatch")
 	}
 
@@ -388,6 +482,13 @@ func (lf *logFile) reportCorruption(bytes int, err error) {
 
 // scan is *Not* thread safe
 func (lf *logFile) scan(startOffset int64, fn func(vp valuePointer, record *Record) error) error {
+	return lf.scanWithReporter(startOffset, fn, func(offset int64, bytes int, reason error) {
+		lf.reportCorruption(bytes, reason)
+	})
+}
+
+// scanWithReporter is like scan, and report is notified of the offset and the length of the corrupt bytes skipped.
+func (lf *logFile) scanWithReporter(startOffset int64, fn func(vp valuePointer, record *Record) error, report func(offset int64, bytes int, reason error)) error {
 	info, err := lf.fd.Stat()
 	if err != nil {
 		return err
@@ -400,23 +501,27 @@ func (lf *logFile) scan(startOffset int64, fn func(vp valuePointer, record *Reco
 	}
 
 	offset := startOffset
+	if offset < lf.dataOffset {
+		offset = lf.dataOffset
+	}
 	var reader = bufio.NewReader(io.NewSectionReader(lf.fd, offset, size-offset))
 
 	for offset < size {
-		r, err := readRecord(reader)
+		r, err := readRecord(reader, lf.checksum)
 		if err != nil {
+			corruptOffset := offset
 			offset = offset + 1
 			reader = bufio.NewReader(io.NewSectionReader(lf.fd, offset, size-offset))
 			bytes, seekErr := seekToNextRecord(reader)
 			if seekErr == nil {
 				offset += int64(bytes)
-				lf.reportCorruption(bytes+1, err)
+				report(corruptOffset, bytes+1, err)
 				continue
 			}
 
 			// reach file end
 			if errors.Cause(seekErr) == io.EOF {
-				lf.reportCorruption(int(size)-int(offset), err)
+				report(corruptOffset, int(size)-int(offset), err)
 				return nil
 			}
 
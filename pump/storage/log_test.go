@@ -16,6 +16,7 @@ package storage
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"hash/crc32"
 	"io"
 	"math/rand"
@@ -63,7 +64,7 @@ func (lfs *LogFileSuit) SetUpTest(c *check.C) {
 	name := path.Join(os.TempDir(), strconv.Itoa(fid))
 	c.Log("file path: ", name)
 
-	lf, err := newLogFile(uint32(fid), name)
+	lf, err := newLogFile(uint32(fid), name, ChecksumCRC32)
 	c.Assert(err, check.IsNil)
 	lfs.lf = lf
 }
@@ -75,7 +76,7 @@ func (lfs *LogFileSuit) TearDownTest(c *check.C) {
 
 func (lfs *LogFileSuit) TestWriteOffset(c *check.C) {
 	dir := c.MkDir()
-	f, err := newLogFile(1024, filepath.Join(dir, "1024.vlog"))
+	f, err := newLogFile(1024, filepath.Join(dir, "1024.vlog"), ChecksumCRC32)
 	c.Assert(err, check.IsNil)
 	c.Assert(f.GetWriteOffset(), check.Equals, int64(0))
 
@@ -90,14 +91,14 @@ func (lfs *LogFileSuit) TestSeekToNextRecord(c *check.C) {
 
 	// first write a record
 	var payload = make([]byte, 100)
-	recordLen, err := encodeRecord(buffer, payload)
+	recordLen, err := encodeRecord(buffer, payload, ChecksumCRC32)
 	c.Log("record len: ", recordLen)
 	c.Assert(err, check.IsNil)
 	// write corruption data
 	_, err = buffer.Write(payload)
 	c.Assert(err, check.IsNil)
 	// write a record again
-	recordLen, err = encodeRecord(buffer, payload)
+	recordLen, err = encodeRecord(buffer, payload, ChecksumCRC32)
 	c.Assert(err, check.IsNil)
 
 	// data contains <record><payload len zero data><record>
@@ -126,7 +127,7 @@ func (lfs *LogFileSuit) TestSimpleCorruption(c *check.C) {
 	lf := lfs.lf
 	var payload = make([]byte, 100)
 	// write one record
-	recordLen, err := encodeRecord(lf.fd, payload)
+	recordLen, err := encodeRecord(lf.fd, payload, ChecksumCRC32)
 	c.Assert(err, check.IsNil)
 
 	// truncate file
@@ -134,7 +135,7 @@ func (lfs *LogFileSuit) TestSimpleCorruption(c *check.C) {
 	c.Assert(err, check.IsNil)
 
 	// write one record
-	_, err = encodeRecord(lf.fd, payload)
+	_, err = encodeRecord(lf.fd, payload, ChecksumCRC32)
 	c.Assert(err, check.IsNil)
 
 	// should get the later one record write
@@ -175,7 +176,7 @@ func (lfs *LogFileSuit) TestCorruption(c *check.C) {
 	// the size of the log file
 	var size int
 	for idx, payload := range payloads {
-		n, err := encodeRecord(lf.fd, payload)
+		n, err := encodeRecord(lf.fd, payload, ChecksumCRC32)
 		c.Assert(err, check.IsNil)
 		size += n
 
@@ -229,7 +230,7 @@ func (lfs *LogFileSuit) TestLogFile(c *check.C) {
 	c.Check(len(records), check.Greater, 0)
 
 	for _, r := range records {
-		_, err := encodeRecord(lf.fd, r.payload)
+		_, err := encodeRecord(lf.fd, r.payload, ChecksumCRC32)
 		c.Assert(err, check.IsNil)
 	}
 
@@ -267,8 +268,103 @@ func (lfs *LogFileSuit) TestLogFile(c *check.C) {
 	c.Assert(int(lf.maxTS), check.Equals, 0, check.Commentf("lf.maxTS should be 0, we didn't update it"))
 
 	lf.close()
-	lf, err = newLogFile(lf.fid, lf.path)
+	lf, err = newLogFile(lf.fid, lf.path, ChecksumCRC32)
 	c.Assert(err, check.IsNil)
 
 	c.Assert(lf.maxTS, check.Equals, lfs.maxTS)
 }
+
+func (lfs *LogFileSuit) TestChecksumAlgorithm(c *check.C) {
+	dir := c.MkDir()
+	name := filepath.Join(dir, "000001.vlog")
+	lf, err := newLogFile(1, name, ChecksumXXH64)
+	c.Assert(err, check.IsNil)
+	c.Assert(lf.GetWriteOffset(), check.Equals, fileHeaderLength)
+
+	payload, err := (&pb.Binlog{StartTs: 1, CommitTs: 2}).Marshal()
+	c.Assert(err, check.IsNil)
+	buf := new(bytes.Buffer)
+	_, err = encodeRecord(buf, payload, lf.checksum)
+	c.Assert(err, check.IsNil)
+	c.Assert(lf.Write(buf.Bytes(), true), check.IsNil)
+
+	record, err := lf.readRecord(fileHeaderLength)
+	c.Assert(err, check.IsNil)
+	c.Assert(record.payload, check.BytesEquals, payload)
+	c.Assert(record.checksum, check.Not(check.Equals), crc32.Checksum(payload, crcTable))
+	c.Assert(lf.close(), check.IsNil)
+
+	// the algorithm of the existing file is detected whatever configured.
+	lf, err = newLogFile(1, name, ChecksumCRC32)
+	c.Assert(err, check.IsNil)
+	c.Assert(lf.checksum, check.Equals, ChecksumXXH64)
+	c.Assert(lf.maxTS, check.Equals, int64(2))
+	var offsets []int64
+	err = lf.scan(0, func(vp valuePointer, r *Record) error {
+		offsets = append(offsets, vp.Offset)
+		c.Assert(r.payload, check.BytesEquals, payload)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(offsets, check.DeepEquals, []int64{fileHeaderLength})
+	c.Assert(lf.close(), check.IsNil)
+
+	// the files of crc32 have no header.
+	lf, err = newLogFile(2, filepath.Join(dir, "000002.vlog"), ChecksumCRC32)
+	c.Assert(err, check.IsNil)
+	c.Assert(lf.GetWriteOffset(), check.Equals, int64(0))
+	c.Assert(lf.close(), check.IsNil)
+
+	header := make([]byte, fileHeaderLength)
+	binary.LittleEndian.PutUint32(header, fileHeaderMagic)
+	header[4] = 100
+	name = filepath.Join(dir, "000003.vlog")
+	c.Assert(os.WriteFile(name, header, 0644), check.IsNil)
+	_, err = newLogFile(3, name, ChecksumCRC32)
+	c.Assert(err, check.ErrorMatches, "unknown checksum algorithm 100 of file .*")
+}
+
+func (lfs *LogFileSuit) TestTruncatePartialRecord(c *check.C) {
+	name := filepath.Join(c.MkDir(), "000001.vlog")
+	lf, err := newLogFile(1, name, ChecksumCRC32)
+	c.Assert(err, check.IsNil)
+
+	payload, err := (&pb.Binlog{StartTs: 1, CommitTs: 2}).Marshal()
+	c.Assert(err, check.IsNil)
+	buf := new(bytes.Buffer)
+	_, err = encodeRecord(buf, payload, lf.checksum)
+	c.Assert(err, check.IsNil)
+	record := buf.Bytes()
+	c.Assert(lf.Write(record, true), check.IsNil)
+	// a crash leaves a part of the second record.
+	c.Assert(lf.Write(record[:len(record)-3], true), check.IsNil)
+	c.Assert(lf.close(), check.IsNil)
+
+	lf, err = newLogFile(1, name, ChecksumCRC32)
+	c.Assert(err, check.IsNil)
+	c.Assert(lf.GetWriteOffset(), check.Equals, int64(len(record)))
+	info, err := os.Stat(name)
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Size(), check.Equals, int64(len(record)))
+
+	// the record written after reopening follows the first one.
+	c.Assert(lf.Write(record, true), check.IsNil)
+	var offsets []int64
+	err = lf.scan(0, func(vp valuePointer, r *Record) error {
+		offsets = append(offsets, vp.Offset)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(offsets, check.DeepEquals, []int64{0, int64(len(record))})
+	c.Assert(lf.close(), check.IsNil)
+}
+
+func (lfs *LogFileSuit) TestParseChecksumAlgorithm(c *check.C) {
+	for name, expected := range map[string]ChecksumAlgorithm{"": ChecksumCRC32, "crc32": ChecksumCRC32, "xxh64": ChecksumXXH64} {
+		checksum, err := ParseChecksumAlgorithm(name)
+		c.Assert(err, check.IsNil)
+		c.Assert(checksum, check.Equals, expected)
+	}
+	_, err := ParseChecksumAlgorithm("md5")
+	c.Assert(err, check.ErrorMatches, "unknown checksum algorithm md5.*")
+}
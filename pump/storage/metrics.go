@@ -100,6 +100,54 @@ var (
 			Help:      "The number of times of various slow chaser state changes.",
 		}, []string{"type"})
 
+	readCacheCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "pump_storage",
+			Name:      "read_cache_count",
+			Help:      "The number of hits and misses of the read cache of recently appended binlogs.",
+		}, []string{"type"})
+
+	readCacheSizeGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "pump_storage",
+			Name:      "read_cache_size_bytes",
+			Help:      "The total size of the payloads in the read cache.",
+		})
+
+	ioLimitWaitTimeCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "pump_storage",
+			Name:      "io_limit_wait_seconds_total",
+			Help:      "The total time waited for the rate limits of reading and writing the value log.",
+		}, []string{"type"})
+
+	scrubFileCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "pump_storage",
+			Name:      "scrub_file_total",
+			Help:      "The number of the value log files scrubbed by the result, ok, corrupt or error.",
+		}, []string{"result"})
+
+	scrubCorruptRecordsCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "binlog",
+			Subsystem: "pump_storage",
+			Name:      "scrub_corrupt_records_total",
+			Help:      "The number of the corrupt records found by scrubbing the value log files.",
+		})
+
+	scrubCorruptFilesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "binlog",
+			Subsystem: "pump_storage",
+			Name:      "scrub_corrupt_files",
+			Help:      "The number of the value log files having corrupt records found by the last scrub.",
+		})
+
 	slowChaserCatchUpTimeHistogram = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Namespace: "binlog",
@@ -123,4 +171,10 @@ func InitMetircs(registry *prometheus.Registry) {
 	registry.MustRegister(storageSizeGauge)
 	registry.MustRegister(slowChaserCount)
 	registry.MustRegister(slowChaserCatchUpTimeHistogram)
+	registry.MustRegister(readCacheCounter)
+	registry.MustRegister(readCacheSizeGauge)
+	registry.MustRegister(ioLimitWaitTimeCounter)
+	registry.MustRegister(scrubFileCounter)
+	registry.MustRegister(scrubCorruptRecordsCounter)
+	registry.MustRegister(scrubCorruptFilesGauge)
 }
@@ -0,0 +1,85 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// IOLimit is the rate limit of the disk IO, 0 means unlimited.
+type IOLimit struct {
+	BytesPerSecond int64
+	IOPS           int
+}
+
+// ioLimiter limits the bytes and operations per second of the disk IO, a nil
+// ioLimiter doesn't limit anything.
+type ioLimiter struct {
+	label string
+	bytes *rate.Limiter
+	ops   *rate.Limiter
+}
+
+func newIOLimiter(label string, limit IOLimit) *ioLimiter {
+	if limit.BytesPerSecond <= 0 && limit.IOPS <= 0 {
+		return nil
+	}
+
+	l := &ioLimiter{label: label}
+	if limit.BytesPerSecond > 0 {
+		// allow to burst for one second
+		l.bytes = rate.NewLimiter(rate.Limit(limit.BytesPerSecond), int(limit.BytesPerSecond))
+	}
+	if limit.IOPS > 0 {
+		l.ops = rate.NewLimiter(rate.Limit(limit.IOPS), limit.IOPS)
+	}
+	return l
+}
+
+// wait blocks until one operation of n bytes is allowed, the bytes larger than
+// the burst are waited for in several rounds.
+func (l *ioLimiter) wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	beginTime := time.Now()
+	defer func() {
+		ioLimitWaitTimeCounter.WithLabelValues(l.label).Add(time.Since(beginTime).Seconds())
+	}()
+
+	if l.ops != nil {
+		if err := l.ops.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	if l.bytes != nil {
+		burst := l.bytes.Burst()
+		for n > 0 {
+			m := n
+			if m > burst {
+				m = burst
+			}
+			if err := l.bytes.WaitN(ctx, m); err != nil {
+				return err
+			}
+			n -= m
+		}
+	}
+	return nil
+}
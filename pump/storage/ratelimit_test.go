@@ -0,0 +1,59 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/check"
+)
+
+type ioLimiterSuite struct{}
+
+var _ = check.Suite(&ioLimiterSuite{})
+
+func (s *ioLimiterSuite) TestIORateLimit(c *check.C) {
+	var cfg IORateLimit
+	c.Assert(cfg.IOLimit(), check.Equals, IOLimit{})
+	c.Assert(newIOLimiter("read", cfg.IOLimit()), check.IsNil)
+
+	var bytes HumanizeBytes
+	c.Assert(bytes.UnmarshalText([]byte("1 kib")), check.IsNil)
+	cfg = IORateLimit{BytesPerSecond: &bytes, IOPS: 10}
+	c.Assert(cfg.IOLimit(), check.Equals, IOLimit{BytesPerSecond: 1024, IOPS: 10})
+}
+
+func (s *ioLimiterSuite) TestWait(c *check.C) {
+	ctx := context.Background()
+	var limiter *ioLimiter
+	c.Assert(limiter.wait(ctx, 1<<30), check.IsNil)
+
+	// the bytes larger than the burst
+	limiter = newIOLimiter("read", IOLimit{BytesPerSecond: 100})
+	beginTime := time.Now()
+	c.Assert(limiter.wait(ctx, 150), check.IsNil)
+	c.Assert(time.Since(beginTime), check.Greater, 400*time.Millisecond)
+
+	limiter = newIOLimiter("write", IOLimit{IOPS: 10})
+	beginTime = time.Now()
+	for i := 0; i < 12; i++ {
+		c.Assert(limiter.wait(ctx, 1<<20), check.IsNil)
+	}
+	c.Assert(time.Since(beginTime), check.Greater, 150*time.Millisecond)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	c.Assert(limiter.wait(cctx, 1), check.NotNil)
+}
@@ -0,0 +1,297 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"go.uber.org/zap"
+)
+
+var (
+	// save the ScrubStatus of every value log file, the key is followed by the fid of the file
+	scrubKeyPrefix = []byte("!binlog!scrub!")
+	// how often to look for the files to scrub, variable for test
+	scrubRoundInterval = time.Minute
+)
+
+// the results of scrubbing a file in the metrics.
+const (
+	scrubResultOK      = "ok"
+	scrubResultCorrupt = "corrupt"
+	scrubResultError   = "error"
+)
+
+// CorruptRange is the corrupt bytes found by scrubbing a value log file, the records in it can't be read.
+type CorruptRange struct {
+	Offset int64  `json:"offset"`
+	Length int    `json:"length"`
+	Reason string `json:"reason"`
+}
+
+// ScrubStatus is the result of the last scrub of a value log file.
+type ScrubStatus struct {
+	Fid        uint32    `json:"fid"`
+	Path       string    `json:"path"`
+	ScrubbedAt time.Time `json:"scrubbed-at"`
+	// Records is the number of the records verified.
+	Records int `json:"records"`
+	// MaxTS is the max ts of the binlogs in the file.
+	MaxTS   int64          `json:"max-ts"`
+	Corrupt []CorruptRange `json:"corrupt,omitempty"`
+	// Repair is what to do with the corrupt file, empty if it's not corrupt.
+	Repair string `json:"repair,omitempty"`
+}
+
+// ScrubReport is the result of scrubbing the value log files still kept by pump.
+type ScrubReport struct {
+	// Enabled is false if scrub-interval isn't set.
+	Enabled  bool   `json:"enabled"`
+	Interval string `json:"interval,omitempty"`
+	// Scrubbing is the fid of the file being scrubbed, -1 if none.
+	Scrubbing int64 `json:"scrubbing"`
+	// CorruptFiles and CorruptRecords are the sums of the files in Files, the adjacent corrupt
+	// records are counted as one since they're skipped together.
+	CorruptFiles   int `json:"corrupt-files"`
+	CorruptRecords int `json:"corrupt-records"`
+	// Files are the statuses of the files scrubbed, in the order of fid.
+	Files []*ScrubStatus `json:"files"`
+}
+
+func encodeScrubKey(fid uint32) []byte {
+	buf := make([]byte, len(scrubKeyPrefix)+4)
+	copy(buf, scrubKeyPrefix)
+	binary.BigEndian.PutUint32(buf[len(scrubKeyPrefix):], fid)
+	return buf
+}
+
+func (a *Append) readScrubStatus(fid uint32) (*ScrubStatus, error) {
+	value, err := a.metadata.Get(encodeScrubKey(fid), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	status := new(ScrubStatus)
+	if err = json.Unmarshal(value, status); err != nil {
+		return nil, errors.Annotatef(err, "decode scrub status of file %d failed", fid)
+	}
+	return status, nil
+}
+
+func (a *Append) saveScrubStatus(status *ScrubStatus) error {
+	value, err := json.Marshal(status)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(a.metadata.Put(encodeScrubKey(status.Fid), value, nil))
+}
+
+// closedFids returns the fids of the files no more written, in order.
+func (vlog *valueLog) closedFids() []uint32 {
+	vlog.filesLock.RLock()
+	defer vlog.filesLock.RUnlock()
+
+	maxFid := atomic.LoadUint32(&vlog.maxFid)
+	var fids []uint32
+	for _, fid := range vlog.sortedFids() {
+		if fid < maxFid {
+			fids = append(fids, fid)
+		}
+	}
+	return fids
+}
+
+// scrub verifies the checksums of all the records in the closed value log files in the background, so the
+// latent corruption of the disk is found before a drainer reads the binlogs. A file is scrubbed again
+// after interval since its last scrub, and the result is saved in metadata.
+func (a *Append) scrub(interval time.Duration) {
+	defer a.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-a.close
+		cancel()
+	}()
+
+	ticker := time.NewTicker(scrubRoundInterval)
+	defer ticker.Stop()
+	for {
+		if err := a.scrubRound(ctx, interval); err != nil && ctx.Err() == nil {
+			log.Warn("scrub value log files failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scrubRound scrubs the closed files not scrubbed within interval, and forgets the files deleted by GC.
+func (a *Append) scrubRound(ctx context.Context, interval time.Duration) error {
+	fids := a.vlog.closedFids()
+	if err := a.forgetScrubStatus(fids); err != nil {
+		return errors.Trace(err)
+	}
+
+	corruptFiles := 0
+	for _, fid := range fids {
+		if ctx.Err() != nil {
+			return nil
+		}
+		status, err := a.readScrubStatus(fid)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if status == nil || time.Since(status.ScrubbedAt) >= interval {
+			status, err = a.scrubFile(ctx, fid)
+			if err != nil && errors.IsNotFound(err) {
+				// deleted by GC.
+				continue
+			}
+			if err != nil {
+				scrubFileCounter.WithLabelValues(scrubResultError).Inc()
+				return errors.Trace(err)
+			}
+		}
+		if len(status.Corrupt) > 0 {
+			corruptFiles++
+		}
+	}
+	scrubCorruptFilesGauge.Set(float64(corruptFiles))
+	return nil
+}
+
+// forgetScrubStatus deletes the statuses of the files not in fids any more.
+func (a *Append) forgetScrubStatus(fids []uint32) error {
+	exists := make(map[uint32]struct{}, len(fids))
+	for _, fid := range fids {
+		exists[fid] = struct{}{}
+	}
+
+	iter := a.metadata.NewIterator(util.BytesPrefix(scrubKeyPrefix), nil)
+	defer iter.Release()
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		fid := binary.BigEndian.Uint32(iter.Key()[len(scrubKeyPrefix):])
+		if _, ok := exists[fid]; !ok {
+			batch.Delete(append([]byte(nil), iter.Key()...))
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return errors.Trace(err)
+	}
+	if batch.Len() == 0 {
+		return nil
+	}
+	return errors.Trace(a.metadata.Write(batch, nil))
+}
+
+// scrubFile verifies the records of the file and saves the status, the disk IO is limited by the scrub
+// limiter. The file is not deleted by GC while it's scrubbed.
+func (a *Append) scrubFile(ctx context.Context, fid uint32) (*ScrubStatus, error) {
+	lf, err := a.vlog.getFileRLocked(fid)
+	if err != nil {
+		return nil, err
+	}
+	defer lf.lock.RUnlock()
+
+	atomic.StoreInt64(&a.scrubbingFid, int64(fid))
+	defer atomic.StoreInt64(&a.scrubbingFid, -1)
+
+	log.Info("scrub value log file", zap.String("path", lf.path))
+	status := &ScrubStatus{Fid: fid, Path: lf.path, MaxTS: lf.maxTS}
+	err = lf.scanWithReporter(0, func(vp valuePointer, r *Record) error {
+		status.Records++
+		return errors.Trace(a.scrubLimiter.wait(ctx, int(r.recordLength())))
+	}, func(offset int64, bytes int, reason error) {
+		status.Corrupt = append(status.Corrupt, CorruptRange{Offset: offset, Length: bytes, Reason: reason.Error()})
+	})
+	if err != nil {
+		return nil, errors.Annotatef(err, "scrub file %s failed", lf.path)
+	}
+	status.ScrubbedAt = time.Now()
+
+	if len(status.Corrupt) > 0 {
+		log.Error("corrupt records are found in value log file",
+			zap.String("path", lf.path), zap.Reflect("corrupt", status.Corrupt))
+		scrubFileCounter.WithLabelValues(scrubResultCorrupt).Inc()
+		scrubCorruptRecordsCounter.Add(float64(len(status.Corrupt)))
+	} else {
+		scrubFileCounter.WithLabelValues(scrubResultOK).Inc()
+	}
+
+	if err = a.saveScrubStatus(status); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return status, nil
+}
+
+// repairAdvice returns what to do with the corrupt file of the status.
+func repairAdvice(status *ScrubStatus, gcTS int64) string {
+	if len(status.Corrupt) == 0 {
+		return ""
+	}
+	if status.MaxTS <= vlogGCTS(gcTS) {
+		return "the binlogs in the file are all GCed, it's deleted by the next GC"
+	}
+	return "the binlogs in the corrupt ranges can't be read, the drainers with checkpoints before max-ts may " +
+		"miss them, check the downstream of them or restore it from a backup"
+}
+
+// ScrubReport implement Storage.ScrubReport
+func (a *Append) ScrubReport() *ScrubReport {
+	report := &ScrubReport{
+		Enabled:   a.options.ScrubInterval > 0,
+		Scrubbing: atomic.LoadInt64(&a.scrubbingFid),
+		Files:     []*ScrubStatus{},
+	}
+	if report.Enabled {
+		report.Interval = a.options.ScrubInterval.String()
+	}
+
+	gcTS := a.GetGCTS()
+	iter := a.metadata.NewIterator(util.BytesPrefix(scrubKeyPrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		status := new(ScrubStatus)
+		if err := json.Unmarshal(iter.Value(), status); err != nil {
+			log.Warn("decode scrub status failed", zap.Binary("key", iter.Key()), zap.Error(err))
+			continue
+		}
+		status.Repair = repairAdvice(status, gcTS)
+		if len(status.Corrupt) > 0 {
+			report.CorruptFiles++
+			report.CorruptRecords += len(status.Corrupt)
+		}
+		report.Files = append(report.Files, status)
+	}
+	if err := iter.Error(); err != nil {
+		log.Warn("read scrub status failed", zap.Error(err))
+	}
+	return report
+}
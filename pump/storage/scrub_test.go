@@ -0,0 +1,88 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pingcap/check"
+)
+
+type scrubSuite struct{}
+
+var _ = check.Suite(&scrubSuite{})
+
+func (s *scrubSuite) TestScrub(c *check.C) {
+	append := newAppendWithOptions(c, DefaultOptions().WithValueLogFileSize(2048))
+	defer cleanAppend(append)
+
+	populateBinlog(c, append, 100, 50)
+	fids := append.vlog.closedFids()
+	c.Assert(len(fids), check.Greater, 1)
+	c.Assert(append.ScrubReport().Enabled, check.IsFalse)
+
+	// flip a byte of the payload of the first record of the first file.
+	fd, err := os.OpenFile(append.vlog.filePath(fids[0]), os.O_RDWR, 0)
+	c.Assert(err, check.IsNil)
+	buf := make([]byte, 1)
+	_, err = fd.ReadAt(buf, headerLength+2)
+	c.Assert(err, check.IsNil)
+	buf[0] ^= 0xff
+	_, err = fd.WriteAt(buf, headerLength+2)
+	c.Assert(err, check.IsNil)
+	c.Assert(fd.Close(), check.IsNil)
+
+	// the status of the file deleted is forgotten.
+	c.Assert(append.saveScrubStatus(&ScrubStatus{Fid: 9999}), check.IsNil)
+
+	c.Assert(append.scrubRound(context.Background(), time.Hour), check.IsNil)
+	report := append.ScrubReport()
+	c.Assert(report.Scrubbing, check.Equals, int64(-1))
+	c.Assert(report.Files, check.HasLen, len(fids))
+	c.Assert(report.CorruptFiles, check.Equals, 1)
+	c.Assert(report.CorruptRecords, check.Equals, 1)
+
+	corrupt := report.Files[0]
+	c.Assert(corrupt.Fid, check.Equals, fids[0])
+	c.Assert(corrupt.Corrupt, check.HasLen, 1)
+	c.Assert(corrupt.Corrupt[0].Offset, check.Equals, int64(0))
+	c.Assert(corrupt.Corrupt[0].Reason, check.Matches, ".*checksum mismatch.*")
+	c.Assert(corrupt.Repair, check.Not(check.Equals), "")
+	for _, status := range report.Files[1:] {
+		c.Assert(status.Corrupt, check.HasLen, 0)
+		c.Assert(status.Records, check.Greater, 0)
+		c.Assert(status.Repair, check.Equals, "")
+	}
+
+	// the files are not scrubbed again within the interval.
+	c.Assert(append.scrubRound(context.Background(), time.Hour), check.IsNil)
+	c.Assert(append.ScrubReport().Files[0].ScrubbedAt.Equal(corrupt.ScrubbedAt), check.IsTrue)
+	c.Assert(append.scrubRound(context.Background(), 0), check.IsNil)
+	c.Assert(append.ScrubReport().Files[0].ScrubbedAt.After(corrupt.ScrubbedAt), check.IsTrue)
+}
+
+func (s *scrubSuite) TestScrubConfig(c *check.C) {
+	cfg := &Config{}
+	c.Assert(cfg.GetScrubInterval(), check.Equals, time.Duration(0))
+	c.Assert(cfg.GetScrubLimit(), check.Equals, IOLimit{BytesPerSecond: defaultScrubBytesPerSecond})
+
+	cfg.ScrubInterval = "7"
+	c.Assert(cfg.GetScrubInterval(), check.Equals, 7*24*time.Hour)
+	cfg.ScrubInterval = "12h"
+	c.Assert(cfg.GetScrubInterval(), check.Equals, 12*time.Hour)
+	cfg.ScrubRateLimit.IOPS = 10
+	c.Assert(cfg.GetScrubLimit(), check.Equals, IOLimit{IOPS: 10})
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/kvproto/pkg/kvrpcpb"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/errorcode"
 	pkgutil "github.com/pingcap/tidb-binlog/pkg/util"
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/store/tikv"
@@ -47,6 +48,9 @@ const (
 	// if pump takes a long time to write binlog, pump will display the binlog meta information (unit: Second)
 	slowWriteThreshold               = 1.0
 	defaultStopWriteAtAvailableSpace = 10 * (1 << 30)
+	defaultReadCacheSize             = 64 * (1 << 20)
+	defaultWriteBatchSize            = 1 << 20
+	defaultScrubBytesPerSecond       = 8 * (1 << 20)
 )
 
 var (
@@ -69,16 +73,29 @@ var (
 type Storage interface {
 	WriteBinlog(binlog *pb.Binlog) error
 
+	// WriteBinlogAfterCommitted writes the binlog only if its start ts is larger than the commit ts
+	// of all the binlogs written before, it's checked in the write path, so no binlog is written in between.
+	WriteBinlogAfterCommitted(binlog *pb.Binlog) error
+
 	// delete <= ts
 	GC(ts int64)
 
 	GetGCTS() int64
 
+	// GCStatus returns the progress of GC
+	GCStatus() *GCStatus
+
 	// AllMatched return if all the P-binlog have the matching C-binlog
 	AllMatched() bool
 
 	MaxCommitTS() int64
 
+	// Stats returns the recent write throughput and disk stats
+	Stats() *WriteStats
+
+	// ScrubReport returns the result of verifying the checksums of the value log files
+	ScrubReport() *ScrubReport
+
 	// GetBinlog return the binlog of ts
 	GetBinlog(ts int64) (binlog *pb.Binlog, err error)
 
@@ -94,8 +111,15 @@ var _ Storage = &Append{}
 type Append struct {
 	dir         string
 	vlog        *valueLog
+	readCache   *readCache
 	storageSize storageSize
 
+	writeLimiter *ioLimiter
+	readLimiter  *ioLimiter
+	scrubLimiter *ioLimiter
+	// scrubbingFid is the fid of the file being scrubbed, -1 if none.
+	scrubbingFid int64
+
 	metadata       *leveldb.DB
 	sorter         *sorter
 	tiStore        kv.Storage
@@ -105,6 +129,7 @@ type Append struct {
 
 	gcWorking     int32
 	gcTS          int64
+	doneGCTS      int64
 	maxCommitTS   int64
 	headPointer   valuePointer
 	handlePointer valuePointer
@@ -166,6 +191,14 @@ func NewAppendWithResolver(dir string, options *Options, tiStore kv.Storage, tiL
 		sortItems: make(chan sortItem, 1024),
 	}
 
+	if options.ReadCacheSize > 0 {
+		append.readCache = newReadCache(options.ReadCacheSize)
+	}
+	append.writeLimiter = newIOLimiter("write", options.WriteLimit)
+	append.readLimiter = newIOLimiter("read", options.ReadLimit)
+	append.scrubLimiter = newIOLimiter("scrub", options.ScrubLimit)
+	append.scrubbingFid = -1
+
 	append.gcTS, err = append.readGCTSFromDB()
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -241,6 +274,11 @@ func NewAppendWithResolver(dir string, options *Options, tiStore kv.Storage, tiL
 	}
 
 	go append.updateStatus()
+
+	if options.ScrubInterval > 0 {
+		append.wg.Add(1)
+		go append.scrub(options.ScrubInterval)
+	}
 	return
 }
 
@@ -403,7 +441,7 @@ func (a *Append) writeCBinlog(pbinlog *pb.Binlog, commitTS int64) error {
 	cbinlog.StartTs = pbinlog.StartTs
 	cbinlog.CommitTs = commitTS
 
-	req := a.writeBinlog(cbinlog)
+	req := a.writeBinlog(cbinlog, false)
 	if req.err != nil {
 		return errors.Annotate(req.err, "writeBinlog failed")
 	}
@@ -521,7 +559,7 @@ func (a *Append) resolve(startTS int64) bool {
 		cbinlog.StartTs = pbinlog.StartTs
 		cbinlog.CommitTs = int64(status.CommitTS())
 
-		req := a.writeBinlog(cbinlog)
+		req := a.writeBinlog(cbinlog, false)
 		if req.err != nil {
 			log.Error("write missing committed binlog failed",
 				zap.Int64("start ts", startTS),
@@ -554,6 +592,27 @@ func (a *Append) resolve(startTS int64) bool {
 	return true
 }
 
+// readValue reads the payload pointed by vp, from the read cache if possible
+func (a *Append) readValue(vp valuePointer) ([]byte, error) {
+	if value, ok := a.readCache.get(vp); ok {
+		return value, nil
+	}
+
+	return a.vlog.readValue(vp)
+}
+
+// pullValue is readValue for the pulling requests, the reading from disk is
+// limited by the read rate limit.
+func (a *Append) pullValue(ctx context.Context, vp valuePointer) ([]byte, error) {
+	if value, ok := a.readCache.get(vp); ok {
+		return value, nil
+	}
+
+	return a.vlog.readValueWait(vp, func(n int) error {
+		return a.readLimiter.wait(ctx, n)
+	})
+}
+
 // GetBinlog gets binlog by ts
 func (a *Append) GetBinlog(ts int64) (*pb.Binlog, error) {
 	return a.readBinlogByTS(ts)
@@ -572,7 +631,7 @@ func (a *Append) readBinlogByTS(ts int64) (*pb.Binlog, error) {
 		return nil, errors.Annotatef(err, "fail read binlog by ts: %d", ts)
 	}
 
-	pvalue, err := a.vlog.readValue(vp)
+	pvalue, err := a.readValue(vp)
 	if err != nil {
 		return nil, errors.Annotatef(err, "fail read binlog by ts: %d", ts)
 	}
@@ -657,6 +716,38 @@ func (a *Append) GetGCTS() int64 {
 	return atomic.LoadInt64(&a.gcTS)
 }
 
+// GCStatus is the progress of GC, the binlogs not greater than GCTS are deleted.
+type GCStatus struct {
+	GCTS int64 `json:"gc-ts"`
+	// DoneGCTS is the ts the last GC has finished, the binlogs in the vlog files are deleted
+	// only if all of them are not greater than it, zero means GC hasn't finished since started.
+	DoneGCTS int64 `json:"done-gc-ts"`
+	// Working is true if a GC is running.
+	Working bool `json:"working"`
+	// PendingFiles and PendingBytes are the vlog files not deleted by GC yet, all the binlogs
+	// in them are not greater than the ts the current GC reclaims up to.
+	PendingFiles int   `json:"pending-files"`
+	PendingBytes int64 `json:"pending-bytes"`
+}
+
+// GCStatus implement Storage.GCStatus
+func (a *Append) GCStatus() *GCStatus {
+	status := &GCStatus{
+		GCTS:     atomic.LoadInt64(&a.gcTS),
+		DoneGCTS: atomic.LoadInt64(&a.doneGCTS),
+		Working:  atomic.LoadInt32(&a.gcWorking) == 1,
+	}
+	status.PendingFiles, status.PendingBytes = a.vlog.reclaimable(vlogGCTS(status.GCTS))
+	return status
+}
+
+// vlogGCTS returns the ts the vlog is reclaimed up to for the gcTS.
+func vlogGCTS(gcTS int64) int64 {
+	// for commit binlog TS ts_c, we may need to get the according P binlog ts_p(ts_p < ts_c
+	// so we forward a little bit to make sure we can get the according P binlog
+	return gcTS - int64(oracle.EncodeTSO(maxTxnTimeoutSecond*1000))
+}
+
 // GC implement Storage.GC
 func (a *Append) GC(ts int64) {
 	lastTS := atomic.LoadInt64(&a.gcTS)
@@ -685,9 +776,7 @@ func (a *Append) GC(ts int64) {
 
 	go func() {
 		defer atomic.StoreInt32(&a.gcWorking, 0)
-		// for commit binlog TS ts_c, we may need to get the according P binlog ts_p(ts_p < ts_c
-		// so we forward a little bit to make sure we can get the according P binlog
-		a.doGCTS(ts - int64(oracle.EncodeTSO(maxTxnTimeoutSecond*1000)))
+		a.doGCTS(vlogGCTS(ts))
 	}()
 }
 
@@ -791,6 +880,7 @@ func (a *Append) doGCTS(ts int64) {
 		log.Info("has delete", zap.Int("delete num", deleteNum))
 	}
 	wg.Wait()
+	atomic.StoreInt64(&a.doneGCTS, ts)
 	doneGcTSGauge.Set(float64(oracle.ExtractPhysical(uint64(ts))))
 }
 
@@ -799,16 +889,34 @@ func (a *Append) MaxCommitTS() int64 {
 	return atomic.LoadInt64(&a.maxCommitTS)
 }
 
+// Stats implement Storage.Stats
+func (a *Append) Stats() *WriteStats {
+	return &WriteStats{
+		WriteBytesPerSecond: a.vlog.stats.rate(time.Now()),
+		FsyncLatencyP99:     a.vlog.stats.fsyncLatencyP99(),
+		DiskFreeBytes:       atomic.LoadUint64(&a.storageSize.available),
+	}
+}
+
 func isFakeBinlog(binlog *pb.Binlog) bool {
 	return binlog.StartTs > 0 && binlog.StartTs == binlog.CommitTs
 }
 
 // WriteBinlog implement Storage.WriteBinlog
 func (a *Append) WriteBinlog(binlog *pb.Binlog) error {
+	return a.writeBinlogIfWritable(binlog, false)
+}
+
+// WriteBinlogAfterCommitted implement Storage.WriteBinlogAfterCommitted
+func (a *Append) WriteBinlogAfterCommitted(binlog *pb.Binlog) error {
+	return a.writeBinlogIfWritable(binlog, true)
+}
+
+func (a *Append) writeBinlogIfWritable(binlog *pb.Binlog, afterCommitted bool) error {
 	if !a.writableOfSpace() {
 		// still accept fake binlog, so will not block drainer if fake binlog writes success
 		if !isFakeBinlog(binlog) {
-			return errors.Errorf("no available space, available: %d, StopWriteAtAvailableSpace: %d", atomic.LoadUint64(&a.storageSize.available), a.options.StopWriteAtAvailableSpace)
+			return errorcode.Newf(errorcode.PumpDiskFull, "no available space, available: %d, StopWriteAtAvailableSpace: %d", atomic.LoadUint64(&a.storageSize.available), a.options.StopWriteAtAvailableSpace)
 		}
 	}
 
@@ -818,10 +926,10 @@ func (a *Append) WriteBinlog(binlog *pb.Binlog) error {
 		return nil
 	}
 
-	return errors.Trace(a.writeBinlog(binlog).err)
+	return errors.Trace(a.writeBinlog(binlog, afterCommitted).err)
 }
 
-func (a *Append) writeBinlog(binlog *pb.Binlog) *request {
+func (a *Append) writeBinlog(binlog *pb.Binlog, afterCommitted bool) *request {
 	beginTime := time.Now()
 	request := new(request)
 
@@ -849,6 +957,7 @@ func (a *Append) writeBinlog(binlog *pb.Binlog) *request {
 	request.startTS = binlog.StartTs
 	request.commitTS = binlog.CommitTs
 	request.tp = binlog.Tp
+	request.afterCommitted = afterCommitted
 	request.wg.Add(1)
 
 	a.writeCh <- request
@@ -952,6 +1061,39 @@ func (a *Append) writeToValueLog(reqs chan *request) chan *request {
 
 		var bufReqs []*request
 		var size int
+		// the max commit ts of the binlogs written, the requests are taken in the order they're written,
+		// the binlogs recovered at start up are counted by maxCommitTS after they're sorted.
+		var committedTS int64
+		accept := func(req *request) bool {
+			if ts := atomic.LoadInt64(&a.maxCommitTS); ts > committedTS {
+				committedTS = ts
+			}
+			if req.afterCommitted && req.startTS <= committedTS {
+				req.err = errorcode.Newf(errorcode.InvalidArgument, "start ts %d is not larger than the commit ts %d of the binlogs written", req.startTS, committedTS)
+				req.wg.Done()
+				return false
+			}
+			if req.commitTS > committedTS {
+				committedTS = req.commitTS
+			}
+			return true
+		}
+
+		maxBatchSize := func(batch []*request) int {
+			if a.options.WriteBatchWait > 0 {
+				return a.options.WriteBatchSize
+			}
+
+			// Allow the group to grow up to a maximum size, but if the
+			// original write is small, limit the growth so we do not slow
+			// down the small write too much.
+			maxSize := 1 << 20
+			firstSize := len(batch[0].payload)
+			if firstSize <= (128 << 10) {
+				maxSize = firstSize + (128 << 10)
+			}
+			return maxSize
+		}
 
 		write := func(batch []*request) {
 			slowChaser.WriteLock.Lock()
@@ -962,10 +1104,18 @@ func (a *Append) writeToValueLog(reqs chan *request) chan *request {
 			}
 			br := batchRequest(batch)
 			log.Debug("write requests to value log", zap.Stringer("requests", &br))
+			var payloadSize int
+			for _, req := range batch {
+				payloadSize += len(req.payload)
+			}
+			// the wait fails only if ctx is canceled, which happens after all the writes.
+			err := a.writeLimiter.wait(ctx, payloadSize)
+
 			beginTime := time.Now()
 			writeBinlogSizeHistogram.WithLabelValues("batch").Observe(float64(size))
-
-			err := a.vlog.write(batch)
+			if err == nil {
+				err = a.vlog.write(batch)
+			}
 			writeBinlogTimeHistogram.WithLabelValues("batch").Observe(time.Since(beginTime).Seconds())
 			if err != nil {
 				for _, req := range batch {
@@ -979,6 +1129,7 @@ func (a *Append) writeToValueLog(reqs chan *request) chan *request {
 			for _, req := range batch {
 				log.Debug("request done", zap.Int64("startTS", req.startTS), zap.Int64("commitTS", req.commitTS))
 				req.wg.Done()
+				a.readCache.add(req.valuePointer, req.payload)
 				// payload is useless anymore, let it GC ASAP
 				req.payload = nil
 			}
@@ -1004,38 +1155,67 @@ func (a *Append) writeToValueLog(reqs chan *request) chan *request {
 					write(bufReqs)
 					return
 				}
+				if !accept(req) {
+					continue
+				}
 				bufReqs = append(bufReqs, req)
 				size += len(req.payload)
 
-				// Allow the group to grow up to a maximum size, but if the
-				// original write is small, limit the growth so we do not slow
-				// down the small write too much.
-				maxSize := 1 << 20
-				firstSize := len(bufReqs[0].payload)
-				if firstSize <= (128 << 10) {
-					maxSize = firstSize + (128 << 10)
-				}
-
-				if size >= maxSize {
+				if size >= maxBatchSize(bufReqs) {
 					write(bufReqs)
 					size = 0
 					bufReqs = bufReqs[:0]
 				}
 			default:
-				if len(bufReqs) > 0 {
+				if len(bufReqs) > 0 && a.options.WriteBatchWait <= 0 {
 					write(bufReqs)
 					size = 0
 					bufReqs = bufReqs[:0]
 					continue
 				}
 
-				// get first
-				req, ok := <-reqs
-				if !ok {
-					return
+				if len(bufReqs) == 0 {
+					// get first
+					req, ok := <-reqs
+					if !ok {
+						return
+					}
+					if !accept(req) {
+						continue
+					}
+					bufReqs = append(bufReqs, req)
+					size += len(req.payload)
+
+					if a.options.WriteBatchWait <= 0 {
+						continue
+					}
 				}
-				bufReqs = append(bufReqs, req)
-				size += len(req.payload)
+
+				// wait a while for more requests, so the requests can be written and
+				// synced to disk in one batch, and all of them are acked afterwards.
+				timer := time.NewTimer(a.options.WriteBatchWait)
+			WAIT:
+				for size < maxBatchSize(bufReqs) {
+					select {
+					case req, ok := <-reqs:
+						if !ok {
+							timer.Stop()
+							write(bufReqs)
+							return
+						}
+						if !accept(req) {
+							continue
+						}
+						bufReqs = append(bufReqs, req)
+						size += len(req.payload)
+					case <-timer.C:
+						break WAIT
+					}
+				}
+				timer.Stop()
+				write(bufReqs)
+				size = 0
+				bufReqs = bufReqs[:0]
 			}
 		}
 	}()
@@ -1075,7 +1255,7 @@ func (a *Append) savePointer(key []byte, vp valuePointer) error {
 	return nil
 }
 
-func (a *Append) feedPreWriteValue(cbinlog *pb.Binlog) error {
+func (a *Append) feedPreWriteValue(ctx context.Context, cbinlog *pb.Binlog) error {
 	var vp valuePointer
 
 	vpData, err := a.metadata.Get(encodeTSKey(cbinlog.StartTs), nil)
@@ -1088,7 +1268,7 @@ func (a *Append) feedPreWriteValue(cbinlog *pb.Binlog) error {
 		return errors.Trace(err)
 	}
 
-	pvalue, err := a.vlog.readValue(vp)
+	pvalue, err := a.pullValue(ctx, vp)
 	if err != nil {
 		return errors.Annotatef(err, "read P-Binlog value failed, vp: %+v", vp)
 	}
@@ -1169,8 +1349,12 @@ func (a *Append) PullCommitBinlog(ctx context.Context, last int64) <-chan []byte
 
 				log.Debug("get binlog", zap.Int64("ts", decodeTSKey(iter.Key())), zap.Reflect("pointer", vp))
 
-				value, err := a.vlog.readValue(vp)
+				value, err := a.pullValue(ctx, vp)
 				if err != nil {
+					if errors.Cause(err) == context.Canceled {
+						iter.Release()
+						return
+					}
 					log.Error("read value failed", zap.Error(err))
 					iter.Release()
 					errorCount.WithLabelValues("read_value").Add(1.0)
@@ -1193,7 +1377,7 @@ func (a *Append) PullCommitBinlog(ctx context.Context, last int64) <-chan []byte
 					// this should be a fake binlog, drainer should ignore this when push binlog to the downstream
 					log.Debug("get fake c binlog", zap.Int64("CommitTS", binlog.CommitTs))
 				} else {
-					err = a.feedPreWriteValue(binlog)
+					err = a.feedPreWriteValue(ctx, binlog)
 					if err != nil {
 						if errors.Cause(err) == leveldb.ErrNotFound {
 							// In pump-client, a C-binlog should always be sent to the same pump instance as the matching P-binlog.
@@ -1289,6 +1473,38 @@ type Config struct {
 	SlowWriteThreshold        float64        `toml:"slow_write_threshold" json:"slow_write_threshold"`
 	KV                        *KVConfig      `toml:"kv" json:"kv"`
 	StopWriteAtAvailableSpace *HumanizeBytes `toml:"stop-write-at-available-space" json:"stop-write-at-available-space"`
+	// the max total size of the recently appended binlogs kept in memory to serve the pulling requests
+	ReadCacheSize *HumanizeBytes `toml:"read-cache-size" json:"read-cache-size"`
+	// how long (unit: Microsecond) to wait for more binlogs to write and sync to disk in one batch
+	WriteBatchWaitUs int `toml:"write-batch-wait-us" json:"write-batch-wait-us"`
+	// the max total size of the binlogs written in one batch when write-batch-wait-us is set
+	WriteBatchSize *HumanizeBytes `toml:"write-batch-size" json:"write-batch-size"`
+	// the rate limits of writing binlogs to disk and reading them for drainers
+	WriteRateLimit IORateLimit `toml:"write-rate-limit" json:"write-rate-limit"`
+	ReadRateLimit  IORateLimit `toml:"read-rate-limit" json:"read-rate-limit"`
+
+	// the checksum algorithm of the binlogs in the new value log files, "crc32" or "xxh64"
+	Checksum string `toml:"checksum" json:"checksum"`
+
+	// how often to verify the checksums of the binlogs in the closed value log files, empty means disabled
+	ScrubInterval pkgutil.Duration `toml:"scrub-interval" json:"scrub-interval"`
+	// the rate limit of reading the files to verify, 8 MiB per second if unset
+	ScrubRateLimit IORateLimit `toml:"scrub-rate-limit" json:"scrub-rate-limit"`
+}
+
+// IORateLimit is the config of the rate limit of disk IO, 0 means unlimited.
+type IORateLimit struct {
+	BytesPerSecond *HumanizeBytes `toml:"bytes-per-second" json:"bytes-per-second"`
+	IOPS           int            `toml:"iops" json:"iops"`
+}
+
+// IOLimit return the IOLimit of the config
+func (c IORateLimit) IOLimit() IOLimit {
+	limit := IOLimit{IOPS: c.IOPS}
+	if c.BytesPerSecond != nil {
+		limit.BytesPerSecond = int64(c.BytesPerSecond.Uint64())
+	}
+	return limit
 }
 
 // GetKVChanCapacity return kv_chan_cap config option
@@ -1318,6 +1534,59 @@ func (c *Config) GetStopWriteAtAvailableSpace() uint64 {
 	return c.StopWriteAtAvailableSpace.Uint64()
 }
 
+// GetReadCacheSize return read-cache-size config option
+func (c *Config) GetReadCacheSize() int64 {
+	if c.ReadCacheSize == nil {
+		return defaultReadCacheSize
+	}
+
+	return int64(c.ReadCacheSize.Uint64())
+}
+
+// GetWriteBatchWait return write-batch-wait-us config option
+func (c *Config) GetWriteBatchWait() time.Duration {
+	if c.WriteBatchWaitUs <= 0 {
+		return 0
+	}
+
+	return time.Duration(c.WriteBatchWaitUs) * time.Microsecond
+}
+
+// GetWriteBatchSize return write-batch-size config option
+func (c *Config) GetWriteBatchSize() int {
+	if c.WriteBatchSize == nil || c.WriteBatchSize.Uint64() == 0 {
+		return defaultWriteBatchSize
+	}
+
+	return int(c.WriteBatchSize.Uint64())
+}
+
+// GetChecksum return checksum config option, it's crc32 if the option is invalid
+func (c *Config) GetChecksum() ChecksumAlgorithm {
+	checksum, _ := ParseChecksumAlgorithm(c.Checksum)
+	return checksum
+}
+
+// GetScrubInterval return scrub-interval config option, it's 0 if the option is empty or invalid
+func (c *Config) GetScrubInterval() time.Duration {
+	if len(c.ScrubInterval) == 0 {
+		return 0
+	}
+
+	interval, _ := c.ScrubInterval.ParseDuration()
+	return interval
+}
+
+// GetScrubLimit return scrub-rate-limit config option
+func (c *Config) GetScrubLimit() IOLimit {
+	limit := c.ScrubRateLimit.IOLimit()
+	if limit.BytesPerSecond <= 0 && limit.IOPS <= 0 {
+		limit.BytesPerSecond = defaultScrubBytesPerSecond
+	}
+
+	return limit
+}
+
 // GetSyncLog return sync-log config option
 func (c *Config) GetSyncLog() bool {
 	if c.SyncLog == nil {
@@ -26,7 +26,10 @@ import (
 
 	fuzz "github.com/google/gofuzz"
 	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
 	pb "github.com/pingcap/tipb/go-binlog"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
 	"github.com/syndtr/goleveldb/leveldb"
 )
 
@@ -271,6 +274,91 @@ func (as *AppendSuit) testWriteBinlogAndPullBack(c *check.C, prewriteValueSize i
 	appendStorage.Close()
 }
 
+func (as *AppendSuit) TestWriteBinlogInBatch(c *check.C) {
+	payload, err := (&pb.Binlog{Tp: pb.BinlogType_Prewrite, StartTs: 1, PrewriteValue: []byte("value")}).Marshal()
+	c.Assert(err, check.IsNil)
+	// the batch is full once all the binlogs arrive, the long waiting time
+	// only makes sure they are not split by a timeout on a busy machine
+	options := DefaultOptions().WithWriteBatchWait(30 * time.Second).WithWriteBatchSize(10 * len(payload))
+	appendStorage := newAppendWithOptions(c, options)
+	defer cleanAppend(appendStorage)
+
+	batchCount := func() uint64 {
+		var metric io_prometheus_client.Metric
+		err := writeBinlogSizeHistogram.WithLabelValues("batch").(prometheus.Metric).Write(&metric)
+		c.Assert(err, check.IsNil)
+		return metric.GetHistogram().GetSampleCount()
+	}
+	before := batchCount()
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func(ts int64) {
+			defer wg.Done()
+			err := appendStorage.WriteBinlog(&pb.Binlog{Tp: pb.BinlogType_Prewrite, StartTs: ts, PrewriteValue: []byte("value")})
+			c.Assert(err, check.IsNil)
+		}(int64(i))
+	}
+	wg.Wait()
+
+	c.Assert(batchCount()-before, check.Equals, uint64(1))
+}
+
+func (as *AppendSuit) TestRateLimit(c *check.C) {
+	value := make([]byte, 1000)
+	options := DefaultOptions().WithWriteLimit(IOLimit{BytesPerSecond: 1000})
+	appendStorage := newAppendWithOptions(c, options)
+	defer cleanAppend(appendStorage)
+
+	// the writes beyond the burst of one second are throttled.
+	beginTime := time.Now()
+	for i := 1; i <= 3; i++ {
+		err := appendStorage.WriteBinlog(&pb.Binlog{Tp: pb.BinlogType_Prewrite, StartTs: int64(i), PrewriteValue: value})
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(time.Since(beginTime), check.Greater, 1500*time.Millisecond)
+
+	// the read waits with the length of the payload before reading it.
+	var vp []byte
+	var err error
+	for i := 0; i < 100; i++ {
+		if vp, err = appendStorage.metadata.Get(encodeTSKey(1), nil); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(err, check.IsNil)
+	var pointer valuePointer
+	c.Assert(pointer.UnmarshalBinary(vp), check.IsNil)
+	var waited int
+	_, err = appendStorage.vlog.readValueWait(pointer, func(n int) error {
+		waited = n
+		return errors.New("throttled")
+	})
+	c.Assert(err, check.ErrorMatches, ".*throttled.*")
+	c.Assert(waited, check.Greater, len(value))
+}
+
+func (as *AppendSuit) TestWriteBinlogAfterCommitted(c *check.C) {
+	appendStorage := newAppend(c)
+	defer cleanAppend(appendStorage)
+
+	err := appendStorage.WriteBinlog(&pb.Binlog{Tp: pb.BinlogType_Prewrite, StartTs: 10, PrewriteValue: []byte("value")})
+	c.Assert(err, check.IsNil)
+	err = appendStorage.WriteBinlog(&pb.Binlog{Tp: pb.BinlogType_Commit, StartTs: 10, CommitTs: 20})
+	c.Assert(err, check.IsNil)
+
+	// the commit ts written is checked before it's sorted.
+	err = appendStorage.WriteBinlogAfterCommitted(&pb.Binlog{Tp: pb.BinlogType_Prewrite, StartTs: 15, PrewriteValue: []byte("value")})
+	c.Assert(err, check.ErrorMatches, "start ts 15 is not larger than the commit ts 20 of the binlogs written")
+	_, err = appendStorage.metadata.Get(encodeTSKey(15), nil)
+	c.Assert(err, check.Equals, leveldb.ErrNotFound)
+
+	err = appendStorage.WriteBinlogAfterCommitted(&pb.Binlog{Tp: pb.BinlogType_Prewrite, StartTs: 21, PrewriteValue: []byte("value")})
+	c.Assert(err, check.IsNil)
+}
+
 func (as *AppendSuit) TestDoGCTS(c *check.C) {
 	var value = make([]byte, 10)
 	append := newAppend(c)
@@ -287,6 +375,7 @@ func (as *AppendSuit) TestDoGCTS(c *check.C) {
 
 	var gcTS int64 = 1024 * 300
 	append.doGCTS(gcTS)
+	c.Assert(append.GCStatus().DoneGCTS, check.Equals, gcTS)
 
 	for i = 1; i < n; i++ {
 		_, err := append.metadata.Get(encodeTSKey(i), nil)
@@ -464,7 +553,7 @@ func (as *AppendSuit) TestFeedPreWriteValue(c *check.C) {
 		DdlSchemaState: 5,
 	}
 
-	req := a.writeBinlog(expectPBinlog)
+	req := a.writeBinlog(expectPBinlog, false)
 	c.Assert(req.err, check.IsNil)
 
 	cBinlog := &pb.Binlog{
@@ -472,10 +561,10 @@ func (as *AppendSuit) TestFeedPreWriteValue(c *check.C) {
 		StartTs:  42,
 		CommitTs: 50,
 	}
-	req = a.writeBinlog(cBinlog)
+	req = a.writeBinlog(cBinlog, false)
 	c.Assert(req.err, check.IsNil)
 
-	err := a.feedPreWriteValue(cBinlog)
+	err := a.feedPreWriteValue(context.Background(), cBinlog)
 	c.Assert(err, check.IsNil)
 
 	c.Assert(cBinlog.StartTs, check.Equals, expectPBinlog.StartTs)
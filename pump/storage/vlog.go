@@ -47,6 +47,25 @@ type Options struct {
 	KVChanCapacity            int
 	SlowWriteThreshold        float64
 	StopWriteAtAvailableSpace uint64
+	// ReadCacheSize is the max total size of the recently appended binlogs
+	// kept in memory for reading, 0 means disabled.
+	ReadCacheSize int64
+	// WriteBatchWait is how long to wait for more binlogs to be written to the value
+	// log in one batch after the first one arrives, 0 means not to wait.
+	WriteBatchWait time.Duration
+	// WriteBatchSize is the max total size of the binlogs written in one batch when
+	// WriteBatchWait is set.
+	WriteBatchSize int
+	// WriteLimit and ReadLimit limit the disk IO of writing binlogs to the value
+	// log and reading them for the pulling requests.
+	WriteLimit IOLimit
+	ReadLimit  IOLimit
+	// Checksum is the checksum algorithm of the records in the new files.
+	Checksum ChecksumAlgorithm
+	// ScrubInterval is how often to verify the checksums of the records in the closed files,
+	// 0 means disabled. ScrubLimit limits the disk IO of it.
+	ScrubInterval time.Duration
+	ScrubLimit    IOLimit
 
 	KVConfig *KVConfig
 }
@@ -58,6 +77,7 @@ func DefaultOptions() *Options {
 		Sync:               true,
 		KVChanCapacity:     chanCapacity,
 		SlowWriteThreshold: slowWriteThreshold,
+		WriteBatchSize:     defaultWriteBatchSize,
 	}
 }
 
@@ -91,6 +111,49 @@ func (o *Options) WithKVChanCapacity(capacity int) *Options {
 	return o
 }
 
+// WithReadCacheSize set the ReadCacheSize
+func (o *Options) WithReadCacheSize(size int64) *Options {
+	o.ReadCacheSize = size
+	return o
+}
+
+// WithWriteBatchWait set the WriteBatchWait
+func (o *Options) WithWriteBatchWait(wait time.Duration) *Options {
+	o.WriteBatchWait = wait
+	return o
+}
+
+// WithWriteBatchSize set the WriteBatchSize
+func (o *Options) WithWriteBatchSize(size int) *Options {
+	o.WriteBatchSize = size
+	return o
+}
+
+// WithWriteLimit set the WriteLimit
+func (o *Options) WithWriteLimit(limit IOLimit) *Options {
+	o.WriteLimit = limit
+	return o
+}
+
+// WithReadLimit set the ReadLimit
+func (o *Options) WithReadLimit(limit IOLimit) *Options {
+	o.ReadLimit = limit
+	return o
+}
+
+// WithChecksum set the Checksum
+func (o *Options) WithChecksum(checksum ChecksumAlgorithm) *Options {
+	o.Checksum = checksum
+	return o
+}
+
+// WithScrub set the ScrubInterval and ScrubLimit
+func (o *Options) WithScrub(interval time.Duration, limit IOLimit) *Options {
+	o.ScrubInterval = interval
+	o.ScrubLimit = limit
+	return o
+}
+
 // WithSync set the Sync
 func (o *Options) WithSync(sync bool) *Options {
 	o.Sync = sync
@@ -101,6 +164,9 @@ type request struct {
 	startTS  int64
 	commitTS int64
 	tp       pb.BinlogType
+	// afterCommitted rejects the request unless its start ts is larger than the
+	// commit ts of all the binlogs written before.
+	afterCommitted bool
 
 	payload      []byte
 	valuePointer valuePointer
@@ -178,7 +244,8 @@ type valueLog struct {
 	gcLock    sync.Mutex
 	filesMap  map[uint32]*logFile
 
-	opt *Options
+	opt   *Options
+	stats *writeStats
 }
 
 func newValueLog(valueDir string, options *Options) (*valueLog, error) {
@@ -214,6 +281,7 @@ func (vlog *valueLog) open(path string, opt *Options) error {
 	vlog.opt = opt
 
 	vlog.buf = new(bytes.Buffer)
+	vlog.stats = newWriteStats()
 
 	vlog.filesMap = make(map[uint32]*logFile)
 	if err := vlog.openOrCreateFiles(); err != nil {
@@ -247,7 +315,7 @@ func (vlog *valueLog) openOrCreateFiles() error {
 		}
 		fid := uint32(fid64)
 
-		logFile, err := newLogFile(fid, vlog.filePath(fid))
+		logFile, err := newLogFile(fid, vlog.filePath(fid), vlog.opt.Checksum)
 		if err != nil {
 			return errors.Annotatef(err, "error open file %s", fName)
 		}
@@ -281,7 +349,7 @@ func (vlog *valueLog) openOrCreateFiles() error {
 
 func (vlog *valueLog) createLogFile(fid uint32) (*logFile, error) {
 	path := vlog.filePath(fid)
-	logFile, err := newLogFile(fid, path)
+	logFile, err := newLogFile(fid, path, vlog.opt.Checksum)
 	if err != nil {
 		return nil, errors.Annotate(err, "unable to create log file")
 	}
@@ -319,6 +387,11 @@ func (vlog *valueLog) close() error {
 }
 
 func (vlog *valueLog) readValue(vp valuePointer) ([]byte, error) {
+	return vlog.readValueWait(vp, nil)
+}
+
+// readValueWait is readValue calling wait with the length of the payload before reading it.
+func (vlog *valueLog) readValueWait(vp valuePointer, wait func(n int) error) ([]byte, error) {
 	logFile, err := vlog.getFileRLocked(vp.Fid)
 	if err != nil {
 		return nil, errors.Annotatef(err, "get file(id: %d) failed", vp.Fid)
@@ -326,7 +399,7 @@ func (vlog *valueLog) readValue(vp valuePointer) ([]byte, error) {
 
 	defer logFile.lock.RUnlock()
 
-	record, err := logFile.readRecord(vp.Offset)
+	record, err := logFile.readRecordWait(vp.Offset, wait)
 	if err != nil {
 		return nil, errors.Annotatef(err, "read record at %+v failed", vp)
 	}
@@ -359,11 +432,17 @@ func (vlog *valueLog) write(reqs []*request) error {
 
 	toDisk := func() error {
 		writeT0 := time.Now()
-		err := curFile.Write(vlog.buf.Bytes(), vlog.sync)
+		err := curFile.Write(vlog.buf.Bytes(), false)
+		if err == nil && vlog.sync {
+			var d time.Duration
+			d, err = curFile.sync()
+			vlog.stats.observeFsync(d)
+		}
 		writeBinlogTimeHistogram.WithLabelValues("to_disk").Observe(time.Since(writeT0).Seconds())
 		if err != nil {
 			return errors.Trace(err)
 		}
+		vlog.stats.addWritten(vlog.buf.Len())
 
 		for _, req := range bufReqs {
 			curFile.updateMaxTS(req.ts())
@@ -386,7 +465,7 @@ func (vlog *valueLog) write(reqs []*request) error {
 	for _, req := range reqs {
 		req.valuePointer.Fid = curFile.fid
 		req.valuePointer.Offset = curFile.GetWriteOffset() + int64(vlog.buf.Len())
-		_, err := encodeRecord(vlog.buf, req.payload)
+		_, err := encodeRecord(vlog.buf, req.payload, curFile.checksum)
 		if err != nil {
 			return errors.Trace(err)
 		}
@@ -476,6 +555,20 @@ func (vlog *valueLog) scan(start valuePointer, fn func(vp valuePointer, record *
 	return nil
 }
 
+// reclaimable returns the number and the size of the files gcTS would delete.
+func (vlog *valueLog) reclaimable(gcTS int64) (files int, size int64) {
+	vlog.filesLock.RLock()
+	defer vlog.filesLock.RUnlock()
+
+	for _, logFile := range vlog.filesMap {
+		if logFile.fid != vlog.maxFid && logFile.maxTS <= gcTS {
+			files++
+			size += logFile.GetWriteOffset()
+		}
+	}
+	return
+}
+
 // delete data <= gcTS
 func (vlog *valueLog) gcTS(gcTS int64) {
 	log.Info("GC vlog", zap.Int64("ts", gcTS))
@@ -192,6 +192,11 @@ func (vs *VlogSuit) TestGCTS(c *check.C) {
 	before := len(vlog.filesMap)
 	c.Logf("before log file num: %d", before)
 
+	pendingFiles, pendingBytes := vlog.reclaimable(90)
+	c.Assert(pendingFiles, check.Greater, 0)
+	c.Assert(pendingFiles, check.Less, before)
+	c.Assert(pendingBytes, check.Greater, int64(0))
+
 	vlog.gcLock.Lock()
 
 	gcDone := make(chan struct{})
@@ -210,6 +215,10 @@ func (vs *VlogSuit) TestGCTS(c *check.C) {
 	after = len(vlog.filesMap)
 	c.Logf("after log file num: %d", after)
 	c.Assert(after, check.Less, before, check.Commentf("no file is deleted"))
+	c.Assert(after, check.Equals, before-pendingFiles)
+	pendingFiles, pendingBytes = vlog.reclaimable(90)
+	c.Assert(pendingFiles, check.Equals, 0)
+	c.Assert(pendingBytes, check.Equals, int64(0))
 
 	// ts 0 has been gc
 	_, err = vlog.readValue(pointers[0])
@@ -0,0 +1,102 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// fsyncSamples is the number of the recent fsyncs to calculate the latency.
+const fsyncSamples = 1024
+
+// WriteStats is the recent write throughput and disk stats of the storage.
+type WriteStats struct {
+	// WriteBytesPerSecond is the bytes written to the value log per second
+	// since the last call of Stats.
+	WriteBytesPerSecond float64
+	// FsyncLatencyP99 is the p99 latency of the recent fsyncs.
+	FsyncLatencyP99 time.Duration
+	// DiskFreeBytes is the available space of the data dir.
+	DiskFreeBytes uint64
+}
+
+// writeStats records the bytes written and the latency of the fsyncs.
+type writeStats struct {
+	mu sync.Mutex
+
+	written     int64
+	lastWritten int64
+	lastTime    time.Time
+
+	// a ring of the latency of the recent fsyncs.
+	fsyncs    []time.Duration
+	nextFsync int
+}
+
+func newWriteStats() *writeStats {
+	return &writeStats{
+		lastTime: time.Now(),
+		fsyncs:   make([]time.Duration, 0, fsyncSamples),
+	}
+}
+
+func (s *writeStats) addWritten(n int) {
+	s.mu.Lock()
+	s.written += int64(n)
+	s.mu.Unlock()
+}
+
+func (s *writeStats) observeFsync(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.fsyncs) < fsyncSamples {
+		s.fsyncs = append(s.fsyncs, d)
+		return
+	}
+	s.fsyncs[s.nextFsync] = d
+	s.nextFsync = (s.nextFsync + 1) % fsyncSamples
+}
+
+// rate returns the bytes written per second since the last call.
+func (s *writeStats) rate(now time.Time) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rate float64
+	if elapsed := now.Sub(s.lastTime).Seconds(); elapsed > 0 {
+		rate = float64(s.written-s.lastWritten) / elapsed
+	}
+	s.lastWritten = s.written
+	s.lastTime = now
+	return rate
+}
+
+func (s *writeStats) fsyncLatencyP99() time.Duration {
+	s.mu.Lock()
+	sorted := append([]time.Duration(nil), s.fsyncs...)
+	s.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return 0
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(float64(len(sorted))*0.99+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
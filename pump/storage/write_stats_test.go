@@ -0,0 +1,69 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	"github.com/pingcap/check"
+)
+
+type writeStatsSuite struct{}
+
+var _ = check.Suite(&writeStatsSuite{})
+
+func (s *writeStatsSuite) TestRate(c *check.C) {
+	stats := newWriteStats()
+	start := stats.lastTime
+
+	stats.addWritten(1024)
+	stats.addWritten(1024)
+	c.Assert(stats.rate(start.Add(2*time.Second)), check.Equals, float64(1024))
+
+	// the rate is since the last call.
+	stats.addWritten(512)
+	c.Assert(stats.rate(start.Add(3*time.Second)), check.Equals, float64(512))
+	c.Assert(stats.rate(start.Add(4*time.Second)), check.Equals, float64(0))
+}
+
+func (s *writeStatsSuite) TestFsyncLatencyP99(c *check.C) {
+	stats := newWriteStats()
+	c.Assert(stats.fsyncLatencyP99(), check.Equals, time.Duration(0))
+
+	for i := 1; i <= 100; i++ {
+		stats.observeFsync(time.Duration(i) * time.Millisecond)
+	}
+	c.Assert(stats.fsyncLatencyP99(), check.Equals, 99*time.Millisecond)
+
+	// only the recent fsyncs are taken.
+	for i := 0; i < fsyncSamples; i++ {
+		stats.observeFsync(time.Millisecond)
+	}
+	c.Assert(stats.fsyncs, check.HasLen, fsyncSamples)
+	c.Assert(stats.fsyncLatencyP99(), check.Equals, time.Millisecond)
+}
+
+func (s *writeStatsSuite) TestVlogWriteStats(c *check.C) {
+	opt := DefaultOptions()
+	opt.Sync = true
+	vlog, err := newValueLog(c.MkDir(), opt)
+	c.Assert(err, check.IsNil)
+	defer vlog.close()
+
+	req := &request{startTS: 1, commitTS: 2, payload: make([]byte, 100)}
+	c.Assert(vlog.write([]*request{req}), check.IsNil)
+
+	c.Assert(vlog.stats.written > 100, check.IsTrue)
+	c.Assert(vlog.stats.fsyncs, check.HasLen, 1)
+}
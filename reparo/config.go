@@ -49,18 +49,33 @@ type Config struct {
 
 	DestType string           `toml:"dest-type" json:"dest-type"`
 	DestDB   *syncer.DBConfig `toml:"dest-db" json:"dest-db"`
+	// Print is how the binlogs are printed by dest-type "print".
+	Print syncer.PrintConfig `toml:"print" json:"print"`
 
 	DoTables []filter.TableName `toml:"replicate-do-table" json:"replicate-do-table"`
 	DoDBs    []string           `toml:"replicate-do-db" json:"replicate-do-db"`
 
 	IgnoreTables []filter.TableName `toml:"replicate-ignore-table" json:"replicate-ignore-table"`
 	IgnoreDBs    []string           `toml:"replicate-ignore-db" json:"replicate-ignore-db"`
+	// CaseSensitive matches the schema and table names of the filter rules case-sensitively.
+	CaseSensitive bool `toml:"case-sensitive" json:"case-sensitive"`
+	// Wildcard matches the names of the filter rules not starting with '~' as wildcards instead of regular expressions.
+	Wildcard bool `toml:"wildcard" json:"wildcard"`
+
+	// Where are the predicates on the rows like `orders.id BETWEEN 100 AND 200`,
+	// only the rows matching all the predicates of their tables are restored.
+	Where []string `toml:"where" json:"where"`
 
 	LogFile  string `toml:"log-file" json:"log-file"`
 	LogLevel string `toml:"log-level" json:"log-level"`
 
 	SafeMode bool `toml:"safe-mode" json:"safe-mode"`
 
+	// SchemaTarget is the schema snapshot the binlogs are applied up to, the remaining
+	// binlogs are written as SQL files to RemainingDir once the target database matches it.
+	SchemaTarget string `toml:"schema-target" json:"schema-target"`
+	RemainingDir string `toml:"remaining-dir" json:"remaining-dir"`
+
 	configFile   string
 	printVersion bool
 }
@@ -82,11 +97,17 @@ func NewConfig() *Config {
 	fs.IntVar(&c.TxnBatch, "txn-batch", 20, "number of binlog events in a transaction batch")
 	fs.IntVar(&c.WorkerCount, "c", 16, "parallel worker count")
 	fs.StringVar(&c.LogFile, "log-file", "", "log file path")
-	fs.StringVar(&c.DestType, "dest-type", "print", "dest type, values can be [print,mysql]")
+	fs.StringVar(&c.DestType, "dest-type", "print", "dest type, values can be [print,mysql,lightning]")
+	fs.StringVar(&c.Print.Mode, "print-mode", syncer.PrintModeEvent, "how dest-type print prints the binlogs, \"event\" prints every DDL and row event, \"summary\" prints the counts of the row events and DDLs of the tables in the time buckets")
+	fs.StringVar(&c.Print.Format, "print-format", syncer.PrintFormatText, "the output format of dest-type print, \"text\" or \"json\" for JSON lines")
+	fs.IntVar(&c.Print.Interval, "print-interval", 3600, "the seconds of a time bucket of the summary of dest-type print")
 	fs.StringVar(&c.LogLevel, "L", "info", "log level: debug, info, warn, error, fatal")
 	fs.StringVar(&c.configFile, "config", "", "[REQUIRED] path to configuration file")
 	fs.BoolVar(&c.printVersion, "V", false, "print reparo version info")
 	fs.BoolVar(&c.SafeMode, "safe-mode", false, "enable safe mode to make syncer reentrant")
+	fs.StringVar(&c.SchemaTarget, "schema-target", "", "schema dump directory or SQL file of the tables, the binlogs are applied until dest-db has the same tables and the remaining ones are written to remaining-dir")
+	fs.StringVar(&c.RemainingDir, "remaining-dir", "", "directory to write the binlogs after schema-target is reached as SQL files")
+	fs.Var((*wheresValue)(&c.Where), "where", "only restore the rows matching the predicate like \"orders.id BETWEEN 100 AND 200\", can be set multiple times")
 	return c
 }
 
@@ -119,7 +140,7 @@ func (c *Config) Parse(args []string) (err error) {
 	}
 
 	// the mysql configuration should be in the file.
-	if c.DestType == "mysql" && c.configFile == "" {
+	if (c.DestType == "mysql" || c.DestType == "lightning") && c.configFile == "" {
 		return errors.Errorf("please specify config file")
 	}
 
@@ -163,7 +184,11 @@ func (c *Config) Parse(args []string) (err error) {
 	return errors.Trace(c.validate())
 }
 
+// adjustDoDBAndTable lowercases the do rules unless they're matched case-sensitively.
 func (c *Config) adjustDoDBAndTable() {
+	if c.CaseSensitive {
+		return
+	}
 	for i := 0; i < len(c.DoTables); i++ {
 		c.DoTables[i].Table = strings.ToLower(c.DoTables[i].Table)
 		c.DoTables[i].Schema = strings.ToLower(c.DoTables[i].Schema)
@@ -173,23 +198,59 @@ func (c *Config) adjustDoDBAndTable() {
 	}
 }
 
+func (c *Config) filterOptions() []filter.Option {
+	return []filter.Option{filter.CaseSensitive(c.CaseSensitive), filter.Wildcard(c.Wildcard)}
+}
+
 func (c *Config) configFromFile(path string) error {
 	return util.StrictDecodeFile(path, "reparo", c)
 }
 
+func (c *Config) validateFilter() error {
+	opts := c.filterOptions()
+	if err := filter.ValidateDBs("replicate-do-db", c.DoDBs, opts...); err != nil {
+		return errors.Trace(err)
+	}
+	if err := filter.ValidateDBs("replicate-ignore-db", c.IgnoreDBs, opts...); err != nil {
+		return errors.Trace(err)
+	}
+	if err := filter.ValidateTables("replicate-do-table", c.DoTables, opts...); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(filter.ValidateTables("replicate-ignore-table", c.IgnoreTables, opts...))
+}
+
 func (c *Config) validate() error {
 	if c.Dir == "" {
 		return errors.New("data-dir is empty")
 	}
 
+	if err := c.validateFilter(); err != nil {
+		return errors.Trace(err)
+	}
+
+	if len(c.SchemaTarget) > 0 {
+		if c.DestType != "mysql" {
+			return errors.New("schema-target is only supported by dest-type mysql")
+		}
+		if len(c.RemainingDir) == 0 {
+			return errors.New("remaining-dir must be set with schema-target")
+		}
+	}
+
 	switch c.DestType {
 	case "mysql":
 		if c.DestDB == nil {
 			return errors.New("dest-db config must not be empty")
 		}
 		return nil
-	case "print":
+	case "lightning":
+		if c.DestDB == nil || c.DestDB.Lightning == nil {
+			return errors.New("dest-db and dest-db.lightning config must not be empty")
+		}
 		return nil
+	case "print":
+		return errors.Trace(c.Print.Validate())
 	case "memory":
 		return nil
 	default:
@@ -23,6 +23,7 @@ import (
 	"github.com/BurntSushi/toml"
 	"github.com/pingcap/check"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/reparo/syncer"
 )
 
 type testConfigSuite struct{}
@@ -73,6 +74,26 @@ func (s *testConfigSuite) TestAdjustDoDBAndTable(c *check.C) {
 	c.Assert(config.DoTables[0].Table, check.Equals, "table1")
 	c.Assert(config.DoDBs[0], check.Equals, "test1")
 	c.Assert(config.DoDBs[1], check.Equals, "test2")
+
+	// the rules matched case-sensitively are kept.
+	config.CaseSensitive = true
+	config.DoDBs = []string{"TEST1"}
+	config.adjustDoDBAndTable()
+	c.Assert(config.DoDBs[0], check.Equals, "TEST1")
+}
+
+func (s *testConfigSuite) TestValidateFilter(c *check.C) {
+	config := &Config{}
+	config.DoTables = []filter.TableName{{Schema: "TEST1", Table: "tablE*"}}
+	config.DoDBs = []string{"TEST1", "~^test2"}
+	c.Assert(config.validateFilter(), check.IsNil)
+
+	config.IgnoreTables = []filter.TableName{{Schema: "test1", Table: ""}}
+	c.Assert(config.validateFilter(), check.ErrorMatches, "empty table name in `replicate-ignore-table` config")
+
+	config.IgnoreTables = nil
+	config.IgnoreDBs = []string{"~(test"}
+	c.Assert(config.validateFilter(), check.ErrorMatches, "in `replicate-ignore-db` config: invalid pattern ~\\(test.*")
 }
 
 func (s *testConfigSuite) TestParseConfigFileWithInvalidArgs(c *check.C) {
@@ -122,3 +143,15 @@ func getTemplateConfigFilePath() string {
 
 	return path
 }
+
+func (s *testConfigSuite) TestValidateSchemaTarget(c *check.C) {
+	config := &Config{Dir: "data.drainer", DestType: "print", SchemaTarget: "schema"}
+	c.Assert(config.validate(), check.ErrorMatches, "schema-target is only supported by dest-type mysql")
+
+	config.DestType = "mysql"
+	config.DestDB = &syncer.DBConfig{}
+	c.Assert(config.validate(), check.ErrorMatches, "remaining-dir must be set with schema-target")
+
+	config.RemainingDir = "remaining"
+	c.Assert(config.validate(), check.IsNil)
+}
@@ -19,16 +19,51 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb-binlog/reparo/syncer"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
 )
 
-// Decode decodes binlog from protobuf content.
+const (
+	// formatPB is the format of the binlog files written by drainer with db-type file.
+	formatPB = "pb"
+	// formatSlaveBinlog is the format of the binlogs written by drainer with db-type kafka,
+	// like the files converted by binlogctl convert-binlog.
+	formatSlaveBinlog = "slave-binlog"
+)
+
+// Decode decodes binlog from protobuf content, the format of the binlog is detected.
 // return *pb.Binlog and how many bytes read from reader
 func Decode(r io.Reader) (*pb.Binlog, int64, error) {
+	return new(binlogDecoder).decode(r)
+}
+
+// binlogDecoder decodes the binlogs of a file to the ones in the pb files,
+// the format of the file is detected by the first binlog.
+type binlogDecoder struct {
+	format string
+}
+
+func (d *binlogDecoder) decode(r io.Reader) (*pb.Binlog, int64, error) {
 	payload, length, err := binlogfile.Decode(r)
 	if err != nil {
 		return nil, 0, errors.Trace(err)
 	}
 
+	if len(d.format) == 0 {
+		d.format = detectFormat(payload)
+	}
+	if d.format == formatSlaveBinlog {
+		slave := new(obinlog.Binlog)
+		if err = slave.Unmarshal(payload); err != nil {
+			return nil, 0, errors.Trace(err)
+		}
+		binlog, err := syncer.SlaveBinlogToPB(slave)
+		if err != nil {
+			return nil, 0, errors.Annotatef(err, "convert binlog with commit ts %d", slave.CommitTs)
+		}
+		return binlog, length, nil
+	}
+
 	binlog := &pb.Binlog{}
 	err = binlog.Unmarshal(payload)
 	if err != nil {
@@ -36,3 +71,24 @@ func Decode(r io.Reader) (*pb.Binlog, int64, error) {
 	}
 	return binlog, length, nil
 }
+
+// detectFormat returns the format the binlog can be decoded in, the DMLs in one format
+// can't be decoded in the other one.
+func detectFormat(payload []byte) string {
+	binlog := new(pb.Binlog)
+	if err := binlog.Unmarshal(payload); err != nil {
+		return formatSlaveBinlog
+	}
+	slave := new(obinlog.Binlog)
+	if err := slave.Unmarshal(payload); err != nil {
+		return formatPB
+	}
+	// the DDLs of kafka can be decoded as the ones of the pb files too, but their queries are
+	// messages led by the key of a field, which is less than 0x20 for the fields numbered less
+	// than 4, while the queries of the pb files are SQLs.
+	query := binlog.GetDdlQuery()
+	if binlog.Tp == pb.BinlogType_DDL && len(query) > 0 && query[0] < 0x20 && len(slave.GetDdlData().GetDdlQuery()) > 0 {
+		return formatSlaveBinlog
+	}
+	return formatPB
+}
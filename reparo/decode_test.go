@@ -16,9 +16,11 @@ package reparo
 import (
 	"bytes"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/pingcap/check"
 	"github.com/pingcap/tidb-binlog/pkg/binlogfile"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
 )
 
 type testDecodeSuite struct{}
@@ -42,3 +44,58 @@ func (s *testDecodeSuite) TestDecode(c *check.C) {
 	c.Assert(int(n), check.Equals, len(data))
 	c.Assert(decodeBinlog, check.DeepEquals, binlog)
 }
+
+func (s *testDecodeSuite) TestDecodeSlaveBinlog(c *check.C) {
+	ddl := &obinlog.Binlog{
+		Type:     obinlog.BinlogType_DDL,
+		CommitTs: 100,
+		DdlData: &obinlog.DDLData{
+			SchemaName: proto.String("test"),
+			TableName:  proto.String("t1"),
+			DdlQuery:   []byte("create table t1(a int)"),
+		},
+	}
+	dml := &obinlog.Binlog{
+		Type:     obinlog.BinlogType_DML,
+		CommitTs: 101,
+		DmlData: &obinlog.DMLData{Tables: []*obinlog.Table{{
+			SchemaName: proto.String("test"),
+			TableName:  proto.String("t1"),
+			ColumnInfo: []*obinlog.ColumnInfo{{Name: "a", MysqlType: "int"}},
+			Mutations: []*obinlog.TableMutation{{
+				Type: obinlog.MutationType_Insert.Enum(),
+				Row:  &obinlog.Row{Columns: []*obinlog.Column{{Int64Value: proto.Int64(1)}}},
+			}},
+		}}},
+	}
+
+	var data []byte
+	for _, binlog := range []*obinlog.Binlog{ddl, dml} {
+		payload, err := binlog.Marshal()
+		c.Assert(err, check.IsNil)
+		c.Assert(detectFormat(payload), check.Equals, formatSlaveBinlog)
+		data = append(data, binlogfile.Encode(payload)...)
+	}
+
+	// the format of the file is detected by the first binlog.
+	decoder := new(binlogDecoder)
+	reader := bytes.NewReader(data)
+	binlog, _, err := decoder.decode(reader)
+	c.Assert(err, check.IsNil)
+	c.Assert(decoder.format, check.Equals, formatSlaveBinlog)
+	c.Assert(binlog.Tp, check.Equals, pb.BinlogType_DDL)
+	c.Assert(binlog.CommitTs, check.Equals, int64(100))
+	c.Assert(string(binlog.DdlQuery), check.Equals, "use `test`; create table t1(a int);")
+
+	binlog, _, err = decoder.decode(reader)
+	c.Assert(err, check.IsNil)
+	c.Assert(binlog.Tp, check.Equals, pb.BinlogType_DML)
+	c.Assert(binlog.DmlData.Events, check.HasLen, 1)
+	c.Assert(binlog.DmlData.Events[0].GetTp(), check.Equals, pb.EventType_Insert)
+
+	// the DDL of the pb files is decoded as it is.
+	pbDDL := &pb.Binlog{Tp: pb.BinlogType_DDL, CommitTs: 100, DdlQuery: []byte("use `test`; create table t1(a int);")}
+	payload, err := pbDDL.Marshal()
+	c.Assert(err, check.IsNil)
+	c.Assert(detectFormat(payload), check.Equals, formatPB)
+}
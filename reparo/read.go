@@ -37,9 +37,10 @@ type dirPbReader struct {
 	startTS int64
 	endTS   int64
 
-	file   *os.File
-	reader *bufio.Reader
-	idx    int // index of next file to read in files
+	file    *os.File
+	reader  *bufio.Reader
+	decoder *binlogDecoder
+	idx     int // index of next file to read in files
 }
 
 var _ PbReader = &dirPbReader{}
@@ -98,6 +99,7 @@ func (r *dirPbReader) nextFile() (err error) {
 	}
 
 	r.reader = bufio.NewReader(r.file)
+	r.decoder = new(binlogDecoder)
 
 	r.idx++
 
@@ -110,7 +112,7 @@ func (r *dirPbReader) read() (binlog *pb.Binlog, err error) {
 	}
 
 	for {
-		binlog, _, err = Decode(r.reader)
+		binlog, _, err = r.decoder.decode(r.reader)
 		if err == nil {
 			if !isAcceptableBinlog(binlog, r.startTS, r.endTS) {
 				continue
@@ -120,7 +122,7 @@ func (r *dirPbReader) read() (binlog *pb.Binlog, err error) {
 		}
 
 		if errors.Cause(err) == io.EOF {
-			log.Info("read file end", zap.String("file", r.files[r.idx-1]))
+			log.Info("read file end", zap.String("file", r.files[r.idx-1]), zap.String("format", r.decoder.format))
 			err = r.nextFile()
 			if err != nil {
 				return nil, err
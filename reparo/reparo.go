@@ -19,6 +19,7 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-binlog/pkg/filter"
+	"github.com/pingcap/tidb-binlog/pkg/loader"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
 	"github.com/pingcap/tidb-binlog/reparo/syncer"
 	"github.com/pingcap/tidb/store/tikv/oracle"
@@ -30,25 +31,85 @@ type Reparo struct {
 	cfg    *Config
 	syncer syncer.Syncer
 
-	filter *filter.Filter
+	filter    *filter.Filter
+	rowFilter *rowFilter
+
+	// target is nil if schema-target isn't set.
+	target *schemaTarget
+	// remaining writes the binlogs after the schema target is reached.
+	remaining syncer.Syncer
+	reached   bool
 }
 
 // New creates a Reparo object.
 func New(cfg *Config) (*Reparo, error) {
 	log.Info("New Reparo", zap.Stringer("config", cfg))
 
-	syncer, err := syncer.New(cfg.DestType, cfg.DestDB, cfg.WorkerCount, cfg.TxnBatch, cfg.SafeMode)
+	var s syncer.Syncer
+	var err error
+	if cfg.DestType == "print" {
+		s, err = syncer.NewPrintSyncer(&cfg.Print)
+	} else {
+		s, err = syncer.New(cfg.DestType, cfg.DestDB, cfg.WorkerCount, cfg.TxnBatch, cfg.SafeMode)
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	filter, err := filter.NewFilter(cfg.IgnoreDBs, cfg.IgnoreTables, cfg.DoDBs, cfg.DoTables, cfg.filterOptions()...)
+	if err != nil {
+		s.Close()
+		return nil, errors.Trace(err)
+	}
+
+	rowFilter, err := newRowFilter(cfg.Where)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	filter := filter.NewFilter(cfg.IgnoreDBs, cfg.IgnoreTables, cfg.DoDBs, cfg.DoTables)
+	r := &Reparo{
+		cfg:       cfg,
+		syncer:    s,
+		filter:    filter,
+		rowFilter: rowFilter,
+	}
+	if len(cfg.SchemaTarget) > 0 {
+		if err = r.initSchemaTarget(); err != nil {
+			r.Close()
+			return nil, errors.Trace(err)
+		}
+	}
+	return r, nil
+}
+
+func (r *Reparo) initSchemaTarget() error {
+	tables, err := loadSchemaTarget(r.cfg.SchemaTarget)
+	if err != nil {
+		return errors.Annotatef(err, "load schema target %s failed", r.cfg.SchemaTarget)
+	}
+	dest := r.cfg.DestDB
+	db, err := loader.CreateDB(dest.User, dest.Password, dest.Host, dest.Port, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	r.target = &schemaTarget{db: db, tables: tables}
+
+	r.remaining, err = syncer.NewSQLFileSyncer(r.cfg.RemainingDir)
+	return errors.Trace(err)
+}
 
-	return &Reparo{
-		cfg:    cfg,
-		syncer: syncer,
-		filter: filter,
-	}, nil
+// checkSchemaTarget checks whether the schema target is reached after the binlogs before ts are executed.
+func (r *Reparo) checkSchemaTarget(ts int64) error {
+	matched, err := r.target.matched()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if matched {
+		r.reached = true
+		log.Info("schema target is reached, the remaining binlogs are written as SQL files",
+			zap.Int64("ts", ts), zap.String("remaining-dir", r.cfg.RemainingDir))
+	}
+	return nil
 }
 
 // Process runs the main procedure.
@@ -59,6 +120,12 @@ func (r *Reparo) Process() error {
 	}
 	defer pbReader.close()
 
+	if r.target != nil {
+		if err = r.checkSchemaTarget(r.cfg.StartTSO); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
 	for {
 		binlog, err := pbReader.read()
 		if err != nil {
@@ -69,7 +136,7 @@ func (r *Reparo) Process() error {
 			return errors.Trace(err)
 		}
 
-		ignore, err := filterBinlog(r.filter, binlog)
+		ignore, err := filterBinlog(r.filter, r.rowFilter, binlog)
 		if err != nil {
 			return errors.Annotate(err, "filter binlog failed")
 		}
@@ -78,10 +145,21 @@ func (r *Reparo) Process() error {
 			continue
 		}
 
-		err = r.syncer.Sync(binlog, func(binlog *pb.Binlog) {
+		cb := func(binlog *pb.Binlog) {
 			dt := oracle.GetTimeFromTS(uint64(binlog.CommitTs))
 			log.Info("sync binlog success", zap.Int64("ts", binlog.CommitTs), zap.Time("datetime", dt))
-		})
+		}
+		switch {
+		case r.reached:
+			err = r.remaining.Sync(binlog, cb)
+		case r.target != nil && binlog.Tp == pb.BinlogType_DDL:
+			// the schema only changes by DDL, check it once the DDL is executed.
+			if err = syncer.SyncAndWait(r.syncer, binlog, cb); err == nil {
+				err = r.checkSchemaTarget(binlog.CommitTs)
+			}
+		default:
+			err = r.syncer.Sync(binlog, cb)
+		}
 
 		if err != nil {
 			return errors.Annotate(err, "sync failed")
@@ -91,12 +169,21 @@ func (r *Reparo) Process() error {
 
 // Close closes the Reparo object.
 func (r *Reparo) Close() error {
-	return errors.Trace(r.syncer.Close())
+	err := r.syncer.Close()
+	if r.remaining != nil {
+		if rerr := r.remaining.Close(); err == nil {
+			err = rerr
+		}
+	}
+	if r.target != nil {
+		r.target.db.Close()
+	}
+	return errors.Trace(err)
 }
 
 // may drop some DML event of binlog
 // return true if the whole binlog should be ignored
-func filterBinlog(afilter *filter.Filter, binlog *pb.Binlog) (ignore bool, err error) {
+func filterBinlog(afilter *filter.Filter, rowFilter *rowFilter, binlog *pb.Binlog) (ignore bool, err error) {
 	switch binlog.Tp {
 	case pb.BinlogType_DDL:
 		var table filter.TableName
@@ -117,6 +204,14 @@ func filterBinlog(afilter *filter.Filter, binlog *pb.Binlog) (ignore bool, err e
 				continue
 			}
 
+			skip, err := rowFilter.skipEvent(&event)
+			if err != nil {
+				return false, errors.Annotatef(err, "filter the row of %s.%s failed", event.GetSchemaName(), event.GetTableName())
+			}
+			if skip {
+				continue
+			}
+
 			events = append(events, event)
 		}
 
@@ -92,7 +92,8 @@ func (s *testReparoSuite) TestIsAcceptableBinlog(c *C) {
 
 func (s *testReparoSuite) TestFilterBinlog(c *C) {
 	// just check the ddl binlog and dml with db name "ignore_db" will be filtered
-	afilter := filter.NewFilter([]string{"ignore_db"}, nil, nil, nil)
+	afilter, err := filter.NewFilter([]string{"ignore_db"}, nil, nil, nil)
+	c.Assert(err, IsNil)
 
 	ddlBinlogs := map[*pb.Binlog]bool{
 		{
@@ -106,7 +107,7 @@ func (s *testReparoSuite) TestFilterBinlog(c *C) {
 	}
 
 	for binlog, ignore := range ddlBinlogs {
-		getIgnore, err := filterBinlog(afilter, binlog)
+		getIgnore, err := filterBinlog(afilter, &rowFilter{}, binlog)
 		c.Assert(err, IsNil)
 		c.Assert(getIgnore, Equals, ignore)
 	}
@@ -135,7 +136,7 @@ func (s *testReparoSuite) TestFilterBinlog(c *C) {
 	}
 
 	for binlog, ignore := range dmlBinlogs {
-		getIgnore, err := filterBinlog(afilter, binlog)
+		getIgnore, err := filterBinlog(afilter, &rowFilter{}, binlog)
 		c.Assert(err, IsNil)
 		c.Assert(getIgnore, Equals, ignore)
 
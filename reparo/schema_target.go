@@ -0,0 +1,175 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	tmysql "github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/types"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"go.uber.org/zap"
+)
+
+// schemaTarget is the schema snapshot the binlogs are applied up to, reparo applies the
+// binlogs until the tables in the snapshot exist in the target database with the same
+// schemas, and then writes the remaining binlogs as SQL files for manual review.
+// The tables are compared by the names and the types without length of the columns, and
+// the names and the columns of the indexes.
+type schemaTarget struct {
+	db *sql.DB
+	// tables are the descriptions of the tables in the snapshot.
+	tables map[filter.TableName]string
+}
+
+// loadSchemaTarget loads the schema snapshot in path, which is a schema dump directory of
+// mydumper or dumpling, whose files of the tables are named like "db.table-schema.sql", or
+// a SQL file of CREATE TABLE statements qualified by the database names or following USE.
+func loadSchemaTarget(path string) (map[filter.TableName]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	tables := make(map[filter.TableName]string)
+	if info.IsDir() {
+		files, err := filepath.Glob(filepath.Join(path, "*-schema.sql"))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for _, file := range files {
+			name := filepath.Base(file)
+			dot := strings.Index(name, ".")
+			if dot < 0 {
+				continue
+			}
+			if err = parseSchemaFile(file, name[:dot], tables); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+	} else if err = parseSchemaFile(path, "", tables); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(tables) == 0 {
+		return nil, errors.Errorf("no table schema found in %s", path)
+	}
+	return tables, nil
+}
+
+func parseSchemaFile(path string, schema string, tables map[filter.TableName]string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	stmts, _, err := parser.New().Parse(string(data), "", "")
+	if err != nil {
+		return errors.Annotatef(err, "parse %s failed", path)
+	}
+	for _, stmt := range stmts {
+		switch node := stmt.(type) {
+		case *ast.UseStmt:
+			schema = node.DBName
+		case *ast.CreateTableStmt:
+			table := filter.TableName{Schema: node.Table.Schema.O, Table: node.Table.Name.O}
+			if len(table.Schema) == 0 {
+				table.Schema = schema
+			}
+			if len(table.Schema) == 0 {
+				return errors.Errorf("the database of table %s in %s is unknown", table.Table, path)
+			}
+			tables[lowerTableName(table)] = describeTable(node)
+		}
+	}
+	return nil
+}
+
+func lowerTableName(table filter.TableName) filter.TableName {
+	return filter.TableName{Schema: strings.ToLower(table.Schema), Table: strings.ToLower(table.Table)}
+}
+
+// describeTable returns the description of the table compared with the target database.
+func describeTable(stmt *ast.CreateTableStmt) string {
+	var indexes []string
+	var b strings.Builder
+	for _, col := range stmt.Cols {
+		name := strings.ToLower(col.Name.Name.O)
+		fmt.Fprintf(&b, "%s %s,", name, types.TypeToStr(col.Tp.Tp, col.Tp.Charset))
+		for _, opt := range col.Options {
+			switch opt.Tp {
+			case ast.ColumnOptionPrimaryKey:
+				indexes = append(indexes, "primary("+name+")")
+			case ast.ColumnOptionUniqKey:
+				indexes = append(indexes, name+"("+name+")")
+			}
+		}
+	}
+	for _, constraint := range stmt.Constraints {
+		var name string
+		switch constraint.Tp {
+		case ast.ConstraintPrimaryKey:
+			name = "primary"
+		case ast.ConstraintKey, ast.ConstraintIndex, ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+			name = strings.ToLower(constraint.Name)
+		default:
+			continue
+		}
+		var cols []string
+		for _, key := range constraint.Keys {
+			if key.Column != nil {
+				cols = append(cols, strings.ToLower(key.Column.Name.O))
+			}
+		}
+		indexes = append(indexes, name+"("+strings.Join(cols, ",")+")")
+	}
+	sort.Strings(indexes)
+	b.WriteString(strings.Join(indexes, ","))
+	return b.String()
+}
+
+// matched returns whether the tables in the snapshot exist in the target database with the same schemas.
+func (t *schemaTarget) matched() (bool, error) {
+	for table, desc := range t.tables {
+		var name, createTable string
+		err := t.db.QueryRow("SHOW CREATE TABLE "+pkgsql.QuoteSchema(table.Schema, table.Table)).Scan(&name, &createTable)
+		if err != nil {
+			if code, ok := pkgsql.GetSQLErrCode(err); ok && (code == tmysql.ErrNoSuchTable || code == tmysql.ErrBadDB) {
+				log.Debug("table in schema target doesn't exist", zap.String("schema", table.Schema), zap.String("table", table.Table))
+				return false, nil
+			}
+			return false, errors.Annotatef(err, "show create table %s.%s failed", table.Schema, table.Table)
+		}
+
+		stmt, err := parser.New().ParseOneStmt(createTable, "", "")
+		if err != nil {
+			return false, errors.Annotatef(err, "parse the schema of %s.%s failed", table.Schema, table.Table)
+		}
+		create, ok := stmt.(*ast.CreateTableStmt)
+		if !ok || describeTable(create) != desc {
+			log.Debug("table in schema target is different", zap.String("schema", table.Schema), zap.String("table", table.Table))
+			return false, nil
+		}
+	}
+	return true, nil
+}
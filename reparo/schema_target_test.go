@@ -0,0 +1,88 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+)
+
+type testSchemaTargetSuite struct{}
+
+var _ = Suite(&testSchemaTargetSuite{})
+
+func (s *testSchemaTargetSuite) TestLoadSchemaTarget(c *C) {
+	dir := c.MkDir()
+	files := map[string]string{
+		"shop-schema-create.sql": "CREATE DATABASE `shop`;",
+		"shop.orders-schema.sql": "/*!40101 SET NAMES binary*/;\nCREATE TABLE `orders` (`id` int(11) NOT NULL, `note` varchar(20), PRIMARY KEY (`id`));",
+		"shop.orders.000000.sql": "INSERT INTO `orders` VALUES (1, 'a');",
+	}
+	for name, data := range files {
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644), IsNil)
+	}
+	tables, err := loadSchemaTarget(dir)
+	c.Assert(err, IsNil)
+	c.Assert(tables, DeepEquals, map[filter.TableName]string{
+		{Schema: "shop", Table: "orders"}: "id int,note varchar,primary(id)",
+	})
+
+	file := filepath.Join(c.MkDir(), "schema.sql")
+	data := "USE shop; CREATE TABLE Users (id bigint PRIMARY KEY, name text, UNIQUE KEY uk_name (name(10)));\nCREATE TABLE crm.leads (id int);"
+	c.Assert(ioutil.WriteFile(file, []byte(data), 0644), IsNil)
+	tables, err = loadSchemaTarget(file)
+	c.Assert(err, IsNil)
+	c.Assert(tables, DeepEquals, map[filter.TableName]string{
+		{Schema: "shop", Table: "users"}: "id bigint,name text,primary(id),uk_name(name)",
+		{Schema: "crm", Table: "leads"}:  "id int,",
+	})
+
+	_, err = loadSchemaTarget(c.MkDir())
+	c.Assert(err, ErrorMatches, "no table schema found in .*")
+}
+
+func (s *testSchemaTargetSuite) TestMatched(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	target := &schemaTarget{db: db, tables: map[filter.TableName]string{
+		{Schema: "shop", Table: "orders"}: "id int,note varchar,primary(id)",
+	}}
+	showCreate := "SHOW CREATE TABLE `shop`.`orders`"
+
+	mock.ExpectQuery(showCreate).WillReturnError(&mysql.MySQLError{Number: 1146, Message: "Table 'shop.orders' doesn't exist"})
+	matched, err := target.matched()
+	c.Assert(err, IsNil)
+	c.Assert(matched, IsFalse)
+
+	// the column note isn't added yet.
+	mock.ExpectQuery(showCreate).WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).
+		AddRow("orders", "CREATE TABLE `orders` (`id` int(11) NOT NULL, PRIMARY KEY (`id`)) ENGINE=InnoDB"))
+	matched, err = target.matched()
+	c.Assert(err, IsNil)
+	c.Assert(matched, IsFalse)
+
+	mock.ExpectQuery(showCreate).WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).
+		AddRow("orders", "CREATE TABLE `orders` (\n  `id` int(11) NOT NULL,\n  `note` varchar(64) DEFAULT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"))
+	matched, err = target.matched()
+	c.Assert(err, IsNil)
+	c.Assert(matched, IsTrue)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,466 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncer
+
+// import the inserted rows into tidb by the importer backend of lightning
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/br/pkg/lightning/backend"
+	"github.com/pingcap/br/pkg/lightning/backend/importer"
+	"github.com/pingcap/br/pkg/lightning/backend/kv"
+	"github.com/pingcap/br/pkg/lightning/common"
+	lightninglog "github.com/pingcap/br/pkg/lightning/log"
+	"github.com/pingcap/br/pkg/lightning/verification"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb-binlog/pkg/security"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	"github.com/pingcap/tidb-binlog/pkg/util"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb/meta/autoid"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/pingcap/tidb/table/tables"
+	"github.com/pingcap/tidb/types"
+	"go.uber.org/zap"
+)
+
+const defaultLightningBatchRows = 1024
+
+// LightningConfig is the configuration of the lightning syncer.
+type LightningConfig struct {
+	// ImporterAddr is the address of tikv-importer.
+	ImporterAddr string `toml:"importer-addr" json:"importer-addr"`
+	// PDAddr is the address of PD of the target cluster.
+	PDAddr string `toml:"pd-addr" json:"pd-addr"`
+	// TiDBStatusAddr is the status address of the target TiDB to fetch the table infos.
+	TiDBStatusAddr string `toml:"tidb-status-addr" json:"tidb-status-addr"`
+	// BatchRows is the number of the encoded rows of a table written to tikv-importer at a time.
+	BatchRows int `toml:"batch-rows" json:"batch-rows"`
+}
+
+// lightningTable is the state of a table restored by the lightning syncer.
+type lightningTable struct {
+	schema string
+	name   string
+	id     int64
+	// bySQL is true if the rows are restored by SQL, the table is restored by SQL if
+	// it isn't empty when it's met the first time or a row is updated or deleted.
+	bySQL bool
+
+	info    *model.TableInfo
+	allocs  autoid.Allocators
+	encoder kv.Encoder
+	// rowID is the last row id allocated for the tables without an integer primary key.
+	rowID int64
+
+	engineID  int32
+	engine    *backend.OpenedEngine
+	writer    *backend.LocalEngineWriter
+	dataRows  kv.Rows
+	indexRows kv.Rows
+	rows      int
+	// checksum is the checksum of the KV pairs imported.
+	checksum verification.KVChecksum
+}
+
+func (t *lightningTable) quoted() string {
+	return pkgsql.QuoteSchema(t.schema, t.name)
+}
+
+// lightningSyncer encodes the inserted rows to KV pairs and imports them by tikv-importer,
+// which is much faster than executing SQL for restoring a lot of data to empty tables.
+// The rows of the tables not empty or with updates and deletes are restored by SQL.
+type lightningSyncer struct {
+	ctx       context.Context
+	db        *sql.DB
+	sql       *mysqlSyncer
+	backend   backend.Backend
+	batchRows int
+
+	getTS       func(ctx context.Context) (uint64, error)
+	fetchTables func(ctx context.Context, schema string) ([]*model.TableInfo, error)
+	closePD     func()
+
+	// schemas caches the table infos of the schemas by the lower case table names.
+	schemas map[string]map[string]*model.TableInfo
+	tables  map[string]*lightningTable
+	// pending are the binlogs written to the engines but not imported yet.
+	pending []*item
+}
+
+var _ Syncer = &lightningSyncer{}
+
+func newLightningSyncer(cfg *DBConfig, worker int, batchSize int, safemode bool) (*lightningSyncer, error) {
+	lcfg := cfg.Lightning
+	if lcfg == nil || lcfg.ImporterAddr == "" || lcfg.PDAddr == "" || lcfg.TiDBStatusAddr == "" {
+		return nil, errors.New("importer-addr, pd-addr and tidb-status-addr of dest-db.lightning must be set")
+	}
+
+	db, err := createDB(cfg.User, cfg.Password, cfg.Host, cfg.Port, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	sqlSyncer, err := newMysqlSyncerFromSQLDB(db, worker, batchSize, safemode)
+	if err != nil {
+		db.Close()
+		return nil, errors.Trace(err)
+	}
+
+	ctx := context.Background()
+	tls, err := common.NewTLS("", "", "", lcfg.TiDBStatusAddr)
+	if err != nil {
+		sqlSyncer.Close()
+		return nil, errors.Trace(err)
+	}
+	be, err := importer.NewImporter(ctx, tls, lcfg.ImporterAddr, lcfg.PDAddr)
+	if err != nil {
+		sqlSyncer.Close()
+		return nil, errors.Annotate(err, "connect to tikv-importer")
+	}
+	pdCli, err := util.GetPdClient(lcfg.PDAddr, security.Config{})
+	if err != nil {
+		be.Close()
+		sqlSyncer.Close()
+		return nil, errors.Trace(err)
+	}
+
+	s := newLightningSyncerFromBackend(db, sqlSyncer, be, lcfg.BatchRows)
+	s.getTS = func(ctx context.Context) (uint64, error) {
+		physical, logical, err := pdCli.GetTS(ctx)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		return oracle.ComposeTS(physical, logical), nil
+	}
+	s.closePD = pdCli.Close
+	return s, nil
+}
+
+func newLightningSyncerFromBackend(db *sql.DB, sqlSyncer *mysqlSyncer, be backend.Backend, batchRows int) *lightningSyncer {
+	if batchRows <= 0 {
+		batchRows = defaultLightningBatchRows
+	}
+	return &lightningSyncer{
+		ctx:         context.Background(),
+		db:          db,
+		sql:         sqlSyncer,
+		backend:     be,
+		batchRows:   batchRows,
+		fetchTables: be.FetchRemoteTableModels,
+		closePD:     func() {},
+		schemas:     make(map[string]map[string]*model.TableInfo),
+		tables:      make(map[string]*lightningTable),
+	}
+}
+
+// Sync implements Syncer interface.
+func (s *lightningSyncer) Sync(pbBinlog *pb.Binlog, cb func(binlog *pb.Binlog)) error {
+	if pbBinlog.Tp == pb.BinlogType_DDL {
+		return errors.Trace(s.syncDDL(pbBinlog, cb))
+	}
+
+	var sqlEvents []pb.Event
+	for _, event := range pbBinlog.GetDmlData().GetEvents() {
+		t, err := s.table(event.GetSchemaName(), event.GetTableName())
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if !t.bySQL && event.GetTp() != pb.EventType_Insert {
+			// the rows imported may be changed, so they must be in tidb before executing SQL,
+			// all the engines are imported to notify the binlogs in order.
+			if err = s.importAll(); err != nil {
+				return errors.Trace(err)
+			}
+			t.bySQL = true
+			log.Info("restore table by SQL for the rows changed", zap.String("table", t.quoted()))
+		}
+		if t.bySQL {
+			sqlEvents = append(sqlEvents, event)
+			continue
+		}
+		if err = s.encode(t, &event); err != nil {
+			return errors.Annotatef(err, "encode row of %s", t.quoted())
+		}
+	}
+
+	if len(sqlEvents) == 0 {
+		s.pending = append(s.pending, &item{binlog: pbBinlog, cb: cb})
+		return nil
+	}
+	sqlBinlog := *pbBinlog
+	sqlBinlog.DmlData = &pb.DMLData{Events: sqlEvents}
+	return errors.Trace(s.sql.Sync(&sqlBinlog, func(*pb.Binlog) { cb(pbBinlog) }))
+}
+
+// syncDDL imports all the engines and executes the DDL by SQL, the table infos are fetched again after it.
+func (s *lightningSyncer) syncDDL(pbBinlog *pb.Binlog, cb func(binlog *pb.Binlog)) error {
+	if err := s.importAll(); err != nil {
+		return errors.Trace(err)
+	}
+
+	done := make(chan struct{})
+	err := s.sql.Sync(pbBinlog, func(binlog *pb.Binlog) {
+		cb(binlog)
+		close(done)
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	select {
+	case <-done:
+	case <-s.sql.loaderQuit:
+		return errors.Annotate(s.sql.loaderErr, "execute DDL failed")
+	}
+
+	schema, _, err := parserSchemaTableFromDDL(string(pbBinlog.GetDdlQuery()))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	delete(s.schemas, strings.ToLower(schema))
+	for _, t := range s.tables {
+		if strings.EqualFold(t.schema, schema) {
+			t.info = nil
+		}
+	}
+	return nil
+}
+
+// table returns the state of the table with its latest table info.
+func (s *lightningSyncer) table(schema string, name string) (*lightningTable, error) {
+	key := pkgsql.QuoteSchema(schema, name)
+	t, ok := s.tables[key]
+	if ok && t.info != nil {
+		return t, nil
+	}
+
+	info, err := s.tableInfo(schema, name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// a table recreated by the DDLs like TRUNCATE TABLE is restored like a new one.
+	if !ok || info.ID != t.id {
+		t = &lightningTable{schema: schema, name: name, id: info.ID}
+		if t.bySQL, err = s.hasRows(t); err != nil {
+			return nil, errors.Trace(err)
+		}
+		s.tables[key] = t
+		log.Info("restore table", zap.String("table", t.quoted()), zap.Bool("by SQL", t.bySQL))
+	}
+	t.info = info
+	if t.encoder != nil {
+		t.encoder.Close()
+		t.encoder = nil
+	}
+	return t, nil
+}
+
+func (s *lightningSyncer) tableInfo(schema string, name string) (*model.TableInfo, error) {
+	infos, ok := s.schemas[strings.ToLower(schema)]
+	if !ok {
+		tableInfos, err := s.fetchTables(s.ctx, schema)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		infos = make(map[string]*model.TableInfo, len(tableInfos))
+		for _, info := range tableInfos {
+			infos[info.Name.L] = info
+		}
+		s.schemas[strings.ToLower(schema)] = infos
+	}
+	info, ok := infos[strings.ToLower(name)]
+	if !ok {
+		return nil, errors.NotFoundf("table %s.%s", schema, name)
+	}
+	return info, nil
+}
+
+func (s *lightningSyncer) hasRows(t *lightningTable) (bool, error) {
+	rows, err := s.db.Query(fmt.Sprintf("SELECT 1 FROM %s LIMIT 1", t.quoted()))
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	defer rows.Close()
+	return rows.Next(), errors.Trace(rows.Err())
+}
+
+// encode encodes the inserted row and writes the KV pairs to the engine of the table.
+func (s *lightningSyncer) encode(t *lightningTable, event *pb.Event) error {
+	if t.engine == nil {
+		if err := s.openEngine(t); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if t.encoder == nil {
+		if err := s.newEncoder(t); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	names, args, err := genColsAndArgs(event.GetRow())
+	if err != nil {
+		return errors.Trace(err)
+	}
+	row := make([]types.Datum, 0, len(args))
+	offsets := make(map[string]int, len(names))
+	for i, arg := range args {
+		row = append(row, types.NewDatum(arg))
+		offsets[strings.ToLower(names[i])] = i
+	}
+	// the extra handle of the tables without an integer primary key is allocated by rowID.
+	permutation := make([]int, 0, len(t.info.Columns)+1)
+	for _, col := range t.info.Columns {
+		offset, ok := offsets[col.Name.L]
+		if !ok {
+			offset = -1
+		}
+		permutation = append(permutation, offset)
+	}
+	permutation = append(permutation, -1)
+
+	t.rowID++
+	kvs, err := t.encoder.Encode(lightninglog.L(), row, t.rowID, permutation)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	kvs.ClassifyAndAppend(&t.dataRows, &t.checksum, &t.indexRows, &t.checksum)
+	t.rows++
+	if t.rows >= s.batchRows {
+		return errors.Trace(s.writeRows(t))
+	}
+	return nil
+}
+
+func (s *lightningSyncer) newEncoder(t *lightningTable) error {
+	if t.allocs == nil {
+		t.allocs = kv.NewPanickingAllocators(0)
+	}
+	tbl, err := tables.TableFromMeta(t.allocs, t.info)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	t.encoder, err = s.backend.NewEncoder(tbl, &kv.SessionOptions{SQLMode: mysql.ModeStrictAllTables})
+	return errors.Trace(err)
+}
+
+func (s *lightningSyncer) openEngine(t *lightningTable) error {
+	ts, err := s.getTS(s.ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	t.engineID++
+	t.engine, err = s.backend.OpenEngine(s.ctx, common.UniqueTable(t.schema, t.name), t.engineID, ts)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	t.writer, err = t.engine.LocalWriter(s.ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	t.dataRows = s.backend.MakeEmptyRows()
+	t.indexRows = s.backend.MakeEmptyRows()
+	return nil
+}
+
+func (s *lightningSyncer) writeRows(t *lightningTable) error {
+	if t.rows == 0 {
+		return nil
+	}
+	if err := t.writer.WriteRows(s.ctx, nil, t.dataRows); err != nil {
+		return errors.Trace(err)
+	}
+	if err := t.writer.WriteRows(s.ctx, nil, t.indexRows); err != nil {
+		return errors.Trace(err)
+	}
+	t.dataRows = s.backend.MakeEmptyRows()
+	t.indexRows = s.backend.MakeEmptyRows()
+	t.rows = 0
+	return nil
+}
+
+// importTable imports the engine of the table and rebases the auto ids of the table
+// after the ones used by the imported rows.
+func (s *lightningSyncer) importTable(t *lightningTable) error {
+	if t.engine == nil {
+		return nil
+	}
+	if err := s.writeRows(t); err != nil {
+		return errors.Trace(err)
+	}
+	if err := t.writer.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	closed, err := t.engine.Close(s.ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = closed.Import(s.ctx); err != nil {
+		return errors.Annotatef(err, "import %s", t.quoted())
+	}
+	if err = closed.Cleanup(s.ctx); err != nil {
+		log.Warn("clean up engine failed", zap.String("table", t.quoted()), zap.Error(err))
+	}
+	t.engine = nil
+	t.writer = nil
+
+	base := t.rowID
+	if t.allocs != nil {
+		if allocBase := t.allocs.Get(autoid.RowIDAllocType).Base(); allocBase > base {
+			base = allocBase
+		}
+	}
+	_, err = s.db.Exec(fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT=%d", t.quoted(), base+1))
+	if err != nil {
+		return errors.Annotatef(err, "rebase auto id of %s", t.quoted())
+	}
+	log.Info("import table", zap.String("table", t.quoted()), zap.Int32("engine", t.engineID), zap.Int64("auto id", base),
+		zap.Uint64("kvs", t.checksum.SumKVS()), zap.Uint64("size", t.checksum.SumSize()), zap.Uint64("checksum", t.checksum.Sum()))
+	return nil
+}
+
+// importAll imports the engines of all the tables and notifies the binlogs imported.
+func (s *lightningSyncer) importAll() error {
+	for _, t := range s.tables {
+		if err := s.importTable(t); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for _, item := range s.pending {
+		item.cb(item.binlog)
+	}
+	s.pending = nil
+	return nil
+}
+
+// Close implements Syncer interface.
+func (s *lightningSyncer) Close() error {
+	err := s.importAll()
+	for _, t := range s.tables {
+		if t.encoder != nil {
+			t.encoder.Close()
+		}
+	}
+	if serr := s.sql.Close(); err == nil {
+		err = serr
+	}
+	s.backend.Close()
+	s.closePD()
+	return errors.Trace(err)
+}
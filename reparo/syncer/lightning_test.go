@@ -0,0 +1,121 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncer
+
+import (
+	"context"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/br/pkg/lightning/backend/noop"
+	"github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb/types"
+)
+
+type testLightningSuite struct{}
+
+var _ = check.Suite(&testLightningSuite{})
+
+func testTableInfo() *model.TableInfo {
+	info := &model.TableInfo{ID: 1, Name: model.NewCIStr("t1"), State: model.StatePublic}
+	tps := []byte{mysql.TypeLong, mysql.TypeVarchar, mysql.TypeVarchar}
+	for i, name := range []string{"a", "b", "c"} {
+		info.Columns = append(info.Columns, &model.ColumnInfo{
+			ID:        int64(i + 1),
+			Name:      model.NewCIStr(name),
+			Offset:    i,
+			State:     model.StatePublic,
+			FieldType: *types.NewFieldType(tps[i]),
+		})
+	}
+	return info
+}
+
+func (s *testLightningSuite) TestImportThenSQL(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	sqlSyncer, err := newMysqlSyncerFromSQLDB(db, 1, 20, false)
+	c.Assert(err, check.IsNil)
+
+	syncer := newLightningSyncerFromBackend(db, sqlSyncer, noop.NewNoopBackend(), 2)
+	syncer.getTS = func(context.Context) (uint64, error) { return 1, nil }
+	syncer.fetchTables = func(context.Context, string) ([]*model.TableInfo, error) {
+		return []*model.TableInfo{testTableInfo()}, nil
+	}
+
+	schema, table := "test", "t1"
+	cols := generateColumns(c)
+	insert := &pb.Binlog{Tp: pb.BinlogType_DML, DmlData: &pb.DMLData{Events: []pb.Event{
+		{Tp: pb.EventType_Insert, SchemaName: &schema, TableName: &table, Row: [][]byte{cols[0], cols[1], cols[2]}},
+	}}}
+	update := &pb.Binlog{Tp: pb.BinlogType_DML, DmlData: &pb.DMLData{Events: []pb.Event{
+		{Tp: pb.EventType_Update, SchemaName: &schema, TableName: &table, Row: [][]byte{cols[0], cols[1], cols[2]}},
+	}}}
+
+	// the table is empty, so the inserted rows are imported.
+	mock.ExpectQuery("SELECT 1 FROM `test`.`t1` LIMIT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}))
+
+	var synced []*pb.Binlog
+	cb := func(binlog *pb.Binlog) { synced = append(synced, binlog) }
+	for i := 0; i < 3; i++ {
+		c.Assert(syncer.Sync(insert, cb), check.IsNil)
+	}
+	c.Assert(synced, check.HasLen, 0)
+	c.Assert(syncer.tables["`test`.`t1`"].rowID, check.Equals, int64(3))
+
+	// the update is executed by SQL after the rows are imported.
+	mock.ExpectExec("ALTER TABLE `test`.`t1` AUTO_INCREMENT=4").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT column_name, extra FROM information_schema.columns").WithArgs("test", "t1").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("a", "").AddRow("b", "").AddRow("c", ""))
+	mock.ExpectQuery("SELECT non_unique, index_name, seq_in_index, column_name FROM information_schema.statistics").
+		WithArgs("test", "t1").
+		WillReturnRows(sqlmock.NewRows([]string{"non_unique", "index_name", "seq_in_index", "column_name"}))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE").WithArgs(1, "test", "abc", 1, "test", "test").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c.Assert(syncer.Sync(update, cb), check.IsNil)
+	c.Assert(syncer.tables["`test`.`t1`"].bySQL, check.IsTrue)
+
+	err = syncer.Close()
+	c.Assert(err, check.IsNil)
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(synced, check.HasLen, 4)
+	c.Assert(mock.ExpectationsWereMet(), check.IsNil)
+}
+
+func (s *testLightningSuite) TestTableWithRows(c *check.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, check.IsNil)
+	sqlSyncer, err := newMysqlSyncerFromSQLDB(db, 1, 20, false)
+	c.Assert(err, check.IsNil)
+
+	syncer := newLightningSyncerFromBackend(db, sqlSyncer, noop.NewNoopBackend(), 2)
+	syncer.fetchTables = func(context.Context, string) ([]*model.TableInfo, error) {
+		return []*model.TableInfo{testTableInfo()}, nil
+	}
+
+	mock.ExpectQuery("SELECT 1 FROM `test`.`t1` LIMIT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	t, err := syncer.table("test", "t1")
+	c.Assert(err, check.IsNil)
+	c.Assert(t.bySQL, check.IsTrue)
+
+	_, err = syncer.table("test", "t2")
+	c.Assert(err, check.NotNil)
+
+	c.Assert(syncer.Close(), check.IsNil)
+}
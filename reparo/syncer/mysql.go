@@ -31,6 +31,9 @@ type DBConfig struct {
 	User     string `toml:"user" json:"user"`
 	Password string `toml:"password" json:"password"`
 	Port     int    `toml:"port" json:"port"`
+
+	// Lightning is the configuration of the cluster to import by dest-type "lightning".
+	Lightning *LightningConfig `toml:"lightning" json:"lightning"`
 }
 
 type mysqlSyncer struct {
@@ -77,9 +80,9 @@ type item struct {
 }
 
 func (m *mysqlSyncer) Sync(pbBinlog *pb.Binlog, cb func(binlog *pb.Binlog)) error {
-	txn, err := pbBinlogToTxn(pbBinlog)
+	txn, err := PBBinlogToTxn(pbBinlog)
 	if err != nil {
-		return errors.Annotate(err, "pbBinlogToTxn failed")
+		return errors.Annotate(err, "PBBinlogToTxn failed")
 	}
 
 	item := &item{binlog: pbBinlog, cb: cb}
@@ -14,118 +14,332 @@
 package syncer
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"sync"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/pkg/util"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb/types"
 	"github.com/pingcap/tidb/util/codec"
 	"go.uber.org/zap"
 )
 
-type printSyncer struct{}
+const (
+	// PrintModeEvent prints every DDL and row event.
+	PrintModeEvent = "event"
+	// PrintModeSummary prints the counts of the row events and DDLs of the tables in the time buckets.
+	PrintModeSummary = "summary"
+
+	// PrintFormatText prints the binlogs for reading.
+	PrintFormatText = "text"
+	// PrintFormatJSON prints a JSON object per line.
+	PrintFormatJSON = "json"
+
+	defaultPrintInterval = 3600
+)
+
+// PrintConfig is the configuration of dest-type "print".
+type PrintConfig struct {
+	// Mode is "event" or "summary".
+	Mode string `toml:"mode" json:"mode"`
+	// Format is "text" or "json".
+	Format string `toml:"format" json:"format"`
+	// Interval is the seconds of a time bucket of the summary by the commit time of the binlogs.
+	Interval int `toml:"interval" json:"interval"`
+}
+
+// Validate checks the config and fills the default values.
+func (c *PrintConfig) Validate() error {
+	util.AdjustString(&c.Mode, PrintModeEvent)
+	if c.Mode != PrintModeEvent && c.Mode != PrintModeSummary {
+		return errors.Errorf("invalid print mode %s, it should be %s or %s", c.Mode, PrintModeEvent, PrintModeSummary)
+	}
+	util.AdjustString(&c.Format, PrintFormatText)
+	if c.Format != PrintFormatText && c.Format != PrintFormatJSON {
+		return errors.Errorf("invalid print format %s, it should be %s or %s", c.Format, PrintFormatText, PrintFormatJSON)
+	}
+	util.AdjustInt(&c.Interval, defaultPrintInterval)
+	if c.Interval < 0 {
+		return errors.Errorf("invalid print interval %d, it should be positive", c.Interval)
+	}
+	return nil
+}
+
+// printSyncer prints the binlogs to stdout, the output of a binlog is written at once, so the
+// outputs of the binlogs synced concurrently are not interleaved.
+type printSyncer struct {
+	cfg PrintConfig
+
+	mu sync.Mutex
+	// out is the writer the binlogs are printed to, os.Stdout at the time of printing if it's nil.
+	out     io.Writer
+	summary *printSummary
+}
 
 var _ Syncer = &printSyncer{}
 
-func newPrintSyncer() (*printSyncer, error) {
-	return &printSyncer{}, nil
+// NewPrintSyncer returns the syncer printing the binlogs by the config.
+func NewPrintSyncer(cfg *PrintConfig) (Syncer, error) {
+	return newPrintSyncer(cfg)
+}
+
+func newPrintSyncer(cfg *PrintConfig) (*printSyncer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	p := &printSyncer{cfg: *cfg}
+	if cfg.Mode == PrintModeSummary {
+		p.summary = newPrintSummary(int64(cfg.Interval))
+	}
+	return p, nil
 }
 
 func (p *printSyncer) Sync(pbBinlog *pb.Binlog, cb func(binlog *pb.Binlog)) error {
-	switch pbBinlog.Tp {
-	case pb.BinlogType_DDL:
-		printDDL(pbBinlog)
-		cb(pbBinlog)
-	case pb.BinlogType_DML:
-		for _, event := range pbBinlog.GetDmlData().GetEvents() {
-			printEvent(&event)
-		}
-		cb(pbBinlog)
-	default:
+	if pbBinlog.Tp != pb.BinlogType_DDL && pbBinlog.Tp != pb.BinlogType_DML {
 		return errors.Errorf("unknown type: %v", pbBinlog.Tp)
+	}
 
+	p.mu.Lock()
+	if p.summary != nil {
+		p.summary.add(pbBinlog)
+		p.mu.Unlock()
+		cb(pbBinlog)
+		return nil
 	}
 
+	var buf bytes.Buffer
+	var err error
+	if p.cfg.Format == PrintFormatJSON {
+		err = printBinlogJSON(&buf, pbBinlog)
+	} else {
+		printBinlog(&buf, pbBinlog)
+	}
+	if err == nil {
+		_, err = p.writer().Write(buf.Bytes())
+	}
+	p.mu.Unlock()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	cb(pbBinlog)
 	return nil
 }
 
+func (p *printSyncer) writer() io.Writer {
+	if p.out == nil {
+		return os.Stdout
+	}
+	return p.out
+}
+
+// Close prints the summary in summary mode.
 func (p *printSyncer) Close() error {
-	return nil
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.summary == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	var err error
+	if p.cfg.Format == PrintFormatJSON {
+		err = p.summary.printJSON(&buf)
+	} else {
+		err = p.summary.printText(&buf)
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, err = p.writer().Write(buf.Bytes())
+	return errors.Trace(err)
+}
+
+func printBinlog(w io.Writer, binlog *pb.Binlog) {
+	if binlog.Tp == pb.BinlogType_DDL {
+		printDDL(w, binlog)
+		return
+	}
+	for _, event := range binlog.GetDmlData().GetEvents() {
+		printEvent(w, &event)
+	}
 }
 
-func printEvent(event *pb.Event) {
-	printHeader(event)
+func printEvent(w io.Writer, event *pb.Event) {
+	printHeader(w, event)
 
 	switch event.GetTp() {
 	case pb.EventType_Insert:
-		err := printInsertOrDeleteEvent(event.Row)
+		err := printInsertOrDeleteEvent(w, event.Row)
 		if err != nil {
 			log.Error("print insert event failed", zap.Error(err))
 		}
 	case pb.EventType_Update:
-		err := printUpdateEvent(event.Row)
+		err := printUpdateEvent(w, event.Row)
 		if err != nil {
 			log.Error("print update event failed", zap.Error(err))
 		}
 	case pb.EventType_Delete:
-		err := printInsertOrDeleteEvent(event.Row)
+		err := printInsertOrDeleteEvent(w, event.Row)
 		if err != nil {
 			log.Error("print delete event failed", zap.Error(err))
 		}
 	}
 }
 
-func printHeader(event *pb.Event) {
-	printEventHeader(event)
+func printHeader(w io.Writer, event *pb.Event) {
+	printEventHeader(w, event)
 }
 
-func printDDL(binlog *pb.Binlog) {
-	fmt.Printf("DDL query: %s\n", binlog.DdlQuery)
+func printDDL(w io.Writer, binlog *pb.Binlog) {
+	fmt.Fprintf(w, "DDL query: %s\n", binlog.DdlQuery)
 }
 
-func printEventHeader(event *pb.Event) {
-	fmt.Printf("schema: %s; table: %s; type: %s\n", event.GetSchemaName(), event.GetTableName(), event.GetTp())
+func printEventHeader(w io.Writer, event *pb.Event) {
+	fmt.Fprintf(w, "schema: %s; table: %s; type: %s\n", event.GetSchemaName(), event.GetTableName(), event.GetTp())
+}
+
+func printUpdateEvent(w io.Writer, row [][]byte) error {
+	cols, err := decodePrintColumns(row, true)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, col := range cols {
+		fmt.Fprintf(w, "%s(%s): %s => %s\n", col.name, col.mysqlType, formatValueToString(col.value, col.tp), formatValueToString(col.changedValue, col.tp))
+	}
+	return nil
 }
 
-func printUpdateEvent(row [][]byte) error {
+func printInsertOrDeleteEvent(w io.Writer, row [][]byte) error {
+	cols, err := decodePrintColumns(row, false)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, col := range cols {
+		fmt.Fprintf(w, "%s(%s): %s\n", col.name, col.mysqlType, formatValueToString(col.value, col.tp))
+	}
+	return nil
+}
+
+// printColumn is a decoded column of a row event, changedValue is only for the updates.
+type printColumn struct {
+	name         string
+	mysqlType    string
+	tp           byte
+	value        types.Datum
+	changedValue types.Datum
+}
+
+func decodePrintColumns(row [][]byte, update bool) ([]printColumn, error) {
+	cols := make([]printColumn, 0, len(row))
 	for _, c := range row {
 		col := &pb.Column{}
 		err := col.Unmarshal(c)
 		if err != nil {
-			return errors.Annotate(err, "unmarshal failed")
+			return nil, errors.Annotate(err, "unmarshal failed")
 		}
 
 		_, val, err := codec.DecodeOne(col.Value)
 		if err != nil {
-			return errors.Annotate(err, "decode row failed")
+			return nil, errors.Annotate(err, "decode row failed")
 		}
+		printCol := printColumn{name: col.Name, mysqlType: col.MysqlType, tp: col.Tp[0], value: val}
 
-		_, changedVal, err := codec.DecodeOne(col.ChangedValue)
-		if err != nil {
-			return errors.Annotate(err, "decode row failed")
+		if update {
+			_, printCol.changedValue, err = codec.DecodeOne(col.ChangedValue)
+			if err != nil {
+				return nil, errors.Annotate(err, "decode row failed")
+			}
 		}
-
-		tp := col.Tp[0]
-		fmt.Printf("%s(%s): %s => %s\n", col.Name, col.MysqlType, formatValueToString(val, tp), formatValueToString(changedVal, tp))
+		cols = append(cols, printCol)
 	}
-	return nil
+	return cols, nil
 }
 
-func printInsertOrDeleteEvent(row [][]byte) error {
-	for _, c := range row {
-		col := &pb.Column{}
-		err := col.Unmarshal(c)
+// jsonDDL is the JSON line of a DDL.
+type jsonDDL struct {
+	CommitTS int64  `json:"commit-ts"`
+	Type     string `json:"type"`
+	Schema   string `json:"schema,omitempty"`
+	Table    string `json:"table,omitempty"`
+	Query    string `json:"query"`
+}
+
+// jsonEvent is the JSON line of a row event, the columns are jsonColumn or jsonUpdatedColumn.
+type jsonEvent struct {
+	CommitTS int64       `json:"commit-ts"`
+	Type     string      `json:"type"`
+	Schema   string      `json:"schema"`
+	Table    string      `json:"table"`
+	Columns  interface{} `json:"columns"`
+}
+
+// jsonColumn is a column of an inserted or deleted row, the value is null for NULL.
+type jsonColumn struct {
+	Name  string  `json:"name"`
+	Type  string  `json:"type"`
+	Value *string `json:"value"`
+}
+
+// jsonUpdatedColumn is a column of an updated row, value is the old value and changed-value is the new one.
+type jsonUpdatedColumn struct {
+	Name         string  `json:"name"`
+	Type         string  `json:"type"`
+	Value        *string `json:"value"`
+	ChangedValue *string `json:"changed-value"`
+}
+
+// printBinlogJSON prints the DDL or every row event of the binlog as a JSON line.
+func printBinlogJSON(w io.Writer, binlog *pb.Binlog) error {
+	enc := json.NewEncoder(w)
+	if binlog.Tp == pb.BinlogType_DDL {
+		query := string(binlog.DdlQuery)
+		schema, table, err := parserSchemaTableFromDDL(query)
 		if err != nil {
-			return errors.Annotate(err, "unmarshal failed")
+			log.Warn("parse the schema and table of DDL failed", zap.String("query", query), zap.Error(err))
 		}
+		return errors.Trace(enc.Encode(&jsonDDL{CommitTS: binlog.CommitTs, Type: "DDL", Schema: schema, Table: table, Query: query}))
+	}
 
-		_, val, err := codec.DecodeOne(col.Value)
+	for _, event := range binlog.GetDmlData().GetEvents() {
+		update := event.GetTp() == pb.EventType_Update
+		cols, err := decodePrintColumns(event.Row, update)
 		if err != nil {
-			return errors.Annotate(err, "decode row failed")
+			return errors.Trace(err)
+		}
+		jsonCols := make([]interface{}, 0, len(cols))
+		for _, col := range cols {
+			if update {
+				jsonCols = append(jsonCols, &jsonUpdatedColumn{Name: col.name, Type: col.mysqlType,
+					Value: jsonValue(col.value, col.tp), ChangedValue: jsonValue(col.changedValue, col.tp)})
+			} else {
+				jsonCols = append(jsonCols, &jsonColumn{Name: col.name, Type: col.mysqlType, Value: jsonValue(col.value, col.tp)})
+			}
+		}
+		err = enc.Encode(&jsonEvent{
+			CommitTS: binlog.CommitTs,
+			Type:     event.GetTp().String(),
+			Schema:   event.GetSchemaName(),
+			Table:    event.GetTableName(),
+			Columns:  jsonCols,
+		})
+		if err != nil {
+			return errors.Trace(err)
 		}
-
-		tp := col.Tp[0]
-		fmt.Printf("%s(%s): %s\n", col.Name, col.MysqlType, formatValueToString(val, tp))
 	}
 	return nil
 }
+
+func jsonValue(val types.Datum, tp byte) *string {
+	if val.IsNull() {
+		return nil
+	}
+	str := formatValueToString(val, tp)
+	return &str
+}
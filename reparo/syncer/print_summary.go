@@ -0,0 +1,141 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"go.uber.org/zap"
+)
+
+const printTimeFormat = "2006-01-02 15:04:05"
+
+// summaryKey is a table in a time bucket, bucket is the unix time of the beginning of the bucket.
+type summaryKey struct {
+	bucket int64
+	schema string
+	table  string
+}
+
+// summaryCounts are the counts of the row events and DDLs of a table in a time bucket.
+type summaryCounts struct {
+	Insert int64 `json:"insert"`
+	Update int64 `json:"update"`
+	Delete int64 `json:"delete"`
+	DDL    int64 `json:"ddl"`
+}
+
+// printSummary counts the row events and DDLs of the tables in the time buckets by the commit time
+// of the binlogs, the counts are printed at last sorted by the bucket, schema and table.
+type printSummary struct {
+	interval int64
+	counts   map[summaryKey]*summaryCounts
+}
+
+func newPrintSummary(interval int64) *printSummary {
+	return &printSummary{interval: interval, counts: make(map[summaryKey]*summaryCounts)}
+}
+
+func (s *printSummary) get(commitTS int64, schema string, table string) *summaryCounts {
+	unix := oracle.GetTimeFromTS(uint64(commitTS)).Unix()
+	key := summaryKey{bucket: unix - unix%s.interval, schema: schema, table: table}
+	counts, ok := s.counts[key]
+	if !ok {
+		counts = new(summaryCounts)
+		s.counts[key] = counts
+	}
+	return counts
+}
+
+func (s *printSummary) add(binlog *pb.Binlog) {
+	if binlog.Tp == pb.BinlogType_DDL {
+		schema, table, err := parserSchemaTableFromDDL(string(binlog.DdlQuery))
+		if err != nil {
+			log.Warn("parse the schema and table of DDL failed", zap.ByteString("query", binlog.DdlQuery), zap.Error(err))
+		}
+		s.get(binlog.CommitTs, schema, table).DDL++
+		return
+	}
+
+	for _, event := range binlog.GetDmlData().GetEvents() {
+		counts := s.get(binlog.CommitTs, event.GetSchemaName(), event.GetTableName())
+		switch event.GetTp() {
+		case pb.EventType_Insert:
+			counts.Insert++
+		case pb.EventType_Update:
+			counts.Update++
+		case pb.EventType_Delete:
+			counts.Delete++
+		}
+	}
+}
+
+func (s *printSummary) sortedKeys() []summaryKey {
+	keys := make([]summaryKey, 0, len(s.counts))
+	for key := range s.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].bucket != keys[j].bucket {
+			return keys[i].bucket < keys[j].bucket
+		}
+		if keys[i].schema != keys[j].schema {
+			return keys[i].schema < keys[j].schema
+		}
+		return keys[i].table < keys[j].table
+	})
+	return keys
+}
+
+func bucketTime(bucket int64) string {
+	return time.Unix(bucket, 0).Format(printTimeFormat)
+}
+
+// printText prints the counts as a table, a row per table in a time bucket.
+func (s *printSummary) printText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSCHEMA\tTABLE\tINSERT\tUPDATE\tDELETE\tDDL")
+	for _, key := range s.sortedKeys() {
+		counts := s.counts[key]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%d\n", bucketTime(key.bucket), key.schema, key.table,
+			counts.Insert, counts.Update, counts.Delete, counts.DDL)
+	}
+	return errors.Trace(tw.Flush())
+}
+
+// printJSON prints the counts as JSON lines, a line per table in a time bucket.
+func (s *printSummary) printJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, key := range s.sortedKeys() {
+		err := enc.Encode(&struct {
+			Time   string `json:"time"`
+			Schema string `json:"schema"`
+			Table  string `json:"table"`
+			*summaryCounts
+		}{bucketTime(key.bucket), key.schema, key.table, s.counts[key]})
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
@@ -1,11 +1,14 @@
 package syncer
 
 import (
+	"os"
 	"strings"
+	"time"
 
 	capturer "github.com/kami-zh/go-capturer"
 	"github.com/pingcap/check"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb/store/tikv/oracle"
 )
 
 type testPrintSuite struct{}
@@ -13,7 +16,7 @@ type testPrintSuite struct{}
 var _ = check.Suite(&testPrintSuite{})
 
 func (s *testPrintSuite) TestPrintSyncer(c *check.C) {
-	syncer, err := newPrintSyncer()
+	syncer, err := newPrintSyncer(&PrintConfig{})
 	c.Assert(err, check.IsNil)
 
 	out := capturer.CaptureStdout(func() {
@@ -49,7 +52,7 @@ func (s *testPrintSuite) TestPrintEventHeader(c *check.C) {
 	}
 
 	out := capturer.CaptureStdout(func() {
-		printEventHeader(event)
+		printEventHeader(os.Stdout, event)
 	})
 	lines := strings.Split(strings.TrimSpace(out), "\n")
 	c.Assert(lines, check.HasLen, 1)
@@ -63,7 +66,7 @@ func (s *testPrintSuite) TestPrintDDL(c *check.C) {
 	}
 
 	out := capturer.CaptureStdout(func() {
-		printDDL(ddlBinlog)
+		printDDL(os.Stdout, ddlBinlog)
 	})
 	lines := strings.Split(strings.TrimSpace(out), "\n")
 	c.Assert(lines, check.HasLen, 1)
@@ -79,7 +82,7 @@ func (s *testPrintSuite) TestPrintRow(c *check.C) {
 	}
 
 	out := capturer.CaptureStdout(func() {
-		printEvent(insertEvent)
+		printEvent(os.Stdout, insertEvent)
 	})
 	lines := strings.Split(strings.TrimSpace(out), "\n")
 	c.Assert(lines, check.HasLen, 3)
@@ -92,7 +95,7 @@ func (s *testPrintSuite) TestPrintRow(c *check.C) {
 		Row: [][]byte{cols[0], cols[1]},
 	}
 	out = capturer.CaptureStdout(func() {
-		printEvent(deleteEvent)
+		printEvent(os.Stdout, deleteEvent)
 	})
 	lines = strings.Split(strings.TrimSpace(out), "\n")
 	c.Assert(lines, check.HasLen, 3)
@@ -105,10 +108,74 @@ func (s *testPrintSuite) TestPrintRow(c *check.C) {
 		Row: [][]byte{cols[2]},
 	}
 	out = capturer.CaptureStdout(func() {
-		printEvent(updateEvent)
+		printEvent(os.Stdout, updateEvent)
 	})
 	lines = strings.Split(strings.TrimSpace(out), "\n")
 	c.Assert(lines, check.HasLen, 2)
 	c.Assert(lines[0], check.Equals, "schema: ; table: ; type: Update")
 	c.Assert(lines[1], check.Equals, "c(varchar): test => abc")
 }
+
+func (s *testPrintSuite) TestPrintJSON(c *check.C) {
+	syncer, err := newPrintSyncer(&PrintConfig{Format: PrintFormatJSON})
+	c.Assert(err, check.IsNil)
+
+	out := capturer.CaptureStdout(func() {
+		syncTest(c, Syncer(syncer))
+	})
+	c.Assert(out, check.Equals,
+		`{"commit-ts":0,"type":"DDL","schema":"test","query":"create database test;"}`+"\n"+
+			`{"commit-ts":0,"type":"Insert","schema":"test","table":"t1","columns":[{"name":"a","type":"int","value":"1"},{"name":"b","type":"varchar","value":"test"},{"name":"c","type":"varchar","value":"test"}]}`+"\n"+
+			`{"commit-ts":0,"type":"Delete","schema":"test","table":"t1","columns":[{"name":"a","type":"int","value":"1"},{"name":"b","type":"varchar","value":"test"},{"name":"c","type":"varchar","value":"test"}]}`+"\n"+
+			`{"commit-ts":0,"type":"Update","schema":"test","table":"t1","columns":[{"name":"a","type":"int","value":"1","changed-value":"1"},{"name":"b","type":"varchar","value":"test","changed-value":"test"},{"name":"c","type":"varchar","value":"test","changed-value":"abc"}]}`+"\n")
+	c.Assert(syncer.Close(), check.IsNil)
+}
+
+func (s *testPrintSuite) TestPrintSummary(c *check.C) {
+	syncer, err := newPrintSyncer(&PrintConfig{Mode: PrintModeSummary, Interval: 60})
+	c.Assert(err, check.IsNil)
+
+	base := time.Date(2021, 6, 1, 10, 0, 0, 0, time.Local)
+	tsOf := func(t time.Time) int64 {
+		return int64(oracle.ComposeTS(t.UnixNano()/int64(time.Millisecond), 0))
+	}
+	events := generateDMLEvents(c)
+	binlogs := []*pb.Binlog{
+		{Tp: pb.BinlogType_DDL, CommitTs: tsOf(base), DdlQuery: []byte("use test; create table t1(a int)")},
+		{Tp: pb.BinlogType_DML, CommitTs: tsOf(base.Add(10 * time.Second)), DmlData: &pb.DMLData{Events: events}},
+		{Tp: pb.BinlogType_DML, CommitTs: tsOf(base.Add(70 * time.Second)), DmlData: &pb.DMLData{Events: events[:1]}},
+	}
+
+	out := capturer.CaptureStdout(func() {
+		for _, binlog := range binlogs {
+			c.Assert(syncer.Sync(binlog, func(*pb.Binlog) {}), check.IsNil)
+		}
+		// the summary is printed on close.
+		c.Assert(syncer.Close(), check.IsNil)
+	})
+	c.Assert(out, check.Equals,
+		"TIME                 SCHEMA  TABLE  INSERT  UPDATE  DELETE  DDL\n"+
+			"2021-06-01 10:00:00  test    t1     1       1       1       1\n"+
+			"2021-06-01 10:01:00  test    t1     1       0       0       0\n")
+
+	syncer, err = newPrintSyncer(&PrintConfig{Mode: PrintModeSummary, Format: PrintFormatJSON, Interval: 3600})
+	c.Assert(err, check.IsNil)
+	out = capturer.CaptureStdout(func() {
+		for _, binlog := range binlogs {
+			c.Assert(syncer.Sync(binlog, func(*pb.Binlog) {}), check.IsNil)
+		}
+		c.Assert(syncer.Close(), check.IsNil)
+	})
+	c.Assert(out, check.Equals,
+		`{"time":"2021-06-01 10:00:00","schema":"test","table":"t1","insert":2,"update":1,"delete":1,"ddl":1}`+"\n")
+}
+
+func (s *testPrintSuite) TestValidatePrintConfig(c *check.C) {
+	cfg := &PrintConfig{}
+	c.Assert(cfg.Validate(), check.IsNil)
+	c.Assert(cfg, check.DeepEquals, &PrintConfig{Mode: PrintModeEvent, Format: PrintFormatText, Interval: defaultPrintInterval})
+
+	c.Assert((&PrintConfig{Mode: "rows"}).Validate(), check.ErrorMatches, "invalid print mode rows.*")
+	c.Assert((&PrintConfig{Format: "csv"}).Validate(), check.ErrorMatches, "invalid print format csv.*")
+	c.Assert((&PrintConfig{Interval: -1}).Validate(), check.ErrorMatches, "invalid print interval -1.*")
+}
@@ -0,0 +1,180 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
+	ptypes "github.com/pingcap/parser/types"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+// SlaveBinlogToPB converts the binlog in kafka to the one in the pb files.
+func SlaveBinlogToPB(slave *obinlog.Binlog) (*pb.Binlog, error) {
+	binlog := &pb.Binlog{CommitTs: slave.CommitTs}
+	switch slave.Type {
+	case obinlog.BinlogType_DDL:
+		sql := string(slave.DdlData.GetDdlQuery())
+		stmt, err := parser.New().ParseOneStmt(sql, "", "")
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		// the same as the one written by drainer.
+		if _, ok := stmt.(*ast.CreateDatabaseStmt); ok {
+			sql += ";"
+		} else {
+			sql = fmt.Sprintf("use `%s`; %s;", strings.Replace(slave.DdlData.GetSchemaName(), "`", "``", -1), sql)
+		}
+		binlog.Tp = pb.BinlogType_DDL
+		binlog.DdlQuery = []byte(sql)
+		return binlog, nil
+	case obinlog.BinlogType_DML:
+	default:
+		return nil, errors.Errorf("unknown type: %v", slave.Type)
+	}
+
+	binlog.Tp = pb.BinlogType_DML
+	binlog.DmlData = new(pb.DMLData)
+	for _, table := range slave.DmlData.GetTables() {
+		for _, mutation := range table.Mutations {
+			event, err := slaveMutationToPBEvent(table, mutation)
+			if err != nil {
+				return nil, errors.Annotatef(err, "table %s.%s", table.GetSchemaName(), table.GetTableName())
+			}
+			binlog.DmlData.Events = append(binlog.DmlData.Events, *event)
+		}
+	}
+	return binlog, nil
+}
+
+func slaveMutationToPBEvent(table *obinlog.Table, mutation *obinlog.TableMutation) (*pb.Event, error) {
+	event := &pb.Event{
+		SchemaName: proto.String(table.GetSchemaName()),
+		TableName:  proto.String(table.GetTableName()),
+	}
+	switch mutation.GetType() {
+	case obinlog.MutationType_Insert:
+		event.Tp = pb.EventType_Insert
+	case obinlog.MutationType_Update:
+		event.Tp = pb.EventType_Update
+	case obinlog.MutationType_Delete:
+		event.Tp = pb.EventType_Delete
+	default:
+		return nil, errors.Errorf("unknown type: %v", mutation.GetType())
+	}
+
+	columns := mutation.GetRow().GetColumns()
+	if len(columns) != len(table.ColumnInfo) {
+		return nil, errors.Errorf("%d columns in the row but %d in the table", len(columns), len(table.ColumnInfo))
+	}
+	if event.Tp == pb.EventType_Update && len(mutation.GetChangeRow().GetColumns()) != len(columns) {
+		return nil, errors.Errorf("%d columns in the old row but %d in the new row", len(mutation.GetChangeRow().GetColumns()), len(columns))
+	}
+	sc := &stmtctx.StatementContext{TimeZone: time.Local}
+	encode := func(info *obinlog.ColumnInfo, column *obinlog.Column) ([]byte, error) {
+		d, err := columnToDatum(info.MysqlType, column)
+		if err != nil {
+			return nil, errors.Annotatef(err, "column %s", info.Name)
+		}
+		return codec.EncodeValue(sc, nil, d)
+	}
+
+	for i, info := range table.ColumnInfo {
+		col := &pb.Column{
+			Name:      info.Name,
+			Tp:        []byte{mysqlTypeToTp(info.MysqlType)},
+			MysqlType: info.MysqlType,
+		}
+		var err error
+		if event.Tp == pb.EventType_Update {
+			// Value is the old value and ChangedValue is the new one in the pb files.
+			if col.Value, err = encode(info, mutation.ChangeRow.Columns[i]); err != nil {
+				return nil, errors.Trace(err)
+			}
+			if col.ChangedValue, err = encode(info, columns[i]); err != nil {
+				return nil, errors.Trace(err)
+			}
+		} else if col.Value, err = encode(info, columns[i]); err != nil {
+			return nil, errors.Trace(err)
+		}
+		data, err := col.Marshal()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		event.Row = append(event.Row, data)
+	}
+	return event, nil
+}
+
+// columnToDatum converts the column of kafka to the datum written to the pb files.
+func columnToDatum(mysqlType string, column *obinlog.Column) (types.Datum, error) {
+	switch {
+	case column.GetIsNull():
+		return types.NewDatum(nil), nil
+	case column.Int64Value != nil:
+		return types.NewIntDatum(column.GetInt64Value()), nil
+	case column.Uint64Value != nil:
+		return types.NewUintDatum(column.GetUint64Value()), nil
+	case column.DoubleValue != nil:
+		return types.NewFloat64Datum(column.GetDoubleValue()), nil
+	case column.BytesValue != nil:
+		switch mysqlType {
+		case "bit":
+			v, err := types.BinaryLiteral(column.BytesValue).ToInt(nil)
+			return types.NewUintDatum(v), errors.Trace(err)
+		case "json":
+			return types.NewStringDatum(string(column.BytesValue)), nil
+		default:
+			return types.NewBytesDatum(column.BytesValue), nil
+		}
+	case column.StringValue != nil:
+		if mysqlType == "year" {
+			v, err := strconv.ParseInt(column.GetStringValue(), 10, 64)
+			return types.NewIntDatum(v), errors.Trace(err)
+		}
+		return types.NewStringDatum(column.GetStringValue()), nil
+	default:
+		return types.Datum{}, errors.New("no value")
+	}
+}
+
+var mysqlTypes = []byte{
+	mysql.TypeBit, mysql.TypeBlob, mysql.TypeDate, mysql.TypeDatetime, mysql.TypeNewDecimal, mysql.TypeDouble,
+	mysql.TypeEnum, mysql.TypeFloat, mysql.TypeGeometry, mysql.TypeInt24, mysql.TypeJSON, mysql.TypeLong,
+	mysql.TypeLonglong, mysql.TypeLongBlob, mysql.TypeMediumBlob, mysql.TypeSet, mysql.TypeShort, mysql.TypeString,
+	mysql.TypeDuration, mysql.TypeTimestamp, mysql.TypeTiny, mysql.TypeTinyBlob, mysql.TypeVarchar,
+	mysql.TypeVarString, mysql.TypeYear,
+}
+
+// mysqlTypeToTp is the reverse of types.TypeToStr.
+func mysqlTypeToTp(mysqlType string) byte {
+	for _, tp := range mysqlTypes {
+		if ptypes.TypeToStr(tp, "") == mysqlType || ptypes.TypeToStr(tp, "binary") == mysqlType {
+			return tp
+		}
+	}
+	return mysql.TypeUnspecified
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncer
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/check"
+	"github.com/pingcap/parser/mysql"
+	obinlog "github.com/pingcap/tidb-tools/tidb-binlog/proto/go-binlog"
+	"github.com/pingcap/tidb/types"
+)
+
+type testSlaveSuite struct{}
+
+var _ = check.Suite(&testSlaveSuite{})
+
+func (s *testSlaveSuite) TestColumnToDatum(c *check.C) {
+	tests := []struct {
+		mysqlType string
+		column    *obinlog.Column
+		expected  types.Datum
+	}{
+		{"int", &obinlog.Column{IsNull: proto.Bool(true)}, types.NewDatum(nil)},
+		{"bigint", &obinlog.Column{Uint64Value: proto.Uint64(1)}, types.NewUintDatum(1)},
+		{"double", &obinlog.Column{DoubleValue: proto.Float64(1.5)}, types.NewFloat64Datum(1.5)},
+		{"bit", &obinlog.Column{BytesValue: []byte{1, 0}}, types.NewUintDatum(256)},
+		{"json", &obinlog.Column{BytesValue: []byte(`{"a":1}`)}, types.NewStringDatum(`{"a":1}`)},
+		{"blob", &obinlog.Column{BytesValue: []byte("a")}, types.NewBytesDatum([]byte("a"))},
+		{"year", &obinlog.Column{StringValue: proto.String("2021")}, types.NewIntDatum(2021)},
+	}
+	for _, t := range tests {
+		d, err := columnToDatum(t.mysqlType, t.column)
+		c.Assert(err, check.IsNil)
+		c.Assert(d, check.DeepEquals, t.expected, check.Commentf("%s", t.mysqlType))
+	}
+	_, err := columnToDatum("int", &obinlog.Column{})
+	c.Assert(err, check.NotNil)
+
+	c.Assert(mysqlTypeToTp("varbinary"), check.Equals, mysql.TypeVarchar)
+	c.Assert(mysqlTypeToTp("longblob"), check.Equals, mysql.TypeLongBlob)
+	c.Assert(mysqlTypeToTp("unknown"), check.Equals, mysql.TypeUnspecified)
+}
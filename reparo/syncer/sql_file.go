@@ -0,0 +1,212 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncer
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	pkgsql "github.com/pingcap/tidb-binlog/pkg/sql"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+// sqlFileSyncer writes the binlogs as SQL statements to the files in a directory for manual review.
+// Every DDL is written to a file of its own, and the DMLs between two DDLs are written to one file,
+// the files are numbered in the order of the binlogs, like 000001-dml.sql and 000002-ddl.sql.
+type sqlFileSyncer struct {
+	dir string
+	seq int
+
+	// file is the file of the DMLs being written, it's nil after a DDL.
+	file   *os.File
+	writer *bufio.Writer
+}
+
+var _ Syncer = &sqlFileSyncer{}
+
+// NewSQLFileSyncer creates a Syncer writing the binlogs as SQL files to dir.
+func NewSQLFileSyncer(dir string) (Syncer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &sqlFileSyncer{dir: dir}, nil
+}
+
+func (s *sqlFileSyncer) Sync(pbBinlog *pb.Binlog, cb func(binlog *pb.Binlog)) error {
+	switch pbBinlog.Tp {
+	case pb.BinlogType_DDL:
+		if err := s.closeFile(); err != nil {
+			return errors.Trace(err)
+		}
+		query := strings.TrimSpace(string(pbBinlog.DdlQuery))
+		if !strings.HasSuffix(query, ";") {
+			query += ";"
+		}
+		s.seq++
+		data := fmt.Sprintf("/* commit ts: %d */\n%s\n", pbBinlog.CommitTs, query)
+		if err := ioutil.WriteFile(s.path("ddl"), []byte(data), 0644); err != nil {
+			return errors.Trace(err)
+		}
+	case pb.BinlogType_DML:
+		if s.file == nil {
+			s.seq++
+			file, err := os.OpenFile(s.path("dml"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			s.file = file
+			s.writer = bufio.NewWriter(file)
+		}
+		fmt.Fprintf(s.writer, "/* commit ts: %d */\nBEGIN;\n", pbBinlog.CommitTs)
+		for _, event := range pbBinlog.GetDmlData().GetEvents() {
+			stmt, err := eventToSQL(&event)
+			if err != nil {
+				return errors.Annotatef(err, "write the event of %s.%s failed", event.GetSchemaName(), event.GetTableName())
+			}
+			fmt.Fprintf(s.writer, "%s;\n", stmt)
+		}
+		if _, err := s.writer.WriteString("COMMIT;\n"); err != nil {
+			return errors.Trace(err)
+		}
+	default:
+		return errors.Errorf("unknown type: %v", pbBinlog.Tp)
+	}
+
+	cb(pbBinlog)
+	return nil
+}
+
+func (s *sqlFileSyncer) path(kind string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%06d-%s.sql", s.seq, kind))
+}
+
+func (s *sqlFileSyncer) closeFile() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.writer.Flush()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	s.file, s.writer = nil, nil
+	return errors.Trace(err)
+}
+
+func (s *sqlFileSyncer) Close() error {
+	return s.closeFile()
+}
+
+// eventToSQL returns the statement of the event with the values inlined. The rows are
+// matched by all the columns, since the keys of the tables are unknown.
+func eventToSQL(event *pb.Event) (string, error) {
+	var names []string
+	var values, changedValues []interface{}
+	for _, c := range event.GetRow() {
+		col := &pb.Column{}
+		if err := col.Unmarshal(c); err != nil {
+			return "", errors.Trace(err)
+		}
+		tp := col.Tp[0]
+		_, val, err := codec.DecodeOne(col.Value)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		val = formatValue(val, tp)
+		names = append(names, pkgsql.QuoteName(col.Name))
+		values = append(values, val.GetValue())
+
+		if event.GetTp() == pb.EventType_Update {
+			_, changed, err := codec.DecodeOne(col.ChangedValue)
+			if err != nil {
+				return "", errors.Trace(err)
+			}
+			changed = formatValue(changed, tp)
+			changedValues = append(changedValues, changed.GetValue())
+		}
+	}
+
+	table := pkgsql.QuoteSchema(event.GetSchemaName(), event.GetTableName())
+	var b strings.Builder
+	switch event.GetTp() {
+	case pb.EventType_Insert:
+		fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES (", table, strings.Join(names, ","))
+		for i, v := range values {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(sqlLiteral(v))
+		}
+		b.WriteString(")")
+	case pb.EventType_Update:
+		fmt.Fprintf(&b, "UPDATE %s SET ", table)
+		for i, name := range names {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "%s = %s", name, sqlLiteral(changedValues[i]))
+		}
+		writeWhere(&b, names, values)
+	case pb.EventType_Delete:
+		fmt.Fprintf(&b, "DELETE FROM %s", table)
+		writeWhere(&b, names, values)
+	default:
+		return "", errors.Errorf("unknown type: %v", event.GetTp())
+	}
+	return b.String(), nil
+}
+
+func writeWhere(b *strings.Builder, names []string, values []interface{}) {
+	b.WriteString(" WHERE ")
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(" AND ")
+		}
+		if values[i] == nil {
+			fmt.Fprintf(b, "%s IS NULL", name)
+		} else {
+			fmt.Fprintf(b, "%s = %s", name, sqlLiteral(values[i]))
+		}
+	}
+	b.WriteString(" LIMIT 1")
+}
+
+var stringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\x00", `\0`, "\n", `\n`, "\r", `\r`, "\x1a", `\Z`)
+
+// sqlLiteral returns the literal of the value formatted by formatValue.
+func sqlLiteral(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + stringEscaper.Replace(val) + "'"
+	case []byte:
+		return fmt.Sprintf("x'%x'", val)
+	case types.BinaryLiteral:
+		return fmt.Sprintf("x'%x'", []byte(val))
+	case float32:
+		return strconv.FormatFloat(float64(val), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncer
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/pingcap/check"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb/types"
+)
+
+type testSQLFileSuite struct{}
+
+var _ = check.Suite(&testSQLFileSuite{})
+
+func (s *testSQLFileSuite) TestSQLFileSyncer(c *check.C) {
+	dir := c.MkDir()
+	syncer, err := NewSQLFileSyncer(dir)
+	c.Assert(err, check.IsNil)
+
+	syncTest(c, syncer)
+	err = syncer.Sync(&pb.Binlog{Tp: pb.BinlogType_DDL, CommitTs: 3, DdlQuery: []byte("use test; drop table t1")}, func(*pb.Binlog) {})
+	c.Assert(err, check.IsNil)
+	c.Assert(syncer.Close(), check.IsNil)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 3)
+
+	read := func(name string) string {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		c.Assert(err, check.IsNil)
+		return string(data)
+	}
+	c.Assert(read("000001-ddl.sql"), check.Equals, "/* commit ts: 0 */\ncreate database test;\n")
+	c.Assert(read("000002-dml.sql"), check.Equals, "/* commit ts: 0 */\nBEGIN;\n"+
+		"INSERT INTO `test`.`t1` (`a`,`b`,`c`) VALUES (1,'test','test');\n"+
+		"DELETE FROM `test`.`t1` WHERE `a` = 1 AND `b` = 'test' AND `c` = 'test' LIMIT 1;\n"+
+		"UPDATE `test`.`t1` SET `a` = 1, `b` = 'test', `c` = 'abc' WHERE `a` = 1 AND `b` = 'test' AND `c` = 'test' LIMIT 1;\n"+
+		"COMMIT;\n")
+	c.Assert(read("000003-ddl.sql"), check.Equals, "/* commit ts: 3 */\nuse test; drop table t1;\n")
+}
+
+func (s *testSQLFileSuite) TestSQLLiteral(c *check.C) {
+	c.Assert(sqlLiteral(nil), check.Equals, "NULL")
+	c.Assert(sqlLiteral("it's\n\\"), check.Equals, `'it\'s\n\\'`)
+	c.Assert(sqlLiteral([]byte{0x01, 0xff}), check.Equals, "x'01ff'")
+	c.Assert(sqlLiteral(types.BinaryLiteral{0x0a}), check.Equals, "x'0a'")
+	c.Assert(sqlLiteral(1.5), check.Equals, "1.5")
+	c.Assert(sqlLiteral(uint64(18446744073709551615)), check.Equals, "18446744073709551615")
+}
@@ -16,6 +16,7 @@ package syncer
 import (
 	"fmt"
 
+	"github.com/pingcap/errors"
 	pb "github.com/pingcap/tidb-binlog/proto/binlog"
 )
 
@@ -33,10 +34,39 @@ func New(name string, cfg *DBConfig, worker int, batchSize int, safemode bool) (
 	switch name {
 	case "mysql":
 		return newMysqlSyncer(cfg, worker, batchSize, safemode)
+	case "lightning":
+		return newLightningSyncer(cfg, worker, batchSize, safemode)
 	case "print":
-		return newPrintSyncer()
+		return newPrintSyncer(&PrintConfig{})
 	case "memory":
 		return newMemSyncer()
 	}
 	panic(fmt.Sprintf("unknown syncer %s", name))
 }
+
+// SyncAndWait syncs the binlog and waits until it's executed on the target.
+func SyncAndWait(syncer Syncer, pbBinlog *pb.Binlog, cb func(binlog *pb.Binlog)) error {
+	done := make(chan struct{})
+	err := syncer.Sync(pbBinlog, func(binlog *pb.Binlog) {
+		cb(binlog)
+		close(done)
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	// the binlogs are executed asynchronously only by the loader of mysqlSyncer.
+	var quit chan struct{}
+	if m, ok := syncer.(*mysqlSyncer); ok {
+		quit = m.loaderQuit
+	}
+	select {
+	case <-done:
+		return nil
+	case <-quit:
+		if m := syncer.(*mysqlSyncer); m.loaderErr != nil {
+			return errors.Trace(m.loaderErr)
+		}
+		return errors.New("syncer quit before the binlog is executed")
+	}
+}
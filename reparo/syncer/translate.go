@@ -36,7 +36,8 @@ func trimUse(sql string) string {
 	return sql
 }
 
-func pbBinlogToTxn(binlog *pb.Binlog) (txn *loader.Txn, err error) {
+// PBBinlogToTxn translates the binlog written by drainer to pb files to the txn of loader.
+func PBBinlogToTxn(binlog *pb.Binlog) (txn *loader.Txn, err error) {
 	txn = new(loader.Txn)
 	switch binlog.Tp {
 	case pb.BinlogType_DDL:
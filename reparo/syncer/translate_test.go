@@ -165,7 +165,7 @@ func (s *testTranslateSuite) TestPBBinlogToTxn(c *check.C) {
 	}
 
 	for binlog, txn := range tests {
-		getTxn, err := pbBinlogToTxn(binlog)
+		getTxn, err := PBBinlogToTxn(binlog)
 		c.Assert(err, check.IsNil)
 		c.Assert(getTxn.DDL, check.DeepEquals, txn.DDL)
 		c.Assert(getTxn.DMLs, check.DeepEquals, txn.DMLs)
@@ -0,0 +1,410 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/opcode"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/types"
+	driver "github.com/pingcap/tidb/types/parser_driver"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+// wheresValue is the flag value of the predicates, each --where adds one.
+type wheresValue []string
+
+// Set adds the predicate if it's not added yet, the flags are parsed more than once.
+func (w *wheresValue) Set(s string) error {
+	for _, where := range *w {
+		if where == s {
+			return nil
+		}
+	}
+	*w = append(*w, s)
+	return nil
+}
+
+func (w *wheresValue) String() string {
+	return strings.Join(*w, "; ")
+}
+
+// rowPredicate is a boolean expression on the columns of a table like
+// `db.tbl.id BETWEEN 100 AND 200`, the schema is optional.
+type rowPredicate struct {
+	schema string
+	table  string
+	where  string
+	expr   ast.ExprNode
+}
+
+// rowFilter drops the rows not matching the predicates of their tables, the
+// rows of the tables without predicates are kept.
+type rowFilter struct {
+	predicates []*rowPredicate
+	sc         *stmtctx.StatementContext
+}
+
+func newRowFilter(wheres []string) (*rowFilter, error) {
+	f := &rowFilter{sc: &stmtctx.StatementContext{TimeZone: time.Local}}
+	for _, where := range wheres {
+		p, err := parseRowPredicate(where)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid where %q", where)
+		}
+		f.predicates = append(f.predicates, p)
+	}
+	return f, nil
+}
+
+func parseRowPredicate(where string) (*rowPredicate, error) {
+	stmt, err := parser.New().ParseOneStmt("SELECT * FROM t WHERE "+where, "", "")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	sel, ok := stmt.(*ast.SelectStmt)
+	if !ok || sel.Where == nil || sel.Limit != nil || sel.OrderBy != nil || sel.GroupBy != nil {
+		return nil, errors.New("not a boolean expression")
+	}
+
+	p := &rowPredicate{where: where, expr: sel.Where}
+	var checker predicateChecker
+	sel.Where.Accept(&checker)
+	if checker.err != nil {
+		return nil, errors.Trace(checker.err)
+	}
+	for _, col := range checker.columns {
+		if col.Table.L == "" {
+			return nil, errors.Errorf("column %s should be qualified by the table", col.Name.O)
+		}
+		if p.table == "" {
+			p.schema, p.table = col.Schema.L, col.Table.L
+		}
+		if col.Schema.L != p.schema || col.Table.L != p.table {
+			return nil, errors.New("all the columns should be of the same table")
+		}
+	}
+	if p.table == "" {
+		return nil, errors.New("no column of the table is referred")
+	}
+	return p, nil
+}
+
+// predicateChecker collects the columns of the predicate and fails on the
+// expressions can't be evaluated by eval.
+type predicateChecker struct {
+	columns []*ast.ColumnName
+	err     error
+}
+
+func (v *predicateChecker) Enter(in ast.Node) (ast.Node, bool) {
+	switch x := in.(type) {
+	case *ast.ColumnNameExpr:
+		v.columns = append(v.columns, x.Name)
+	case *ast.BinaryOperationExpr:
+		switch x.Op {
+		case opcode.LogicAnd, opcode.LogicOr, opcode.LogicXor,
+			opcode.EQ, opcode.NE, opcode.LT, opcode.LE, opcode.GT, opcode.GE, opcode.NullEQ:
+		default:
+			v.err = errors.Errorf("operator %s is not supported", x.Op)
+		}
+	case *ast.UnaryOperationExpr:
+		if x.Op != opcode.Not && x.Op != opcode.Minus {
+			v.err = errors.Errorf("operator %s is not supported", x.Op)
+		}
+	case *ast.PatternInExpr:
+		if x.Sel != nil {
+			v.err = errors.New("subquery is not supported")
+		}
+	case *ast.ColumnName, *driver.ValueExpr, *ast.ParenthesesExpr, *ast.BetweenExpr, *ast.IsNullExpr:
+	default:
+		v.err = errors.Errorf("expression %T is not supported", in)
+	}
+	return in, v.err != nil
+}
+
+func (v *predicateChecker) Leave(in ast.Node) (ast.Node, bool) {
+	return in, v.err == nil
+}
+
+func (p *rowPredicate) match(schema, table string) bool {
+	return strings.EqualFold(table, p.table) && (p.schema == "" || strings.EqualFold(schema, p.schema))
+}
+
+// skipEvent returns true if the row of the event doesn't match the predicates
+// of the table. An update is kept if either the old row or the new one matches,
+// so the rows moved into or out of the range are restored too.
+func (f *rowFilter) skipEvent(event *pb.Event) (bool, error) {
+	var predicates []*rowPredicate
+	for _, p := range f.predicates {
+		if p.match(event.GetSchemaName(), event.GetTableName()) {
+			predicates = append(predicates, p)
+		}
+	}
+	if len(predicates) == 0 {
+		return false, nil
+	}
+
+	oldRow, newRow, err := decodeEventRow(event)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	for _, row := range []map[string]types.Datum{oldRow, newRow} {
+		if row == nil {
+			continue
+		}
+		matched, err := f.matchRow(predicates, row)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		if matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (f *rowFilter) matchRow(predicates []*rowPredicate, row map[string]types.Datum) (bool, error) {
+	for _, p := range predicates {
+		d, err := f.eval(p.expr, row)
+		if err != nil {
+			return false, errors.Annotatef(err, "evaluate %q failed", p.where)
+		}
+		// NULL is false as in the WHERE clause.
+		b, _, err := f.truth(d)
+		if err != nil || !b {
+			return false, errors.Trace(err)
+		}
+	}
+	return true, nil
+}
+
+// decodeEventRow returns the columns of the row by the lower case names, the
+// old row is only returned for update.
+func decodeEventRow(event *pb.Event) (oldRow, newRow map[string]types.Datum, err error) {
+	newRow = make(map[string]types.Datum, len(event.Row))
+	if event.GetTp() == pb.EventType_Update {
+		oldRow = make(map[string]types.Datum, len(event.Row))
+	}
+	for _, c := range event.Row {
+		col := &pb.Column{}
+		if err = col.Unmarshal(c); err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		name := strings.ToLower(col.Name)
+		_, value, err := codec.DecodeOne(col.Value)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		if oldRow == nil {
+			newRow[name] = value
+			continue
+		}
+		oldRow[name] = value
+		_, newRow[name], err = codec.DecodeOne(col.ChangedValue)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+	}
+	return
+}
+
+func boolDatum(b bool) types.Datum {
+	if b {
+		return types.NewIntDatum(1)
+	}
+	return types.NewIntDatum(0)
+}
+
+// truth returns the boolean value of the datum, and false if it's NULL.
+func (f *rowFilter) truth(d types.Datum) (b bool, isNull bool, err error) {
+	if d.IsNull() {
+		return false, true, nil
+	}
+	i, err := d.ToBool(f.sc)
+	return i != 0, false, errors.Trace(err)
+}
+
+// eval evaluates the expression checked by predicateChecker on the row with
+// the three-valued logic of SQL.
+func (f *rowFilter) eval(expr ast.ExprNode, row map[string]types.Datum) (types.Datum, error) {
+	var null types.Datum
+	switch x := expr.(type) {
+	case *driver.ValueExpr:
+		return x.Datum, nil
+	case *ast.ParenthesesExpr:
+		return f.eval(x.Expr, row)
+	case *ast.ColumnNameExpr:
+		d, ok := row[x.Name.Name.L]
+		if !ok {
+			return null, errors.Errorf("column %s not found", x.Name.Name.O)
+		}
+		return d, nil
+	case *ast.UnaryOperationExpr:
+		d, err := f.eval(x.V, row)
+		if err != nil || d.IsNull() {
+			return d, errors.Trace(err)
+		}
+		if x.Op == opcode.Minus {
+			return negate(d)
+		}
+		b, _, err := f.truth(d)
+		return boolDatum(!b), errors.Trace(err)
+	case *ast.IsNullExpr:
+		d, err := f.eval(x.Expr, row)
+		return boolDatum(d.IsNull() != x.Not), errors.Trace(err)
+	case *ast.BetweenExpr:
+		d, err := f.eval(x.Expr, row)
+		if err != nil || d.IsNull() {
+			return d, errors.Trace(err)
+		}
+		left, err := f.compare(d, x.Left, row)
+		if err != nil || left == nil {
+			return null, errors.Trace(err)
+		}
+		right, err := f.compare(d, x.Right, row)
+		if err != nil || right == nil {
+			return null, errors.Trace(err)
+		}
+		return boolDatum((*left >= 0 && *right <= 0) != x.Not), nil
+	case *ast.PatternInExpr:
+		d, err := f.eval(x.Expr, row)
+		if err != nil || d.IsNull() {
+			return d, errors.Trace(err)
+		}
+		for _, e := range x.List {
+			cmp, err := f.compare(d, e, row)
+			if err != nil {
+				return null, errors.Trace(err)
+			}
+			if cmp != nil && *cmp == 0 {
+				return boolDatum(!x.Not), nil
+			}
+		}
+		return boolDatum(x.Not), nil
+	case *ast.BinaryOperationExpr:
+		return f.evalBinary(x, row)
+	default:
+		return null, errors.Errorf("expression %T is not supported", expr)
+	}
+}
+
+func (f *rowFilter) evalBinary(x *ast.BinaryOperationExpr, row map[string]types.Datum) (types.Datum, error) {
+	var null types.Datum
+	l, err := f.eval(x.L, row)
+	if err != nil {
+		return null, errors.Trace(err)
+	}
+
+	switch x.Op {
+	case opcode.LogicAnd, opcode.LogicOr, opcode.LogicXor:
+		lb, lNull, err := f.truth(l)
+		if err != nil {
+			return null, errors.Trace(err)
+		}
+		// short circuit.
+		if !lNull && ((x.Op == opcode.LogicAnd && !lb) || (x.Op == opcode.LogicOr && lb)) {
+			return boolDatum(lb), nil
+		}
+		r, err := f.eval(x.R, row)
+		if err != nil {
+			return null, errors.Trace(err)
+		}
+		rb, rNull, err := f.truth(r)
+		if err != nil {
+			return null, errors.Trace(err)
+		}
+		switch {
+		case x.Op == opcode.LogicAnd && !rNull && !rb:
+			return boolDatum(false), nil
+		case x.Op == opcode.LogicOr && !rNull && rb:
+			return boolDatum(true), nil
+		case lNull || rNull:
+			return null, nil
+		case x.Op == opcode.LogicXor:
+			return boolDatum(lb != rb), nil
+		default:
+			return boolDatum(rb), nil
+		}
+	case opcode.NullEQ:
+		r, err := f.eval(x.R, row)
+		if err != nil {
+			return null, errors.Trace(err)
+		}
+		if l.IsNull() || r.IsNull() {
+			return boolDatum(l.IsNull() && r.IsNull()), nil
+		}
+		cmp, err := l.CompareDatum(f.sc, &r)
+		return boolDatum(cmp == 0), errors.Trace(err)
+	}
+
+	if l.IsNull() {
+		return null, nil
+	}
+	cmp, err := f.compare(l, x.R, row)
+	if err != nil || cmp == nil {
+		return null, errors.Trace(err)
+	}
+	switch x.Op {
+	case opcode.EQ:
+		return boolDatum(*cmp == 0), nil
+	case opcode.NE:
+		return boolDatum(*cmp != 0), nil
+	case opcode.LT:
+		return boolDatum(*cmp < 0), nil
+	case opcode.LE:
+		return boolDatum(*cmp <= 0), nil
+	case opcode.GT:
+		return boolDatum(*cmp > 0), nil
+	default:
+		return boolDatum(*cmp >= 0), nil
+	}
+}
+
+// compare compares d with the value of expr, nil is returned if it's NULL.
+func (f *rowFilter) compare(d types.Datum, expr ast.ExprNode, row map[string]types.Datum) (*int, error) {
+	v, err := f.eval(expr, row)
+	if err != nil || v.IsNull() {
+		return nil, errors.Trace(err)
+	}
+	cmp, err := d.CompareDatum(f.sc, &v)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &cmp, nil
+}
+
+func negate(d types.Datum) (types.Datum, error) {
+	switch d.Kind() {
+	case types.KindInt64:
+		return types.NewIntDatum(-d.GetInt64()), nil
+	case types.KindFloat32, types.KindFloat64:
+		return types.NewFloat64Datum(-d.GetFloat64()), nil
+	case types.KindMysqlDecimal:
+		dec := new(types.MyDecimal)
+		if err := types.DecimalSub(new(types.MyDecimal), d.GetMysqlDecimal(), dec); err != nil {
+			return d, errors.Trace(err)
+		}
+		return types.NewDecimalDatum(dec), nil
+	default:
+		return d, errors.Errorf("can't negate %v", d.GetValue())
+	}
+}
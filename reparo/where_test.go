@@ -0,0 +1,185 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reparo
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-binlog/pkg/filter"
+	pb "github.com/pingcap/tidb-binlog/proto/binlog"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+type testWhereSuite struct{}
+
+var _ = Suite(&testWhereSuite{})
+
+func encodeDatum(c *C, v interface{}) []byte {
+	value, err := codec.EncodeValue(nil, nil, types.NewDatum(v))
+	c.Assert(err, IsNil)
+	return value
+}
+
+// rowEvent creates an event of test.orders with the columns id and status,
+// the update changes id by delta.
+func rowEvent(c *C, tp pb.EventType, id int64, status interface{}, delta int64) pb.Event {
+	newColumn := func(name string, v, changed interface{}) []byte {
+		col := &pb.Column{Name: name, Value: encodeDatum(c, v)}
+		if tp == pb.EventType_Update {
+			col.ChangedValue = encodeDatum(c, changed)
+		}
+		data, err := col.Marshal()
+		c.Assert(err, IsNil)
+		return data
+	}
+	schema, table := "test", "orders"
+	return pb.Event{
+		SchemaName: &schema,
+		TableName:  &table,
+		Tp:         tp,
+		Row: [][]byte{
+			newColumn("id", id, id+delta),
+			newColumn("Status", status, status),
+		},
+	}
+}
+
+func (s *testWhereSuite) TestParseRowPredicate(c *C) {
+	p, err := parseRowPredicate("Test.Orders.id BETWEEN 100 AND 200")
+	c.Assert(err, IsNil)
+	c.Assert(p.schema, Equals, "test")
+	c.Assert(p.table, Equals, "orders")
+	c.Assert(p.match("TEST", "orders"), IsTrue)
+	c.Assert(p.match("test2", "orders"), IsFalse)
+
+	p, err = parseRowPredicate("orders.id > 1 AND (orders.status IN ('paid', 'sent') OR orders.status IS NULL)")
+	c.Assert(err, IsNil)
+	c.Assert(p.schema, Equals, "")
+	c.Assert(p.match("test2", "orders"), IsTrue)
+
+	for _, where := range []string{
+		"id > 1",
+		"orders.id > users.id",
+		"1 = 1",
+		"orders.id > 1 ORDER BY orders.id",
+		"orders.id + 1 > 2",
+		"orders.id IN (SELECT id FROM t)",
+		"orders.status LIKE 'p%'",
+		"orders.id >",
+	} {
+		_, err := parseRowPredicate(where)
+		c.Assert(err, NotNil, Commentf("%s", where))
+	}
+}
+
+func (s *testWhereSuite) TestSkipEvent(c *C) {
+	f, err := newRowFilter([]string{"orders.id BETWEEN 100 AND 200", "orders.status != 'canceled'"})
+	c.Assert(err, IsNil)
+
+	tests := []struct {
+		event pb.Event
+		skip  bool
+	}{
+		{rowEvent(c, pb.EventType_Insert, 100, "paid", 0), false},
+		{rowEvent(c, pb.EventType_Delete, 200, "paid", 0), false},
+		{rowEvent(c, pb.EventType_Insert, 99, "paid", 0), true},
+		{rowEvent(c, pb.EventType_Insert, 150, "canceled", 0), true},
+		// NULL doesn't match.
+		{rowEvent(c, pb.EventType_Insert, 150, nil, 0), true},
+		// moved into or out of the range.
+		{rowEvent(c, pb.EventType_Update, 90, "paid", 20), false},
+		{rowEvent(c, pb.EventType_Update, 190, "paid", 20), false},
+		{rowEvent(c, pb.EventType_Update, 10, "paid", 20), true},
+	}
+	for i, t := range tests {
+		skip, err := f.skipEvent(&t.event)
+		c.Assert(err, IsNil)
+		c.Assert(skip, Equals, t.skip, Commentf("case %d", i))
+	}
+
+	// the rows of other tables are kept.
+	event := rowEvent(c, pb.EventType_Insert, 1, "paid", 0)
+	*event.TableName = "users"
+	skip, err := f.skipEvent(&event)
+	c.Assert(err, IsNil)
+	c.Assert(skip, IsFalse)
+
+	f, err = newRowFilter([]string{"orders.price > 1"})
+	c.Assert(err, IsNil)
+	event = rowEvent(c, pb.EventType_Insert, 1, "paid", 0)
+	_, err = f.skipEvent(&event)
+	c.Assert(err, ErrorMatches, ".*column price not found.*")
+}
+
+func (s *testWhereSuite) TestEval(c *C) {
+	row := map[string]types.Datum{
+		"id":     types.NewIntDatum(5),
+		"status": types.NewBytesDatum([]byte("paid")),
+		"note":   types.NewDatum(nil),
+	}
+	tests := []struct {
+		where  string
+		result interface{}
+	}{
+		{"t.id = 5", int64(1)},
+		{"t.id = '5'", int64(1)},
+		{"t.id <=> 5", int64(1)},
+		{"t.note <=> NULL", int64(1)},
+		{"t.id >= -1", int64(1)},
+		{"t.id < 5.5", int64(1)},
+		{"t.id NOT BETWEEN 1 AND 4", int64(1)},
+		{"t.id IN (1, NULL)", int64(0)},
+		{"t.status = 'paid'", int64(1)},
+		{"NOT t.status = 'paid'", int64(0)},
+		{"t.note IS NOT NULL", int64(0)},
+		{"t.note = 1", nil},
+		{"t.note = 1 AND t.id = 4", int64(0)},
+		{"t.note = 1 OR t.id = 5", int64(1)},
+		{"t.note = 1 OR t.id = 4", nil},
+		{"t.id = 5 XOR t.id = 4", int64(1)},
+	}
+	f, err := newRowFilter(nil)
+	c.Assert(err, IsNil)
+	for _, t := range tests {
+		p, err := parseRowPredicate(t.where)
+		c.Assert(err, IsNil)
+		d, err := f.eval(p.expr, row)
+		c.Assert(err, IsNil)
+		c.Assert(d.GetValue(), Equals, t.result, Commentf("%s", t.where))
+	}
+}
+
+func (s *testWhereSuite) TestFilterBinlog(c *C) {
+	f, err := newRowFilter([]string{"orders.id < 10"})
+	c.Assert(err, IsNil)
+
+	binlog := &pb.Binlog{
+		Tp: pb.BinlogType_DML,
+		DmlData: &pb.DMLData{Events: []pb.Event{
+			rowEvent(c, pb.EventType_Insert, 1, "paid", 0),
+			rowEvent(c, pb.EventType_Insert, 11, "paid", 0),
+		}},
+	}
+	noFilter, err := filter.NewFilter(nil, nil, nil, nil)
+	c.Assert(err, IsNil)
+	ignore, err := filterBinlog(noFilter, f, binlog)
+	c.Assert(err, IsNil)
+	c.Assert(ignore, IsFalse)
+	c.Assert(binlog.DmlData.Events, HasLen, 1)
+
+	binlog.DmlData.Events[0] = rowEvent(c, pb.EventType_Insert, 12, "paid", 0)
+	ignore, err = filterBinlog(noFilter, f, binlog)
+	c.Assert(err, IsNil)
+	c.Assert(ignore, IsTrue)
+}
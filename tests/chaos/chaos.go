@@ -0,0 +1,202 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The chaos test runs the workload of dailytest while killing, pausing
+// and restarting pumps and drainer randomly, then checks the downstream is
+// the same as the upstream after all of them are recovered. Network
+// partitions are not covered.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"os"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/tests/dailytest"
+	"github.com/pingcap/tidb-binlog/tests/util"
+	"go.uber.org/zap"
+)
+
+var tableSQLs = []string{`
+create table chaos_ptest(
+	a int primary key,
+	b double NOT NULL DEFAULT 2.0,
+	c varchar(10) NOT NULL,
+	d time unique
+);
+`, `
+create table chaos_ntest(
+	a int,
+	b double NOT NULL DEFAULT 2.0,
+	c varchar(10) NOT NULL,
+	d time unique
+);
+`}
+
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return errors.Trace(err)
+}
+
+type chaosConfig struct {
+	Interval      duration `toml:"interval"`
+	FaultDuration duration `toml:"fault-duration"`
+	Seed          int64    `toml:"seed"`
+	PumpPorts     []int    `toml:"pump-ports"`
+	Faults        []string `toml:"faults"`
+	CheckTimeout  duration `toml:"check-timeout"`
+}
+
+type config struct {
+	WorkerCount int           `toml:"worker-count"`
+	JobCount    int           `toml:"job-count"`
+	Batch       int           `toml:"batch"`
+	SourceDBCfg util.DBConfig `toml:"source-db"`
+	TargetDBCfg util.DBConfig `toml:"target-db"`
+	Chaos       chaosConfig   `toml:"chaos"`
+}
+
+func loadConfig() (*config, error) {
+	fs := flag.NewFlagSet("chaos", flag.ContinueOnError)
+	configFile := fs.String("config", "", "Config file")
+	seed := fs.Int64("seed", 0, "seed of the random faults, overrides the one in config file")
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	cfg := &config{
+		WorkerCount: 1,
+		JobCount:    1,
+		Batch:       1,
+		Chaos: chaosConfig{
+			Interval:      duration{5 * time.Second},
+			FaultDuration: duration{10 * time.Second},
+			Faults:        []string{faultKill, faultPause},
+			CheckTimeout:  duration{5 * time.Minute},
+		},
+	}
+	if *configFile != "" {
+		if _, err := toml.DecodeFile(*configFile, cfg); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	if *seed != 0 {
+		cfg.Chaos.Seed = *seed
+	}
+
+	for _, fault := range cfg.Chaos.Faults {
+		if fault != faultKill && fault != faultPause {
+			return nil, errors.NotSupportedf("fault %s", fault)
+		}
+	}
+	if len(cfg.Chaos.Faults) == 0 {
+		return nil, errors.New("no fault to inject")
+	}
+	return cfg, nil
+}
+
+func main() {
+	cfg, err := loadConfig()
+	switch errors.Cause(err) {
+	case nil:
+	case flag.ErrHelp:
+		os.Exit(0)
+	default:
+		log.S().Errorf("parse cmd flags err %s\n", err)
+		os.Exit(2)
+	}
+
+	sourceDB, err := util.CreateDB(cfg.SourceDBCfg)
+	if err != nil {
+		log.S().Fatal(err)
+	}
+	defer func() {
+		if err := util.CloseDB(sourceDB); err != nil {
+			log.S().Errorf("Failed to close source database: %s\n", err)
+		}
+	}()
+
+	targetDB, err := util.CreateDB(cfg.TargetDBCfg)
+	if err != nil {
+		log.S().Fatal(err)
+	}
+	defer func() {
+		if err := util.CloseDB(targetDB); err != nil {
+			log.S().Errorf("Failed to close target database: %s\n", err)
+		}
+	}()
+
+	m := newNemesis(&cfg.Chaos)
+	runUnderChaos(m, func() {
+		dailytest.RunDailyTest(sourceDB, tableSQLs, cfg.WorkerCount, cfg.JobCount, cfg.Batch)
+	})
+	waitSync(sourceDB, targetDB, cfg.SourceDBCfg.Name, cfg.Chaos.CheckTimeout.Duration)
+
+	runUnderChaos(m, func() {
+		dailytest.DropTestTable(sourceDB, tableSQLs)
+	})
+	waitSync(sourceDB, targetDB, cfg.SourceDBCfg.Name, cfg.Chaos.CheckTimeout.Duration)
+
+	log.Info("chaos test pass")
+}
+
+// runUnderChaos runs the workload while injecting faults, and recovers all
+// the nodes after the workload is done.
+func runUnderChaos(m *nemesis, workload func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- m.run(ctx)
+	}()
+
+	workload()
+
+	cancel()
+	if err := <-errCh; err != nil {
+		log.Fatal("inject fault failed", zap.Error(err))
+	}
+	if err := m.heal(); err != nil {
+		log.Fatal("recover nodes failed", zap.Error(err))
+	}
+}
+
+func waitSync(src, dst *sql.DB, schema string, timeout time.Duration) {
+	tick := time.NewTicker(5 * time.Second)
+	defer tick.Stop()
+	deadline := time.After(timeout)
+
+	for {
+		select {
+		case <-tick.C:
+			if util.CheckSyncState(src, dst, schema) {
+				return
+			}
+		case <-deadline:
+			if !util.CheckSyncState(src, dst, schema) {
+				log.Fatal("sourceDB don't equal targetDB after all nodes recovered")
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+const (
+	faultKill  = "kill"
+	faultPause = "pause"
+)
+
+type nodeState int
+
+const (
+	nodeRunning nodeState = iota
+	nodeKilled
+	nodePaused
+)
+
+// node is a pump or drainer process started by the scripts in tests/_utils.
+type node struct {
+	name string
+	// pattern matches the command line of the process
+	pattern string
+	// start is the command to start the process
+	start  []string
+	isPump bool
+
+	state     nodeState
+	faultTime time.Time
+}
+
+func newPumpNode(port int) *node {
+	return &node{
+		name:    fmt.Sprintf("pump:%d", port),
+		pattern: fmt.Sprintf("node-id=pump:%d", port),
+		start:   []string{"run_pump", fmt.Sprint(port)},
+		isPump:  true,
+	}
+}
+
+func newDrainerNode() *node {
+	return &node{
+		name:    "drainer",
+		pattern: "drainer -log-file",
+		start:   []string{"run_drainer"},
+	}
+}
+
+func (n *node) signal(sig string) error {
+	out, err := exec.Command("pkill", "-"+sig, "-f", n.pattern).CombinedOutput()
+	return errors.Annotatef(err, "send %s to %s, output: %s", sig, n.name, out)
+}
+
+// kill kills the process, it's restarted when recovered.
+func (n *node) kill() error {
+	if err := n.signal("KILL"); err != nil {
+		return errors.Trace(err)
+	}
+	n.state = nodeKilled
+	n.faultTime = time.Now()
+	return nil
+}
+
+// pause stops the process by SIGSTOP, it continues when recovered. It's not a network partition:
+// the process keeps its connections and its timers don't fire while it's paused.
+func (n *node) pause() error {
+	if err := n.signal("STOP"); err != nil {
+		return errors.Trace(err)
+	}
+	n.state = nodePaused
+	n.faultTime = time.Now()
+	return nil
+}
+
+func (n *node) recover() error {
+	switch n.state {
+	case nodeKilled:
+		cmd := exec.Command(n.start[0], n.start[1:]...)
+		if err := cmd.Start(); err != nil {
+			return errors.Annotatef(err, "restart %s", n.name)
+		}
+		go func() {
+			// the process exits once it's killed again
+			_ = cmd.Wait()
+		}()
+	case nodePaused:
+		if err := n.signal("CONT"); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	n.state = nodeRunning
+	return nil
+}
+
+// nemesis injects the faults to the nodes randomly.
+type nemesis struct {
+	cfg   *chaosConfig
+	rand  *rand.Rand
+	nodes []*node
+}
+
+func newNemesis(cfg *chaosConfig) *nemesis {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Info("create nemesis", zap.Int64("seed", seed))
+
+	nodes := []*node{newDrainerNode()}
+	for _, port := range cfg.PumpPorts {
+		nodes = append(nodes, newPumpNode(port))
+	}
+
+	return &nemesis{
+		cfg:   cfg,
+		rand:  rand.New(rand.NewSource(seed)),
+		nodes: nodes,
+	}
+}
+
+// availablePumps returns the number of pumps which can receive binlogs now.
+func (m *nemesis) availablePumps() int {
+	var count int
+	for _, n := range m.nodes {
+		if n.isPump && n.state == nodeRunning {
+			count++
+		}
+	}
+	return count
+}
+
+// run injects a fault every interval until ctx is done, the node is recovered
+// after the fault duration.
+func (m *nemesis) run(ctx context.Context) error {
+	ticker := time.NewTicker(m.cfg.Interval.Duration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		for _, n := range m.nodes {
+			if n.state != nodeRunning && time.Since(n.faultTime) >= m.cfg.FaultDuration.Duration {
+				log.Info("recover node", zap.String("node", n.name))
+				if err := n.recover(); err != nil {
+					return errors.Trace(err)
+				}
+			}
+		}
+
+		if err := m.inject(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
+func (m *nemesis) inject() error {
+	var candidates []*node
+	for _, n := range m.nodes {
+		if n.state != nodeRunning {
+			continue
+		}
+		// keep one pump at least, or TiDB fails to write binlogs
+		if n.isPump && m.availablePumps() <= 1 {
+			continue
+		}
+		candidates = append(candidates, n)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	n := candidates[m.rand.Intn(len(candidates))]
+	fault := m.cfg.Faults[m.rand.Intn(len(m.cfg.Faults))]
+	log.Info("inject fault", zap.String("node", n.name), zap.String("fault", fault))
+
+	switch fault {
+	case faultKill:
+		return errors.Trace(n.kill())
+	case faultPause:
+		return errors.Trace(n.pause())
+	default:
+		return errors.NotSupportedf("fault %s", fault)
+	}
+}
+
+// heal recovers all the nodes.
+func (m *nemesis) heal() error {
+	for _, n := range m.nodes {
+		if n.state == nodeRunning {
+			continue
+		}
+		log.Info("recover node", zap.String("node", n.name))
+		if err := n.recover(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+
+run_drainer &
+
+# the pump killed and paused besides the one started by tests/run.sh
+run_pump 8251 &
+sleep 5
+
+GO111MODULE=on go build -o out
+
+./out -config ./config.toml > ${OUT_DIR-/tmp}/$TEST_NAME.out 2>&1
+
+killall drainer
+
+binlogctl -ssl-ca $OUT_DIR/cert/ca.pem \
+    -ssl-cert $OUT_DIR/cert/client.pem \
+    -ssl-key $OUT_DIR/cert/client.key \
+    -pd-urls https://127.0.0.1:2379 -cmd offline-pump -node-id pump:8251
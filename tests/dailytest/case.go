@@ -169,6 +169,29 @@ var caseUKWithNoPKClean = []string{`
 	DROP TABLE binlog_uk_with_no_pk`,
 }
 
+// the NULL values of the unique keys don't conflict, the rows with them are synced concurrently,
+// but the non-NULL values moved between the rows must be synced in order.
+var caseUKWithNull = []string{`
+CREATE TABLE binlog_uk_with_null (id INT PRIMARY KEY, a1 INT, a2 INT, UNIQUE KEY uk1(a1), UNIQUE KEY uk2(a1, a2));
+`,
+	`
+INSERT INTO binlog_uk_with_null(id, a1, a2) VALUES(1, NULL, NULL), (2, NULL, NULL), (3, NULL, 1), (4, 10, NULL), (5, 20, NULL);
+`,
+	`
+UPDATE binlog_uk_with_null SET a2 = 2 WHERE a1 IS NULL;
+`,
+	`
+DELETE FROM binlog_uk_with_null WHERE id = 2;
+`,
+	`
+INSERT INTO binlog_uk_with_null(id, a1, a2) VALUES(2, NULL, 2), (6, NULL, NULL);
+`,
+}
+
+var caseUKWithNullClean = []string{`
+	DROP TABLE binlog_uk_with_null`,
+}
+
 var casePKAddDuplicateUK = []string{`
 CREATE TABLE binlog_pk_add_duplicate_uk(id INT PRIMARY KEY, a1 INT);
 `,
@@ -281,6 +304,35 @@ func RunCase(src *sql.DB, dst *sql.DB, schema string) {
 	tr.execSQLs(caseUKWithNoPK)
 	tr.execSQLs(caseUKWithNoPKClean)
 
+	tr.execSQLs(caseUKWithNull)
+	// move the unique values between the rows with NULL values in one transaction
+	tr.run(func(src *sql.DB) {
+		tx, err := src.Begin()
+		if err != nil {
+			log.S().Fatal(err)
+		}
+
+		sqls := []string{
+			"update binlog_uk_with_null set a1 = NULL where id = 4",
+			"update binlog_uk_with_null set a1 = 10 where id = 1",
+			"update binlog_uk_with_null set a1 = NULL where id = 5",
+			"update binlog_uk_with_null set a1 = 20 where id = 2",
+			"update binlog_uk_with_null set a1 = 30 where id = 6",
+			"update binlog_uk_with_null set a1 = NULL where id = 6",
+		}
+		for _, query := range sqls {
+			if _, err = tx.Exec(query); err != nil {
+				log.S().Fatal(err)
+			}
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			log.S().Fatal(err)
+		}
+	})
+	tr.execSQLs(caseUKWithNullClean)
+
 	tr.execSQLs(caseAlterDatabase)
 	tr.execSQLs(caseAlterDatabaseClean)
 
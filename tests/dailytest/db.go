@@ -383,3 +383,15 @@ func RunTest(src *sql.DB, dst *sql.DB, schema string, writeSrc func(src *sql.DB)
 		}
 	}
 }
+
+// waitSync waits until dst is the same as src, it returns false if they're not the same after timeout.
+func waitSync(src *sql.DB, dst *sql.DB, schema string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for !util.CheckSyncState(src, dst, schema) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Second)
+	}
+	return true
+}
@@ -23,6 +23,11 @@ import (
 
 // RunDailyTest generates insert/update/delete sqls and execute
 func RunDailyTest(db *sql.DB, tableSQLs []string, workerCount int, jobCount int, batch int) {
+	runTables(db, tableSQLs, workerCount, jobCount, batch, 1)
+}
+
+// runTables creates the tables and runs the workload on them concurrently.
+func runTables(db *sql.DB, tableSQLs []string, workerCount int, jobCount int, batch int, ddlRounds int) {
 	var wg sync.WaitGroup
 	wg.Add(len(tableSQLs))
 
@@ -41,7 +46,7 @@ func RunDailyTest(db *sql.DB, tableSQLs []string, workerCount int, jobCount int,
 				log.S().Fatal(err)
 			}
 
-			doProcess(table, db, jobCount, workerCount, batch)
+			doProcessWithDDL(table, db, jobCount, workerCount, batch, ddlRounds)
 		}(i)
 	}
 
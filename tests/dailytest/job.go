@@ -161,12 +161,18 @@ func doDDLProcess(table *table, db *sql.DB) {
 	execSqls(db, []string{sql}, [][]interface{}{{}})
 }
 
-func doProcess(table *table, db *sql.DB, jobCount int, workerCount int, batch int) {
-	if len(table.columns) <= 2 {
+// doProcessWithDDL splits the jobs evenly into ddlRounds+1 parts, a round of dropping and
+// adding a column runs between every two parts.
+func doProcessWithDDL(table *table, db *sql.DB, jobCount int, workerCount int, batch int, ddlRounds int) {
+	if ddlRounds > 0 && len(table.columns) <= 2 {
 		log.S().Fatal("column count must > 2, and the first and second column are for primary key")
 	}
 
-	doDMLProcess(table, db, jobCount/2, workerCount, batch)
-	doDDLProcess(table, db)
-	doDMLProcess(table, db, jobCount/2, workerCount, batch)
+	parts := ddlRounds + 1
+	for i := 0; i < parts; i++ {
+		if i > 0 {
+			doDDLProcess(table, db)
+		}
+		doDMLProcess(table, db, jobCount/parts, workerCount, batch)
+	}
 }
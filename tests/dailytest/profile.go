@@ -0,0 +1,268 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dailytest
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"sigs.k8s.io/yaml"
+)
+
+// Profile is a named workload, the jobs of each table are split into DDLRounds+1 parts,
+// and a round of dropping and adding a column runs between every two parts.
+type Profile struct {
+	Name        string   `json:"name"`
+	Tables      []string `json:"tables"`
+	WorkerCount int      `json:"worker-count"`
+	JobCount    int      `json:"job-count"`
+	Batch       int      `json:"batch"`
+	DDLRounds   int      `json:"ddl-rounds"`
+}
+
+// ProfileResult is the result of running a profile.
+type ProfileResult struct {
+	Name     string `json:"name"`
+	Tables   int    `json:"tables"`
+	JobCount int    `json:"job-count"`
+	// WriteSeconds is how long the workload is written to the source.
+	WriteSeconds float64 `json:"write-seconds"`
+	JobsPerSec   float64 `json:"jobs-per-sec"`
+	// SyncSeconds is how long the target takes to catch up after the workload is written.
+	SyncSeconds float64 `json:"sync-seconds"`
+}
+
+var builtinProfiles = map[string]*Profile{
+	"write-heavy": {
+		Tables: []string{`
+create table loadgen_write_heavy(
+	a int primary key,
+	b double NOT NULL DEFAULT 2.0,
+	c varchar(10) NOT NULL,
+	d time unique
+);
+`},
+		WorkerCount: 32,
+		JobCount:    100000,
+		Batch:       100,
+	},
+	"wide-rows": {
+		Tables:      []string{wideRowsTableSQL("loadgen_wide_rows", 64)},
+		WorkerCount: 8,
+		JobCount:    20000,
+		Batch:       20,
+	},
+	"many-small-txns": {
+		Tables: []string{`
+create table loadgen_small_txns(
+	a int primary key,
+	b int NOT NULL,
+	c varchar(10) NOT NULL
+);
+`},
+		WorkerCount: 64,
+		JobCount:    50000,
+		Batch:       1,
+	},
+	"ddl-churn": {
+		Tables: []string{`
+create table loadgen_ddl_churn_1(
+	a int primary key,
+	b double NOT NULL DEFAULT 2.0,
+	c varchar(10) NOT NULL,
+	d time unique
+);
+`, `
+create table loadgen_ddl_churn_2(
+	a int,
+	b double NOT NULL DEFAULT 2.0,
+	c varchar(10) NOT NULL,
+	d time unique
+);
+`},
+		WorkerCount: 4,
+		JobCount:    5000,
+		Batch:       10,
+		DDLRounds:   50,
+	},
+	"blob-heavy": {
+		Tables: []string{`
+create table loadgen_blob_heavy(
+	a int primary key,
+	b varchar(10) NOT NULL,
+	c blob(16384),
+	d text(16384)
+);
+`},
+		WorkerCount: 8,
+		JobCount:    5000,
+		Batch:       5,
+	},
+}
+
+func init() {
+	for name, p := range builtinProfiles {
+		p.Name = name
+	}
+}
+
+// wideRowsTableSQL returns the table with n columns besides the primary key.
+func wideRowsTableSQL(name string, n int) string {
+	cols := []string{"\n\ta int primary key"}
+	for i := 0; i < n; i++ {
+		switch i % 4 {
+		case 0:
+			cols = append(cols, fmt.Sprintf("\n\tc%d bigint", i))
+		case 1:
+			cols = append(cols, fmt.Sprintf("\n\tc%d varchar(64)", i))
+		case 2:
+			cols = append(cols, fmt.Sprintf("\n\tc%d double", i))
+		default:
+			cols = append(cols, fmt.Sprintf("\n\tc%d datetime", i))
+		}
+	}
+	return fmt.Sprintf("create table %s(%s\n);", name, strings.Join(cols, ","))
+}
+
+// ProfileNames returns the names of the builtin profiles.
+func ProfileNames() []string {
+	names := make([]string, 0, len(builtinProfiles))
+	for name := range builtinProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadProfiles returns the profiles of the names, "all" means all builtin profiles.
+// The profiles in the YAML file override the builtin ones with the same name, the
+// fields not set in the file are kept, the others in the file are new profiles.
+//
+//	profiles:
+//	- name: write-heavy
+//	  job-count: 1000000
+func LoadProfiles(names []string, file string) ([]*Profile, error) {
+	profiles := make(map[string]*Profile, len(builtinProfiles))
+	for name, p := range builtinProfiles {
+		clone := *p
+		profiles[name] = &clone
+	}
+
+	if len(file) > 0 {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		var content struct {
+			Profiles []*Profile `json:"profiles"`
+		}
+		if err = yaml.Unmarshal(data, &content); err != nil {
+			return nil, errors.Annotatef(err, "parse profile file %s", file)
+		}
+		for _, p := range content.Profiles {
+			if len(p.Name) == 0 {
+				return nil, errors.Errorf("profile without name in %s", file)
+			}
+			if base, ok := profiles[p.Name]; ok {
+				p.merge(base)
+			}
+			profiles[p.Name] = p
+		}
+	}
+
+	var result []*Profile
+	for _, name := range names {
+		if name == "all" {
+			for _, n := range ProfileNames() {
+				result = append(result, profiles[n])
+			}
+			continue
+		}
+		p, ok := profiles[name]
+		if !ok {
+			return nil, errors.Errorf("unknown profile %s, the builtin profiles are %v", name, ProfileNames())
+		}
+		result = append(result, p)
+	}
+	for _, p := range result {
+		if err := p.validate(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return result, nil
+}
+
+// merge sets the fields not set to the ones of base.
+func (p *Profile) merge(base *Profile) {
+	if len(p.Tables) == 0 {
+		p.Tables = base.Tables
+	}
+	if p.WorkerCount == 0 {
+		p.WorkerCount = base.WorkerCount
+	}
+	if p.JobCount == 0 {
+		p.JobCount = base.JobCount
+	}
+	if p.Batch == 0 {
+		p.Batch = base.Batch
+	}
+	if p.DDLRounds == 0 {
+		p.DDLRounds = base.DDLRounds
+	}
+}
+
+func (p *Profile) validate() error {
+	if len(p.Tables) == 0 || p.WorkerCount <= 0 || p.JobCount <= 0 || p.Batch <= 0 || p.DDLRounds < 0 {
+		return errors.Errorf("invalid profile %+v, the tables, worker-count, job-count and batch must be set", *p)
+	}
+	return nil
+}
+
+// RunProfile runs the workload of the profile on the source, and waits until the target
+// is the same as the source, the tables are dropped after that.
+func RunProfile(src *sql.DB, dst *sql.DB, schema string, p *Profile, syncTimeout time.Duration) (*ProfileResult, error) {
+	log.Info("run profile", zap.String("profile", p.Name), zap.Int("tables", len(p.Tables)), zap.Int("job count", p.JobCount),
+		zap.Int("worker count", p.WorkerCount), zap.Int("batch", p.Batch), zap.Int("ddl rounds", p.DDLRounds))
+
+	start := time.Now()
+	runTables(src, p.Tables, p.WorkerCount, p.JobCount, p.Batch, p.DDLRounds)
+	result := &ProfileResult{
+		Name:         p.Name,
+		Tables:       len(p.Tables),
+		JobCount:     p.JobCount,
+		WriteSeconds: time.Since(start).Seconds(),
+	}
+	result.JobsPerSec = float64(p.JobCount*len(p.Tables)) / result.WriteSeconds
+
+	written := time.Now()
+	if !waitSync(src, dst, schema, syncTimeout) {
+		return nil, errors.Errorf("target is not the same as source %s after the profile %s", syncTimeout, p.Name)
+	}
+	result.SyncSeconds = time.Since(written).Seconds()
+	log.Info("run profile success", zap.String("profile", p.Name), zap.Float64("write seconds", result.WriteSeconds),
+		zap.Float64("jobs per second", result.JobsPerSec), zap.Float64("sync seconds", result.SyncSeconds))
+
+	DropTestTable(src, p.Tables)
+	if !waitSync(src, dst, schema, syncTimeout) {
+		return nil, errors.Errorf("target is not the same as source %s after dropping the tables of profile %s", syncTimeout, p.Name)
+	}
+	return result, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The loadgen test runs the named workload profiles of dailytest one by one, and
+// records how fast each one is written and replicated, so the performance of pump
+// and drainer can be tracked per profile.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-binlog/tests/dailytest"
+	"github.com/pingcap/tidb-binlog/tests/util"
+)
+
+func main() {
+	cfg := util.NewConfig()
+	profileNames := cfg.FlagSet.String("profile", "all", fmt.Sprintf("comma separated profiles to run, \"all\" or some of %v", dailytest.ProfileNames()))
+	profileFile := cfg.FlagSet.String("profile-file", "", "YAML file of the profiles, overrides the builtin ones with the same name")
+	resultFile := cfg.FlagSet.String("result", "", "file to write the results to, one JSON line per profile")
+	syncTimeout := cfg.FlagSet.Duration("sync-timeout", 10*time.Minute, "how long to wait for the target to catch up after a profile")
+	err := cfg.Parse(os.Args[1:])
+	switch errors.Cause(err) {
+	case nil:
+	case flag.ErrHelp:
+		os.Exit(0)
+	default:
+		log.S().Errorf("parse cmd flags err %s\n", err)
+		os.Exit(2)
+	}
+
+	profiles, err := dailytest.LoadProfiles(strings.Split(*profileNames, ","), *profileFile)
+	if err != nil {
+		log.S().Fatal(err)
+	}
+
+	sourceDB, err := util.CreateDB(cfg.SourceDBCfg)
+	if err != nil {
+		log.S().Fatal(err)
+	}
+	defer func() {
+		if err := util.CloseDB(sourceDB); err != nil {
+			log.S().Errorf("Failed to close source database: %s\n", err)
+		}
+	}()
+
+	targetDB, err := util.CreateDB(cfg.TargetDBCfg)
+	if err != nil {
+		log.S().Fatal(err)
+	}
+	defer func() {
+		if err := util.CloseDB(targetDB); err != nil {
+			log.S().Errorf("Failed to close target database: %s\n", err)
+		}
+	}()
+
+	var results []*dailytest.ProfileResult
+	for _, p := range profiles {
+		result, err := dailytest.RunProfile(sourceDB, targetDB, cfg.SourceDBCfg.Name, p, *syncTimeout)
+		if err != nil {
+			log.S().Fatal(err)
+		}
+		results = append(results, result)
+	}
+
+	if len(*resultFile) > 0 {
+		if err = writeResults(*resultFile, results); err != nil {
+			log.S().Fatal(err)
+		}
+	}
+	log.S().Info("loadgen pass!!!")
+}
+
+func writeResults(path string, results []*dailytest.ProfileResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, result := range results {
+		if err = enc.Encode(result); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(f.Sync())
+}
@@ -0,0 +1,14 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+
+run_drainer &
+
+GO111MODULE=on go build -o out
+
+./out -config ./config.toml -profile all -profile-file ./profiles.yaml \
+    -result ${OUT_DIR-/tmp}/$TEST_NAME.result.json > ${OUT_DIR-/tmp}/$TEST_NAME.out 2>&1
+
+killall drainer